@@ -28,6 +28,9 @@ func RegisterProcessAPI(mux *http.ServeMux, absPath string) {
 	})
 	mux.HandleFunc("POST /api/process/start", handleStartGateway)
 	mux.HandleFunc("POST /api/process/stop", handleStopGateway)
+	mux.HandleFunc("POST /api/process/reload", func(w http.ResponseWriter, r *http.Request) {
+		handleReloadGateway(w, r, absPath)
+	})
 }
 
 func handleStartGateway(w http.ResponseWriter, r *http.Request) {
@@ -134,7 +137,9 @@ func handleStopGateway(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func handleStatusGateway(w http.ResponseWriter, r *http.Request, absPath string) {
+// gatewayBaseURL returns the base URL of the gateway's HTTP server as
+// configured in the config file at absPath.
+func gatewayBaseURL(absPath string) string {
 	cfg, cfgErr := config.LoadConfig(absPath)
 	host := "127.0.0.1"
 	port := 18790
@@ -146,10 +151,12 @@ func handleStatusGateway(w http.ResponseWriter, r *http.Request, absPath string)
 			port = cfg.Gateway.Port
 		}
 	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
 
-	url := fmt.Sprintf("http://%s/health", net.JoinHostPort(host, strconv.Itoa(port)))
+func handleStatusGateway(w http.ResponseWriter, r *http.Request, absPath string) {
 	client := http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get(url)
+	resp, err := client.Get(gatewayBaseURL(absPath) + "/health")
 
 	// Build the response data map
 	data := map[string]any{}
@@ -185,6 +192,27 @@ func handleStatusGateway(w http.ResponseWriter, r *http.Request, absPath string)
 	json.NewEncoder(w).Encode(data)
 }
 
+// handleReloadGateway asks the running gateway to reload its config file and
+// relays the result.
+func handleReloadGateway(w http.ResponseWriter, r *http.Request, absPath string) {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(gatewayBaseURL(absPath)+"/reload", "application/json", nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reach gateway: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read gateway response: %v", err), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+}
+
 // appendLogData reads log_offset and log_run_id query params from the request and
 // populates the response data map with incremental log lines.
 func appendLogData(r *http.Request, data map[string]any) {
@@ -30,7 +30,10 @@ type providerStatus struct {
 func RegisterConfigAPI(mux *http.ServeMux, absPath string) {
 	// GET /api/config — read config
 	mux.HandleFunc("GET /api/config", func(w http.ResponseWriter, r *http.Request) {
-		cfg, err := config.LoadConfig(absPath)
+		// Return secret references as written, without resolving them: the
+		// editor never sees, and PUT never persists, the resolved secrets, and
+		// loading the page never runs a cmd: reference.
+		cfg, err := config.LoadConfigRefs(absPath)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to load config: %v", err), http.StatusInternalServerError)
 			return
@@ -62,6 +65,41 @@ func RegisterConfigAPI(mux *http.ServeMux, absPath string) {
 			return
 		}
 
+		// Refuse to save a config the gateway would trip over.
+		if errs := config.Validate(body); len(errs) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]any{
+				"status": "invalid",
+				"errors": errs,
+			})
+			return
+		}
+
+		current, _ := config.LoadConfigRefs(absPath)
+
+		// cmd: references run a shell command whenever the config loads. The
+		// launcher API is unauthenticated, so it may keep the ones already in
+		// the file but not add or change them.
+		var allowed map[string]string
+		if current != nil {
+			allowed = current.CommandRefs()
+		}
+		for path, ref := range cfg.CommandRefs() {
+			if allowed[path] != ref {
+				http.Error(w, fmt.Sprintf(
+					"Refusing to save %s: cmd: secret references can only be added by editing the config file directly",
+					path), http.StatusForbidden)
+				return
+			}
+		}
+
+		// The editor shows the merged result of layered configs; only what
+		// it changed goes to the base file.
+		if current != nil {
+			cfg.AdoptLayers(current)
+		}
+
 		if err := config.SaveConfig(absPath, &cfg); err != nil {
 			http.Error(w, fmt.Sprintf("Failed to save config: %v", err), http.StatusInternalServerError)
 			return
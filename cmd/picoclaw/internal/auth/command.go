@@ -5,7 +5,7 @@ import "github.com/spf13/cobra"
 func NewAuthCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "auth",
-		Short: "Manage authentication (login, logout, status)",
+		Short: "Manage authentication (login, logout, status, lock)",
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			return cmd.Help()
 		},
@@ -16,6 +16,9 @@ func NewAuthCommand() *cobra.Command {
 		newLogoutCommand(),
 		newStatusCommand(),
 		newModelsCommand(),
+		newLockCommand(),
+		newUnlockCommand(),
+		newRotateKeyCommand(),
 	)
 
 	return cmd
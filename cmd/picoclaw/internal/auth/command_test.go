@@ -14,7 +14,7 @@ func TestNewAuthCommand(t *testing.T) {
 	require.NotNil(t, cmd)
 
 	assert.Equal(t, "auth", cmd.Use)
-	assert.Equal(t, "Manage authentication (login, logout, status)", cmd.Short)
+	assert.Equal(t, "Manage authentication (login, logout, status, lock)", cmd.Short)
 
 	assert.Len(t, cmd.Aliases, 0)
 
@@ -32,6 +32,9 @@ func TestNewAuthCommand(t *testing.T) {
 		"logout",
 		"status",
 		"models",
+		"lock",
+		"unlock",
+		"rotate-key",
 	}
 
 	subcommands := cmd.Commands()
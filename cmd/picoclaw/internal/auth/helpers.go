@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,6 +11,8 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/term"
+
 	"github.com/sipeed/picoclaw/cmd/picoclaw/internal"
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/config"
@@ -435,3 +439,170 @@ func isAnthropicModel(model string) bool {
 	return model == "anthropic" ||
 		strings.HasPrefix(model, "anthropic/")
 }
+
+// readPassphrase prompts for a passphrase without echo. When stdin is not a
+// terminal, a single line is read from it instead so the command can be scripted.
+func readPassphrase(prompt string, confirm bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading passphrase: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Print(prompt)
+	first, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("reading passphrase: %w", err)
+	}
+	if len(first) == 0 {
+		return "", fmt.Errorf("passphrase must not be empty")
+	}
+	if confirm {
+		fmt.Print("Confirm passphrase: ")
+		second, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("reading passphrase: %w", err)
+		}
+		if string(first) != string(second) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return string(first), nil
+}
+
+// unlockWithPassphrase makes the current passphrase available, prompting for
+// it when the store is passphrase-encrypted and none is set in the environment.
+func unlockWithPassphrase() error {
+	if os.Getenv(auth.PassphraseEnv) != "" {
+		return nil
+	}
+	if _, err := auth.LoadStore(); !errors.Is(err, auth.ErrStoreLocked) {
+		return err
+	}
+	pass, err := readPassphrase("Current passphrase: ", false)
+	if err != nil {
+		return err
+	}
+	auth.SetPassphrase(pass)
+	_, err = auth.LoadStore()
+	return err
+}
+
+// newKeySource returns the key to encrypt with: the given key file, generated
+// if missing, or a passphrase. The passphrase is taken from the environment
+// when fromEnv is set, and prompted for otherwise.
+func newKeySource(keyFile string, fromEnv bool) (auth.KeySource, error) {
+	if keyFile != "" {
+		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+			if err := auth.GenerateKeyFile(keyFile); err != nil {
+				return auth.KeySource{}, fmt.Errorf("generating key file: %w", err)
+			}
+			fmt.Printf("Generated key file %s — back it up, it is required to read your credentials.\n", keyFile)
+		}
+		return auth.KeySource{KeyFile: keyFile}, nil
+	}
+	if pass := os.Getenv(auth.PassphraseEnv); pass != "" && fromEnv {
+		return auth.KeySource{Passphrase: pass}, nil
+	}
+	pass, err := readPassphrase("New passphrase: ", true)
+	if err != nil {
+		return auth.KeySource{}, err
+	}
+	return auth.KeySource{Passphrase: pass}, nil
+}
+
+func authLockCmd(keyFile string) error {
+	encrypted, err := auth.IsStoreEncrypted()
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		fmt.Println("Credentials are already encrypted. Use 'picoclaw auth rotate-key' to change the key.")
+		return nil
+	}
+
+	src, err := newKeySource(keyFile, true)
+	if err != nil {
+		return err
+	}
+	if err := auth.Lock(src); err != nil {
+		return fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+
+	fmt.Println("✓ Credentials encrypted")
+	if src.KeyFile != "" {
+		fmt.Printf("  Key file: %s\n", src.KeyFile)
+	} else if os.Getenv(auth.PassphraseEnv) == "" {
+		fmt.Printf("  Set %s so the gateway can read them.\n", auth.PassphraseEnv)
+	}
+	return nil
+}
+
+func authUnlockCmd() error {
+	encrypted, err := auth.IsStoreEncrypted()
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		fmt.Println("Credentials are not encrypted.")
+		return nil
+	}
+	if err := unlockWithPassphrase(); err != nil {
+		return err
+	}
+	if err := auth.Unlock(); err != nil {
+		return fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+
+	fmt.Println("✓ Credentials decrypted")
+	if os.Getenv(auth.PassphraseEnv) != "" || os.Getenv(auth.KeyFileEnv) != "" {
+		fmt.Printf("  Note: unset %s and %s, or they will be encrypted again on next use.\n",
+			auth.PassphraseEnv, auth.KeyFileEnv)
+	}
+	return nil
+}
+
+func authRotateKeyCmd(keyFile string) error {
+	encrypted, err := auth.IsStoreEncrypted()
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		return fmt.Errorf("credentials are not encrypted; run 'picoclaw auth lock' first")
+	}
+	if err := unlockWithPassphrase(); err != nil {
+		return err
+	}
+
+	current, err := auth.CurrentKeySource()
+	if err != nil {
+		return err
+	}
+	if current.KeyFile != "" && (keyFile == "" || keyFile == current.KeyFile) {
+		if err := auth.RotateKeyFile(current.KeyFile); err != nil {
+			return fmt.Errorf("failed to rotate key: %w", err)
+		}
+		fmt.Printf("✓ Generated a new key in %s and re-encrypted credentials\n", current.KeyFile)
+		return nil
+	}
+
+	next, err := newKeySource(keyFile, false)
+	if err != nil {
+		return err
+	}
+	if err := auth.RotateKey(next); err != nil {
+		return fmt.Errorf("failed to rotate key: %w", err)
+	}
+	auth.SetPassphrase(next.Passphrase)
+
+	fmt.Println("✓ Credentials re-encrypted with the new key")
+	if next.Passphrase != "" && os.Getenv(auth.PassphraseEnv) != "" {
+		fmt.Printf("  Update %s to the new passphrase.\n", auth.PassphraseEnv)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "github.com/spf13/cobra"
+
+func newLockCommand() *cobra.Command {
+	var keyFile string
+
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Encrypt stored credentials",
+		Long: `Encrypt auth.json with ChaCha20-Poly1305.
+
+By default the key is derived from a passphrase (read from PICOCLAW_AUTH_PASSPHRASE
+or prompted). With --key-file a random key is stored in that file instead; it is
+generated if it does not exist yet.`,
+		Example: `  picoclaw auth lock
+  picoclaw auth lock --key-file ~/.picoclaw/auth.key`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return authLockCmd(keyFile)
+		},
+	}
+
+	cmd.Flags().StringVar(&keyFile, "key-file", "", "Use a key file instead of a passphrase")
+
+	return cmd
+}
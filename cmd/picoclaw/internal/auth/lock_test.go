@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLockSubcommand(t *testing.T) {
+	cmd := newLockCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Encrypt stored credentials", cmd.Short)
+	assert.True(t, cmd.HasExample())
+
+	assert.True(t, cmd.HasFlags())
+	assert.NotNil(t, cmd.Flags().Lookup("key-file"))
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "github.com/spf13/cobra"
+
+func newRotateKeyCommand() *cobra.Command {
+	var keyFile string
+
+	cmd := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Re-encrypt stored credentials with a new key",
+		Long: `Decrypt auth.json with the current key and encrypt it with a new one.
+
+Without flags, a store locked with a passphrase asks for a new passphrase and a
+store locked with a key file gets a freshly generated key in the same file.
+--key-file switches to (or generates) the given key file.`,
+		Example: `  picoclaw auth rotate-key
+  picoclaw auth rotate-key --key-file /secure/picoclaw.key`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return authRotateKeyCmd(keyFile)
+		},
+	}
+
+	cmd.Flags().StringVar(&keyFile, "key-file", "", "Encrypt with this key file (generated if missing)")
+
+	return cmd
+}
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRotateKeySubcommand(t *testing.T) {
+	cmd := newRotateKeyCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Re-encrypt stored credentials with a new key", cmd.Short)
+	assert.True(t, cmd.HasExample())
+
+	assert.True(t, cmd.HasFlags())
+	assert.NotNil(t, cmd.Flags().Lookup("key-file"))
+}
@@ -0,0 +1,16 @@
+package auth
+
+import "github.com/spf13/cobra"
+
+func newUnlockCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Decrypt stored credentials back to plaintext",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return authUnlockCmd()
+		},
+	}
+
+	return cmd
+}
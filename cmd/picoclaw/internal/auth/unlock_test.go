@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUnlockSubcommand(t *testing.T) {
+	cmd := newUnlockCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Decrypt stored credentials back to plaintext", cmd.Short)
+
+	assert.False(t, cmd.HasFlags())
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect, edit and validate the configuration",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(
+		newShowCommand(),
+		newGetCommand(),
+		newSetCommand(),
+		newUnsetCommand(),
+		newValidateCommand(),
+		newSchemaCommand(),
+	)
+
+	return cmd
+}
@@ -0,0 +1,18 @@
+package config
+
+import "github.com/spf13/cobra"
+
+func newGetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <path>",
+		Short: "Print the config value at a dotted path",
+		Args:  cobra.ExactArgs(1),
+		Example: `picoclaw config get channels.telegram.allow_from
+picoclaw config get model_list[name=gpt4].api_base`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return configGetCmd(args[0])
+		},
+	}
+
+	return cmd
+}
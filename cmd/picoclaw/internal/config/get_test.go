@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGetSubcommand(t *testing.T) {
+	cmd := newGetCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Print the config value at a dotted path", cmd.Short)
+
+	assert.True(t, cmd.HasExample())
+	assert.False(t, cmd.HasFlags())
+}
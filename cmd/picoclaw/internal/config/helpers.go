@@ -0,0 +1,321 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sipeed/picoclaw/cmd/picoclaw/internal"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+)
+
+func configValidateCmd(path string) error {
+	if path == "" {
+		path = internal.GetConfigPath()
+	}
+	layers, err := config.ResolveLayers(path, internal.GetProfile())
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+	if layers.Data == nil {
+		return fmt.Errorf("error reading config: %s does not exist", path)
+	}
+	errs := config.Validate(layers.Data)
+	if len(layers.Files) > 1 {
+		fmt.Printf("Merged %s\n", strings.Join(layers.Files, ", "))
+	}
+	if len(errs) == 0 {
+		fmt.Printf("✓ %s is valid\n", path)
+		return nil
+	}
+
+	fmt.Printf("✗ %s has %d problem(s):\n", path, len(errs))
+	for _, e := range errs {
+		fmt.Printf("  • %s\n", e.Error())
+	}
+	return fmt.Errorf("config is invalid")
+}
+
+func configShowCmd(resolved bool) error {
+	layers, err := config.ResolveLayers(internal.GetConfigPath(), internal.GetProfile())
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+	if !resolved {
+		if layers.Data == nil {
+			return fmt.Errorf("error reading config: %s does not exist", layers.Base)
+		}
+		doc, err := config.ParseDocument(layers.Data)
+		if err != nil {
+			return fmt.Errorf("error parsing config: %w", err)
+		}
+		doc.MaskSecrets()
+		data, err := doc.Bytes()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if layers.Data == nil {
+		layers.Data = []byte("{}")
+	}
+	values, err := layers.Resolve()
+	if err != nil {
+		return fmt.Errorf("error parsing config: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, v := range values {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", v.Path, formatResolved(v), v.Source)
+	}
+	return w.Flush()
+}
+
+// formatResolved renders a resolved value as compact JSON, masking literal
+// secrets. Secret references are shown, since they reveal nothing.
+func formatResolved(v config.ResolvedValue) string {
+	data, err := json.Marshal(config.MaskSecrets(v.Path, v.Value))
+	if err != nil {
+		return fmt.Sprint(v.Value)
+	}
+	return string(data)
+}
+
+func configSchemaCmd(output string) error {
+	data, err := json.MarshalIndent(config.Schema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := fileutil.WriteFileAtomic(output, data, 0o644); err != nil {
+		return fmt.Errorf("error writing schema: %w", err)
+	}
+	fmt.Printf("✓ Schema written to %s\n", output)
+	return nil
+}
+
+type setOptions struct {
+	appendItem bool
+	removeItem bool
+	dryRun     bool
+}
+
+func configGetCmd(path string) error {
+	value, err := lookupValue(internal.GetConfigPath(), internal.GetProfile(), path)
+	if err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		fmt.Println(v)
+	case nil:
+		fmt.Println("null")
+	default:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+	return nil
+}
+
+// lookupValue returns the value at path from the config file merged with
+// its includes and overlays, falling back to the built-in default when none
+// of them sets it.
+func lookupValue(configPath, profile, path string) (any, error) {
+	if _, err := config.SchemaAt(path); err != nil {
+		return nil, err
+	}
+	layers, err := config.ResolveLayers(configPath, profile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	if layers.Data != nil {
+		doc, err := config.ParseDocument(layers.Data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing config: %w", err)
+		}
+		value, err := doc.Get(path)
+		if err == nil {
+			return value, nil
+		}
+		if !errors.Is(err, config.ErrPathNotFound) {
+			return nil, err
+		}
+	}
+
+	defaults, err := json.Marshal(config.DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	doc, err := config.ParseDocument(defaults)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Get(path)
+}
+
+func configSetCmd(path, raw string, opts setOptions) error {
+	return editConfig(internal.GetConfigPath(), opts.dryRun, func(doc *config.Document) error {
+		switch {
+		case opts.appendItem:
+			value, err := config.CoerceElement(path, raw)
+			if err != nil {
+				return err
+			}
+			return doc.Append(path, value)
+		case opts.removeItem:
+			value, err := config.CoerceElement(path, raw)
+			if err != nil {
+				return err
+			}
+			_, err = doc.Remove(path, value)
+			return err
+		default:
+			value, err := config.CoerceValue(path, raw)
+			if err != nil {
+				return err
+			}
+			return doc.Set(path, value)
+		}
+	})
+}
+
+func configUnsetCmd(path string, dryRun bool) error {
+	return editConfig(internal.GetConfigPath(), dryRun, func(doc *config.Document) error {
+		return doc.Unset(path)
+	})
+}
+
+// editConfig applies edit to the config file at configPath. The result must
+// not introduce validation errors; it is then either shown as a diff or
+// written atomically, so an interrupted write never leaves a truncated file.
+func editConfig(configPath string, dryRun bool, edit func(*config.Document) error) error {
+	before, err := os.ReadFile(configPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("error reading config: %w", err)
+		}
+		before = []byte("{}\n")
+	}
+	doc, err := config.ParseDocument(before)
+	if err != nil {
+		return fmt.Errorf("error parsing config: %w", err)
+	}
+	if err := edit(doc); err != nil {
+		return err
+	}
+	after, err := doc.Bytes()
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	for _, e := range config.Validate(before) {
+		existing[e.Error()] = true
+	}
+	var introduced []string
+	for _, e := range config.Validate(after) {
+		if !existing[e.Error()] {
+			introduced = append(introduced, e.Error())
+		}
+	}
+	if len(introduced) > 0 {
+		fmt.Printf("✗ Change rejected, it would make the config invalid:\n")
+		for _, msg := range introduced {
+			fmt.Printf("  • %s\n", msg)
+		}
+		return fmt.Errorf("config not changed")
+	}
+
+	if dryRun {
+		diff := lineDiff(string(before), string(after))
+		if diff == "" {
+			fmt.Println("No changes.")
+			return nil
+		}
+		fmt.Print(diff)
+		return nil
+	}
+	if err := fileutil.WriteFileAtomic(configPath, after, 0o600); err != nil {
+		return fmt.Errorf("error writing config: %w", err)
+	}
+	fmt.Printf("✓ Updated %s\n", configPath)
+	return nil
+}
+
+// lineDiff returns a minimal unified-style diff of a and b ("-" and "+"
+// lines with a line of context), or "" if they are equal.
+func lineDiff(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i]})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', x[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', y[j]})
+			j++
+		}
+	}
+
+	const context = 1
+	var out strings.Builder
+	last := -1
+	for k, l := range lines {
+		if l.op == ' ' {
+			near := false
+			for d := -context; d <= context; d++ {
+				if n := k + d; n >= 0 && n < len(lines) && lines[n].op != ' ' {
+					near = true
+				}
+			}
+			if !near {
+				continue
+			}
+		}
+		if last >= 0 && k > last+1 {
+			out.WriteString("...\n")
+		}
+		fmt.Fprintf(&out, "%c %s\n", l.op, l.text)
+		last = k
+	}
+	return out.String()
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestLineDiff(t *testing.T) {
+	assert.Equal(t, "", lineDiff("a\nb\n", "a\nb\n"))
+	assert.Equal(t, "  a\n- b\n+ B\n  c\n", lineDiff("a\nb\nc\nd\n", "a\nB\nc\nd\n"))
+}
+
+func TestEditConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := "{\n  \"gateway\": {\n    \"port\": 18790\n  }\n}\n"
+	require.NoError(t, os.WriteFile(path, []byte(original), 0o600))
+
+	setPort := func(doc *config.Document) error { return doc.Set("gateway.port", 9000) }
+
+	require.NoError(t, editConfig(path, true, setPort))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, string(data), "dry run must not write")
+
+	require.NoError(t, editConfig(path, false, setPort))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"port": 9000`)
+
+	err = editConfig(path, false, func(doc *config.Document) error {
+		return doc.Set("bindings", []any{map[string]any{"agent_id": "ghost"}})
+	})
+	assert.Error(t, err, "edits that break references are rejected")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "ghost")
+}
+
+func TestLookupValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"gateway": {"port": 9000}}`), 0o600))
+
+	v, err := lookupValue(path, "", "gateway.port")
+	require.NoError(t, err)
+	assert.Equal(t, json.Number("9000"), v)
+
+	v, err = lookupValue(path, "", "gateway.host")
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultConfig().Gateway.Host, v)
+
+	_, err = lookupValue(path, "", "gateway.prot")
+	assert.Error(t, err)
+}
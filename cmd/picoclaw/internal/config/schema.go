@@ -0,0 +1,21 @@
+package config
+
+import "github.com/spf13/cobra"
+
+func newSchemaCommand() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:     "schema",
+		Short:   "Print the JSON Schema of the config file",
+		Args:    cobra.NoArgs,
+		Example: `picoclaw config schema -o config.schema.json`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return configSchemaCmd(output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of stdout")
+
+	return cmd
+}
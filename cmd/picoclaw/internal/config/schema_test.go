@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSchemaSubcommand(t *testing.T) {
+	cmd := newSchemaCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Print the JSON Schema of the config file", cmd.Short)
+
+	assert.True(t, cmd.HasExample())
+	assert.NotNil(t, cmd.Flags().Lookup("output"))
+}
@@ -0,0 +1,26 @@
+package config
+
+import "github.com/spf13/cobra"
+
+func newSetCommand() *cobra.Command {
+	var opts setOptions
+
+	cmd := &cobra.Command{
+		Use:   "set <path> <value>",
+		Short: "Change the config value at a dotted path",
+		Args:  cobra.ExactArgs(2),
+		Example: `picoclaw config set channels.telegram.enabled true
+picoclaw config set channels.telegram.allow_from 123456 --append
+picoclaw config set model_list[name=gpt4].api_key env:OPENAI_API_KEY --dry-run`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return configSetCmd(args[0], args[1], opts)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.appendItem, "append", false, "Append the value to the list at path")
+	cmd.Flags().BoolVar(&opts.removeItem, "remove", false, "Remove every occurrence of the value from the list at path")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show the change as a diff without writing it")
+	cmd.MarkFlagsMutuallyExclusive("append", "remove")
+
+	return cmd
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSetSubcommand(t *testing.T) {
+	cmd := newSetCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Change the config value at a dotted path", cmd.Short)
+
+	assert.True(t, cmd.HasExample())
+	assert.NotNil(t, cmd.Flags().Lookup("append"))
+	assert.NotNil(t, cmd.Flags().Lookup("remove"))
+	assert.NotNil(t, cmd.Flags().Lookup("dry-run"))
+}
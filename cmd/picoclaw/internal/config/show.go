@@ -0,0 +1,22 @@
+package config
+
+import "github.com/spf13/cobra"
+
+func newShowCommand() *cobra.Command {
+	var resolved bool
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the config merged from its includes, host and profile overlays",
+		Args:  cobra.NoArgs,
+		Example: `picoclaw config show
+picoclaw --profile staging config show --resolved`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return configShowCmd(resolved)
+		},
+	}
+
+	cmd.Flags().BoolVar(&resolved, "resolved", false, "Print every effective value, defaults included, with its source")
+
+	return cmd
+}
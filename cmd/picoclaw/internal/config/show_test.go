@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewShowSubcommand(t *testing.T) {
+	cmd := newShowCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Print the config merged from its includes, host and profile overlays", cmd.Short)
+
+	assert.True(t, cmd.HasExample())
+	assert.NotNil(t, cmd.Flags().Lookup("resolved"))
+}
@@ -0,0 +1,21 @@
+package config
+
+import "github.com/spf13/cobra"
+
+func newUnsetCommand() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:     "unset <path>",
+		Short:   "Remove the config value at a dotted path, restoring its default",
+		Args:    cobra.ExactArgs(1),
+		Example: `picoclaw config unset channels.telegram.proxy`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return configUnsetCmd(args[0], dryRun)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the change as a diff without writing it")
+
+	return cmd
+}
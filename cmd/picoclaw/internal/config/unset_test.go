@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUnsetSubcommand(t *testing.T) {
+	cmd := newUnsetCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Remove the config value at a dotted path, restoring its default", cmd.Short)
+
+	assert.True(t, cmd.HasExample())
+	assert.NotNil(t, cmd.Flags().Lookup("dry-run"))
+}
@@ -0,0 +1,21 @@
+package config
+
+import "github.com/spf13/cobra"
+
+func newValidateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "validate [path]",
+		Short:   "Check the config file for unknown keys, wrong types and broken references",
+		Args:    cobra.MaximumNArgs(1),
+		Example: `picoclaw config validate ~/.picoclaw/config.json`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			path := ""
+			if len(args) > 0 {
+				path = args[0]
+			}
+			return configValidateCmd(path)
+		},
+	}
+
+	return cmd
+}
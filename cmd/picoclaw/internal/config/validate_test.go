@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewValidateSubcommand(t *testing.T) {
+	cmd := newValidateCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Check the config file for unknown keys, wrong types and broken references", cmd.Short)
+
+	assert.True(t, cmd.HasExample())
+	assert.False(t, cmd.HasFlags())
+}
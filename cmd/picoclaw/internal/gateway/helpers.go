@@ -7,6 +7,8 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"syscall"
 	"time"
 
 	"github.com/sipeed/picoclaw/cmd/picoclaw/internal"
@@ -15,14 +17,21 @@ import (
 	"github.com/sipeed/picoclaw/pkg/channels"
 	_ "github.com/sipeed/picoclaw/pkg/channels/dingtalk"
 	_ "github.com/sipeed/picoclaw/pkg/channels/discord"
+	_ "github.com/sipeed/picoclaw/pkg/channels/email"
 	_ "github.com/sipeed/picoclaw/pkg/channels/feishu"
+	_ "github.com/sipeed/picoclaw/pkg/channels/irc"
 	_ "github.com/sipeed/picoclaw/pkg/channels/line"
 	_ "github.com/sipeed/picoclaw/pkg/channels/maixcam"
+	_ "github.com/sipeed/picoclaw/pkg/channels/matrix"
+	_ "github.com/sipeed/picoclaw/pkg/channels/mattermost"
+	_ "github.com/sipeed/picoclaw/pkg/channels/mqtt"
 	_ "github.com/sipeed/picoclaw/pkg/channels/onebot"
 	_ "github.com/sipeed/picoclaw/pkg/channels/pico"
 	_ "github.com/sipeed/picoclaw/pkg/channels/qq"
+	_ "github.com/sipeed/picoclaw/pkg/channels/signal"
 	_ "github.com/sipeed/picoclaw/pkg/channels/slack"
 	_ "github.com/sipeed/picoclaw/pkg/channels/telegram"
+	_ "github.com/sipeed/picoclaw/pkg/channels/webhook"
 	_ "github.com/sipeed/picoclaw/pkg/channels/wecom"
 	_ "github.com/sipeed/picoclaw/pkg/channels/whatsapp"
 	_ "github.com/sipeed/picoclaw/pkg/channels/whatsapp_native"
@@ -33,12 +42,17 @@ import (
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/openaiapi"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
+// configWatchInterval is how often the config file is checked for changes
+// when gateway.hot_reload is enabled.
+const configWatchInterval = 2 * time.Second
+
 func gatewayCmd(debug bool) error {
 	if debug {
 		logger.SetLevel(logger.DEBUG)
@@ -56,6 +70,7 @@ func gatewayCmd(debug bool) error {
 	}
 
 	// Use the resolved model ID from provider creation
+	rawModel := cfg.Agents.Defaults.ModelName
 	if modelID != "" {
 		cfg.Agents.Defaults.ModelName = modelID
 	}
@@ -180,6 +195,25 @@ func gatewayCmd(debug bool) error {
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
 	addr := fmt.Sprintf("%s:%d", cfg.Gateway.Host, cfg.Gateway.Port)
 	channelManager.SetupHTTPServer(addr, healthServer)
+	if cfg.Gateway.OpenAIAPI.Enabled {
+		apiHandler, err := openaiapi.NewHandler(cfg.Gateway.OpenAIAPI, agentLoop)
+		if err != nil {
+			fmt.Printf("Error setting up OpenAI-compatible API: %v\n", err)
+		} else {
+			channelManager.RegisterHTTPHandler(openaiapi.PathPrefix, apiHandler)
+			fmt.Printf("✓ OpenAI-compatible API available at http://%s%s\n", addr, openaiapi.PathPrefix)
+		}
+	}
+
+	reload := &reloader{
+		ctx:            ctx,
+		cfg:            cfg,
+		rawModel:       rawModel,
+		provider:       provider,
+		agentLoop:      agentLoop,
+		channelManager: channelManager,
+	}
+	healthServer.SetReloadFunc(reload.Reload)
 
 	if err := channelManager.StartAll(ctx); err != nil {
 		fmt.Printf("Error starting channels: %v\n", err)
@@ -190,12 +224,39 @@ func gatewayCmd(debug bool) error {
 
 	go agentLoop.Run(ctx)
 
+	if cfg.Gateway.HotReload {
+		// Watch the base file, every include and overlay it was merged from,
+		// and the host overlay even before it exists.
+		watched := []string{internal.GetConfigPath()}
+		if host := config.HostOverlayPath(internal.GetConfigPath()); host != "" {
+			watched = append(watched, host)
+		}
+		for _, f := range cfg.Files() {
+			if !slices.Contains(watched, f) {
+				watched = append(watched, f)
+			}
+		}
+		for _, f := range watched {
+			go config.WatchFile(ctx, f, configWatchInterval, func() {
+				logger.InfoCF("gateway", "Config file changed, reloading", map[string]any{"file": f})
+				reload.Reload()
+			})
+		}
+	}
+
+	// SIGHUP reloads the config; an interrupt shuts the gateway down.
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
-	<-sigChan
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		logger.InfoC("gateway", "SIGHUP received, reloading config")
+		reload.Reload()
+	}
 
 	fmt.Println("\nShutting down...")
-	if cp, ok := provider.(providers.StatefulProvider); ok {
+	if cp, ok := reload.currentProvider().(providers.StatefulProvider); ok {
 		cp.Close()
 	}
 	cancel()
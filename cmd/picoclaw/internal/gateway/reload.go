@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/cmd/picoclaw/internal"
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// providerCloseGrace is how long a replaced provider is kept open so that
+// requests already in flight can finish.
+const providerCloseGrace = 2 * time.Minute
+
+// providerSections are the config sections the LLM provider is built from.
+var providerSections = []string{"model_list", "providers", "agents"}
+
+// restartSections are the config sections that are only read at startup.
+var restartSections = []string{"gateway", "heartbeat", "devices"}
+
+// reloader applies config file changes to a running gateway.
+type reloader struct {
+	mu             sync.Mutex
+	ctx            context.Context
+	cfg            *config.Config
+	rawModel       string // agents.defaults.model_name as written, before provider resolution
+	provider       providers.LLMProvider
+	agentLoop      *agent.AgentLoop
+	channelManager *channels.Manager
+}
+
+// Reload re-reads the config file and applies the changes. An invalid config
+// is rejected with an error and the running config is kept.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		logger.ErrorCF("gateway", "Config reload rejected, keeping the running config",
+			map[string]any{"error": err.Error()})
+		return err
+	}
+
+	rawModel := next.Agents.Defaults.ModelName
+	if rawModel == r.rawModel {
+		// Same model as before: carry over the resolved model ID so the
+		// agents section only shows up as changed if it really did.
+		next.Agents.Defaults.ModelName = r.cfg.Agents.Defaults.ModelName
+	}
+	changed := config.ChangedSections(r.cfg, next)
+	if len(changed) == 0 {
+		logger.InfoCF("gateway", "Config reloaded, nothing changed", nil)
+		return nil
+	}
+
+	var provider providers.LLMProvider
+	if slices.ContainsFunc(changed, func(s string) bool { return slices.Contains(providerSections, s) }) {
+		next.Agents.Defaults.ModelName = rawModel
+		p, modelID, err := providers.CreateProvider(next)
+		if err != nil {
+			err = fmt.Errorf("creating provider: %w", err)
+			logger.ErrorCF("gateway", "Config reload rejected, keeping the running config",
+				map[string]any{"error": err.Error()})
+			return err
+		}
+		if modelID != "" {
+			next.Agents.Defaults.ModelName = modelID
+		}
+		provider = p
+	}
+
+	for _, section := range changed {
+		if slices.Contains(restartSections, section) {
+			logger.WarnCF("gateway", "Config section changed but only takes effect after a restart",
+				map[string]any{"section": section})
+		}
+	}
+
+	r.agentLoop.ReloadConfig(next, provider)
+	r.channelManager.Reload(r.ctx, next)
+
+	if provider != nil {
+		if sp, ok := r.provider.(providers.StatefulProvider); ok {
+			time.AfterFunc(providerCloseGrace, sp.Close)
+		}
+		r.provider = provider
+	}
+	r.cfg = next
+	r.rawModel = rawModel
+
+	logger.InfoCF("gateway", "Config reloaded", map[string]any{"sections": changed})
+	return nil
+}
+
+// load reads and validates the config file. Unlike startup, a missing file
+// or one that fails validation is an error rather than something to work
+// around, so a half-edited config never replaces a running one.
+func (r *reloader) load() (*config.Config, error) {
+	path := internal.GetConfigPath()
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	layers, err := config.ResolveLayers(path, internal.GetProfile())
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	if errs := config.Validate(layers.Data); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid config: %w", errors.Join(validationErrors(errs)...))
+	}
+	cfg, err := internal.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	return cfg, nil
+}
+
+// currentProvider returns the running provider, for shutdown.
+func (r *reloader) currentProvider() providers.LLMProvider {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.provider
+}
+
+func validationErrors(errs []config.ValidationError) []error {
+	out := make([]error, len(errs))
+	for i, e := range errs {
+		out[i] = e
+	}
+	return out
+}
@@ -0,0 +1,26 @@
+package gateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloaderLoad_RejectsInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("PICOCLAW_CONFIG", path)
+	r := &reloader{}
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"bindings": [{"agent_id": "ghost"}]}`), 0o600))
+	_, err := r.load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ghost")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"agents": {"defaults": {"max_tokens": 1024}}}`), 0o600))
+	cfg, err := r.load()
+	require.NoError(t, err)
+	assert.Equal(t, 1024, cfg.Agents.Defaults.MaxTokens)
+}
@@ -6,7 +6,11 @@ import (
 	"path/filepath"
 	"runtime"
 
+	"github.com/spf13/pflag"
+
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/redact"
 )
 
 const Logo = "🦞"
@@ -26,8 +30,37 @@ func GetConfigPath() string {
 	return filepath.Join(home, ".picoclaw", "config.json")
 }
 
+// profile is set by the global --profile flag.
+var profile string
+
+// AddProfileFlag registers the global --profile flag on flags.
+func AddProfileFlag(flags *pflag.FlagSet) {
+	flags.StringVar(&profile, "profile", "", "Config profile to apply (default $"+config.ProfileEnv+")")
+}
+
+// GetProfile returns the config profile selected with --profile or
+// PICOCLAW_PROFILE, or "" for none.
+func GetProfile() string {
+	if profile != "" {
+		return profile
+	}
+	return os.Getenv(config.ProfileEnv)
+}
+
+// LoadConfig loads the config file with its includes and overlays and, when
+// log redaction is enabled, installs a redactor that masks its secrets in all
+// log output.
 func LoadConfig() (*config.Config, error) {
-	return config.LoadConfig(GetConfigPath())
+	cfg, err := config.LoadConfigProfile(GetConfigPath(), GetProfile())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Redaction.Enabled && cfg.Redaction.Logs {
+		logger.SetRedactor(redact.New(redact.Options{Secrets: cfg.Secrets(), PII: cfg.Redaction.PII}))
+	} else {
+		logger.SetRedactor(nil)
+	}
+	return cfg, nil
 }
 
 // FormatVersion returns the version string with optional git commit
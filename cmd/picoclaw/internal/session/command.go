@@ -0,0 +1,46 @@
+package session
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sipeed/picoclaw/cmd/picoclaw/internal"
+	"github.com/sipeed/picoclaw/pkg/agent"
+)
+
+func NewSessionCommand() *cobra.Command {
+	var workspaces map[string]string
+
+	cmd := &cobra.Command{
+		Use:     "session",
+		Aliases: []string{"sessions"},
+		Short:   "Manage stored conversation sessions",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+		// Resolve agent workspaces at execution time so they reflect the
+		// current config and are shared across all subcommands.
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			cfg, err := internal.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("error loading config: %w", err)
+			}
+			workspaces = agent.ResolveAgentWorkspaces(cfg)
+			return nil
+		},
+	}
+
+	workspacesFn := func() map[string]string { return workspaces }
+
+	cmd.AddCommand(
+		newListCommand(workspacesFn),
+		newShowCommand(workspacesFn),
+		newDeleteCommand(workspacesFn),
+		newPruneCommand(workspacesFn),
+		newExportCommand(workspacesFn),
+	)
+
+	return cmd
+}
@@ -0,0 +1,21 @@
+package session
+
+import "github.com/spf13/cobra"
+
+func newDeleteCommand(workspaces func() map[string]string) *cobra.Command {
+	var agentID string
+
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a session by key",
+		Args:    cobra.ExactArgs(1),
+		Example: `picoclaw session delete agent:main:telegram:direct:123456`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return sessionDeleteCmd(workspaces(), agentID, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&agentID, "agent", "a", "", "Only look in this agent's sessions")
+
+	return cmd
+}
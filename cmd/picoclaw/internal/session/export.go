@@ -0,0 +1,27 @@
+package session
+
+import "github.com/spf13/cobra"
+
+func newExportCommand(workspaces func() map[string]string) *cobra.Command {
+	var (
+		agentID string
+		format  string
+		output  string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "export",
+		Short:   "Export a session as Markdown, HTML or JSON",
+		Args:    cobra.ExactArgs(1),
+		Example: `picoclaw session export agent:main:telegram:direct:123456 --format html -o chat.html`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return sessionExportCmd(workspaces(), agentID, args[0], format, output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&agentID, "agent", "a", "", "Only look in this agent's sessions")
+	cmd.Flags().StringVarP(&format, "format", "f", "markdown", "Output format: markdown, html or json")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of stdout")
+
+	return cmd
+}
@@ -0,0 +1,22 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExportSubcommand(t *testing.T) {
+	fn := func() map[string]string { return nil }
+	cmd := newExportCommand(fn)
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Export a session as Markdown, HTML or JSON", cmd.Short)
+
+	assert.True(t, cmd.HasExample())
+	assert.NotNil(t, cmd.Flags().Lookup("agent"))
+	assert.NotNil(t, cmd.Flags().Lookup("format"))
+	assert.NotNil(t, cmd.Flags().Lookup("output"))
+}
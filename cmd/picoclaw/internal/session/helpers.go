@@ -0,0 +1,255 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+// filter narrows the set of sessions a subcommand operates on.
+type filter struct {
+	agent     string
+	channel   string
+	olderThan string
+}
+
+func (f *filter) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.agent, "agent", "a", "", "Only include sessions of this agent")
+	cmd.Flags().StringVarP(&f.channel, "channel", "c", "", "Only include sessions from this channel")
+	cmd.Flags().StringVar(&f.olderThan, "older-than", "", "Only include sessions idle for this long (e.g. 12h, 7d)")
+}
+
+// entry is a session found in an agent's on-disk session store.
+type entry struct {
+	agentID string
+	store   *session.SessionManager
+	info    session.SessionInfo
+}
+
+// parseAge parses a duration, additionally accepting a "d" suffix for days.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// sessionChannel returns the channel a session belongs to. Older session
+// files do not record it, so fall back to the channel encoded in the key.
+func sessionChannel(info session.SessionInfo) string {
+	if info.Channel != "" {
+		return info.Channel
+	}
+	parsed := routing.ParseAgentSessionKey(info.Key)
+	if parsed == nil {
+		return ""
+	}
+	first, _, _ := strings.Cut(parsed.Rest, ":")
+	switch first {
+	case routing.DefaultMainKey, "direct", "subagent":
+		return ""
+	}
+	return first
+}
+
+// collect loads the session stores of all matching agents and returns the
+// sessions that pass the filter, most recently updated first.
+func collect(workspaces map[string]string, f filter) ([]entry, error) {
+	var cutoff time.Time
+	if f.olderThan != "" {
+		age, err := parseAge(f.olderThan)
+		if err != nil {
+			return nil, err
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	agentFilter := ""
+	if f.agent != "" {
+		agentFilter = routing.NormalizeAgentID(f.agent)
+		if _, ok := workspaces[agentFilter]; !ok {
+			return nil, fmt.Errorf("agent %q not found in config", f.agent)
+		}
+	}
+
+	var entries []entry
+	for agentID, workspace := range workspaces {
+		if agentFilter != "" && agentID != agentFilter {
+			continue
+		}
+		store := session.NewSessionManager(filepath.Join(workspace, "sessions"))
+		for _, info := range store.List() {
+			if f.channel != "" && !strings.EqualFold(sessionChannel(info), f.channel) {
+				continue
+			}
+			if !cutoff.IsZero() && !info.Updated.Before(cutoff) {
+				continue
+			}
+			entries = append(entries, entry{agentID: agentID, store: store, info: info})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].info.Updated.After(entries[j].info.Updated)
+	})
+	return entries, nil
+}
+
+// find returns the session stored under key, searching every agent unless
+// agentID is set.
+func find(workspaces map[string]string, agentID, key string) (entry, error) {
+	entries, err := collect(workspaces, filter{agent: agentID})
+	if err != nil {
+		return entry{}, err
+	}
+	for _, e := range entries {
+		if e.info.Key == key {
+			return e, nil
+		}
+	}
+	return entry{}, fmt.Errorf("session %q not found", key)
+}
+
+func sessionListCmd(workspaces map[string]string, f filter) error {
+	entries, err := collect(workspaces, f)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No sessions found.")
+		return nil
+	}
+
+	fmt.Println("\nSessions:")
+	fmt.Println("---------")
+	for _, e := range entries {
+		fmt.Printf("  %s\n", e.info.Key)
+		if e.info.Title != "" {
+			fmt.Printf("    Title: %s\n", e.info.Title)
+		}
+		fmt.Printf("    Agent: %s\n", e.agentID)
+		if channel := sessionChannel(e.info); channel != "" {
+			fmt.Printf("    Channel: %s\n", channel)
+		}
+		fmt.Printf("    Messages: %d\n", e.info.Messages)
+		fmt.Printf("    Updated: %s\n", e.info.Updated.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+func sessionShowCmd(workspaces map[string]string, agentID, key string) error {
+	e, err := find(workspaces, agentID, key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Session: %s\n", e.info.Key)
+	if e.info.Title != "" {
+		fmt.Printf("Title: %s\n", e.info.Title)
+	}
+	fmt.Printf("Agent: %s\n", e.agentID)
+	fmt.Printf("Created: %s\n", e.info.Created.Format("2006-01-02 15:04"))
+	fmt.Printf("Updated: %s\n", e.info.Updated.Format("2006-01-02 15:04"))
+	if summary := e.store.GetSummary(key); summary != "" {
+		fmt.Printf("\nSummary:\n%s\n", summary)
+	}
+
+	fmt.Println("\nMessages:")
+	snapshot, _ := e.store.Snapshot(key)
+	for _, m := range session.Normalize(snapshot).Messages {
+		switch {
+		case m.Content != "":
+			fmt.Printf("[%s] %s\n", m.Role, m.Content)
+		case len(m.ToolCalls) > 0:
+			names := make([]string, 0, len(m.ToolCalls))
+			for _, tc := range m.ToolCalls {
+				names = append(names, tc.Name)
+			}
+			fmt.Printf("[%s] (tool calls: %s)\n", m.Role, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+func sessionExportCmd(workspaces map[string]string, agentID, key, format, output string) error {
+	exportFormat, err := session.ParseExportFormat(format)
+	if err != nil {
+		return err
+	}
+	e, err := find(workspaces, agentID, key)
+	if err != nil {
+		return err
+	}
+	snapshot, _ := e.store.Snapshot(key)
+
+	if output == "" {
+		return session.Export(os.Stdout, snapshot, exportFormat)
+	}
+
+	var buf bytes.Buffer
+	if err := session.Export(&buf, snapshot, exportFormat); err != nil {
+		return fmt.Errorf("error exporting session: %w", err)
+	}
+	if err := fileutil.WriteFileAtomic(output, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", output, err)
+	}
+	fmt.Printf("✓ Exported session %s to %s\n", key, output)
+	return nil
+}
+
+func sessionDeleteCmd(workspaces map[string]string, agentID, key string) error {
+	e, err := find(workspaces, agentID, key)
+	if err != nil {
+		return err
+	}
+	if err := e.store.Delete(key); err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	fmt.Printf("✓ Deleted session %s\n", key)
+	return nil
+}
+
+func sessionPruneCmd(workspaces map[string]string, f filter, dryRun bool) error {
+	entries, err := collect(workspaces, f)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No sessions to prune.")
+		return nil
+	}
+
+	for _, e := range entries {
+		if dryRun {
+			fmt.Printf("  would delete %s (agent %s)\n", e.info.Key, e.agentID)
+			continue
+		}
+		if err := e.store.Delete(e.info.Key); err != nil {
+			fmt.Printf("✗ Failed to delete %s: %v\n", e.info.Key, err)
+			continue
+		}
+		fmt.Printf("✓ Deleted %s (agent %s)\n", e.info.Key, e.agentID)
+	}
+	return nil
+}
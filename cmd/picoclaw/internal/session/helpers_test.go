@@ -0,0 +1,70 @@
+package session
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func TestParseAge(t *testing.T) {
+	d, err := parseAge("7d")
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, d)
+
+	d, err = parseAge("90m")
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, d)
+
+	_, err = parseAge("soon")
+	assert.Error(t, err)
+}
+
+func TestSessionChannel(t *testing.T) {
+	assert.Equal(t, "telegram", sessionChannel(session.SessionInfo{Key: "agent:main:telegram:group:42"}))
+	assert.Equal(t, "", sessionChannel(session.SessionInfo{Key: "agent:main:main"}))
+	assert.Equal(t, "", sessionChannel(session.SessionInfo{Key: "agent:main:direct:alice"}))
+	assert.Equal(t, "slack", sessionChannel(session.SessionInfo{Key: "agent:main:main", Channel: "slack"}))
+}
+
+func TestCollect_Filters(t *testing.T) {
+	mainWS := t.TempDir()
+	otherWS := t.TempDir()
+
+	sm := session.NewSessionManager(filepath.Join(mainWS, "sessions"))
+	sm.AddMessage("agent:main:telegram:group:1", "user", "hi")
+	sm.Save("agent:main:telegram:group:1")
+	sm.AddMessage("agent:main:discord:channel:2", "user", "hi")
+	sm.Save("agent:main:discord:channel:2")
+
+	other := session.NewSessionManager(filepath.Join(otherWS, "sessions"))
+	other.AddMessage("agent:other:main", "user", "hi")
+	other.Save("agent:other:main")
+
+	workspaces := map[string]string{"main": mainWS, "other": otherWS}
+
+	entries, err := collect(workspaces, filter{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	entries, err = collect(workspaces, filter{agent: "other"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "agent:other:main", entries[0].info.Key)
+
+	entries, err = collect(workspaces, filter{channel: "telegram"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "agent:main:telegram:group:1", entries[0].info.Key)
+
+	entries, err = collect(workspaces, filter{olderThan: "1h"})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = collect(workspaces, filter{agent: "missing"})
+	assert.Error(t, err)
+}
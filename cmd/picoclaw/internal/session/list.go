@@ -0,0 +1,21 @@
+package session
+
+import "github.com/spf13/cobra"
+
+func newListCommand(workspaces func() map[string]string) *cobra.Command {
+	var f filter
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List stored sessions",
+		Args:    cobra.NoArgs,
+		Example: `picoclaw session list --agent main --channel telegram --older-than 7d`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return sessionListCmd(workspaces(), f)
+		},
+	}
+
+	f.addFlags(cmd)
+
+	return cmd
+}
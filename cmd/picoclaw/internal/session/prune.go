@@ -0,0 +1,32 @@
+package session
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newPruneCommand(workspaces func() map[string]string) *cobra.Command {
+	var (
+		f      filter
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:     "prune",
+		Short:   "Delete sessions that have not been updated recently",
+		Args:    cobra.NoArgs,
+		Example: `picoclaw session prune --older-than 30d --channel discord`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if f.olderThan == "" {
+				return fmt.Errorf("--older-than must be specified")
+			}
+			return sessionPruneCmd(workspaces(), f, dryRun)
+		},
+	}
+
+	f.addFlags(cmd)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the sessions that would be deleted")
+
+	return cmd
+}
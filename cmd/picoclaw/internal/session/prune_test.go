@@ -0,0 +1,20 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPruneSubcommand(t *testing.T) {
+	fn := func() map[string]string { return nil }
+	cmd := newPruneCommand(fn)
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Delete sessions that have not been updated recently", cmd.Short)
+
+	assert.True(t, cmd.HasExample())
+	assert.NotNil(t, cmd.Flags().Lookup("agent"))
+}
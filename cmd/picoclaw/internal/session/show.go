@@ -0,0 +1,21 @@
+package session
+
+import "github.com/spf13/cobra"
+
+func newShowCommand(workspaces func() map[string]string) *cobra.Command {
+	var agentID string
+
+	cmd := &cobra.Command{
+		Use:     "show",
+		Short:   "Show the messages of a session",
+		Args:    cobra.ExactArgs(1),
+		Example: `picoclaw session show agent:main:telegram:direct:123456`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return sessionShowCmd(workspaces(), agentID, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&agentID, "agent", "a", "", "Only look in this agent's sessions")
+
+	return cmd
+}
@@ -0,0 +1,20 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewShowSubcommand(t *testing.T) {
+	fn := func() map[string]string { return nil }
+	cmd := newShowCommand(fn)
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "Show the messages of a session", cmd.Short)
+
+	assert.True(t, cmd.HasExample())
+	assert.NotNil(t, cmd.Flags().Lookup("agent"))
+}
@@ -83,6 +83,17 @@ func statusCmd() {
 			fmt.Println("Ollama: not set")
 		}
 
+		if refs := cfg.SecretRefs(); len(refs) > 0 {
+			fmt.Println("\nSecret References:")
+			for _, ref := range refs {
+				if ref.Err != nil {
+					fmt.Printf("  %s (%s): missing — %v\n", ref.Path, ref.Ref, ref.Err)
+				} else {
+					fmt.Printf("  %s (%s): ✓\n", ref.Path, ref.Ref)
+				}
+			}
+		}
+
 		store, _ := auth.LoadStore()
 		if store != nil && len(store.Credentials) > 0 {
 			fmt.Println("\nOAuth/Token Auth:")
@@ -24,7 +24,8 @@ func TestNewPicoclawCommand(t *testing.T) {
 	assert.True(t, cmd.HasSubCommands())
 	assert.True(t, cmd.HasAvailableSubCommands())
 
-	assert.False(t, cmd.HasFlags())
+	assert.True(t, cmd.HasPersistentFlags())
+	assert.NotNil(t, cmd.PersistentFlags().Lookup("profile"))
 
 	assert.Nil(t, cmd.Run)
 	assert.Nil(t, cmd.RunE)
@@ -35,10 +36,12 @@ func TestNewPicoclawCommand(t *testing.T) {
 	allowedCommands := []string{
 		"agent",
 		"auth",
+		"config",
 		"cron",
 		"gateway",
 		"migrate",
 		"onboard",
+		"session",
 		"skills",
 		"status",
 		"version",
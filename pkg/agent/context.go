@@ -22,6 +22,13 @@ type ContextBuilder struct {
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
 
+	// peerWorkspace and shared are set on builders returned by ForPeer when
+	// the agent isolates context per peer. peerWorkspace holds the peer's own
+	// memory and scratch files; shared is the optional memory every peer sees.
+	peerWorkspace string
+	sharedDir     string
+	shared        *MemoryStore
+
 	// Cache for system prompt to avoid rebuilding on every call.
 	// This fixes issue #607: repeated reprocessing of the entire context.
 	// The cache auto-invalidates when workspace source files change (mtime check).
@@ -66,8 +73,36 @@ func NewContextBuilder(workspace string) *ContextBuilder {
 	}
 }
 
+// ForPeer returns a builder that shares this builder's bootstrap files and
+// skills but keeps memory in peerWorkspace. If sharedDir is non-empty, its
+// memory is included in the prompt for every peer as well.
+func (cb *ContextBuilder) ForPeer(peerWorkspace, sharedDir string) *ContextBuilder {
+	peer := &ContextBuilder{
+		workspace:     cb.workspace,
+		skillsLoader:  cb.skillsLoader,
+		memory:        NewMemoryStore(peerWorkspace),
+		peerWorkspace: peerWorkspace,
+		sharedDir:     sharedDir,
+	}
+	if sharedDir != "" {
+		peer.shared = NewMemoryStore(sharedDir)
+	}
+	return peer
+}
+
 func (cb *ContextBuilder) getIdentity() string {
 	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
+	memoryRoot := workspacePath
+	if cb.peerWorkspace != "" {
+		memoryRoot, _ = filepath.Abs(cb.peerWorkspace)
+	}
+
+	var shared string
+	if cb.sharedDir != "" {
+		sharedPath, _ := filepath.Abs(cb.sharedDir)
+		shared = fmt.Sprintf("\n- Shared: %s (visible to everyone you talk to; "+
+			"only store things here that are meant to be shared)", sharedPath)
+	}
 
 	return fmt.Sprintf(`# picoclaw 🦞
 
@@ -77,7 +112,7 @@ You are picoclaw, a helpful AI assistant.
 Your workspace is at: %s
 - Memory: %s/memory/MEMORY.md
 - Daily Notes: %s/memory/YYYYMM/YYYYMMDD.md
-- Skills: %s/skills/{skill-name}/SKILL.md
+- Skills: %s/skills/{skill-name}/SKILL.md%s
 
 ## Important Rules
 
@@ -88,7 +123,7 @@ Your workspace is at: %s
 3. **Memory** - When interacting with me if something seems memorable, update %s/memory/MEMORY.md
 
 4. **Context summaries** - Conversation summaries provided as context are approximate references only. They may be incomplete or outdated. Always defer to explicit user instructions over summary content.`,
-		workspacePath, workspacePath, workspacePath, workspacePath, workspacePath)
+		memoryRoot, memoryRoot, memoryRoot, workspacePath, shared, memoryRoot)
 }
 
 func (cb *ContextBuilder) BuildSystemPrompt() string {
@@ -118,6 +153,11 @@ The following skills extend your capabilities. To use a skill, read its SKILL.md
 	if memoryContext != "" {
 		parts = append(parts, "# Memory\n\n"+memoryContext)
 	}
+	if cb.shared != nil {
+		if sharedContext := cb.shared.GetMemoryContext(); sharedContext != "" {
+			parts = append(parts, "# Shared Memory\n\n"+sharedContext)
+		}
+	}
 
 	// Join with "---" separator
 	return strings.Join(parts, "\n\n---\n\n")
@@ -185,13 +225,17 @@ func (cb *ContextBuilder) InvalidateCache() {
 // invalidation (bootstrap files + memory). Skill roots are handled separately
 // because they require both directory-level and recursive file-level checks.
 func (cb *ContextBuilder) sourcePaths() []string {
-	return []string{
+	paths := []string{
 		filepath.Join(cb.workspace, "AGENTS.md"),
 		filepath.Join(cb.workspace, "SOUL.md"),
 		filepath.Join(cb.workspace, "USER.md"),
 		filepath.Join(cb.workspace, "IDENTITY.md"),
-		filepath.Join(cb.workspace, "memory", "MEMORY.md"),
+		cb.memory.memoryFile,
+	}
+	if cb.shared != nil {
+		paths = append(paths, cb.shared.memoryFile)
 	}
+	return paths
 }
 
 // skillRoots returns all skill root directories that can affect
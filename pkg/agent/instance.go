@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
@@ -37,6 +38,11 @@ type AgentInstance struct {
 	Subagents                 *config.SubagentsConfig
 	SkillsFilter              []string
 	Candidates                []providers.FallbackCandidate
+	Isolation                 *config.IsolationConfig
+
+	// peerContexts caches one ContextBuilder per peer scope when
+	// Isolation is per-peer.
+	peerContexts sync.Map
 }
 
 // NewAgentInstance creates an agent instance from config.
@@ -94,12 +100,14 @@ func NewAgentInstance(
 	agentName := ""
 	var subagents *config.SubagentsConfig
 	var skillsFilter []string
+	var isolation *config.IsolationConfig
 
 	if agentCfg != nil {
 		agentID = routing.NormalizeAgentID(agentCfg.ID)
 		agentName = agentCfg.Name
 		subagents = agentCfg.Subagents
 		skillsFilter = agentCfg.Skills
+		isolation = agentCfg.Isolation
 	}
 
 	maxIter := defaults.MaxToolIterations
@@ -200,7 +208,85 @@ func NewAgentInstance(
 		Subagents:                 subagents,
 		SkillsFilter:              skillsFilter,
 		Candidates:                candidates,
+		Isolation:                 isolation,
+	}
+}
+
+// PeerWorkspace returns the private directory for the peer that sessionKey
+// belongs to, creating it if needed. It returns "" when the agent does not
+// isolate peers or the key has no peer (heartbeat, cron).
+func (a *AgentInstance) PeerWorkspace(sessionKey string) string {
+	if !a.Isolation.PerPeer() {
+		return ""
+	}
+	scope := routing.PeerScope(sessionKey)
+	if scope == "" {
+		return ""
+	}
+	dir := filepath.Join(a.Workspace, "peers", scope)
+	os.MkdirAll(dir, 0o755)
+	return dir
+}
+
+// SharedWorkspace returns the directory shared by all peers, or "" if the
+// owner has not opted into a shared area.
+func (a *AgentInstance) SharedWorkspace() string {
+	if !a.Isolation.PerPeer() || !a.Isolation.Shared {
+		return ""
+	}
+	dir := filepath.Join(a.Workspace, "shared")
+	os.MkdirAll(dir, 0o755)
+	return dir
+}
+
+// ContextFor returns the context builder to use for sessionKey: the agent's
+// own builder, or a per-peer builder when isolation is enabled.
+func (a *AgentInstance) ContextFor(sessionKey string) *ContextBuilder {
+	peerDir := a.PeerWorkspace(sessionKey)
+	if peerDir == "" {
+		return a.ContextBuilder
+	}
+	if cb, ok := a.peerContexts.Load(peerDir); ok {
+		return cb.(*ContextBuilder)
+	}
+	cb, _ := a.peerContexts.LoadOrStore(peerDir, a.ContextBuilder.ForPeer(peerDir, a.SharedWorkspace()))
+	return cb.(*ContextBuilder)
+}
+
+// WorkspaceScope returns the tool workspace scope for sessionKey, or nil when
+// tools should use the agent workspace. Skills stay readable from inside a
+// peer's sandbox, but only the owner can change them since every peer loads
+// them; the shared area is readable and writable.
+func (a *AgentInstance) WorkspaceScope(sessionKey string) *tools.WorkspaceScope {
+	peerDir := a.PeerWorkspace(sessionKey)
+	if peerDir == "" {
+		return nil
+	}
+	scope := &tools.WorkspaceScope{
+		Dir:           peerDir,
+		ReadOnlyPaths: []*regexp.Regexp{dirPattern(filepath.Join(a.Workspace, "skills"))},
+	}
+	if shared := a.SharedWorkspace(); shared != "" {
+		scope.AllowPaths = append(scope.AllowPaths, dirPattern(shared))
+	}
+	return scope
+}
+
+// dirPattern matches dir and any path below it. Tools match paths with
+// symlinks resolved, so dir (or its parent, if dir does not exist yet) is
+// resolved too.
+func dirPattern(dir string) *regexp.Regexp {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = real
+	} else if real, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		abs = filepath.Join(real, filepath.Base(abs))
 	}
+	sep := regexp.QuoteMeta(string(filepath.Separator))
+	return regexp.MustCompile("^" + regexp.QuoteMeta(abs) + "(" + sep + "|$)")
 }
 
 // resolveAgentWorkspace determines the workspace directory for an agent.
@@ -2,6 +2,8 @@ package agent
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/sipeed/picoclaw/pkg/config"
@@ -160,3 +162,86 @@ func TestNewAgentInstance_ResolveCandidatesFromModelListAlias(t *testing.T) {
 		})
 	}
 }
+
+func TestAgentInstance_PeerIsolation(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace: tmpDir,
+				Model:     "test-model",
+			},
+		},
+	}
+	agentCfg := &config.AgentConfig{
+		ID:        "main",
+		Default:   true,
+		Isolation: &config.IsolationConfig{Mode: config.IsolationModePeer, Shared: true},
+	}
+	agent := NewAgentInstance(agentCfg, &cfg.Agents.Defaults, cfg, &mockProvider{})
+
+	aliceKey := "agent:main:direct:alice"
+	groupKey := "agent:main:telegram:group:42"
+
+	alice := agent.ContextFor(aliceKey)
+	group := agent.ContextFor(groupKey)
+	if alice == group || alice == agent.ContextBuilder {
+		t.Fatal("expected a distinct context builder per peer")
+	}
+	if agent.ContextFor(aliceKey) != alice {
+		t.Fatal("expected per-peer context builder to be cached")
+	}
+	if agent.ContextFor("heartbeat") != agent.ContextBuilder {
+		t.Fatal("expected keys without a peer to use the agent context")
+	}
+
+	if err := alice.memory.WriteLongTerm("alice likes tea"); err != nil {
+		t.Fatalf("WriteLongTerm failed: %v", err)
+	}
+	if err := NewMemoryStore(agent.SharedWorkspace()).WriteLongTerm("office closes at 6"); err != nil {
+		t.Fatalf("WriteLongTerm failed: %v", err)
+	}
+
+	alicePrompt := alice.BuildSystemPrompt()
+	groupPrompt := group.BuildSystemPrompt()
+	if !strings.Contains(alicePrompt, "alice likes tea") {
+		t.Error("expected alice's memory in her own prompt")
+	}
+	if strings.Contains(groupPrompt, "alice likes tea") {
+		t.Error("alice's memory leaked into another peer's prompt")
+	}
+	if !strings.Contains(groupPrompt, "office closes at 6") {
+		t.Error("expected shared memory to be visible to every peer")
+	}
+
+	scope := agent.WorkspaceScope(groupKey)
+	if scope == nil || scope.Dir != filepath.Join(tmpDir, "peers", "telegram_group_42-be64fc3c") {
+		t.Fatalf("unexpected workspace scope: %+v", scope)
+	}
+	skill := filepath.Join(tmpDir, "skills", "weather", "SKILL.md")
+	for _, p := range scope.AllowPaths {
+		if p.MatchString(skill) {
+			t.Fatal("skills must not be writable from a peer's scope")
+		}
+	}
+	if len(scope.ReadOnlyPaths) != 1 || !scope.ReadOnlyPaths[0].MatchString(skill) {
+		t.Fatalf("expected skills to be readable from a peer's scope: %+v", scope.ReadOnlyPaths)
+	}
+}
+
+func TestAgentInstance_NoIsolationByDefault(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: t.TempDir(), Model: "test-model"},
+		},
+	}
+	agent := NewAgentInstance(nil, &cfg.Agents.Defaults, cfg, &mockProvider{})
+
+	if agent.ContextFor("agent:main:direct:alice") != agent.ContextBuilder {
+		t.Error("expected shared context builder without isolation")
+	}
+	if agent.WorkspaceScope("agent:main:direct:alice") != nil {
+		t.Error("expected no workspace scope without isolation")
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/mcp"
 	"github.com/sipeed/picoclaw/pkg/media"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/redact"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
@@ -46,6 +47,19 @@ type AgentLoop struct {
 	channelManager *channels.Manager
 	mediaStore     media.MediaStore
 	transcriber    voice.Transcriber
+	redactor       *redact.Redactor
+	provider       providers.LLMProvider
+	extraTools     []tools.Tool // registered through RegisterTool; re-added to rebuilt agents
+
+	// mu guards cfg, redactor, provider and the MCP state, which ReloadConfig
+	// replaces while messages are being processed.
+	mu         sync.RWMutex
+	mcpCtx     context.Context
+	mcpManager *mcp.Manager
+	mcpTools   []tools.Tool
+
+	apiMu       sync.Mutex
+	apiSessions map[string]*apiSessionLock // session key -> lock held by its running API turn
 }
 
 // processOptions configures how a message is processed
@@ -59,6 +73,9 @@ type processOptions struct {
 	EnableSummary   bool     // Whether to trigger summarization
 	SendResponse    bool     // Whether to send response via bus
 	NoHistory       bool     // If true, don't load session history (for heartbeat)
+
+	// OnToolCall, if set, is called as each tool call starts.
+	OnToolCall func(name string, args map[string]any)
 }
 
 const defaultResponse = "I've completed processing but have no response to give. Increase `max_tool_iterations` in config.json."
@@ -84,6 +101,11 @@ func NewAgentLoop(
 		stateManager = state.NewManager(defaultAgent.Workspace)
 	}
 
+	var redactor *redact.Redactor
+	if cfg.Redaction.Enabled {
+		redactor = redact.New(redact.Options{Secrets: cfg.Secrets(), PII: cfg.Redaction.PII})
+	}
+
 	return &AgentLoop{
 		bus:         msgBus,
 		cfg:         cfg,
@@ -91,6 +113,8 @@ func NewAgentLoop(
 		state:       stateManager,
 		summarizing: sync.Map{},
 		fallback:    fallbackChain,
+		redactor:    redactor,
+		provider:    provider,
 	}
 }
 
@@ -102,111 +126,121 @@ func registerSharedTools(
 	provider providers.LLMProvider,
 ) {
 	for _, agentID := range registry.ListAgentIDs() {
-		agent, ok := registry.GetAgent(agentID)
-		if !ok {
-			continue
+		if agent, ok := registry.GetAgent(agentID); ok {
+			registerAgentSharedTools(cfg, msgBus, registry, provider, agentID, agent)
 		}
+	}
+}
 
-		// Web tools
-		if cfg.Tools.IsToolEnabled("web") {
-			searchTool, err := tools.NewWebSearchTool(tools.WebSearchToolOptions{
-				BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
-				BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
-				BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
-				TavilyAPIKey:         cfg.Tools.Web.Tavily.APIKey,
-				TavilyBaseURL:        cfg.Tools.Web.Tavily.BaseURL,
-				TavilyMaxResults:     cfg.Tools.Web.Tavily.MaxResults,
-				TavilyEnabled:        cfg.Tools.Web.Tavily.Enabled,
-				DuckDuckGoMaxResults: cfg.Tools.Web.DuckDuckGo.MaxResults,
-				DuckDuckGoEnabled:    cfg.Tools.Web.DuckDuckGo.Enabled,
-				PerplexityAPIKey:     cfg.Tools.Web.Perplexity.APIKey,
-				PerplexityMaxResults: cfg.Tools.Web.Perplexity.MaxResults,
-				PerplexityEnabled:    cfg.Tools.Web.Perplexity.Enabled,
-				SearXNGBaseURL:       cfg.Tools.Web.SearXNG.BaseURL,
-				SearXNGMaxResults:    cfg.Tools.Web.SearXNG.MaxResults,
-				SearXNGEnabled:       cfg.Tools.Web.SearXNG.Enabled,
-				GLMSearchAPIKey:      cfg.Tools.Web.GLMSearch.APIKey,
-				GLMSearchBaseURL:     cfg.Tools.Web.GLMSearch.BaseURL,
-				GLMSearchEngine:      cfg.Tools.Web.GLMSearch.SearchEngine,
-				GLMSearchMaxResults:  cfg.Tools.Web.GLMSearch.MaxResults,
-				GLMSearchEnabled:     cfg.Tools.Web.GLMSearch.Enabled,
-				Proxy:                cfg.Tools.Web.Proxy,
-			})
-			if err != nil {
-				logger.ErrorCF("agent", "Failed to create web search tool", map[string]any{"error": err.Error()})
-			} else if searchTool != nil {
-				agent.Tools.Register(searchTool)
-			}
+// registerAgentSharedTools registers the shared tools on a single agent.
+func registerAgentSharedTools(
+	cfg *config.Config,
+	msgBus *bus.MessageBus,
+	registry *AgentRegistry,
+	provider providers.LLMProvider,
+	agentID string,
+	agent *AgentInstance,
+) {
+	// Web tools
+	if cfg.Tools.IsToolEnabled("web") {
+		searchTool, err := tools.NewWebSearchTool(tools.WebSearchToolOptions{
+			BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
+			BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
+			BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
+			TavilyAPIKey:         cfg.Tools.Web.Tavily.APIKey,
+			TavilyBaseURL:        cfg.Tools.Web.Tavily.BaseURL,
+			TavilyMaxResults:     cfg.Tools.Web.Tavily.MaxResults,
+			TavilyEnabled:        cfg.Tools.Web.Tavily.Enabled,
+			DuckDuckGoMaxResults: cfg.Tools.Web.DuckDuckGo.MaxResults,
+			DuckDuckGoEnabled:    cfg.Tools.Web.DuckDuckGo.Enabled,
+			PerplexityAPIKey:     cfg.Tools.Web.Perplexity.APIKey,
+			PerplexityMaxResults: cfg.Tools.Web.Perplexity.MaxResults,
+			PerplexityEnabled:    cfg.Tools.Web.Perplexity.Enabled,
+			SearXNGBaseURL:       cfg.Tools.Web.SearXNG.BaseURL,
+			SearXNGMaxResults:    cfg.Tools.Web.SearXNG.MaxResults,
+			SearXNGEnabled:       cfg.Tools.Web.SearXNG.Enabled,
+			GLMSearchAPIKey:      cfg.Tools.Web.GLMSearch.APIKey,
+			GLMSearchBaseURL:     cfg.Tools.Web.GLMSearch.BaseURL,
+			GLMSearchEngine:      cfg.Tools.Web.GLMSearch.SearchEngine,
+			GLMSearchMaxResults:  cfg.Tools.Web.GLMSearch.MaxResults,
+			GLMSearchEnabled:     cfg.Tools.Web.GLMSearch.Enabled,
+			Proxy:                cfg.Tools.Web.Proxy,
+		})
+		if err != nil {
+			logger.ErrorCF("agent", "Failed to create web search tool", map[string]any{"error": err.Error()})
+		} else if searchTool != nil {
+			agent.Tools.Register(searchTool)
 		}
-		if cfg.Tools.IsToolEnabled("web_fetch") {
-			fetchTool, err := tools.NewWebFetchToolWithProxy(50000, cfg.Tools.Web.Proxy, cfg.Tools.Web.FetchLimitBytes)
-			if err != nil {
-				logger.ErrorCF("agent", "Failed to create web fetch tool", map[string]any{"error": err.Error()})
-			} else {
-				agent.Tools.Register(fetchTool)
-			}
+	}
+	if cfg.Tools.IsToolEnabled("web_fetch") {
+		fetchTool, err := tools.NewWebFetchToolWithProxy(50000, cfg.Tools.Web.Proxy, cfg.Tools.Web.FetchLimitBytes)
+		if err != nil {
+			logger.ErrorCF("agent", "Failed to create web fetch tool", map[string]any{"error": err.Error()})
+		} else {
+			agent.Tools.Register(fetchTool)
 		}
+	}
 
-		// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
-		if cfg.Tools.IsToolEnabled("i2c") {
-			agent.Tools.Register(tools.NewI2CTool())
-		}
-		if cfg.Tools.IsToolEnabled("spi") {
-			agent.Tools.Register(tools.NewSPITool())
-		}
+	// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
+	if cfg.Tools.IsToolEnabled("i2c") {
+		agent.Tools.Register(tools.NewI2CTool())
+	}
+	if cfg.Tools.IsToolEnabled("spi") {
+		agent.Tools.Register(tools.NewSPITool())
+	}
 
-		// Message tool
-		if cfg.Tools.IsToolEnabled("message") {
-			messageTool := tools.NewMessageTool()
-			messageTool.SetSendCallback(func(channel, chatID, content string) error {
-				pubCtx, pubCancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer pubCancel()
-				return msgBus.PublishOutbound(pubCtx, bus.OutboundMessage{
-					Channel: channel,
-					ChatID:  chatID,
-					Content: content,
-				})
+	// Message tool
+	if cfg.Tools.IsToolEnabled("message") {
+		messageTool := tools.NewMessageTool()
+		messageTool.SetSendCallback(func(channel, chatID, content string, buttons [][]bus.Button) error {
+			pubCtx, pubCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer pubCancel()
+			return msgBus.PublishOutbound(pubCtx, bus.OutboundMessage{
+				Channel: channel,
+				ChatID:  chatID,
+				Content: content,
+				Buttons: buttons,
 			})
-			agent.Tools.Register(messageTool)
-		}
+		})
+		agent.Tools.Register(messageTool)
+	}
 
-		// Skill discovery and installation tools
-		skills_enabled := cfg.Tools.IsToolEnabled("skills")
-		find_skills_enable := cfg.Tools.IsToolEnabled("find_skills")
-		install_skills_enable := cfg.Tools.IsToolEnabled("install_skill")
-		if skills_enabled && (find_skills_enable || install_skills_enable) {
-			registryMgr := skills.NewRegistryManagerFromConfig(skills.RegistryConfig{
-				MaxConcurrentSearches: cfg.Tools.Skills.MaxConcurrentSearches,
-				ClawHub:               skills.ClawHubConfig(cfg.Tools.Skills.Registries.ClawHub),
-			})
+	// Skill discovery and installation tools
+	skills_enabled := cfg.Tools.IsToolEnabled("skills")
+	find_skills_enable := cfg.Tools.IsToolEnabled("find_skills")
+	install_skills_enable := cfg.Tools.IsToolEnabled("install_skill")
+	if skills_enabled && (find_skills_enable || install_skills_enable) {
+		registryMgr := skills.NewRegistryManagerFromConfig(skills.RegistryConfig{
+			MaxConcurrentSearches: cfg.Tools.Skills.MaxConcurrentSearches,
+			ClawHub:               skills.ClawHubConfig(cfg.Tools.Skills.Registries.ClawHub),
+		})
 
-			if find_skills_enable {
-				searchCache := skills.NewSearchCache(
-					cfg.Tools.Skills.SearchCache.MaxSize,
-					time.Duration(cfg.Tools.Skills.SearchCache.TTLSeconds)*time.Second,
-				)
-				agent.Tools.Register(tools.NewFindSkillsTool(registryMgr, searchCache))
-			}
+		if find_skills_enable {
+			searchCache := skills.NewSearchCache(
+				cfg.Tools.Skills.SearchCache.MaxSize,
+				time.Duration(cfg.Tools.Skills.SearchCache.TTLSeconds)*time.Second,
+			)
+			agent.Tools.Register(tools.NewFindSkillsTool(registryMgr, searchCache))
+		}
 
-			if install_skills_enable {
-				agent.Tools.Register(tools.NewInstallSkillTool(registryMgr, agent.Workspace))
-			}
+		if install_skills_enable {
+			agent.Tools.Register(tools.NewInstallSkillTool(registryMgr, agent.Workspace))
 		}
+	}
 
-		// Spawn tool with allowlist checker
-		if cfg.Tools.IsToolEnabled("spawn") {
-			if cfg.Tools.IsToolEnabled("subagent") {
-				subagentManager := tools.NewSubagentManager(provider, agent.Model, agent.Workspace, msgBus)
-				subagentManager.SetLLMOptions(agent.MaxTokens, agent.Temperature)
-				spawnTool := tools.NewSpawnTool(subagentManager)
-				currentAgentID := agentID
-				spawnTool.SetAllowlistChecker(func(targetAgentID string) bool {
-					return registry.CanSpawnSubagent(currentAgentID, targetAgentID)
-				})
-				agent.Tools.Register(spawnTool)
-			} else {
-				logger.WarnCF("agent", "spawn tool requires subagent to be enabled", nil)
-			}
+	// Spawn tool with allowlist checker
+	if cfg.Tools.IsToolEnabled("spawn") {
+		if cfg.Tools.IsToolEnabled("subagent") {
+			subagentManager := tools.NewSubagentManager(provider, agent.Model, agent.Workspace, msgBus)
+			subagentManager.SetLLMOptions(agent.MaxTokens, agent.Temperature)
+			spawnTool := tools.NewSpawnTool(subagentManager)
+			currentAgentID := agentID
+			spawnTool.SetAllowlistChecker(func(targetAgentID string) bool {
+				return registry.CanSpawnSubagent(currentAgentID, targetAgentID)
+			})
+			agent.Tools.Register(spawnTool)
+		} else {
+			logger.WarnCF("agent", "spawn tool requires subagent to be enabled", nil)
 		}
 	}
 }
@@ -215,71 +249,14 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
 
 	// Initialize MCP servers for all agents
-	if al.cfg.Tools.IsToolEnabled("mcp") {
-		mcpManager := mcp.NewManager()
-		// Ensure MCP connections are cleaned up on exit, regardless of initialization success
-		// This fixes resource leak when LoadFromMCPConfig partially succeeds then fails
-		defer func() {
-			if err := mcpManager.Close(); err != nil {
-				logger.ErrorCF("agent", "Failed to close MCP manager",
-					map[string]any{
-						"error": err.Error(),
-					})
-			}
-		}()
-
-		defaultAgent := al.registry.GetDefaultAgent()
-		var workspacePath string
-		if defaultAgent != nil && defaultAgent.Workspace != "" {
-			workspacePath = defaultAgent.Workspace
-		} else {
-			workspacePath = al.cfg.WorkspacePath()
-		}
-
-		if err := mcpManager.LoadFromMCPConfig(ctx, al.cfg.Tools.MCP, workspacePath); err != nil {
-			logger.WarnCF("agent", "Failed to load MCP servers, MCP tools will not be available",
-				map[string]any{
-					"error": err.Error(),
-				})
-		} else {
-			// Register MCP tools for all agents
-			servers := mcpManager.GetServers()
-			uniqueTools := 0
-			totalRegistrations := 0
-			agentIDs := al.registry.ListAgentIDs()
-			agentCount := len(agentIDs)
-
-			for serverName, conn := range servers {
-				uniqueTools += len(conn.Tools)
-				for _, tool := range conn.Tools {
-					for _, agentID := range agentIDs {
-						agent, ok := al.registry.GetAgent(agentID)
-						if !ok {
-							continue
-						}
-
-						mcpTool := tools.NewMCPTool(mcpManager, serverName, tool)
-						agent.Tools.Register(mcpTool)
-						totalRegistrations++
-						logger.DebugCF("agent", "Registered MCP tool",
-							map[string]any{
-								"agent_id": agentID,
-								"server":   serverName,
-								"tool":     tool.Name,
-								"name":     mcpTool.Name(),
-							})
-					}
-				}
-			}
-			logger.InfoCF("agent", "MCP tools registered successfully",
-				map[string]any{
-					"server_count":        len(servers),
-					"unique_tools":        uniqueTools,
-					"total_registrations": totalRegistrations,
-					"agent_count":         agentCount,
-				})
-		}
+	al.mu.Lock()
+	al.mcpCtx = ctx
+	al.mu.Unlock()
+	if cfg := al.config(); cfg.Tools.IsToolEnabled("mcp") {
+		al.startMCP(ctx, cfg)
 	}
+	// Ensure MCP connections are cleaned up on exit, regardless of initialization success
+	defer al.stopMCP()
 
 	for al.running.Load() {
 		select {
@@ -329,7 +306,8 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 						al.bus.PublishOutbound(ctx, bus.OutboundMessage{
 							Channel: msg.Channel,
 							ChatID:  msg.ChatID,
-							Content: response,
+							Content: al.redactOutbound(response),
+							ReplyTo: msg.MessageID,
 						})
 						logger.InfoCF("agent", "Published outbound response",
 							map[string]any{
@@ -357,6 +335,9 @@ func (al *AgentLoop) Stop() {
 }
 
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
+	al.mu.Lock()
+	al.extraTools = append(al.extraTools, tool)
+	al.mu.Unlock()
 	for _, agentID := range al.registry.ListAgentIDs() {
 		if agent, ok := al.registry.GetAgent(agentID); ok {
 			agent.Tools.Register(tool)
@@ -529,7 +510,7 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	if strings.Contains(msg.Content, "Error:") || strings.Contains(msg.Content, "error") {
 		logContent = msg.Content // Full content for errors
 	} else {
-		logContent = utils.Truncate(msg.Content, 80)
+		logContent = utils.Truncate(logger.Redact(msg.Content), 80)
 	}
 	logger.InfoCF(
 		"agent",
@@ -555,22 +536,11 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	}
 
 	// Route to determine agent and session key
-	route := al.registry.ResolveRoute(routing.RouteInput{
-		Channel:    msg.Channel,
-		AccountID:  msg.Metadata["account_id"],
-		Peer:       extractPeer(msg),
-		ParentPeer: extractParentPeer(msg),
-		GuildID:    msg.Metadata["guild_id"],
-		TeamID:     msg.Metadata["team_id"],
-	})
-
-	agent, ok := al.registry.GetAgent(route.AgentID)
-	if !ok {
-		agent = al.registry.GetDefaultAgent()
-	}
-	if agent == nil {
-		return "", fmt.Errorf("no agent available for route (agent_id=%s)", route.AgentID)
+	agent, route, err := al.resolveSession(msg)
+	if err != nil {
+		return "", err
 	}
+	sessionKey := route.SessionKey
 
 	// Reset message-tool state for this round so we don't skip publishing due to a previous round.
 	if tool, ok := agent.Tools.Get("message"); ok {
@@ -579,12 +549,6 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		}
 	}
 
-	// Use routed session key, but honor pre-set agent-scoped keys (for ProcessDirect/cron)
-	sessionKey := route.SessionKey
-	if msg.SessionKey != "" && strings.HasPrefix(msg.SessionKey, "agent:") {
-		sessionKey = msg.SessionKey
-	}
-
 	logger.InfoCF("agent", "Routed message",
 		map[string]any{
 			"agent_id":    agent.ID,
@@ -604,6 +568,34 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	})
 }
 
+// resolveSession routes an inbound message to the agent that should handle it.
+// The returned route's SessionKey is the key the conversation is stored under.
+func (al *AgentLoop) resolveSession(msg bus.InboundMessage) (*AgentInstance, routing.ResolvedRoute, error) {
+	route := al.registry.ResolveRoute(routing.RouteInput{
+		Channel:    msg.Channel,
+		AccountID:  msg.Metadata["account_id"],
+		Peer:       extractPeer(msg),
+		ParentPeer: extractParentPeer(msg),
+		GuildID:    msg.Metadata["guild_id"],
+		TeamID:     msg.Metadata["team_id"],
+	})
+
+	agent, ok := al.registry.GetAgent(route.AgentID)
+	if !ok {
+		agent = al.registry.GetDefaultAgent()
+	}
+	if agent == nil {
+		return nil, route, fmt.Errorf("no agent available for route (agent_id=%s)", route.AgentID)
+	}
+
+	// Use routed session key, but honor pre-set agent-scoped keys (for ProcessDirect/cron)
+	if msg.SessionKey != "" && strings.HasPrefix(msg.SessionKey, "agent:") {
+		route.SessionKey = msg.SessionKey
+	}
+
+	return agent, route, nil
+}
+
 func (al *AgentLoop) processSystemMessage(
 	ctx context.Context,
 	msg bus.InboundMessage,
@@ -697,7 +689,7 @@ func (al *AgentLoop) runAgentLoop(
 		history = agent.Sessions.GetHistory(opts.SessionKey)
 		summary = agent.Sessions.GetSummary(opts.SessionKey)
 	}
-	messages := agent.ContextBuilder.BuildMessages(
+	messages := agent.ContextFor(opts.SessionKey).BuildMessages(
 		history,
 		summary,
 		opts.UserMessage,
@@ -707,11 +699,12 @@ func (al *AgentLoop) runAgentLoop(
 	)
 
 	// Resolve media:// refs to base64 data URLs (streaming)
-	maxMediaSize := al.cfg.Agents.Defaults.GetMaxMediaSize()
+	maxMediaSize := al.config().Agents.Defaults.GetMaxMediaSize()
 	messages = resolveMediaRefs(messages, al.mediaStore, maxMediaSize)
 
 	// 2. Save user message to session
 	agent.Sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+	agent.Sessions.SetChannel(opts.SessionKey, opts.Channel)
 
 	// 3. Run LLM iteration loop
 	finalContent, iteration, err := al.runLLMIteration(ctx, agent, messages, opts)
@@ -741,12 +734,12 @@ func (al *AgentLoop) runAgentLoop(
 		al.bus.PublishOutbound(ctx, bus.OutboundMessage{
 			Channel: opts.Channel,
 			ChatID:  opts.ChatID,
-			Content: finalContent,
+			Content: al.redactOutbound(finalContent),
 		})
 	}
 
 	// 8. Log response
-	responsePreview := utils.Truncate(finalContent, 120)
+	responsePreview := utils.Truncate(logger.Redact(finalContent), 120)
 	logger.InfoCF("agent", fmt.Sprintf("Response: %s", responsePreview),
 		map[string]any{
 			"agent_id":     agent.ID,
@@ -824,6 +817,13 @@ func (al *AgentLoop) runLLMIteration(
 	iteration := 0
 	var finalContent string
 
+	// With per-peer isolation, file and exec tools are confined to the
+	// peer's own scratch directory instead of the agent workspace.
+	toolCtx := ctx
+	if scope := agent.WorkspaceScope(opts.SessionKey); scope != nil {
+		toolCtx = tools.WithWorkspaceScope(ctx, scope)
+	}
+
 	for iteration < agent.MaxIterations {
 		iteration++
 
@@ -963,7 +963,7 @@ func (al *AgentLoop) runLLMIteration(
 				al.forceCompression(agent, opts.SessionKey)
 				newHistory := agent.Sessions.GetHistory(opts.SessionKey)
 				newSummary := agent.Sessions.GetSummary(opts.SessionKey)
-				messages = agent.ContextBuilder.BuildMessages(
+				messages = agent.ContextFor(opts.SessionKey).BuildMessages(
 					newHistory, newSummary, "",
 					nil, opts.Channel, opts.ChatID,
 				)
@@ -1079,13 +1079,16 @@ func (al *AgentLoop) runLLMIteration(
 				defer wg.Done()
 
 				argsJSON, _ := json.Marshal(tc.Arguments)
-				argsPreview := utils.Truncate(string(argsJSON), 200)
+				argsPreview := utils.Truncate(logger.Redact(string(argsJSON)), 200)
 				logger.InfoCF("agent", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
 					map[string]any{
 						"agent_id":  agent.ID,
 						"tool":      tc.Name,
 						"iteration": iteration,
 					})
+				if opts.OnToolCall != nil {
+					opts.OnToolCall(tc.Name, tc.Arguments)
+				}
 
 				// Create async callback for tools that implement AsyncExecutor
 				asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
@@ -1099,7 +1102,7 @@ func (al *AgentLoop) runLLMIteration(
 				}
 
 				toolResult := agent.Tools.ExecuteWithContext(
-					ctx,
+					toolCtx,
 					tc.Name,
 					tc.Arguments,
 					opts.Channel,
@@ -1118,7 +1121,7 @@ func (al *AgentLoop) runLLMIteration(
 				al.bus.PublishOutbound(ctx, bus.OutboundMessage{
 					Channel: opts.Channel,
 					ChatID:  opts.ChatID,
-					Content: r.result.ForUser,
+					Content: al.redactOutbound(r.result.ForUser),
 				})
 				logger.DebugCF("agent", "Sent tool result to user",
 					map[string]any{
@@ -1153,6 +1156,7 @@ func (al *AgentLoop) runLLMIteration(
 			if contentForLLM == "" && r.result.Err != nil {
 				contentForLLM = r.result.Err.Error()
 			}
+			contentForLLM = al.redactToolResult(r.tc.Name, contentForLLM)
 
 			toolResultMsg := providers.Message{
 				Role:       "tool",
@@ -1286,13 +1290,13 @@ func formatMessagesForLog(messages []providers.Message) string {
 					fmt.Fprintf(
 						&sb,
 						"      Arguments: %s\n",
-						utils.Truncate(tc.Function.Arguments, 200),
+						utils.Truncate(logger.Redact(tc.Function.Arguments), 200),
 					)
 				}
 			}
 		}
 		if msg.Content != "" {
-			content := utils.Truncate(msg.Content, 200)
+			content := utils.Truncate(logger.Redact(msg.Content), 200)
 			fmt.Fprintf(&sb, "  Content: %s\n", content)
 		}
 		if msg.ToolCallID != "" {
@@ -1545,6 +1549,9 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 		default:
 			return fmt.Sprintf("Unknown switch target: %s", target), true
 		}
+
+	case "/new", "/reset", "/sessions", "/resume", "/rename", "/compact", "/history", "/export":
+		return al.handleSessionCommand(ctx, msg, cmd, args), true
 	}
 
 	return "", false
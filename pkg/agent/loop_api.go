@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+// apiChannel is the channel name API turns are recorded under.
+const apiChannel = "openai"
+
+// ErrUnknownAgent is returned by ProcessAPIRequest for an agent ID that is
+// not configured.
+var ErrUnknownAgent = errors.New("unknown agent")
+
+// APIRequest is one turn submitted through the OpenAI-compatible API rather
+// than a chat channel.
+type APIRequest struct {
+	// AgentID selects the agent; "" means the default agent.
+	AgentID string
+	// SessionID names a conversation the caller keeps on the server. Turns
+	// with the same SessionID share a session and run one at a time, so only
+	// the newest message needs to be sent. With no SessionID, the turn runs
+	// in a throwaway session seeded from History.
+	SessionID string
+	History   []providers.Message
+	Content   string
+	// OnToolCall, if set, is called as each tool call starts. Tool calls run
+	// in parallel, so it must be safe for concurrent use.
+	OnToolCall func(name string, args map[string]any)
+}
+
+// ListAgentIDs returns the IDs of the configured agents, sorted.
+func (al *AgentLoop) ListAgentIDs() []string {
+	ids := al.registry.ListAgentIDs()
+	sort.Strings(ids)
+	return ids
+}
+
+// ProcessAPIRequest runs one turn of req's agent and returns its final
+// answer. Unlike channel messages it bypasses the bus and bindings, and chat
+// commands are not interpreted.
+func (al *AgentLoop) ProcessAPIRequest(ctx context.Context, req APIRequest) (string, error) {
+	var agent *AgentInstance
+	if req.AgentID == "" {
+		agent = al.registry.GetDefaultAgent()
+	} else if a, ok := al.registry.GetAgent(req.AgentID); ok {
+		agent = a
+	}
+	if agent == nil {
+		return "", fmt.Errorf("%w: %q", ErrUnknownAgent, req.AgentID)
+	}
+
+	opts := processOptions{
+		Channel:         apiChannel,
+		UserMessage:     req.Content,
+		DefaultResponse: defaultResponse,
+		OnToolCall:      req.OnToolCall,
+	}
+	if req.SessionID != "" {
+		opts.SessionKey = strings.ToLower(routing.BuildAgentPeerSessionKey(routing.SessionKeyParams{
+			AgentID: agent.ID,
+			Channel: apiChannel,
+			Peer:    &routing.RoutePeer{Kind: "direct", ID: req.SessionID},
+			DMScope: routing.DMScopePerChannelPeer,
+		}))
+		opts.ChatID = req.SessionID
+		opts.EnableSummary = true
+
+		// Concurrent turns on one session would interleave their messages
+		// in its history.
+		unlock, err := al.lockAPISession(ctx, opts.SessionKey)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+	} else {
+		id := make([]byte, 8)
+		rand.Read(id)
+		opts.SessionKey = fmt.Sprintf("agent:%s:%s:request:%s", agent.ID, apiChannel, hex.EncodeToString(id))
+		opts.ChatID = "request"
+		agent.Sessions.GetOrCreate(opts.SessionKey)
+		agent.Sessions.SetHistory(opts.SessionKey, req.History)
+		defer func() {
+			if err := agent.Sessions.Delete(opts.SessionKey); err != nil && !errors.Is(err, session.ErrSessionNotFound) {
+				logger.WarnCF("agent", "Failed to delete API request session", map[string]any{
+					"session_key": opts.SessionKey,
+					"error":       err.Error(),
+				})
+			}
+		}()
+	}
+
+	logger.InfoCF("agent", "Processing API request", map[string]any{
+		"agent_id":    agent.ID,
+		"session_key": opts.SessionKey,
+	})
+
+	content, err := al.runAgentLoop(ctx, agent, opts)
+	if err != nil {
+		return "", err
+	}
+	return al.redactOutbound(content), nil
+}
+
+// apiSessionLock serializes the API turns of one session. refs counts the
+// turns holding or waiting for it, so it can be dropped when the last one is
+// done.
+type apiSessionLock struct {
+	sem  chan struct{}
+	refs int
+}
+
+// lockAPISession waits until no other API turn runs on sessionKey, or ctx is
+// done. The returned function releases the session.
+func (al *AgentLoop) lockAPISession(ctx context.Context, sessionKey string) (func(), error) {
+	al.apiMu.Lock()
+	if al.apiSessions == nil {
+		al.apiSessions = make(map[string]*apiSessionLock)
+	}
+	l := al.apiSessions[sessionKey]
+	if l == nil {
+		l = &apiSessionLock{sem: make(chan struct{}, 1)}
+		al.apiSessions[sessionKey] = l
+	}
+	l.refs++
+	al.apiMu.Unlock()
+
+	release := func() {
+		al.apiMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(al.apiSessions, sessionKey)
+		}
+		al.apiMu.Unlock()
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		return func() {
+			<-l.sem
+			release()
+		}, nil
+	case <-ctx.Done():
+		release()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// recordingProvider answers every call and keeps the messages it was sent.
+type recordingProvider struct {
+	mu    sync.Mutex
+	calls [][]providers.Message
+}
+
+func (p *recordingProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, messages)
+	return &providers.LLMResponse{Content: "answer"}, nil
+}
+
+func (p *recordingProvider) GetDefaultModel() string { return "recording-model" }
+
+func (p *recordingProvider) last() []providers.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[len(p.calls)-1]
+}
+
+func contains(msgs []providers.Message, role, content string) bool {
+	for _, m := range msgs {
+		if m.Role == role && m.Content == content {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProcessAPIRequest(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &recordingProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	agent := al.registry.GetDefaultAgent()
+	ctx := context.Background()
+
+	t.Run("stateless", func(t *testing.T) {
+		reply, err := al.ProcessAPIRequest(ctx, APIRequest{
+			History: []providers.Message{
+				{Role: "user", Content: "my name is Ada"},
+				{Role: "assistant", Content: "hi Ada"},
+			},
+			Content: "what is my name?",
+		})
+		if err != nil || reply != "answer" {
+			t.Fatalf("reply = %q, err = %v", reply, err)
+		}
+		msgs := provider.last()
+		if !contains(msgs, "user", "my name is Ada") || !contains(msgs, "assistant", "hi Ada") {
+			t.Fatalf("history not sent to the model: %+v", msgs)
+		}
+		for _, info := range agent.Sessions.List() {
+			if strings.Contains(info.Key, ":request:") {
+				t.Fatalf("throwaway session %s was kept", info.Key)
+			}
+		}
+	})
+
+	t.Run("session", func(t *testing.T) {
+		for _, content := range []string{"first", "second"} {
+			if _, err := al.ProcessAPIRequest(ctx, APIRequest{SessionID: "Alice", Content: content}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if msgs := provider.last(); !contains(msgs, "user", "first") || !contains(msgs, "assistant", "answer") {
+			t.Fatalf("earlier turn missing from session: %+v", msgs)
+		}
+		if history := agent.Sessions.GetHistory("agent:main:openai:direct:alice"); len(history) != 4 {
+			t.Fatalf("session history has %d messages, want 4", len(history))
+		}
+	})
+
+	t.Run("one turn per session", func(t *testing.T) {
+		unlock, err := al.lockAPISession(ctx, "s1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := al.lockAPISession(waitCtx, "s1"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("second turn on a busy session: err = %v, want DeadlineExceeded", err)
+		}
+		if other, err := al.lockAPISession(ctx, "s2"); err != nil {
+			t.Fatalf("other session blocked: %v", err)
+		} else {
+			other()
+		}
+		unlock()
+		if len(al.apiSessions) != 0 {
+			t.Fatalf("idle session locks kept: %v", al.apiSessions)
+		}
+	})
+
+	t.Run("unknown agent", func(t *testing.T) {
+		_, err := al.ProcessAPIRequest(ctx, APIRequest{AgentID: "nobody", Content: "hi"})
+		if !errors.Is(err, ErrUnknownAgent) {
+			t.Fatalf("err = %v, want ErrUnknownAgent", err)
+		}
+	})
+
+	if ids := al.ListAgentIDs(); len(ids) != 1 || ids[0] != "main" {
+		t.Fatalf("ListAgentIDs() = %v", ids)
+	}
+}
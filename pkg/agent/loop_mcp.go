@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mcp"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// startMCP connects to the configured MCP servers and registers their tools
+// on every agent. The manager is kept so the tools can be added to agents
+// rebuilt by a reload, and so stopMCP can close the connections.
+func (al *AgentLoop) startMCP(ctx context.Context, cfg *config.Config) {
+	mcpManager := mcp.NewManager()
+	// Keep the manager even when loading fails part-way, so the connections
+	// that did succeed are closed by stopMCP.
+	al.mu.Lock()
+	al.mcpManager = mcpManager
+	al.mcpTools = nil
+	al.mu.Unlock()
+
+	defaultAgent := al.registry.GetDefaultAgent()
+	var workspacePath string
+	if defaultAgent != nil && defaultAgent.Workspace != "" {
+		workspacePath = defaultAgent.Workspace
+	} else {
+		workspacePath = cfg.WorkspacePath()
+	}
+
+	if err := mcpManager.LoadFromMCPConfig(ctx, cfg.Tools.MCP, workspacePath); err != nil {
+		logger.WarnCF("agent", "Failed to load MCP servers, MCP tools will not be available",
+			map[string]any{
+				"error": err.Error(),
+			})
+		return
+	}
+
+	// Register MCP tools for all agents
+	servers := mcpManager.GetServers()
+	var mcpTools []tools.Tool
+	totalRegistrations := 0
+	agentIDs := al.registry.ListAgentIDs()
+
+	for serverName, conn := range servers {
+		for _, tool := range conn.Tools {
+			mcpTool := tools.NewMCPTool(mcpManager, serverName, tool)
+			mcpTools = append(mcpTools, mcpTool)
+			for _, agentID := range agentIDs {
+				agent, ok := al.registry.GetAgent(agentID)
+				if !ok {
+					continue
+				}
+
+				agent.Tools.Register(mcpTool)
+				totalRegistrations++
+				logger.DebugCF("agent", "Registered MCP tool",
+					map[string]any{
+						"agent_id": agentID,
+						"server":   serverName,
+						"tool":     tool.Name,
+						"name":     mcpTool.Name(),
+					})
+			}
+		}
+	}
+	al.mu.Lock()
+	al.mcpTools = mcpTools
+	al.mu.Unlock()
+
+	logger.InfoCF("agent", "MCP tools registered successfully",
+		map[string]any{
+			"server_count":        len(servers),
+			"unique_tools":        len(mcpTools),
+			"total_registrations": totalRegistrations,
+			"agent_count":         len(agentIDs),
+		})
+}
+
+// stopMCP unregisters the MCP tools from every agent and closes the server
+// connections.
+func (al *AgentLoop) stopMCP() {
+	al.mu.Lock()
+	mcpManager, mcpTools := al.mcpManager, al.mcpTools
+	al.mcpManager, al.mcpTools = nil, nil
+	al.mu.Unlock()
+
+	if mcpManager == nil {
+		return
+	}
+	for _, agentID := range al.registry.ListAgentIDs() {
+		if agent, ok := al.registry.GetAgent(agentID); ok {
+			for _, tool := range mcpTools {
+				agent.Tools.Unregister(tool.Name())
+			}
+		}
+	}
+	if err := mcpManager.Close(); err != nil {
+		logger.ErrorCF("agent", "Failed to close MCP manager",
+			map[string]any{
+				"error": err.Error(),
+			})
+	}
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/redact"
+)
+
+// redaction returns the current redaction settings and redactor, which a
+// config reload may replace.
+func (al *AgentLoop) redaction() (config.RedactionConfig, *redact.Redactor) {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	return al.cfg.Redaction, al.redactor
+}
+
+// redactToolResult masks secrets in a tool result before it is added to the
+// model context and the session history. Tools such as exec or read_file can
+// easily surface environment variables or the config file.
+func (al *AgentLoop) redactToolResult(toolName, content string) string {
+	cfg, redactor := al.redaction()
+	if !cfg.Enabled || !cfg.ToolResults {
+		return content
+	}
+	redacted, n := redactor.Redact(content)
+	if n > 0 {
+		logger.DebugCF("agent", "Redacted tool result",
+			map[string]any{
+				"tool":       toolName,
+				"redactions": n,
+			})
+	}
+	return redacted
+}
+
+// redactOutbound masks secrets in a reply before it is sent to the chat, when
+// outbound redaction is enabled.
+func (al *AgentLoop) redactOutbound(content string) string {
+	cfg, redactor := al.redaction()
+	if !cfg.Enabled || !cfg.Outbound {
+		return content
+	}
+	redacted, n := redactor.Redact(content)
+	if n > 0 {
+		logger.DebugCF("agent", "Redacted outbound message",
+			map[string]any{
+				"redactions": n,
+			})
+	}
+	return redacted
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"reflect"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/redact"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// config returns the config currently in effect.
+func (al *AgentLoop) config() *config.Config {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	return al.cfg
+}
+
+// ReloadConfig applies a new config without restarting the loop. Agents whose
+// configuration did not change keep running with their existing instance;
+// changed or new agents are rebuilt and get the shared, extra and MCP tools
+// registered again. A non-nil provider that differs from the current one
+// rebuilds every agent. MCP servers are reconnected only when tools.mcp
+// changed.
+func (al *AgentLoop) ReloadConfig(cfg *config.Config, provider providers.LLMProvider) {
+	var redactor *redact.Redactor
+	if cfg.Redaction.Enabled {
+		redactor = redact.New(redact.Options{Secrets: cfg.Secrets(), PII: cfg.Redaction.PII})
+	}
+
+	al.mu.Lock()
+	old := al.cfg
+	providerChanged := provider != nil && provider != al.provider
+	if providerChanged {
+		al.provider = provider
+	}
+	provider = al.provider
+	al.cfg = cfg
+	al.redactor = redactor
+	extraTools := append([]tools.Tool(nil), al.extraTools...)
+	mcpCtx, mcpTools := al.mcpCtx, al.mcpTools
+	al.mu.Unlock()
+
+	rebuilt := al.registry.Reload(cfg, provider, providerChanged)
+	mcpChanged := old.Tools.IsToolEnabled("mcp") != cfg.Tools.IsToolEnabled("mcp") ||
+		!reflect.DeepEqual(old.Tools.MCP, cfg.Tools.MCP)
+
+	for _, agentID := range rebuilt {
+		agent, ok := al.registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		registerAgentSharedTools(cfg, al.bus, al.registry, provider, agentID, agent)
+		for _, tool := range extraTools {
+			agent.Tools.Register(tool)
+		}
+		if !mcpChanged {
+			for _, tool := range mcpTools {
+				agent.Tools.Register(tool)
+			}
+		}
+	}
+
+	// MCP servers are only running once Run has started; Run connects them
+	// with the new config otherwise.
+	if mcpChanged && mcpCtx != nil {
+		logger.InfoCF("agent", "Reloading MCP servers", nil)
+		al.stopMCP()
+		if cfg.Tools.IsToolEnabled("mcp") {
+			al.startMCP(mcpCtx, cfg)
+		}
+	}
+
+	logger.InfoCF("agent", "Agent config reloaded",
+		map[string]any{
+			"rebuilt_agents":   len(rebuilt),
+			"provider_changed": providerChanged,
+			"mcp_reloaded":     mcpChanged && mcpCtx != nil,
+		})
+}
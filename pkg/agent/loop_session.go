@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const defaultHistoryLimit = 10
+
+// handleSessionCommand implements the session lifecycle chat commands. Every
+// command operates on the session key the message would be routed to, so
+// "/new" in one chat never touches another chat's conversation.
+func (al *AgentLoop) handleSessionCommand(
+	ctx context.Context,
+	msg bus.InboundMessage,
+	cmd string,
+	args []string,
+) string {
+	agent, route, err := al.resolveSession(msg)
+	if err != nil {
+		return err.Error()
+	}
+	sessionKey := route.SessionKey
+	sessions := agent.Sessions
+
+	switch cmd {
+	case "/new":
+		id, ok := sessions.Archive(sessionKey)
+		if !ok {
+			return "Started a new session."
+		}
+		return fmt.Sprintf("Started a new session. Previous session saved as %s (use /resume %s to return).", id, id)
+
+	case "/reset":
+		if err := sessions.Delete(sessionKey); err != nil && !errors.Is(err, session.ErrSessionNotFound) {
+			return fmt.Sprintf("Failed to reset session: %v", err)
+		}
+		return "Session cleared."
+
+	case "/sessions":
+		return formatSessionList(sessions, sessionKey)
+
+	case "/resume":
+		if len(args) < 1 {
+			return "Usage: /resume <id>"
+		}
+		prevID, err := sessions.Restore(sessionKey, args[0])
+		if errors.Is(err, session.ErrSessionNotFound) {
+			return fmt.Sprintf("Session '%s' not found. Use /sessions to list saved sessions.", args[0])
+		}
+		if err != nil {
+			return fmt.Sprintf("Failed to resume session: %v", err)
+		}
+		if prevID != "" {
+			return fmt.Sprintf("Resumed session %s. Previous session saved as %s.", args[0], prevID)
+		}
+		return fmt.Sprintf("Resumed session %s.", args[0])
+
+	case "/rename":
+		if len(args) < 1 {
+			return "Usage: /rename <title>"
+		}
+		title := strings.Join(args, " ")
+		sessions.GetOrCreate(sessionKey)
+		sessions.SetTitle(sessionKey, title)
+		sessions.Save(sessionKey)
+		return fmt.Sprintf("Session renamed to %q.", title)
+
+	case "/compact":
+		before := len(sessions.GetHistory(sessionKey))
+		al.summarizeSession(agent, sessionKey)
+		after := len(sessions.GetHistory(sessionKey))
+		if after >= before {
+			return "Nothing to compact."
+		}
+		return fmt.Sprintf("Compacted %d messages into the session summary.", before-after)
+
+	case "/history":
+		limit := defaultHistoryLimit
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return "Usage: /history [count]"
+			}
+			limit = n
+		}
+		return formatSessionHistory(sessions.GetHistory(sessionKey), limit)
+
+	case "/export":
+		format, err := session.ParseExportFormat(strings.Join(args, ""))
+		if err != nil {
+			return "Usage: /export [markdown|html|json]"
+		}
+		return al.exportSession(ctx, msg, agent, sessionKey, format)
+	}
+
+	return fmt.Sprintf("Unknown session command: %s", cmd)
+}
+
+// exportSession renders the session to a file and sends it back to the chat
+// as a document through the channel's MediaSender.
+func (al *AgentLoop) exportSession(
+	ctx context.Context,
+	msg bus.InboundMessage,
+	agent *AgentInstance,
+	sessionKey string,
+	format session.ExportFormat,
+) string {
+	snapshot, ok := agent.Sessions.Snapshot(sessionKey)
+	if !ok || len(snapshot.Messages) == 0 {
+		return "Nothing to export."
+	}
+	if al.mediaStore == nil {
+		return "Export is not available: media store not configured."
+	}
+	if al.channelManager != nil {
+		ch, exists := al.channelManager.GetChannel(msg.Channel)
+		if !exists {
+			return fmt.Sprintf("Export is not available on channel %s.", msg.Channel)
+		}
+		if _, ok := ch.(channels.MediaSender); !ok {
+			return fmt.Sprintf("Channel %s cannot send files.", msg.Channel)
+		}
+	}
+
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		return fmt.Sprintf("Failed to export session: %v", err)
+	}
+	f, err := os.CreateTemp(mediaDir, "session-*"+format.Extension())
+	if err != nil {
+		return fmt.Sprintf("Failed to export session: %v", err)
+	}
+	err = session.Export(f, snapshot, format)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Sprintf("Failed to export session: %v", err)
+	}
+
+	filename := "session-" + time.Now().Format("20060102-150405") + format.Extension()
+	scope := channels.BuildMediaScope(msg.Channel, msg.ChatID, "")
+	ref, err := al.mediaStore.Store(f.Name(), media.MediaMeta{
+		Filename:    filename,
+		ContentType: format.ContentType(),
+		Source:      "agent:export",
+	}, scope)
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Sprintf("Failed to export session: %v", err)
+	}
+
+	err = al.bus.PublishOutboundMedia(ctx, bus.OutboundMediaMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Parts: []bus.MediaPart{{
+			Type:        "file",
+			Ref:         ref,
+			Filename:    filename,
+			ContentType: format.ContentType(),
+		}},
+	})
+	if err != nil {
+		return fmt.Sprintf("Failed to send export: %v", err)
+	}
+	return fmt.Sprintf("Exported session as %s.", filename)
+}
+
+func formatSessionList(sessions *session.SessionManager, sessionKey string) string {
+	var sb strings.Builder
+
+	sb.WriteString("Current session")
+	if info, ok := sessions.Info(sessionKey); ok {
+		if info.Title != "" {
+			fmt.Fprintf(&sb, " %q", info.Title)
+		}
+		fmt.Fprintf(&sb, ": %d messages, updated %s\n", info.Messages, info.Updated.Format("2006-01-02 15:04"))
+	} else {
+		sb.WriteString(": empty\n")
+	}
+
+	archived := sessions.ListArchived(sessionKey)
+	if len(archived) == 0 {
+		sb.WriteString("No saved sessions.")
+		return sb.String()
+	}
+
+	sb.WriteString("Saved sessions:")
+	for _, info := range archived {
+		_, id, _ := session.SplitArchiveKey(info.Key)
+		fmt.Fprintf(&sb, "\n  %s", id)
+		if info.Title != "" {
+			fmt.Fprintf(&sb, " %q", info.Title)
+		}
+		fmt.Fprintf(&sb, " (%d messages, updated %s)", info.Messages, info.Updated.Format("2006-01-02 15:04"))
+	}
+	return sb.String()
+}
+
+func formatSessionHistory(history []providers.Message, limit int) string {
+	var lines []string
+	for _, m := range history {
+		if (m.Role != "user" && m.Role != "assistant") || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", m.Role, utils.Truncate(m.Content, 200)))
+	}
+	if len(lines) == 0 {
+		return "No messages in this session."
+	}
+	if len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+	return strings.Join(lines, "\n")
+}
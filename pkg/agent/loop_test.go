@@ -12,9 +12,11 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/commands"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/media"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
@@ -900,3 +902,214 @@ func TestResolveMediaRefs_UsesMetaContentType(t *testing.T) {
 		t.Fatalf("expected jpeg prefix, got %q", result[0].Media[0][:30])
 	}
 }
+
+func TestHandleCommand_SessionLifecycle(t *testing.T) {
+	al, _, _, _, cleanup := newTestAgentLoop(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	msg := func(content string) bus.InboundMessage {
+		return bus.InboundMessage{
+			Channel:  "telegram",
+			SenderID: "user1",
+			ChatID:   "chat1",
+			Content:  content,
+			Peer:     bus.Peer{Kind: "group", ID: "chat1"},
+		}
+	}
+
+	if _, err := al.processMessage(ctx, msg("hello")); err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+
+	agent := al.registry.GetDefaultAgent()
+	_, route, err := al.resolveSession(msg("hello"))
+	if err != nil {
+		t.Fatalf("resolveSession failed: %v", err)
+	}
+	key := route.SessionKey
+	if len(agent.Sessions.GetHistory(key)) == 0 {
+		t.Fatal("expected history for routed session")
+	}
+
+	if resp, _ := al.handleCommand(ctx, msg("/rename trip planning")); !strings.Contains(resp, "trip planning") {
+		t.Errorf("unexpected /rename response: %s", resp)
+	}
+	if resp, _ := al.handleCommand(ctx, msg("/history")); !strings.Contains(resp, "user: hello") {
+		t.Errorf("expected /history to include user message, got: %s", resp)
+	}
+
+	resp, handled := al.handleCommand(ctx, msg("/new"))
+	if !handled || !strings.Contains(resp, "Previous session saved as") {
+		t.Fatalf("unexpected /new response: %s", resp)
+	}
+	if len(agent.Sessions.GetHistory(key)) != 0 {
+		t.Fatal("expected empty session after /new")
+	}
+
+	archived := agent.Sessions.ListArchived(key)
+	if len(archived) != 1 {
+		t.Fatalf("expected one archived session, got %d", len(archived))
+	}
+	if resp, _ := al.handleCommand(ctx, msg("/sessions")); !strings.Contains(resp, "trip planning") {
+		t.Errorf("expected /sessions to list the archived title, got: %s", resp)
+	}
+
+	_, id, _ := session.SplitArchiveKey(archived[0].Key)
+	if resp, _ := al.handleCommand(ctx, msg("/resume "+id)); !strings.Contains(resp, "Resumed session") {
+		t.Fatalf("unexpected /resume response: %s", resp)
+	}
+	if len(agent.Sessions.GetHistory(key)) == 0 {
+		t.Fatal("expected history to be restored after /resume")
+	}
+
+	if resp, _ := al.handleCommand(ctx, msg("/resume nope")); !strings.Contains(resp, "not found") {
+		t.Errorf("unexpected /resume response for unknown id: %s", resp)
+	}
+
+	al.handleCommand(ctx, msg("/reset"))
+	if len(agent.Sessions.GetHistory(key)) != 0 {
+		t.Fatal("expected empty session after /reset")
+	}
+}
+
+func TestHandleCommand_ExportSendsDocument(t *testing.T) {
+	al, _, msgBus, _, cleanup := newTestAgentLoop(t)
+	defer cleanup()
+
+	store := media.NewFileMediaStore()
+	al.SetMediaStore(store)
+
+	ctx := context.Background()
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "u", ChatID: "c", Content: "hello"}
+	if _, err := al.processMessage(ctx, msg); err != nil {
+		t.Fatalf("processMessage failed: %v", err)
+	}
+
+	msg.Content = "/export html"
+	resp, handled := al.handleCommand(ctx, msg)
+	if !handled || !strings.HasPrefix(resp, "Exported session as") {
+		t.Fatalf("unexpected /export response: %s", resp)
+	}
+
+	subCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	out, ok := msgBus.SubscribeOutboundMedia(subCtx)
+	if !ok || len(out.Parts) != 1 {
+		t.Fatalf("expected one outbound media part, got %+v", out)
+	}
+	if out.Parts[0].ContentType != "text/html" || out.Parts[0].Type != "file" {
+		t.Errorf("unexpected media part: %+v", out.Parts[0])
+	}
+	path, err := store.Resolve(out.Parts[0].Ref)
+	if err != nil {
+		t.Fatalf("failed to resolve exported ref: %v", err)
+	}
+	defer os.Remove(path)
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "hello") {
+		t.Errorf("exported file missing conversation: %v", err)
+	}
+}
+
+func TestRedactToolResultAndOutbound(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Tools: config.ToolsConfig{
+			Web: config.WebToolsConfig{
+				Brave: config.BraveConfig{APIKey: "brave-api-key-value"},
+			},
+		},
+		Redaction: config.RedactionConfig{Enabled: true, ToolResults: true},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+
+	got := al.redactToolResult("exec", "BRAVE_API_KEY=brave-api-key-value")
+	if got != "BRAVE_API_KEY=[REDACTED:secret]" {
+		t.Errorf("tool result not redacted: %q", got)
+	}
+
+	reply := "your key is brave-api-key-value"
+	if got := al.redactOutbound(reply); got != reply {
+		t.Errorf("outbound redaction should be off unless enabled, got %q", got)
+	}
+	cfg.Redaction.Outbound = true
+	if got := al.redactOutbound(reply); got != "your key is [REDACTED:secret]" {
+		t.Errorf("outbound reply not redacted: %q", got)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	newCfg := func(supportModel string, redaction bool) *config.Config {
+		return &config.Config{
+			Agents: config.AgentsConfig{
+				Defaults: config.AgentDefaults{
+					Workspace:         tmpDir,
+					Model:             "test-model",
+					MaxTokens:         4096,
+					MaxToolIterations: 10,
+				},
+				List: []config.AgentConfig{
+					{ID: "main", Default: true},
+					{ID: "support", Model: &config.AgentModelConfig{Primary: supportModel}},
+				},
+			},
+			Redaction: config.RedactionConfig{Enabled: redaction, Outbound: redaction},
+		}
+	}
+	al := NewAgentLoop(newCfg("model-a", false), bus.NewMessageBus(), &mockProvider{})
+	al.RegisterTool(&mockCustomTool{})
+	mainAgent, _ := al.registry.GetAgent("main")
+
+	al.ReloadConfig(newCfg("model-b", true), nil)
+
+	if got, _ := al.registry.GetAgent("main"); got != mainAgent {
+		t.Error("unchanged agent should keep its instance")
+	}
+	support, _ := al.registry.GetAgent("support")
+	if support.Model != "model-b" {
+		t.Errorf("support model = %q, want model-b", support.Model)
+	}
+	if _, ok := support.Tools.Get("mock_custom"); !ok {
+		t.Error("rebuilt agent should get tools registered through RegisterTool")
+	}
+	if !al.config().Redaction.Outbound {
+		t.Error("reloaded config should be in effect")
+	}
+}
+
+func TestHandleCommand_CoversCommandCatalog(t *testing.T) {
+	al, _, _, _, cleanup := newTestAgentLoop(t)
+	defer cleanup()
+
+	for _, cmd := range commands.Builtin {
+		values := make(map[string]string)
+		for _, arg := range cmd.Args {
+			if len(arg.Choices) > 0 {
+				values[arg.Name] = arg.Choices[0]
+			} else {
+				values[arg.Name] = "1"
+			}
+		}
+		content := cmd.Format(values)
+		_, handled := al.handleCommand(context.Background(), bus.InboundMessage{
+			Channel:  "discord",
+			SenderID: "user1",
+			ChatID:   "chat1",
+			Content:  content,
+			Peer:     bus.Peer{Kind: "channel", ID: "chat1"},
+		})
+		if !handled {
+			t.Errorf("%q was not handled", content)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"encoding/json"
 	"sync"
 
 	"github.com/sipeed/picoclaw/pkg/config"
@@ -11,9 +12,10 @@ import (
 
 // AgentRegistry manages multiple agent instances and routes messages to them.
 type AgentRegistry struct {
-	agents   map[string]*AgentInstance
-	resolver *routing.RouteResolver
-	mu       sync.RWMutex
+	agents       map[string]*AgentInstance
+	fingerprints map[string]string // agent ID → config the instance was built from
+	resolver     *routing.RouteResolver
+	mu           sync.RWMutex
 }
 
 // NewAgentRegistry creates a registry from config, instantiating all agents.
@@ -22,25 +24,20 @@ func NewAgentRegistry(
 	provider providers.LLMProvider,
 ) *AgentRegistry {
 	registry := &AgentRegistry{
-		agents:   make(map[string]*AgentInstance),
-		resolver: routing.NewRouteResolver(cfg),
+		agents:       make(map[string]*AgentInstance),
+		fingerprints: make(map[string]string),
+		resolver:     routing.NewRouteResolver(cfg),
 	}
 
-	agentConfigs := cfg.Agents.List
-	if len(agentConfigs) == 0 {
-		implicitAgent := &config.AgentConfig{
-			ID:      "main",
-			Default: true,
-		}
-		instance := NewAgentInstance(implicitAgent, &cfg.Agents.Defaults, cfg, provider)
-		registry.agents["main"] = instance
+	if len(cfg.Agents.List) == 0 {
 		logger.InfoCF("agent", "Created implicit main agent (no agents.list configured)", nil)
-	} else {
-		for i := range agentConfigs {
-			ac := &agentConfigs[i]
-			id := routing.NormalizeAgentID(ac.ID)
-			instance := NewAgentInstance(ac, &cfg.Agents.Defaults, cfg, provider)
-			registry.agents[id] = instance
+	}
+	for _, ac := range agentConfigList(cfg) {
+		id := routing.NormalizeAgentID(ac.ID)
+		instance := NewAgentInstance(ac, &cfg.Agents.Defaults, cfg, provider)
+		registry.agents[id] = instance
+		registry.fingerprints[id] = agentFingerprint(ac, cfg)
+		if len(cfg.Agents.List) > 0 {
 			logger.InfoCF("agent", "Registered agent",
 				map[string]any{
 					"agent_id":  id,
@@ -54,6 +51,77 @@ func NewAgentRegistry(
 	return registry
 }
 
+// agentConfigList returns the configured agents, or the implicit main agent
+// when agents.list is empty.
+func agentConfigList(cfg *config.Config) []*config.AgentConfig {
+	if len(cfg.Agents.List) == 0 {
+		return []*config.AgentConfig{{ID: "main", Default: true}}
+	}
+	list := make([]*config.AgentConfig, len(cfg.Agents.List))
+	for i := range cfg.Agents.List {
+		list[i] = &cfg.Agents.List[i]
+	}
+	return list
+}
+
+// agentFingerprint captures every part of the config an AgentInstance is
+// built from, so Reload can tell which instances need rebuilding.
+func agentFingerprint(ac *config.AgentConfig, cfg *config.Config) string {
+	data, _ := json.Marshal([]any{ac, cfg.Agents.Defaults, cfg.Tools, cfg.ModelList})
+	return string(data)
+}
+
+// Reload applies a new config to the registry. Agents whose configuration is
+// unchanged keep their instance (and with it their tools and in-flight
+// state); new or changed agents get a fresh instance, which keeps the old
+// one's session manager when the workspace is unchanged, and removed agents
+// are dropped. With rebuildAll set, for example after the provider changed, every
+// agent is rebuilt. It returns the IDs of the newly built instances.
+func (r *AgentRegistry) Reload(
+	cfg *config.Config,
+	provider providers.LLMProvider,
+	rebuildAll bool,
+) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agents := make(map[string]*AgentInstance)
+	fingerprints := make(map[string]string)
+	var rebuilt []string
+	for _, ac := range agentConfigList(cfg) {
+		id := routing.NormalizeAgentID(ac.ID)
+		fp := agentFingerprint(ac, cfg)
+		if existing, ok := r.agents[id]; ok && !rebuildAll && r.fingerprints[id] == fp {
+			agents[id] = existing
+			fingerprints[id] = fp
+			continue
+		}
+		instance := NewAgentInstance(ac, &cfg.Agents.Defaults, cfg, provider)
+		if existing, ok := r.agents[id]; ok && existing.Workspace == instance.Workspace {
+			// Turns still running on the old instance keep writing to its
+			// session manager; sharing it keeps their history visible to
+			// the new instance instead of being lost on the next save.
+			instance.Sessions = existing.Sessions
+		}
+		agents[id] = instance
+		fingerprints[id] = fp
+		rebuilt = append(rebuilt, id)
+	}
+	for id := range r.agents {
+		if _, ok := agents[id]; !ok {
+			logger.InfoCF("agent", "Removed agent", map[string]any{"agent_id": id})
+		}
+	}
+	if len(rebuilt) > 0 {
+		logger.InfoCF("agent", "Rebuilt agents", map[string]any{"agent_ids": rebuilt})
+	}
+
+	r.agents = agents
+	r.fingerprints = fingerprints
+	r.resolver = routing.NewRouteResolver(cfg)
+	return rebuilt
+}
+
 // GetAgent returns the agent instance for a given ID.
 func (r *AgentRegistry) GetAgent(agentID string) (*AgentInstance, bool) {
 	r.mu.RLock()
@@ -65,7 +133,10 @@ func (r *AgentRegistry) GetAgent(agentID string) (*AgentInstance, bool) {
 
 // ResolveRoute determines which agent handles the message.
 func (r *AgentRegistry) ResolveRoute(input routing.RouteInput) routing.ResolvedRoute {
-	return r.resolver.ResolveRoute(input)
+	r.mu.RLock()
+	resolver := r.resolver
+	r.mu.RUnlock()
+	return resolver.ResolveRoute(input)
 }
 
 // ListAgentIDs returns all registered agent IDs.
@@ -112,3 +183,18 @@ func (r *AgentRegistry) GetDefaultAgent() *AgentInstance {
 	}
 	return nil
 }
+
+// ResolveAgentWorkspaces returns the workspace directory of every configured
+// agent keyed by agent ID, without instantiating the agents themselves.
+func ResolveAgentWorkspaces(cfg *config.Config) map[string]string {
+	workspaces := make(map[string]string)
+	if len(cfg.Agents.List) == 0 {
+		workspaces[routing.DefaultAgentID] = resolveAgentWorkspace(nil, &cfg.Agents.Defaults)
+		return workspaces
+	}
+	for i := range cfg.Agents.List {
+		ac := &cfg.Agents.List[i]
+		workspaces[routing.NormalizeAgentID(ac.ID)] = resolveAgentWorkspace(ac, &cfg.Agents.Defaults)
+	}
+	return workspaces
+}
@@ -203,3 +203,52 @@ func TestAgentInstance_FallbackExplicitEmpty(t *testing.T) {
 		t.Errorf("expected 0 fallbacks (explicit empty), got %d: %v", len(agent.Fallbacks), agent.Fallbacks)
 	}
 }
+
+func TestAgentRegistry_Reload(t *testing.T) {
+	cfg := testCfg([]config.AgentConfig{
+		{ID: "sales", Name: "Sales"},
+		{ID: "support", Name: "Support"},
+	})
+	provider := &mockRegistryProvider{}
+	registry := NewAgentRegistry(cfg, provider)
+	sales, _ := registry.GetAgent("sales")
+	support, _ := registry.GetAgent("support")
+
+	// Change only the support agent and add a new one.
+	next := testCfg([]config.AgentConfig{
+		{ID: "sales", Name: "Sales"},
+		{ID: "support", Name: "Support", Model: &config.AgentModelConfig{Primary: "gpt-4o"}},
+		{ID: "ops", Name: "Ops"},
+	})
+	rebuilt := registry.Reload(next, provider, false)
+
+	if len(rebuilt) != 2 || rebuilt[0] != "support" || rebuilt[1] != "ops" {
+		t.Errorf("rebuilt = %v, want [support ops]", rebuilt)
+	}
+	if got, _ := registry.GetAgent("sales"); got != sales {
+		t.Error("unchanged agent 'sales' should keep its instance")
+	}
+	newSupport, _ := registry.GetAgent("support")
+	if newSupport == support {
+		t.Error("changed agent 'support' should have been rebuilt")
+	}
+	if newSupport.Sessions != support.Sessions {
+		t.Error("rebuilt agent 'support' should share the old session manager")
+	}
+	if _, ok := registry.GetAgent("ops"); !ok {
+		t.Error("new agent 'ops' should be registered")
+	}
+
+	// Dropping an agent removes it; rebuildAll replaces the rest.
+	last := testCfg([]config.AgentConfig{{ID: "sales", Name: "Sales"}})
+	rebuilt = registry.Reload(last, provider, true)
+	if len(rebuilt) != 1 || rebuilt[0] != "sales" {
+		t.Errorf("rebuilt = %v, want [sales]", rebuilt)
+	}
+	if got, _ := registry.GetAgent("sales"); got == sales {
+		t.Error("rebuildAll should replace every instance")
+	}
+	if _, ok := registry.GetAgent("support"); ok {
+		t.Error("removed agent 'support' should be gone")
+	}
+}
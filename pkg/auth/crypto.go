@@ -0,0 +1,392 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+)
+
+const (
+	// PassphraseEnv supplies the passphrase for a passphrase-encrypted store.
+	// Setting it while the store is still plaintext encrypts it on next load.
+	PassphraseEnv = "PICOCLAW_AUTH_PASSPHRASE"
+	// KeyFileEnv points at a key file. Setting it while the store is still
+	// plaintext encrypts it with that key on next load.
+	KeyFileEnv = "PICOCLAW_AUTH_KEY_FILE"
+
+	KDFArgon2id = "argon2id"
+	KDFKeyFile  = "keyfile"
+
+	encryptedVersion = 1
+	cipherName       = "chacha20-poly1305"
+	saltSize         = 16
+)
+
+// ErrStoreLocked is returned when the auth store is encrypted and no key is
+// available to decrypt it.
+var ErrStoreLocked = errors.New("auth store is encrypted: set " + PassphraseEnv + " or provide the key file")
+
+// Argon2id parameters sized for small boards: about 19 MiB of memory, as
+// recommended by OWASP for interactive logins.
+var defaultArgon2 = argon2Params{Time: 2, Memory: 19 * 1024, Threads: 1}
+
+type argon2Params struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// encryptedFile is the on-disk form of an encrypted auth store. Byte slices
+// are base64-encoded by encoding/json.
+type encryptedFile struct {
+	Version    int           `json:"version"`
+	Cipher     string        `json:"cipher"`
+	KDF        string        `json:"kdf"`
+	Argon2     *argon2Params `json:"argon2,omitempty"`
+	Salt       []byte        `json:"salt,omitempty"`
+	KeyFile    string        `json:"key_file,omitempty"`
+	Nonce      []byte        `json:"nonce"`
+	Ciphertext []byte        `json:"ciphertext"`
+}
+
+// KeySource describes how the store key is obtained: either a passphrase,
+// run through Argon2id, or a file holding a random 256-bit key.
+type KeySource struct {
+	Passphrase string
+	KeyFile    string
+}
+
+func (s KeySource) kdf() string {
+	if s.KeyFile != "" {
+		return KDFKeyFile
+	}
+	return KDFArgon2id
+}
+
+var (
+	keyMu      sync.Mutex
+	passphrase string
+	// derived caches the last Argon2id result so that loading and saving the
+	// store repeatedly does not pay for key derivation every time.
+	derived struct {
+		passphrase string
+		salt       []byte
+		params     argon2Params
+		key        []byte
+	}
+)
+
+// SetPassphrase sets the passphrase used for the auth store in this process,
+// taking precedence over PICOCLAW_AUTH_PASSPHRASE.
+func SetPassphrase(p string) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	passphrase = p
+}
+
+func currentPassphrase() string {
+	keyMu.Lock()
+	p := passphrase
+	keyMu.Unlock()
+	if p != "" {
+		return p
+	}
+	return os.Getenv(PassphraseEnv)
+}
+
+// DefaultKeyFilePath returns the key file used when none is specified.
+func DefaultKeyFilePath() string {
+	return filepath.Join(filepath.Dir(authFilePath()), "auth.key")
+}
+
+// GenerateKeyFile writes a new random key to path. It refuses to overwrite
+// an existing file so that a key still in use is never lost.
+func GenerateKeyFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("key file %s already exists", path)
+	}
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	data := []byte(base64.StdEncoding.EncodeToString(key) + "\n")
+	return fileutil.WriteFileAtomic(path, data, 0o600)
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("key file %s does not contain a valid %d-byte key", path, chacha20poly1305.KeySize)
+	}
+	return key, nil
+}
+
+func deriveKey(pass string, salt []byte, params argon2Params) []byte {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	if derived.key != nil && derived.passphrase == pass && derived.params == params &&
+		bytes.Equal(derived.salt, salt) {
+		return derived.key
+	}
+	key := argon2.IDKey([]byte(pass), salt, params.Time, params.Memory, params.Threads, chacha20poly1305.KeySize)
+	derived.passphrase = pass
+	derived.salt = salt
+	derived.params = params
+	derived.key = key
+	return key
+}
+
+// cachedSalt returns the salt of the cached derivation for pass, so repeated
+// saves with the same passphrase can skip Argon2id.
+func cachedSalt(pass string) []byte {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	if derived.key != nil && derived.passphrase == pass && derived.params == defaultArgon2 {
+		return derived.salt
+	}
+	return nil
+}
+
+// isEncrypted reports whether data is an encrypted store rather than the
+// plaintext JSON layout.
+func isEncrypted(data []byte) bool {
+	var probe struct {
+		Ciphertext json.RawMessage `json:"ciphertext"`
+	}
+	return json.Unmarshal(data, &probe) == nil && len(probe.Ciphertext) > 0
+}
+
+func encryptStore(plaintext []byte, src KeySource) ([]byte, error) {
+	ef := encryptedFile{
+		Version: encryptedVersion,
+		Cipher:  cipherName,
+		KDF:     src.kdf(),
+	}
+
+	var key []byte
+	switch ef.KDF {
+	case KDFKeyFile:
+		k, err := readKeyFile(src.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+		ef.KeyFile = src.KeyFile
+	default:
+		if src.Passphrase == "" {
+			return nil, errors.New("empty passphrase")
+		}
+		salt := cachedSalt(src.Passphrase)
+		if salt == nil {
+			salt = make([]byte, saltSize)
+			if _, err := rand.Read(salt); err != nil {
+				return nil, err
+			}
+		}
+		params := defaultArgon2
+		ef.Argon2 = &params
+		ef.Salt = salt
+		key = deriveKey(src.Passphrase, salt, params)
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	ef.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(ef.Nonce); err != nil {
+		return nil, err
+	}
+	ef.Ciphertext = aead.Seal(nil, ef.Nonce, plaintext, associatedData(ef))
+	return json.MarshalIndent(ef, "", "  ")
+}
+
+func decryptStore(data []byte, src KeySource) ([]byte, error) {
+	var ef encryptedFile
+	if err := json.Unmarshal(data, &ef); err != nil {
+		return nil, err
+	}
+	if ef.Version != encryptedVersion || ef.Cipher != cipherName {
+		return nil, fmt.Errorf("unsupported auth store encryption (version %d, cipher %q)", ef.Version, ef.Cipher)
+	}
+
+	var key []byte
+	switch ef.KDF {
+	case KDFKeyFile:
+		path := src.KeyFile
+		if path == "" {
+			path = ef.KeyFile
+		}
+		k, err := readKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	case KDFArgon2id:
+		if src.Passphrase == "" {
+			return nil, ErrStoreLocked
+		}
+		if ef.Argon2 == nil {
+			return nil, errors.New("auth store is missing key derivation parameters")
+		}
+		key = deriveKey(src.Passphrase, ef.Salt, *ef.Argon2)
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %q", ef.KDF)
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ef.Nonce) != aead.NonceSize() {
+		return nil, errors.New("auth store has an invalid nonce")
+	}
+	plaintext, err := aead.Open(nil, ef.Nonce, ef.Ciphertext, associatedData(ef))
+	if err != nil {
+		return nil, errors.New("failed to decrypt auth store: wrong passphrase or key")
+	}
+	return plaintext, nil
+}
+
+// associatedData binds the header fields to the ciphertext so that they
+// cannot be altered without failing authentication.
+func associatedData(ef encryptedFile) []byte {
+	return fmt.Appendf(nil, "picoclaw-auth:v%d:%s:%s", ef.Version, ef.Cipher, ef.KDF)
+}
+
+// readKeySource returns the key source recorded in an encrypted store file,
+// filled in from the process passphrase and environment.
+func readKeySource(data []byte) (KeySource, error) {
+	var ef encryptedFile
+	if err := json.Unmarshal(data, &ef); err != nil {
+		return KeySource{}, err
+	}
+	if ef.KDF == KDFKeyFile {
+		path := os.Getenv(KeyFileEnv)
+		if path == "" {
+			path = ef.KeyFile
+		}
+		if path == "" {
+			path = DefaultKeyFilePath()
+		}
+		return KeySource{KeyFile: path}, nil
+	}
+	return KeySource{Passphrase: currentPassphrase()}, nil
+}
+
+// envKeySource returns the key source requested through the environment for
+// a store that is not encrypted yet, or nil if encryption is not configured.
+func envKeySource() *KeySource {
+	if path := os.Getenv(KeyFileEnv); path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return &KeySource{KeyFile: path}
+		}
+	}
+	if p := currentPassphrase(); p != "" {
+		return &KeySource{Passphrase: p}
+	}
+	return nil
+}
+
+// IsStoreEncrypted reports whether the auth store on disk is encrypted.
+func IsStoreEncrypted() (bool, error) {
+	data, err := os.ReadFile(authFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return isEncrypted(data), nil
+}
+
+// Lock encrypts the auth store with src. An already encrypted store is
+// re-encrypted, which requires its current key to be available.
+func Lock(src KeySource) error {
+	store, err := LoadStore()
+	if err != nil {
+		return err
+	}
+	return saveStore(store, &src)
+}
+
+// Unlock decrypts the auth store and writes it back as plaintext JSON.
+func Unlock() error {
+	store, err := LoadStore()
+	if err != nil {
+		return err
+	}
+	return saveStore(store, nil)
+}
+
+// RotateKey decrypts the auth store with its current key and re-encrypts it
+// with next.
+func RotateKey(next KeySource) error {
+	encrypted, err := IsStoreEncrypted()
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		return errors.New("auth store is not encrypted; use lock first")
+	}
+	return Lock(next)
+}
+
+// RotateKeyFile replaces the key in the key file at path with a freshly
+// generated one and re-encrypts the store with it. The new key is written
+// next to the old one first, so the store is never left without a usable key.
+func RotateKeyFile(path string) error {
+	encrypted, err := IsStoreEncrypted()
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		return errors.New("auth store is not encrypted; use lock first")
+	}
+	store, err := LoadStore()
+	if err != nil {
+		return err
+	}
+
+	next := path + ".new"
+	os.Remove(next)
+	if err := GenerateKeyFile(next); err != nil {
+		return err
+	}
+	if err := saveStore(store, &KeySource{KeyFile: next}); err != nil {
+		os.Remove(next)
+		return err
+	}
+	if err := os.Rename(next, path); err != nil {
+		return err
+	}
+	return saveStore(store, &KeySource{KeyFile: path})
+}
+
+// CurrentKeySource returns the key source of the encrypted store on disk.
+func CurrentKeySource() (KeySource, error) {
+	data, err := os.ReadFile(authFilePath())
+	if err != nil {
+		return KeySource{}, err
+	}
+	if !isEncrypted(data) {
+		return KeySource{}, errors.New("auth store is not encrypted")
+	}
+	return readKeySource(data)
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupAuthHome(t *testing.T) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv(PassphraseEnv, "")
+	t.Setenv(KeyFileEnv, "")
+	SetPassphrase("")
+	t.Cleanup(func() { SetPassphrase("") })
+	return filepath.Join(tmpDir, ".picoclaw", "auth.json")
+}
+
+func assertEncryptedFile(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error: %v", err)
+	}
+	if !isEncrypted(data) {
+		t.Fatalf("auth store is not encrypted:\n%s", data)
+	}
+	if strings.Contains(string(data), "secret-access-token") {
+		t.Fatal("encrypted auth store contains the plaintext token")
+	}
+}
+
+func TestLockWithPassphrase(t *testing.T) {
+	path := setupAuthHome(t)
+	cred := &AuthCredential{AccessToken: "secret-access-token", Provider: "openai", AuthMethod: "oauth"}
+	if err := SetCredential("openai", cred); err != nil {
+		t.Fatalf("SetCredential() error: %v", err)
+	}
+
+	if err := Lock(KeySource{Passphrase: "correct horse"}); err != nil {
+		t.Fatalf("Lock() error: %v", err)
+	}
+	assertEncryptedFile(t, path)
+
+	// Without the passphrase the store cannot be read.
+	if _, err := LoadStore(); !errors.Is(err, ErrStoreLocked) {
+		t.Fatalf("LoadStore() error = %v, want ErrStoreLocked", err)
+	}
+
+	t.Setenv(PassphraseEnv, "wrong")
+	if _, err := LoadStore(); err == nil {
+		t.Fatal("LoadStore() with a wrong passphrase should fail")
+	}
+
+	t.Setenv(PassphraseEnv, "correct horse")
+	loaded, err := GetCredential("openai")
+	if err != nil {
+		t.Fatalf("GetCredential() error: %v", err)
+	}
+	if loaded.AccessToken != "secret-access-token" {
+		t.Errorf("AccessToken = %q", loaded.AccessToken)
+	}
+
+	// Saving keeps the store encrypted.
+	if err := SetCredential("anthropic", &AuthCredential{AccessToken: "secret-access-token-2"}); err != nil {
+		t.Fatalf("SetCredential() error: %v", err)
+	}
+	assertEncryptedFile(t, path)
+
+	if err := Unlock(); err != nil {
+		t.Fatalf("Unlock() error: %v", err)
+	}
+	if encrypted, _ := IsStoreEncrypted(); encrypted {
+		t.Error("store should be plaintext after Unlock()")
+	}
+}
+
+func TestLoadStore_MigratesPlaintext(t *testing.T) {
+	path := setupAuthHome(t)
+	if err := SetCredential("openai", &AuthCredential{AccessToken: "secret-access-token"}); err != nil {
+		t.Fatalf("SetCredential() error: %v", err)
+	}
+	if encrypted, _ := IsStoreEncrypted(); encrypted {
+		t.Fatal("store should start as plaintext")
+	}
+
+	keyFile := filepath.Join(filepath.Dir(path), "auth.key")
+	if err := GenerateKeyFile(keyFile); err != nil {
+		t.Fatalf("GenerateKeyFile() error: %v", err)
+	}
+	t.Setenv(KeyFileEnv, keyFile)
+
+	store, err := LoadStore()
+	if err != nil {
+		t.Fatalf("LoadStore() error: %v", err)
+	}
+	if store.Credentials["openai"].AccessToken != "secret-access-token" {
+		t.Error("credentials lost during migration")
+	}
+	assertEncryptedFile(t, path)
+}
+
+func TestRotateKeyFile(t *testing.T) {
+	path := setupAuthHome(t)
+	if err := SetCredential("openai", &AuthCredential{AccessToken: "secret-access-token"}); err != nil {
+		t.Fatalf("SetCredential() error: %v", err)
+	}
+	keyFile := filepath.Join(filepath.Dir(path), "auth.key")
+	if err := GenerateKeyFile(keyFile); err != nil {
+		t.Fatalf("GenerateKeyFile() error: %v", err)
+	}
+	if err := GenerateKeyFile(keyFile); err == nil {
+		t.Error("GenerateKeyFile() should refuse to overwrite an existing key")
+	}
+	if err := Lock(KeySource{KeyFile: keyFile}); err != nil {
+		t.Fatalf("Lock() error: %v", err)
+	}
+	oldKey, _ := os.ReadFile(keyFile)
+
+	if err := RotateKeyFile(keyFile); err != nil {
+		t.Fatalf("RotateKeyFile() error: %v", err)
+	}
+	newKey, _ := os.ReadFile(keyFile)
+	if string(oldKey) == string(newKey) {
+		t.Error("key file was not replaced")
+	}
+	if _, err := os.Stat(keyFile + ".new"); !os.IsNotExist(err) {
+		t.Error("temporary key file left behind")
+	}
+
+	cred, err := GetCredential("openai")
+	if err != nil || cred.AccessToken != "secret-access-token" {
+		t.Fatalf("GetCredential() after rotation = %v, %v", cred, err)
+	}
+	assertEncryptedFile(t, path)
+}
+
+func TestRotateKey_RequiresEncryptedStore(t *testing.T) {
+	setupAuthHome(t)
+	if err := RotateKey(KeySource{Passphrase: "next"}); err == nil {
+		t.Error("RotateKey() on a plaintext store should fail")
+	}
+}
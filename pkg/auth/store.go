@@ -2,6 +2,7 @@ package auth
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
@@ -43,6 +44,9 @@ func authFilePath() string {
 	return filepath.Join(home, ".picoclaw", "auth.json")
 }
 
+// LoadStore reads the auth store, decrypting it if necessary. A plaintext
+// store is transparently encrypted when PICOCLAW_AUTH_PASSPHRASE or
+// PICOCLAW_AUTH_KEY_FILE is set.
 func LoadStore() (*AuthStore, error) {
 	path := authFilePath()
 	data, err := os.ReadFile(path)
@@ -53,6 +57,19 @@ func LoadStore() (*AuthStore, error) {
 		return nil, err
 	}
 
+	var migrateTo *KeySource
+	if isEncrypted(data) {
+		src, err := readKeySource(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = decryptStore(data, src); err != nil {
+			return nil, err
+		}
+	} else {
+		migrateTo = envKeySource()
+	}
+
 	var store AuthStore
 	if err := json.Unmarshal(data, &store); err != nil {
 		return nil, err
@@ -60,15 +77,47 @@ func LoadStore() (*AuthStore, error) {
 	if store.Credentials == nil {
 		store.Credentials = make(map[string]*AuthCredential)
 	}
+
+	if migrateTo != nil {
+		if err := saveStore(&store, migrateTo); err != nil {
+			return nil, fmt.Errorf("encrypting auth store: %w", err)
+		}
+	}
 	return &store, nil
 }
 
+// SaveStore writes the auth store. It stays encrypted with the same kind of
+// key if it already was, and is encrypted for the first time if a key is
+// configured through the environment.
 func SaveStore(store *AuthStore) error {
+	var src *KeySource
+	if data, err := os.ReadFile(authFilePath()); err == nil && isEncrypted(data) {
+		s, err := readKeySource(data)
+		if err != nil {
+			return err
+		}
+		if s.KeyFile == "" && s.Passphrase == "" {
+			return ErrStoreLocked
+		}
+		src = &s
+	} else {
+		src = envKeySource()
+	}
+	return saveStore(store, src)
+}
+
+// saveStore writes store, encrypted with src, or as plaintext if src is nil.
+func saveStore(store *AuthStore, src *KeySource) error {
 	path := authFilePath()
 	data, err := json.MarshalIndent(store, "", "  ")
 	if err != nil {
 		return err
 	}
+	if src != nil {
+		if data, err = encryptStore(data, *src); err != nil {
+			return err
+		}
+	}
 
 	// Use unified atomic write utility with explicit sync for flash storage reliability.
 	return fileutil.WriteFileAtomic(path, data, 0o600)
@@ -0,0 +1,37 @@
+// Package bustest provides helpers for tests that read the messages a
+// channel publishes to the bus.
+package bustest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// Timeout is how long Consume waits for a message.
+const Timeout = 5 * time.Second
+
+// Consume returns the next inbound message, failing the test if none
+// arrives within Timeout.
+func Consume(t testing.TB, mb *bus.MessageBus) bus.InboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	return msg
+}
+
+// NoInbound fails the test if an inbound message arrives within wait.
+func NoInbound(t testing.TB, mb *bus.MessageBus, wait time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	if msg, ok := mb.ConsumeInbound(ctx); ok {
+		t.Fatalf("unexpected inbound message: %+v", msg)
+	}
+}
@@ -30,9 +30,27 @@ type InboundMessage struct {
 }
 
 type OutboundMessage struct {
-	Channel string `json:"channel"`
-	ChatID  string `json:"chat_id"`
-	Content string `json:"content"`
+	Channel string     `json:"channel"`
+	ChatID  string     `json:"chat_id"`
+	Content string     `json:"content"`
+	Buttons [][]Button `json:"buttons,omitempty"`  // rows of choices shown under the message
+	ReplyTo string     `json:"reply_to,omitempty"` // MessageID of the inbound message this is the final answer to
+}
+
+// Button is a choice offered with an outbound message. Channels that render
+// buttons deliver a tap as an inbound message whose content is Data, or Text
+// when Data is empty; other channels list the choices in the message text.
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"data,omitempty"`
+}
+
+// Value returns what a tap on the button sends back.
+func (b Button) Value() string {
+	if b.Data != "" {
+		return b.Data
+	}
+	return b.Text
 }
 
 // MediaPart describes a single media attachment to send.
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/identity"
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -61,6 +62,13 @@ func WithMaxMessageLength(n int) BaseChannelOption {
 	return func(c *BaseChannel) { c.maxMessageLength = n }
 }
 
+// WithTextFormat sets the markup the channel sends. The Manager renders the
+// agent's Markdown into it and splits the rendered text, so Send receives
+// text ready for the platform.
+func WithTextFormat(d format.Dialect) BaseChannelOption {
+	return func(c *BaseChannel) { c.textFormat = d }
+}
+
 // WithGroupTrigger sets the group trigger configuration for a channel.
 func WithGroupTrigger(gt config.GroupTriggerConfig) BaseChannelOption {
 	return func(c *BaseChannel) { c.groupTrigger = gt }
@@ -78,6 +86,20 @@ type MessageLengthProvider interface {
 	MaxMessageLength() int
 }
 
+// TextFormatProvider is an opt-in interface for channels that want outbound
+// Markdown rendered into their platform's markup. An empty dialect leaves
+// the content untouched.
+type TextFormatProvider interface {
+	TextFormat() format.Dialect
+}
+
+// SendRateProvider is an opt-in interface for channels whose platform
+// enforces its own flood control. The Manager uses it instead of
+// channelRateConfig when creating the channel's rate limiter.
+type SendRateProvider interface {
+	SendRate() (perSecond float64, burst int)
+}
+
 type BaseChannel struct {
 	config              any
 	bus                 *bus.MessageBus
@@ -85,6 +107,7 @@ type BaseChannel struct {
 	name                string
 	allowList           []string
 	maxMessageLength    int
+	textFormat          format.Dialect
 	groupTrigger        config.GroupTriggerConfig
 	mediaStore          media.MediaStore
 	placeholderRecorder PlaceholderRecorder
@@ -117,6 +140,12 @@ func (c *BaseChannel) MaxMessageLength() int {
 	return c.maxMessageLength
 }
 
+// TextFormat returns the markup this channel sends, or "" to send the
+// agent's Markdown as is.
+func (c *BaseChannel) TextFormat() format.Dialect {
+	return c.textFormat
+}
+
 // ShouldRespondInGroup determines whether the bot should respond in a group chat.
 // Each channel is responsible for:
 //  1. Detecting isMentioned (platform-specific)
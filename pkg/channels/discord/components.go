@@ -0,0 +1,138 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+// Discord component limits.
+const (
+	maxActionRows    = 5
+	maxRowButtons    = 5
+	maxSelectOptions = 25
+	maxButtonLabel   = 80
+	maxOptionText    = 100
+	maxCustomID      = 100
+)
+
+// customIDPrefix marks components created by this channel. The rest of the
+// custom ID is "<row>:<col>:<value>", keeping IDs unique within a message.
+const customIDPrefix = "pc:"
+
+// buildComponents renders button rows as Discord action rows. Rows with more
+// buttons than fit in one action row become a select menu instead.
+func buildComponents(buttons [][]bus.Button) []discordgo.MessageComponent {
+	components := []discordgo.MessageComponent{}
+	for i, row := range buttons {
+		if len(row) == 0 {
+			continue
+		}
+		if len(components) == maxActionRows {
+			break
+		}
+
+		if len(row) <= maxRowButtons {
+			actions := discordgo.ActionsRow{}
+			for j, b := range row {
+				actions.Components = append(actions.Components, discordgo.Button{
+					Label:    truncateRunes(b.Text, maxButtonLabel),
+					Style:    discordgo.SecondaryButton,
+					CustomID: buttonCustomID(i, j, b.Value()),
+				})
+			}
+			components = append(components, actions)
+			continue
+		}
+
+		menu := discordgo.SelectMenu{
+			MenuType:    discordgo.StringSelectMenu,
+			CustomID:    buttonCustomID(i, 0, ""),
+			Placeholder: "Choose an option",
+		}
+		for _, b := range row[:min(len(row), maxSelectOptions)] {
+			menu.Options = append(menu.Options, discordgo.SelectMenuOption{
+				Label: truncateRunes(b.Text, maxOptionText),
+				Value: truncateRunes(b.Value(), maxOptionText),
+			})
+		}
+		components = append(components, discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{menu},
+		})
+	}
+	return components
+}
+
+func buttonCustomID(row, col int, value string) string {
+	return truncateRunes(fmt.Sprintf("%s%d:%d:%s", customIDPrefix, row, col, value), maxCustomID)
+}
+
+// componentValue returns the value a component interaction selected, or
+// false for components this channel did not create.
+func componentValue(data discordgo.MessageComponentInteractionData) (string, bool) {
+	if !strings.HasPrefix(data.CustomID, customIDPrefix) {
+		return "", false
+	}
+	if len(data.Values) > 0 {
+		return data.Values[0], true
+	}
+	parts := strings.SplitN(strings.TrimPrefix(data.CustomID, customIDPrefix), ":", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return "", false
+	}
+	return parts[2], true
+}
+
+// EditMessageButtons implements channels.ButtonCapable.
+func (c *DiscordChannel) EditMessageButtons(
+	ctx context.Context,
+	chatID, messageID, content string,
+	buttons [][]bus.Button,
+) error {
+	components := buildComponents(buttons)
+	_, err := c.session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         messageID,
+		Channel:    chatID,
+		Content:    &content,
+		Components: &components,
+	})
+	return err
+}
+
+// sendComplex sends content with components attached.
+func (c *DiscordChannel) sendComplex(ctx context.Context, channelID, content string, buttons [][]bus.Button) error {
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content:    content,
+			Components: buildComponents(buttons),
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("discord send: %w", channels.ErrTemporary)
+		}
+		return nil
+	case <-sendCtx.Done():
+		return sendCtx.Err()
+	}
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
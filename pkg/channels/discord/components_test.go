@@ -0,0 +1,105 @@
+package discord
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestBuildComponents(t *testing.T) {
+	many := make([]bus.Button, 7)
+	for i := range many {
+		many[i] = bus.Button{Text: string(rune('a' + i))}
+	}
+	components := buildComponents([][]bus.Button{
+		{{Text: "Yes", Data: "yes"}, {Text: "No"}},
+		{},
+		many,
+	})
+	if len(components) != 2 {
+		t.Fatalf("got %d rows, want 2", len(components))
+	}
+
+	row := components[0].(discordgo.ActionsRow)
+	yes := row.Components[0].(discordgo.Button)
+	no := row.Components[1].(discordgo.Button)
+	if yes.Label != "Yes" || no.Label != "No" || yes.CustomID == no.CustomID {
+		t.Fatalf("unexpected buttons: %+v %+v", yes, no)
+	}
+	if v, ok := componentValue(discordgo.MessageComponentInteractionData{CustomID: yes.CustomID}); !ok || v != "yes" {
+		t.Fatalf("componentValue(yes) = %q, %v", v, ok)
+	}
+	if v, ok := componentValue(discordgo.MessageComponentInteractionData{CustomID: no.CustomID}); !ok || v != "No" {
+		t.Fatalf("componentValue(no) = %q, %v", v, ok)
+	}
+
+	menu := components[1].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if len(menu.Options) != len(many) {
+		t.Fatalf("got %d options, want %d", len(menu.Options), len(many))
+	}
+	v, ok := componentValue(discordgo.MessageComponentInteractionData{
+		CustomID: menu.CustomID,
+		Values:   []string{menu.Options[3].Value},
+	})
+	if !ok || v != "d" {
+		t.Fatalf("componentValue(menu) = %q, %v", v, ok)
+	}
+
+	if _, ok := componentValue(discordgo.MessageComponentInteractionData{CustomID: "other"}); ok {
+		t.Fatal("foreign component should be ignored")
+	}
+}
+
+func TestThreadName(t *testing.T) {
+	if got := threadName("  ", "alice"); got != "Conversation with alice" {
+		t.Fatalf("threadName(blank) = %q", got)
+	}
+	got := threadName(strings.Repeat("word ", 20), "alice")
+	if n := len([]rune(got)); n != maxThreadName || !strings.HasSuffix(got, "…") {
+		t.Fatalf("threadName(long) = %q (%d runes)", got, n)
+	}
+}
+
+func TestSlashCommand(t *testing.T) {
+	sw, _ := commands.Find("switch")
+	ac := slashCommand(sw)
+	if ac.Name != "switch" || len(ac.Options) != 2 {
+		t.Fatalf("unexpected command: %+v", ac)
+	}
+	if len(ac.Options[0].Choices) != 2 || ac.Options[0].Autocomplete {
+		t.Fatalf("unexpected target option: %+v", ac.Options[0])
+	}
+	if !ac.Options[1].Autocomplete || !ac.Options[1].Required {
+		t.Fatalf("unexpected value option: %+v", ac.Options[1])
+	}
+}
+
+func TestModelChoices(t *testing.T) {
+	cfg := &config.Config{
+		ModelList: []config.ModelConfig{{ModelName: "gpt-4o"}, {ModelName: "gpt-4o"}, {ModelName: "claude"}},
+	}
+	cfg.Agents.List = []config.AgentConfig{
+		{ID: "coder", Model: &config.AgentModelConfig{Primary: "claude"}},
+		{ID: "plain"},
+	}
+
+	got := modelChoices(cfg)
+	want := []modelChoice{
+		{label: "gpt-4o", value: "gpt-4o"},
+		{label: "claude", value: "claude"},
+		{label: "claude (agent coder)", value: "claude"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("choice %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/identity"
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -35,6 +36,10 @@ type DiscordChannel struct {
 	typingMu   sync.Mutex
 	typingStop map[string]chan struct{} // chatID → stop signal
 	botUserID  string                   // stored for mention checking
+	models     []modelChoice            // autocomplete suggestions for model arguments
+
+	interactionsMu sync.Mutex
+	interactions   map[string]pendingInteraction // interaction ID → deferred slash command
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -48,16 +53,18 @@ func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordC
 	}
 	base := channels.NewBaseChannel("discord", cfg, bus, cfg.AllowFrom,
 		channels.WithMaxMessageLength(2000),
+		channels.WithTextFormat(format.Discord),
 		channels.WithGroupTrigger(cfg.GroupTrigger),
 		channels.WithReasoningChannelID(cfg.ReasoningChannelID),
 	)
 
 	return &DiscordChannel{
-		BaseChannel: base,
-		session:     session,
-		config:      cfg,
-		ctx:         context.Background(),
-		typingStop:  make(map[string]chan struct{}),
+		BaseChannel:  base,
+		session:      session,
+		config:       cfg,
+		ctx:          context.Background(),
+		typingStop:   make(map[string]chan struct{}),
+		interactions: make(map[string]pendingInteraction),
 	}, nil
 }
 
@@ -74,11 +81,16 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 	c.botUserID = botUser.ID
 
 	c.session.AddHandler(c.handleMessage)
+	c.session.AddHandler(c.handleInteraction)
 
 	if err := c.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
 	}
 
+	if c.config.SlashCommands {
+		c.registerCommands()
+	}
+
 	c.SetRunning(true)
 
 	logger.InfoCF("discord", "Discord bot connected", map[string]any{
@@ -127,6 +139,22 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 		return nil
 	}
 
+	// A slash command's answer fills in its deferred response. The
+	// interaction ID is the inbound message ID the answer replies to.
+	if i, ok := c.takeInteraction(msg.ReplyTo); ok {
+		err := c.respondInteraction(i, msg.Content, msg.Buttons)
+		if err == nil {
+			return nil
+		}
+		logger.WarnCF("discord", "Failed to answer slash command, sending instead", map[string]any{
+			"chat_id": channelID,
+			"error":   err.Error(),
+		})
+	}
+
+	if len(msg.Buttons) > 0 {
+		return c.sendComplex(ctx, channelID, msg.Content, msg.Buttons)
+	}
 	return c.sendChunk(ctx, channelID, msg.Content)
 }
 
@@ -227,15 +255,15 @@ func (c *DiscordChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMes
 
 // EditMessage implements channels.MessageEditor.
 func (c *DiscordChannel) EditMessage(ctx context.Context, chatID string, messageID string, content string) error {
-	_, err := c.session.ChannelMessageEdit(chatID, messageID, content)
-	return err
+	return c.EditMessageButtons(ctx, chatID, messageID, content, nil)
 }
 
 // SendPlaceholder implements channels.PlaceholderCapable.
 // It sends a placeholder message that will later be edited to the actual
 // response via EditMessage (channels.MessageEditor).
 func (c *DiscordChannel) SendPlaceholder(ctx context.Context, chatID string) (string, error) {
-	if !c.config.Placeholder.Enabled {
+	// The deferred slash command response already shows progress.
+	if !c.config.Placeholder.Enabled || c.hasInteraction(chatID) {
 		return "", nil
 	}
 
@@ -292,19 +320,7 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 	}
 
 	// Check allowlist first to avoid downloading attachments for rejected users
-	sender := bus.SenderInfo{
-		Platform:    "discord",
-		PlatformID:  m.Author.ID,
-		CanonicalID: identity.BuildCanonicalID("discord", m.Author.ID),
-		Username:    m.Author.Username,
-	}
-	// Build display name
-	displayName := m.Author.Username
-	if m.Author.Discriminator != "" && m.Author.Discriminator != "0" {
-		displayName += "#" + m.Author.Discriminator
-	}
-	sender.DisplayName = displayName
-
+	sender := senderInfo(m.Author)
 	if !c.IsAllowedSender(sender) {
 		logger.DebugCF("discord", "Message rejected by allowlist", map[string]any{
 			"user_id": m.Author.ID,
@@ -316,8 +332,11 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 
 	// In guild (group) channels, apply unified group trigger filtering
 	// DMs (GuildID is empty) always get a response
+	var thread *discordgo.Channel
 	if m.GuildID != "" {
-		isMentioned := false
+		// Threads the bot opened are its conversations; no mention needed.
+		thread = c.lookupThread(m.ChannelID)
+		isMentioned := thread != nil && thread.OwnerID == c.botUserID
 		for _, mention := range m.Mentions {
 			if mention.ID == c.botUserID {
 				isMentioned = true
@@ -339,6 +358,7 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 	}
 
 	senderID := m.Author.ID
+	text := content
 
 	mediaPaths := make([]string, 0, len(m.Attachments))
 
@@ -394,8 +414,16 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		"preview":     utils.Truncate(content, 50),
 	})
 
+	chatID := m.ChannelID
+	if m.GuildID != "" && thread == nil && c.config.ThreadPerConversation {
+		thread = c.startThread(m.Message, threadName(text, sender.DisplayName))
+	}
+	if thread != nil {
+		chatID = thread.ID
+	}
+
 	peerKind := "channel"
-	peerID := m.ChannelID
+	peerID := chatID
 	if m.GuildID == "" {
 		peerKind = "direct"
 		peerID = senderID
@@ -411,8 +439,25 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		"channel_id":   m.ChannelID,
 		"is_dm":        fmt.Sprintf("%t", m.GuildID == ""),
 	}
+	if thread != nil {
+		setThreadMetadata(metadata, thread)
+	}
 
-	c.HandleMessage(c.ctx, peer, m.ID, senderID, m.ChannelID, content, mediaPaths, metadata, sender)
+	c.HandleMessage(c.ctx, peer, m.ID, senderID, chatID, content, mediaPaths, metadata, sender)
+}
+
+func senderInfo(u *discordgo.User) bus.SenderInfo {
+	displayName := u.Username
+	if u.Discriminator != "" && u.Discriminator != "0" {
+		displayName += "#" + u.Discriminator
+	}
+	return bus.SenderInfo{
+		Platform:    "discord",
+		PlatformID:  u.ID,
+		CanonicalID: identity.BuildCanonicalID("discord", u.ID),
+		Username:    u.Username,
+		DisplayName: displayName,
+	}
 }
 
 // startTyping starts a continuous typing indicator loop for the given chatID.
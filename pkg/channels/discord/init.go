@@ -8,6 +8,11 @@ import (
 
 func init() {
 	channels.RegisterFactory("discord", func(cfg *config.Config, b *bus.MessageBus) (channels.Channel, error) {
-		return NewDiscordChannel(cfg.Channels.Discord, b)
+		ch, err := NewDiscordChannel(cfg.Channels.Discord, b)
+		if err != nil {
+			return nil, err
+		}
+		ch.models = modelChoices(cfg)
+		return ch, nil
 	})
 }
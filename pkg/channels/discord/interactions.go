@@ -0,0 +1,333 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// interactionTTL is how long a deferred slash command response can still be
+// edited; Discord invalidates interaction tokens after 15 minutes.
+const interactionTTL = 14 * time.Minute
+
+const maxAutocompleteChoices = 25
+
+// pendingInteraction is a deferred slash command response waiting for the
+// agent's reply.
+type pendingInteraction struct {
+	interaction *discordgo.Interaction
+	created     time.Time
+}
+
+// modelChoice is an autocomplete suggestion for a model argument.
+type modelChoice struct {
+	label string
+	value string
+}
+
+// modelChoices lists the configured models, followed by the models of
+// individual agents labelled with the agent ID.
+func modelChoices(cfg *config.Config) []modelChoice {
+	var out []modelChoice
+	seen := make(map[string]bool)
+	for _, m := range cfg.ModelList {
+		if m.ModelName == "" || seen[m.ModelName] {
+			continue
+		}
+		seen[m.ModelName] = true
+		out = append(out, modelChoice{label: m.ModelName, value: m.ModelName})
+	}
+	for _, a := range cfg.Agents.List {
+		if a.Model == nil || a.Model.Primary == "" {
+			continue
+		}
+		out = append(out, modelChoice{
+			label: fmt.Sprintf("%s (agent %s)", a.Model.Primary, a.ID),
+			value: a.Model.Primary,
+		})
+	}
+	return out
+}
+
+// slashCommand converts a chat command to a Discord application command.
+func slashCommand(cmd commands.Command) *discordgo.ApplicationCommand {
+	ac := &discordgo.ApplicationCommand{
+		Name:        cmd.Name,
+		Description: cmd.Description,
+	}
+	for _, arg := range cmd.Args {
+		opt := &discordgo.ApplicationCommandOption{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         arg.Name,
+			Description:  arg.Description,
+			Required:     arg.Required,
+			Autocomplete: arg.Complete != "",
+		}
+		for _, choice := range arg.Choices {
+			opt.Choices = append(opt.Choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  choice,
+				Value: choice,
+			})
+		}
+		ac.Options = append(ac.Options, opt)
+	}
+	return ac
+}
+
+// registerCommands replaces the bot's global slash commands with the chat
+// commands the agent understands.
+func (c *DiscordChannel) registerCommands() {
+	cmds := make([]*discordgo.ApplicationCommand, 0, len(commands.Builtin))
+	for _, cmd := range commands.Builtin {
+		cmds = append(cmds, slashCommand(cmd))
+	}
+	if _, err := c.session.ApplicationCommandBulkOverwrite(c.botUserID, "", cmds); err != nil {
+		logger.WarnCF("discord", "Failed to register slash commands", map[string]any{
+			"error": err.Error(),
+		})
+	}
+}
+
+func (c *DiscordChannel) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i == nil || i.Interaction == nil {
+		return
+	}
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		c.handleSlashCommand(i.Interaction)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		c.handleAutocomplete(i.Interaction)
+	case discordgo.InteractionMessageComponent:
+		c.handleComponent(i.Interaction)
+	}
+}
+
+// handleSlashCommand defers the response and passes the command to the agent
+// in its text form. The agent's reply then fills in the deferred response.
+func (c *DiscordChannel) handleSlashCommand(i *discordgo.Interaction) {
+	data := i.ApplicationCommandData()
+	cmd, ok := commands.Find(data.Name)
+	if !ok {
+		return
+	}
+	user, sender, ok := c.interactionSender(i)
+	if !ok {
+		return
+	}
+
+	values := make(map[string]string, len(data.Options))
+	for _, opt := range data.Options {
+		values[opt.Name] = fmt.Sprint(opt.Value)
+	}
+
+	err := c.session.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		logger.ErrorCF("discord", "Failed to defer slash command", map[string]any{
+			"command": cmd.Name,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.interactionsMu.Lock()
+	for id, p := range c.interactions {
+		if time.Since(p.created) > interactionTTL {
+			delete(c.interactions, id)
+		}
+	}
+	c.interactions[i.ID] = pendingInteraction{interaction: i, created: time.Now()}
+	c.interactionsMu.Unlock()
+
+	metadata := c.interactionMetadata(i, user, sender)
+	metadata["interaction"] = "command"
+	c.HandleMessage(c.ctx, c.interactionPeer(i, user, metadata), i.ID, user.ID, i.ChannelID,
+		cmd.Format(values), nil, metadata, sender)
+}
+
+// handleAutocomplete suggests model names for arguments that complete them.
+func (c *DiscordChannel) handleAutocomplete(i *discordgo.Interaction) {
+	data := i.ApplicationCommandData()
+	cmd, ok := commands.Find(data.Name)
+	if !ok {
+		return
+	}
+
+	values := make(map[string]string, len(data.Options))
+	var focused string
+	for _, opt := range data.Options {
+		values[opt.Name] = fmt.Sprint(opt.Value)
+		if opt.Focused {
+			focused = opt.Name
+		}
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, arg := range cmd.Args {
+		// "/switch channel to ..." takes a channel name, not a model.
+		if arg.Name != focused || arg.Complete != commands.CompleteModel || values["target"] == "channel" {
+			continue
+		}
+		query := strings.ToLower(values[arg.Name])
+		for _, m := range c.models {
+			if len(choices) == maxAutocompleteChoices {
+				break
+			}
+			if query != "" && !strings.Contains(strings.ToLower(m.label), query) {
+				continue
+			}
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  truncateRunes(m.label, maxOptionText),
+				Value: truncateRunes(m.value, maxOptionText),
+			})
+		}
+	}
+
+	err := c.session.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		logger.DebugCF("discord", "Failed to answer autocomplete", map[string]any{
+			"error": err.Error(),
+		})
+	}
+}
+
+// handleComponent removes the components from the message that offered them
+// and passes the selected value to the agent as a reply to that message.
+func (c *DiscordChannel) handleComponent(i *discordgo.Interaction) {
+	value, ok := componentValue(i.MessageComponentData())
+	if !ok {
+		return
+	}
+	user, sender, ok := c.interactionSender(i)
+	if !ok {
+		return
+	}
+
+	var content, messageID string
+	if i.Message != nil {
+		content = i.Message.Content
+		messageID = i.Message.ID
+	}
+	err := c.session.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		logger.DebugCF("discord", "Failed to acknowledge component", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	metadata := c.interactionMetadata(i, user, sender)
+	metadata["interaction"] = "component"
+	if messageID != "" {
+		metadata["reply_to"] = messageID
+	}
+	c.HandleMessage(c.ctx, c.interactionPeer(i, user, metadata), i.ID, user.ID, i.ChannelID,
+		value, nil, metadata, sender)
+}
+
+// interactionSender returns the user behind an interaction, refusing it with
+// an ephemeral message if the allowlist rejects them.
+func (c *DiscordChannel) interactionSender(i *discordgo.Interaction) (*discordgo.User, bus.SenderInfo, bool) {
+	user := i.User
+	if i.Member != nil && i.Member.User != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return nil, bus.SenderInfo{}, false
+	}
+
+	sender := senderInfo(user)
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("discord", "Interaction rejected by allowlist", map[string]any{
+			"user_id": user.ID,
+		})
+		_ = c.session.InteractionRespond(i, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "You are not allowed to use this bot.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return nil, bus.SenderInfo{}, false
+	}
+	return user, sender, true
+}
+
+func (c *DiscordChannel) interactionMetadata(i *discordgo.Interaction, user *discordgo.User, sender bus.SenderInfo) map[string]string {
+	return map[string]string{
+		"user_id":      user.ID,
+		"username":     user.Username,
+		"display_name": sender.DisplayName,
+		"guild_id":     i.GuildID,
+		"channel_id":   i.ChannelID,
+		"is_dm":        fmt.Sprintf("%t", i.GuildID == ""),
+	}
+}
+
+func (c *DiscordChannel) interactionPeer(i *discordgo.Interaction, user *discordgo.User, metadata map[string]string) bus.Peer {
+	if i.GuildID == "" {
+		return bus.Peer{Kind: "direct", ID: user.ID}
+	}
+	if thread := c.lookupThread(i.ChannelID); thread != nil {
+		setThreadMetadata(metadata, thread)
+	}
+	return bus.Peer{Kind: "channel", ID: i.ChannelID}
+}
+
+// takeInteraction returns and forgets the deferred slash command response
+// with the given interaction ID, if it can still be edited.
+func (c *DiscordChannel) takeInteraction(id string) (*discordgo.Interaction, bool) {
+	if id == "" {
+		return nil, false
+	}
+	c.interactionsMu.Lock()
+	defer c.interactionsMu.Unlock()
+	p, ok := c.interactions[id]
+	if !ok {
+		return nil, false
+	}
+	delete(c.interactions, id)
+	if time.Since(p.created) > interactionTTL {
+		return nil, false
+	}
+	return p.interaction, true
+}
+
+// hasInteraction reports whether a deferred slash command response is
+// pending in chatID.
+func (c *DiscordChannel) hasInteraction(chatID string) bool {
+	c.interactionsMu.Lock()
+	defer c.interactionsMu.Unlock()
+	for _, p := range c.interactions {
+		if p.interaction.ChannelID == chatID && time.Since(p.created) <= interactionTTL {
+			return true
+		}
+	}
+	return false
+}
+
+// respondInteraction fills in a deferred slash command response.
+func (c *DiscordChannel) respondInteraction(i *discordgo.Interaction, content string, buttons [][]bus.Button) error {
+	components := buildComponents(buttons)
+	_, err := c.session.InteractionResponseEdit(i, &discordgo.WebhookEdit{
+		Content:    &content,
+		Components: &components,
+	})
+	return err
+}
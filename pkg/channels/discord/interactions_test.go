@@ -0,0 +1,43 @@
+package discord
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestTakeInteraction_ByID(t *testing.T) {
+	c := &DiscordChannel{interactions: make(map[string]pendingInteraction)}
+	for _, id := range []string{"i1", "i2"} {
+		c.interactions[id] = pendingInteraction{
+			interaction: &discordgo.Interaction{ID: id, ChannelID: "chan"},
+			created:     time.Now(),
+		}
+	}
+	c.interactions["old"] = pendingInteraction{
+		interaction: &discordgo.Interaction{ID: "old", ChannelID: "stale"},
+		created:     time.Now().Add(-interactionTTL - time.Minute),
+	}
+
+	// Messages that answer no interaction, such as tool output, leave the
+	// pending responses alone.
+	if _, ok := c.takeInteraction(""); ok {
+		t.Fatal("a message without ReplyTo took an interaction")
+	}
+	if i, ok := c.takeInteraction("i2"); !ok || i.ID != "i2" {
+		t.Fatalf("takeInteraction(i2) = %v, %v", i, ok)
+	}
+	if _, ok := c.takeInteraction("i2"); ok {
+		t.Fatal("an interaction was answered twice")
+	}
+	if !c.hasInteraction("chan") {
+		t.Fatal("i1 is still pending in chan")
+	}
+	if c.hasInteraction("stale") {
+		t.Fatal("expired interaction counted as pending")
+	}
+	if _, ok := c.takeInteraction("old"); ok {
+		t.Fatal("expired interaction was returned")
+	}
+}
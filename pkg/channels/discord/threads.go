@@ -0,0 +1,70 @@
+package discord
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	maxThreadName = 50
+
+	// threadArchiveMinutes is how long a conversation thread stays open
+	// without activity.
+	threadArchiveMinutes = 1440
+)
+
+// lookupThread returns the channel with the given ID if it is a thread,
+// preferring the gateway state over a REST call.
+func (c *DiscordChannel) lookupThread(channelID string) *discordgo.Channel {
+	ch, err := c.session.State.Channel(channelID)
+	if err != nil {
+		ch, err = c.session.Channel(channelID)
+		if err != nil {
+			return nil
+		}
+	}
+	if !ch.IsThread() {
+		return nil
+	}
+	return ch
+}
+
+// startThread opens a thread on m for the conversation it starts. It returns
+// nil if the thread cannot be created, so the reply goes to the channel.
+func (c *DiscordChannel) startThread(m *discordgo.Message, name string) *discordgo.Channel {
+	thread, err := c.session.MessageThreadStartComplex(m.ChannelID, m.ID, &discordgo.ThreadStart{
+		Name:                name,
+		AutoArchiveDuration: threadArchiveMinutes,
+	})
+	if err != nil {
+		logger.WarnCF("discord", "Failed to start conversation thread", map[string]any{
+			"channel_id": m.ChannelID,
+			"error":      err.Error(),
+		})
+		return nil
+	}
+	return thread
+}
+
+// setThreadMetadata records the thread and its parent channel, so bindings on
+// the parent channel still route the thread's conversation.
+func setThreadMetadata(metadata map[string]string, thread *discordgo.Channel) {
+	metadata["thread_id"] = thread.ID
+	metadata["parent_peer_kind"] = "channel"
+	metadata["parent_peer_id"] = thread.ParentID
+}
+
+// threadName derives a thread name from the message that starts it.
+func threadName(text, username string) string {
+	name := strings.Join(strings.Fields(text), " ")
+	if name == "" {
+		return "Conversation with " + username
+	}
+	if r := []rune(name); len(r) > maxThreadName {
+		name = string(r[:maxThreadName-1]) + "…"
+	}
+	return name
+}
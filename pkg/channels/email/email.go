@@ -0,0 +1,333 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// EmailChannel implements the Channel interface for a mailbox. Incoming mail
+// is read from one or more IMAP folders (using IDLE where the server supports
+// it) and replies are sent over SMTP. Every email thread, as linked by the
+// Message-ID, In-Reply-To and References headers, is its own chat.
+type EmailChannel struct {
+	*channels.BaseChannel
+	config   config.EmailConfig
+	address  string // the bot's own address, lower-cased
+	threads  *threadStore
+	watching atomic.Int32 // folders with a live IMAP session
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewEmailChannel creates a new email channel instance.
+func NewEmailChannel(cfg config.EmailConfig, messageBus *bus.MessageBus) (*EmailChannel, error) {
+	if cfg.IMAPHost == "" || cfg.SMTPHost == "" {
+		return nil, fmt.Errorf("email imap_host and smtp_host are required")
+	}
+	if cfg.Address == "" {
+		cfg.Address = cfg.Username
+	}
+	if !strings.Contains(cfg.Address, "@") {
+		return nil, fmt.Errorf("email address is required")
+	}
+	if len(cfg.Folders) == 0 {
+		cfg.Folders = config.FlexibleStringSlice{"INBOX"}
+	}
+
+	// Addresses are case-insensitive; senders are matched lower-cased.
+	allowFrom := make([]string, 0, len(cfg.AllowFrom))
+	for _, entry := range cfg.AllowFrom {
+		allowFrom = append(allowFrom, strings.ToLower(strings.TrimSpace(entry)))
+	}
+
+	base := channels.NewBaseChannel("email", cfg, messageBus, allowFrom,
+		channels.WithReasoningChannelID(cfg.ReasoningChannelID),
+	)
+
+	return &EmailChannel{
+		BaseChannel: base,
+		config:      cfg,
+		address:     strings.ToLower(cfg.Address),
+		threads:     newThreadStore(),
+	}, nil
+}
+
+// Start begins watching the configured folders.
+func (c *EmailChannel) Start(ctx context.Context) error {
+	logger.InfoCF("email", "Starting email channel", map[string]any{
+		"address": c.config.Address,
+		"folders": []string(c.config.Folders),
+	})
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	for _, folder := range c.config.Folders {
+		c.wg.Add(1)
+		go c.watchFolder(folder)
+	}
+
+	c.SetRunning(true)
+	logger.InfoC("email", "Email channel started")
+	return nil
+}
+
+// Stop stops watching folders and waits for the IMAP sessions to close.
+func (c *EmailChannel) Stop(ctx context.Context) error {
+	logger.InfoC("email", "Stopping email channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	c.SetRunning(false)
+	logger.InfoC("email", "Email channel stopped")
+	return nil
+}
+
+// Send replies to the thread identified by msg.ChatID.
+func (c *EmailChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+	return c.reply(ctx, msg.ChatID, msg.Content, nil)
+}
+
+// SendMedia implements the channels.MediaSender interface. All parts are sent
+// as attachments of a single reply; their captions make up the body.
+func (c *EmailChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+
+	store := c.GetMediaStore()
+	if store == nil {
+		return fmt.Errorf("no media store available: %w", channels.ErrSendFailed)
+	}
+
+	var captions []string
+	var files []outgoingAttachment
+	for _, part := range msg.Parts {
+		localPath, err := store.Resolve(part.Ref)
+		if err != nil {
+			logger.ErrorCF("email", "Failed to resolve media ref", map[string]any{
+				"ref":   part.Ref,
+				"error": err.Error(),
+			})
+			continue
+		}
+		filename := part.Filename
+		if filename == "" {
+			filename = filepath.Base(localPath)
+		}
+		files = append(files, outgoingAttachment{
+			path:        localPath,
+			filename:    filename,
+			contentType: part.ContentType,
+		})
+		if part.Caption != "" {
+			captions = append(captions, part.Caption)
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("email send media: no attachments resolved: %w", channels.ErrSendFailed)
+	}
+
+	return c.reply(ctx, msg.ChatID, strings.Join(captions, "\n\n"), files)
+}
+
+// reply sends body and attachments as a reply in the thread chatID and
+// records the sent message as the thread's latest.
+func (c *EmailChannel) reply(ctx context.Context, chatID, body string, files []outgoingAttachment) error {
+	t, ok := c.threads.get(chatID)
+	if !ok {
+		return fmt.Errorf("email: no thread for chat %s: %w", chatID, channels.ErrSendFailed)
+	}
+
+	raw, msgID, err := buildReply(c.config.Address, c.config.DisplayName, t, body, files)
+	if err != nil {
+		return fmt.Errorf("email: build reply: %v: %w", err, channels.ErrSendFailed)
+	}
+
+	if err := c.sendMail(ctx, t.to, raw); err != nil {
+		logger.ErrorCF("email", "Failed to send reply", map[string]any{
+			"chat_id": chatID,
+			"to":      t.to,
+			"error":   err.Error(),
+		})
+		return err
+	}
+
+	c.threads.sent(chatID, msgID)
+	return nil
+}
+
+// handleMail turns a parsed message into an inbound bus message. It reports
+// whether the message was accepted.
+func (c *EmailChannel) handleMail(folder string, m *inboundMail) bool {
+	if m.from == "" || m.from == c.address {
+		return false
+	}
+	if m.automated {
+		logger.DebugCF("email", "Ignoring automated message", map[string]any{
+			"from":       m.from,
+			"message_id": m.messageID,
+		})
+		return false
+	}
+
+	sender := senderInfo(m.from, m.fromName)
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("email", "Message rejected by allowlist", map[string]any{
+			"from": m.from,
+		})
+		return false
+	}
+
+	// Reply-To is set by the sender, so it is only honored for addresses the
+	// bot may talk to anyway; otherwise replies go back to From.
+	replyTo := m.replyTo
+	if replyTo != "" && replyTo != m.from && !c.IsAllowedSender(senderInfo(replyTo, "")) {
+		logger.DebugCF("email", "Ignoring Reply-To outside the allowlist", map[string]any{
+			"from":     m.from,
+			"reply_to": replyTo,
+		})
+		replyTo = ""
+	}
+
+	if m.messageID == "" {
+		m.messageID = newMessageID(c.address)
+	}
+	chatID, isNew := c.threads.record(m, replyTo)
+	scope := channels.BuildMediaScope("email", chatID, m.messageID)
+
+	content := m.text
+	if isNew && m.subject != "" {
+		content = "Subject: " + m.subject + "\n\n" + content
+	}
+
+	var mediaRefs []string
+	for _, att := range m.attachments {
+		if att.skipped {
+			content = appendLine(content, fmt.Sprintf("[attachment skipped: %s (larger than %d MB)]",
+				att.filename, c.maxAttachmentBytes()>>20))
+			continue
+		}
+		ref, err := c.storeAttachment(att, scope)
+		if err != nil {
+			logger.ErrorCF("email", "Failed to store attachment", map[string]any{
+				"filename": att.filename,
+				"error":    err.Error(),
+			})
+			continue
+		}
+		mediaRefs = append(mediaRefs, ref)
+		content = appendLine(content, fmt.Sprintf("[attachment: %s]", att.filename))
+	}
+
+	content = strings.TrimSpace(content)
+	if content == "" && len(mediaRefs) == 0 {
+		return false
+	}
+
+	metadata := map[string]string{
+		"message_id": m.messageID,
+		"subject":    m.subject,
+		"from":       m.from,
+		"folder":     folder,
+	}
+
+	logger.DebugCF("email", "Received message", map[string]any{
+		"from":    m.from,
+		"chat_id": chatID,
+		"preview": utils.Truncate(content, 50),
+	})
+
+	peer := bus.Peer{Kind: "group", ID: chatID}
+	c.HandleMessage(c.ctx, peer, m.messageID, m.from, chatID, content, mediaRefs, metadata, sender)
+	return true
+}
+
+func senderInfo(addr, name string) bus.SenderInfo {
+	return bus.SenderInfo{
+		Platform:    "email",
+		PlatformID:  addr,
+		CanonicalID: identity.BuildCanonicalID("email", addr),
+		Username:    addr,
+		DisplayName: name,
+	}
+}
+
+// storeAttachment writes an attachment to the media temp dir and registers it
+// with the media store.
+func (c *EmailChannel) storeAttachment(att attachment, scope string) (string, error) {
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(mediaDir, "email-*-"+utils.SanitizeFilename(att.filename))
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(att.data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	store := c.GetMediaStore()
+	if store == nil {
+		return f.Name(), nil
+	}
+	ref, err := store.Store(f.Name(), media.MediaMeta{
+		Filename:    att.filename,
+		ContentType: att.contentType,
+		Source:      "email",
+	}, scope)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return ref, nil
+}
+
+func (c *EmailChannel) maxAttachmentBytes() int64 {
+	if c.config.MaxAttachmentMB <= 0 {
+		return 20 << 20
+	}
+	return int64(c.config.MaxAttachmentMB) << 20
+}
+
+func appendLine(s, line string) string {
+	if s == "" {
+		return line
+	}
+	return s + "\n" + line
+}
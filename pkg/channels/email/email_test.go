@@ -0,0 +1,629 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+	"github.com/emersion/go-message/mail"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/media"
+)
+
+const (
+	testUser     = "bot@example.com"
+	testPassword = "secret"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "paragraphs and breaks",
+			in:   "<html><head><title>x</title><style>p{}</style></head><body><p>Hello   <b>world</b></p><p>Line one<br>Line two</p></body></html>",
+			want: "Hello world\n\nLine one\nLine two",
+		},
+		{
+			name: "lists",
+			in:   "<ul><li>first</li><li>second</li></ul>",
+			want: "- first\n- second",
+		},
+		{
+			name: "links keep their target",
+			in:   `See <a href="https://example.com/docs">the docs</a> or <a href="https://example.com">https://example.com</a>.`,
+			want: "See the docs (https://example.com/docs) or https://example.com.",
+		},
+		{
+			name: "entities and scripts",
+			in:   "<div>a &amp; b &lt;c&gt;</div><script>alert(1)</script>",
+			want: "a & b <c>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := htmlToText(tt.in); got != tt.want {
+				t.Errorf("htmlToText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripQuoted(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "attribution and quote",
+			in:   "Sounds good.\n\nOn Mon, 1 Jan 2026 at 10:00, Bot <bot@example.com> wrote:\n> Earlier text\n> more",
+			want: "Sounds good.",
+		},
+		{
+			name: "wrapped attribution",
+			in:   "Thanks!\n\nOn Mon, 1 Jan 2026 at 10:00, Bot\n<bot@example.com> wrote:\n\n> Earlier text",
+			want: "Thanks!",
+		},
+		{
+			name: "inline answers are kept",
+			in:   "On Mon, Bot wrote:\n> question one\nanswer one\n> question two\nanswer two",
+			want: "On Mon, Bot wrote:\n> question one\nanswer one\n> question two\nanswer two",
+		},
+		{
+			name: "outlook separator",
+			in:   "Yes.\n-----Original Message-----\nFrom: Bot",
+			want: "Yes.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripQuoted(tt.in); got != tt.want {
+				t.Errorf("stripQuoted() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMail(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: Alice Example <Alice@Example.com>",
+		"To: bot@example.com",
+		"Subject: Quarterly report",
+		"Message-ID: <m2@example.com>",
+		"In-Reply-To: <m1@example.com>",
+		"References: <root@example.com> <m1@example.com>",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/mixed; boundary="outer"`,
+		"",
+		"--outer",
+		`Content-Type: multipart/alternative; boundary="inner"`,
+		"",
+		"--inner",
+		"Content-Type: text/html; charset=utf-8",
+		"",
+		"<p>Please <i>review</i> the attached file.</p>",
+		"--inner--",
+		"--outer",
+		"Content-Type: text/csv",
+		`Content-Disposition: attachment; filename="report.csv"`,
+		"Content-Transfer-Encoding: base64",
+		"",
+		"YSxiCjEsMgo=",
+		"--outer",
+		"Content-Type: application/octet-stream",
+		`Content-Disposition: attachment; filename="big.bin"`,
+		"",
+		strings.Repeat("x", 64),
+		"--outer--",
+		"",
+	}, "\r\n")
+
+	m, err := parseMail(strings.NewReader(raw), 32)
+	if err != nil {
+		t.Fatalf("parseMail() error = %v", err)
+	}
+	if m.from != "alice@example.com" || m.fromName != "Alice Example" {
+		t.Errorf("from = %q (%q), want alice@example.com (Alice Example)", m.from, m.fromName)
+	}
+	if m.messageID != "m2@example.com" || m.inReplyTo != "m1@example.com" {
+		t.Errorf("ids = %q / %q", m.messageID, m.inReplyTo)
+	}
+	if len(m.references) != 2 || m.references[0] != "root@example.com" {
+		t.Errorf("references = %v", m.references)
+	}
+	if m.text != "Please review the attached file." {
+		t.Errorf("text = %q", m.text)
+	}
+	if len(m.attachments) != 2 {
+		t.Fatalf("attachments = %d, want 2", len(m.attachments))
+	}
+	if a := m.attachments[0]; a.filename != "report.csv" || string(a.data) != "a,b\n1,2\n" || a.skipped {
+		t.Errorf("attachment[0] = %+v", a)
+	}
+	if a := m.attachments[1]; a.filename != "big.bin" || !a.skipped {
+		t.Errorf("attachment[1] should be skipped as too large, got %+v", a)
+	}
+}
+
+func TestParseMail_Automated(t *testing.T) {
+	raw := "From: daemon@example.com\r\nAuto-Submitted: auto-replied\r\nSubject: Out of office\r\n\r\nAway.\r\n"
+	m, err := parseMail(strings.NewReader(raw), 1024)
+	if err != nil {
+		t.Fatalf("parseMail() error = %v", err)
+	}
+	if !m.automated {
+		t.Error("expected Auto-Submitted mail to be marked automated")
+	}
+}
+
+func TestThreadStore(t *testing.T) {
+	s := newThreadStore()
+
+	chat, isNew := s.record(&inboundMail{messageID: "a@x", from: "alice@x", subject: "Hi"}, "")
+	if chat != "a@x" || !isNew {
+		t.Fatalf("first message: chat = %q, isNew = %v", chat, isNew)
+	}
+	s.sent(chat, "b@bot")
+
+	// A reply to our message that only carries In-Reply-To stays in the thread.
+	chat2, isNew := s.record(&inboundMail{messageID: "c@x", inReplyTo: "b@bot", from: "alice@x"}, "")
+	if chat2 != chat || isNew {
+		t.Fatalf("reply: chat = %q, isNew = %v, want %q", chat2, isNew, chat)
+	}
+
+	th, ok := s.get(chat)
+	if !ok {
+		t.Fatal("thread not found")
+	}
+	if th.lastID != "c@x" || th.to != "alice@x" || th.subject != "Hi" {
+		t.Errorf("thread = %+v", th)
+	}
+	if refs := th.references(); strings.Join(refs, " ") != "a@x b@bot c@x" {
+		t.Errorf("references = %v", refs)
+	}
+
+	// An unknown reply is filed under the root it names.
+	chat3, _ := s.record(&inboundMail{messageID: "z@y", references: []string{"root@y", "q@y"}, from: "bob@y"}, "")
+	if chat3 != "root@y" {
+		t.Errorf("unknown reply chat = %q, want root@y", chat3)
+	}
+}
+
+func TestThreadStore_EvictsOldest(t *testing.T) {
+	s := newThreadStore()
+	for i := range maxThreads + 1 {
+		id := "m" + strconv.Itoa(i)
+		s.record(&inboundMail{messageID: id, from: "alice@x"}, "")
+		if i == 0 {
+			s.sent(id, "r0@bot")
+		}
+		if i == 1 {
+			// Activity on the first thread keeps it; the second is now oldest.
+			s.record(&inboundMail{messageID: "m0b", inReplyTo: "r0@bot", from: "alice@x"}, "")
+		}
+	}
+	if len(s.chats) != maxThreads {
+		t.Fatalf("threads = %d, want %d", len(s.chats), maxThreads)
+	}
+	if _, ok := s.get("m1"); ok {
+		t.Error("least recently active thread should be evicted")
+	}
+	if _, ok := s.byMsg["m1"]; ok {
+		t.Error("evicted thread's message IDs should be forgotten")
+	}
+	if chat, _ := s.record(&inboundMail{messageID: "m0c", inReplyTo: "m0b", from: "alice@x"}, ""); chat != "m0" {
+		t.Errorf("active thread chat = %q, want m0", chat)
+	}
+}
+
+func TestEmailChannel_ReplyToAllowlist(t *testing.T) {
+	cfg := testConfig("127.0.0.1:1", "127.0.0.1:1")
+	cfg.AllowFrom = config.FlexibleStringSlice{"alice@example.com", "alice@work.example.com"}
+	ch, err := NewEmailChannel(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewEmailChannel() error = %v", err)
+	}
+	ch.ctx = context.Background()
+
+	tests := []struct {
+		replyTo string
+		want    string
+	}{
+		{"alice@work.example.com", "alice@work.example.com"},
+		{"victim@example.org", "alice@example.com"},
+	}
+	for i, tt := range tests {
+		id := "r" + strconv.Itoa(i) + "@example.com"
+		ch.handleMail("INBOX", &inboundMail{messageID: id, from: "alice@example.com", replyTo: tt.replyTo, text: "hi"})
+		th, ok := ch.threads.get(id)
+		if !ok {
+			t.Fatalf("Reply-To %s: thread not recorded", tt.replyTo)
+		}
+		if th.to != tt.want {
+			t.Errorf("Reply-To %s: replies go to %q, want %q", tt.replyTo, th.to, tt.want)
+		}
+	}
+}
+
+func TestMergeRefs_Trims(t *testing.T) {
+	var refs []string
+	for i := range maxReferences + 5 {
+		refs = mergeRefs(refs, nil, "id"+strconv.Itoa(i))
+	}
+	if len(refs) != maxReferences {
+		t.Fatalf("len(refs) = %d, want %d", len(refs), maxReferences)
+	}
+	if refs[0] != "id0" || refs[len(refs)-1] != "id"+strconv.Itoa(maxReferences+4) {
+		t.Errorf("refs should keep the root and the latest ids, got %v", refs)
+	}
+}
+
+func TestEmailChannel_RoundTrip(t *testing.T) {
+	imapAddr, user := startIMAPServer(t)
+	smtpAddr, sent := startSMTPServer(t)
+
+	cfg := testConfig(imapAddr, smtpAddr)
+	cfg.AllowFrom = config.FlexibleStringSlice{"Alice@Example.com"}
+
+	messageBus := bus.NewMessageBus()
+	ch, err := NewEmailChannel(cfg, messageBus)
+	if err != nil {
+		t.Fatalf("NewEmailChannel() error = %v", err)
+	}
+	store := media.NewFileMediaStore()
+	ch.SetMediaStore(store)
+
+	// Mail that was in the folder before the channel first connected is left
+	// alone.
+	appendMail(t, user, "From: alice@example.com\r\nSubject: Old\r\nMessage-ID: <old@example.com>\r\n\r\nStale\r\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer ch.Stop(context.Background())
+	waitFor(t, func() bool { return ch.watching.Load() == 1 })
+
+	appendMail(t, user, "From: Mallory <mallory@example.com>\r\nSubject: Spam\r\nMessage-ID: <spam@example.com>\r\n\r\nBuy now\r\n")
+	appendMail(t, user, strings.Join([]string{
+		"From: Alice <alice@example.com>",
+		"Subject: Trip plans",
+		"Message-ID: <root@example.com>",
+		"MIME-Version: 1.0",
+		"Content-Type: text/html; charset=utf-8",
+		"",
+		"<p>Where should we go?</p>",
+		"",
+	}, "\r\n"))
+
+	msg, ok := messageBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if msg.ChatID != "root@example.com" || msg.Peer.Kind != "group" {
+		t.Errorf("chat = %q, peer = %+v", msg.ChatID, msg.Peer)
+	}
+	if msg.SenderID != "email:alice@example.com" {
+		t.Errorf("sender = %q", msg.SenderID)
+	}
+	if msg.Content != "Subject: Trip plans\n\nWhere should we go?" {
+		t.Errorf("content = %q", msg.Content)
+	}
+
+	// The old and the stranger's messages are left unread; Alice's new one is
+	// marked seen.
+	waitFor(t, func() bool {
+		return strings.Join(unseenSubjects(t, imapAddr), ",") == "Old,Spam"
+	})
+
+	if err := ch.Send(ctx, bus.OutboundMessage{Channel: "email", ChatID: msg.ChatID, Content: "How about Lisbon?"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	reply := receive(t, sent)
+	if reply.to != "alice@example.com" {
+		t.Errorf("reply recipient = %q", reply.to)
+	}
+	h := readHeader(t, reply.data)
+	if got := h.Get("Subject"); got != "Re: Trip plans" {
+		t.Errorf("Subject = %q", got)
+	}
+	if got, _ := h.MsgIDList("In-Reply-To"); len(got) != 1 || got[0] != "root@example.com" {
+		t.Errorf("In-Reply-To = %v", got)
+	}
+	if got, _ := h.MsgIDList("References"); strings.Join(got, " ") != "root@example.com" {
+		t.Errorf("References = %v", got)
+	}
+	replyID, _ := h.MessageID()
+
+	// Alice answers our reply while the channel is idling; the answer lands in
+	// the same chat.
+	appendMail(t, user, strings.Join([]string{
+		"From: alice@example.com",
+		"Subject: Re: Trip plans",
+		"Message-ID: <second@example.com>",
+		"In-Reply-To: <" + replyID + ">",
+		"",
+		"Lisbon works.",
+		"",
+		"On Tue, PicoClaw <bot@example.com> wrote:",
+		"> How about Lisbon?",
+		"",
+	}, "\r\n"))
+	msg, ok = messageBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message for the follow-up")
+	}
+	if msg.ChatID != "root@example.com" || msg.Content != "Lisbon works." {
+		t.Errorf("follow-up chat = %q, content = %q", msg.ChatID, msg.Content)
+	}
+
+	// Media replies carry the files as attachments.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "itinerary.txt")
+	if err := os.WriteFile(path, []byte("day 1: Belém"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := store.Store(path, media.MediaMeta{Filename: "itinerary.txt"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ch.SendMedia(ctx, bus.OutboundMediaMessage{
+		Channel: "email",
+		ChatID:  msg.ChatID,
+		Parts:   []bus.MediaPart{{Type: "file", Ref: ref, Caption: "Here is the plan."}},
+	})
+	if err != nil {
+		t.Fatalf("SendMedia() error = %v", err)
+	}
+	reply = receive(t, sent)
+	h = readHeader(t, reply.data)
+	if got, _ := h.MsgIDList("In-Reply-To"); len(got) != 1 || got[0] != "second@example.com" {
+		t.Errorf("In-Reply-To = %v", got)
+	}
+	if got, _ := h.MsgIDList("References"); strings.Join(got, " ") != "root@example.com "+replyID+" second@example.com" {
+		t.Errorf("References = %v", got)
+	}
+	parsed, err := parseMail(bytes.NewReader(reply.data), 1<<20)
+	if err != nil {
+		t.Fatalf("parse reply: %v", err)
+	}
+	if parsed.text != "Here is the plan." {
+		t.Errorf("reply body = %q", parsed.text)
+	}
+	if len(parsed.attachments) != 1 || parsed.attachments[0].filename != "itinerary.txt" ||
+		string(parsed.attachments[0].data) != "day 1: Belém" {
+		t.Errorf("reply attachments = %+v", parsed.attachments)
+	}
+}
+
+func TestEmailChannel_SendUnknownThread(t *testing.T) {
+	ch, err := NewEmailChannel(testConfig("127.0.0.1:1", "127.0.0.1:1"), bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewEmailChannel() error = %v", err)
+	}
+	ch.SetRunning(true)
+	err = ch.Send(context.Background(), bus.OutboundMessage{ChatID: "nope@example.com", Content: "hi"})
+	if !errors.Is(err, channels.ErrSendFailed) {
+		t.Errorf("Send() error = %v, want ErrSendFailed", err)
+	}
+}
+
+func testConfig(imapAddr, smtpAddr string) config.EmailConfig {
+	imapHost, imapPort, _ := net.SplitHostPort(imapAddr)
+	smtpHost, smtpPort, _ := net.SplitHostPort(smtpAddr)
+	ip, _ := strconv.Atoi(imapPort)
+	sp, _ := strconv.Atoi(smtpPort)
+	return config.EmailConfig{
+		Enabled:      true,
+		Address:      testUser,
+		DisplayName:  "PicoClaw",
+		IMAPHost:     imapHost,
+		IMAPPort:     ip,
+		IMAPSecurity: "none",
+		Username:     testUser,
+		Password:     testPassword,
+		Folders:      config.FlexibleStringSlice{"INBOX"},
+		SMTPHost:     smtpHost,
+		SMTPPort:     sp,
+		SMTPSecurity: "none",
+	}
+}
+
+func startIMAPServer(t *testing.T) (string, *imapmemserver.User) {
+	t.Helper()
+
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser(testUser, testPassword)
+	if err := user.Create("INBOX", nil); err != nil {
+		t.Fatal(err)
+	}
+	mem.AddUser(user)
+
+	srv := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return mem.NewSession(), nil, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIMAP4rev2: {}},
+		InsecureAuth: true,
+		Logger:       discardLogger{},
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String(), user
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(string, ...any) {}
+
+func appendMail(t *testing.T, user *imapmemserver.User, raw string) {
+	t.Helper()
+	if _, err := user.Append("INBOX", bytes.NewReader([]byte(raw)), &imap.AppendOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func unseenSubjects(t *testing.T, addr string) []string {
+	t.Helper()
+	c, err := imapclient.DialInsecure(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Login(testUser, testPassword).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Select("INBOX", &imap.SelectOptions{ReadOnly: true}).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.UIDSearch(&imap.SearchCriteria{NotFlag: []imap.Flag{imap.FlagSeen}}, nil).Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uids := data.AllUIDs()
+	if len(uids) == 0 {
+		return nil
+	}
+	msgs, err := c.Fetch(imap.UIDSetNum(uids...), &imap.FetchOptions{Envelope: true}).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subjects []string
+	for _, m := range msgs {
+		subjects = append(subjects, m.Envelope.Subject)
+	}
+	return subjects
+}
+
+type sentMail struct {
+	from, to string
+	data     []byte
+}
+
+// startSMTPServer runs a minimal SMTP server that accepts every message and
+// reports it on the returned channel.
+func startSMTPServer(t *testing.T) (string, <-chan sentMail) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	out := make(chan sentMail, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, out)
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func serveSMTP(conn net.Conn, out chan<- sentMail) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP test")
+	var msg sentMail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		upper := strings.ToUpper(cmd)
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			msg.from = strings.Trim(cmd[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			msg.to = strings.Trim(cmd[len("RCPT TO:"):], "<> ")
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = data.Bytes()
+			out <- msg
+			msg = sentMail{}
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func receive(t *testing.T, sent <-chan sentMail) sentMail {
+	t.Helper()
+	select {
+	case m := <-sent:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message reached the SMTP server")
+		return sentMail{}
+	}
+}
+
+func readHeader(t *testing.T, data []byte) mail.Header {
+	t.Helper()
+	mr, err := mail.CreateReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	return mr.Header
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
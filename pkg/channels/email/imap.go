@@ -0,0 +1,245 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	minReconnectDelay = 2 * time.Second
+	maxReconnectDelay = 5 * time.Minute
+)
+
+// folderState remembers how far a folder has been read, across reconnects.
+type folderState struct {
+	uidValidity uint32
+	lastUID     imap.UID
+}
+
+// watchFolder keeps an IMAP session open on folder, reconnecting with backoff
+// until the channel stops.
+func (c *EmailChannel) watchFolder(folder string) {
+	defer c.wg.Done()
+
+	state := &folderState{}
+	delay := minReconnectDelay
+	for {
+		started := time.Now()
+		err := c.runSession(folder, state)
+		if c.ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+		logger.WarnCF("email", "IMAP session ended, reconnecting", map[string]any{
+			"folder": folder,
+			"error":  fmt.Sprint(err),
+			"retry":  delay.String(),
+		})
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// runSession connects, selects folder and handles new mail until the
+// connection fails or the channel stops.
+func (c *EmailChannel) runSession(folder string, state *folderState) error {
+	updates := make(chan struct{}, 1)
+	client, err := c.dialIMAP(&imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Mailbox: func(data *imapclient.UnilateralDataMailbox) {
+				if data.NumMessages != nil {
+					select {
+					case updates <- struct{}{}:
+					default:
+					}
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer client.Close()
+
+	// Closing the connection unblocks any command in flight on shutdown.
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			client.Close()
+		case <-client.Closed():
+		}
+	}()
+
+	if err := client.Login(c.config.Username, c.config.Password).Wait(); err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	selected, err := client.Select(folder, nil).Wait()
+	if err != nil {
+		return fmt.Errorf("select %s: %w", folder, err)
+	}
+	if selected.UIDValidity != state.uidValidity {
+		// On first connect, or when the server renumbered the folder, start
+		// at its end: mail already there is not answered all at once.
+		state.uidValidity = selected.UIDValidity
+		state.lastUID = 0
+		if selected.UIDNext > 0 {
+			state.lastUID = selected.UIDNext - 1
+		}
+	}
+	c.watching.Add(1)
+	defer c.watching.Add(-1)
+
+	canIdle := client.Caps().Has(imap.CapIdle)
+	logger.InfoCF("email", "Watching folder", map[string]any{
+		"folder": folder,
+		"idle":   canIdle,
+	})
+
+	for {
+		if err := c.fetchNew(client, folder, state); err != nil {
+			return err
+		}
+		if canIdle {
+			if err := c.idle(client, updates); err != nil {
+				return err
+			}
+		} else {
+			select {
+			case <-c.ctx.Done():
+				return nil
+			case <-time.After(c.pollInterval()):
+			}
+		}
+		if c.ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (c *EmailChannel) dialIMAP(opts *imapclient.Options) (*imapclient.Client, error) {
+	port := c.config.IMAPPort
+	if port == 0 {
+		port = 993
+	}
+	addr := net.JoinHostPort(c.config.IMAPHost, strconv.Itoa(port))
+
+	switch c.config.IMAPSecurity {
+	case "", "tls":
+		return imapclient.DialTLS(addr, opts)
+	case "starttls":
+		return imapclient.DialStartTLS(addr, opts)
+	case "none":
+		return imapclient.DialInsecure(addr, opts)
+	default:
+		return nil, fmt.Errorf("unknown imap_security %q", c.config.IMAPSecurity)
+	}
+}
+
+// idle waits in IDLE until the server reports new messages or the channel
+// stops.
+func (c *EmailChannel) idle(client *imapclient.Client, updates <-chan struct{}) error {
+	cmd, err := client.Idle()
+	if err != nil {
+		return fmt.Errorf("idle: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			err = errors.New("server ended IDLE")
+		}
+		return err
+	case <-updates:
+	case <-c.ctx.Done():
+	}
+
+	if err := cmd.Close(); err != nil {
+		return fmt.Errorf("idle: %w", err)
+	}
+	return <-done
+}
+
+// fetchNew handles the unread messages that arrived since the last fetch.
+// Handled messages are marked \Seen; messages the channel ignores are left
+// unread so a person sharing the mailbox still sees them.
+func (c *EmailChannel) fetchNew(client *imapclient.Client, folder string, state *folderState) error {
+	criteria := &imap.SearchCriteria{NotFlag: []imap.Flag{imap.FlagSeen}}
+	if state.lastUID > 0 {
+		criteria.UID = []imap.UIDSet{{imap.UIDRange{Start: state.lastUID + 1}}}
+	}
+	data, err := client.UIDSearch(criteria, nil).Wait()
+	if err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+
+	section := &imap.FetchItemBodySection{Peek: true}
+	options := &imap.FetchOptions{
+		UID:         true,
+		BodySection: []*imap.FetchItemBodySection{section},
+	}
+	for _, uid := range data.AllUIDs() {
+		// "N:*" matches the last message even when its UID is below N.
+		if uid <= state.lastUID {
+			continue
+		}
+		msgs, err := client.Fetch(imap.UIDSetNum(uid), options).Collect()
+		if err != nil {
+			return fmt.Errorf("fetch %d: %w", uid, err)
+		}
+		state.lastUID = uid
+
+		for _, msg := range msgs {
+			raw := msg.FindBodySection(section)
+			if raw == nil {
+				continue
+			}
+			if c.processRaw(folder, raw) {
+				seen := &imap.StoreFlags{Op: imap.StoreFlagsAdd, Flags: []imap.Flag{imap.FlagSeen}, Silent: true}
+				if err := client.Store(imap.UIDSetNum(uid), seen, nil).Close(); err != nil {
+					return fmt.Errorf("mark %d seen: %w", uid, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// processRaw parses one message and hands it to the bus. It reports whether
+// the message was accepted.
+func (c *EmailChannel) processRaw(folder string, raw []byte) bool {
+	m, err := parseMail(bytes.NewReader(raw), c.maxAttachmentBytes())
+	if err != nil {
+		logger.WarnCF("email", "Failed to parse message", map[string]any{
+			"folder": folder,
+			"error":  err.Error(),
+		})
+		return false
+	}
+	return c.handleMail(folder, m)
+}
+
+func (c *EmailChannel) pollInterval() time.Duration {
+	if c.config.PollInterval <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(c.config.PollInterval) * time.Second
+}
@@ -0,0 +1,342 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+
+	_ "github.com/emersion/go-message/charset" // decode non-UTF-8 bodies and headers
+	"github.com/emersion/go-message/mail"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// inboundMail is the part of an incoming message the channel uses.
+type inboundMail struct {
+	messageID   string
+	inReplyTo   string
+	references  []string
+	from        string // lower-cased sender address
+	fromName    string
+	replyTo     string // lower-cased Reply-To address, if any
+	subject     string
+	text        string
+	automated   bool // auto-replies, bounces and list mail
+	attachments []attachment
+}
+
+type attachment struct {
+	filename    string
+	contentType string
+	data        []byte
+	skipped     bool // larger than the configured limit
+}
+
+// parseMail reads a raw RFC 5322 message. Attachments larger than
+// maxAttachment bytes are listed but not kept.
+func parseMail(r io.Reader, maxAttachment int64) (*inboundMail, error) {
+	mr, err := mail.CreateReader(r)
+	if err != nil && mr == nil {
+		return nil, err
+	}
+	defer mr.Close()
+
+	h := mr.Header
+	m := &inboundMail{}
+	m.messageID, _ = h.MessageID()
+	if ids, _ := h.MsgIDList("In-Reply-To"); len(ids) > 0 {
+		m.inReplyTo = ids[0]
+	}
+	m.references, _ = h.MsgIDList("References")
+	if from, err := h.AddressList("From"); err == nil && len(from) > 0 {
+		m.from = strings.ToLower(from[0].Address)
+		m.fromName = from[0].Name
+	}
+	if replyTo, err := h.AddressList("Reply-To"); err == nil && len(replyTo) > 0 {
+		m.replyTo = strings.ToLower(replyTo[0].Address)
+	}
+	m.subject, _ = h.Subject()
+	m.automated = isAutomated(h)
+
+	var plain, htmlBody string
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read part: %w", err)
+		}
+
+		switch ph := p.Header.(type) {
+		case *mail.InlineHeader:
+			ct, _, _ := ph.ContentType()
+			switch {
+			case ct == "text/plain" || ct == "":
+				if plain == "" {
+					b, err := io.ReadAll(p.Body)
+					if err != nil {
+						return nil, fmt.Errorf("read text body: %w", err)
+					}
+					plain = string(b)
+				}
+			case ct == "text/html":
+				if htmlBody == "" {
+					b, err := io.ReadAll(p.Body)
+					if err != nil {
+						return nil, fmt.Errorf("read html body: %w", err)
+					}
+					htmlBody = string(b)
+				}
+			case !strings.HasPrefix(ct, "text/"):
+				// Inline images and the like are kept as attachments.
+				att, err := readAttachment(p.Body, "", ct, maxAttachment)
+				if err != nil {
+					return nil, err
+				}
+				m.attachments = append(m.attachments, att)
+			}
+		case *mail.AttachmentHeader:
+			filename, _ := ph.Filename()
+			ct, _, _ := ph.ContentType()
+			att, err := readAttachment(p.Body, filename, ct, maxAttachment)
+			if err != nil {
+				return nil, err
+			}
+			m.attachments = append(m.attachments, att)
+		}
+	}
+
+	if plain != "" {
+		m.text = normalizeText(plain)
+	} else {
+		m.text = htmlToText(htmlBody)
+	}
+	m.text = stripQuoted(m.text)
+	return m, nil
+}
+
+func readAttachment(r io.Reader, filename, contentType string, limit int64) (attachment, error) {
+	if filename == "" {
+		filename = "attachment"
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	att := attachment{filename: filename, contentType: contentType}
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return att, fmt.Errorf("read attachment %s: %w", filename, err)
+	}
+	if int64(len(data)) > limit {
+		att.skipped = true
+		return att, nil
+	}
+	att.data = data
+	return att, nil
+}
+
+// isAutomated reports whether the message was sent by a machine, so the bot
+// does not answer vacation replies, bounces or mailing lists.
+func isAutomated(h mail.Header) bool {
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "list", "junk", "auto_reply":
+		return true
+	}
+	return h.Get("List-Id") != "" || h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != ""
+}
+
+var (
+	quoteHeaderRe = regexp.MustCompile(`(?i)^on\s.+wrote:$`)
+	blankLinesRe  = regexp.MustCompile(`\n{3,}`)
+)
+
+// stripQuoted removes the quoted history most clients append below a reply:
+// an "On ... wrote:" line or an "Original Message" separator followed only by
+// quoted text, and any trailing block of "> " lines.
+func stripQuoted(text string) string {
+	lines := strings.Split(text, "\n")
+
+	cut := len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "-----Original Message-----") {
+			cut = i
+			break
+		}
+		// Some clients wrap the attribution line: "On <date>, <name>\n<addr> wrote:".
+		start := i
+		if i > 0 && strings.HasSuffix(trimmed, "wrote:") && !quoteHeaderRe.MatchString(trimmed) {
+			joined := strings.TrimSpace(lines[i-1]) + " " + trimmed
+			if quoteHeaderRe.MatchString(joined) {
+				trimmed, start = joined, i-1
+			}
+		}
+		if quoteHeaderRe.MatchString(trimmed) && onlyQuotedAfter(lines[i+1:]) {
+			cut = start
+			break
+		}
+	}
+	lines = lines[:cut]
+
+	for len(lines) > 0 {
+		last := strings.TrimSpace(lines[len(lines)-1])
+		if last != "" && !strings.HasPrefix(last, ">") {
+			break
+		}
+		lines = lines[:len(lines)-1]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func onlyQuotedAfter(lines []string) bool {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, ">") {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeText converts line endings and drops runs of blank lines.
+func normalizeText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	s = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLinesRe.ReplaceAllString(s, "\n\n"))
+}
+
+// htmlToText renders an HTML body as plain text: block elements become line
+// breaks, list items get a "- " marker, links keep their target, and scripts,
+// styles and the document head are dropped.
+func htmlToText(s string) string {
+	z := html.NewTokenizer(strings.NewReader(s))
+	var b strings.Builder
+	skip := 0
+	type link struct {
+		href  string
+		start int
+	}
+	var links []link
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			lines := strings.Split(b.String(), "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimSpace(line)
+			}
+			return normalizeText(strings.Join(lines, "\n"))
+
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			text := string(z.Text())
+			collapsed := strings.Join(strings.Fields(text), " ")
+			if collapsed == "" || startsWithSpace(text) {
+				writeSpace(&b)
+			}
+			if collapsed == "" {
+				continue
+			}
+			b.WriteString(collapsed)
+			if endsWithSpace(text) {
+				writeSpace(&b)
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			a := atom.Lookup(name)
+			switch a {
+			case atom.Script, atom.Style, atom.Head, atom.Title:
+				if tt == html.StartTagToken {
+					skip++
+				}
+			case atom.Br:
+				b.WriteString("\n")
+			case atom.Li:
+				b.WriteString("\n- ")
+			case atom.Td, atom.Th:
+				b.WriteString(" ")
+			case atom.A:
+				href := ""
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					if string(key) == "href" {
+						href = string(val)
+					}
+				}
+				links = append(links, link{href: href, start: b.Len()})
+			default:
+				if isBlock(a) {
+					b.WriteString("\n")
+				}
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			switch a {
+			case atom.Script, atom.Style, atom.Head, atom.Title:
+				if skip > 0 {
+					skip--
+				}
+			case atom.A:
+				if len(links) == 0 {
+					continue
+				}
+				l := links[len(links)-1]
+				links = links[:len(links)-1]
+				label := strings.TrimSpace(b.String()[l.start:])
+				if (strings.HasPrefix(l.href, "http://") || strings.HasPrefix(l.href, "https://")) &&
+					label != l.href {
+					b.WriteString(" (" + l.href + ")")
+				}
+			default:
+				if isBlock(a) {
+					b.WriteString("\n")
+				}
+			}
+		}
+	}
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Tr, atom.Table, atom.Ul, atom.Ol, atom.Blockquote, atom.Pre,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Hr, atom.Section, atom.Article,
+		atom.Header, atom.Footer:
+		return true
+	}
+	return false
+}
+
+// writeSpace separates words without doubling spaces or indenting lines.
+func writeSpace(b *strings.Builder) {
+	out := b.String()
+	if out != "" && !strings.HasSuffix(out, " ") && !strings.HasSuffix(out, "\n") {
+		b.WriteString(" ")
+	}
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\r\n", rune(s[0]))
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\r\n", rune(s[len(s)-1]))
+}
@@ -0,0 +1,243 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message/mail"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+const smtpTimeout = 60 * time.Second
+
+type outgoingAttachment struct {
+	path        string
+	filename    string
+	contentType string
+}
+
+// buildReply renders a reply to t. It returns the message and its Message-ID.
+func buildReply(
+	from, displayName string,
+	t thread,
+	body string,
+	files []outgoingAttachment,
+) ([]byte, string, error) {
+	msgID := newMessageID(from)
+
+	var h mail.Header
+	h.SetDate(time.Now())
+	h.SetAddressList("From", []*mail.Address{{Name: displayName, Address: from}})
+	h.SetAddressList("To", []*mail.Address{{Address: t.to}})
+	h.SetSubject(replySubject(t.subject))
+	h.SetMessageID(msgID)
+	if t.lastID != "" {
+		h.SetMsgIDList("In-Reply-To", []string{t.lastID})
+		h.SetMsgIDList("References", t.references())
+	}
+	h.Set("Auto-Submitted", "auto-replied")
+
+	var textHeader mail.InlineHeader
+	textHeader.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+
+	var buf bytes.Buffer
+	if len(files) == 0 {
+		h.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+		w, err := mail.CreateSingleInlineWriter(&buf, h)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := io.WriteString(w, body); err != nil {
+			return nil, "", err
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), msgID, nil
+	}
+
+	mw, err := mail.CreateWriter(&buf, h)
+	if err != nil {
+		return nil, "", err
+	}
+	tw, err := mw.CreateSingleInline(textHeader)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.WriteString(tw, body); err != nil {
+		return nil, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+	for _, f := range files {
+		if err := writeAttachment(mw, f); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), msgID, nil
+}
+
+func writeAttachment(mw *mail.Writer, f outgoingAttachment) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	contentType := f.contentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(f.filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	var ah mail.AttachmentHeader
+	ah.Set("Content-Type", contentType)
+	ah.SetFilename(f.filename)
+	w, err := mw.CreateAttachment(ah)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// replySubject prefixes subject with "Re: " unless it already has it.
+func replySubject(subject string) string {
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return "Re: (no subject)"
+	}
+	if strings.HasPrefix(strings.ToLower(subject), "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
+
+// newMessageID returns a unique Message-ID (without angle brackets) in the
+// domain of address.
+func newMessageID(address string) string {
+	domain := "picoclaw.local"
+	if _, d, ok := strings.Cut(address, "@"); ok && d != "" {
+		domain = d
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "." + hex.EncodeToString(b) + "@" + domain
+}
+
+// sendMail delivers raw to the given recipient through the configured SMTP
+// server.
+func (c *EmailChannel) sendMail(ctx context.Context, to string, raw []byte) error {
+	host := c.config.SMTPHost
+	port := c.config.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: host}
+
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	switch c.config.SMTPSecurity {
+	case "tls":
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	case "", "starttls", "none":
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	default:
+		return fmt.Errorf("email: unknown smtp_security %q: %w", c.config.SMTPSecurity, channels.ErrSendFailed)
+	}
+	if err != nil {
+		return fmt.Errorf("email: connect %s: %v: %w", addr, err, channels.ErrTemporary)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return smtpError(err)
+	}
+	defer client.Close()
+
+	if c.config.SMTPSecurity == "" || c.config.SMTPSecurity == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("email: %s does not support STARTTLS: %w", addr, channels.ErrSendFailed)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	username, password := c.config.SMTPUsername, c.config.SMTPPassword
+	if username == "" {
+		username, password = c.config.Username, c.config.Password
+	}
+	if ok, _ := client.Extension("AUTH"); ok && username != "" {
+		if err := client.Auth(smtp.PlainAuth("", username, password, host)); err != nil {
+			return smtpError(err)
+		}
+	}
+
+	if err := client.Mail(c.config.Address); err != nil {
+		return smtpError(err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return smtpError(err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := w.Write(raw); err != nil {
+		return smtpError(err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError(err)
+	}
+	// The message is accepted once DATA completes; a failed QUIT does not
+	// change that.
+	client.Quit()
+	return nil
+}
+
+// smtpError classifies err: permanent (5xx) replies fail the send, anything
+// else is worth retrying.
+func smtpError(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return fmt.Errorf("email: smtp: %v: %w", err, channels.ErrSendFailed)
+	}
+	return fmt.Errorf("email: smtp: %v: %w", err, channels.ErrTemporary)
+}
@@ -0,0 +1,179 @@
+package email
+
+import (
+	"slices"
+	"sync"
+)
+
+// maxReferences caps the References header of replies. Long threads keep the
+// root and the most recent messages, as RFC 5322 suggests.
+const maxReferences = 20
+
+// maxThreads caps how many conversations are remembered. The least recently
+// active thread is forgotten first; a reply to it starts a new session.
+const maxThreads = 1000
+
+// thread is what a reply needs to know about an email conversation.
+type thread struct {
+	to      string   // address replies are sent to
+	subject string   // subject of the first message
+	lastID  string   // Message-ID of the latest message, for In-Reply-To
+	refs    []string // References chain, oldest first, excluding lastID
+	msgIDs  []string // every Message-ID filed under the thread, for eviction
+	used    uint64   // store clock at the last activity, for eviction
+}
+
+// threadStore maps email conversations to chat IDs. A chat ID is the
+// Message-ID of the thread's first message, so every message that refers to
+// it lands in the same session.
+type threadStore struct {
+	mu    sync.Mutex
+	chats map[string]*thread
+	byMsg map[string]string // Message-ID -> chat ID
+	clock uint64
+}
+
+func newThreadStore() *threadStore {
+	return &threadStore{
+		chats: make(map[string]*thread),
+		byMsg: make(map[string]string),
+	}
+}
+
+// record files an incoming message under its thread and returns the chat ID.
+// Replies go to replyTo, which the caller has checked, or else to the sender.
+// isNew reports whether the message starts a thread not seen before.
+func (s *threadStore) record(m *inboundMail, replyTo string) (chatID string, isNew bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chatID = s.lookup(m)
+	t, ok := s.chats[chatID]
+	if !ok {
+		t = &thread{subject: m.subject}
+		s.chats[chatID] = t
+		isNew = len(m.references) == 0 && m.inReplyTo == ""
+	}
+
+	t.to = replyTo
+	if t.to == "" {
+		t.to = m.from
+	}
+	if m.messageID != "" {
+		t.refs = mergeRefs(t.refs, m.references, t.lastID)
+		t.lastID = m.messageID
+		s.file(t, chatID, m.messageID)
+	}
+	s.touch(t)
+	s.evict()
+	return chatID, isNew
+}
+
+// lookup finds the chat a message belongs to: the chat of the closest known
+// message it refers to, or else the thread root named in its headers.
+func (s *threadStore) lookup(m *inboundMail) string {
+	if m.inReplyTo != "" {
+		if id, ok := s.byMsg[m.inReplyTo]; ok {
+			return id
+		}
+	}
+	for _, ref := range slices.Backward(m.references) {
+		if id, ok := s.byMsg[ref]; ok {
+			return id
+		}
+	}
+	if id, ok := s.byMsg[m.messageID]; ok {
+		return id
+	}
+
+	switch {
+	case len(m.references) > 0:
+		return m.references[0]
+	case m.inReplyTo != "":
+		return m.inReplyTo
+	default:
+		return m.messageID
+	}
+}
+
+// get returns a copy of the thread for chatID.
+func (s *threadStore) get(chatID string) (thread, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.chats[chatID]
+	if !ok {
+		return thread{}, false
+	}
+	cp := *t
+	cp.refs = slices.Clone(t.refs)
+	return cp, true
+}
+
+// sent records a reply we sent so answers to it stay in the thread.
+func (s *threadStore) sent(chatID, msgID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.chats[chatID]
+	if !ok {
+		return
+	}
+	t.refs = mergeRefs(t.refs, nil, t.lastID)
+	t.lastID = msgID
+	s.file(t, chatID, msgID)
+	s.touch(t)
+}
+
+// file indexes msgID under the thread t with the given chat ID.
+func (s *threadStore) file(t *thread, chatID, msgID string) {
+	if _, ok := s.byMsg[msgID]; !ok {
+		t.msgIDs = append(t.msgIDs, msgID)
+	}
+	s.byMsg[msgID] = chatID
+}
+
+func (s *threadStore) touch(t *thread) {
+	s.clock++
+	t.used = s.clock
+}
+
+// evict forgets the least recently active thread once there are more than
+// maxThreads.
+func (s *threadStore) evict() {
+	if len(s.chats) <= maxThreads {
+		return
+	}
+	var oldestID string
+	var oldest *thread
+	for id, t := range s.chats {
+		if oldest == nil || t.used < oldest.used {
+			oldestID, oldest = id, t
+		}
+	}
+	for _, msgID := range oldest.msgIDs {
+		if s.byMsg[msgID] == oldestID {
+			delete(s.byMsg, msgID)
+		}
+	}
+	delete(s.chats, oldestID)
+}
+
+// references returns the References header for a reply to t.
+func (t thread) references() []string {
+	return mergeRefs(t.refs, nil, t.lastID)
+}
+
+// mergeRefs appends the IDs from more and last to refs, skipping duplicates
+// and trimming the chain to maxReferences.
+func mergeRefs(refs, more []string, last string) []string {
+	for _, id := range append(slices.Clone(more), last) {
+		if id != "" && !slices.Contains(refs, id) {
+			refs = append(refs, id)
+		}
+	}
+	if len(refs) > maxReferences {
+		refs = append(refs[:1], refs[len(refs)-maxReferences+1:]...)
+	}
+	return refs
+}
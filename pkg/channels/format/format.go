@@ -0,0 +1,311 @@
+// Package format renders the Markdown the agent writes into the markup each
+// channel understands. The Markdown is parsed once into blocks and inline
+// elements, and long messages are split on the rendered form, between
+// blocks, lines or words, so every part is well-formed on its own.
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Dialect is an outbound text markup.
+type Dialect string
+
+const (
+	// Markdown is normalized CommonMark, for platforms that render Markdown
+	// themselves (DingTalk, Mattermost, Slack Block Kit).
+	Markdown Dialect = "markdown"
+	// FeishuMarkdown is the markdown of Feishu/Lark card elements.
+	FeishuMarkdown Dialect = "feishu_markdown"
+	// Discord is Markdown without tables and with three heading levels.
+	Discord Dialect = "discord"
+	// SlackMrkdwn is Slack's mrkdwn text format.
+	SlackMrkdwn Dialect = "slack_mrkdwn"
+	// TelegramHTML is Telegram's HTML parse mode.
+	TelegramHTML Dialect = "telegram_html"
+	// TelegramMarkdownV2 is Telegram's MarkdownV2 parse mode.
+	TelegramMarkdownV2 Dialect = "telegram_markdown_v2"
+	// WeComMarkdown is the markdown subset WeCom messages support.
+	WeComMarkdown Dialect = "wecom_markdown"
+	// Plain drops all markup.
+	Plain Dialect = "plain"
+)
+
+// Render converts Markdown to the dialect.
+func Render(md string, d Dialect) string {
+	return strings.Join(Split(md, d, 0), "")
+}
+
+// Split converts Markdown to the dialect and splits the result into parts of
+// at most maxLen runes. A maxLen of 0 means no limit.
+func Split(md string, d Dialect, maxLen int) []string {
+	st := styleFor(d)
+
+	var chunks []string
+	var cur strings.Builder
+	curLen := 0
+	flush := func() {
+		if strings.TrimSpace(cur.String()) != "" {
+			chunks = append(chunks, cur.String())
+		}
+		cur.Reset()
+		curLen = 0
+	}
+
+	for _, b := range parse(md) {
+		sep := "\n"
+		if b.spaced {
+			sep = "\n\n"
+		}
+		for _, piece := range st.pieces(b, maxLen) {
+			n := utf8.RuneCountInString(piece)
+			if curLen > 0 && maxLen > 0 && curLen+len(sep)+n > maxLen {
+				flush()
+			}
+			if curLen > 0 {
+				cur.WriteString(sep)
+				curLen += len(sep)
+			}
+			cur.WriteString(piece)
+			curLen += n
+			sep = "\n"
+		}
+	}
+	flush()
+	return chunks
+}
+
+// pieces renders a block as one or more parts of at most maxLen runes.
+func (st *style) pieces(b block, maxLen int) []string {
+	lines := inlineLines(b)
+	whole := st.renderBlock(b, lines)
+	if maxLen <= 0 || fits(whole, maxLen) {
+		return []string{whole}
+	}
+
+	switch b.kind {
+	case codeBlock:
+		return st.splitCode(b, maxLen)
+	case tableBlock:
+		return st.splitTable(b, maxLen)
+	case ruleBlock:
+		return nil
+	}
+
+	// Group lines into parts, breaking single lines that are too long.
+	var out []string
+	var group [][]node
+	render := func(g [][]node) string { return st.renderBlock(b, g) }
+	for _, line := range lines {
+		if len(group) > 0 && fits(render(append(group[:len(group):len(group)], line)), maxLen) {
+			group = append(group, line)
+			continue
+		}
+		if len(group) > 0 {
+			out = append(out, render(group))
+			group = nil
+		}
+		if fits(render([][]node{line}), maxLen) {
+			group = [][]node{line}
+			continue
+		}
+		parts := splitNodes(line, func(ns []node) bool {
+			return fits(render([][]node{ns}), maxLen)
+		})
+		for _, p := range parts {
+			out = append(out, render([][]node{p}))
+		}
+	}
+	if len(group) > 0 {
+		out = append(out, render(group))
+	}
+	return out
+}
+
+// splitCode splits a code block between lines, breaking lines that are too
+// long, and renders each part as a complete code block.
+func (st *style) splitCode(b block, maxLen int) []string {
+	render := func(lines []string) string {
+		part := b
+		part.lines = lines
+		return st.renderBlock(part, nil)
+	}
+	var out []string
+	var group []string
+	for _, line := range b.lines {
+		if fits(render(append(group[:len(group):len(group)], line)), maxLen) {
+			group = append(group, line)
+			continue
+		}
+		if len(group) > 0 {
+			out = append(out, render(group))
+			group = nil
+		}
+		for !fits(render([]string{line}), maxLen) {
+			n := longestFit(line, func(s string) bool { return fits(render([]string{s}), maxLen) })
+			if n == 0 {
+				out = append(out, hardSplit(render([]string{line}), maxLen)...)
+				line = ""
+				break
+			}
+			out = append(out, render([]string{line[:n]}))
+			line = line[n:]
+		}
+		if line != "" {
+			group = []string{line}
+		}
+	}
+	if len(group) > 0 {
+		out = append(out, render(group))
+	}
+	return out
+}
+
+// splitTable splits a table between rows, repeating the header row.
+func (st *style) splitTable(b block, maxLen int) []string {
+	render := func(rows [][]string) string {
+		part := b
+		part.rows = rows
+		return st.renderBlock(part, nil)
+	}
+	header := b.rows[0]
+	var out []string
+	group := [][]string{header}
+	for _, row := range b.rows[1:] {
+		next := append(group[:len(group):len(group)], row)
+		if fits(render(next), maxLen) {
+			group = next
+			continue
+		}
+		if len(group) > 1 {
+			out = append(out, render(group))
+		}
+		group = [][]string{header, row}
+		if !fits(render(group), maxLen) {
+			out = append(out, hardSplit(render(group), maxLen)...)
+			group = [][]string{header}
+		}
+	}
+	if len(group) > 1 {
+		out = append(out, render(group))
+	}
+	return out
+}
+
+// splitNodes splits inline nodes into parts that each satisfy ok, breaking
+// text between words and wrapping split parts of formatted text in the
+// same formatting.
+func splitNodes(nodes []node, ok func([]node) bool) [][]node {
+	var parts [][]node
+	var cur []node
+	for _, n := range nodes {
+		if next := append(cur[:len(cur):len(cur)], n); ok(next) {
+			cur = next
+			continue
+		}
+		if len(cur) > 0 {
+			parts = append(parts, trimParts(cur))
+			cur = nil
+		}
+		if ok([]node{n}) {
+			cur = []node{n}
+			continue
+		}
+		broken := breakNode(n, ok)
+		if len(broken) == 0 {
+			continue
+		}
+		parts = append(parts, broken[:len(broken)-1]...)
+		cur = broken[len(broken)-1]
+	}
+	if len(cur) > 0 {
+		parts = append(parts, trimParts(cur))
+	}
+	return parts
+}
+
+// breakNode splits a single node that does not satisfy ok on its own.
+func breakNode(n node, ok func([]node) bool) [][]node {
+	if n.kind != textNode && n.kind != codeNode {
+		wrapped := func(children []node) []node {
+			return []node{{kind: n.kind, url: n.url, children: children}}
+		}
+		var out [][]node
+		for _, children := range splitNodes(n.children, func(ns []node) bool { return ok(wrapped(ns)) }) {
+			out = append(out, wrapped(children))
+		}
+		return out
+	}
+
+	leaf := func(s string) []node { return []node{{kind: n.kind, text: s}} }
+	var out [][]node
+	text := n.text
+	for text != "" {
+		text = strings.TrimLeft(text, " ")
+		if ok(leaf(text)) {
+			out = append(out, leaf(text))
+			break
+		}
+		// Prefer the last space that still fits, else cut inside the word.
+		cut := longestFit(text, func(s string) bool { return ok(leaf(strings.TrimRight(s, " "))) })
+		if cut == 0 {
+			break
+		}
+		if sp := strings.LastIndexByte(text[:cut], ' '); sp > 0 && cut < len(text) && text[cut] != ' ' {
+			cut = sp
+		}
+		out = append(out, leaf(strings.TrimRight(text[:cut], " ")))
+		text = text[cut:]
+	}
+	return out
+}
+
+// trimParts drops the spaces at the edges of a part, which would otherwise
+// sit inside its formatting markers.
+func trimParts(nodes []node) []node {
+	if len(nodes) == 0 {
+		return nodes
+	}
+	nodes = append([]node(nil), nodes...)
+	if first := &nodes[0]; first.kind == textNode {
+		first.text = strings.TrimLeft(first.text, " ")
+	}
+	if last := &nodes[len(nodes)-1]; last.kind == textNode {
+		last.text = strings.TrimRight(last.text, " ")
+	}
+	return nodes
+}
+
+// longestFit returns the byte length of the longest prefix of s, ending on a
+// rune boundary, for which ok holds.
+func longestFit(s string, ok func(string) bool) int {
+	runes := []rune(s)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if ok(string(runes[:mid])) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return len(string(runes[:lo]))
+}
+
+// hardSplit cuts rendered text at maxLen runes. It is the last resort for
+// parts whose markup alone exceeds the limit.
+func hardSplit(s string, maxLen int) []string {
+	var out []string
+	runes := []rune(s)
+	for len(runes) > 0 {
+		n := min(len(runes), maxLen)
+		out = append(out, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return out
+}
+
+func fits(s string, maxLen int) bool {
+	return utf8.RuneCountInString(s) <= maxLen
+}
@@ -0,0 +1,123 @@
+package format
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const sample = "# Title\n\nSome **bold**, *italic*, ~~gone~~ and `a<b` with [docs](https://example.com/?a=1&b=2).\n\n- one\n- two_three\n\n```go\nif a < b {\n}\n```\n\n| Name | Qty |\n|---|--:|\n| **apple** | 3 |\n"
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{Markdown, "# Title\n\nSome **bold**, *italic*, ~~gone~~ and `a<b` with [docs](https://example.com/?a=1&b=2).\n\n- one\n- two_three\n\n```go\nif a < b {\n}\n```\n\n| Name | Qty |\n| --- | --- |\n| **apple** | 3 |"},
+		{Discord, "# Title\n\nSome **bold**, *italic*, ~~gone~~ and `a<b` with [docs](https://example.com/?a=1&b=2).\n\n- one\n- two_three\n\n```go\nif a < b {\n}\n```\n\n```\nName  | Qty\n------+----\napple | 3\n```"},
+		{FeishuMarkdown, "**Title**\n\nSome **bold**, *italic*, ~~gone~~ and `a<b` with [docs](https://example.com/?a=1&b=2).\n\n- one\n- two_three\n\n```go\nif a < b {\n}\n```\n\n```\nName  | Qty\n------+----\napple | 3\n```"},
+		{SlackMrkdwn, "*Title*\n\nSome *bold*, _italic_, ~gone~ and `a&lt;b` with <https://example.com/?a=1&b=2|docs>.\n\n• one\n• two_three\n\n```\nif a &lt; b {\n}\n```\n\n```\nName  | Qty\n------+----\napple | 3\n```"},
+		{TelegramHTML, "<b>Title</b>\n\nSome <b>bold</b>, <i>italic</i>, <s>gone</s> and <code>a&lt;b</code> with <a href=\"https://example.com/?a=1&amp;b=2\">docs</a>.\n\n• one\n• two_three\n\n<pre><code class=\"language-go\">if a &lt; b {\n}</code></pre>\n\n<pre>Name  | Qty\n------+----\napple | 3</pre>"},
+		{TelegramMarkdownV2, "*Title*\n\nSome *bold*, _italic_, ~gone~ and `a<b` with [docs](https://example.com/?a=1&b=2)\\.\n\n• one\n• two\\_three\n\n```go\nif a < b {\n}\n```\n\n```\nName  | Qty\n------+----\napple | 3\n```"},
+		{WeComMarkdown, "# Title\n\nSome **bold**, italic, gone and `a<b` with [docs](https://example.com/?a=1&b=2).\n\n• one\n• two_three\n\nif a < b {\n}\n\nName  | Qty\n------+----\napple | 3"},
+		{Plain, "Title\n\nSome bold, italic, gone and a<b with docs (https://example.com/?a=1&b=2).\n\n• one\n• two_three\n\nif a < b {\n}\n\nName  | Qty\n------+----\napple | 3"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.dialect), func(t *testing.T) {
+			if got := Render(sample, tt.dialect); got != tt.want {
+				t.Errorf("Render() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderFeishuLinksAndTags(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"[wiki](https://example.com/?q=(x)", "[wiki](https://example.com/?q=%28x)"},
+		{"[mail me](mailto:a@example.com)", "mail me (mailto:a@example.com)"},
+		{"a <at id=all></at> b", "a &lt;at id=all&gt;&lt;/at&gt; b"},
+		{"`<font>`", "`<font>`"},
+	}
+	for _, tt := range tests {
+		if got := Render(tt.in, FeishuMarkdown); got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"snake_case_name stays", "snake_case_name stays"},
+		{"2 * 3 * 4", "2 * 3 * 4"},
+		{"**unclosed bold", "**unclosed bold"},
+		{"**bold with *italic* inside**", "<b>bold with <i>italic</i> inside</b>"},
+		{"[**bold link**](http://x)", `<a href="http://x"><b>bold link</b></a>`},
+		{`\*not italic\*`, "*not italic*"},
+		{"`` a ` b ``", "<code>a ` b</code>"},
+		{"**a `**` b**", "<b>a <code>**</code> b</b>"},
+	}
+	for _, tt := range tests {
+		if got := Render(tt.in, TelegramHTML); got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitKeepsEntitiesWhole(t *testing.T) {
+	words := strings.Repeat("lorem ipsum dolor ", 40)
+	md := "intro\n\n**" + strings.TrimSpace(words) + "**\n\n```\n" + strings.Repeat("x := 1\n", 60) + "```"
+
+	for _, d := range []Dialect{Markdown, FeishuMarkdown, TelegramHTML, SlackMrkdwn, TelegramMarkdownV2} {
+		chunks := Split(md, d, 200)
+		if len(chunks) < 3 {
+			t.Fatalf("%s: got %d chunks", d, len(chunks))
+		}
+		for _, c := range chunks {
+			if n := utf8.RuneCountInString(c); n > 200 {
+				t.Errorf("%s: chunk of %d runes", d, n)
+			}
+			if strings.Count(c, "```")%2 != 0 {
+				t.Errorf("%s: unbalanced fence in %q", d, c)
+			}
+		}
+		if d == TelegramHTML {
+			for _, c := range chunks {
+				if strings.Count(c, "<b>") != strings.Count(c, "</b>") || strings.Count(c, "<pre>") != strings.Count(c, "</pre>") {
+					t.Errorf("unbalanced tags in %q", c)
+				}
+				if strings.Contains(c, " </b>") || strings.Contains(c, "<b> ") {
+					t.Errorf("space inside bold in %q", c)
+				}
+			}
+		}
+	}
+}
+
+func TestSplitTableRepeatsHeader(t *testing.T) {
+	md := "| a | b |\n|---|---|\n" + strings.Repeat("| 1 | 2 |\n", 30)
+	chunks := Split(md, Markdown, 100)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks", len(chunks))
+	}
+	for _, c := range chunks {
+		if !strings.HasPrefix(c, "| a | b |\n| --- | --- |") {
+			t.Errorf("chunk lacks header: %q", c)
+		}
+	}
+}
+
+func TestSplitPacksBlocks(t *testing.T) {
+	chunks := Split("one\n\ntwo\n\nthree", Plain, 100)
+	if len(chunks) != 1 || chunks[0] != "one\n\ntwo\n\nthree" {
+		t.Fatalf("Split() = %q", chunks)
+	}
+	if got := Split("  \n\n", Plain, 100); len(got) != 0 {
+		t.Fatalf("Split(blank) = %q", got)
+	}
+}
@@ -0,0 +1,326 @@
+package format
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	quoteBlock
+	listBlock
+	codeBlock
+	tableBlock
+	ruleBlock
+)
+
+// block is one block of a parsed Markdown document. Paragraphs, quotes and
+// list items keep their source lines, so a long block can be split between
+// lines and each part rendered on its own.
+type block struct {
+	kind   blockKind
+	level  int    // heading level, or list nesting depth
+	marker string // list marker: "" for bullets, "3." for ordered items
+	lang   string // code block language
+	lines  []string
+	rows   [][]string // table cells, header first
+	spaced bool       // preceded by a blank line
+}
+
+var (
+	reHeading   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	reFence     = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)")
+	reQuote     = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	reBullet    = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	reOrdered   = regexp.MustCompile(`^(\s*)(\d{1,9})[.)]\s+(.*)$`)
+	reRule      = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	reTableRule = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+// parse splits Markdown into blocks.
+func parse(md string) []block {
+	var blocks []block
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	spaced := false
+
+	add := func(b block) {
+		b.spaced = spaced && len(blocks) > 0
+		spaced = false
+		blocks = append(blocks, b)
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" {
+			spaced = true
+			continue
+		}
+
+		if m := reFence.FindStringSubmatch(line); m != nil {
+			fence := m[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			add(block{kind: codeBlock, lang: m[2], lines: code})
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && reTableRule.MatchString(lines[i+1]) {
+			rows := [][]string{tableCells(trimmed)}
+			for i += 2; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, tableCells(strings.TrimSpace(lines[i])))
+			}
+			i--
+			add(block{kind: tableBlock, rows: rows})
+			continue
+		}
+
+		if m := reHeading.FindStringSubmatch(trimmed); m != nil {
+			add(block{kind: headingBlock, level: len(m[1]), lines: []string{m[2]}})
+			continue
+		}
+
+		if reRule.MatchString(line) {
+			add(block{kind: ruleBlock})
+			continue
+		}
+
+		if reQuote.MatchString(line) {
+			var quote []string
+			for ; i < len(lines); i++ {
+				m := reQuote.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				quote = append(quote, m[1])
+			}
+			i--
+			add(block{kind: quoteBlock, lines: quote})
+			continue
+		}
+
+		if m := reBullet.FindStringSubmatch(line); m != nil {
+			add(block{kind: listBlock, level: indentLevel(m[1]), lines: []string{m[2]}})
+			continue
+		}
+		if m := reOrdered.FindStringSubmatch(line); m != nil {
+			add(block{kind: listBlock, level: indentLevel(m[1]), marker: m[2] + ".", lines: []string{m[3]}})
+			continue
+		}
+
+		// Consecutive plain lines form one paragraph; line breaks are kept
+		// since chat messages show them as typed.
+		if n := len(blocks); n > 0 && !spaced && blocks[n-1].kind == paragraphBlock {
+			blocks[n-1].lines = append(blocks[n-1].lines, line)
+			continue
+		}
+		add(block{kind: paragraphBlock, lines: []string{line}})
+	}
+	return blocks
+}
+
+func indentLevel(indent string) int {
+	n := utf8.RuneCountInString(strings.ReplaceAll(indent, "\t", "    "))
+	return n / 2
+}
+
+func tableCells(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	cells := strings.Split(line, "|")
+	for i, c := range cells {
+		cells[i] = strings.TrimSpace(c)
+	}
+	return cells
+}
+
+type nodeKind int
+
+const (
+	textNode nodeKind = iota
+	boldNode
+	italicNode
+	strikeNode
+	codeNode
+	linkNode
+)
+
+// node is an inline element. Text and code nodes carry text; the others
+// wrap children.
+type node struct {
+	kind     nodeKind
+	text     string
+	url      string
+	children []node
+}
+
+// parseInline parses the inline markup of one line. Delimiters without a
+// matching closer are kept as text.
+func parseInline(s string) []node {
+	var out []node
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			out = append(out, node{kind: textNode, text: text.String()})
+			text.Reset()
+		}
+	}
+	emit := func(n node) {
+		flush()
+		out = append(out, n)
+	}
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune(`\*_~[]()#+-.!|>`+"`", rune(rest[1])):
+			text.WriteByte(rest[1])
+			i += 2
+			continue
+
+		case rest[0] == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			delim := rest[:ticks]
+			if end := strings.Index(rest[ticks:], delim); end >= 0 {
+				code := rest[ticks : ticks+end]
+				if strings.TrimSpace(code) != "" && len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				emit(node{kind: codeNode, text: code})
+				i += 2*ticks + end
+				continue
+			}
+			text.WriteString(delim)
+			i += ticks
+			continue
+
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if inner, n, ok := delimited(s, i, rest[:2]); ok {
+				emit(node{kind: boldNode, children: parseInline(inner)})
+				i += n
+				continue
+			}
+
+		case strings.HasPrefix(rest, "~~"):
+			if inner, n, ok := delimited(s, i, "~~"); ok {
+				emit(node{kind: strikeNode, children: parseInline(inner)})
+				i += n
+				continue
+			}
+
+		case rest[0] == '*' || rest[0] == '_':
+			if inner, n, ok := delimited(s, i, rest[:1]); ok {
+				emit(node{kind: italicNode, children: parseInline(inner)})
+				i += n
+				continue
+			}
+
+		case rest[0] == '[':
+			if label, url, n, ok := link(rest); ok {
+				emit(node{kind: linkNode, url: url, children: parseInline(label)})
+				i += n
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		text.WriteString(rest[:size])
+		i += size
+	}
+	flush()
+	return out
+}
+
+// delimited finds the closer of the emphasis delimiter at s[i:]. It returns
+// the enclosed text and the length consumed, including both delimiters.
+func delimited(s string, i int, delim string) (string, int, bool) {
+	start := i + len(delim)
+	if start >= len(s) || isSpace(s[start]) {
+		return "", 0, false
+	}
+	// Underscores inside words ("snake_case") are not emphasis.
+	if delim[0] == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", 0, false
+	}
+	for j := start + 1; j+len(delim) <= len(s); j++ {
+		if s[j] == '`' {
+			// Skip code spans so their content can't close the emphasis.
+			if end := strings.IndexByte(s[j+1:], '`'); end >= 0 {
+				j += end + 1
+				continue
+			}
+		}
+		if !strings.HasPrefix(s[j:], delim) || isSpace(s[j-1]) {
+			continue
+		}
+		after := j + len(delim)
+		// A single delimiter must not be half of a double one.
+		if len(delim) == 1 && after < len(s) && s[after] == delim[0] {
+			j++
+			continue
+		}
+		if delim[0] == '_' && after < len(s) && isWordByte(s[after]) {
+			continue
+		}
+		return s[start:j], after - i, true
+	}
+	return "", 0, false
+}
+
+// link parses "[label](url)" at the start of s.
+func link(s string) (label, url string, n int, ok bool) {
+	depth := 0
+	for j := 0; j < len(s); j++ {
+		switch s[j] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if j+1 >= len(s) || s[j+1] != '(' {
+				return "", "", 0, false
+			}
+			end := strings.IndexByte(s[j+2:], ')')
+			if end < 0 {
+				return "", "", 0, false
+			}
+			url = strings.TrimSpace(s[j+2 : j+2+end])
+			if url == "" || strings.ContainsAny(url, " \n") {
+				return "", "", 0, false
+			}
+			return s[1:j], url, j + 3 + end, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n'
+}
+
+func isWordByte(b byte) bool {
+	return b >= utf8.RuneSelf || b == '_' || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// plainText returns the text of inline nodes without markup.
+func plainText(nodes []node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		if n.kind == textNode || n.kind == codeNode {
+			b.WriteString(n.text)
+		} else {
+			b.WriteString(plainText(n.children))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,400 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// style describes how one dialect writes each Markdown element. Inline
+// wrappers are open/close pairs; an empty pair drops the formatting.
+type style struct {
+	escape    func(string) string // plain text
+	code      func(string) string // inline code
+	bold      [2]string
+	italic    [2]string
+	strike    [2]string
+	link      func(label, url string) string // label is already rendered
+	heading   func(level int, text string) string
+	quote     func(lines []string) string
+	listItem  func(indent, marker, text string) string
+	codeBlock func(lang string, lines []string) string
+	table     func(st *style, rows [][]string) string // nil renders an aligned code block
+	rule      string
+}
+
+func identity(s string) string { return s }
+
+var markdownStyle = style{
+	escape: identity,
+	code:   markdownCode,
+	bold:   [2]string{"**", "**"},
+	italic: [2]string{"*", "*"},
+	strike: [2]string{"~~", "~~"},
+	link: func(label, url string) string {
+		return "[" + label + "](" + url + ")"
+	},
+	heading: func(level int, text string) string {
+		return strings.Repeat("#", level) + " " + text
+	},
+	quote:     prefixLines("> "),
+	listItem:  markdownListItem,
+	codeBlock: fencedCode(identity),
+	table:     markdownTable,
+	rule:      "---",
+}
+
+var discordStyle = func() style {
+	st := markdownStyle
+	// Discord renders only three heading levels and no tables.
+	st.heading = func(level int, text string) string {
+		if level > 3 {
+			return "**" + text + "**"
+		}
+		return strings.Repeat("#", level) + " " + text
+	}
+	st.table = nil
+	return st
+}()
+
+// Feishu card markdown reads <...> in text as tags such as <at> and <font>,
+// links only http(s) URLs, and does not render headings or tables on every
+// client.
+var feishuStyle = func() style {
+	st := markdownStyle
+	st.escape = feishuEscape
+	st.link = func(label, url string) string {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			if label == feishuEscape(url) {
+				return label
+			}
+			return label + " (" + feishuEscape(url) + ")"
+		}
+		return "[" + label + "](" + strings.NewReplacer("(", "%28", ")", "%29").Replace(url) + ")"
+	}
+	st.heading = func(_ int, text string) string {
+		return "**" + text + "**"
+	}
+	st.table = nil
+	return st
+}()
+
+var slackStyle = style{
+	escape: slackEscape,
+	code: func(s string) string {
+		return "`" + slackEscape(s) + "`"
+	},
+	bold:   [2]string{"*", "*"},
+	italic: [2]string{"_", "_"},
+	strike: [2]string{"~", "~"},
+	link: func(label, url string) string {
+		if label == slackEscape(url) {
+			return "<" + url + ">"
+		}
+		return "<" + url + "|" + strings.ReplaceAll(label, "|", "¦") + ">"
+	},
+	heading: func(_ int, text string) string {
+		return "*" + text + "*"
+	},
+	quote:    prefixLines("> "),
+	listItem: bulletListItem,
+	codeBlock: func(_ string, lines []string) string {
+		return "```\n" + slackEscape(strings.Join(lines, "\n")) + "\n```"
+	},
+	rule: "───────────",
+}
+
+var telegramHTMLStyle = style{
+	escape: htmlEscape,
+	code: func(s string) string {
+		return "<code>" + htmlEscape(s) + "</code>"
+	},
+	bold:   [2]string{"<b>", "</b>"},
+	italic: [2]string{"<i>", "</i>"},
+	strike: [2]string{"<s>", "</s>"},
+	link: func(label, url string) string {
+		return `<a href="` + htmlEscape(url) + `">` + label + "</a>"
+	},
+	heading: func(_ int, text string) string {
+		return "<b>" + text + "</b>"
+	},
+	quote: func(lines []string) string {
+		return "<blockquote>" + strings.Join(lines, "\n") + "</blockquote>"
+	},
+	listItem: bulletListItem,
+	codeBlock: func(lang string, lines []string) string {
+		code := htmlEscape(strings.Join(lines, "\n"))
+		if lang != "" {
+			return `<pre><code class="language-` + htmlEscape(lang) + `">` + code + "</code></pre>"
+		}
+		return "<pre>" + code + "</pre>"
+	},
+	rule: "———",
+}
+
+var telegramMarkdownV2Style = style{
+	escape: markdownV2Escape,
+	code: func(s string) string {
+		return "`" + markdownV2CodeEscape(s) + "`"
+	},
+	bold:   [2]string{"*", "*"},
+	italic: [2]string{"_", "_"},
+	strike: [2]string{"~", "~"},
+	link: func(label, url string) string {
+		return "[" + label + "](" + strings.NewReplacer(`\`, `\\`, ")", `\)`).Replace(url) + ")"
+	},
+	heading: func(_ int, text string) string {
+		return "*" + text + "*"
+	},
+	quote: prefixLines(">"),
+	listItem: func(indent, marker, text string) string {
+		return bulletListItem(indent, markdownV2Escape(marker), text)
+	},
+	codeBlock: func(lang string, lines []string) string {
+		return "```" + lang + "\n" + markdownV2CodeEscape(strings.Join(lines, "\n")) + "\n```"
+	},
+	rule: "———",
+}
+
+// WeCom's markdown supports headings, bold, links, inline code and quotes.
+var weComStyle = style{
+	escape: identity,
+	code:   markdownCode,
+	bold:   [2]string{"**", "**"},
+	link: func(label, url string) string {
+		return "[" + label + "](" + url + ")"
+	},
+	heading: func(level int, text string) string {
+		return strings.Repeat("#", level) + " " + text
+	},
+	quote:     prefixLines("> "),
+	listItem:  bulletListItem,
+	codeBlock: plainCode,
+	rule:      "───────────",
+}
+
+var plainStyle = style{
+	escape: identity,
+	code:   identity,
+	link: func(label, url string) string {
+		if label == url {
+			return url
+		}
+		return label + " (" + url + ")"
+	},
+	heading: func(_ int, text string) string {
+		return text
+	},
+	quote:     prefixLines("> "),
+	listItem:  bulletListItem,
+	codeBlock: plainCode,
+	rule:      "───────────",
+}
+
+func styleFor(d Dialect) *style {
+	switch d {
+	case Discord:
+		return &discordStyle
+	case FeishuMarkdown:
+		return &feishuStyle
+	case SlackMrkdwn:
+		return &slackStyle
+	case TelegramHTML:
+		return &telegramHTMLStyle
+	case TelegramMarkdownV2:
+		return &telegramMarkdownV2Style
+	case WeComMarkdown:
+		return &weComStyle
+	case Plain:
+		return &plainStyle
+	default:
+		return &markdownStyle
+	}
+}
+
+// renderInline renders inline nodes.
+func (st *style) renderInline(nodes []node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.kind {
+		case textNode:
+			b.WriteString(st.escape(n.text))
+		case codeNode:
+			b.WriteString(st.code(n.text))
+		case boldNode:
+			b.WriteString(st.bold[0] + st.renderInline(n.children) + st.bold[1])
+		case italicNode:
+			b.WriteString(st.italic[0] + st.renderInline(n.children) + st.italic[1])
+		case strikeNode:
+			b.WriteString(st.strike[0] + st.renderInline(n.children) + st.strike[1])
+		case linkNode:
+			b.WriteString(st.link(st.renderInline(n.children), n.url))
+		}
+	}
+	return b.String()
+}
+
+// renderBlock renders a block. Inline content comes from lines, one entry
+// per source line, so split parts of a block can be rendered alike.
+func (st *style) renderBlock(b block, lines [][]node) string {
+	switch b.kind {
+	case codeBlock:
+		return st.codeBlock(b.lang, b.lines)
+	case tableBlock:
+		if st.table != nil {
+			return st.table(st, b.rows)
+		}
+		return st.codeBlock("", alignTable(b.rows))
+	case ruleBlock:
+		return st.rule
+	}
+
+	rendered := make([]string, len(lines))
+	for i, l := range lines {
+		rendered[i] = st.renderInline(l)
+	}
+	switch b.kind {
+	case headingBlock:
+		return st.heading(b.level, strings.Join(rendered, " "))
+	case quoteBlock:
+		return st.quote(rendered)
+	case listBlock:
+		return st.listItem(strings.Repeat("  ", b.level), b.marker, strings.Join(rendered, " "))
+	default:
+		return strings.Join(rendered, "\n")
+	}
+}
+
+func inlineLines(b block) [][]node {
+	lines := make([][]node, len(b.lines))
+	for i, l := range b.lines {
+		lines[i] = parseInline(l)
+	}
+	return lines
+}
+
+func prefixLines(prefix string) func([]string) string {
+	return func(lines []string) string {
+		out := make([]string, len(lines))
+		for i, l := range lines {
+			out[i] = prefix + l
+		}
+		return strings.Join(out, "\n")
+	}
+}
+
+func markdownListItem(indent, marker, text string) string {
+	if marker == "" {
+		marker = "-"
+	}
+	return indent + marker + " " + text
+}
+
+func bulletListItem(indent, marker, text string) string {
+	if marker == "" {
+		marker = "•"
+	}
+	return indent + marker + " " + text
+}
+
+// markdownCode wraps s in enough backticks that it can contain backticks.
+func markdownCode(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+func fencedCode(escape func(string) string) func(string, []string) string {
+	return func(lang string, lines []string) string {
+		code := escape(strings.Join(lines, "\n"))
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + lang + "\n" + code + "\n" + fence
+	}
+}
+
+func plainCode(_ string, lines []string) string {
+	return strings.Join(lines, "\n")
+}
+
+func markdownTable(st *style, rows [][]string) string {
+	out := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cells[j] = strings.ReplaceAll(st.renderInline(parseInline(cell)), "|", `\|`)
+		}
+		out = append(out, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			out = append(out, "|"+strings.Repeat(" --- |", len(row)))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// alignTable lays a table out in monospace columns, using the plain text
+// of each cell.
+func alignTable(rows [][]string) []string {
+	text := make([][]string, len(rows))
+	var widths []int
+	for r, row := range rows {
+		text[r] = make([]string, len(row))
+		for i, cell := range row {
+			text[r][i] = plainText(parseInline(cell))
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(text[r][i]))
+		}
+	}
+	out := make([]string, 0, len(rows)+1)
+	for r, row := range text {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = cell + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		}
+		out = append(out, strings.TrimRight(strings.Join(cells, " | "), " "))
+		if r == 0 {
+			sep := make([]string, len(widths))
+			for i, w := range widths {
+				sep[i] = strings.Repeat("-", w)
+			}
+			out = append(out, strings.Join(sep, "-+-"))
+		}
+	}
+	return out
+}
+
+func htmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
+
+func feishuEscape(s string) string {
+	return strings.NewReplacer("<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// markdownV2Escape escapes the characters Telegram's MarkdownV2 reserves.
+func markdownV2Escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("_*[]()~`>#+-=|{}.!\\", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func markdownV2CodeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(s)
+}
@@ -1,6 +1,10 @@
 package channels
 
-import "context"
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
 
 // TypingCapable — channels that can show a typing/thinking indicator.
 // StartTyping begins the indicator and returns a stop function.
@@ -15,6 +19,14 @@ type MessageEditor interface {
 	EditMessage(ctx context.Context, chatID string, messageID string, content string) error
 }
 
+// ButtonCapable — channels that render OutboundMessage.Buttons natively.
+// EditMessageButtons replaces the content and buttons of an existing message,
+// so a placeholder can become a reply that offers choices. Manager lists the
+// choices in the message text for channels that don't implement it.
+type ButtonCapable interface {
+	EditMessageButtons(ctx context.Context, chatID, messageID, content string, buttons [][]bus.Button) error
+}
+
 // ReactionCapable — channels that can add a reaction (e.g. 👀) to an inbound message.
 // ReactToMessage adds a reaction and returns an undo function to remove it.
 // The undo function MUST be idempotent and safe to call multiple times.
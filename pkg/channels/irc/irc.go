@@ -0,0 +1,604 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	maxMessageLength = 2000
+	pingInterval     = 2 * time.Minute
+	registerTimeout  = time.Minute
+	writeTimeout     = 30 * time.Second
+	// assumedMaskLen stands in for the "user@host" the server adds to our
+	// relayed lines until our own JOIN shows the real one.
+	assumedMaskLen = 10 + 1 + 63
+)
+
+var (
+	minRetryDelay = 2 * time.Second
+	maxRetryDelay = 2 * time.Minute
+)
+
+// IRCChannel implements the Channel interface for IRC. Channel messages use
+// the channel name as chat ID; private messages use the sender's nick.
+type IRCChannel struct {
+	*channels.BaseChannel
+	config  config.IRCConfig
+	limiter *rate.Limiter // flood control for outgoing lines
+
+	mu   sync.Mutex
+	conn net.Conn // registered connection, nil while disconnected
+	nick string
+	mask string // our "user@host" as other clients see it
+
+	writeMu sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewIRCChannel creates a new IRC channel instance.
+func NewIRCChannel(cfg config.IRCConfig, messageBus *bus.MessageBus) (*IRCChannel, error) {
+	if cfg.Server == "" || cfg.Nick == "" {
+		return nil, fmt.Errorf("irc server and nick are required")
+	}
+	switch strings.ToUpper(cfg.SASLMechanism) {
+	case "", "PLAIN", "EXTERNAL":
+	default:
+		return nil, fmt.Errorf("irc sasl_mechanism must be PLAIN or EXTERNAL, got %q", cfg.SASLMechanism)
+	}
+	if cfg.FloodBurst <= 0 {
+		cfg.FloodBurst = 5
+	}
+	if cfg.FloodDelay <= 0 {
+		cfg.FloodDelay = 2000
+	}
+
+	base := channels.NewBaseChannel("irc", cfg, messageBus, cfg.AllowFrom,
+		channels.WithMaxMessageLength(maxMessageLength),
+		channels.WithTextFormat(format.Plain),
+		channels.WithGroupTrigger(cfg.GroupTrigger),
+		channels.WithReasoningChannelID(cfg.ReasoningChannelID),
+	)
+
+	return &IRCChannel{
+		BaseChannel: base,
+		config:      cfg,
+		limiter:     rate.NewLimiter(rate.Every(time.Duration(cfg.FloodDelay)*time.Millisecond), cfg.FloodBurst),
+	}, nil
+}
+
+// SendRate implements channels.SendRateProvider, so the Manager queues
+// messages at the pace the flood control lets lines out.
+func (c *IRCChannel) SendRate() (float64, int) {
+	return 1000 / float64(c.config.FloodDelay), c.config.FloodBurst
+}
+
+// Start connects to the server in the background, reconnecting with backoff
+// whenever the connection drops.
+func (c *IRCChannel) Start(ctx context.Context) error {
+	logger.InfoC("irc", "Starting IRC channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	go c.connectLoop()
+
+	c.SetRunning(true)
+	logger.InfoCF("irc", "IRC channel started", map[string]any{
+		"server": c.config.Server,
+		"nick":   c.config.Nick,
+	})
+	return nil
+}
+
+// Stop quits and closes the connection.
+func (c *IRCChannel) Stop(ctx context.Context) error {
+	logger.InfoC("irc", "Stopping IRC channel")
+
+	if conn, _, _ := c.current(); conn != nil {
+		c.writeLine(conn, "QUIT :Shutting down")
+	}
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.done != nil {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+		}
+	}
+
+	c.SetRunning(false)
+	logger.InfoC("irc", "IRC channel stopped")
+	return nil
+}
+
+// Send delivers msg.Content to msg.ChatID as PRIVMSG lines, split to fit the
+// protocol line limit and paced by flood control.
+func (c *IRCChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+	if msg.ChatID == "" || strings.ContainsAny(msg.ChatID, " ,\r\n") {
+		return fmt.Errorf("irc: invalid target %q: %w", msg.ChatID, channels.ErrSendFailed)
+	}
+	conn, nick, mask := c.current()
+	if conn == nil {
+		return fmt.Errorf("irc: not connected: %w", channels.ErrTemporary)
+	}
+
+	command := "PRIVMSG " + msg.ChatID + " :"
+	maskLen := len(mask)
+	if maskLen == 0 {
+		maskLen = assumedMaskLen
+	}
+	limit := maxLineBytes - len("\r\n") - len(":"+nick+"!"+" ") - maskLen - len(command)
+
+	for _, line := range splitLines(msg.Content, limit) {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		if err := c.writeLine(conn, command+line); err != nil {
+			return channels.ClassifyNetError(err)
+		}
+	}
+	return nil
+}
+
+// current returns the registered connection with our nick and mask.
+func (c *IRCChannel) current() (net.Conn, string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn, c.nick, c.mask
+}
+
+// writeLine sends one protocol line. Line breaks are removed so text cannot
+// inject commands, and the line is cut to the protocol limit.
+func (c *IRCChannel) writeLine(conn net.Conn, line string) error {
+	line = strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == 0 {
+			return ' '
+		}
+		return r
+	}, line)
+	if len(line) > maxLineBytes-2 {
+		line = line[:maxLineBytes-2]
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// connectLoop keeps a session open until the channel stops.
+func (c *IRCChannel) connectLoop() {
+	defer close(c.done)
+
+	delay := minRetryDelay
+	for {
+		started := time.Now()
+		err := c.session()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > maxRetryDelay {
+			delay = minRetryDelay
+		}
+		logger.WarnCF("irc", "Disconnected, reconnecting", map[string]any{
+			"server": c.config.Server,
+			"error":  err.Error(),
+			"retry":  delay.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+func (c *IRCChannel) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: time.Minute}
+	if !c.config.TLS {
+		return dialer.DialContext(c.ctx, "tcp", c.config.Server)
+	}
+
+	host, _, err := net.SplitHostPort(c.config.Server)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if c.config.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.config.TLSCertFile, c.config.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+	return tlsDialer.DialContext(c.ctx, "tcp", c.config.Server)
+}
+
+// session is the state of one connection.
+type session struct {
+	conn       net.Conn
+	nick       string
+	registered bool
+	caps       []string // capabilities advertised so far
+	loggedIn   bool     // SASL succeeded
+	lastRead   atomic.Int64
+}
+
+// session connects, registers and processes server lines until the
+// connection fails.
+func (c *IRCChannel) session() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(c.ctx, func() { conn.Close() })
+	defer stop()
+
+	s := &session{conn: conn, nick: c.config.Nick}
+	s.lastRead.Store(time.Now().UnixNano())
+	defer c.setConnection(nil, "")
+
+	username := c.config.Username
+	if username == "" {
+		username = c.config.Nick
+	}
+	realName := c.config.RealName
+	if realName == "" {
+		realName = "picoclaw"
+	}
+	c.writeLine(conn, "CAP LS 302")
+	if c.config.Password != "" {
+		c.writeLine(conn, "PASS "+c.config.Password)
+	}
+	c.writeLine(conn, "NICK "+s.nick)
+	c.writeLine(conn, "USER "+username+" 0 * :"+realName)
+
+	watchdogDone := make(chan struct{})
+	defer close(watchdogDone)
+	go c.watchdog(s, watchdogDone)
+
+	reader := bufio.NewReaderSize(conn, 16<<10)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return c.ctx.Err()
+			}
+			return err
+		}
+		s.lastRead.Store(time.Now().UnixNano())
+		if msg, ok := parseMessage(line); ok {
+			c.handle(s, msg)
+		}
+	}
+}
+
+// watchdog pings an idle server and drops connections that stop answering
+// or fail to register.
+func (c *IRCChannel) watchdog(s *session, done <-chan struct{}) {
+	ticker := time.NewTicker(pingInterval / 4)
+	defer ticker.Stop()
+	started := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		registered := s.registered
+		c.mu.Unlock()
+		if !registered && time.Since(started) > registerTimeout {
+			logger.WarnC("irc", "Registration timed out")
+			s.conn.Close()
+			return
+		}
+		idle := time.Since(time.Unix(0, s.lastRead.Load()))
+		switch {
+		case idle > 2*pingInterval:
+			s.conn.Close()
+			return
+		case idle > pingInterval:
+			c.writeLine(s.conn, "PING :picoclaw")
+		}
+	}
+}
+
+func (c *IRCChannel) setConnection(conn net.Conn, nick string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn = conn
+	c.nick = nick
+	if conn == nil {
+		c.mask = ""
+	}
+}
+
+func (c *IRCChannel) handle(s *session, msg message) {
+	switch msg.command {
+	case "PING":
+		c.writeLine(s.conn, "PONG :"+msg.param(0))
+
+	case "CAP":
+		c.handleCap(s, msg)
+
+	case "AUTHENTICATE":
+		if msg.param(0) == "+" {
+			c.authenticate(s)
+		}
+
+	case "903": // RPL_SASLSUCCESS
+		s.loggedIn = true
+		logger.InfoC("irc", "SASL authentication succeeded")
+		c.writeLine(s.conn, "CAP END")
+
+	case "902", "904", "905", "906", "908": // SASL failures
+		logger.WarnCF("irc", "SASL authentication failed", map[string]any{
+			"reply":   msg.command,
+			"message": msg.param(len(msg.params) - 1),
+		})
+		c.writeLine(s.conn, "CAP END")
+
+	case "001": // RPL_WELCOME
+		c.registered(s, msg.param(0))
+
+	case "432", "433": // ERR_ERRONEUSNICKNAME, ERR_NICKNAMEINUSE
+		c.mu.Lock()
+		registered := s.registered
+		c.mu.Unlock()
+		if !registered {
+			s.nick += "_"
+			c.writeLine(s.conn, "NICK "+s.nick)
+		}
+
+	case "NICK":
+		if strings.EqualFold(msg.nick(), s.nick) {
+			s.nick = msg.param(0)
+			c.mu.Lock()
+			c.nick = s.nick
+			c.mu.Unlock()
+		}
+
+	case "JOIN":
+		if strings.EqualFold(msg.nick(), s.nick) {
+			if _, mask, ok := strings.Cut(msg.prefix, "!"); ok {
+				c.mu.Lock()
+				c.mask = mask
+				c.mu.Unlock()
+			}
+			logger.InfoCF("irc", "Joined channel", map[string]any{
+				"channel": msg.param(0),
+			})
+		}
+
+	case "KICK":
+		if strings.EqualFold(msg.param(1), s.nick) {
+			logger.WarnCF("irc", "Kicked from channel", map[string]any{
+				"channel": msg.param(0),
+				"by":      msg.nick(),
+				"reason":  msg.param(2),
+			})
+		}
+
+	case "ERROR":
+		logger.WarnCF("irc", "Server closed the connection", map[string]any{
+			"message": msg.param(0),
+		})
+
+	case "PRIVMSG":
+		c.handlePrivmsg(s, msg)
+	}
+}
+
+// handleCap negotiates the sasl and message-tags capabilities.
+func (c *IRCChannel) handleCap(s *session, msg message) {
+	switch strings.ToUpper(msg.param(1)) {
+	case "LS":
+		// CAP * LS * :caps... marks a continued list.
+		more := len(msg.params) > 3 && msg.param(2) == "*"
+		s.caps = append(s.caps, strings.Fields(msg.param(len(msg.params)-1))...)
+		if more {
+			return
+		}
+		var want []string
+		for _, capability := range s.caps {
+			name, _, _ := strings.Cut(capability, "=")
+			switch {
+			case name == "sasl" && c.config.SASLMechanism != "":
+				want = append(want, name)
+			case name == "message-tags":
+				want = append(want, name)
+			}
+		}
+		if c.config.SASLMechanism != "" && !slices.Contains(want, "sasl") {
+			logger.WarnC("irc", "Server does not support SASL")
+		}
+		if len(want) == 0 {
+			c.writeLine(s.conn, "CAP END")
+			return
+		}
+		c.writeLine(s.conn, "CAP REQ :"+strings.Join(want, " "))
+
+	case "ACK":
+		if slices.Contains(strings.Fields(msg.param(len(msg.params)-1)), "sasl") {
+			c.writeLine(s.conn, "AUTHENTICATE "+strings.ToUpper(c.config.SASLMechanism))
+			return
+		}
+		c.writeLine(s.conn, "CAP END")
+
+	case "NAK":
+		c.writeLine(s.conn, "CAP END")
+	}
+}
+
+// authenticate answers the server's AUTHENTICATE challenge, splitting the
+// PLAIN payload into 400-byte chunks as the protocol requires.
+func (c *IRCChannel) authenticate(s *session) {
+	if strings.EqualFold(c.config.SASLMechanism, "EXTERNAL") {
+		c.writeLine(s.conn, "AUTHENTICATE +")
+		return
+	}
+	user := c.config.SASLUsername
+	if user == "" {
+		user = c.config.Nick
+	}
+	payload := base64.StdEncoding.EncodeToString([]byte(user + "\x00" + user + "\x00" + c.config.SASLPassword))
+	for len(payload) >= 400 {
+		c.writeLine(s.conn, "AUTHENTICATE "+payload[:400])
+		payload = payload[400:]
+	}
+	if payload == "" {
+		payload = "+"
+	}
+	c.writeLine(s.conn, "AUTHENTICATE "+payload)
+}
+
+// registered runs once the server accepts the connection: it identifies
+// with NickServ if SASL did not log in, then joins the configured channels.
+func (c *IRCChannel) registered(s *session, nick string) {
+	c.mu.Lock()
+	s.registered = true
+	c.mu.Unlock()
+	if nick != "" {
+		s.nick = nick
+	}
+	c.setConnection(s.conn, s.nick)
+	logger.InfoCF("irc", "Connected", map[string]any{
+		"server": c.config.Server,
+		"nick":   s.nick,
+	})
+
+	if !s.loggedIn && c.config.NickServPassword != "" {
+		account := c.config.SASLUsername
+		if account == "" {
+			account = c.config.Nick
+		}
+		c.writeLine(s.conn, "PRIVMSG NickServ :IDENTIFY "+account+" "+c.config.NickServPassword)
+	}
+
+	for _, entry := range c.config.Channels {
+		if fields := strings.Fields(entry); len(fields) > 0 {
+			c.writeLine(s.conn, "JOIN "+strings.Join(fields[:min(len(fields), 2)], " "))
+		}
+	}
+}
+
+func (c *IRCChannel) handlePrivmsg(s *session, msg message) {
+	target, text, nick := msg.param(0), msg.param(1), msg.nick()
+	if nick == "" || target == "" || strings.EqualFold(nick, s.nick) {
+		return
+	}
+	if command, arg, ok := ctcp(text); ok {
+		// Only /me actions are conversation; VERSION, PING and the like
+		// are left unanswered.
+		if command != "ACTION" {
+			return
+		}
+		text = "* " + arg
+	}
+	text = strings.TrimSpace(stripFormatting(text))
+
+	sender := bus.SenderInfo{
+		Platform:    "irc",
+		PlatformID:  nick,
+		CanonicalID: identity.BuildCanonicalID("irc", nick),
+		Username:    nick,
+		DisplayName: nick,
+	}
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("irc", "Message rejected by allowlist", map[string]any{
+			"sender": nick,
+		})
+		return
+	}
+
+	chatID := nick
+	peer := bus.Peer{Kind: "direct", ID: nick}
+	if isChannelName(target) {
+		chatID = target
+		peer = bus.Peer{Kind: "group", ID: target}
+		mentioned, content := addressed(text, s.nick)
+		respond, cleaned := c.ShouldRespondInGroup(mentioned, content)
+		if !respond {
+			return
+		}
+		text = cleaned
+	}
+	if text == "" {
+		return
+	}
+
+	metadata := map[string]string{
+		"platform": "irc",
+		"hostmask": msg.prefix,
+	}
+
+	logger.DebugCF("irc", "Received message", map[string]any{
+		"sender_id": nick,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(text, 50),
+	})
+
+	c.HandleMessage(c.ctx, peer, msg.msgID, nick, chatID, text, nil, metadata, sender)
+}
+
+func isChannelName(target string) bool {
+	return target != "" && strings.ContainsRune("#&+!", rune(target[0]))
+}
+
+// addressed reports whether text mentions nick. A leading "nick:" or
+// "nick," address is removed from the returned text.
+func addressed(text, nick string) (bool, string) {
+	if nick == "" {
+		return false, text
+	}
+	if len(text) > len(nick) && strings.EqualFold(text[:len(nick)], nick) &&
+		strings.ContainsRune(":,", rune(text[len(nick)])) {
+		return true, strings.TrimSpace(text[len(nick)+1:])
+	}
+	lower, lowerNick := strings.ToLower(text), strings.ToLower(nick)
+	for i := 0; ; {
+		idx := strings.Index(lower[i:], lowerNick)
+		if idx < 0 {
+			return false, text
+		}
+		start, end := i+idx, i+idx+len(lowerNick)
+		if (start == 0 || !isNickChar(lower[start-1])) && (end == len(lower) || !isNickChar(lower[end])) {
+			return true, text
+		}
+		i = start + 1
+	}
+}
+
+func isNickChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || strings.IndexByte("[]\\`_^{|}-", c) >= 0
+}
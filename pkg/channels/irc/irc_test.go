@@ -0,0 +1,353 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/bus/bustest"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeServer is an in-process stand-in for an IRC server. It registers
+// clients (with SASL PLAIN when sasl is set), echoes JOINs and records every
+// line it receives.
+type fakeServer struct {
+	t        *testing.T
+	ln       net.Listener
+	sasl     bool
+	nickUsed string // first NICK attempt with this name gets 433
+
+	mu    sync.Mutex
+	lines []string
+	conns []net.Conn
+	conn  chan net.Conn
+}
+
+func newFakeServer(t *testing.T, sasl bool) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{t: t, ln: ln, sasl: sasl, conn: make(chan net.Conn, 4)}
+	t.Cleanup(func() {
+		ln.Close()
+		s.mu.Lock()
+		for _, c := range s.conns {
+			c.Close()
+		}
+		s.mu.Unlock()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	send := func(format string, args ...any) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	nick := ""
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		s.mu.Lock()
+		s.lines = append(s.lines, line)
+		s.mu.Unlock()
+
+		msg, _ := parseMessage(line)
+		switch msg.command {
+		case "CAP":
+			switch msg.param(0) {
+			case "LS":
+				if s.sasl {
+					send(":irc.test CAP * LS * :multi-prefix")
+					send(":irc.test CAP * LS :sasl=PLAIN,EXTERNAL message-tags")
+				} else {
+					send(":irc.test CAP * LS :multi-prefix")
+				}
+			case "REQ":
+				send(":irc.test CAP * ACK :%s", msg.param(1))
+			}
+		case "AUTHENTICATE":
+			if msg.param(0) == "PLAIN" {
+				send("AUTHENTICATE +")
+			} else if data, _ := base64.StdEncoding.DecodeString(msg.param(0)); string(data) == "bot\x00bot\x00secret" {
+				send(":irc.test 903 * :SASL authentication successful")
+			} else {
+				send(":irc.test 904 * :SASL authentication failed")
+			}
+		case "NICK":
+			if msg.param(0) == s.nickUsed && nick == "" {
+				s.nickUsed = ""
+				send(":irc.test 433 * %s :Nickname is already in use", msg.param(0))
+				continue
+			}
+			nick = msg.param(0)
+		case "JOIN":
+			send(":%s!~bot@bot.example JOIN %s", nick, msg.param(0))
+		case "PING":
+			send(":irc.test PONG irc.test :%s", msg.param(0))
+		}
+		// Registration completes when capability negotiation ends.
+		if msg.command == "CAP" && msg.param(0) == "END" {
+			send(":irc.test 001 %s :Welcome", nick)
+			s.conn <- conn
+		}
+	}
+}
+
+func (s *fakeServer) waitConn(t *testing.T) net.Conn {
+	t.Helper()
+	select {
+	case conn := <-s.conn:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not register")
+		return nil
+	}
+}
+
+// waitLine waits until the server has received a line matching pred.
+func (s *fakeServer) waitLine(t *testing.T, pred func(string) bool) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		for _, line := range s.lines {
+			if pred(line) {
+				s.mu.Unlock()
+				return line
+			}
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.Fatalf("expected line not received; got %q", s.lines)
+	return ""
+}
+
+func (s *fakeServer) linesWithPrefix(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, line := range s.lines {
+		if strings.HasPrefix(line, prefix) {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+func newTestChannel(t *testing.T, cfg config.IRCConfig) (*IRCChannel, *bus.MessageBus) {
+	t.Helper()
+	mb := bus.NewMessageBus()
+	ch, err := NewIRCChannel(cfg, mb)
+	if err != nil {
+		t.Fatalf("NewIRCChannel() error = %v", err)
+	}
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { ch.Stop(context.Background()) })
+	return ch, mb
+}
+
+func TestIRCChannel_SASLAndMessages(t *testing.T) {
+	srv := newFakeServer(t, true)
+	srv.nickUsed = "bot"
+	ch, mb := newTestChannel(t, config.IRCConfig{
+		Server:        srv.ln.Addr().String(),
+		Nick:          "bot",
+		SASLMechanism: "PLAIN",
+		SASLPassword:  "secret",
+		Channels:      config.FlexibleStringSlice{"#ops", "#secret key"},
+		FloodBurst:    100,
+		FloodDelay:    1,
+		AllowFrom:     config.FlexibleStringSlice{"alice"},
+		GroupTrigger:  config.GroupTriggerConfig{Prefixes: []string{"!ask "}},
+	})
+	conn := srv.waitConn(t)
+	srv.waitLine(t, func(l string) bool { return l == "JOIN #secret key" })
+	if got := srv.linesWithPrefix("CAP REQ"); len(got) != 1 || got[0] != "CAP REQ :sasl message-tags" {
+		t.Errorf("CAP REQ = %q", got)
+	}
+	if got := srv.linesWithPrefix("PRIVMSG NickServ"); len(got) != 0 {
+		t.Errorf("NickServ should not be used after SASL, got %q", got)
+	}
+
+	send := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	send(":mallory!m@evil PRIVMSG bot_ :let me in")
+	send(":alice!a@host PRIVMSG #ops :just chatting")
+	send(":alice!a@host NOTICE bot_ :ignored")
+	send(":alice!a@host PRIVMSG bot_ :\x01VERSION\x01")
+	send("@msgid=abc;time=2024-01-01T00:00:00Z :alice!a@host PRIVMSG bot_ :hello \x02there\x02")
+	send(":alice!a@host PRIVMSG #ops :bot_: status?")
+	send(":alice!a@host PRIVMSG #ops :!ask what's new")
+	send(":alice!a@host PRIVMSG #ops :\x01ACTION pokes bot_\x01")
+
+	msg := bustest.Consume(t, mb)
+	if msg.ChatID != "alice" || msg.Peer.Kind != "direct" || msg.Content != "hello there" || msg.MessageID != "abc" {
+		t.Errorf("DM = %+v", msg)
+	}
+	for _, want := range []string{"status?", "what's new", "* pokes bot_"} {
+		msg = bustest.Consume(t, mb)
+		if msg.ChatID != "#ops" || msg.Peer.Kind != "group" || msg.Content != want {
+			t.Errorf("channel message = %+v, want content %q", msg, want)
+		}
+	}
+
+	// Each line is cut to fit 512 bytes once the server adds our prefix.
+	long := strings.Repeat("word ", 200)
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "#ops", Content: "first\n\n" + long}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	srv.waitLine(t, func(l string) bool { return strings.HasPrefix(l, "PRIVMSG #ops :word") })
+	time.Sleep(50 * time.Millisecond)
+	lines := srv.linesWithPrefix("PRIVMSG #ops")
+	if len(lines) < 3 || lines[0] != "PRIVMSG #ops :first" {
+		t.Fatalf("sent lines = %q", lines)
+	}
+	relayedPrefix := len(":bot_!~bot@bot.example ")
+	total := 0
+	for _, line := range lines[1:] {
+		if relayedPrefix+len(line)+2 > maxLineBytes {
+			t.Errorf("relayed line would be %d bytes", relayedPrefix+len(line)+2)
+		}
+		total += len(strings.Fields(strings.TrimPrefix(line, "PRIVMSG #ops :")))
+	}
+	if total != 200 {
+		t.Errorf("sent %d words, want 200", total)
+	}
+
+	err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "#ops\r\nQUIT", Content: "x"})
+	if !errors.Is(err, channels.ErrSendFailed) {
+		t.Errorf("Send() to an invalid target error = %v, want ErrSendFailed", err)
+	}
+}
+
+func TestIRCChannel_NickServFallbackAndReconnect(t *testing.T) {
+	oldMin := minRetryDelay
+	minRetryDelay = 10 * time.Millisecond
+	defer func() { minRetryDelay = oldMin }()
+
+	srv := newFakeServer(t, false)
+	ch, _ := newTestChannel(t, config.IRCConfig{
+		Server:           srv.ln.Addr().String(),
+		Nick:             "bot",
+		SASLMechanism:    "PLAIN",
+		SASLPassword:     "secret",
+		NickServPassword: "secret",
+		Channels:         config.FlexibleStringSlice{"#ops"},
+	})
+	conn := srv.waitConn(t)
+	srv.waitLine(t, func(l string) bool { return l == "PRIVMSG NickServ :IDENTIFY bot secret" })
+
+	conn.Close()
+	srv.waitConn(t)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.linesWithPrefix("JOIN #ops")) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("client did not rejoin after reconnecting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "#ops", Content: "back"}); err != nil {
+		t.Fatalf("Send() after reconnect error = %v", err)
+	}
+	srv.waitLine(t, func(l string) bool { return l == "PRIVMSG #ops :back" })
+}
+
+func TestIRCChannel_SendRate(t *testing.T) {
+	ch, err := NewIRCChannel(config.IRCConfig{Server: "irc.test:6667", Nick: "bot", FloodBurst: 3, FloodDelay: 500}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, burst := ch.SendRate(); r != 2 || burst != 3 {
+		t.Errorf("SendRate() = %v, %d; want 2, 3", r, burst)
+	}
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "#x", Content: "x"}); !errors.Is(err, channels.ErrNotRunning) {
+		t.Errorf("Send() before Start error = %v, want ErrNotRunning", err)
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	msg, ok := parseMessage("@msgid=1 :nick!user@host PRIVMSG #chan :hello :world\r\n")
+	if !ok || msg.msgID != "1" || msg.nick() != "nick" || msg.command != "PRIVMSG" ||
+		len(msg.params) != 2 || msg.params[0] != "#chan" || msg.params[1] != "hello :world" {
+		t.Errorf("parseMessage() = %+v", msg)
+	}
+	msg, ok = parseMessage("PING irc.test")
+	if !ok || msg.command != "PING" || msg.param(0) != "irc.test" {
+		t.Errorf("parseMessage(PING) = %+v", msg)
+	}
+}
+
+func TestStripFormatting(t *testing.T) {
+	tests := map[string]string{
+		"plain":                       "plain",
+		"\x02bold\x02 \x1ditalic\x1d": "bold italic",
+		"\x0304,12red\x03 done":       "red done",
+		"\x033,4x":                    "x",
+		"\x03 reset":                  " reset",
+		"\x04ff0000hex\x0f":           "hex",
+	}
+	for in, want := range tests {
+		if got := stripFormatting(in); got != want {
+			t.Errorf("stripFormatting(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	lines := splitLines("héllo wörld ünïcode", 8)
+	for _, line := range lines {
+		if len(line) > 8 || !strings.Contains("héllowörldünïcode", line) {
+			t.Errorf("bad line %q in %q", line, lines)
+		}
+	}
+	if got := strings.Join(lines, ""); got != "héllowörldünïcode" {
+		t.Errorf("rejoined = %q", got)
+	}
+}
+
+func TestAddressed(t *testing.T) {
+	tests := []struct {
+		text      string
+		mentioned bool
+		content   string
+	}{
+		{"bot: hi", true, "hi"},
+		{"Bot, hi", true, "hi"},
+		{"hey bot how are you", true, "hey bot how are you"},
+		{"robot wars", false, "robot wars"},
+		{"bots everywhere", false, "bots everywhere"},
+	}
+	for _, tt := range tests {
+		mentioned, content := addressed(tt.text, "bot")
+		if mentioned != tt.mentioned || content != tt.content {
+			t.Errorf("addressed(%q) = %v, %q", tt.text, mentioned, content)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package irc
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLineBytes is the protocol limit for a line, including the CRLF.
+const maxLineBytes = 512
+
+// message is a parsed IRC protocol line. Of the IRCv3 message tags only
+// msgid is kept.
+type message struct {
+	msgID   string
+	prefix  string
+	command string
+	params  []string
+}
+
+// parseMessage parses a line without its trailing CRLF.
+func parseMessage(line string) (message, bool) {
+	var m message
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, "@") {
+		tags, rest, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			return m, false
+		}
+		for _, tag := range strings.Split(tags, ";") {
+			if id, found := strings.CutPrefix(tag, "msgid="); found {
+				m.msgID = id
+			}
+		}
+		line = strings.TrimLeft(rest, " ")
+	}
+	if strings.HasPrefix(line, ":") {
+		prefix, rest, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			return m, false
+		}
+		m.prefix = prefix
+		line = strings.TrimLeft(rest, " ")
+	}
+
+	for line != "" {
+		if strings.HasPrefix(line, ":") && m.command != "" {
+			m.params = append(m.params, line[1:])
+			break
+		}
+		word, rest, _ := strings.Cut(line, " ")
+		if m.command == "" {
+			m.command = strings.ToUpper(word)
+		} else {
+			m.params = append(m.params, word)
+		}
+		line = strings.TrimLeft(rest, " ")
+	}
+	return m, m.command != ""
+}
+
+// nick returns the nickname part of the prefix.
+func (m message) nick() string {
+	nick, _, _ := strings.Cut(m.prefix, "!")
+	return nick
+}
+
+func (m message) param(i int) string {
+	if i < len(m.params) {
+		return m.params[i]
+	}
+	return ""
+}
+
+// ctcp splits a CTCP message ("\x01ACTION waves\x01") into its command and
+// argument.
+func ctcp(text string) (command, arg string, ok bool) {
+	if len(text) < 2 || text[0] != '\x01' {
+		return "", "", false
+	}
+	body := strings.TrimSuffix(text[1:], "\x01")
+	command, arg, _ = strings.Cut(body, " ")
+	return strings.ToUpper(command), arg, true
+}
+
+// stripFormatting removes mIRC bold, color, italic, underline and reset codes.
+func stripFormatting(text string) string {
+	if !strings.ContainsAny(text, "\x02\x03\x04\x0f\x11\x16\x1d\x1e\x1f") {
+		return text
+	}
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch ch := text[i]; ch {
+		case '\x02', '\x0f', '\x11', '\x16', '\x1d', '\x1e', '\x1f':
+		case '\x03':
+			// \x03[fg[,bg]] with one or two digits each
+			i += skipDigits(text[i+1:], 2)
+			if i+2 < len(text) && text[i+1] == ',' && isDigit(text[i+2]) {
+				i++
+				i += skipDigits(text[i+1:], 2)
+			}
+		case '\x04':
+			// \x04[rrggbb[,rrggbb]]
+			i += skipHex(text[i+1:])
+			if i+2 < len(text) && text[i+1] == ',' && isHex(text[i+2]) {
+				i++
+				i += skipHex(text[i+1:])
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+func skipDigits(s string, max int) int {
+	n := 0
+	for n < max && n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return n
+}
+
+func skipHex(s string) int {
+	if len(s) < 6 {
+		return 0
+	}
+	for i := range 6 {
+		if !isHex(s[i]) {
+			return 0
+		}
+	}
+	return 6
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// splitLines breaks text into lines of at most limit bytes: first at
+// newlines, then at the last space before the limit, and otherwise at a rune
+// boundary. Blank lines are dropped, since IRC cannot send them.
+func splitLines(text string, limit int) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		line = strings.TrimRight(line, " \t")
+		for len(line) > limit {
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if space := strings.LastIndexByte(line[:cut], ' '); space > limit/2 {
+				cut = space
+			}
+			lines = append(lines, line[:cut])
+			line = strings.TrimLeft(line[cut:], " ")
+		}
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -12,12 +12,15 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/health"
@@ -64,15 +67,28 @@ var channelRateConfig = map[string]float64{
 	"line":     10,
 }
 
+// channelWorker delivers the outbound messages of one channel. Its queues
+// are never closed, since dispatchers and SendToChannel may hold the worker
+// after it was removed from Manager.workers; stop tells both loops to
+// deliver what is already queued and exit.
 type channelWorker struct {
 	ch         Channel
 	queue      chan bus.OutboundMessage
 	mediaQueue chan bus.OutboundMediaMessage
+	stop       chan struct{}
 	done       chan struct{}
 	mediaDone  chan struct{}
 	limiter    *rate.Limiter
 }
 
+// stopAndWait stops the worker and waits for both loops to exit. Only the
+// caller that removed the worker from Manager.workers may call it.
+func (w *channelWorker) stopAndWait() {
+	close(w.stop)
+	<-w.done
+	<-w.mediaDone
+}
+
 type Manager struct {
 	channels      map[string]Channel
 	workers       map[string]*channelWorker
@@ -80,12 +96,16 @@ type Manager struct {
 	config        *config.Config
 	mediaStore    media.MediaStore
 	dispatchTask  *asyncTask
+	startCtx      context.Context // context channels were started with; reused on reload
+	dispatchCtx   context.Context // context workers run under; reused on reload
 	mux           *http.ServeMux
+	routes        map[string]bool // webhook and health paths registered on mux
 	httpServer    *http.Server
 	mu            sync.RWMutex
-	placeholders  sync.Map // "channel:chatID" → placeholderID (string)
-	typingStops   sync.Map // "channel:chatID" → func()
-	reactionUndos sync.Map // "channel:chatID" → reactionEntry
+	reloadMu      sync.Mutex // serializes Reload
+	placeholders  sync.Map   // "channel:chatID" → placeholderID (string)
+	typingStops   sync.Map   // "channel:chatID" → func()
+	reactionUndos sync.Map   // "channel:chatID" → reactionEntry
 }
 
 type asyncTask struct {
@@ -135,7 +155,13 @@ func (m *Manager) preSend(ctx context.Context, name string, msg bus.OutboundMess
 	// 3. Try editing placeholder
 	if v, loaded := m.placeholders.LoadAndDelete(key); loaded {
 		if entry, ok := v.(placeholderEntry); ok && entry.id != "" {
-			if editor, ok := ch.(MessageEditor); ok {
+			if len(msg.Buttons) > 0 {
+				if bc, ok := ch.(ButtonCapable); ok {
+					if err := bc.EditMessageButtons(ctx, msg.ChatID, entry.id, msg.Content, msg.Buttons); err == nil {
+						return true
+					}
+				}
+			} else if editor, ok := ch.(MessageEditor); ok {
 				if err := editor.EditMessage(ctx, msg.ChatID, entry.id, msg.Content); err == nil {
 					return true // edited successfully, skip Send
 				}
@@ -165,106 +191,188 @@ func NewManager(cfg *config.Config, messageBus *bus.MessageBus, store media.Medi
 
 // initChannel is a helper that looks up a factory by name and creates the channel.
 func (m *Manager) initChannel(name, displayName string) {
+	if ch := m.newChannel(m.config, name, displayName); ch != nil {
+		m.channels[name] = ch
+	}
+}
+
+// newChannel creates a channel from cfg and injects the manager's services.
+// It returns nil if the channel could not be created.
+func (m *Manager) newChannel(cfg *config.Config, name, displayName string) Channel {
 	f, ok := getFactory(name)
 	if !ok {
 		logger.WarnCF("channels", "Factory not registered", map[string]any{
 			"channel": displayName,
 		})
-		return
+		return nil
 	}
 	logger.DebugCF("channels", "Attempting to initialize channel", map[string]any{
 		"channel": displayName,
 	})
-	ch, err := f(m.config, m.bus)
+	ch, err := f(cfg, m.bus)
 	if err != nil {
 		logger.ErrorCF("channels", "Failed to initialize channel", map[string]any{
 			"channel": displayName,
 			"error":   err.Error(),
 		})
-	} else {
-		// Inject MediaStore if channel supports it
-		if m.mediaStore != nil {
-			if setter, ok := ch.(interface{ SetMediaStore(s media.MediaStore) }); ok {
-				setter.SetMediaStore(m.mediaStore)
-			}
-		}
-		// Inject PlaceholderRecorder if channel supports it
-		if setter, ok := ch.(interface{ SetPlaceholderRecorder(r PlaceholderRecorder) }); ok {
-			setter.SetPlaceholderRecorder(m)
-		}
-		// Inject owner reference so BaseChannel.HandleMessage can auto-trigger typing/reaction
-		if setter, ok := ch.(interface{ SetOwner(ch Channel) }); ok {
-			setter.SetOwner(ch)
-		}
-		m.channels[name] = ch
-		logger.InfoCF("channels", "Channel enabled successfully", map[string]any{
-			"channel": displayName,
-		})
-	}
-}
-
-func (m *Manager) initChannels() error {
-	logger.InfoC("channels", "Initializing channel manager")
-
-	if m.config.Channels.Telegram.Enabled && m.config.Channels.Telegram.Token != "" {
-		m.initChannel("telegram", "Telegram")
+		return nil
 	}
-
-	if m.config.Channels.WhatsApp.Enabled {
-		waCfg := m.config.Channels.WhatsApp
-		if waCfg.UseNative {
-			m.initChannel("whatsapp_native", "WhatsApp Native")
-		} else if waCfg.BridgeURL != "" {
-			m.initChannel("whatsapp", "WhatsApp")
+	// Inject MediaStore if channel supports it
+	if m.mediaStore != nil {
+		if setter, ok := ch.(interface{ SetMediaStore(s media.MediaStore) }); ok {
+			setter.SetMediaStore(m.mediaStore)
 		}
 	}
-
-	if m.config.Channels.Feishu.Enabled {
-		m.initChannel("feishu", "Feishu")
-	}
-
-	if m.config.Channels.Discord.Enabled && m.config.Channels.Discord.Token != "" {
-		m.initChannel("discord", "Discord")
+	// Inject PlaceholderRecorder if channel supports it
+	if setter, ok := ch.(interface{ SetPlaceholderRecorder(r PlaceholderRecorder) }); ok {
+		setter.SetPlaceholderRecorder(m)
 	}
-
-	if m.config.Channels.MaixCam.Enabled {
-		m.initChannel("maixcam", "MaixCam")
-	}
-
-	if m.config.Channels.QQ.Enabled {
-		m.initChannel("qq", "QQ")
-	}
-
-	if m.config.Channels.DingTalk.Enabled && m.config.Channels.DingTalk.ClientID != "" {
-		m.initChannel("dingtalk", "DingTalk")
-	}
-
-	if m.config.Channels.Slack.Enabled && m.config.Channels.Slack.BotToken != "" {
-		m.initChannel("slack", "Slack")
-	}
-
-	if m.config.Channels.LINE.Enabled && m.config.Channels.LINE.ChannelAccessToken != "" {
-		m.initChannel("line", "LINE")
-	}
-
-	if m.config.Channels.OneBot.Enabled && m.config.Channels.OneBot.WSUrl != "" {
-		m.initChannel("onebot", "OneBot")
+	// Inject owner reference so BaseChannel.HandleMessage can auto-trigger typing/reaction
+	if setter, ok := ch.(interface{ SetOwner(ch Channel) }); ok {
+		setter.SetOwner(ch)
 	}
+	logger.InfoCF("channels", "Channel enabled successfully", map[string]any{
+		"channel": displayName,
+	})
+	return ch
+}
 
-	if m.config.Channels.WeCom.Enabled && m.config.Channels.WeCom.Token != "" {
-		m.initChannel("wecom", "WeCom")
-	}
+// channelSpec describes how a channel is enabled from config. section returns
+// the part of the config the channel is built from; when it changes on
+// reload, the channel is restarted.
+type channelSpec struct {
+	name        string
+	displayName string
+	enabled     func(c *config.ChannelsConfig) bool
+	section     func(c *config.ChannelsConfig) any
+}
 
-	if m.config.Channels.WeComAIBot.Enabled && m.config.Channels.WeComAIBot.Token != "" {
-		m.initChannel("wecom_aibot", "WeCom AI Bot")
-	}
+var channelSpecs = []channelSpec{
+	{
+		"telegram", "Telegram",
+		func(c *config.ChannelsConfig) bool { return c.Telegram.Enabled && c.Telegram.Token != "" },
+		func(c *config.ChannelsConfig) any { return c.Telegram },
+	},
+	{
+		"whatsapp_native", "WhatsApp Native",
+		func(c *config.ChannelsConfig) bool { return c.WhatsApp.Enabled && c.WhatsApp.UseNative },
+		func(c *config.ChannelsConfig) any { return c.WhatsApp },
+	},
+	{
+		"whatsapp", "WhatsApp",
+		func(c *config.ChannelsConfig) bool {
+			return c.WhatsApp.Enabled && !c.WhatsApp.UseNative && c.WhatsApp.BridgeURL != ""
+		},
+		func(c *config.ChannelsConfig) any { return c.WhatsApp },
+	},
+	{
+		"feishu", "Feishu",
+		func(c *config.ChannelsConfig) bool { return c.Feishu.Enabled },
+		func(c *config.ChannelsConfig) any { return c.Feishu },
+	},
+	{
+		"discord", "Discord",
+		func(c *config.ChannelsConfig) bool { return c.Discord.Enabled && c.Discord.Token != "" },
+		func(c *config.ChannelsConfig) any { return c.Discord },
+	},
+	{
+		"maixcam", "MaixCam",
+		func(c *config.ChannelsConfig) bool { return c.MaixCam.Enabled },
+		func(c *config.ChannelsConfig) any { return c.MaixCam },
+	},
+	{
+		"qq", "QQ",
+		func(c *config.ChannelsConfig) bool { return c.QQ.Enabled },
+		func(c *config.ChannelsConfig) any { return c.QQ },
+	},
+	{
+		"dingtalk", "DingTalk",
+		func(c *config.ChannelsConfig) bool { return c.DingTalk.Enabled && c.DingTalk.ClientID != "" },
+		func(c *config.ChannelsConfig) any { return c.DingTalk },
+	},
+	{
+		"slack", "Slack",
+		func(c *config.ChannelsConfig) bool { return c.Slack.Enabled && c.Slack.BotToken != "" },
+		func(c *config.ChannelsConfig) any { return c.Slack },
+	},
+	{
+		"line", "LINE",
+		func(c *config.ChannelsConfig) bool { return c.LINE.Enabled && c.LINE.ChannelAccessToken != "" },
+		func(c *config.ChannelsConfig) any { return c.LINE },
+	},
+	{
+		"onebot", "OneBot",
+		func(c *config.ChannelsConfig) bool { return c.OneBot.Enabled && c.OneBot.WSUrl != "" },
+		func(c *config.ChannelsConfig) any { return c.OneBot },
+	},
+	{
+		"wecom", "WeCom",
+		func(c *config.ChannelsConfig) bool { return c.WeCom.Enabled && c.WeCom.Token != "" },
+		func(c *config.ChannelsConfig) any { return c.WeCom },
+	},
+	{
+		"wecom_aibot", "WeCom AI Bot",
+		func(c *config.ChannelsConfig) bool { return c.WeComAIBot.Enabled && c.WeComAIBot.Token != "" },
+		func(c *config.ChannelsConfig) any { return c.WeComAIBot },
+	},
+	{
+		"wecom_app", "WeCom App",
+		func(c *config.ChannelsConfig) bool { return c.WeComApp.Enabled && c.WeComApp.CorpID != "" },
+		func(c *config.ChannelsConfig) any { return c.WeComApp },
+	},
+	{
+		"pico", "Pico",
+		func(c *config.ChannelsConfig) bool { return c.Pico.Enabled && c.Pico.Token != "" },
+		func(c *config.ChannelsConfig) any { return c.Pico },
+	},
+	{
+		"email", "Email",
+		func(c *config.ChannelsConfig) bool { return c.Email.Enabled && c.Email.IMAPHost != "" },
+		func(c *config.ChannelsConfig) any { return c.Email },
+	},
+	{
+		"matrix", "Matrix",
+		func(c *config.ChannelsConfig) bool { return c.Matrix.Enabled && c.Matrix.AccessToken != "" },
+		func(c *config.ChannelsConfig) any { return c.Matrix },
+	},
+	{
+		"signal", "Signal",
+		func(c *config.ChannelsConfig) bool { return c.Signal.Enabled && c.Signal.Account != "" },
+		func(c *config.ChannelsConfig) any { return c.Signal },
+	},
+	{
+		"irc", "IRC",
+		func(c *config.ChannelsConfig) bool { return c.IRC.Enabled && c.IRC.Server != "" && c.IRC.Nick != "" },
+		func(c *config.ChannelsConfig) any { return c.IRC },
+	},
+	{
+		"mattermost", "Mattermost",
+		func(c *config.ChannelsConfig) bool {
+			return c.Mattermost.Enabled && c.Mattermost.ServerURL != "" && c.Mattermost.Token != ""
+		},
+		func(c *config.ChannelsConfig) any { return c.Mattermost },
+	},
+	{
+		"mqtt", "MQTT",
+		func(c *config.ChannelsConfig) bool { return c.MQTT.Enabled && c.MQTT.Broker != "" },
+		func(c *config.ChannelsConfig) any { return c.MQTT },
+	},
+	{
+		"webhook", "Webhook",
+		func(c *config.ChannelsConfig) bool {
+			return c.Webhook.Enabled && (c.Webhook.Secret != "" || c.Webhook.Token != "")
+		},
+		func(c *config.ChannelsConfig) any { return c.Webhook },
+	},
+}
 
-	if m.config.Channels.WeComApp.Enabled && m.config.Channels.WeComApp.CorpID != "" {
-		m.initChannel("wecom_app", "WeCom App")
-	}
+func (m *Manager) initChannels() error {
+	logger.InfoC("channels", "Initializing channel manager")
 
-	if m.config.Channels.Pico.Enabled && m.config.Channels.Pico.Token != "" {
-		m.initChannel("pico", "Pico")
+	for _, spec := range channelSpecs {
+		if spec.enabled(&m.config.Channels) {
+			m.initChannel(spec.name, spec.displayName)
+		}
 	}
 
 	logger.InfoCF("channels", "Channel initialization completed", map[string]any{
@@ -286,21 +394,9 @@ func (m *Manager) SetupHTTPServer(addr string, healthServer *health.Server) {
 	}
 
 	// Discover and register webhook handlers and health checkers
+	m.routes = make(map[string]bool)
 	for name, ch := range m.channels {
-		if wh, ok := ch.(WebhookHandler); ok {
-			m.mux.Handle(wh.WebhookPath(), wh)
-			logger.InfoCF("channels", "Webhook handler registered", map[string]any{
-				"channel": name,
-				"path":    wh.WebhookPath(),
-			})
-		}
-		if hc, ok := ch.(HealthChecker); ok {
-			m.mux.HandleFunc(hc.HealthPath(), hc.HealthHandler)
-			logger.InfoCF("channels", "Health endpoint registered", map[string]any{
-				"channel": name,
-				"path":    hc.HealthPath(),
-			})
-		}
+		m.registerRoutes(name, ch)
 	}
 
 	m.httpServer = &http.Server{
@@ -311,6 +407,72 @@ func (m *Manager) SetupHTTPServer(addr string, healthServer *health.Server) {
 	}
 }
 
+// registerRoutes adds the webhook and health endpoints of ch to the shared
+// mux. Handlers look the channel up by name on every request, so a channel
+// restarted by Reload keeps serving on the same path; a path is only ever
+// registered once because http.ServeMux cannot replace handlers.
+func (m *Manager) registerRoutes(name string, ch Channel) {
+	if m.mux == nil {
+		return
+	}
+	if wh, ok := ch.(WebhookHandler); ok && !m.routes[wh.WebhookPath()] {
+		m.routes[wh.WebhookPath()] = true
+		m.mux.HandleFunc(wh.WebhookPath(), func(w http.ResponseWriter, r *http.Request) {
+			m.mu.RLock()
+			cur, ok := m.channels[name].(WebhookHandler)
+			m.mu.RUnlock()
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			cur.ServeHTTP(w, r)
+		})
+		logger.InfoCF("channels", "Webhook handler registered", map[string]any{
+			"channel": name,
+			"path":    wh.WebhookPath(),
+		})
+	}
+	if hc, ok := ch.(HealthChecker); ok && !m.routes[hc.HealthPath()] {
+		m.routes[hc.HealthPath()] = true
+		m.mux.HandleFunc(hc.HealthPath(), func(w http.ResponseWriter, r *http.Request) {
+			m.mu.RLock()
+			cur, ok := m.channels[name].(HealthChecker)
+			m.mu.RUnlock()
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			cur.HealthHandler(w, r)
+		})
+		logger.InfoCF("channels", "Health endpoint registered", map[string]any{
+			"channel": name,
+			"path":    hc.HealthPath(),
+		})
+	}
+}
+
+// RegisterHTTPHandler mounts a handler that does not belong to a channel,
+// such as the OpenAI-compatible API, on the shared HTTP server. It must be
+// called after SetupHTTPServer.
+func (m *Manager) RegisterHTTPHandler(pattern string, handler http.Handler) {
+	if m.mux == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.routes[pattern] {
+		logger.WarnCF("channels", "HTTP path already registered", map[string]any{
+			"path": pattern,
+		})
+		return
+	}
+	m.routes[pattern] = true
+	m.mux.Handle(pattern, handler)
+	logger.InfoCF("channels", "HTTP handler registered", map[string]any{
+		"path": pattern,
+	})
+}
+
 func (m *Manager) StartAll(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -324,6 +486,8 @@ func (m *Manager) StartAll(ctx context.Context) error {
 
 	dispatchCtx, cancel := context.WithCancel(ctx)
 	m.dispatchTask = &asyncTask{cancel: cancel}
+	m.startCtx = ctx
+	m.dispatchCtx = dispatchCtx
 
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Starting channel", map[string]any{
@@ -391,29 +555,22 @@ func (m *Manager) StopAll(ctx context.Context) error {
 		m.dispatchTask.cancel()
 		m.dispatchTask = nil
 	}
+	m.startCtx = nil
+	m.dispatchCtx = nil
 
-	// Close all worker queues and wait for them to drain
+	// Stop all workers and wait for them to exit
 	for _, w := range m.workers {
 		if w != nil {
-			close(w.queue)
+			close(w.stop)
 		}
 	}
 	for _, w := range m.workers {
 		if w != nil {
 			<-w.done
-		}
-	}
-	// Close all media worker queues and wait for them to drain
-	for _, w := range m.workers {
-		if w != nil {
-			close(w.mediaQueue)
-		}
-	}
-	for _, w := range m.workers {
-		if w != nil {
 			<-w.mediaDone
 		}
 	}
+	m.workers = make(map[string]*channelWorker)
 
 	// Stop all channels
 	for name, channel := range m.channels {
@@ -433,47 +590,49 @@ func (m *Manager) StopAll(ctx context.Context) error {
 }
 
 // newChannelWorker creates a channelWorker with a rate limiter configured
-// for the given channel name.
+// for the given channel name, or by the channel itself if it implements
+// SendRateProvider.
 func newChannelWorker(name string, ch Channel) *channelWorker {
 	rateVal := float64(defaultRateLimit)
 	if r, ok := channelRateConfig[name]; ok {
 		rateVal = r
 	}
 	burst := int(math.Max(1, math.Ceil(rateVal/2)))
+	if srp, ok := ch.(SendRateProvider); ok {
+		if r, b := srp.SendRate(); r > 0 {
+			rateVal, burst = r, max(b, 1)
+		}
+	}
 
 	return &channelWorker{
 		ch:         ch,
 		queue:      make(chan bus.OutboundMessage, defaultChannelQueueSize),
 		mediaQueue: make(chan bus.OutboundMediaMessage, defaultChannelQueueSize),
+		stop:       make(chan struct{}),
 		done:       make(chan struct{}),
 		mediaDone:  make(chan struct{}),
 		limiter:    rate.NewLimiter(rate.Limit(rateVal), burst),
 	}
 }
 
-// runWorker processes outbound messages for a single channel, splitting
-// messages that exceed the channel's maximum message length.
+// runWorker processes outbound messages for a single channel, rendering
+// them into the channel's text format and splitting messages that exceed
+// the channel's maximum message length.
 func (m *Manager) runWorker(ctx context.Context, name string, w *channelWorker) {
 	defer close(w.done)
 	for {
 		select {
-		case msg, ok := <-w.queue:
-			if !ok {
-				return
-			}
-			maxLen := 0
-			if mlp, ok := w.ch.(MessageLengthProvider); ok {
-				maxLen = mlp.MaxMessageLength()
-			}
-			if maxLen > 0 && len([]rune(msg.Content)) > maxLen {
-				chunks := SplitMessage(msg.Content, maxLen)
-				for _, chunk := range chunks {
-					chunkMsg := msg
-					chunkMsg.Content = chunk
-					m.sendWithRetry(ctx, name, w, chunkMsg)
+		case msg := <-w.queue:
+			m.sendMessage(ctx, name, w, msg)
+		case <-w.stop:
+			// Deliver what was queued before the stop, then exit.
+			for {
+				select {
+				case msg := <-w.queue:
+					m.sendMessage(ctx, name, w, msg)
+				default:
+					return
 				}
-			} else {
-				m.sendWithRetry(ctx, name, w, msg)
 			}
 		case <-ctx.Done():
 			return
@@ -481,6 +640,53 @@ func (m *Manager) runWorker(ctx context.Context, name string, w *channelWorker)
 	}
 }
 
+// sendMessage renders and splits msg for the channel and sends each part.
+func (m *Manager) sendMessage(ctx context.Context, name string, w *channelWorker, msg bus.OutboundMessage) {
+	if _, ok := w.ch.(ButtonCapable); !ok && len(msg.Buttons) > 0 {
+		msg.Content = appendButtonText(msg.Content, msg.Buttons)
+		msg.Buttons = nil
+	}
+	maxLen := 0
+	if mlp, ok := w.ch.(MessageLengthProvider); ok {
+		maxLen = mlp.MaxMessageLength()
+	}
+	var chunks []string
+	switch dialect := textFormat(w.ch); {
+	case dialect != "":
+		chunks = format.Split(msg.Content, dialect, maxLen)
+	case maxLen > 0 && len([]rune(msg.Content)) > maxLen:
+		chunks = SplitMessage(msg.Content, maxLen)
+	}
+	if len(chunks) == 0 {
+		m.sendWithRetry(ctx, name, w, msg)
+		return
+	}
+	for i, chunk := range chunks {
+		chunkMsg := msg
+		chunkMsg.Content = chunk
+		if i < len(chunks)-1 {
+			chunkMsg.Buttons = nil // buttons go under the last chunk
+		}
+		m.sendWithRetry(ctx, name, w, chunkMsg)
+	}
+}
+
+// appendButtonText lists button choices below content, one row per line,
+// for channels that can't show buttons.
+func appendButtonText(content string, buttons [][]bus.Button) string {
+	lines := []string{content}
+	for _, row := range buttons {
+		var labels []string
+		for _, b := range row {
+			labels = append(labels, "["+b.Text+"]")
+		}
+		if len(labels) > 0 {
+			lines = append(lines, strings.Join(labels, " "))
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
 // sendWithRetry sends a message through the channel with rate limiting and
 // retry logic. It classifies errors to determine the retry strategy:
 //   - ErrNotRunning / ErrSendFailed: permanent, no retry
@@ -596,6 +802,11 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 			select {
 			case w.queue <- msg:
 				return true
+			case <-w.stop:
+				logger.WarnCF("channels", "Channel is restarting, dropping message", map[string]any{
+					"channel": msg.Channel,
+				})
+				return true
 			case <-ctx.Done():
 				return false
 			}
@@ -616,6 +827,11 @@ func (m *Manager) dispatchOutboundMedia(ctx context.Context) {
 			select {
 			case w.mediaQueue <- msg:
 				return true
+			case <-w.stop:
+				logger.WarnCF("channels", "Channel is restarting, dropping media message", map[string]any{
+					"channel": msg.Channel,
+				})
+				return true
 			case <-ctx.Done():
 				return false
 			}
@@ -632,11 +848,17 @@ func (m *Manager) runMediaWorker(ctx context.Context, name string, w *channelWor
 	defer close(w.mediaDone)
 	for {
 		select {
-		case msg, ok := <-w.mediaQueue:
-			if !ok {
-				return
-			}
+		case msg := <-w.mediaQueue:
 			m.sendMediaWithRetry(ctx, name, w, msg)
+		case <-w.stop:
+			for {
+				select {
+				case msg := <-w.mediaQueue:
+					m.sendMediaWithRetry(ctx, name, w, msg)
+				default:
+					return
+				}
+			}
 		case <-ctx.Done():
 			return
 		}
@@ -788,15 +1010,114 @@ func (m *Manager) RegisterChannel(name string, channel Channel) {
 
 func (m *Manager) UnregisterChannel(name string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	if w, ok := m.workers[name]; ok && w != nil {
-		close(w.queue)
-		<-w.done
-		close(w.mediaQueue)
-		<-w.mediaDone
-	}
+	w := m.workers[name]
 	delete(m.workers, name)
 	delete(m.channels, name)
+	m.mu.Unlock()
+	if w != nil {
+		w.stopAndWait()
+	}
+}
+
+// Reload applies a new config to the running channels. Only channels whose
+// config section changed, or that were enabled or disabled, are stopped and
+// started again; all others keep running untouched. It returns the names of
+// the channels that were restarted, started or stopped.
+//
+// The affected channels are swapped out under m.mu and stopped and started
+// without it, so webhooks, dispatch and GetChannel are not held up by a
+// draining worker or a slow Start.
+func (m *Manager) Reload(ctx context.Context, cfg *config.Config) []string {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	type change struct {
+		spec    channelSpec
+		enabled bool
+		old     Channel
+		worker  *channelWorker
+	}
+
+	m.mu.Lock()
+	old := m.config
+	m.config = cfg
+	var changes []change
+	for _, spec := range channelSpecs {
+		wasEnabled := spec.enabled(&old.Channels)
+		enabled := spec.enabled(&cfg.Channels)
+		changed := !reflect.DeepEqual(spec.section(&old.Channels), spec.section(&cfg.Channels))
+		if wasEnabled == enabled && (!enabled || !changed) {
+			continue
+		}
+		changes = append(changes, change{
+			spec:    spec,
+			enabled: enabled,
+			old:     m.channels[spec.name],
+			worker:  m.workers[spec.name],
+		})
+		delete(m.channels, spec.name)
+		delete(m.workers, spec.name)
+	}
+	startCtx, dispatchCtx := m.startCtx, m.dispatchCtx
+	m.mu.Unlock()
+
+	affected := make([]string, 0, len(changes))
+	for _, c := range changes {
+		name := c.spec.name
+		affected = append(affected, name)
+
+		if c.old != nil {
+			logger.InfoCF("channels", "Stopping channel for reload", map[string]any{
+				"channel": name,
+			})
+			if c.worker != nil {
+				c.worker.stopAndWait()
+			}
+			if err := c.old.Stop(ctx); err != nil {
+				logger.ErrorCF("channels", "Error stopping channel", map[string]any{
+					"channel": name,
+					"error":   err.Error(),
+				})
+			}
+		}
+		if !c.enabled {
+			continue
+		}
+
+		ch := m.newChannel(cfg, name, c.spec.displayName)
+		if ch == nil {
+			continue
+		}
+		var w *channelWorker
+		if dispatchCtx != nil {
+			if err := ch.Start(startCtx); err != nil {
+				logger.ErrorCF("channels", "Failed to start channel", map[string]any{
+					"channel": name,
+					"error":   err.Error(),
+				})
+			} else {
+				w = newChannelWorker(name, ch)
+			}
+		}
+		// Not started yet when dispatchCtx is nil; StartAll picks it up.
+
+		m.mu.Lock()
+		m.channels[name] = ch
+		m.registerRoutes(name, ch)
+		if w != nil {
+			m.workers[name] = w
+			go m.runWorker(dispatchCtx, name, w)
+			go m.runMediaWorker(dispatchCtx, name, w)
+		}
+		m.mu.Unlock()
+	}
+
+	if len(affected) > 0 {
+		logger.InfoCF("channels", "Channels reloaded", map[string]any{
+			"channels": affected,
+		})
+	}
+	return affected
 }
 
 func (m *Manager) SendToChannel(ctx context.Context, channelName, chatID, content string) error {
@@ -819,6 +1140,8 @@ func (m *Manager) SendToChannel(ctx context.Context, channelName, chatID, conten
 		select {
 		case w.queue <- msg:
 			return nil
+		case <-w.stop:
+			return fmt.Errorf("channel %s is restarting", channelName)
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -826,5 +1149,16 @@ func (m *Manager) SendToChannel(ctx context.Context, channelName, chatID, conten
 
 	// Fallback: direct send (should not happen)
 	channel, _ := m.channels[channelName]
+	if dialect := textFormat(channel); dialect != "" {
+		msg.Content = format.Render(msg.Content, dialect)
+	}
 	return channel.Send(ctx, msg)
 }
+
+// textFormat returns the markup ch sends, or "" if it takes Markdown as is.
+func textFormat(ch Channel) format.Dialect {
+	if tfp, ok := ch.(TextFormatProvider); ok {
+		return tfp.TextFormat()
+	}
+	return ""
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -12,6 +13,8 @@ import (
 	"golang.org/x/time/rate"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
+	"github.com/sipeed/picoclaw/pkg/config"
 )
 
 // mockChannel is a test double that delegates Send to a configurable function.
@@ -326,6 +329,21 @@ func TestNewChannelWorker_ConfiguredRate(t *testing.T) {
 	}
 }
 
+type mockChannelWithRate struct {
+	mockChannel
+}
+
+func (m *mockChannelWithRate) SendRate() (float64, int) {
+	return 0.5, 4
+}
+
+func TestNewChannelWorker_ChannelProvidedRate(t *testing.T) {
+	w := newChannelWorker("telegram", &mockChannelWithRate{})
+	if w.limiter.Limit() != rate.Limit(0.5) || w.limiter.Burst() != 4 {
+		t.Fatalf("expected rate 0.5 burst 4, got %v burst %d", w.limiter.Limit(), w.limiter.Burst())
+	}
+}
+
 func TestRunWorker_MessageSplitting(t *testing.T) {
 	m := newTestManager()
 
@@ -860,3 +878,308 @@ func TestBuildMediaScope_WithMessageID(t *testing.T) {
 		t.Fatalf("expected %s, got %s", expected, scope)
 	}
 }
+
+// --- Reload tests ---
+
+// reloadChannel records its lifecycle so tests can tell restarted channels
+// from ones left running.
+type reloadChannel struct {
+	mockChannel
+	started atomic.Int32
+	stopped atomic.Int32
+}
+
+func (c *reloadChannel) Start(ctx context.Context) error { c.started.Add(1); return nil }
+func (c *reloadChannel) Stop(ctx context.Context) error  { c.stopped.Add(1); return nil }
+
+func TestManagerReload(t *testing.T) {
+	factory := func(cfg *config.Config, b *bus.MessageBus) (Channel, error) {
+		return &reloadChannel{}, nil
+	}
+	RegisterFactory("telegram", factory)
+	RegisterFactory("discord", factory)
+
+	cfg := config.DefaultConfig()
+	cfg.Channels.Telegram.Enabled = true
+	cfg.Channels.Telegram.Token = "tg-token"
+	cfg.Channels.Discord.Enabled = true
+	cfg.Channels.Discord.Token = "dc-token"
+
+	msgBus := bus.NewMessageBus()
+	defer msgBus.Close()
+	m, err := NewManager(cfg, msgBus, nil)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := m.StartAll(ctx); err != nil {
+		t.Fatalf("StartAll: %v", err)
+	}
+	defer m.StopAll(context.Background())
+
+	oldTelegram, _ := m.GetChannel("telegram")
+	oldDiscord, _ := m.GetChannel("discord")
+
+	// Change only the Telegram token: Telegram restarts, Discord is untouched.
+	next := config.DefaultConfig()
+	next.Channels = cfg.Channels
+	next.Channels.Telegram.Token = "tg-token-2"
+	affected := m.Reload(ctx, next)
+	if len(affected) != 1 || affected[0] != "telegram" {
+		t.Fatalf("affected = %v, want [telegram]", affected)
+	}
+	if oldTelegram.(*reloadChannel).stopped.Load() != 1 {
+		t.Error("old telegram channel was not stopped")
+	}
+	newTelegram, ok := m.GetChannel("telegram")
+	if !ok || newTelegram == oldTelegram {
+		t.Fatal("telegram channel was not replaced")
+	}
+	if newTelegram.(*reloadChannel).started.Load() != 1 {
+		t.Error("new telegram channel was not started")
+	}
+	m.mu.RLock()
+	_, hasWorker := m.workers["telegram"]
+	m.mu.RUnlock()
+	if !hasWorker {
+		t.Error("new telegram channel has no worker")
+	}
+	if cur, _ := m.GetChannel("discord"); cur != oldDiscord || oldDiscord.(*reloadChannel).stopped.Load() != 0 {
+		t.Error("discord channel should have been left running")
+	}
+
+	// Disable Discord: it is stopped and removed.
+	disabled := config.DefaultConfig()
+	disabled.Channels = next.Channels
+	disabled.Channels.Discord.Enabled = false
+	affected = m.Reload(ctx, disabled)
+	if len(affected) != 1 || affected[0] != "discord" {
+		t.Fatalf("affected = %v, want [discord]", affected)
+	}
+	if _, ok := m.GetChannel("discord"); ok {
+		t.Error("discord channel should have been removed")
+	}
+
+	// Reloading an identical config is a no-op.
+	if affected = m.Reload(ctx, disabled); len(affected) != 0 {
+		t.Errorf("affected = %v, want none", affected)
+	}
+}
+
+// gatedChannel blocks in Start until gate is closed, if set.
+type gatedChannel struct {
+	mockChannel
+	gate chan struct{}
+}
+
+func (c *gatedChannel) Start(ctx context.Context) error {
+	if c.gate != nil {
+		<-c.gate
+	}
+	return nil
+}
+func (c *gatedChannel) Stop(ctx context.Context) error { return nil }
+
+func TestManagerReload_ConcurrentUse(t *testing.T) {
+	var created atomic.Int32
+	release := make(chan struct{})
+	factory := func(gated bool) ChannelFactory {
+		return func(cfg *config.Config, b *bus.MessageBus) (Channel, error) {
+			ch := &gatedChannel{}
+			ch.sendFn = func(context.Context, bus.OutboundMessage) error { return nil }
+			if gated && created.Add(1) > 1 {
+				ch.gate = release
+			}
+			return ch, nil
+		}
+	}
+	RegisterFactory("telegram", factory(true))
+	RegisterFactory("discord", factory(false))
+
+	cfg := config.DefaultConfig()
+	cfg.Channels.Telegram.Enabled = true
+	cfg.Channels.Telegram.Token = "tg-token"
+	cfg.Channels.Discord.Enabled = true
+	cfg.Channels.Discord.Token = "dc-token"
+
+	msgBus := bus.NewMessageBus()
+	defer msgBus.Close()
+	m, err := NewManager(cfg, msgBus, nil)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := m.StartAll(ctx); err != nil {
+		t.Fatalf("StartAll: %v", err)
+	}
+	defer m.StopAll(context.Background())
+
+	// Keep sending to Telegram while it restarts; a send must never hit a
+	// closed queue.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = m.SendToChannel(ctx, "telegram", "1", "hi")
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	next := config.DefaultConfig()
+	next.Channels = cfg.Channels
+	next.Channels.Telegram.Token = "tg-token-2"
+	reloaded := make(chan []string)
+	go func() { reloaded <- m.Reload(ctx, next) }()
+
+	// While the new Telegram channel is starting, the manager stays usable.
+	for created.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	got := make(chan bool)
+	go func() {
+		_, ok := m.GetChannel("discord")
+		got <- ok
+	}()
+	select {
+	case ok := <-got:
+		if !ok {
+			t.Error("discord channel missing during reload")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GetChannel blocked while a channel was starting")
+	}
+
+	close(release)
+	if affected := <-reloaded; len(affected) != 1 || affected[0] != "telegram" {
+		t.Errorf("affected = %v, want [telegram]", affected)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// mockButtonChannel implements ButtonCapable and MessageLengthProvider.
+type mockButtonChannel struct {
+	mockChannelWithLength
+	editFn func(ctx context.Context, chatID, messageID, content string, buttons [][]bus.Button) error
+}
+
+func (m *mockButtonChannel) EditMessageButtons(
+	ctx context.Context, chatID, messageID, content string, buttons [][]bus.Button,
+) error {
+	return m.editFn(ctx, chatID, messageID, content, buttons)
+}
+
+func runWorkerOnce(t *testing.T, ch Channel, msg bus.OutboundMessage, want int) []bus.OutboundMessage {
+	t.Helper()
+	m := newTestManager()
+	sent := make(chan bus.OutboundMessage, 10)
+	w := &channelWorker{
+		ch:      ch,
+		queue:   make(chan bus.OutboundMessage, 1),
+		done:    make(chan struct{}),
+		limiter: rate.NewLimiter(rate.Inf, 1),
+	}
+	switch c := ch.(type) {
+	case *mockChannelWithLength:
+		c.sendFn = func(_ context.Context, msg bus.OutboundMessage) error { sent <- msg; return nil }
+	case *mockButtonChannel:
+		c.sendFn = func(_ context.Context, msg bus.OutboundMessage) error { sent <- msg; return nil }
+	}
+	go m.runWorker(t.Context(), "test", w)
+	w.queue <- msg
+
+	var got []bus.OutboundMessage
+	for len(got) < want {
+		select {
+		case msg := <-sent:
+			got = append(got, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("got %d messages, want %d", len(got), want)
+		}
+	}
+	return got
+}
+
+func TestRunWorker_ButtonsAsTextFallback(t *testing.T) {
+	msg := bus.OutboundMessage{
+		ChatID:  "1",
+		Content: "Deploy?",
+		Buttons: [][]bus.Button{{{Text: "Yes"}, {Text: "No"}}, {{Text: "Later", Data: "later"}}},
+	}
+	got := runWorkerOnce(t, &mockChannelWithLength{}, msg, 1)
+	if got[0].Content != "Deploy?\n[Yes] [No]\n[Later]" || got[0].Buttons != nil {
+		t.Fatalf("sent %+v", got[0])
+	}
+}
+
+func TestRunWorker_ButtonsOnLastChunk(t *testing.T) {
+	msg := bus.OutboundMessage{
+		ChatID:  "1",
+		Content: "hello world",
+		Buttons: [][]bus.Button{{{Text: "OK"}}},
+	}
+	chunks := len(SplitMessage(msg.Content, 5))
+	got := runWorkerOnce(t, &mockButtonChannel{mockChannelWithLength: mockChannelWithLength{maxLen: 5}}, msg, chunks)
+	for i, m := range got[:len(got)-1] {
+		if m.Buttons != nil {
+			t.Fatalf("chunk %d has buttons", i)
+		}
+	}
+	if last := got[len(got)-1]; len(last.Buttons) != 1 {
+		t.Fatalf("last chunk = %+v", last)
+	}
+}
+
+func TestRunWorker_RendersTextFormat(t *testing.T) {
+	ch := &mockChannelWithLength{maxLen: 40}
+	ch.textFormat = format.TelegramHTML
+	msg := bus.OutboundMessage{
+		ChatID:  "1",
+		Content: "**Status:** all good\n\n```\nline one\nline two\nline three\n```",
+	}
+	want := format.Split(msg.Content, format.TelegramHTML, 40)
+	got := runWorkerOnce(t, ch, msg, len(want))
+	for i, m := range got {
+		if m.Content != want[i] {
+			t.Fatalf("chunk %d = %q, want %q", i, m.Content, want[i])
+		}
+		if strings.Count(m.Content, "<pre>") != strings.Count(m.Content, "</pre>") {
+			t.Fatalf("chunk %d breaks a code block: %q", i, m.Content)
+		}
+	}
+	if got[0].Content != "<b>Status:</b> all good" {
+		t.Fatalf("first chunk = %q", got[0].Content)
+	}
+}
+
+func TestPreSend_PlaceholderEditWithButtons(t *testing.T) {
+	m := newTestManager()
+	var gotButtons [][]bus.Button
+	ch := &mockButtonChannel{
+		editFn: func(_ context.Context, chatID, messageID, content string, buttons [][]bus.Button) error {
+			if chatID != "123" || messageID != "456" || content != "pick one" {
+				t.Fatalf("edit(%s, %s, %q)", chatID, messageID, content)
+			}
+			gotButtons = buttons
+			return nil
+		},
+	}
+	m.RecordPlaceholder("test", "123", "456")
+
+	msg := bus.OutboundMessage{ChatID: "123", Content: "pick one", Buttons: [][]bus.Button{{{Text: "A"}}}}
+	if !m.preSend(context.Background(), "test", msg, ch) {
+		t.Fatal("expected placeholder to be edited")
+	}
+	if len(gotButtons) != 1 || gotButtons[0][0].Value() != "A" {
+		t.Fatalf("buttons = %+v", gotButtons)
+	}
+}
@@ -0,0 +1,308 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// client is a minimal Matrix client-server API client covering what the
+// channel needs: sync, joins, sending and redacting events, typing
+// notifications and the content repository.
+type client struct {
+	homeserver  string
+	accessToken string
+	http        *http.Client
+	txnPrefix   string
+	txnCounter  atomic.Uint64
+}
+
+func newClient(homeserver, accessToken string) *client {
+	return &client{
+		homeserver:  strings.TrimRight(homeserver, "/"),
+		accessToken: accessToken,
+		http:        &http.Client{},
+		txnPrefix:   strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+// apiError is an error response from the homeserver.
+type apiError struct {
+	Status  int
+	ErrCode string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+func (e *apiError) Error() string {
+	if e.ErrCode == "" {
+		return fmt.Sprintf("matrix: HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("matrix: HTTP %d %s: %s", e.Status, e.ErrCode, e.Message)
+}
+
+// do sends a request and decodes a JSON response into out (if non-nil).
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	resp, err := c.request(ctx, method, path, query, reader, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// request sends a raw request and returns the response if it succeeded.
+func (c *client) request(
+	ctx context.Context,
+	method, path string,
+	query url.Values,
+	body io.Reader,
+	contentType string,
+) (*http.Response, error) {
+	u := c.homeserver + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		apiErr := &apiError{Status: resp.StatusCode}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(apiErr)
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+func (c *client) nextTxnID() string {
+	return c.txnPrefix + "." + strconv.FormatUint(c.txnCounter.Add(1), 10)
+}
+
+func roomPath(roomID string, parts ...string) string {
+	p := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID)
+	for _, part := range parts {
+		p += "/" + url.PathEscape(part)
+	}
+	return p
+}
+
+func (c *client) whoami(ctx context.Context) (string, error) {
+	var resp struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.UserID, nil
+}
+
+func (c *client) displayName(ctx context.Context, userID string) (string, error) {
+	var resp struct {
+		DisplayName string `json:"displayname"`
+	}
+	path := "/_matrix/client/v3/profile/" + url.PathEscape(userID) + "/displayname"
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.DisplayName, nil
+}
+
+// syncFilter keeps sync responses small: no presence or account data, and
+// lazy-loaded members.
+const syncFilter = `{"presence":{"not_types":["*"]},"account_data":{"not_types":["*"]},` +
+	`"room":{"state":{"lazy_load_members":true},"timeline":{"limit":50},` +
+	`"ephemeral":{"not_types":["*"]},"account_data":{"not_types":["*"]}}}`
+
+func (c *client) sync(ctx context.Context, since string, timeout time.Duration) (*syncResponse, error) {
+	query := url.Values{
+		"timeout": {strconv.FormatInt(timeout.Milliseconds(), 10)},
+		"filter":  {syncFilter},
+	}
+	if since != "" {
+		query.Set("since", since)
+	}
+	var resp syncResponse
+	if err := c.do(ctx, http.MethodGet, "/_matrix/client/v3/sync", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *client) joinRoom(ctx context.Context, roomID string) error {
+	return c.do(ctx, http.MethodPost, roomPath(roomID, "join"), nil, struct{}{}, nil)
+}
+
+func (c *client) leaveRoom(ctx context.Context, roomID string) error {
+	return c.do(ctx, http.MethodPost, roomPath(roomID, "leave"), nil, struct{}{}, nil)
+}
+
+func (c *client) joinedMemberCount(ctx context.Context, roomID string) (int, error) {
+	var resp struct {
+		Joined map[string]json.RawMessage `json:"joined"`
+	}
+	if err := c.do(ctx, http.MethodGet, roomPath(roomID, "joined_members"), nil, nil, &resp); err != nil {
+		return 0, err
+	}
+	return len(resp.Joined), nil
+}
+
+// sendEvent sends a room event and returns its event ID.
+func (c *client) sendEvent(ctx context.Context, roomID, eventType string, content any) (string, error) {
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	path := roomPath(roomID, "send", eventType, c.nextTxnID())
+	if err := c.do(ctx, http.MethodPut, path, nil, content, &resp); err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+func (c *client) redact(ctx context.Context, roomID, eventID string) error {
+	path := roomPath(roomID, "redact", eventID, c.nextTxnID())
+	return c.do(ctx, http.MethodPut, path, nil, struct{}{}, nil)
+}
+
+func (c *client) setTyping(ctx context.Context, roomID, userID string, typing bool, timeout time.Duration) error {
+	body := map[string]any{"typing": typing}
+	if typing {
+		body["timeout"] = timeout.Milliseconds()
+	}
+	return c.do(ctx, http.MethodPut, roomPath(roomID, "typing", userID), nil, body, nil)
+}
+
+// upload stores data in the content repository and returns its mxc:// URI.
+func (c *client) upload(ctx context.Context, r io.Reader, filename, contentType string) (string, error) {
+	resp, err := c.request(ctx, http.MethodPost, "/_matrix/media/v3/upload",
+		url.Values{"filename": {filename}}, r, contentType)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	return out.ContentURI, nil
+}
+
+// download fetches an mxc:// URI. It uses the authenticated media endpoint
+// and falls back to the legacy one for older homeservers.
+func (c *client) download(ctx context.Context, mxc string) (io.ReadCloser, error) {
+	server, mediaID, ok := parseMXC(mxc)
+	if !ok {
+		return nil, fmt.Errorf("matrix: invalid content URI %q", mxc)
+	}
+	suffix := "/" + url.PathEscape(server) + "/" + url.PathEscape(mediaID)
+
+	resp, err := c.request(ctx, http.MethodGet, "/_matrix/client/v1/media/download"+suffix, nil, nil, "")
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound || apiErr.ErrCode == "M_UNRECOGNIZED") {
+		resp, err = c.request(ctx, http.MethodGet, "/_matrix/media/v3/download"+suffix, nil, nil, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func parseMXC(uri string) (server, mediaID string, ok bool) {
+	rest, found := strings.CutPrefix(uri, "mxc://")
+	if !found {
+		return "", "", false
+	}
+	server, mediaID, ok = strings.Cut(rest, "/")
+	return server, mediaID, ok && server != "" && mediaID != ""
+}
+
+// syncResponse is the subset of the /sync response the channel reads.
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join   map[string]joinedRoom  `json:"join"`
+		Invite map[string]invitedRoom `json:"invite"`
+	} `json:"rooms"`
+}
+
+type joinedRoom struct {
+	Summary struct {
+		JoinedMemberCount *int `json:"m.joined_member_count"`
+	} `json:"summary"`
+	Timeline struct {
+		Events []event `json:"events"`
+	} `json:"timeline"`
+}
+
+type invitedRoom struct {
+	InviteState struct {
+		Events []event `json:"events"`
+	} `json:"invite_state"`
+}
+
+type event struct {
+	Type     string          `json:"type"`
+	EventID  string          `json:"event_id"`
+	Sender   string          `json:"sender"`
+	StateKey *string         `json:"state_key"`
+	Content  json.RawMessage `json:"content"`
+}
+
+// messageContent is the content of an m.room.message event.
+type messageContent struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+	URL           string `json:"url,omitempty"`
+	FileName      string `json:"filename,omitempty"`
+	Info          *struct {
+		MimeType string `json:"mimetype,omitempty"`
+		Size     int64  `json:"size,omitempty"`
+	} `json:"info,omitempty"`
+	Mentions *struct {
+		UserIDs []string `json:"user_ids,omitempty"`
+		Room    bool     `json:"room,omitempty"`
+	} `json:"m.mentions,omitempty"`
+	RelatesTo *struct {
+		RelType   string `json:"rel_type,omitempty"`
+		EventID   string `json:"event_id,omitempty"`
+		InReplyTo *struct {
+			EventID string `json:"event_id"`
+		} `json:"m.in_reply_to,omitempty"`
+	} `json:"m.relates_to,omitempty"`
+}
@@ -0,0 +1,152 @@
+package matrix
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	reHeading    = regexp.MustCompile(`^(#{1,6})\s+(.+)$`)
+	reBlockquote = regexp.MustCompile(`^>\s?(.*)$`)
+	reBullet     = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	reNumbered   = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	reLink       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	reBoldStar   = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	reBoldUnder  = regexp.MustCompile(`__(.+?)__`)
+	reItalicStar = regexp.MustCompile(`(^|[^*\w])\*([^*\s][^*]*?)\*`)
+	reItalic     = regexp.MustCompile(`(^|[^_\w])_([^_]+)_`)
+	reStrike     = regexp.MustCompile(`~~(.+?)~~`)
+	reCodeBlock  = regexp.MustCompile("(?s)```([\\w+-]*)\\n?(.*?)```")
+	reInlineCode = regexp.MustCompile("`([^`\n]+)`")
+)
+
+// markdownToMatrixHTML converts the markdown subset models typically produce
+// into the HTML Matrix clients render: headings, quotes, lists, code, links
+// and emphasis. It returns "" when the text has no formatting, so plain
+// replies are sent without a formatted body.
+func markdownToMatrixHTML(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	var blocks []string
+	text = reCodeBlock.ReplaceAllStringFunc(text, func(m string) string {
+		match := reCodeBlock.FindStringSubmatch(m)
+		code := html.EscapeString(strings.TrimSuffix(match[2], "\n"))
+		block := "<pre><code>" + code + "</code></pre>"
+		if match[1] != "" {
+			block = fmt.Sprintf(`<pre><code class="language-%s">%s</code></pre>`, html.EscapeString(match[1]), code)
+		}
+		blocks = append(blocks, block)
+		return fmt.Sprintf("\x00CB%d\x00", len(blocks)-1)
+	})
+
+	var out []string
+	var list []string
+	listTag := ""
+	var quote []string
+	flushList := func() {
+		if len(list) > 0 {
+			out = append(out, "<"+listTag+">"+strings.Join(list, "")+"</"+listTag+">")
+			list, listTag = nil, ""
+		}
+	}
+	flushQuote := func() {
+		if len(quote) > 0 {
+			out = append(out, "<blockquote>"+strings.Join(quote, "<br>")+"</blockquote>")
+			quote = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if m := reBlockquote.FindStringSubmatch(line); m != nil {
+			flushList()
+			quote = append(quote, inlineMarkdown(m[1]))
+			continue
+		}
+		flushQuote()
+
+		if m := reBullet.FindStringSubmatch(line); m != nil {
+			if listTag != "ul" {
+				flushList()
+				listTag = "ul"
+			}
+			list = append(list, "<li>"+inlineMarkdown(m[1])+"</li>")
+			continue
+		}
+		if m := reNumbered.FindStringSubmatch(line); m != nil {
+			if listTag != "ol" {
+				flushList()
+				listTag = "ol"
+			}
+			list = append(list, "<li>"+inlineMarkdown(m[1])+"</li>")
+			continue
+		}
+		flushList()
+
+		if m := reHeading.FindStringSubmatch(line); m != nil {
+			n := len(m[1])
+			out = append(out, fmt.Sprintf("<h%d>%s</h%d>", n, inlineMarkdown(m[2]), n))
+			continue
+		}
+		out = append(out, inlineMarkdown(line))
+	}
+	flushList()
+	flushQuote()
+
+	result := joinBlocks(out)
+	for i, block := range blocks {
+		result = strings.ReplaceAll(result, fmt.Sprintf("\x00CB%d\x00", i), block)
+	}
+
+	if result == html.EscapeString(text) {
+		return ""
+	}
+	return result
+}
+
+// joinBlocks joins rendered lines with <br>, except around block elements
+// that already break the line.
+func joinBlocks(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 && !isBlockHTML(lines[i-1]) && !isBlockHTML(line) {
+			b.WriteString("<br>")
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+func isBlockHTML(s string) bool {
+	for _, prefix := range []string{"<ul>", "<ol>", "<blockquote>", "<h1>", "<h2>", "<h3>", "<h4>", "<h5>", "<h6>", "\x00CB"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineMarkdown renders the inline markup of a single line.
+func inlineMarkdown(line string) string {
+	var codes []string
+	line = reInlineCode.ReplaceAllStringFunc(line, func(m string) string {
+		codes = append(codes, "<code>"+html.EscapeString(reInlineCode.FindStringSubmatch(m)[1])+"</code>")
+		return fmt.Sprintf("\x00IC%d\x00", len(codes)-1)
+	})
+
+	line = html.EscapeString(line)
+	line = reLink.ReplaceAllString(line, `<a href="$2">$1</a>`)
+	line = reBoldStar.ReplaceAllString(line, "<strong>$1</strong>")
+	line = reBoldUnder.ReplaceAllString(line, "<strong>$1</strong>")
+	line = reItalicStar.ReplaceAllString(line, "$1<em>$2</em>")
+	line = reItalic.ReplaceAllString(line, "$1<em>$2</em>")
+	line = reStrike.ReplaceAllString(line, "<del>$1</del>")
+
+	for i, code := range codes {
+		line = strings.ReplaceAll(line, fmt.Sprintf("\x00IC%d\x00", i), code)
+	}
+	return line
+}
@@ -0,0 +1,742 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	maxMessageLength = 20000
+	maxDownloadSize  = 50 << 20
+	typingTimeout    = 30 * time.Second
+	minRetryDelay    = 2 * time.Second
+	maxRetryDelay    = 2 * time.Minute
+)
+
+// MatrixChannel implements the Channel interface for Matrix using the
+// client-server API: it long-polls /sync for room events and sends replies
+// as m.notice messages with an HTML formatted body.
+type MatrixChannel struct {
+	*channels.BaseChannel
+	config      config.MatrixConfig
+	client      *client
+	storePath   string
+	userID      string
+	displayName string
+	members     sync.Map // roomID -> joined member count
+	encrypted   sync.Map // roomID -> struct{}, rooms already warned about
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// NewMatrixChannel creates a new Matrix channel instance. The sync token is
+// kept in storePath.
+func NewMatrixChannel(cfg config.MatrixConfig, messageBus *bus.MessageBus, storePath string) (*MatrixChannel, error) {
+	if cfg.Homeserver == "" || cfg.AccessToken == "" {
+		return nil, fmt.Errorf("matrix homeserver and access_token are required")
+	}
+
+	// Matrix user IDs contain a colon, so "@alice:example.org" would be read
+	// as a canonical "platform:id" entry; qualify them with the platform.
+	allowFrom := make([]string, 0, len(cfg.AllowFrom))
+	for _, entry := range cfg.AllowFrom {
+		entry = strings.TrimSpace(entry)
+		if strings.HasPrefix(entry, "@") && strings.Contains(entry, ":") {
+			entry = identity.BuildCanonicalID("matrix", entry)
+		}
+		allowFrom = append(allowFrom, entry)
+	}
+
+	base := channels.NewBaseChannel("matrix", cfg, messageBus, allowFrom,
+		channels.WithMaxMessageLength(maxMessageLength),
+		channels.WithGroupTrigger(cfg.GroupTrigger),
+		channels.WithReasoningChannelID(cfg.ReasoningChannelID),
+	)
+
+	return &MatrixChannel{
+		BaseChannel: base,
+		config:      cfg,
+		client:      newClient(cfg.Homeserver, cfg.AccessToken),
+		storePath:   storePath,
+		userID:      cfg.UserID,
+	}, nil
+}
+
+// Start verifies the access token and begins syncing.
+func (c *MatrixChannel) Start(ctx context.Context) error {
+	logger.InfoC("matrix", "Starting Matrix channel")
+
+	userID, err := c.client.whoami(ctx)
+	if err != nil {
+		return fmt.Errorf("matrix: verify access token: %w", err)
+	}
+	if c.userID != "" && c.userID != userID {
+		logger.WarnCF("matrix", "Configured user_id does not match the access token", map[string]any{
+			"configured": c.userID,
+			"actual":     userID,
+		})
+	}
+	c.userID = userID
+
+	if name, err := c.client.displayName(ctx, userID); err == nil {
+		c.displayName = name
+	}
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	go c.syncLoop()
+
+	c.SetRunning(true)
+	logger.InfoCF("matrix", "Matrix channel started", map[string]any{
+		"user_id":      c.userID,
+		"display_name": c.displayName,
+	})
+	return nil
+}
+
+// Stop ends the sync loop.
+func (c *MatrixChannel) Stop(ctx context.Context) error {
+	logger.InfoC("matrix", "Stopping Matrix channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.done != nil {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+		}
+	}
+
+	c.SetRunning(false)
+	logger.InfoC("matrix", "Matrix channel stopped")
+	return nil
+}
+
+// Send posts msg.Content to the room msg.ChatID as an m.notice.
+func (c *MatrixChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+	if _, err := c.client.sendEvent(ctx, msg.ChatID, "m.room.message", noticeContent(msg.Content)); err != nil {
+		return classifyError(err)
+	}
+	return nil
+}
+
+// StartTyping implements channels.TypingCapable. The typing notification is
+// renewed until stop is called, since homeservers expire it after a timeout.
+func (c *MatrixChannel) StartTyping(ctx context.Context, chatID string) (func(), error) {
+	if err := c.client.setTyping(ctx, chatID, c.userID, true, typingTimeout); err != nil {
+		return func() {}, err
+	}
+
+	typingCtx, cancel := context.WithCancel(c.ctx)
+	go func() {
+		ticker := time.NewTicker(typingTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-typingCtx.Done():
+				// Clear the indicator; the typing context is already done.
+				clearCtx, clearCancel := context.WithTimeout(context.Background(), 5*time.Second)
+				c.client.setTyping(clearCtx, chatID, c.userID, false, 0)
+				clearCancel()
+				return
+			case <-ticker.C:
+				c.client.setTyping(typingCtx, chatID, c.userID, true, typingTimeout)
+			}
+		}
+	}()
+
+	return cancel, nil
+}
+
+// EditMessage implements channels.MessageEditor with an m.replace event.
+func (c *MatrixChannel) EditMessage(ctx context.Context, chatID string, messageID string, content string) error {
+	newContent := noticeContent(content)
+	edit := noticeContent("* " + content)
+	edit["m.new_content"] = newContent
+	edit["m.relates_to"] = map[string]any{
+		"rel_type": "m.replace",
+		"event_id": messageID,
+	}
+	if _, err := c.client.sendEvent(ctx, chatID, "m.room.message", edit); err != nil {
+		return classifyError(err)
+	}
+	return nil
+}
+
+// SendPlaceholder implements channels.PlaceholderCapable.
+// It sends a placeholder message (e.g. "Thinking... 💭") that will later be
+// edited to the actual response via EditMessage (channels.MessageEditor).
+func (c *MatrixChannel) SendPlaceholder(ctx context.Context, chatID string) (string, error) {
+	if !c.config.Placeholder.Enabled {
+		return "", nil
+	}
+
+	text := c.config.Placeholder.Text
+	if text == "" {
+		text = "Thinking... 💭"
+	}
+
+	return c.client.sendEvent(ctx, chatID, "m.room.message", map[string]any{
+		"msgtype": "m.notice",
+		"body":    text,
+	})
+}
+
+// ReactToMessage implements channels.ReactionCapable.
+// It adds an "eyes" (👀) reaction to the inbound message and returns an undo
+// function that redacts the reaction.
+func (c *MatrixChannel) ReactToMessage(ctx context.Context, chatID, messageID string) (func(), error) {
+	reactionID, err := c.client.sendEvent(ctx, chatID, "m.reaction", map[string]any{
+		"m.relates_to": map[string]any{
+			"rel_type": "m.annotation",
+			"event_id": messageID,
+			"key":      "👀",
+		},
+	})
+	if err != nil {
+		return func() {}, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			undoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := c.client.redact(undoCtx, chatID, reactionID); err != nil {
+				logger.DebugCF("matrix", "Failed to remove reaction", map[string]any{
+					"room_id": chatID,
+					"error":   err.Error(),
+				})
+			}
+		})
+	}, nil
+}
+
+// SendMedia implements the channels.MediaSender interface. Each part is
+// uploaded to the content repository and sent as its own message.
+func (c *MatrixChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+
+	store := c.GetMediaStore()
+	if store == nil {
+		return fmt.Errorf("no media store available: %w", channels.ErrSendFailed)
+	}
+
+	for _, part := range msg.Parts {
+		localPath, err := store.Resolve(part.Ref)
+		if err != nil {
+			logger.ErrorCF("matrix", "Failed to resolve media ref", map[string]any{
+				"ref":   part.Ref,
+				"error": err.Error(),
+			})
+			continue
+		}
+		if err := c.sendFile(ctx, msg.ChatID, localPath, part); err != nil {
+			logger.ErrorCF("matrix", "Failed to send media", map[string]any{
+				"room_id": msg.ChatID,
+				"error":   err.Error(),
+			})
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *MatrixChannel) sendFile(ctx context.Context, roomID, localPath string, part bus.MediaPart) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("matrix send media: %v: %w", err, channels.ErrSendFailed)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("matrix send media: %v: %w", err, channels.ErrSendFailed)
+	}
+
+	filename := part.Filename
+	if filename == "" {
+		filename = filepath.Base(localPath)
+	}
+	contentType := part.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if contentType == "" {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		contentType = http.DetectContentType(head[:n])
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("matrix send media: %v: %w", err, channels.ErrSendFailed)
+		}
+	}
+
+	uri, err := c.client.upload(ctx, f, filename, contentType)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	content := map[string]any{
+		"msgtype":  mediaMsgType(part.Type, contentType),
+		"body":     filename,
+		"filename": filename,
+		"url":      uri,
+		"info": map[string]any{
+			"mimetype": contentType,
+			"size":     info.Size(),
+		},
+	}
+	// Since Matrix 1.10 a body that differs from the filename is a caption.
+	if part.Caption != "" {
+		content["body"] = part.Caption
+	}
+	if _, err := c.client.sendEvent(ctx, roomID, "m.room.message", content); err != nil {
+		return classifyError(err)
+	}
+	return nil
+}
+
+func mediaMsgType(partType, contentType string) string {
+	switch {
+	case partType == "image" || strings.HasPrefix(contentType, "image/"):
+		return "m.image"
+	case partType == "audio" || strings.HasPrefix(contentType, "audio/"):
+		return "m.audio"
+	case partType == "video" || strings.HasPrefix(contentType, "video/"):
+		return "m.video"
+	default:
+		return "m.file"
+	}
+}
+
+// noticeContent renders markdown text as an m.notice with an HTML body.
+func noticeContent(text string) map[string]any {
+	content := map[string]any{
+		"msgtype": "m.notice",
+		"body":    text,
+	}
+	if formatted := markdownToMatrixHTML(text); formatted != "" {
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = formatted
+	}
+	return content
+}
+
+// classifyError maps a client error to the channel error sentinels.
+func classifyError(err error) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return channels.ClassifySendError(apiErr.Status, err)
+	}
+	return channels.ClassifyNetError(err)
+}
+
+// syncLoop long-polls /sync until the channel stops, persisting the sync
+// token after every batch.
+func (c *MatrixChannel) syncLoop() {
+	defer close(c.done)
+
+	since := c.loadSyncToken()
+	timeout := time.Duration(c.config.SyncTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	delay := minRetryDelay
+	for {
+		reqCtx, cancel := context.WithTimeout(c.ctx, timeout+30*time.Second)
+		resp, err := c.client.sync(reqCtx, since, timeout)
+		cancel()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.WarnCF("matrix", "Sync failed, retrying", map[string]any{
+				"error": err.Error(),
+				"retry": delay.String(),
+			})
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxRetryDelay)
+			continue
+		}
+		delay = minRetryDelay
+
+		// Without a stored token this is the initial sync: accept invites
+		// but do not answer the room history it returns.
+		c.processSync(resp, since == "")
+		if resp.NextBatch != "" && resp.NextBatch != since {
+			since = resp.NextBatch
+			c.saveSyncToken(since)
+		}
+	}
+}
+
+func (c *MatrixChannel) processSync(resp *syncResponse, initial bool) {
+	for roomID, room := range resp.Rooms.Invite {
+		c.handleInvite(roomID, room)
+	}
+	for roomID, room := range resp.Rooms.Join {
+		if n := room.Summary.JoinedMemberCount; n != nil {
+			c.members.Store(roomID, *n)
+		}
+		if initial {
+			continue
+		}
+		for _, ev := range room.Timeline.Events {
+			c.handleEvent(roomID, ev)
+		}
+	}
+}
+
+// handleInvite joins rooms the bot is invited to by allowed users and
+// declines invites from everyone else.
+func (c *MatrixChannel) handleInvite(roomID string, room invitedRoom) {
+	inviter := ""
+	for _, ev := range room.InviteState.Events {
+		if ev.Type != "m.room.member" || ev.StateKey == nil || *ev.StateKey != c.userID {
+			continue
+		}
+		var member struct {
+			Membership string `json:"membership"`
+		}
+		if json.Unmarshal(ev.Content, &member) == nil && member.Membership == "invite" {
+			inviter = ev.Sender
+		}
+	}
+	if inviter == "" || !c.config.AutoJoin {
+		return
+	}
+
+	if !c.IsAllowedSender(senderInfo(inviter)) {
+		logger.InfoCF("matrix", "Declining invite from user not in allow_from", map[string]any{
+			"room_id": roomID,
+			"inviter": inviter,
+		})
+		if err := c.client.leaveRoom(c.ctx, roomID); err != nil {
+			logger.WarnCF("matrix", "Failed to decline invite", map[string]any{
+				"room_id": roomID,
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
+
+	if err := c.client.joinRoom(c.ctx, roomID); err != nil {
+		logger.ErrorCF("matrix", "Failed to join room", map[string]any{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+		return
+	}
+	logger.InfoCF("matrix", "Joined room", map[string]any{
+		"room_id": roomID,
+		"inviter": inviter,
+	})
+}
+
+func (c *MatrixChannel) handleEvent(roomID string, ev event) {
+	if ev.Sender == c.userID {
+		return
+	}
+	if ev.Type == "m.room.encrypted" {
+		if _, warned := c.encrypted.LoadOrStore(roomID, struct{}{}); !warned {
+			logger.WarnCF("matrix", "Ignoring encrypted room; end-to-end encryption is not supported", map[string]any{
+				"room_id": roomID,
+			})
+		}
+		return
+	}
+	if ev.Type != "m.room.message" {
+		return
+	}
+
+	var msg messageContent
+	if err := json.Unmarshal(ev.Content, &msg); err != nil {
+		return
+	}
+	// Edits repeat a message already handled; notices are how bots talk and
+	// answering them risks loops.
+	if msg.RelatesTo != nil && msg.RelatesTo.RelType == "m.replace" {
+		return
+	}
+	if msg.MsgType == "m.notice" || msg.MsgType == "" {
+		return
+	}
+
+	sender := senderInfo(ev.Sender)
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("matrix", "Message rejected by allowlist", map[string]any{
+			"sender": ev.Sender,
+		})
+		return
+	}
+
+	direct := c.isDirect(roomID)
+	scope := channels.BuildMediaScope("matrix", roomID, ev.EventID)
+
+	var content string
+	var mediaRefs []string
+	switch msg.MsgType {
+	case "m.image", "m.file", "m.audio", "m.video":
+		filename := msg.FileName
+		if filename == "" {
+			filename = msg.Body
+		}
+		if ref := c.downloadMedia(msg.URL, filename, msgContentType(msg), scope); ref != "" {
+			mediaRefs = append(mediaRefs, ref)
+		}
+		kind := strings.TrimPrefix(msg.MsgType, "m.")
+		content = fmt.Sprintf("[%s: %s]", kind, filename)
+		if msg.FileName != "" && msg.Body != "" && msg.Body != msg.FileName {
+			content = msg.Body + "\n" + content
+		}
+	case "m.emote":
+		content = "* " + stripReplyFallback(msg.Body)
+	default:
+		content = stripReplyFallback(msg.Body)
+	}
+
+	if !direct {
+		mentioned := c.isMentioned(msg)
+		content = c.stripMention(content)
+		respond, cleaned := c.ShouldRespondInGroup(mentioned, content)
+		if !respond {
+			return
+		}
+		content = cleaned
+	}
+
+	if strings.TrimSpace(content) == "" && len(mediaRefs) == 0 {
+		return
+	}
+
+	peer := bus.Peer{Kind: "group", ID: roomID}
+	if direct {
+		peer = bus.Peer{Kind: "direct", ID: ev.Sender}
+	}
+
+	metadata := map[string]string{
+		"event_id": ev.EventID,
+		"room_id":  roomID,
+		"platform": "matrix",
+	}
+	if msg.RelatesTo != nil && msg.RelatesTo.InReplyTo != nil {
+		metadata["reply_to"] = msg.RelatesTo.InReplyTo.EventID
+	}
+
+	logger.DebugCF("matrix", "Received message", map[string]any{
+		"sender_id": ev.Sender,
+		"room_id":   roomID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(c.ctx, peer, ev.EventID, ev.Sender, roomID, content, mediaRefs, metadata, sender)
+}
+
+func senderInfo(userID string) bus.SenderInfo {
+	return bus.SenderInfo{
+		Platform:    "matrix",
+		PlatformID:  userID,
+		CanonicalID: identity.BuildCanonicalID("matrix", userID),
+		Username:    userID,
+	}
+}
+
+// isDirect reports whether roomID is a one-to-one room.
+func (c *MatrixChannel) isDirect(roomID string) bool {
+	if n, ok := c.members.Load(roomID); ok {
+		return n.(int) <= 2
+	}
+	n, err := c.client.joinedMemberCount(c.ctx, roomID)
+	if err != nil {
+		logger.DebugCF("matrix", "Failed to count room members", map[string]any{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+		return false
+	}
+	c.members.Store(roomID, n)
+	return n <= 2
+}
+
+// isMentioned reports whether the message mentions the bot, either through
+// intentional mentions or, for older clients, by name or user ID in the body.
+func (c *MatrixChannel) isMentioned(msg messageContent) bool {
+	if msg.Mentions != nil {
+		for _, id := range msg.Mentions.UserIDs {
+			if id == c.userID {
+				return true
+			}
+		}
+		return false
+	}
+	if strings.Contains(msg.FormattedBody, "matrix.to/#/"+c.userID) {
+		return true
+	}
+	body := strings.ToLower(msg.Body)
+	if strings.Contains(body, strings.ToLower(c.userID)) {
+		return true
+	}
+	return c.displayName != "" && strings.Contains(body, strings.ToLower(c.displayName))
+}
+
+// stripMention removes a leading "Name:" or "@user:server" address from
+// content, as clients insert when the bot is mentioned.
+func (c *MatrixChannel) stripMention(content string) string {
+	trimmed := strings.TrimSpace(content)
+	for _, name := range []string{c.userID, c.displayName} {
+		if name == "" {
+			continue
+		}
+		if len(trimmed) >= len(name) && strings.EqualFold(trimmed[:len(name)], name) {
+			rest := strings.TrimLeft(trimmed[len(name):], ":, ")
+			return strings.TrimSpace(rest)
+		}
+	}
+	return content
+}
+
+// stripReplyFallback removes the quoted "> <@user> ..." block that clients
+// prepend to the body of replies.
+func stripReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	return strings.TrimSpace(strings.Join(lines[i:], "\n"))
+}
+
+func msgContentType(msg messageContent) string {
+	if msg.Info != nil {
+		return msg.Info.MimeType
+	}
+	return ""
+}
+
+// downloadMedia fetches an mxc:// URI into the media temp dir and registers it
+// with the media store. It returns "" on failure.
+func (c *MatrixChannel) downloadMedia(uri, filename, contentType, scope string) string {
+	if uri == "" {
+		return ""
+	}
+	body, err := c.client.download(c.ctx, uri)
+	if err != nil {
+		logger.ErrorCF("matrix", "Failed to download media", map[string]any{
+			"url":   uri,
+			"error": err.Error(),
+		})
+		return ""
+	}
+	defer body.Close()
+
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		return ""
+	}
+	f, err := os.CreateTemp(mediaDir, "matrix-*-"+utils.SanitizeFilename(filename))
+	if err != nil {
+		return ""
+	}
+	n, err := io.Copy(f, io.LimitReader(body, maxDownloadSize+1))
+	f.Close()
+	if err != nil || n > maxDownloadSize {
+		os.Remove(f.Name())
+		logger.WarnCF("matrix", "Media download failed or too large", map[string]any{
+			"url":  uri,
+			"size": n,
+		})
+		return ""
+	}
+
+	store := c.GetMediaStore()
+	if store == nil {
+		return f.Name()
+	}
+	ref, err := store.Store(f.Name(), media.MediaMeta{
+		Filename:    filename,
+		ContentType: contentType,
+		Source:      "matrix",
+	}, scope)
+	if err != nil {
+		os.Remove(f.Name())
+		return ""
+	}
+	return ref
+}
+
+type syncState struct {
+	UserID    string `json:"user_id"`
+	NextBatch string `json:"next_batch"`
+}
+
+func (c *MatrixChannel) syncStateFile() string {
+	return filepath.Join(c.storePath, "sync.json")
+}
+
+// loadSyncToken returns the stored next_batch token for this account, or ""
+// to start with an initial sync.
+func (c *MatrixChannel) loadSyncToken() string {
+	if c.storePath == "" {
+		return ""
+	}
+	data, err := os.ReadFile(c.syncStateFile())
+	if err != nil {
+		return ""
+	}
+	var st syncState
+	if json.Unmarshal(data, &st) != nil || st.UserID != c.userID {
+		return ""
+	}
+	return st.NextBatch
+}
+
+func (c *MatrixChannel) saveSyncToken(token string) {
+	if c.storePath == "" {
+		return
+	}
+	if err := os.MkdirAll(c.storePath, 0o700); err != nil {
+		logger.WarnCF("matrix", "Failed to create store directory", map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	data, _ := json.Marshal(syncState{UserID: c.userID, NextBatch: token})
+	if err := fileutil.WriteFileAtomic(c.syncStateFile(), data, 0o600); err != nil {
+		logger.WarnCF("matrix", "Failed to save sync token", map[string]any{
+			"error": err.Error(),
+		})
+	}
+}
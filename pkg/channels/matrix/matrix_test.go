@@ -0,0 +1,456 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/bus/bustest"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/media"
+)
+
+const botID = "@bot:test"
+
+// fakeHomeserver is a stand-in for the parts of the client-server API the
+// channel uses. Sync batches are served from a queue; requests that change
+// state are recorded.
+type fakeHomeserver struct {
+	t       *testing.T
+	batches chan map[string]any
+	members map[string]int
+
+	mu       sync.Mutex
+	since    []string
+	joined   []string
+	left     []string
+	sent     []sentEvent
+	redacted []string
+	typing   []bool
+	uploads  map[string][]byte
+	nextID   int
+}
+
+type sentEvent struct {
+	room, eventType string
+	content         map[string]any
+}
+
+func newFakeHomeserver(t *testing.T) (*fakeHomeserver, *httptest.Server) {
+	hs := &fakeHomeserver{
+		t:       t,
+		batches: make(chan map[string]any, 10),
+		members: map[string]int{},
+		uploads: map[string][]byte{},
+	}
+	srv := httptest.NewServer(hs)
+	t.Cleanup(srv.Close)
+	return hs, srv
+}
+
+func (hs *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"errcode": "M_UNKNOWN_TOKEN", "error": "bad token"})
+		return
+	}
+	path := r.URL.EscapedPath()
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "/_matrix/client/v3/account/whoami":
+		writeJSON(w, 200, map[string]any{"user_id": botID})
+
+	case strings.HasPrefix(path, "/_matrix/client/v3/profile/"):
+		writeJSON(w, 200, map[string]any{"displayname": "PicoBot"})
+
+	case path == "/_matrix/client/v3/sync":
+		hs.mu.Lock()
+		hs.since = append(hs.since, r.URL.Query().Get("since"))
+		hs.mu.Unlock()
+		select {
+		case batch := <-hs.batches:
+			writeJSON(w, 200, batch)
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+			writeJSON(w, 200, map[string]any{"next_batch": r.URL.Query().Get("since")})
+		}
+
+	case strings.HasSuffix(path, "/join"):
+		hs.record(func() { hs.joined = append(hs.joined, unescape(parts[5])) })
+		writeJSON(w, 200, map[string]any{"room_id": unescape(parts[5])})
+
+	case strings.HasSuffix(path, "/leave"):
+		hs.record(func() { hs.left = append(hs.left, unescape(parts[5])) })
+		writeJSON(w, 200, map[string]any{})
+
+	case strings.HasSuffix(path, "/joined_members"):
+		joined := map[string]any{}
+		for i := range hs.members[unescape(parts[5])] {
+			joined[fmt.Sprintf("@u%d:test", i)] = map[string]any{}
+		}
+		writeJSON(w, 200, map[string]any{"joined": joined})
+
+	case len(parts) > 7 && parts[6] == "send":
+		var content map[string]any
+		json.NewDecoder(r.Body).Decode(&content)
+		var id string
+		hs.record(func() {
+			hs.nextID++
+			id = fmt.Sprintf("$ev%d", hs.nextID)
+			hs.sent = append(hs.sent, sentEvent{room: unescape(parts[5]), eventType: parts[7], content: content})
+		})
+		writeJSON(w, 200, map[string]any{"event_id": id})
+
+	case len(parts) > 7 && parts[6] == "redact":
+		hs.record(func() { hs.redacted = append(hs.redacted, unescape(parts[7])) })
+		writeJSON(w, 200, map[string]any{"event_id": "$redaction"})
+
+	case len(parts) > 6 && parts[6] == "typing":
+		var body struct {
+			Typing bool `json:"typing"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		hs.record(func() { hs.typing = append(hs.typing, body.Typing) })
+		writeJSON(w, 200, map[string]any{})
+
+	case path == "/_matrix/media/v3/upload":
+		data, _ := io.ReadAll(r.Body)
+		hs.record(func() { hs.uploads[r.URL.Query().Get("filename")] = data })
+		writeJSON(w, 200, map[string]any{"content_uri": "mxc://test/uploaded"})
+
+	case strings.HasPrefix(path, "/_matrix/client/v1/media/download/"):
+		// An older homeserver without authenticated media.
+		writeJSON(w, 404, map[string]any{"errcode": "M_UNRECOGNIZED", "error": "unrecognized"})
+
+	case path == "/_matrix/media/v3/download/test/photo":
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png-bytes"))
+
+	default:
+		hs.t.Errorf("unexpected request %s %s", r.Method, path)
+		writeJSON(w, 404, map[string]any{"errcode": "M_UNRECOGNIZED"})
+	}
+}
+
+func (hs *fakeHomeserver) record(f func()) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	f()
+}
+
+func (hs *fakeHomeserver) sentEvents() []sentEvent {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return append([]sentEvent(nil), hs.sent...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func unescape(s string) string {
+	s = strings.ReplaceAll(s, "%21", "!")
+	s = strings.ReplaceAll(s, "%3A", ":")
+	s = strings.ReplaceAll(s, "%24", "$")
+	s = strings.ReplaceAll(s, "%40", "@")
+	return s
+}
+
+func message(id, sender string, content map[string]any) map[string]any {
+	return map[string]any{"type": "m.room.message", "event_id": id, "sender": sender, "content": content}
+}
+
+func joinBatch(next, room string, members int, events ...map[string]any) map[string]any {
+	return map[string]any{
+		"next_batch": next,
+		"rooms": map[string]any{
+			"join": map[string]any{
+				room: map[string]any{
+					"summary":  map[string]any{"m.joined_member_count": members},
+					"timeline": map[string]any{"events": events},
+				},
+			},
+		},
+	}
+}
+
+func newTestChannel(t *testing.T, url string, cfg config.MatrixConfig) (*MatrixChannel, *bus.MessageBus, string) {
+	t.Helper()
+	cfg.Homeserver = url
+	cfg.AccessToken = "token"
+	storePath := t.TempDir()
+	mb := bus.NewMessageBus()
+	ch, err := NewMatrixChannel(cfg, mb, storePath)
+	if err != nil {
+		t.Fatalf("NewMatrixChannel() error = %v", err)
+	}
+	ch.SetMediaStore(media.NewFileMediaStore())
+	return ch, mb, storePath
+}
+
+func TestMatrixChannel_SyncAndInvites(t *testing.T) {
+	hs, srv := newFakeHomeserver(t)
+	ch, mb, storePath := newTestChannel(t, srv.URL, config.MatrixConfig{
+		AutoJoin:     true,
+		AllowFrom:    config.FlexibleStringSlice{"@alice:test"},
+		GroupTrigger: config.GroupTriggerConfig{MentionOnly: true},
+	})
+
+	invite := func(room, inviter string) map[string]any {
+		return map[string]any{"invite_state": map[string]any{"events": []any{map[string]any{
+			"type": "m.room.member", "sender": inviter, "state_key": botID,
+			"content": map[string]any{"membership": "invite"},
+		}}}}
+	}
+	// The initial sync carries history that must not be answered.
+	initial := joinBatch("s1", "!dm:test", 2, message("$old", "@alice:test", map[string]any{"msgtype": "m.text", "body": "old"}))
+	initial["rooms"].(map[string]any)["invite"] = map[string]any{
+		"!friend:test":   invite("!friend:test", "@alice:test"),
+		"!stranger:test": invite("!stranger:test", "@mallory:test"),
+	}
+	hs.batches <- initial
+	hs.batches <- joinBatch("s2", "!dm:test", 2,
+		message("$1", "@mallory:test", map[string]any{"msgtype": "m.text", "body": "let me in"}),
+		message("$2", "@alice:test", map[string]any{"msgtype": "m.text", "body": "> <@bot:test> earlier\n\nhello"}),
+	)
+	hs.batches <- joinBatch("s3", "!group:test", 5,
+		message("$3", "@alice:test", map[string]any{"msgtype": "m.text", "body": "chatting among ourselves"}),
+		message("$4", "@alice:test", map[string]any{
+			"msgtype": "m.text", "body": "PicoBot: what's up?",
+			"m.mentions": map[string]any{"user_ids": []any{botID}},
+		}),
+		message("$5", botID, map[string]any{"msgtype": "m.notice", "body": "my own message"}),
+	)
+
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer ch.Stop(context.Background())
+
+	msg := bustest.Consume(t, mb)
+	if msg.ChatID != "!dm:test" || msg.Content != "hello" || msg.Peer.Kind != "direct" || msg.Peer.ID != "@alice:test" {
+		t.Errorf("DM message = %+v", msg)
+	}
+	if msg.SenderID != "matrix:@alice:test" || msg.MessageID != "$2" {
+		t.Errorf("sender = %q, message id = %q", msg.SenderID, msg.MessageID)
+	}
+
+	msg = bustest.Consume(t, mb)
+	if msg.ChatID != "!group:test" || msg.Content != "what's up?" || msg.Peer.Kind != "group" {
+		t.Errorf("group message = %+v", msg)
+	}
+
+	hs.mu.Lock()
+	joined, left := hs.joined, hs.left
+	hs.mu.Unlock()
+	if strings.Join(joined, ",") != "!friend:test" {
+		t.Errorf("joined = %v, want [!friend:test]", joined)
+	}
+	if strings.Join(left, ",") != "!stranger:test" {
+		t.Errorf("declined = %v, want [!stranger:test]", left)
+	}
+
+	// The sync token is persisted, so a restart resumes after s3.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(filepath.Join(storePath, "sync.json"))
+		if strings.Contains(string(data), `"next_batch":"s3"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sync token not persisted, got %s", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	ch.Stop(context.Background())
+
+	ch2, _, _ := newTestChannel(t, srv.URL, config.MatrixConfig{})
+	ch2.storePath = storePath
+	ch2.userID = botID
+	if got := ch2.loadSyncToken(); got != "s3" {
+		t.Errorf("loadSyncToken() = %q, want s3", got)
+	}
+}
+
+func TestMatrixChannel_SendEditReactTyping(t *testing.T) {
+	hs, srv := newFakeHomeserver(t)
+	ch, _, _ := newTestChannel(t, srv.URL, config.MatrixConfig{
+		Placeholder: config.PlaceholderConfig{Enabled: true},
+	})
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer ch.Stop(context.Background())
+	ctx := context.Background()
+
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "!r:test", Content: "**done**"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	phID, err := ch.SendPlaceholder(ctx, "!r:test")
+	if err != nil || phID == "" {
+		t.Fatalf("SendPlaceholder() = %q, %v", phID, err)
+	}
+	if err := ch.EditMessage(ctx, "!r:test", phID, "final answer"); err != nil {
+		t.Fatalf("EditMessage() error = %v", err)
+	}
+	undo, err := ch.ReactToMessage(ctx, "!r:test", "$in")
+	if err != nil {
+		t.Fatalf("ReactToMessage() error = %v", err)
+	}
+	undo()
+	undo()
+
+	events := hs.sentEvents()
+	if len(events) != 4 {
+		t.Fatalf("sent %d events, want 4", len(events))
+	}
+	if c := events[0].content; c["msgtype"] != "m.notice" || c["body"] != "**done**" ||
+		c["format"] != "org.matrix.custom.html" || c["formatted_body"] != "<strong>done</strong>" {
+		t.Errorf("notice = %v", c)
+	}
+	edit := events[2].content
+	rel, _ := edit["m.relates_to"].(map[string]any)
+	newContent, _ := edit["m.new_content"].(map[string]any)
+	if rel["rel_type"] != "m.replace" || rel["event_id"] != phID || newContent["body"] != "final answer" {
+		t.Errorf("edit = %v", edit)
+	}
+	if events[3].eventType != "m.reaction" {
+		t.Errorf("reaction event type = %q", events[3].eventType)
+	}
+	hs.mu.Lock()
+	redacted := hs.redacted
+	hs.mu.Unlock()
+	if len(redacted) != 1 || redacted[0] != "$ev4" {
+		t.Errorf("redacted = %v, want the reaction once", redacted)
+	}
+
+	stop, err := ch.StartTyping(ctx, "!r:test")
+	if err != nil {
+		t.Fatalf("StartTyping() error = %v", err)
+	}
+	stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hs.mu.Lock()
+		typing := append([]bool(nil), hs.typing...)
+		hs.mu.Unlock()
+		if len(typing) >= 2 && typing[0] && !typing[len(typing)-1] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("typing notifications = %v, want start then stop", typing)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestMatrixChannel_Media(t *testing.T) {
+	hs, srv := newFakeHomeserver(t)
+	ch, mb, _ := newTestChannel(t, srv.URL, config.MatrixConfig{})
+	hs.batches <- map[string]any{"next_batch": "s1"}
+	hs.batches <- joinBatch("s2", "!dm:test", 2, message("$img", "@alice:test", map[string]any{
+		"msgtype": "m.image", "body": "look at this", "filename": "photo.png", "url": "mxc://test/photo",
+		"info": map[string]any{"mimetype": "image/png"},
+	}))
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer ch.Stop(context.Background())
+
+	msg := bustest.Consume(t, mb)
+	if msg.Content != "look at this\n[image: photo.png]" || len(msg.Media) != 1 {
+		t.Fatalf("inbound media message = %+v", msg)
+	}
+	path, err := ch.GetMediaStore().Resolve(msg.Media[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "png-bytes" {
+		t.Errorf("downloaded media = %q", data)
+	}
+
+	out := filepath.Join(t.TempDir(), "report.pdf")
+	os.WriteFile(out, []byte("%PDF"), 0o600)
+	ref, _ := ch.GetMediaStore().Store(out, media.MediaMeta{Filename: "report.pdf"}, "test")
+	err = ch.SendMedia(context.Background(), bus.OutboundMediaMessage{
+		ChatID: "!dm:test",
+		Parts:  []bus.MediaPart{{Type: "file", Ref: ref, Caption: "Your report"}},
+	})
+	if err != nil {
+		t.Fatalf("SendMedia() error = %v", err)
+	}
+	hs.mu.Lock()
+	uploaded := string(hs.uploads["report.pdf"])
+	hs.mu.Unlock()
+	if uploaded != "%PDF" {
+		t.Errorf("uploaded = %q", uploaded)
+	}
+	events := hs.sentEvents()
+	c := events[len(events)-1].content
+	if c["msgtype"] != "m.file" || c["url"] != "mxc://test/uploaded" || c["body"] != "Your report" || c["filename"] != "report.pdf" {
+		t.Errorf("media event = %v", c)
+	}
+}
+
+func TestMatrixChannel_SendErrors(t *testing.T) {
+	_, srv := newFakeHomeserver(t)
+	ch, _, _ := newTestChannel(t, srv.URL, config.MatrixConfig{})
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "!r:test"}); !errors.Is(err, channels.ErrNotRunning) {
+		t.Errorf("Send() before Start error = %v, want ErrNotRunning", err)
+	}
+
+	bad, _, _ := newTestChannel(t, srv.URL, config.MatrixConfig{})
+	bad.client.accessToken = "wrong"
+	if err := bad.Start(context.Background()); err == nil {
+		t.Error("Start() with a bad token should fail")
+	}
+	bad.SetRunning(true)
+	err := bad.Send(context.Background(), bus.OutboundMessage{ChatID: "!r:test", Content: "hi"})
+	if !errors.Is(err, channels.ErrSendFailed) {
+		t.Errorf("Send() with a bad token error = %v, want ErrSendFailed", err)
+	}
+}
+
+func TestStripReplyFallback(t *testing.T) {
+	tests := map[string]string{
+		"plain":                            "plain",
+		"> <@a:b> quoted\n> more\n\nreply": "reply",
+		">not a fallback":                  ">not a fallback",
+	}
+	for in, want := range tests {
+		if got := stripReplyFallback(in); got != want {
+			t.Errorf("stripReplyFallback(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNewMatrixChannel_QualifiesAllowList(t *testing.T) {
+	ch, err := NewMatrixChannel(config.MatrixConfig{
+		Homeserver:  "https://example.org",
+		AccessToken: "t",
+		AllowFrom:   config.FlexibleStringSlice{"@alice:example.org"},
+	}, bus.NewMessageBus(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ch.IsAllowedSender(senderInfo("@alice:example.org")) {
+		t.Error("alice should be allowed")
+	}
+	if ch.IsAllowedSender(senderInfo("@bob:example.org")) {
+		t.Error("bob should not be allowed")
+	}
+}
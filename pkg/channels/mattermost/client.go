@@ -0,0 +1,213 @@
+package mattermost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// client is a minimal Mattermost REST API v4 client.
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newClient(serverURL, token string) *client {
+	return &client{
+		baseURL: strings.TrimRight(serverURL, "/"),
+		token:   token,
+		http:    &http.Client{},
+	}
+}
+
+// apiError is an error response from the server.
+type apiError struct {
+	Status  int
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("mattermost: HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("mattermost: HTTP %d: %s", e.Status, e.Message)
+}
+
+// do sends a JSON request and decodes the JSON response into out (if non-nil).
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	resp, err := c.request(ctx, method, path, reader, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// request sends a raw request and returns the response if it succeeded.
+func (c *client) request(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api/v4"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		apiErr := &apiError{Status: resp.StatusCode}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(apiErr)
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+type user struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// post is the subset of a Mattermost post the channel reads and writes.
+type post struct {
+	ID        string         `json:"id,omitempty"`
+	UserID    string         `json:"user_id,omitempty"`
+	ChannelID string         `json:"channel_id"`
+	RootID    string         `json:"root_id,omitempty"`
+	Message   string         `json:"message"`
+	Type      string         `json:"type,omitempty"`
+	FileIDs   []string       `json:"file_ids,omitempty"`
+	Props     map[string]any `json:"props,omitempty"`
+	Metadata  *struct {
+		Files []fileInfo `json:"files"`
+	} `json:"metadata,omitempty"`
+}
+
+type fileInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+func (c *client) me(ctx context.Context) (*user, error) {
+	var u user
+	if err := c.do(ctx, http.MethodGet, "/users/me", nil, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (c *client) createPost(ctx context.Context, p *post) (*post, error) {
+	var created post
+	if err := c.do(ctx, http.MethodPost, "/posts", p, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *client) patchPost(ctx context.Context, postID, message string) error {
+	return c.do(ctx, http.MethodPut, "/posts/"+url.PathEscape(postID)+"/patch",
+		map[string]any{"message": message}, nil)
+}
+
+func (c *client) addReaction(ctx context.Context, userID, postID, emoji string) error {
+	return c.do(ctx, http.MethodPost, "/reactions", map[string]any{
+		"user_id":    userID,
+		"post_id":    postID,
+		"emoji_name": emoji,
+	}, nil)
+}
+
+func (c *client) removeReaction(ctx context.Context, userID, postID, emoji string) error {
+	path := "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) +
+		"/reactions/" + url.PathEscape(emoji)
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+func (c *client) fileInfo(ctx context.Context, fileID string) (*fileInfo, error) {
+	var info fileInfo
+	if err := c.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"/info", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// downloadFile returns the content of an uploaded file.
+func (c *client) downloadFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	resp, err := c.request(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// uploadFile uploads r to channelID and returns the new file ID.
+func (c *client) uploadFile(ctx context.Context, channelID, filename string, r io.Reader) (string, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := mw.WriteField("channel_id", channelID)
+		if err == nil {
+			var part io.Writer
+			if part, err = mw.CreateFormFile("files", filename); err == nil {
+				if _, err = io.Copy(part, r); err == nil {
+					err = mw.Close()
+				}
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := c.request(ctx, http.MethodPost, "/files", pr, mw.FormDataContentType())
+	if err != nil {
+		pr.CloseWithError(err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		FileInfos []fileInfo `json:"file_infos"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if len(out.FileInfos) == 0 {
+		return "", fmt.Errorf("mattermost: upload returned no file")
+	}
+	return out.FileInfos[0].ID, nil
+}
+
+// websocketURL returns the URL of the server's WebSocket event stream.
+func (c *client) websocketURL() string {
+	u := c.baseURL + "/api/v4/websocket"
+	if rest, ok := strings.CutPrefix(u, "https://"); ok {
+		return "wss://" + rest
+	}
+	return "ws://" + strings.TrimPrefix(u, "http://")
+}
@@ -0,0 +1,718 @@
+package mattermost
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	maxMessageLength = 16000
+	maxDownloadSize  = 50 << 20
+	pingInterval     = 30 * time.Second
+	readTimeout      = 90 * time.Second
+	reactionEmoji    = "eyes"
+)
+
+// Reconnect backoff; variables so tests can shorten them.
+var (
+	minRetryDelay = 2 * time.Second
+	maxRetryDelay = 2 * time.Minute
+)
+
+// MattermostChannel implements the Channel interface for Mattermost using
+// the WebSocket event stream for inbound posts and the REST API for replies.
+//
+// Chat IDs are "<channelID>" or "<channelID>/<rootPostID>". Posts in
+// channels are answered in a thread, so every thread is its own session;
+// direct messages stay flat unless the user replies in a thread.
+type MattermostChannel struct {
+	*channels.BaseChannel
+	config   config.MattermostConfig
+	client   *client
+	botID    string
+	botName  string
+	mentionR *regexp.Regexp
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewMattermostChannel creates a new Mattermost channel instance.
+func NewMattermostChannel(cfg config.MattermostConfig, messageBus *bus.MessageBus) (*MattermostChannel, error) {
+	if cfg.ServerURL == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("mattermost server_url and token are required")
+	}
+	if !strings.HasPrefix(cfg.ServerURL, "http://") && !strings.HasPrefix(cfg.ServerURL, "https://") {
+		return nil, fmt.Errorf("mattermost server_url must start with http:// or https://")
+	}
+
+	base := channels.NewBaseChannel("mattermost", cfg, messageBus, cfg.AllowFrom,
+		channels.WithMaxMessageLength(maxMessageLength),
+		channels.WithTextFormat(format.Markdown),
+		channels.WithGroupTrigger(cfg.GroupTrigger),
+		channels.WithReasoningChannelID(cfg.ReasoningChannelID),
+	)
+
+	return &MattermostChannel{
+		BaseChannel: base,
+		config:      cfg,
+		client:      newClient(cfg.ServerURL, cfg.Token),
+	}, nil
+}
+
+// Start verifies the token and connects to the event stream.
+func (c *MattermostChannel) Start(ctx context.Context) error {
+	logger.InfoC("mattermost", "Starting Mattermost channel")
+
+	me, err := c.client.me(ctx)
+	if err != nil {
+		return fmt.Errorf("mattermost: verify token: %w", err)
+	}
+	c.botID = me.ID
+	c.botName = me.Username
+	c.mentionR = regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(me.Username) + `\b`)
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	go c.eventLoop()
+
+	c.SetRunning(true)
+	logger.InfoCF("mattermost", "Mattermost channel started", map[string]any{
+		"user_id":  c.botID,
+		"username": c.botName,
+	})
+	return nil
+}
+
+// Stop closes the event stream.
+func (c *MattermostChannel) Stop(ctx context.Context) error {
+	logger.InfoC("mattermost", "Stopping Mattermost channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.done != nil {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+		}
+	}
+
+	c.SetRunning(false)
+	logger.InfoC("mattermost", "Mattermost channel stopped")
+	return nil
+}
+
+// Send posts msg.Content to the channel or thread msg.ChatID.
+func (c *MattermostChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+
+	channelID, rootID := parseChatID(msg.ChatID)
+	_, err := c.client.createPost(ctx, &post{
+		ChannelID: channelID,
+		RootID:    rootID,
+		Message:   msg.Content,
+	})
+	if err != nil {
+		return classifyError(err)
+	}
+	return nil
+}
+
+// EditMessage implements channels.MessageEditor.
+func (c *MattermostChannel) EditMessage(ctx context.Context, chatID string, messageID string, content string) error {
+	if err := c.client.patchPost(ctx, messageID, content); err != nil {
+		return classifyError(err)
+	}
+	return nil
+}
+
+// SendPlaceholder implements channels.PlaceholderCapable.
+// It sends a placeholder message (e.g. "Thinking... 💭") that will later be
+// edited to the actual response via EditMessage (channels.MessageEditor).
+func (c *MattermostChannel) SendPlaceholder(ctx context.Context, chatID string) (string, error) {
+	if !c.config.Placeholder.Enabled {
+		return "", nil
+	}
+
+	text := c.config.Placeholder.Text
+	if text == "" {
+		text = "Thinking... 💭"
+	}
+
+	channelID, rootID := parseChatID(chatID)
+	p, err := c.client.createPost(ctx, &post{
+		ChannelID: channelID,
+		RootID:    rootID,
+		Message:   text,
+	})
+	if err != nil {
+		return "", err
+	}
+	return p.ID, nil
+}
+
+// ReactToMessage implements channels.ReactionCapable.
+// It adds an "eyes" (👀) reaction to the inbound post and returns an undo
+// function that removes it.
+func (c *MattermostChannel) ReactToMessage(ctx context.Context, chatID, messageID string) (func(), error) {
+	if err := c.client.addReaction(ctx, c.botID, messageID, reactionEmoji); err != nil {
+		return func() {}, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			undoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := c.client.removeReaction(undoCtx, c.botID, messageID, reactionEmoji); err != nil {
+				logger.DebugCF("mattermost", "Failed to remove reaction", map[string]any{
+					"post_id": messageID,
+					"error":   err.Error(),
+				})
+			}
+		})
+	}, nil
+}
+
+// SendMedia implements the channels.MediaSender interface. Each part is
+// uploaded and attached to its own post, with the caption as the message.
+func (c *MattermostChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+
+	store := c.GetMediaStore()
+	if store == nil {
+		return fmt.Errorf("no media store available: %w", channels.ErrSendFailed)
+	}
+
+	channelID, rootID := parseChatID(msg.ChatID)
+	for _, part := range msg.Parts {
+		localPath, err := store.Resolve(part.Ref)
+		if err != nil {
+			logger.ErrorCF("mattermost", "Failed to resolve media ref", map[string]any{
+				"ref":   part.Ref,
+				"error": err.Error(),
+			})
+			continue
+		}
+		if err := c.sendFile(ctx, channelID, rootID, localPath, part); err != nil {
+			logger.ErrorCF("mattermost", "Failed to send media", map[string]any{
+				"chat_id": msg.ChatID,
+				"error":   err.Error(),
+			})
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *MattermostChannel) sendFile(ctx context.Context, channelID, rootID, localPath string, part bus.MediaPart) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("mattermost send media: %v: %w", err, channels.ErrSendFailed)
+	}
+	defer f.Close()
+
+	filename := part.Filename
+	if filename == "" {
+		filename = filepath.Base(localPath)
+	}
+	fileID, err := c.client.uploadFile(ctx, channelID, filename, f)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	_, err = c.client.createPost(ctx, &post{
+		ChannelID: channelID,
+		RootID:    rootID,
+		Message:   part.Caption,
+		FileIDs:   []string{fileID},
+	})
+	if err != nil {
+		return classifyError(err)
+	}
+	return nil
+}
+
+// WebhookPath returns the path for registering on the shared HTTP server.
+// Slash commands are pointed at this path.
+func (c *MattermostChannel) WebhookPath() string {
+	if c.config.WebhookPath != "" {
+		return c.config.WebhookPath
+	}
+	return "/webhook/mattermost"
+}
+
+// ServeHTTP implements http.Handler for slash command requests. The command
+// is acknowledged with an ephemeral response and answered in the channel.
+func (c *MattermostChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if !c.validCommandToken(r.PostForm.Get("token")) {
+		logger.WarnC("mattermost", "Rejected slash command with unknown token")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	cmd := slashCommand{
+		userID:    r.PostForm.Get("user_id"),
+		userName:  r.PostForm.Get("user_name"),
+		channelID: r.PostForm.Get("channel_id"),
+		teamID:    r.PostForm.Get("team_id"),
+		rootID:    r.PostForm.Get("root_id"),
+		command:   r.PostForm.Get("command"),
+		text:      r.PostForm.Get("text"),
+	}
+	if cmd.userID == "" || cmd.channelID == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if !c.IsRunning() {
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"response_type": "ephemeral",
+		"text":          "Working on it...",
+	})
+
+	go c.handleSlashCommand(cmd)
+}
+
+// validCommandToken reports whether token belongs to one of the configured
+// slash commands.
+func (c *MattermostChannel) validCommandToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, t := range c.config.CommandTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+type slashCommand struct {
+	userID, userName, channelID, teamID, rootID, command, text string
+}
+
+func (c *MattermostChannel) handleSlashCommand(cmd slashCommand) {
+	sender := senderInfo(cmd.userID, cmd.userName)
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("mattermost", "Slash command rejected by allowlist", map[string]any{
+			"user_id": cmd.userID,
+		})
+		return
+	}
+
+	chatID := cmd.channelID
+	if cmd.rootID != "" {
+		chatID = cmd.channelID + "/" + cmd.rootID
+	}
+	content := cmd.text
+	if strings.TrimSpace(content) == "" {
+		content = "help"
+	}
+
+	metadata := map[string]string{
+		"channel_id": cmd.channelID,
+		"team_id":    cmd.teamID,
+		"platform":   "mattermost",
+		"is_command": "true",
+		"command":    cmd.command,
+	}
+
+	logger.DebugCF("mattermost", "Slash command received", map[string]any{
+		"sender_id": cmd.userID,
+		"command":   cmd.command,
+		"text":      utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(
+		c.ctx,
+		threadPeer("channel", cmd.channelID, chatID, metadata),
+		"",
+		cmd.userID,
+		chatID,
+		content,
+		nil,
+		metadata,
+		sender,
+	)
+}
+
+// threadPeer returns the peer for a conversation in a group or channel. A
+// thread is its own peer, so it gets its own session; its channel is recorded
+// as the parent so bindings on the channel still route it.
+func threadPeer(kind, channelID, chatID string, metadata map[string]string) bus.Peer {
+	if chatID == channelID {
+		return bus.Peer{Kind: kind, ID: channelID}
+	}
+	metadata["parent_peer_kind"] = kind
+	metadata["parent_peer_id"] = channelID
+	return bus.Peer{Kind: kind, ID: chatID}
+}
+
+// parseChatID splits a chat ID into the channel and the optional thread root.
+func parseChatID(chatID string) (channelID, rootID string) {
+	channelID, rootID, _ = strings.Cut(chatID, "/")
+	return channelID, rootID
+}
+
+// classifyError maps a client error to the channel error sentinels.
+func classifyError(err error) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return channels.ClassifySendError(apiErr.Status, err)
+	}
+	return channels.ClassifyNetError(err)
+}
+
+// eventLoop keeps the WebSocket connection open until the channel stops,
+// reconnecting with backoff.
+func (c *MattermostChannel) eventLoop() {
+	defer close(c.done)
+
+	delay := minRetryDelay
+	for {
+		connected := time.Now()
+		err := c.listen()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if time.Since(connected) > maxRetryDelay {
+			delay = minRetryDelay
+		}
+		logger.WarnCF("mattermost", "Lost WebSocket connection, retrying", map[string]any{
+			"error": err.Error(),
+			"retry": delay.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// wsEvent is a WebSocket event. Fields of data are mostly JSON-encoded
+// strings.
+type wsEvent struct {
+	Event string         `json:"event"`
+	Data  map[string]any `json:"data"`
+}
+
+// listen reads events from one WebSocket connection until it fails or the
+// channel stops.
+func (c *MattermostChannel) listen() error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.config.Token)
+	conn, resp, err := websocket.DefaultDialer.DialContext(c.ctx, c.client.websocketURL(), header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("dial: %w (HTTP %d)", err, resp.StatusCode)
+		}
+		return fmt.Errorf("dial: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+
+	connCtx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-connCtx.Done():
+				// Unblock ReadJSON when the channel stops.
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				conn.Close()
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	logger.InfoC("mattermost", "Connected to event stream")
+	for {
+		var ev wsEvent
+		if err := conn.ReadJSON(&ev); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if ev.Event == "posted" {
+			c.handlePosted(ev.Data)
+		}
+	}
+}
+
+func (c *MattermostChannel) handlePosted(data map[string]any) {
+	raw, _ := data["post"].(string)
+	var p post
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		logger.DebugCF("mattermost", "Ignoring malformed post", map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	// Skip our own posts, system messages and other bots.
+	if p.UserID == "" || p.UserID == c.botID || p.Type != "" {
+		return
+	}
+	if fromBot, _ := p.Props["from_bot"].(string); fromBot == "true" {
+		return
+	}
+
+	channelType, _ := data["channel_type"].(string)
+	senderName, _ := data["sender_name"].(string)
+	sender := senderInfo(p.UserID, strings.TrimPrefix(senderName, "@"))
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("mattermost", "Message rejected by allowlist", map[string]any{
+			"user_id": p.UserID,
+		})
+		return
+	}
+
+	var mentions []string
+	if s, ok := data["mentions"].(string); ok {
+		json.Unmarshal([]byte(s), &mentions)
+	}
+	mentioned := slices.Contains(mentions, c.botID)
+
+	content := p.Message
+	if c.mentionR != nil {
+		content = strings.TrimSpace(c.mentionR.ReplaceAllString(content, ""))
+	}
+
+	direct := channelType == "D"
+	chatID := p.ChannelID
+	switch {
+	case p.RootID != "":
+		chatID = p.ChannelID + "/" + p.RootID
+	case !direct:
+		// Answer in a thread started from this post.
+		chatID = p.ChannelID + "/" + p.ID
+	}
+
+	if !direct {
+		respond, cleaned := c.ShouldRespondInGroup(mentioned, content)
+		if !respond {
+			return
+		}
+		content = cleaned
+	}
+
+	scope := channels.BuildMediaScope("mattermost", chatID, p.ID)
+	var mediaRefs []string
+	for _, file := range c.postFiles(p) {
+		if ref := c.downloadFile(file, scope); ref != "" {
+			mediaRefs = append(mediaRefs, ref)
+		}
+		content = appendLine(content, fileLabel(file))
+	}
+
+	if strings.TrimSpace(content) == "" && len(mediaRefs) == 0 {
+		return
+	}
+
+	metadata := map[string]string{
+		"post_id":      p.ID,
+		"channel_id":   p.ChannelID,
+		"channel_type": channelType,
+		"platform":     "mattermost",
+	}
+	if p.RootID != "" {
+		metadata["root_id"] = p.RootID
+	}
+	if teamID, _ := data["team_id"].(string); teamID != "" {
+		metadata["team_id"] = teamID
+	}
+
+	var peer bus.Peer
+	switch channelType {
+	case "D":
+		peer = bus.Peer{Kind: "direct", ID: p.UserID}
+	case "G":
+		peer = threadPeer("group", p.ChannelID, chatID, metadata)
+	default:
+		peer = threadPeer("channel", p.ChannelID, chatID, metadata)
+	}
+
+	logger.DebugCF("mattermost", "Received message", map[string]any{
+		"sender_id": p.UserID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(c.ctx, peer, p.ID, p.UserID, chatID, content, mediaRefs, metadata, sender)
+}
+
+func senderInfo(userID, username string) bus.SenderInfo {
+	return bus.SenderInfo{
+		Platform:    "mattermost",
+		PlatformID:  userID,
+		CanonicalID: identity.BuildCanonicalID("mattermost", userID),
+		Username:    username,
+	}
+}
+
+// postFiles returns the files attached to p. Newer servers embed the file
+// infos in the post metadata; otherwise they are looked up by ID.
+func (c *MattermostChannel) postFiles(p post) []fileInfo {
+	if p.Metadata != nil && len(p.Metadata.Files) > 0 {
+		return p.Metadata.Files
+	}
+	var files []fileInfo
+	for _, id := range p.FileIDs {
+		info, err := c.client.fileInfo(c.ctx, id)
+		if err != nil {
+			logger.WarnCF("mattermost", "Failed to look up file", map[string]any{
+				"file_id": id,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		files = append(files, *info)
+	}
+	return files
+}
+
+// downloadFile fetches a file into the media store and returns its ref, or
+// "" on failure.
+func (c *MattermostChannel) downloadFile(file fileInfo, scope string) string {
+	store := c.GetMediaStore()
+	if store == nil || file.ID == "" {
+		return ""
+	}
+	if file.Size > maxDownloadSize {
+		logger.InfoCF("mattermost", "Skipping large file", map[string]any{
+			"file_id": file.ID,
+			"size":    file.Size,
+		})
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, 2*time.Minute)
+	defer cancel()
+	body, err := c.client.downloadFile(ctx, file.ID)
+	if err != nil {
+		logger.WarnCF("mattermost", "Failed to download file", map[string]any{
+			"file_id": file.ID,
+			"error":   err.Error(),
+		})
+		return ""
+	}
+	defer body.Close()
+
+	filename := file.Name
+	if filename == "" {
+		filename = file.ID
+		if exts, _ := mime.ExtensionsByType(file.MimeType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		return ""
+	}
+	localPath := filepath.Join(mediaDir, "mattermost-"+utils.SanitizeFilename(file.ID)+"-"+utils.SanitizeFilename(filename))
+	out, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return ""
+	}
+	_, err = io.Copy(out, io.LimitReader(body, maxDownloadSize))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(localPath)
+		return ""
+	}
+
+	ref, err := store.Store(localPath, media.MediaMeta{
+		Filename:    filename,
+		ContentType: file.MimeType,
+		Source:      "mattermost",
+	}, scope)
+	if err != nil {
+		os.Remove(localPath)
+		return ""
+	}
+	return ref
+}
+
+func fileLabel(file fileInfo) string {
+	kind := "file"
+	switch {
+	case strings.HasPrefix(file.MimeType, "image/"):
+		kind = "image"
+	case strings.HasPrefix(file.MimeType, "audio/"):
+		kind = "audio"
+	case strings.HasPrefix(file.MimeType, "video/"):
+		kind = "video"
+	}
+	name := file.Name
+	if name == "" {
+		name = file.MimeType
+	}
+	return fmt.Sprintf("[%s: %s]", kind, name)
+}
+
+func appendLine(content, line string) string {
+	if content == "" {
+		return line
+	}
+	return content + "\n" + line
+}
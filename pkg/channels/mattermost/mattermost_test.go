@@ -0,0 +1,419 @@
+package mattermost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/bus/bustest"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/media"
+)
+
+const (
+	botID   = "botuserid"
+	botName = "picobot"
+	token   = "secret-token"
+)
+
+// fakeServer is a stand-in for the parts of the Mattermost REST API and
+// WebSocket the channel uses. Events queued on events are pushed to the
+// connected WebSocket; requests that change state are recorded.
+type fakeServer struct {
+	t      *testing.T
+	events chan map[string]any
+
+	mu        sync.Mutex
+	posts     []post
+	patches   map[string]string
+	reactions []string
+	uploads   map[string][]byte
+	nextID    int
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *httptest.Server) {
+	fs := &fakeServer{
+		t:       t,
+		events:  make(chan map[string]any, 10),
+		patches: map[string]string{},
+		uploads: map[string][]byte{"file1": []byte("hello file")},
+	}
+	srv := httptest.NewServer(fs)
+	t.Cleanup(srv.Close)
+	return fs, srv
+}
+
+func (fs *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+token {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"id": "api.context.session_expired.app_error", "message": "Invalid or expired session"})
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v4")
+	switch {
+	case path == "/websocket":
+		fs.serveWebSocket(w, r)
+	case path == "/users/me":
+		writeJSON(w, http.StatusOK, user{ID: botID, Username: botName})
+	case path == "/posts" && r.Method == http.MethodPost:
+		var p post
+		json.NewDecoder(r.Body).Decode(&p)
+		fs.record(func() {
+			fs.nextID++
+			p.ID = "post" + string(rune('0'+fs.nextID))
+			fs.posts = append(fs.posts, p)
+		})
+		writeJSON(w, http.StatusCreated, p)
+	case strings.HasSuffix(path, "/patch") && r.Method == http.MethodPut:
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/posts/"), "/patch")
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fs.record(func() { fs.patches[id] = body.Message })
+		writeJSON(w, http.StatusOK, post{ID: id, Message: body.Message})
+	case path == "/reactions" && r.Method == http.MethodPost:
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		fs.record(func() { fs.reactions = append(fs.reactions, "+"+body["post_id"]+":"+body["emoji_name"]) })
+		writeJSON(w, http.StatusCreated, body)
+	case strings.Contains(path, "/reactions/") && r.Method == http.MethodDelete:
+		parts := strings.Split(path, "/")
+		fs.record(func() { fs.reactions = append(fs.reactions, "-"+parts[4]+":"+parts[6]) })
+		writeJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+	case path == "/files" && r.Method == http.MethodPost:
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		f, header, err := r.FormFile("files")
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		data, _ := io.ReadAll(f)
+		fs.record(func() { fs.uploads[header.Filename] = data })
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"file_infos": []fileInfo{{ID: "up-" + header.Filename, Name: header.Filename}},
+		})
+	case path == "/files/file1/info":
+		writeJSON(w, http.StatusOK, fileInfo{ID: "file1", Name: "notes.txt", MimeType: "text/plain", Size: 10})
+	case path == "/files/file1":
+		w.Write(fs.uploads["file1"])
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"message": "not found"})
+	}
+}
+
+func (fs *fakeServer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]any{"event": "hello", "data": map[string]any{"server_version": "9.0"}})
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case ev := <-fs.events:
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (fs *fakeServer) record(f func()) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f()
+}
+
+func (fs *fakeServer) sentPosts() []post {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]post(nil), fs.posts...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// posted builds a "posted" event the way the server encodes it: the post
+// and the mention list are JSON strings inside data.
+func posted(p post, channelType, senderName string, mentions ...string) map[string]any {
+	postJSON, _ := json.Marshal(p)
+	data := map[string]any{
+		"post":         string(postJSON),
+		"channel_type": channelType,
+		"sender_name":  senderName,
+		"team_id":      "team1",
+	}
+	if len(mentions) > 0 {
+		m, _ := json.Marshal(mentions)
+		data["mentions"] = string(m)
+	}
+	return map[string]any{"event": "posted", "data": data, "seq": 1}
+}
+
+func newTestChannel(t *testing.T, serverURL string, cfg config.MattermostConfig) (*MattermostChannel, *bus.MessageBus) {
+	t.Helper()
+	cfg.ServerURL = serverURL
+	cfg.Token = token
+	mb := bus.NewMessageBus()
+	ch, err := NewMattermostChannel(cfg, mb)
+	if err != nil {
+		t.Fatalf("NewMattermostChannel() error = %v", err)
+	}
+	ch.SetMediaStore(media.NewFileMediaStore())
+	return ch, mb
+}
+
+func startChannel(t *testing.T, ch *MattermostChannel) {
+	t.Helper()
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { ch.Stop(context.Background()) })
+}
+
+func TestMattermostChannel_InboundThreads(t *testing.T) {
+	fs, srv := newFakeServer(t)
+	ch, mb := newTestChannel(t, srv.URL, config.MattermostConfig{
+		GroupTrigger: config.GroupTriggerConfig{MentionOnly: true},
+	})
+	startChannel(t, ch)
+
+	// Our own posts, system posts and other bots are ignored.
+	fs.events <- posted(post{ID: "own", UserID: botID, ChannelID: "dm1", Message: "echo"}, "D", "@"+botName)
+	fs.events <- posted(post{ID: "sys", UserID: "u1", ChannelID: "dm1", Message: "joined", Type: "system_join_channel"}, "D", "@alice")
+	fs.events <- posted(post{ID: "bot", UserID: "u2", ChannelID: "dm1", Message: "hi", Props: map[string]any{"from_bot": "true"}}, "D", "@otherbot")
+
+	// Unmentioned channel posts are ignored with mention_only.
+	fs.events <- posted(post{ID: "chat", UserID: "u1", ChannelID: "town", Message: "lunch?"}, "O", "@alice")
+
+	fs.events <- posted(post{ID: "dm", UserID: "u1", ChannelID: "dm1", Message: "hello"}, "D", "@alice")
+	msg := bustest.Consume(t, mb)
+	if msg.ChatID != "dm1" || msg.Content != "hello" || msg.Peer.Kind != "direct" || msg.MessageID != "dm" {
+		t.Errorf("direct message = %+v", msg)
+	}
+	if msg.Sender.Username != "alice" || msg.Sender.CanonicalID != "mattermost:u1" {
+		t.Errorf("sender = %+v", msg.Sender)
+	}
+
+	fs.events <- posted(post{ID: "p1", UserID: "u1", ChannelID: "town", Message: "@PicoBot what time is it?"},
+		"O", "@alice", botID)
+	msg = bustest.Consume(t, mb)
+	if msg.ChatID != "town/p1" || msg.Content != "what time is it?" || msg.Peer.Kind != "channel" {
+		t.Errorf("channel mention = %+v", msg)
+	}
+	// Each thread is its own peer, with the channel as its parent.
+	if msg.Peer.ID != "town/p1" || msg.Metadata["parent_peer_kind"] != "channel" ||
+		msg.Metadata["parent_peer_id"] != "town" {
+		t.Errorf("thread peer = %+v, metadata = %v", msg.Peer, msg.Metadata)
+	}
+
+	fs.events <- posted(post{ID: "p2", UserID: "u1", ChannelID: "town", RootID: "p1", Message: "@picobot and the date?"},
+		"O", "@alice", botID)
+	msg = bustest.Consume(t, mb)
+	if msg.ChatID != "town/p1" || msg.Metadata["root_id"] != "p1" || msg.Peer.ID != "town/p1" {
+		t.Errorf("thread reply = %+v", msg)
+	}
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: msg.ChatID, Content: "noon"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	posts := fs.sentPosts()
+	if len(posts) != 1 || posts[0].ChannelID != "town" || posts[0].RootID != "p1" || posts[0].Message != "noon" {
+		t.Errorf("sent posts = %+v", posts)
+	}
+}
+
+func TestMattermostChannel_PlaceholderEditReact(t *testing.T) {
+	fs, srv := newFakeServer(t)
+	ch, _ := newTestChannel(t, srv.URL, config.MattermostConfig{
+		Placeholder: config.PlaceholderConfig{Enabled: true},
+	})
+	startChannel(t, ch)
+	ctx := context.Background()
+
+	id, err := ch.SendPlaceholder(ctx, "town/p1")
+	if err != nil || id == "" {
+		t.Fatalf("SendPlaceholder() = %q, %v", id, err)
+	}
+	if posts := fs.sentPosts(); len(posts) != 1 || posts[0].Message != "Thinking... 💭" || posts[0].RootID != "p1" {
+		t.Errorf("placeholder posts = %+v", posts)
+	}
+	if err := ch.EditMessage(ctx, "town/p1", id, "done"); err != nil {
+		t.Fatalf("EditMessage() error = %v", err)
+	}
+
+	undo, err := ch.ReactToMessage(ctx, "town/p1", "p1")
+	if err != nil {
+		t.Fatalf("ReactToMessage() error = %v", err)
+	}
+	undo()
+	undo()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.patches[id] != "done" {
+		t.Errorf("patches = %v", fs.patches)
+	}
+	if got := strings.Join(fs.reactions, ","); got != "+p1:eyes,-p1:eyes" {
+		t.Errorf("reactions = %s", got)
+	}
+}
+
+func TestMattermostChannel_Media(t *testing.T) {
+	fs, srv := newFakeServer(t)
+	ch, mb := newTestChannel(t, srv.URL, config.MattermostConfig{})
+	startChannel(t, ch)
+
+	fs.events <- posted(post{ID: "f1", UserID: "u1", ChannelID: "dm1", FileIDs: []string{"file1"}}, "D", "@alice")
+	msg := bustest.Consume(t, mb)
+	if msg.Content != "[file: notes.txt]" || len(msg.Media) != 1 {
+		t.Fatalf("inbound file = %+v", msg)
+	}
+	localPath, err := ch.GetMediaStore().Resolve(msg.Media[0])
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if data, _ := os.ReadFile(localPath); string(data) != "hello file" {
+		t.Errorf("downloaded file = %q", data)
+	}
+
+	outPath := filepath.Join(t.TempDir(), "report.txt")
+	os.WriteFile(outPath, []byte("report"), 0o600)
+	ref, err := ch.GetMediaStore().Store(outPath, media.MediaMeta{Filename: "report.txt"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ch.SendMedia(context.Background(), bus.OutboundMediaMessage{
+		ChatID: "town/p1",
+		Parts:  []bus.MediaPart{{Ref: ref, Filename: "report.txt", Caption: "here you go"}},
+	})
+	if err != nil {
+		t.Fatalf("SendMedia() error = %v", err)
+	}
+	posts := fs.sentPosts()
+	if len(posts) != 1 || posts[0].Message != "here you go" || posts[0].RootID != "p1" ||
+		len(posts[0].FileIDs) != 1 || posts[0].FileIDs[0] != "up-report.txt" {
+		t.Errorf("media posts = %+v", posts)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if string(fs.uploads["report.txt"]) != "report" {
+		t.Errorf("uploads = %v", fs.uploads)
+	}
+}
+
+func TestMattermostChannel_SlashCommand(t *testing.T) {
+	_, srv := newFakeServer(t)
+	ch, mb := newTestChannel(t, srv.URL, config.MattermostConfig{
+		CommandTokens: config.FlexibleStringSlice{"cmdtoken"},
+		AllowFrom:     config.FlexibleStringSlice{"alice"},
+	})
+	if ch.WebhookPath() != "/webhook/mattermost" {
+		t.Errorf("WebhookPath() = %q", ch.WebhookPath())
+	}
+	startChannel(t, ch)
+
+	command := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/mattermost", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		ch.ServeHTTP(rec, req)
+		return rec
+	}
+
+	form := url.Values{
+		"token":      {"wrong"},
+		"user_id":    {"u1"},
+		"user_name":  {"alice"},
+		"channel_id": {"town"},
+		"command":    {"/pico"},
+	}
+	if rec := command(form); rec.Code != http.StatusForbidden {
+		t.Errorf("unknown token status = %d, want 403", rec.Code)
+	}
+
+	form.Set("token", "cmdtoken")
+	rec := command(form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ephemeral") {
+		t.Errorf("response = %d %s", rec.Code, rec.Body.String())
+	}
+	msg := bustest.Consume(t, mb)
+	if msg.Content != "help" || msg.ChatID != "town" || msg.Metadata["is_command"] != "true" || msg.Peer.ID != "town" {
+		t.Errorf("slash command = %+v", msg)
+	}
+
+	form.Set("text", "summarize")
+	form.Set("root_id", "p9")
+	command(form)
+	msg = bustest.Consume(t, mb)
+	if msg.Content != "summarize" || msg.ChatID != "town/p9" || msg.Peer.ID != "town/p9" ||
+		msg.Metadata["parent_peer_id"] != "town" {
+		t.Errorf("threaded slash command = %+v", msg)
+	}
+}
+
+func TestMattermostChannel_Errors(t *testing.T) {
+	_, srv := newFakeServer(t)
+	ch, _ := newTestChannel(t, srv.URL, config.MattermostConfig{})
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "town", Content: "hi"}); !errors.Is(err, channels.ErrNotRunning) {
+		t.Errorf("Send() before Start error = %v, want ErrNotRunning", err)
+	}
+
+	bad, _ := newTestChannel(t, srv.URL, config.MattermostConfig{})
+	bad.client.token = "wrong"
+	if err := bad.Start(context.Background()); err == nil {
+		t.Error("Start() with a bad token should fail")
+	}
+	bad.SetRunning(true)
+	err := bad.Send(context.Background(), bus.OutboundMessage{ChatID: "town", Content: "hi"})
+	if !errors.Is(err, channels.ErrSendFailed) {
+		t.Errorf("Send() with a bad token error = %v, want ErrSendFailed", err)
+	}
+
+	if _, err := NewMattermostChannel(config.MattermostConfig{ServerURL: "chat.example.com", Token: "t"}, bus.NewMessageBus()); err == nil {
+		t.Error("NewMattermostChannel() should reject a server URL without a scheme")
+	}
+}
+
+func TestParseChatID(t *testing.T) {
+	tests := map[string][2]string{
+		"town":    {"town", ""},
+		"town/p1": {"town", "p1"},
+	}
+	for in, want := range tests {
+		if ch, root := parseChatID(in); ch != want[0] || root != want[1] {
+			t.Errorf("parseChatID(%q) = %q, %q", in, ch, root)
+		}
+	}
+}
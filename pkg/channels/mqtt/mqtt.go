@@ -0,0 +1,494 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	keepAlive      = 30 // seconds
+	maxPayloadSize = 64 << 10
+	maxPending     = 16 // unanswered requests remembered per chat
+	formatText     = "text"
+	formatJSON     = "json"
+	statusOnline   = "online"
+	statusOffline  = "offline"
+)
+
+// Reconnect backoff; variables so tests can shorten them.
+var (
+	minRetryDelay = 2 * time.Second
+	maxRetryDelay = 2 * time.Minute
+)
+
+// MQTTChannel implements the Channel interface over an MQTT 5 broker, so
+// devices can talk to the agent by publishing to a topic. The chat ID comes
+// from the {chat_id} segment of the subscribed topic.
+type MQTTChannel struct {
+	*channels.BaseChannel
+	config   config.MQTTConfig
+	patterns []topicPattern
+	server   *url.URL
+	tlsCfg   *tls.Config
+	conn     *autopaho.ConnectionManager
+	mu       sync.Mutex
+	pending  map[string][]pendingRequest // chatID -> requests awaiting an answer, oldest first
+	seq      atomic.Uint64
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// replyTarget is where the answer to a request goes when the request named
+// it: the MQTT v5 response topic and correlation data, and the request ID of
+// a JSON payload.
+type replyTarget struct {
+	topic       string
+	correlation []byte
+	requestID   string
+}
+
+// pendingRequest is a request that has not been answered yet.
+type pendingRequest struct {
+	messageID string
+	target    replyTarget
+}
+
+// NewMQTTChannel creates a new MQTT channel instance.
+func NewMQTTChannel(cfg config.MQTTConfig, messageBus *bus.MessageBus) (*MQTTChannel, error) {
+	server, err := url.Parse(cfg.Broker)
+	if err != nil || server.Host == "" {
+		return nil, fmt.Errorf("mqtt: invalid broker URL %q", cfg.Broker)
+	}
+	switch server.Scheme {
+	case "mqtt", "tcp", "mqtts", "ssl", "tls", "ws", "wss":
+	default:
+		return nil, fmt.Errorf("mqtt: unsupported broker scheme %q", server.Scheme)
+	}
+
+	if len(cfg.Topics) == 0 {
+		return nil, fmt.Errorf("mqtt: at least one topic is required")
+	}
+	patterns := make([]topicPattern, 0, len(cfg.Topics))
+	for _, topic := range cfg.Topics {
+		p, err := parsePattern(strings.TrimSpace(topic))
+		if err != nil {
+			return nil, fmt.Errorf("mqtt: %w", err)
+		}
+		patterns = append(patterns, p)
+	}
+
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		return nil, fmt.Errorf("mqtt: qos must be 0, 1 or 2")
+	}
+	switch cfg.PayloadFormat {
+	case "":
+		cfg.PayloadFormat = formatText
+	case formatText, formatJSON:
+	default:
+		return nil, fmt.Errorf("mqtt: payload_format must be %q or %q", formatText, formatJSON)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "picoclaw"
+	}
+
+	tlsCfg, err := loadTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	base := channels.NewBaseChannel("mqtt", cfg, messageBus, cfg.AllowFrom,
+		channels.WithReasoningChannelID(cfg.ReasoningChannelID),
+	)
+
+	return &MQTTChannel{
+		BaseChannel: base,
+		config:      cfg,
+		patterns:    patterns,
+		server:      server,
+		tlsCfg:      tlsCfg,
+		pending:     make(map[string][]pendingRequest),
+	}, nil
+}
+
+func loadTLSConfig(cfg config.MQTTConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("mqtt: read tls_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("mqtt: no certificates in tls_ca_file")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("mqtt: load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// Start connects to the broker. The broker does not have to be reachable
+// yet; the connection is retried in the background.
+func (c *MQTTChannel) Start(ctx context.Context) error {
+	logger.InfoC("mqtt", "Starting MQTT channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	clientCfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{c.server},
+		TlsCfg:                        c.tlsCfg,
+		KeepAlive:                     keepAlive,
+		CleanStartOnInitialConnection: true,
+		ReconnectBackoff:              backoff,
+		ConnectTimeout:                10 * time.Second,
+		OnConnectionUp:                c.onConnectionUp,
+		OnConnectError: func(err error) {
+			logger.WarnCF("mqtt", "Failed to connect to broker", map[string]any{
+				"broker": c.server.Redacted(),
+				"error":  err.Error(),
+			})
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID:          c.config.ClientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.onPublish},
+			OnClientError: func(err error) {
+				logger.WarnCF("mqtt", "Connection error", map[string]any{
+					"error": err.Error(),
+				})
+			},
+		},
+	}
+	if c.config.Username != "" {
+		clientCfg.ConnectUsername = c.config.Username
+		clientCfg.ConnectPassword = []byte(c.config.Password)
+	}
+	if c.config.StatusTopic != "" {
+		clientCfg.WillMessage = &paho.WillMessage{
+			Topic:   c.config.StatusTopic,
+			Payload: c.statusPayload(statusOffline),
+			QoS:     byte(c.config.QoS),
+			Retain:  true,
+		}
+	}
+
+	conn, err := autopaho.NewConnection(c.ctx, clientCfg)
+	if err != nil {
+		c.cancel()
+		return fmt.Errorf("mqtt: %w", err)
+	}
+	c.conn = conn
+
+	c.SetRunning(true)
+	logger.InfoCF("mqtt", "MQTT channel started", map[string]any{
+		"broker":    c.server.Redacted(),
+		"client_id": c.config.ClientID,
+	})
+	return nil
+}
+
+// Stop publishes the offline status and disconnects cleanly, which discards
+// the last will.
+func (c *MQTTChannel) Stop(ctx context.Context) error {
+	logger.InfoC("mqtt", "Stopping MQTT channel")
+
+	if c.conn != nil {
+		if c.config.StatusTopic != "" {
+			pubCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			c.publishStatus(pubCtx, statusOffline)
+			cancel()
+		}
+		c.conn.Disconnect(ctx)
+	}
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.conn != nil {
+		select {
+		case <-c.conn.Done():
+		case <-ctx.Done():
+		}
+	}
+
+	c.SetRunning(false)
+	logger.InfoC("mqtt", "MQTT channel stopped")
+	return nil
+}
+
+// backoff is the delay before connection attempt n, doubling from
+// minRetryDelay up to maxRetryDelay.
+func backoff(attempt int) time.Duration {
+	if attempt <= 0 {
+		return 0
+	}
+	delay := minRetryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// onConnectionUp subscribes to the topics and announces the gateway. It runs
+// after every (re)connection and must not block.
+func (c *MQTTChannel) onConnectionUp(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+	logger.InfoCF("mqtt", "Connected to broker", map[string]any{
+		"broker": c.server.Redacted(),
+	})
+
+	subs := make([]paho.SubscribeOptions, 0, len(c.patterns))
+	for _, p := range c.patterns {
+		// NoLocal keeps replies from looping back when a response topic
+		// matches a subscription.
+		subs = append(subs, paho.SubscribeOptions{Topic: p.filter, QoS: byte(c.config.QoS), NoLocal: true})
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+		defer cancel()
+		if _, err := cm.Subscribe(ctx, &paho.Subscribe{Subscriptions: subs}); err != nil {
+			logger.ErrorCF("mqtt", "Failed to subscribe", map[string]any{
+				"error": err.Error(),
+			})
+			return
+		}
+		if c.config.StatusTopic != "" {
+			c.publishStatus(ctx, statusOnline)
+		}
+	}()
+}
+
+func (c *MQTTChannel) statusPayload(status string) []byte {
+	if c.config.PayloadFormat == formatJSON {
+		data, _ := json.Marshal(map[string]string{"status": status, "client_id": c.config.ClientID})
+		return data
+	}
+	return []byte(status)
+}
+
+func (c *MQTTChannel) publishStatus(ctx context.Context, status string) {
+	_, err := c.conn.Publish(ctx, &paho.Publish{
+		Topic:   c.config.StatusTopic,
+		QoS:     byte(c.config.QoS),
+		Retain:  true,
+		Payload: c.statusPayload(status),
+	})
+	if err != nil {
+		logger.DebugCF("mqtt", "Failed to publish status", map[string]any{
+			"status": status,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// Send publishes msg.Content as the reply for msg.ChatID.
+func (c *MQTTChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+
+	pub := &paho.Publish{
+		Topic:      expandTopic(c.config.ResponseTopic, msg.ChatID),
+		QoS:        byte(c.config.QoS),
+		Properties: &paho.PublishProperties{},
+	}
+	var requestID string
+	if target, ok := c.replyTarget(msg.ChatID, msg.ReplyTo); ok {
+		if target.topic != "" {
+			pub.Topic = target.topic
+			pub.Properties.CorrelationData = target.correlation
+		}
+		requestID = target.requestID
+	}
+	if pub.Topic == "" {
+		return fmt.Errorf("mqtt: no response topic for chat %s: %w", msg.ChatID, channels.ErrSendFailed)
+	}
+
+	utf8Format := byte(1)
+	pub.Properties.PayloadFormat = &utf8Format
+	if c.config.PayloadFormat == formatJSON {
+		out := map[string]string{"chat_id": msg.ChatID, "text": msg.Content}
+		if requestID != "" {
+			out["reply_to"] = requestID
+		}
+		pub.Payload, _ = json.Marshal(out)
+		pub.Properties.ContentType = "application/json"
+	} else {
+		pub.Payload = []byte(msg.Content)
+		pub.Properties.ContentType = "text/plain; charset=utf-8"
+	}
+
+	if _, err := c.conn.Publish(ctx, pub); err != nil {
+		return channels.ClassifyNetError(err)
+	}
+	return nil
+}
+
+// addPending queues a request of chatID for its answer.
+func (c *MQTTChannel) addPending(chatID string, req pendingRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue := append(c.pending[chatID], req)
+	if len(queue) > maxPending {
+		queue = queue[len(queue)-maxPending:]
+	}
+	c.pending[chatID] = queue
+}
+
+// replyTarget returns where a message for chatID goes. The final answer to a
+// request (replyTo set) consumes it, along with any older requests that went
+// unanswered. Other messages, such as progress updates, go to the oldest
+// pending request, which is the one being worked on since a chat's requests
+// are handled in order.
+func (c *MQTTChannel) replyTarget(chatID, replyTo string) (replyTarget, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue := c.pending[chatID]
+	if len(queue) == 0 {
+		return replyTarget{}, false
+	}
+	if replyTo == "" {
+		return queue[0].target, true
+	}
+	for i, req := range queue {
+		if req.messageID != replyTo {
+			continue
+		}
+		if rest := queue[i+1:]; len(rest) > 0 {
+			c.pending[chatID] = rest
+		} else {
+			delete(c.pending, chatID)
+		}
+		return req.target, true
+	}
+	return replyTarget{}, false
+}
+
+// inboundPayload is the JSON payload format. Only text is required.
+type inboundPayload struct {
+	Text   string `json:"text"`
+	Sender string `json:"sender"`
+	ID     string `json:"id"`
+}
+
+// onPublish handles a message on a subscribed topic. It runs on the client's
+// receive goroutine.
+//
+// The sender is whatever the publisher declares, since MQTT does not tell
+// subscribers who published a message, so allow_from only filters clients
+// that identify themselves honestly. Access control belongs in the broker's
+// ACLs on the subscribed topics.
+func (c *MQTTChannel) onPublish(pr paho.PublishReceived) (bool, error) {
+	p := pr.Packet
+	chatID, ok := c.matchChat(p.Topic)
+	if !ok {
+		return false, nil
+	}
+	if len(p.Payload) > maxPayloadSize || !utf8.Valid(p.Payload) {
+		logger.DebugCF("mqtt", "Ignoring oversized or binary payload", map[string]any{
+			"topic": p.Topic,
+			"size":  len(p.Payload),
+		})
+		return true, nil
+	}
+
+	var in inboundPayload
+	if c.config.PayloadFormat == formatJSON {
+		if err := json.Unmarshal(p.Payload, &in); err != nil {
+			logger.DebugCF("mqtt", "Ignoring malformed JSON payload", map[string]any{
+				"topic": p.Topic,
+				"error": err.Error(),
+			})
+			return true, nil
+		}
+	} else {
+		in.Text = string(p.Payload)
+	}
+	if p.Properties != nil && in.Sender == "" {
+		in.Sender = p.Properties.User.Get("sender")
+	}
+	if in.Sender == "" {
+		in.Sender = chatID
+	}
+	content := strings.TrimSpace(in.Text)
+	if content == "" {
+		return true, nil
+	}
+
+	sender := bus.SenderInfo{
+		Platform:    "mqtt",
+		PlatformID:  in.Sender,
+		CanonicalID: identity.BuildCanonicalID("mqtt", in.Sender),
+	}
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("mqtt", "Message rejected by allowlist", map[string]any{
+			"sender": in.Sender,
+			"topic":  p.Topic,
+		})
+		return true, nil
+	}
+
+	target := replyTarget{requestID: in.ID}
+	if p.Properties != nil {
+		target.topic = p.Properties.ResponseTopic
+		target.correlation = p.Properties.CorrelationData
+	}
+	// Every request gets a message ID, so its answer can find the target
+	// even when requests on the same chat overlap.
+	messageID := in.ID
+	if messageID == "" {
+		messageID = fmt.Sprintf("mqtt-%d", c.seq.Add(1))
+	}
+	c.addPending(chatID, pendingRequest{messageID: messageID, target: target})
+
+	metadata := map[string]string{
+		"topic":    p.Topic,
+		"platform": "mqtt",
+	}
+	if target.topic != "" {
+		metadata["response_topic"] = target.topic
+	}
+
+	logger.DebugCF("mqtt", "Received message", map[string]any{
+		"sender_id": in.Sender,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(c.ctx, bus.Peer{Kind: "direct", ID: chatID}, messageID, in.Sender, chatID, content, nil, metadata, sender)
+	return true, nil
+}
+
+// matchChat finds the chat ID of a topic from the first matching pattern.
+func (c *MQTTChannel) matchChat(topic string) (string, bool) {
+	for _, p := range c.patterns {
+		if chatID, ok := p.chatID(topic); ok {
+			return chatID, true
+		}
+	}
+	return "", false
+}
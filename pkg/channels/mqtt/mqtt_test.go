@@ -0,0 +1,359 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/bus/bustest"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// startBroker runs an embedded broker that accepts the users "picoclaw" and
+// "device" (password "pw") and returns its address.
+func startBroker(t *testing.T) string {
+	t.Helper()
+	server := mochi.New(&mochi.Options{Logger: slog.New(slog.DiscardHandler)})
+	err := server.AddHook(new(auth.Hook), &auth.Options{Ledger: &auth.Ledger{
+		Auth: auth.AuthRules{
+			{Username: "picoclaw", Password: "pw", Allow: true},
+			{Username: "device", Password: "pw", Allow: true},
+		},
+		ACL: auth.ACLRules{{Filters: auth.Filters{"#": auth.ReadWrite}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	return tcp.Address()
+}
+
+type received struct {
+	topic       string
+	payload     string
+	correlation string
+	retain      bool
+}
+
+// device is an MQTT client standing in for an IoT device.
+type device struct {
+	client *paho.Client
+	msgs   chan received
+}
+
+func connectDevice(t *testing.T, addr, clientID string, filters ...string) *device {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &device{msgs: make(chan received, 20)}
+	d.client = paho.NewClient(paho.ClientConfig{
+		Conn: conn,
+		OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+			func(pr paho.PublishReceived) (bool, error) {
+				r := received{topic: pr.Packet.Topic, payload: string(pr.Packet.Payload), retain: pr.Packet.Retain}
+				if pr.Packet.Properties != nil {
+					r.correlation = string(pr.Packet.Properties.CorrelationData)
+				}
+				d.msgs <- r
+				return true, nil
+			},
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = d.client.Connect(ctx, &paho.Connect{
+		ClientID:     clientID,
+		CleanStart:   true,
+		KeepAlive:    30,
+		Username:     "device",
+		UsernameFlag: true,
+		Password:     []byte("pw"),
+		PasswordFlag: true,
+	})
+	if err != nil {
+		t.Fatalf("device connect: %v", err)
+	}
+	t.Cleanup(func() { d.client.Disconnect(&paho.Disconnect{}) })
+
+	subs := make([]paho.SubscribeOptions, 0, len(filters))
+	for _, f := range filters {
+		subs = append(subs, paho.SubscribeOptions{Topic: f, QoS: 1})
+	}
+	if len(subs) > 0 {
+		if _, err := d.client.Subscribe(ctx, &paho.Subscribe{Subscriptions: subs}); err != nil {
+			t.Fatalf("device subscribe: %v", err)
+		}
+	}
+	return d
+}
+
+func (d *device) publish(t *testing.T, p *paho.Publish) {
+	t.Helper()
+	p.QoS = 1
+	if _, err := d.client.Publish(context.Background(), p); err != nil {
+		t.Fatalf("device publish: %v", err)
+	}
+}
+
+func (d *device) next(t *testing.T) received {
+	t.Helper()
+	select {
+	case r := <-d.msgs:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("device received nothing")
+		return received{}
+	}
+}
+
+func newTestChannel(t *testing.T, addr string, cfg config.MQTTConfig) (*MQTTChannel, *bus.MessageBus) {
+	t.Helper()
+	cfg.Broker = "mqtt://" + addr
+	cfg.ClientID = "picoclaw-" + t.Name()
+	cfg.Username = "picoclaw"
+	cfg.Password = "pw"
+	if len(cfg.Topics) == 0 {
+		cfg.Topics = config.FlexibleStringSlice{"picoclaw/{chat_id}/in"}
+	}
+	if cfg.ResponseTopic == "" {
+		cfg.ResponseTopic = "picoclaw/{chat_id}/out"
+	}
+	cfg.StatusTopic = "picoclaw/status"
+	cfg.QoS = 1
+	mb := bus.NewMessageBus()
+	ch, err := NewMQTTChannel(cfg, mb)
+	if err != nil {
+		t.Fatalf("NewMQTTChannel() error = %v", err)
+	}
+	return ch, mb
+}
+
+// startChannel starts ch and waits until it has subscribed, which it
+// signals by publishing its online status.
+func startChannel(t *testing.T, ch *MQTTChannel, observer *device) {
+	t.Helper()
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { ch.Stop(context.Background()) })
+	if r := observer.next(t); r.topic != "picoclaw/status" || r.payload != "online" {
+		t.Fatalf("status = %+v, want online", r)
+	}
+}
+
+func TestMQTTChannel_TextRoundTrip(t *testing.T) {
+	oldMin, oldMax := minRetryDelay, maxRetryDelay
+	minRetryDelay, maxRetryDelay = 50*time.Millisecond, 200*time.Millisecond
+	defer func() { minRetryDelay, maxRetryDelay = oldMin, oldMax }()
+	addr := startBroker(t)
+	observer := connectDevice(t, addr, "observer", "picoclaw/status", "picoclaw/+/out")
+	ch, mb := newTestChannel(t, addr, config.MQTTConfig{})
+	startChannel(t, ch, observer)
+
+	kitchen := connectDevice(t, addr, "kitchen")
+	kitchen.publish(t, &paho.Publish{Topic: "picoclaw/kitchen/in", Payload: []byte("  is the oven on?  ")})
+	msg := bustest.Consume(t, mb)
+	if msg.ChatID != "kitchen" || msg.Content != "is the oven on?" || msg.Sender.CanonicalID != "mqtt:kitchen" {
+		t.Errorf("inbound = %+v", msg)
+	}
+	if msg.Metadata["topic"] != "picoclaw/kitchen/in" {
+		t.Errorf("metadata = %v", msg.Metadata)
+	}
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "kitchen", Content: "no"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if r := observer.next(t); r.topic != "picoclaw/kitchen/out" || r.payload != "no" {
+		t.Errorf("reply = %+v", r)
+	}
+
+	// An unexpected disconnect triggers the last will; the channel then
+	// reconnects and announces itself again.
+	ch.conn.TerminateConnectionForTest()
+	if r := observer.next(t); r.topic != "picoclaw/status" || r.payload != "offline" {
+		t.Errorf("status after drop = %+v, want offline", r)
+	}
+	if r := observer.next(t); r.payload != "online" {
+		t.Errorf("status after reconnect = %+v, want online", r)
+	}
+
+	ch.Stop(context.Background())
+	if r := observer.next(t); r.payload != "offline" {
+		t.Errorf("status after Stop = %+v, want offline", r)
+	}
+	late := connectDevice(t, addr, "late", "picoclaw/status")
+	if r := late.next(t); !r.retain || r.payload != "offline" {
+		t.Errorf("retained status = %+v", r)
+	}
+}
+
+func TestMQTTChannel_JSONRequestReply(t *testing.T) {
+	addr := startBroker(t)
+	observer := connectDevice(t, addr, "observer", "picoclaw/status", "sensors/+/reply")
+	ch, mb := newTestChannel(t, addr, config.MQTTConfig{
+		PayloadFormat: "json",
+		AllowFrom:     config.FlexibleStringSlice{"sensor-1"},
+	})
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { ch.Stop(context.Background()) })
+	var status map[string]string
+	if r := observer.next(t); json.Unmarshal([]byte(r.payload), &status) != nil || status["status"] != "online" {
+		t.Fatalf("status = %+v", r)
+	}
+
+	sensor := connectDevice(t, addr, "sensor")
+	// Not on the allow list.
+	sensor.publish(t, &paho.Publish{Topic: "picoclaw/hall/in", Payload: []byte(`{"text":"hi","sender":"intruder"}`)})
+	// Malformed JSON.
+	sensor.publish(t, &paho.Publish{Topic: "picoclaw/hall/in", Payload: []byte(`hi`)})
+	sensor.publish(t, &paho.Publish{
+		Topic:   "picoclaw/hall/in",
+		Payload: []byte(`{"text":"temperature?","sender":"sensor-1","id":"r1"}`),
+		Properties: &paho.PublishProperties{
+			ResponseTopic:   "sensors/sensor-1/reply",
+			CorrelationData: []byte("corr-7"),
+		},
+	})
+	msg := bustest.Consume(t, mb)
+	if msg.ChatID != "hall" || msg.Content != "temperature?" || msg.SenderID != "mqtt:sensor-1" || msg.MessageID != "r1" {
+		t.Errorf("inbound = %+v", msg)
+	}
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "hall", Content: "21°C", ReplyTo: msg.MessageID}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	r := observer.next(t)
+	if r.topic != "sensors/sensor-1/reply" || r.correlation != "corr-7" {
+		t.Errorf("reply = %+v", r)
+	}
+	var out map[string]string
+	if err := json.Unmarshal([]byte(r.payload), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["text"] != "21°C" || out["chat_id"] != "hall" || out["reply_to"] != "r1" {
+		t.Errorf("reply payload = %v", out)
+	}
+}
+
+func TestMQTTChannel_OverlappingRequests(t *testing.T) {
+	ch, _ := newTestChannel(t, "127.0.0.1:1", config.MQTTConfig{})
+	for _, id := range []string{"r1", "r2", "r3"} {
+		ch.addPending("hall", pendingRequest{messageID: id, target: replyTarget{topic: "reply/" + id}})
+	}
+
+	// Progress messages go to the request being worked on.
+	if target, _ := ch.replyTarget("hall", ""); target.topic != "reply/r1" {
+		t.Errorf("progress target = %q, want reply/r1", target.topic)
+	}
+	// Each answer goes to its own request, even if an earlier one was never
+	// answered.
+	if target, _ := ch.replyTarget("hall", "r2"); target.topic != "reply/r2" {
+		t.Errorf("answer to r2 went to %q", target.topic)
+	}
+	if target, _ := ch.replyTarget("hall", ""); target.topic != "reply/r3" {
+		t.Errorf("progress target after r2 = %q, want reply/r3", target.topic)
+	}
+	if target, _ := ch.replyTarget("hall", "r3"); target.topic != "reply/r3" {
+		t.Errorf("answer to r3 went to %q", target.topic)
+	}
+	if _, ok := ch.replyTarget("hall", ""); ok {
+		t.Error("all requests answered, nothing should be pending")
+	}
+
+	for i := range maxPending + 5 {
+		ch.addPending("flood", pendingRequest{messageID: string(rune('a' + i))})
+	}
+	if n := len(ch.pending["flood"]); n != maxPending {
+		t.Errorf("pending = %d, want %d", n, maxPending)
+	}
+}
+
+func TestMQTTChannel_SendErrors(t *testing.T) {
+	ch, _ := newTestChannel(t, "127.0.0.1:1", config.MQTTConfig{ResponseTopic: "x"})
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "a", Content: "hi"}); !errors.Is(err, channels.ErrNotRunning) {
+		t.Errorf("Send() before Start error = %v, want ErrNotRunning", err)
+	}
+	ch.config.ResponseTopic = ""
+	ch.SetRunning(true)
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "a", Content: "hi"}); !errors.Is(err, channels.ErrSendFailed) {
+		t.Errorf("Send() without response topic error = %v, want ErrSendFailed", err)
+	}
+}
+
+func TestNewMQTTChannel_Validation(t *testing.T) {
+	valid := config.MQTTConfig{Broker: "mqtt://localhost:1883", Topics: config.FlexibleStringSlice{"a/{chat_id}"}}
+	tests := map[string]func(*config.MQTTConfig){
+		"bad scheme":     func(c *config.MQTTConfig) { c.Broker = "http://localhost" },
+		"no host":        func(c *config.MQTTConfig) { c.Broker = "localhost:1883" },
+		"no topics":      func(c *config.MQTTConfig) { c.Topics = nil },
+		"bad pattern":    func(c *config.MQTTConfig) { c.Topics = config.FlexibleStringSlice{"a/x{chat_id}"} },
+		"bad qos":        func(c *config.MQTTConfig) { c.QoS = 3 },
+		"bad format":     func(c *config.MQTTConfig) { c.PayloadFormat = "xml" },
+		"missing cafile": func(c *config.MQTTConfig) { c.TLSCAFile = "/nonexistent/ca.pem" },
+	}
+	for name, mutate := range tests {
+		cfg := valid
+		mutate(&cfg)
+		if _, err := NewMQTTChannel(cfg, bus.NewMessageBus()); err == nil {
+			t.Errorf("%s: NewMQTTChannel() should fail", name)
+		}
+	}
+	if _, err := NewMQTTChannel(valid, bus.NewMessageBus()); err != nil {
+		t.Errorf("NewMQTTChannel() error = %v", err)
+	}
+}
+
+func TestTopicPattern(t *testing.T) {
+	tests := []struct {
+		pattern, topic, chatID string
+		ok                     bool
+	}{
+		{"picoclaw/{chat_id}/in", "picoclaw/kitchen/in", "kitchen", true},
+		{"picoclaw/{chat_id}/in", "picoclaw/kitchen/out", "", false},
+		{"picoclaw/{chat_id}/in", "picoclaw//in", "", false},
+		{"home/+/{chat_id}/#", "home/floor1/lamp/set/now", "lamp", true},
+		{"devices/#", "devices/a/b", "devices/a/b", true},
+		{"devices/#", "devices", "devices", true},
+		{"+/status", "$SYS/status", "", false},
+	}
+	for _, tt := range tests {
+		p, err := parsePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parsePattern(%q) error = %v", tt.pattern, err)
+		}
+		chatID, ok := p.chatID(tt.topic)
+		if chatID != tt.chatID || ok != tt.ok {
+			t.Errorf("%q on %q = %q, %v; want %q, %v", tt.pattern, tt.topic, chatID, ok, tt.chatID, tt.ok)
+		}
+	}
+
+	for _, bad := range []string{"", "a/{chat_id}/{chat_id}", "a/#/b", "a/b+", "{chat_id}x"} {
+		if _, err := parsePattern(bad); err == nil {
+			t.Errorf("parsePattern(%q) should fail", bad)
+		}
+	}
+	if got := expandTopic("out/{chat_id}", "kitchen"); !strings.HasSuffix(got, "/kitchen") {
+		t.Errorf("expandTopic() = %q", got)
+	}
+}
@@ -0,0 +1,85 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+)
+
+const chatIDPlaceholder = "{chat_id}"
+
+// topicPattern is a configured subscription. The {chat_id} segment, if any,
+// is subscribed as a single-level wildcard and names the chat.
+type topicPattern struct {
+	filter  string
+	chatSeg int // index of the {chat_id} segment, or -1
+}
+
+func parsePattern(pattern string) (topicPattern, error) {
+	if pattern == "" {
+		return topicPattern{}, fmt.Errorf("empty topic")
+	}
+	p := topicPattern{chatSeg: -1}
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		switch {
+		case seg == chatIDPlaceholder:
+			if p.chatSeg >= 0 {
+				return topicPattern{}, fmt.Errorf("topic %q has more than one %s", pattern, chatIDPlaceholder)
+			}
+			p.chatSeg = i
+			segments[i] = "+"
+		case strings.Contains(seg, chatIDPlaceholder):
+			return topicPattern{}, fmt.Errorf("topic %q: %s must be a whole segment", pattern, chatIDPlaceholder)
+		case seg == "#" && i != len(segments)-1:
+			return topicPattern{}, fmt.Errorf("topic %q: # must be the last segment", pattern)
+		case seg != "+" && seg != "#" && strings.ContainsAny(seg, "+#"):
+			return topicPattern{}, fmt.Errorf("topic %q: wildcards must be whole segments", pattern)
+		}
+	}
+	p.filter = strings.Join(segments, "/")
+	return p, nil
+}
+
+// chatID returns the chat ID of a message published on topic, and whether
+// the topic matches the pattern at all.
+func (p topicPattern) chatID(topic string) (string, bool) {
+	if !matchTopic(p.filter, topic) {
+		return "", false
+	}
+	if p.chatSeg < 0 {
+		return topic, true
+	}
+	segments := strings.Split(topic, "/")
+	if segments[p.chatSeg] == "" {
+		return "", false
+	}
+	return segments[p.chatSeg], true
+}
+
+// matchTopic reports whether topic matches the subscription filter. As the
+// spec requires, wildcards in the first segment do not match topics that
+// start with "$".
+func matchTopic(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+// expandTopic fills {chat_id} into a response topic template.
+func expandTopic(template, chatID string) string {
+	return strings.ReplaceAll(template, chatIDPlaceholder, chatID)
+}
@@ -0,0 +1,343 @@
+package pico
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	defaultMaxMediaSize = 10 << 20
+
+	// inlineMediaSize is the largest file media.create carries inline as
+	// base64; larger files follow the frame as binary chunks.
+	inlineMediaSize = 256 << 10
+	mediaChunkSize  = 64 << 10
+)
+
+// upload is a media.send whose bytes are still arriving as binary frames.
+// It is only touched by the connection's read loop.
+type upload struct {
+	msg         PicoMessage
+	file        *os.File
+	filename    string
+	contentType string
+	caption     string
+	size        int
+	received    int
+}
+
+// abort discards a partial upload.
+func (u *upload) abort() {
+	u.file.Close()
+	os.Remove(u.file.Name())
+}
+
+func (c *PicoChannel) maxMediaSize() int {
+	if c.config.MaxMediaSize > 0 {
+		return c.config.MaxMediaSize
+	}
+	return defaultMaxMediaSize
+}
+
+// handleMediaSend processes an inbound media.send from a client.
+func (c *PicoChannel) handleMediaSend(pc *picoConn, msg PicoMessage) {
+	if pc.upload != nil {
+		pc.writeJSON(replyError(msg, "upload_in_progress", "another upload is still in progress"))
+		return
+	}
+	if !c.IsAllowedSender(picoSender()) {
+		return
+	}
+	if c.GetMediaStore() == nil {
+		pc.writeJSON(replyError(msg, "media_unavailable", "media uploads are not available"))
+		return
+	}
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+	}
+
+	filename, _ := msg.Payload["filename"].(string)
+	filename = utils.SanitizeFilename(filename)
+	if filename == "" {
+		filename = "upload"
+	}
+	contentType, _ := msg.Payload["content_type"].(string)
+	caption, _ := msg.Payload["content"].(string)
+	limit := c.maxMediaSize()
+
+	if data, ok := msg.Payload["data"].(string); ok && data != "" {
+		if base64.StdEncoding.DecodedLen(len(data)) > limit+2 {
+			pc.writeJSON(replyError(msg, "media_too_large", fmt.Sprintf("media exceeds %d bytes", limit)))
+			return
+		}
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			pc.writeJSON(replyError(msg, "invalid_media", "data is not valid base64"))
+			return
+		}
+		if len(raw) > limit {
+			pc.writeJSON(replyError(msg, "media_too_large", fmt.Sprintf("media exceeds %d bytes", limit)))
+			return
+		}
+		f, err := createMediaFile(filename)
+		if err != nil {
+			pc.writeJSON(replyError(msg, "media_unavailable", "failed to store media"))
+			return
+		}
+		_, err = f.Write(raw)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			pc.writeJSON(replyError(msg, "media_unavailable", "failed to store media"))
+			return
+		}
+		c.finishMedia(pc, msg, f.Name(), filename, contentType, caption)
+		return
+	}
+
+	size, ok := msg.Payload["size"].(float64)
+	if !ok || size <= 0 || size != float64(int(size)) {
+		pc.writeJSON(replyError(msg, "invalid_media", "media.send needs data or a positive size"))
+		return
+	}
+	if int(size) > limit {
+		pc.writeJSON(replyError(msg, "media_too_large", fmt.Sprintf("media exceeds %d bytes", limit)))
+		return
+	}
+	f, err := createMediaFile(filename)
+	if err != nil {
+		pc.writeJSON(replyError(msg, "media_unavailable", "failed to store media"))
+		return
+	}
+	pc.upload = &upload{
+		msg:         msg,
+		file:        f,
+		filename:    filename,
+		contentType: contentType,
+		caption:     caption,
+		size:        int(size),
+	}
+}
+
+// handleBinary appends a binary frame to the connection's pending upload and
+// completes it once all announced bytes have arrived.
+func (c *PicoChannel) handleBinary(pc *picoConn, data []byte) {
+	up := pc.upload
+	if up == nil {
+		pc.writeJSON(newError("unexpected_binary", "binary frame without a pending media.send"))
+		return
+	}
+	if up.received+len(data) > up.size {
+		up.abort()
+		pc.upload = nil
+		pc.writeJSON(replyError(up.msg, "invalid_media", fmt.Sprintf("received more than the announced %d bytes", up.size)))
+		return
+	}
+	if _, err := up.file.Write(data); err != nil {
+		up.abort()
+		pc.upload = nil
+		pc.writeJSON(replyError(up.msg, "media_unavailable", "failed to store media"))
+		return
+	}
+	up.received += len(data)
+	if up.received < up.size {
+		return
+	}
+
+	pc.upload = nil
+	if err := up.file.Close(); err != nil {
+		os.Remove(up.file.Name())
+		pc.writeJSON(replyError(up.msg, "media_unavailable", "failed to store media"))
+		return
+	}
+	c.finishMedia(pc, up.msg, up.file.Name(), up.filename, up.contentType, up.caption)
+}
+
+// finishMedia registers a received file in the media store and passes it to
+// the agent with its caption.
+func (c *PicoChannel) finishMedia(pc *picoConn, msg PicoMessage, localPath, filename, contentType, caption string) {
+	if contentType == "" {
+		contentType = detectContentType(localPath, filename)
+	}
+
+	sessionID := msg.SessionID
+	if sessionID == "" {
+		sessionID = pc.sessionID
+	}
+	chatID := "pico:" + sessionID
+	scope := channels.BuildMediaScope("pico", chatID, msg.ID)
+
+	ref, err := c.GetMediaStore().Store(localPath, media.MediaMeta{
+		Filename:    filename,
+		ContentType: contentType,
+		Source:      "pico",
+	}, scope)
+	if err != nil {
+		os.Remove(localPath)
+		logger.ErrorCF("pico", "Failed to store media", map[string]any{
+			"filename": filename,
+			"error":    err.Error(),
+		})
+		pc.writeJSON(replyError(msg, "media_unavailable", "failed to store media"))
+		return
+	}
+
+	label := fmt.Sprintf("[%s: %s]", mediaType(filename, contentType), filename)
+	content := label
+	if caption = strings.TrimSpace(caption); caption != "" {
+		content = caption + "\n" + label
+	}
+	c.dispatch(pc, msg, content, []string{ref})
+}
+
+// SendMedia implements channels.MediaSender with media.create frames.
+func (c *PicoChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+
+	store := c.GetMediaStore()
+	if store == nil {
+		return fmt.Errorf("no media store available: %w", channels.ErrSendFailed)
+	}
+
+	for _, part := range msg.Parts {
+		localPath, err := store.Resolve(part.Ref)
+		if err != nil {
+			logger.ErrorCF("pico", "Failed to resolve media ref", map[string]any{
+				"ref":   part.Ref,
+				"error": err.Error(),
+			})
+			continue
+		}
+		data, err := os.ReadFile(localPath)
+		if err != nil {
+			return fmt.Errorf("pico send media: %v: %w", err, channels.ErrSendFailed)
+		}
+
+		filename := part.Filename
+		if filename == "" {
+			filename = filepath.Base(localPath)
+		}
+		contentType := part.ContentType
+		if contentType == "" {
+			contentType = detectContentType(localPath, filename)
+		}
+		typ := part.Type
+		if typ == "" {
+			typ = mediaType(filename, contentType)
+		}
+
+		payload := map[string]any{
+			"type":         typ,
+			"filename":     filename,
+			"content_type": contentType,
+			"size":         len(data),
+		}
+		if part.Caption != "" {
+			payload["caption"] = part.Caption
+		}
+		if len(data) <= inlineMediaSize {
+			payload["data"] = base64.StdEncoding.EncodeToString(data)
+			data = nil
+		}
+		frame := newMessage(TypeMediaCreate, payload)
+		frame.ID = uuid.New().String()
+
+		if err := c.publish(msg.ChatID, frame, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFrames sends a JSON frame followed by data as binary frames,
+// holding the write lock so nothing is interleaved.
+func (pc *picoConn) writeFrames(frame PicoMessage, data []byte) error {
+	if pc.closed.Load() {
+		return fmt.Errorf("connection closed")
+	}
+	pc.writeMu.Lock()
+	defer pc.writeMu.Unlock()
+	if err := pc.conn.WriteJSON(frame); err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		n := min(len(data), mediaChunkSize)
+		if err := pc.conn.WriteMessage(websocket.BinaryMessage, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// replyError creates an error PicoMessage that answers msg.
+func replyError(msg PicoMessage, code, message string) PicoMessage {
+	e := newError(code, message)
+	e.ID = msg.ID
+	return e
+}
+
+func createMediaFile(filename string) (*os.File, error) {
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(mediaDir, "pico-*-"+filename)
+}
+
+// detectContentType guesses a MIME type from the file name, then the content.
+func detectContentType(localPath, filename string) string {
+	if ct := mime.TypeByExtension(filepath.Ext(filename)); ct != "" {
+		return ct
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return http.DetectContentType(head[:n])
+}
+
+func mediaType(filename, contentType string) string {
+	ct := strings.ToLower(contentType)
+	switch {
+	case strings.HasPrefix(ct, "image/"):
+		return "image"
+	case strings.HasPrefix(ct, "audio/"):
+		return "audio"
+	case strings.HasPrefix(ct, "video/"):
+		return "video"
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp":
+		return "image"
+	case ".mp3", ".wav", ".ogg", ".m4a", ".flac", ".opus":
+		return "audio"
+	case ".mp4", ".webm", ".mov", ".avi", ".mkv":
+		return "video"
+	default:
+		return "file"
+	}
+}
@@ -0,0 +1,224 @@
+package pico
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/bus/bustest"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/media"
+)
+
+func newTestChannel(t *testing.T, maxMediaSize int) (*PicoChannel, *bus.MessageBus, *websocket.Conn) {
+	t.Helper()
+	return newTestChannelWithConfig(t, config.PicoConfig{MaxMediaSize: maxMediaSize})
+}
+
+// newTestChannelWithConfig starts a channel and connects a client to session
+// s1.
+func newTestChannelWithConfig(t *testing.T, cfg config.PicoConfig) (*PicoChannel, *bus.MessageBus, *websocket.Conn) {
+	t.Helper()
+	mb := bus.NewMessageBus()
+	cfg.Token = "tok"
+	ch, err := NewPicoChannel(cfg, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.SetMediaStore(media.NewFileMediaStore())
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ch.Stop(context.Background()) })
+
+	srv := httptest.NewServer(ch)
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/pico/ws?session_id=s1"
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer tok"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// A pong means the server has registered the connection.
+	conn.WriteJSON(PicoMessage{Type: TypePing})
+	if frame := readFrame(t, conn); frame.Type != TypePong {
+		t.Fatalf("expected pong, got %+v", frame)
+	}
+	return ch, mb, conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) PicoMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg PicoMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func readMediaFile(t *testing.T, ch *PicoChannel, ref string) ([]byte, media.MediaMeta) {
+	t.Helper()
+	path, meta, err := ch.GetMediaStore().ResolveWithMeta(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, meta
+}
+
+func TestMediaSend_Inline(t *testing.T) {
+	ch, mb, conn := newTestChannel(t, 0)
+
+	conn.WriteJSON(PicoMessage{Type: TypeMediaSend, ID: "m1", Payload: map[string]any{
+		"filename": "photo.jpg",
+		"content":  "what is this?",
+		"data":     base64.StdEncoding.EncodeToString([]byte("jpeg bytes")),
+	}})
+
+	msg := bustest.Consume(t, mb)
+	if msg.ChatID != "pico:s1" || msg.MessageID != "m1" || msg.Content != "what is this?\n[image: photo.jpg]" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if len(msg.Media) != 1 {
+		t.Fatalf("media = %v", msg.Media)
+	}
+	data, meta := readMediaFile(t, ch, msg.Media[0])
+	if string(data) != "jpeg bytes" || meta.ContentType != "image/jpeg" || meta.Source != "pico" {
+		t.Fatalf("stored %q with %+v", data, meta)
+	}
+}
+
+func TestMediaSend_Chunked(t *testing.T) {
+	ch, mb, conn := newTestChannel(t, 0)
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+
+	conn.WriteJSON(PicoMessage{Type: TypeMediaSend, Payload: map[string]any{
+		"filename":     "log.txt",
+		"content_type": "text/plain",
+		"size":         len(payload),
+	}})
+	for i := 0; i < len(payload); i += 3000 {
+		conn.WriteMessage(websocket.BinaryMessage, payload[i:min(i+3000, len(payload))])
+	}
+
+	msg := bustest.Consume(t, mb)
+	if msg.Content != "[file: log.txt]" || msg.MessageID == "" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if data, _ := readMediaFile(t, ch, msg.Media[0]); !bytes.Equal(data, payload) {
+		t.Fatalf("stored %d bytes, want %d", len(data), len(payload))
+	}
+}
+
+func TestMediaSend_Errors(t *testing.T) {
+	_, _, conn := newTestChannel(t, 16)
+
+	tests := []struct {
+		name string
+		send func()
+		code string
+	}{
+		{"inline too large", func() {
+			conn.WriteJSON(PicoMessage{Type: TypeMediaSend, ID: "a", Payload: map[string]any{
+				"data": base64.StdEncoding.EncodeToString(make([]byte, 17)),
+			}})
+		}, "media_too_large"},
+		{"announced too large", func() {
+			conn.WriteJSON(PicoMessage{Type: TypeMediaSend, ID: "b", Payload: map[string]any{"size": 17}})
+		}, "media_too_large"},
+		{"bad base64", func() {
+			conn.WriteJSON(PicoMessage{Type: TypeMediaSend, ID: "c", Payload: map[string]any{"data": "!!"}})
+		}, "invalid_media"},
+		{"no data or size", func() {
+			conn.WriteJSON(PicoMessage{Type: TypeMediaSend, ID: "d", Payload: map[string]any{}})
+		}, "invalid_media"},
+		{"stray binary", func() {
+			conn.WriteMessage(websocket.BinaryMessage, []byte("x"))
+		}, "unexpected_binary"},
+		{"overrun", func() {
+			conn.WriteJSON(PicoMessage{Type: TypeMediaSend, ID: "e", Payload: map[string]any{"size": 4}})
+			conn.WriteMessage(websocket.BinaryMessage, []byte("12345"))
+		}, "invalid_media"},
+		{"second upload", func() {
+			conn.WriteJSON(PicoMessage{Type: TypeMediaSend, ID: "f", Payload: map[string]any{"size": 4}})
+			conn.WriteJSON(PicoMessage{Type: TypeMediaSend, ID: "g", Payload: map[string]any{"size": 4}})
+		}, "upload_in_progress"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.send()
+			if frame := readFrame(t, conn); frame.Type != TypeError || frame.Payload["code"] != tt.code {
+				t.Fatalf("frame = %+v, want error %s", frame, tt.code)
+			}
+		})
+	}
+}
+
+func TestSendMedia(t *testing.T) {
+	ch, _, conn := newTestChannel(t, 0)
+	store := ch.GetMediaStore()
+
+	dir := t.TempDir()
+	small := filepath.Join(dir, "chart.png")
+	os.WriteFile(small, []byte("png bytes"), 0o600)
+	big := filepath.Join(dir, "report.pdf")
+	bigData := bytes.Repeat([]byte("x"), inlineMediaSize+mediaChunkSize+1)
+	os.WriteFile(big, bigData, 0o600)
+
+	smallRef, _ := store.Store(small, media.MediaMeta{Filename: "chart.png", ContentType: "image/png"}, "test")
+	bigRef, _ := store.Store(big, media.MediaMeta{Filename: "report.pdf"}, "test")
+
+	err := ch.SendMedia(context.Background(), bus.OutboundMediaMessage{
+		ChatID: "pico:s1",
+		Parts: []bus.MediaPart{
+			{Ref: smallRef, Caption: "here", Filename: "chart.png", ContentType: "image/png"},
+			{Ref: bigRef, Filename: "report.pdf"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SendMedia() error = %v", err)
+	}
+
+	frame := readFrame(t, conn)
+	if frame.Type != TypeMediaCreate || frame.Payload["type"] != "image" || frame.Payload["caption"] != "here" {
+		t.Fatalf("first frame = %+v", frame)
+	}
+	if data, _ := base64.StdEncoding.DecodeString(frame.Payload["data"].(string)); string(data) != "png bytes" {
+		t.Fatalf("inline data = %q", data)
+	}
+
+	frame = readFrame(t, conn)
+	if frame.Payload["data"] != nil || frame.Payload["size"] != float64(len(bigData)) || frame.Payload["content_type"] != "application/pdf" {
+		t.Fatalf("second frame = %+v", frame)
+	}
+	var got []byte
+	for len(got) < len(bigData) {
+		typ, chunk, err := conn.ReadMessage()
+		if err != nil || typ != websocket.BinaryMessage {
+			t.Fatalf("chunk: type %d, err %v", typ, err)
+		}
+		got = append(got, chunk...)
+	}
+	if !bytes.Equal(got, bigData) {
+		t.Fatal("chunked data mismatch")
+	}
+
+	if err := ch.SendMedia(context.Background(), bus.OutboundMediaMessage{ChatID: "pico:nobody", Parts: []bus.MediaPart{{Ref: smallRef}}}); err == nil {
+		t.Fatal("expected error without a connection for the session")
+	}
+}
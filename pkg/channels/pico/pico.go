@@ -27,6 +27,11 @@ type picoConn struct {
 	sessionID string
 	writeMu   sync.Mutex
 	closed    atomic.Bool
+
+	// Only touched by the connection's read loop.
+	upload  *upload                 // media.send awaiting binary frames
+	version int                     // negotiated protocol version
+	joined  map[string]*picoSession // sessions this connection receives
 }
 
 // writeJSON sends a JSON message to the connection with write locking.
@@ -54,6 +59,9 @@ type PicoChannel struct {
 	upgrader    websocket.Upgrader
 	connections sync.Map // connID → *picoConn
 	connCount   atomic.Int32
+	sessionsMu  sync.Mutex
+	sessions    map[string]*picoSession
+	replayBytes atomic.Int64 // media held for replay across sessions
 	ctx         context.Context
 	cancel      context.CancelFunc
 }
@@ -88,6 +96,7 @@ func NewPicoChannel(cfg config.PicoConfig, messageBus *bus.MessageBus) (*PicoCha
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
 		},
+		sessions: make(map[string]*picoSession),
 	}, nil
 }
 
@@ -95,6 +104,7 @@ func NewPicoChannel(cfg config.PicoConfig, messageBus *bus.MessageBus) (*PicoCha
 func (c *PicoChannel) Start(ctx context.Context) error {
 	logger.InfoC("pico", "Starting Pico Protocol channel")
 	c.ctx, c.cancel = context.WithCancel(ctx)
+	go c.sweepSessions(c.ctx)
 	c.SetRunning(true)
 	logger.InfoC("pico", "Pico Protocol channel started")
 	return nil
@@ -147,7 +157,7 @@ func (c *PicoChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 		"content": msg.Content,
 	})
 
-	return c.broadcastToSession(msg.ChatID, outMsg)
+	return c.publish(msg.ChatID, outMsg, nil)
 }
 
 // EditMessage implements channels.MessageEditor.
@@ -156,18 +166,18 @@ func (c *PicoChannel) EditMessage(ctx context.Context, chatID string, messageID
 		"message_id": messageID,
 		"content":    content,
 	})
-	return c.broadcastToSession(chatID, outMsg)
+	return c.publish(chatID, outMsg, nil)
 }
 
 // StartTyping implements channels.TypingCapable.
 func (c *PicoChannel) StartTyping(ctx context.Context, chatID string) (func(), error) {
 	startMsg := newMessage(TypeTypingStart, nil)
-	if err := c.broadcastToSession(chatID, startMsg); err != nil {
+	if err := c.broadcast(chatID, startMsg); err != nil {
 		return func() {}, err
 	}
 	return func() {
 		stopMsg := newMessage(TypeTypingStop, nil)
-		c.broadcastToSession(chatID, stopMsg)
+		c.broadcast(chatID, stopMsg)
 	}, nil
 }
 
@@ -190,39 +200,36 @@ func (c *PicoChannel) SendPlaceholder(ctx context.Context, chatID string) (strin
 		"message_id": msgID,
 	})
 
-	if err := c.broadcastToSession(chatID, outMsg); err != nil {
+	if err := c.publish(chatID, outMsg, nil); err != nil {
 		return "", err
 	}
 
 	return msgID, nil
 }
 
-// broadcastToSession sends a message to all connections with a matching session.
-func (c *PicoChannel) broadcastToSession(chatID string, msg PicoMessage) error {
+// publish sends a message, followed by data as binary frames if non-empty,
+// to a session. The session keeps it for clients that resume later, so it
+// succeeds even when no connection is attached.
+func (c *PicoChannel) publish(chatID string, msg PicoMessage, data []byte) error {
 	// chatID format: "pico:<sessionID>"
 	sessionID := strings.TrimPrefix(chatID, "pico:")
-	msg.SessionID = sessionID
-
-	var sent bool
-	c.connections.Range(func(key, value any) bool {
-		pc, ok := value.(*picoConn)
-		if !ok {
-			return true
-		}
-		if pc.sessionID == sessionID {
-			if err := pc.writeJSON(msg); err != nil {
-				logger.DebugCF("pico", "Write to connection failed", map[string]any{
-					"conn_id": pc.id,
-					"error":   err.Error(),
-				})
-			} else {
-				sent = true
-			}
-		}
-		return true
-	})
+	sess := c.session(sessionID, false)
+	if sess == nil {
+		return fmt.Errorf("unknown session %s: %w", sessionID, channels.ErrSendFailed)
+	}
+	sess.publish(msg, data)
+	if c.replayBytes.Load() > maxTotalReplayBytes {
+		c.trimReplay()
+	}
+	return nil
+}
 
-	if !sent {
+// broadcast sends a transient message to the connections attached to a
+// session.
+func (c *PicoChannel) broadcast(chatID string, msg PicoMessage) error {
+	sessionID := strings.TrimPrefix(chatID, "pico:")
+	sess := c.session(sessionID, false)
+	if sess == nil || !sess.broadcast(msg) {
 		return fmt.Errorf("no active connections for session %s: %w", sessionID, channels.ErrSendFailed)
 	}
 	return nil
@@ -269,7 +276,10 @@ func (c *PicoChannel) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		id:        uuid.New().String(),
 		conn:      conn,
 		sessionID: sessionID,
+		version:   1,
+		joined:    make(map[string]*picoSession),
 	}
+	c.joinSession(pc, sessionID)
 
 	c.connections.Store(pc.id, pc)
 	c.connCount.Add(1)
@@ -311,6 +321,11 @@ func (c *PicoChannel) authenticate(r *http.Request) bool {
 // readLoop reads messages from a WebSocket connection.
 func (c *PicoChannel) readLoop(pc *picoConn) {
 	defer func() {
+		if pc.upload != nil {
+			pc.upload.abort()
+			pc.upload = nil
+		}
+		c.leaveSessions(pc)
 		pc.close()
 		c.connections.Delete(pc.id)
 		c.connCount.Add(-1)
@@ -325,6 +340,8 @@ func (c *PicoChannel) readLoop(pc *picoConn) {
 		readTimeout = 60 * time.Second
 	}
 
+	// Inline media arrives base64-encoded in a single frame.
+	pc.conn.SetReadLimit(int64(c.maxMediaSize())*4/3 + 64<<10)
 	_ = pc.conn.SetReadDeadline(time.Now().Add(readTimeout))
 	pc.conn.SetPongHandler(func(appData string) error {
 		_ = pc.conn.SetReadDeadline(time.Now().Add(readTimeout))
@@ -345,7 +362,7 @@ func (c *PicoChannel) readLoop(pc *picoConn) {
 		default:
 		}
 
-		_, rawMsg, err := pc.conn.ReadMessage()
+		msgType, rawMsg, err := pc.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 				logger.DebugCF("pico", "WebSocket read error", map[string]any{
@@ -358,6 +375,11 @@ func (c *PicoChannel) readLoop(pc *picoConn) {
 
 		_ = pc.conn.SetReadDeadline(time.Now().Add(readTimeout))
 
+		if msgType == websocket.BinaryMessage {
+			c.handleBinary(pc, rawMsg)
+			continue
+		}
+
 		var msg PicoMessage
 		if err := json.Unmarshal(rawMsg, &msg); err != nil {
 			errMsg := newError("invalid_message", "failed to parse message")
@@ -403,6 +425,26 @@ func (c *PicoChannel) handleMessage(pc *picoConn, msg PicoMessage) {
 	case TypeMessageSend:
 		c.handleMessageSend(pc, msg)
 
+	case TypeMediaSend:
+		c.handleMediaSend(pc, msg)
+
+	case TypeHello:
+		c.handleHello(pc, msg)
+
+	case TypeAck, TypeSessionResume, TypeHistoryGet:
+		if pc.version < 2 {
+			pc.writeJSON(replyError(msg, "hello_required", msg.Type+" needs protocol version 2; send hello first"))
+			return
+		}
+		switch msg.Type {
+		case TypeAck:
+			c.handleAck(pc, msg)
+		case TypeSessionResume:
+			c.handleSessionResume(pc, msg)
+		case TypeHistoryGet:
+			c.handleHistoryGet(pc, msg)
+		}
+
 	default:
 		errMsg := newError("unknown_type", fmt.Sprintf("unknown message type: %s", msg.Type))
 		pc.writeJSON(errMsg)
@@ -418,13 +460,27 @@ func (c *PicoChannel) handleMessageSend(pc *picoConn, msg PicoMessage) {
 		return
 	}
 
+	c.dispatch(pc, msg, content, nil)
+}
+
+// picoSender is the sender every Pico message is attributed to.
+func picoSender() bus.SenderInfo {
+	return bus.SenderInfo{
+		Platform:    "pico",
+		PlatformID:  "pico-user",
+		CanonicalID: identity.BuildCanonicalID("pico", "pico-user"),
+	}
+}
+
+// dispatch passes a client message, with any media refs, to the agent.
+func (c *PicoChannel) dispatch(pc *picoConn, msg PicoMessage, content string, mediaRefs []string) {
 	sessionID := msg.SessionID
 	if sessionID == "" {
 		sessionID = pc.sessionID
 	}
 
 	chatID := "pico:" + sessionID
-	senderID := "pico-user"
+	sender := picoSender()
 
 	peer := bus.Peer{Kind: "direct", ID: "pico:" + sessionID}
 
@@ -439,17 +495,12 @@ func (c *PicoChannel) handleMessageSend(pc *picoConn, msg PicoMessage) {
 		"preview":    truncate(content, 50),
 	})
 
-	sender := bus.SenderInfo{
-		Platform:    "pico",
-		PlatformID:  senderID,
-		CanonicalID: identity.BuildCanonicalID("pico", senderID),
-	}
-
 	if !c.IsAllowedSender(sender) {
 		return
 	}
 
-	c.HandleMessage(c.ctx, peer, msg.ID, senderID, chatID, content, nil, metadata, sender)
+	c.joinSession(pc, sessionID).addUserMessage(msg.ID, content)
+	c.HandleMessage(c.ctx, peer, msg.ID, sender.PlatformID, chatID, content, mediaRefs, metadata, sender)
 }
 
 // truncate truncates a string to maxLen runes.
@@ -3,12 +3,51 @@ package pico
 import "time"
 
 // Protocol message types.
+//
+// media.send uploads one file, with payload fields "filename",
+// "content_type" and an optional "content" caption. The file is either
+// inline as base64 in "data", or announced with its byte count in "size" and
+// then sent as binary frames on the same connection until "size" bytes have
+// arrived. media.create delivers a file the same way in the other direction,
+// with "type", "filename", "content_type", "caption" and "size": files up to
+// inlineMediaSize are inline in "data", larger ones follow as binary frames.
+//
+// Protocol version 2 is negotiated with a hello frame: the client sends
+// {"type":"hello","payload":{"versions":[1,2]}} and the server answers with
+// a hello whose "protocol_version" is the highest version both support,
+// along with "connection_id", "session_id" (the connection's initial
+// session), "replay_buffer_size" and "history_size". Clients that never send
+// hello speak version 1. In version 2:
+//
+//   - message.create, message.update and media.create carry a per-session
+//     "seq". The client acknowledges with {"type":"ack","session_id":...,
+//     "payload":{"seq":N}}, which lets the server drop frames up to N from
+//     its replay buffer.
+//   - session.resume, with "session_id" and payload {"last_seq":N}, attaches
+//     the connection to a session and replays the frames after N. The server
+//     answers with session.resumed: {"last_seq","replayed","gap"}, where gap
+//     means frames were lost and history.get should be used. The hello
+//     payload may list {"session_id","last_seq"} objects under "sessions" to
+//     resume them all at once.
+//   - history.get, with "session_id" and an optional payload {"limit":N},
+//     is answered by a history frame whose payload "messages" lists the
+//     session's recent messages, oldest first.
+//   - A connection may join any number of sessions; message.send to a session
+//     joins it too, and replies go to every connection that joined.
 const (
 	// TypeMessageSend is sent from client to server.
 	TypeMessageSend = "message.send"
 	TypeMediaSend   = "media.send"
 	TypePing        = "ping"
 
+	// Version 2 frames sent from client to server.
+	TypeAck           = "ack"
+	TypeSessionResume = "session.resume"
+	TypeHistoryGet    = "history.get"
+
+	// TypeHello is sent in both directions.
+	TypeHello = "hello"
+
 	// TypeMessageCreate is sent from server to client.
 	TypeMessageCreate = "message.create"
 	TypeMessageUpdate = "message.update"
@@ -17,6 +56,10 @@ const (
 	TypeTypingStop    = "typing.stop"
 	TypeError         = "error"
 	TypePong          = "pong"
+
+	// Version 2 frames sent from server to client.
+	TypeSessionResumed = "session.resumed"
+	TypeHistory        = "history"
 )
 
 // PicoMessage is the wire format for all Pico Protocol messages.
@@ -24,6 +67,7 @@ type PicoMessage struct {
 	Type      string         `json:"type"`
 	ID        string         `json:"id,omitempty"`
 	SessionID string         `json:"session_id,omitempty"`
+	Seq       uint64         `json:"seq,omitempty"`
 	Timestamp int64          `json:"timestamp,omitempty"`
 	Payload   map[string]any `json:"payload,omitempty"`
 }
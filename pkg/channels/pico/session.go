@@ -0,0 +1,528 @@
+package pico
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ProtocolVersion is the newest Pico Protocol version the server speaks.
+// Version 1 is plain message exchange on the connection's session; version 2
+// adds sequence numbers, acks, resume, history and joining several sessions,
+// and is enabled by a hello exchange.
+const ProtocolVersion = 2
+
+const (
+	defaultReplayBufferSize = 100
+	defaultHistorySize      = 50
+
+	// maxReplayBytes bounds the media kept for replay in one session.
+	maxReplayBytes = 8 << 20
+	// maxTotalReplayBytes bounds the media kept for replay across all
+	// sessions; the least recently active sessions give theirs up first.
+	maxTotalReplayBytes = 128 << 20
+	// maxSessions bounds the sessions kept in memory; idle ones are evicted
+	// first.
+	maxSessions = 1000
+	// sessionIdleTTL is how long a session with no connection attached is
+	// kept after its last activity.
+	sessionIdleTTL = 24 * time.Hour
+)
+
+// sessionSweepInterval is how often expired sessions are dropped; a variable
+// so tests can shorten it.
+var sessionSweepInterval = 10 * time.Minute
+
+// picoSession is the server side of a conversation. It outlives the
+// connections attached to it, so frames sent while a client is away can be
+// replayed when it resumes.
+type picoSession struct {
+	id string
+
+	mu         sync.Mutex
+	seq        uint64
+	replay     []replayEntry // unacknowledged frames, oldest first
+	replaySize int           // bytes of media held in replay
+	evicted    uint64        // highest seq dropped from replay before it was acked
+	history    []historyEntry
+	conns      map[string]*picoConn
+	lastActive time.Time
+
+	maxReplay   int
+	maxHistory  int
+	replayTotal *atomic.Int64 // the channel's replay bytes across sessions
+}
+
+type replayEntry struct {
+	msg  PicoMessage
+	data []byte
+}
+
+// historyEntry is one message in a history response.
+type historyEntry struct {
+	Seq       uint64 `json:"seq,omitempty"`
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	MessageID string `json:"message_id,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// session returns the session with the given ID, creating it if create is
+// set. It returns nil for an unknown session otherwise.
+func (c *PicoChannel) session(id string, create bool) *picoSession {
+	c.sessionsMu.Lock()
+	defer c.sessionsMu.Unlock()
+
+	if s, ok := c.sessions[id]; ok {
+		return s
+	}
+	if !create {
+		return nil
+	}
+	if len(c.sessions) >= maxSessions {
+		c.evictIdleSessionLocked()
+	}
+
+	maxReplay, maxHistory := c.bufferSizes()
+	s := &picoSession{
+		id:          id,
+		conns:       make(map[string]*picoConn),
+		lastActive:  time.Now(),
+		maxReplay:   maxReplay,
+		maxHistory:  maxHistory,
+		replayTotal: &c.replayBytes,
+	}
+	c.sessions[id] = s
+	return s
+}
+
+// bufferSizes returns the configured replay buffer and history lengths.
+func (c *PicoChannel) bufferSizes() (replay, history int) {
+	replay, history = c.config.ReplayBufferSize, c.config.HistorySize
+	if replay <= 0 {
+		replay = defaultReplayBufferSize
+	}
+	if history <= 0 {
+		history = defaultHistorySize
+	}
+	return replay, history
+}
+
+// evictIdleSessionLocked drops the least recently active session that has
+// no connection attached.
+func (c *PicoChannel) evictIdleSessionLocked() {
+	var oldest *picoSession
+	for _, s := range c.sessions {
+		s.mu.Lock()
+		idle := len(s.conns) == 0
+		s.mu.Unlock()
+		if idle && (oldest == nil || s.lastActive.Before(oldest.lastActive)) {
+			oldest = s
+		}
+	}
+	if oldest != nil {
+		c.removeSessionLocked(oldest)
+		logger.DebugCF("pico", "Evicted idle session", map[string]any{
+			"session_id": oldest.id,
+		})
+	}
+}
+
+func (c *PicoChannel) removeSessionLocked(s *picoSession) {
+	s.mu.Lock()
+	s.dropReplayLocked(len(s.replay))
+	s.mu.Unlock()
+	delete(c.sessions, s.id)
+}
+
+// sweepSessions drops the sessions that have had no connection and no
+// activity for sessionIdleTTL, until the channel stops.
+func (c *PicoChannel) sweepSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.evictExpiredSessions(time.Now().Add(-sessionIdleTTL))
+		}
+	}
+}
+
+// evictExpiredSessions drops the idle sessions last active before cutoff.
+func (c *PicoChannel) evictExpiredSessions(cutoff time.Time) {
+	c.sessionsMu.Lock()
+	defer c.sessionsMu.Unlock()
+	for _, s := range c.sessions {
+		s.mu.Lock()
+		expired := len(s.conns) == 0 && s.lastActive.Before(cutoff)
+		s.mu.Unlock()
+		if expired {
+			c.removeSessionLocked(s)
+			logger.DebugCF("pico", "Expired idle session", map[string]any{
+				"session_id": s.id,
+			})
+		}
+	}
+}
+
+// trimReplay frees replay media of the least recently active sessions until
+// the total is within maxTotalReplayBytes. Clients resuming those sessions
+// are told about the gap and fetch the history instead.
+func (c *PicoChannel) trimReplay() {
+	c.sessionsMu.Lock()
+	defer c.sessionsMu.Unlock()
+
+	type candidate struct {
+		s          *picoSession
+		lastActive time.Time
+	}
+	var candidates []candidate
+	for _, s := range c.sessions {
+		s.mu.Lock()
+		if s.replaySize > 0 {
+			candidates = append(candidates, candidate{s, s.lastActive})
+		}
+		s.mu.Unlock()
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastActive.Before(candidates[j].lastActive)
+	})
+	for _, cand := range candidates {
+		if c.replayBytes.Load() <= maxTotalReplayBytes {
+			return
+		}
+		s := cand.s
+		s.mu.Lock()
+		n := 0
+		for i, e := range s.replay {
+			if len(e.data) > 0 {
+				n = i + 1
+			}
+		}
+		s.dropReplayLocked(n)
+		s.mu.Unlock()
+	}
+}
+
+// joinSession attaches pc to a session, creating it if needed.
+func (c *PicoChannel) joinSession(pc *picoConn, id string) *picoSession {
+	if s, ok := pc.joined[id]; ok {
+		return s
+	}
+	s := c.session(id, true)
+	s.mu.Lock()
+	s.conns[pc.id] = pc
+	s.lastActive = time.Now()
+	s.mu.Unlock()
+	pc.joined[id] = s
+	return s
+}
+
+// leaveSessions detaches pc from every session it joined.
+func (c *PicoChannel) leaveSessions(pc *picoConn) {
+	for id, s := range pc.joined {
+		s.mu.Lock()
+		delete(s.conns, pc.id)
+		s.lastActive = time.Now()
+		s.mu.Unlock()
+		delete(pc.joined, id)
+	}
+}
+
+// publish numbers msg, keeps it for replay and history, and writes it to
+// every attached connection. Holding the lock while writing keeps frames in
+// sequence order on every connection.
+func (s *picoSession) publish(msg PicoMessage, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	msg.Seq = s.seq
+	msg.SessionID = s.id
+	s.lastActive = time.Now()
+
+	s.replay = append(s.replay, replayEntry{msg: msg, data: data})
+	s.replaySize += len(data)
+	s.replayTotal.Add(int64(len(data)))
+	for len(s.replay) > s.maxReplay || (s.replaySize > maxReplayBytes && len(s.replay) > 1) {
+		s.dropReplayLocked(1)
+	}
+	s.recordLocked(msg)
+
+	s.writeLocked(msg, data)
+}
+
+// dropReplayLocked evicts the n oldest frames from the replay buffer before
+// they were acknowledged.
+func (s *picoSession) dropReplayLocked(n int) {
+	if n == 0 {
+		return
+	}
+	var size int
+	for _, e := range s.replay[:n] {
+		size += len(e.data)
+	}
+	s.evicted = s.replay[n-1].msg.Seq
+	s.replaySize -= size
+	s.replayTotal.Add(-int64(size))
+	s.replay = s.replay[n:]
+}
+
+// broadcast writes a frame that is not worth replaying, such as a typing
+// indicator, and reports whether any connection received it.
+func (s *picoSession) broadcast(msg PicoMessage) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg.SessionID = s.id
+	return s.writeLocked(msg, nil)
+}
+
+func (s *picoSession) writeLocked(msg PicoMessage, data []byte) bool {
+	var sent bool
+	for _, pc := range s.conns {
+		if err := pc.writeFrames(msg, data); err != nil {
+			logger.DebugCF("pico", "Write to connection failed", map[string]any{
+				"conn_id": pc.id,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		sent = true
+	}
+	return sent
+}
+
+// recordLocked adds an outbound frame to the history. An update replaces the
+// content of the message it edits, so placeholders don't linger.
+func (s *picoSession) recordLocked(msg PicoMessage) {
+	content, _ := msg.Payload["content"].(string)
+	messageID, _ := msg.Payload["message_id"].(string)
+	switch msg.Type {
+	case TypeMessageCreate:
+	case TypeMessageUpdate:
+		for i := len(s.history) - 1; i >= 0; i-- {
+			if s.history[i].MessageID == messageID {
+				s.history[i].Content = content
+				s.history[i].Seq = msg.Seq
+				return
+			}
+		}
+	case TypeMediaCreate:
+		typ, _ := msg.Payload["type"].(string)
+		filename, _ := msg.Payload["filename"].(string)
+		content = fmt.Sprintf("[%s: %s]", typ, filename)
+		if caption, _ := msg.Payload["caption"].(string); caption != "" {
+			content = caption + "\n" + content
+		}
+	default:
+		return
+	}
+	s.addHistoryLocked(historyEntry{
+		Seq:       msg.Seq,
+		Role:      "assistant",
+		Content:   content,
+		MessageID: messageID,
+		Timestamp: msg.Timestamp,
+	})
+}
+
+// addUserMessage records a message from the client in the history.
+func (s *picoSession) addUserMessage(messageID, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastActive = time.Now()
+	s.addHistoryLocked(historyEntry{
+		Role:      "user",
+		Content:   content,
+		MessageID: messageID,
+		Timestamp: time.Now().UnixMilli(),
+	})
+}
+
+func (s *picoSession) addHistoryLocked(e historyEntry) {
+	s.history = append(s.history, e)
+	if over := len(s.history) - s.maxHistory; over > 0 {
+		s.history = append(s.history[:0:0], s.history[over:]...)
+	}
+}
+
+// recentHistory returns up to limit of the latest history entries, oldest
+// first. A limit of zero or less returns everything kept.
+func (s *picoSession) recentHistory(limit int) []historyEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.history
+	if limit > 0 && len(h) > limit {
+		h = h[len(h)-limit:]
+	}
+	return append([]historyEntry{}, h...)
+}
+
+// ack drops the frames up to seq from the replay buffer.
+func (s *picoSession) ack(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, size := 0, 0
+	for i < len(s.replay) && s.replay[i].msg.Seq <= seq {
+		size += len(s.replay[i].data)
+		i++
+	}
+	s.replaySize -= size
+	s.replayTotal.Add(-int64(size))
+	s.replay = s.replay[i:]
+}
+
+// resume attaches pc and writes the frames after lastSeq to it. gap reports
+// that some of them are no longer available, or that lastSeq is from before
+// a server restart, so the client should fetch the history instead.
+func (s *picoSession) resume(pc *picoConn, lastSeq uint64) (replayed int, gap bool, current uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[pc.id] = pc
+	s.lastActive = time.Now()
+
+	gap = lastSeq < s.evicted || lastSeq > s.seq
+	for _, e := range s.replay {
+		if e.msg.Seq <= lastSeq {
+			continue
+		}
+		if err := pc.writeFrames(e.msg, e.data); err != nil {
+			break
+		}
+		replayed++
+	}
+	return replayed, gap, s.seq
+}
+
+// handleHello negotiates the protocol version and resumes any sessions the
+// client lists.
+func (c *PicoChannel) handleHello(pc *picoConn, msg PicoMessage) {
+	var offered []int
+	if versions, ok := msg.Payload["versions"].([]any); ok {
+		for _, v := range versions {
+			if n, ok := v.(float64); ok {
+				offered = append(offered, int(n))
+			}
+		}
+	} else if v, ok := msg.Payload["protocol_version"].(float64); ok {
+		offered = append(offered, int(v))
+	} else {
+		offered = []int{1}
+	}
+
+	version := 0
+	for _, v := range offered {
+		if v >= 1 && v <= ProtocolVersion && v > version {
+			version = v
+		}
+	}
+	if version == 0 {
+		pc.writeJSON(replyError(msg, "unsupported_version",
+			fmt.Sprintf("no common protocol version; server supports 1 to %d", ProtocolVersion)))
+		return
+	}
+	pc.version = version
+
+	maxReplay, maxHistory := c.bufferSizes()
+	reply := newMessage(TypeHello, map[string]any{
+		"protocol_version":   version,
+		"connection_id":      pc.id,
+		"session_id":         pc.sessionID,
+		"replay_buffer_size": maxReplay,
+		"history_size":       maxHistory,
+	})
+	reply.ID = msg.ID
+	pc.writeJSON(reply)
+
+	if version < 2 {
+		return
+	}
+	sessions, _ := msg.Payload["sessions"].([]any)
+	for _, item := range sessions {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		id, _ := entry["session_id"].(string)
+		lastSeq, _ := entry["last_seq"].(float64)
+		if id != "" {
+			c.resumeSession(pc, "", id, uint64(lastSeq))
+		}
+	}
+}
+
+// handleAck drops acknowledged frames from a session's replay buffer.
+func (c *PicoChannel) handleAck(pc *picoConn, msg PicoMessage) {
+	seq, ok := msg.Payload["seq"].(float64)
+	if !ok || seq < 0 {
+		pc.writeJSON(replyError(msg, "invalid_ack", "ack needs a seq"))
+		return
+	}
+	if s, ok := pc.joined[requestSession(pc, msg)]; ok {
+		s.ack(uint64(seq))
+	}
+}
+
+// handleSessionResume attaches the connection to a session and replays what
+// it missed.
+func (c *PicoChannel) handleSessionResume(pc *picoConn, msg PicoMessage) {
+	lastSeq, _ := msg.Payload["last_seq"].(float64)
+	if lastSeq < 0 {
+		lastSeq = 0
+	}
+	c.resumeSession(pc, msg.ID, requestSession(pc, msg), uint64(lastSeq))
+}
+
+func (c *PicoChannel) resumeSession(pc *picoConn, requestID, id string, lastSeq uint64) {
+	s := c.session(id, true)
+	pc.joined[id] = s
+
+	replayed, gap, current := s.resume(pc, lastSeq)
+	logger.DebugCF("pico", "Session resumed", map[string]any{
+		"session_id": id,
+		"conn_id":    pc.id,
+		"last_seq":   lastSeq,
+		"replayed":   replayed,
+		"gap":        gap,
+	})
+
+	reply := newMessage(TypeSessionResumed, map[string]any{
+		"last_seq": current,
+		"replayed": replayed,
+		"gap":      gap,
+	})
+	reply.ID = requestID
+	reply.SessionID = id
+	pc.writeJSON(reply)
+}
+
+// handleHistoryGet answers with the recent messages of a session.
+func (c *PicoChannel) handleHistoryGet(pc *picoConn, msg PicoMessage) {
+	id := requestSession(pc, msg)
+	limit, _ := msg.Payload["limit"].(float64)
+
+	messages := []historyEntry{}
+	if s := c.session(id, false); s != nil {
+		messages = s.recentHistory(int(limit))
+	}
+	reply := newMessage(TypeHistory, map[string]any{"messages": messages})
+	reply.ID = msg.ID
+	reply.SessionID = id
+	pc.writeJSON(reply)
+}
+
+// requestSession returns the session a client frame refers to, defaulting to
+// the connection's initial session.
+func requestSession(pc *picoConn, msg PicoMessage) string {
+	if msg.SessionID != "" {
+		return msg.SessionID
+	}
+	return pc.sessionID
+}
@@ -0,0 +1,276 @@
+package pico
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/bus/bustest"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// dial opens another authenticated connection to the channel's server.
+func dial(t *testing.T, ch *PicoChannel, sessionID string) *websocket.Conn {
+	t.Helper()
+	srv := httptestServer(t, ch)
+	conn, _, err := websocket.DefaultDialer.Dial(srv+"/pico/ws?session_id="+sessionID, http.Header{"Authorization": {"Bearer tok"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func hello(t *testing.T, conn *websocket.Conn, payload map[string]any) PicoMessage {
+	t.Helper()
+	conn.WriteJSON(PicoMessage{Type: TypeHello, ID: "h", Payload: payload})
+	return readFrame(t, conn)
+}
+
+func send(t *testing.T, ch *PicoChannel, chatID, content string) {
+	t.Helper()
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: chatID, Content: content}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+}
+
+func TestHello(t *testing.T) {
+	_, _, conn := newTestChannel(t, 0)
+
+	frame := hello(t, conn, map[string]any{"versions": []int{1, 2, 7}})
+	if frame.Type != TypeHello || frame.ID != "h" || frame.Payload["protocol_version"] != float64(2) {
+		t.Fatalf("hello = %+v", frame)
+	}
+	if frame.Payload["session_id"] != "s1" || frame.Payload["replay_buffer_size"] != float64(defaultReplayBufferSize) {
+		t.Fatalf("hello payload = %v", frame.Payload)
+	}
+
+	frame = hello(t, conn, map[string]any{"versions": []int{3}})
+	if frame.Type != TypeError || frame.Payload["code"] != "unsupported_version" {
+		t.Fatalf("frame = %+v, want unsupported_version", frame)
+	}
+}
+
+func TestVersion2FramesNeedHello(t *testing.T) {
+	_, _, conn := newTestChannel(t, 0)
+	for _, typ := range []string{TypeAck, TypeSessionResume, TypeHistoryGet} {
+		conn.WriteJSON(PicoMessage{Type: typ, Payload: map[string]any{}})
+		if frame := readFrame(t, conn); frame.Type != TypeError || frame.Payload["code"] != "hello_required" {
+			t.Fatalf("%s: frame = %+v", typ, frame)
+		}
+	}
+}
+
+func TestResumeReplaysMissedFrames(t *testing.T) {
+	ch, _, conn := newTestChannel(t, 0)
+	hello(t, conn, map[string]any{"versions": []int{1, 2}})
+
+	send(t, ch, "pico:s1", "one")
+	if frame := readFrame(t, conn); frame.Seq != 1 || frame.SessionID != "s1" {
+		t.Fatalf("frame = %+v", frame)
+	}
+	conn.WriteJSON(PicoMessage{Type: TypeAck, Payload: map[string]any{"seq": 1}})
+
+	// Replies sent while the client is away are kept for it.
+	conn.Close()
+	waitFor(t, func() bool { return ch.connCount.Load() == 0 })
+	send(t, ch, "pico:s1", "two")
+	send(t, ch, "pico:s1", "three")
+
+	conn = dial(t, ch, "other")
+	hello(t, conn, map[string]any{"versions": []int{2}})
+	conn.WriteJSON(PicoMessage{Type: TypeSessionResume, ID: "r", SessionID: "s1", Payload: map[string]any{"last_seq": 1}})
+	for i, want := range []string{"two", "three"} {
+		frame := readFrame(t, conn)
+		if frame.Seq != uint64(i+2) || frame.Payload["content"] != want {
+			t.Fatalf("replayed frame %d = %+v", i, frame)
+		}
+	}
+	frame := readFrame(t, conn)
+	if frame.Type != TypeSessionResumed || frame.ID != "r" || frame.Payload["replayed"] != float64(2) ||
+		frame.Payload["gap"] != false || frame.Payload["last_seq"] != float64(3) {
+		t.Fatalf("resumed = %+v", frame)
+	}
+
+	// The resumed connection now receives live replies too.
+	send(t, ch, "pico:s1", "four")
+	if frame := readFrame(t, conn); frame.Seq != 4 || frame.Payload["content"] != "four" {
+		t.Fatalf("live frame = %+v", frame)
+	}
+}
+
+func TestResumeFromHello(t *testing.T) {
+	ch, _, conn := newTestChannel(t, 0)
+	send(t, ch, "pico:s1", "one")
+	readFrame(t, conn)
+
+	conn2 := dial(t, ch, "s2")
+	hello(t, conn2, map[string]any{
+		"versions": []int{2},
+		"sessions": []map[string]any{{"session_id": "s1", "last_seq": 0}},
+	})
+	if frame := readFrame(t, conn2); frame.Payload["content"] != "one" {
+		t.Fatalf("replayed frame = %+v", frame)
+	}
+	if frame := readFrame(t, conn2); frame.Type != TypeSessionResumed || frame.SessionID != "s1" {
+		t.Fatalf("resumed = %+v", frame)
+	}
+}
+
+func TestResumeReportsGap(t *testing.T) {
+	ch, _, conn := newTestChannelWithConfig(t, config.PicoConfig{ReplayBufferSize: 2})
+	hello(t, conn, map[string]any{"versions": []int{2}})
+	for _, s := range []string{"a", "b", "c"} {
+		send(t, ch, "pico:s1", s)
+		readFrame(t, conn)
+	}
+
+	conn.WriteJSON(PicoMessage{Type: TypeSessionResume, Payload: map[string]any{"last_seq": 0}})
+	readFrame(t, conn)
+	readFrame(t, conn)
+	if frame := readFrame(t, conn); frame.Type != TypeSessionResumed || frame.Payload["gap"] != true || frame.Payload["replayed"] != float64(2) {
+		t.Fatalf("resumed = %+v", frame)
+	}
+
+	// Acked frames are not replayed again.
+	conn.WriteJSON(PicoMessage{Type: TypeAck, Payload: map[string]any{"seq": 3}})
+	conn.WriteJSON(PicoMessage{Type: TypeSessionResume, Payload: map[string]any{"last_seq": 3}})
+	if frame := readFrame(t, conn); frame.Type != TypeSessionResumed || frame.Payload["replayed"] != float64(0) || frame.Payload["gap"] != false {
+		t.Fatalf("resumed = %+v", frame)
+	}
+}
+
+func TestHistoryGet(t *testing.T) {
+	ch, mb, conn := newTestChannelWithConfig(t, config.PicoConfig{Placeholder: config.PlaceholderConfig{Enabled: true}})
+	hello(t, conn, map[string]any{"versions": []int{2}})
+
+	conn.WriteJSON(PicoMessage{Type: TypeMessageSend, ID: "u1", Payload: map[string]any{"content": "hi"}})
+	bustest.Consume(t, mb)
+	id, err := ch.SendPlaceholder(context.Background(), "pico:s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readFrame(t, conn)
+	ch.EditMessage(context.Background(), "pico:s1", id, "hello there")
+	readFrame(t, conn)
+
+	conn.WriteJSON(PicoMessage{Type: TypeHistoryGet, ID: "q", Payload: map[string]any{"limit": 10}})
+	frame := readFrame(t, conn)
+	if frame.Type != TypeHistory || frame.ID != "q" || frame.SessionID != "s1" {
+		t.Fatalf("history = %+v", frame)
+	}
+	messages, _ := frame.Payload["messages"].([]any)
+	if len(messages) != 2 {
+		t.Fatalf("messages = %v", messages)
+	}
+	first, second := messages[0].(map[string]any), messages[1].(map[string]any)
+	if first["role"] != "user" || first["content"] != "hi" {
+		t.Fatalf("first = %v", first)
+	}
+	if second["role"] != "assistant" || second["content"] != "hello there" || second["message_id"] != id {
+		t.Fatalf("second = %v", second)
+	}
+
+	conn.WriteJSON(PicoMessage{Type: TypeHistoryGet, SessionID: "unknown"})
+	if frame := readFrame(t, conn); frame.Type != TypeHistory || len(frame.Payload["messages"].([]any)) != 0 {
+		t.Fatalf("unknown session history = %+v", frame)
+	}
+}
+
+func TestMultipleSessionsPerConnection(t *testing.T) {
+	ch, mb, conn := newTestChannel(t, 0)
+
+	conn.WriteJSON(PicoMessage{Type: TypeMessageSend, SessionID: "s2", Payload: map[string]any{"content": "other topic"}})
+	if msg := bustest.Consume(t, mb); msg.ChatID != "pico:s2" {
+		t.Fatalf("inbound chat = %s", msg.ChatID)
+	}
+
+	send(t, ch, "pico:s2", "reply two")
+	send(t, ch, "pico:s1", "reply one")
+	for _, want := range []struct{ session, content string }{{"s2", "reply two"}, {"s1", "reply one"}} {
+		frame := readFrame(t, conn)
+		if frame.SessionID != want.session || frame.Payload["content"] != want.content || frame.Seq != 1 {
+			t.Fatalf("frame = %+v, want %+v", frame, want)
+		}
+	}
+}
+
+func httptestServer(t *testing.T, ch *PicoChannel) string {
+	t.Helper()
+	srv := httptest.NewServer(ch)
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplayBudgetAcrossSessions(t *testing.T) {
+	ch, err := NewPicoChannel(config.PicoConfig{Token: "tok"}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 7<<20)
+	n := maxTotalReplayBytes/len(data) + 3
+	for i := range n {
+		id := "s" + string(rune('a'+i))
+		ch.session(id, true)
+		frame := newMessage(TypeMediaCreate, map[string]any{"type": "file", "filename": "f.bin"})
+		if err := ch.publish("pico:"+id, frame, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if total := ch.replayBytes.Load(); total > maxTotalReplayBytes {
+		t.Fatalf("replay bytes = %d, want at most %d", total, maxTotalReplayBytes)
+	}
+	// The oldest session gave up its media; the newest kept it.
+	oldest, newest := ch.session("sa", false), ch.session("s"+string(rune('a'+n-1)), false)
+	if oldest.replaySize != 0 || oldest.evicted == 0 {
+		t.Errorf("oldest session: replay size = %d, evicted = %d", oldest.replaySize, oldest.evicted)
+	}
+	if newest.replaySize != len(data) {
+		t.Errorf("newest session replay size = %d, want %d", newest.replaySize, len(data))
+	}
+}
+
+func TestExpiredSessionsAreEvicted(t *testing.T) {
+	ch, err := NewPicoChannel(config.PicoConfig{Token: "tok"}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"old", "busy", "fresh"} {
+		ch.session(id, true)
+		ch.publish("pico:"+id, newMessage(TypeMediaCreate, map[string]any{}), []byte("payload"))
+	}
+	ch.session("old", false).lastActive = time.Now().Add(-2 * sessionIdleTTL)
+	busy := ch.session("busy", false)
+	busy.lastActive = time.Now().Add(-2 * sessionIdleTTL)
+	busy.conns["c1"] = &picoConn{id: "c1"}
+
+	ch.evictExpiredSessions(time.Now().Add(-sessionIdleTTL))
+
+	if ch.session("old", false) != nil {
+		t.Error("expired idle session was kept")
+	}
+	if ch.session("busy", false) == nil || ch.session("fresh", false) == nil {
+		t.Error("connected or recent sessions were evicted")
+	}
+	if total := ch.replayBytes.Load(); total != 2*int64(len("payload")) {
+		t.Errorf("replay bytes = %d, want %d", total, 2*len("payload"))
+	}
+}
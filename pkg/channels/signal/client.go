@@ -0,0 +1,327 @@
+package signal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxLineSize bounds a single JSON-RPC message on the socket; attachment
+// downloads arrive base64 encoded in one line.
+const maxLineSize = 128 << 20
+
+// rpcError is a JSON-RPC error returned by signal-cli.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("signal-cli: %s (code %d)", e.Message, e.Code)
+}
+
+// httpError is a non-2xx response from the signal-cli HTTP server.
+type httpError struct {
+	Status int
+	Body   string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("signal-cli: HTTP %d: %s", e.Status, e.Body)
+}
+
+var errNotConnected = errors.New("signal-cli: not connected")
+
+type rpcRequest struct {
+	JSONRPC string         `json:"jsonrpc"`
+	Method  string         `json:"method"`
+	Params  map[string]any `json:"params,omitempty"`
+	ID      string         `json:"id"`
+}
+
+type rpcMessage struct {
+	ID     string          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// transport is a connection to the signal-cli daemon. call invokes a JSON-RPC
+// method; listen delivers "receive" notifications to handle until the
+// connection fails or ctx is done.
+type transport interface {
+	call(ctx context.Context, method string, params map[string]any) (json.RawMessage, error)
+	listen(ctx context.Context, handle func(params json.RawMessage)) error
+}
+
+// newTransport picks the transport for endpoint: http(s):// for the daemon's
+// HTTP server, unix:// or tcp:// for its JSON-RPC socket.
+func newTransport(endpoint string) (transport, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signal endpoint %q: %w", endpoint, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &httpTransport{base: strings.TrimRight(endpoint, "/"), http: &http.Client{}}, nil
+	case "unix":
+		return newSocketTransport("unix", u.Path), nil
+	case "tcp":
+		return newSocketTransport("tcp", u.Host), nil
+	default:
+		return nil, fmt.Errorf("invalid signal endpoint %q: use http://, unix:// or tcp://", endpoint)
+	}
+}
+
+// httpTransport uses the HTTP server of "signal-cli daemon --http": requests
+// go to /api/v1/rpc and messages arrive as server-sent events.
+type httpTransport struct {
+	base   string
+	http   *http.Client
+	nextID atomic.Uint64
+}
+
+func (t *httpTransport) call(ctx context.Context, method string, params map[string]any) (json.RawMessage, error) {
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      strconv.FormatUint(t.nextID.Add(1), 10),
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.base+"/api/v1/rpc", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &httpError{Status: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	var msg rpcMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("signal-cli: decode response: %w", err)
+	}
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	return msg.Result, nil
+}
+
+func (t *httpTransport) listen(ctx context.Context, handle func(params json.RawMessage)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.base+"/api/v1/events", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &httpError{Status: resp.StatusCode}
+	}
+
+	reader := bufio.NewReaderSize(resp.Body, 64<<10)
+	var eventType string
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if data.Len() > 0 && (eventType == "" || eventType == "receive") {
+				handle(json.RawMessage(data.String()))
+			}
+			eventType = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// keep-alive comment
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+// socketTransport speaks newline-delimited JSON-RPC over the daemon's unix
+// or TCP socket. Responses and notifications share the connection, so calls
+// only work while listen holds it open.
+type socketTransport struct {
+	network string
+	addr    string
+	nextID  atomic.Uint64
+
+	mu      sync.Mutex
+	conn    net.Conn
+	pending map[string]chan rpcMessage
+}
+
+func newSocketTransport(network, addr string) *socketTransport {
+	return &socketTransport{network: network, addr: addr}
+}
+
+func (t *socketTransport) call(ctx context.Context, method string, params map[string]any) (json.RawMessage, error) {
+	id := strconv.FormatUint(t.nextID.Add(1), 10)
+	line, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Method: method, Params: params, ID: id})
+	if err != nil {
+		return nil, err
+	}
+	line = append(line, '\n')
+
+	ch := make(chan rpcMessage, 1)
+	t.mu.Lock()
+	if t.conn == nil {
+		t.mu.Unlock()
+		return nil, errNotConnected
+	}
+	t.pending[id] = ch
+	_, err = t.conn.Write(line)
+	t.mu.Unlock()
+	if err != nil {
+		t.forget(id)
+		return nil, err
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, errNotConnected
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-ctx.Done():
+		t.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+func (t *socketTransport) forget(id string) {
+	t.mu.Lock()
+	delete(t.pending, id)
+	t.mu.Unlock()
+}
+
+func (t *socketTransport) listen(ctx context.Context, handle func(params json.RawMessage)) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, t.network, t.addr)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.conn = conn
+	t.pending = make(map[string]chan rpcMessage)
+	t.mu.Unlock()
+
+	// Notifications are handled on their own goroutine, queued without
+	// bound: handlers make calls whose responses arrive on this connection,
+	// so the reader must never wait for them.
+	var queueMu sync.Mutex
+	var queue []json.RawMessage
+	wake := make(chan struct{}, 1)
+	done := make(chan struct{})
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		for {
+			queueMu.Lock()
+			batch := queue
+			queue = nil
+			queueMu.Unlock()
+			for _, params := range batch {
+				handle(params)
+			}
+			select {
+			case <-wake:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer func() {
+		stop()
+		conn.Close()
+		t.mu.Lock()
+		t.conn = nil
+		for id, ch := range t.pending {
+			close(ch)
+			delete(t.pending, id)
+		}
+		t.mu.Unlock()
+		close(done)
+		<-handled
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Method != "" {
+			if msg.Method == "receive" {
+				queueMu.Lock()
+				queue = append(queue, msg.Params)
+				queueMu.Unlock()
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+			continue
+		}
+		t.mu.Lock()
+		ch, ok := t.pending[msg.ID]
+		delete(t.pending, msg.ID)
+		t.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
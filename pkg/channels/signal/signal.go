@@ -0,0 +1,740 @@
+package signal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	maxMessageLength = 2000
+	maxDownloadSize  = 50 << 20
+	maxUploadSize    = 95 << 20
+	typingInterval   = 10 * time.Second
+	minRetryDelay    = 2 * time.Second
+	maxRetryDelay    = 2 * time.Minute
+	groupPrefix      = "group:"
+	reactionEmoji    = "👀"
+)
+
+// SignalChannel implements the Channel interface for Signal through a
+// signal-cli daemon. Direct chats use the sender's number (or UUID) as chat
+// ID; groups use "group:<groupId>".
+type SignalChannel struct {
+	*channels.BaseChannel
+	config   config.SignalConfig
+	rpc      transport
+	selfUUID string // resolved lazily, only touched by the receive goroutine
+	recent   *recentMessages
+	quotes   sync.Map // chatID -> inboundRef to quote in the next reply
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewSignalChannel creates a new Signal channel instance.
+func NewSignalChannel(cfg config.SignalConfig, messageBus *bus.MessageBus) (*SignalChannel, error) {
+	if cfg.Account == "" {
+		return nil, fmt.Errorf("signal account is required")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "http://127.0.0.1:8080"
+	}
+	rpc, err := newTransport(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	base := channels.NewBaseChannel("signal", cfg, messageBus, cfg.AllowFrom,
+		channels.WithMaxMessageLength(maxMessageLength),
+		channels.WithGroupTrigger(cfg.GroupTrigger),
+		channels.WithReasoningChannelID(cfg.ReasoningChannelID),
+	)
+
+	return &SignalChannel{
+		BaseChannel: base,
+		config:      cfg,
+		rpc:         rpc,
+		recent:      newRecentMessages(512),
+	}, nil
+}
+
+// Start begins receiving messages from the daemon. The daemon does not have
+// to be up yet; the channel keeps reconnecting.
+func (c *SignalChannel) Start(ctx context.Context) error {
+	logger.InfoC("signal", "Starting Signal channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	go c.receiveLoop()
+
+	c.SetRunning(true)
+	logger.InfoCF("signal", "Signal channel started", map[string]any{
+		"account": c.config.Account,
+	})
+	return nil
+}
+
+// Stop disconnects from the daemon.
+func (c *SignalChannel) Stop(ctx context.Context) error {
+	logger.InfoC("signal", "Stopping Signal channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.done != nil {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+		}
+	}
+
+	c.SetRunning(false)
+	logger.InfoC("signal", "Signal channel stopped")
+	return nil
+}
+
+// Send delivers msg.Content to msg.ChatID. In groups the first reply after an
+// inbound message quotes it, so it is clear what is being answered.
+func (c *SignalChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+
+	params := c.target(msg.ChatID)
+	params["message"] = msg.Content
+	c.addQuote(params, msg.ChatID)
+	return c.send(ctx, params)
+}
+
+// SendMedia implements the channels.MediaSender interface. Files are passed
+// to signal-cli as data URIs so the daemon does not need to share a
+// filesystem with picoclaw.
+func (c *SignalChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+
+	store := c.GetMediaStore()
+	if store == nil {
+		return fmt.Errorf("no media store available: %w", channels.ErrSendFailed)
+	}
+
+	for _, part := range msg.Parts {
+		localPath, err := store.Resolve(part.Ref)
+		if err != nil {
+			logger.ErrorCF("signal", "Failed to resolve media ref", map[string]any{
+				"ref":   part.Ref,
+				"error": err.Error(),
+			})
+			continue
+		}
+		attachment, err := dataURI(localPath, part)
+		if err != nil {
+			return fmt.Errorf("signal send media: %v: %w", err, channels.ErrSendFailed)
+		}
+
+		params := c.target(msg.ChatID)
+		params["attachments"] = []string{attachment}
+		if part.Caption != "" {
+			params["message"] = part.Caption
+		}
+		c.addQuote(params, msg.ChatID)
+		if err := c.send(ctx, params); err != nil {
+			logger.ErrorCF("signal", "Failed to send media", map[string]any{
+				"chat_id": msg.ChatID,
+				"error":   err.Error(),
+			})
+			return err
+		}
+	}
+	return nil
+}
+
+// dataURI encodes a file in the data URI form signal-cli accepts for
+// attachments.
+func dataURI(localPath string, part bus.MediaPart) (string, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxUploadSize {
+		return "", fmt.Errorf("file too large (%d bytes)", info.Size())
+	}
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return "", err
+	}
+
+	filename := part.Filename
+	if filename == "" {
+		filename = filepath.Base(localPath)
+	}
+	contentType := part.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	// The data URI has no escaping, so keep the separators out of the name.
+	filename = strings.NewReplacer(";", "_", ",", "_").Replace(utils.SanitizeFilename(filename))
+	return fmt.Sprintf("data:%s;filename=%s;base64,%s",
+		contentType, filename, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// StartTyping implements channels.TypingCapable. Signal clients hide the
+// indicator after about 15 seconds, so it is renewed until stop is called.
+func (c *SignalChannel) StartTyping(ctx context.Context, chatID string) (func(), error) {
+	if _, err := c.rpc.call(ctx, "sendTyping", c.target(chatID)); err != nil {
+		return func() {}, err
+	}
+
+	typingCtx, cancel := context.WithCancel(c.ctx)
+	go func() {
+		ticker := time.NewTicker(typingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-typingCtx.Done():
+				stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+				params := c.target(chatID)
+				params["stop"] = true
+				c.rpc.call(stopCtx, "sendTyping", params)
+				stopCancel()
+				return
+			case <-ticker.C:
+				c.rpc.call(typingCtx, "sendTyping", c.target(chatID))
+			}
+		}
+	}()
+
+	return cancel, nil
+}
+
+// ReactToMessage implements channels.ReactionCapable.
+// It adds an "eyes" (👀) reaction to the inbound message and returns an undo
+// function that removes it.
+func (c *SignalChannel) ReactToMessage(ctx context.Context, chatID, messageID string) (func(), error) {
+	ref, ok := c.recent.get(chatID, messageID)
+	if !ok {
+		return func() {}, fmt.Errorf("signal: unknown message %s in %s", messageID, chatID)
+	}
+
+	reaction := func(ctx context.Context, remove bool) error {
+		params := c.target(chatID)
+		params["emoji"] = reactionEmoji
+		params["targetAuthor"] = ref.author
+		params["targetTimestamp"] = ref.timestamp
+		if remove {
+			params["remove"] = true
+		}
+		_, err := c.rpc.call(ctx, "sendReaction", params)
+		return err
+	}
+	if err := reaction(ctx, false); err != nil {
+		return func() {}, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			undoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := reaction(undoCtx, true); err != nil {
+				logger.DebugCF("signal", "Failed to remove reaction", map[string]any{
+					"chat_id": chatID,
+					"error":   err.Error(),
+				})
+			}
+		})
+	}, nil
+}
+
+// target returns the recipient parameters for chatID.
+func (c *SignalChannel) target(chatID string) map[string]any {
+	params := map[string]any{"account": c.config.Account}
+	if groupID, ok := strings.CutPrefix(chatID, groupPrefix); ok {
+		params["groupId"] = groupID
+	} else {
+		params["recipient"] = []string{chatID}
+	}
+	return params
+}
+
+// addQuote quotes the message being answered, once, in group chats.
+func (c *SignalChannel) addQuote(params map[string]any, chatID string) {
+	v, ok := c.quotes.LoadAndDelete(chatID)
+	if !ok {
+		return
+	}
+	ref := v.(inboundRef)
+	params["quoteTimestamp"] = ref.timestamp
+	params["quoteAuthor"] = ref.author
+	params["quoteMessage"] = ref.text
+}
+
+// send calls the "send" method and checks that at least one recipient got
+// the message.
+func (c *SignalChannel) send(ctx context.Context, params map[string]any) error {
+	result, err := c.rpc.call(ctx, "send", params)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	var resp struct {
+		Results []struct {
+			Type string `json:"type"`
+		} `json:"results"`
+	}
+	if json.Unmarshal(result, &resp) != nil || len(resp.Results) == 0 {
+		return nil
+	}
+	for _, r := range resp.Results {
+		if r.Type == "SUCCESS" {
+			return nil
+		}
+	}
+	return fmt.Errorf("signal send: %s: %w", resp.Results[0].Type, channels.ErrSendFailed)
+}
+
+// classifyError maps a transport error to the channel error sentinels.
+func classifyError(err error) error {
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		return fmt.Errorf("%w: %v", channels.ErrSendFailed, err)
+	}
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return channels.ClassifySendError(httpErr.Status, err)
+	}
+	return channels.ClassifyNetError(err)
+}
+
+// receiveLoop listens for messages until the channel stops, reconnecting
+// with backoff.
+func (c *SignalChannel) receiveLoop() {
+	defer close(c.done)
+
+	delay := minRetryDelay
+	for {
+		connected := time.Now()
+		err := c.rpc.listen(c.ctx, c.handleNotification)
+		if c.ctx.Err() != nil {
+			return
+		}
+		if time.Since(connected) > maxRetryDelay {
+			delay = minRetryDelay
+		}
+		logger.WarnCF("signal", "Lost connection to signal-cli, retrying", map[string]any{
+			"error": err.Error(),
+			"retry": delay.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// envelope is the subset of a signal-cli "receive" notification the channel
+// reads.
+type envelope struct {
+	Source       string       `json:"source"`
+	SourceNumber string       `json:"sourceNumber"`
+	SourceUUID   string       `json:"sourceUuid"`
+	SourceName   string       `json:"sourceName"`
+	Timestamp    int64        `json:"timestamp"`
+	DataMessage  *dataMessage `json:"dataMessage"`
+}
+
+type dataMessage struct {
+	Timestamp   int64        `json:"timestamp"`
+	Message     string       `json:"message"`
+	Attachments []attachment `json:"attachments"`
+	Mentions    []mention    `json:"mentions"`
+	GroupInfo   *struct {
+		GroupID string `json:"groupId"`
+	} `json:"groupInfo"`
+	Quote *struct {
+		ID           int64  `json:"id"`
+		Author       string `json:"author"`
+		AuthorNumber string `json:"authorNumber"`
+		AuthorUUID   string `json:"authorUuid"`
+		Text         string `json:"text"`
+	} `json:"quote"`
+	Reaction     json.RawMessage `json:"reaction"`
+	RemoteDelete json.RawMessage `json:"remoteDelete"`
+}
+
+type attachment struct {
+	ID          string `json:"id"`
+	ContentType string `json:"contentType"`
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+}
+
+type mention struct {
+	Name   string `json:"name"`
+	Number string `json:"number"`
+	UUID   string `json:"uuid"`
+	Start  int    `json:"start"`
+	Length int    `json:"length"`
+}
+
+func (c *SignalChannel) handleNotification(params json.RawMessage) {
+	var n struct {
+		Envelope envelope `json:"envelope"`
+		Account  string   `json:"account"`
+	}
+	if err := json.Unmarshal(params, &n); err != nil {
+		logger.DebugCF("signal", "Ignoring malformed notification", map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	if n.Account != "" && n.Account != c.config.Account {
+		return
+	}
+	c.handleEnvelope(n.Envelope)
+}
+
+func (c *SignalChannel) handleEnvelope(env envelope) {
+	dm := env.DataMessage
+	// Receipts, typing and sync messages carry no data message; reactions
+	// and deletions are not something to answer.
+	if dm == nil || len(dm.Reaction) > 0 || len(dm.RemoteDelete) > 0 {
+		return
+	}
+	if dm.Message == "" && len(dm.Attachments) == 0 {
+		return
+	}
+
+	senderID := env.SourceNumber
+	if senderID == "" {
+		senderID = env.SourceUUID
+	}
+	if senderID == "" {
+		senderID = env.Source
+	}
+	if senderID == "" || senderID == c.config.Account {
+		return
+	}
+
+	sender := senderInfo(senderID, env.SourceName)
+	if !c.isAllowed(sender, env.SourceUUID) {
+		logger.DebugCF("signal", "Message rejected by allowlist", map[string]any{
+			"sender": senderID,
+		})
+		return
+	}
+
+	timestamp := dm.Timestamp
+	if timestamp == 0 {
+		timestamp = env.Timestamp
+	}
+	messageID := strconv.FormatInt(timestamp, 10)
+
+	chatID := senderID
+	peer := bus.Peer{Kind: "direct", ID: senderID}
+	group := dm.GroupInfo != nil && dm.GroupInfo.GroupID != ""
+	if group {
+		chatID = groupPrefix + dm.GroupInfo.GroupID
+		peer = bus.Peer{Kind: "group", ID: dm.GroupInfo.GroupID}
+	}
+
+	content, mentioned := c.renderMentions(dm.Message, dm.Mentions)
+	if dm.Quote != nil && (dm.Quote.AuthorNumber == c.config.Account || c.isSelf(dm.Quote.AuthorUUID)) {
+		mentioned = true
+	}
+	if group {
+		respond, cleaned := c.ShouldRespondInGroup(mentioned, content)
+		if !respond {
+			return
+		}
+		content = cleaned
+	}
+
+	scope := channels.BuildMediaScope("signal", chatID, messageID)
+	var mediaRefs []string
+	for _, att := range dm.Attachments {
+		label := attachmentLabel(att)
+		if ref := c.downloadAttachment(chatID, att, scope); ref != "" {
+			mediaRefs = append(mediaRefs, ref)
+		}
+		content = appendLine(content, label)
+	}
+
+	metadata := map[string]string{
+		"timestamp": messageID,
+		"platform":  "signal",
+	}
+	if group {
+		metadata["group_id"] = dm.GroupInfo.GroupID
+	}
+	if dm.Quote != nil {
+		metadata["reply_to"] = strconv.FormatInt(dm.Quote.ID, 10)
+		if dm.Quote.Text != "" {
+			content = fmt.Sprintf("[quote: %s]\n%s", utils.Truncate(dm.Quote.Text, 200), content)
+		}
+	}
+
+	if strings.TrimSpace(content) == "" && len(mediaRefs) == 0 {
+		return
+	}
+
+	ref := inboundRef{author: senderID, timestamp: timestamp, text: utils.Truncate(dm.Message, 200)}
+	c.recent.add(chatID, messageID, ref)
+	if group {
+		c.quotes.Store(chatID, ref)
+	}
+
+	logger.DebugCF("signal", "Received message", map[string]any{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(c.ctx, peer, messageID, senderID, chatID, content, mediaRefs, metadata, sender)
+}
+
+func senderInfo(id, name string) bus.SenderInfo {
+	return bus.SenderInfo{
+		Platform:    "signal",
+		PlatformID:  id,
+		CanonicalID: identity.BuildCanonicalID("signal", id),
+		DisplayName: name,
+	}
+}
+
+// isAllowed checks the sender by number and, for allow_from entries written
+// as UUIDs, by UUID.
+func (c *SignalChannel) isAllowed(sender bus.SenderInfo, uuid string) bool {
+	if c.IsAllowedSender(sender) {
+		return true
+	}
+	return uuid != "" && uuid != sender.PlatformID && c.IsAllowedSender(senderInfo(uuid, sender.DisplayName))
+}
+
+// renderMentions replaces the placeholder characters Signal puts in the text
+// for mentions with readable names, dropping mentions of the bot itself, and
+// reports whether the bot was mentioned. Mention offsets count UTF-16 units.
+func (c *SignalChannel) renderMentions(text string, mentions []mention) (string, bool) {
+	if len(mentions) == 0 {
+		return text, false
+	}
+	units := utf16.Encode([]rune(text))
+	sorted := append([]mention(nil), mentions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start > sorted[j].Start })
+
+	mentioned := false
+	for _, m := range sorted {
+		if m.Start < 0 || m.Length < 0 || m.Start+m.Length > len(units) {
+			continue
+		}
+		var replacement []uint16
+		if m.Number == c.config.Account || c.isSelf(m.UUID) {
+			mentioned = true
+		} else {
+			name := m.Name
+			if name == "" {
+				name = m.Number
+			}
+			if name == "" {
+				name = m.UUID
+			}
+			replacement = utf16.Encode([]rune("@" + name))
+		}
+		units = append(units[:m.Start], append(replacement, units[m.Start+m.Length:]...)...)
+	}
+	text = strings.Join(strings.Fields(string(utf16.Decode(units))), " ")
+	return text, mentioned
+}
+
+// isSelf reports whether uuid is the bot account. The UUID is looked up
+// once from the daemon.
+func (c *SignalChannel) isSelf(uuid string) bool {
+	if uuid == "" {
+		return false
+	}
+	if c.selfUUID == "" {
+		result, err := c.rpc.call(c.ctx, "getUserStatus", map[string]any{
+			"account":   c.config.Account,
+			"recipient": []string{c.config.Account},
+		})
+		if err != nil {
+			logger.DebugCF("signal", "Failed to look up own UUID", map[string]any{
+				"error": err.Error(),
+			})
+			return false
+		}
+		var statuses []struct {
+			UUID string `json:"uuid"`
+		}
+		if json.Unmarshal(result, &statuses) == nil && len(statuses) > 0 {
+			c.selfUUID = statuses[0].UUID
+		}
+	}
+	return strings.EqualFold(uuid, c.selfUUID)
+}
+
+// downloadAttachment fetches an attachment from the daemon into the media
+// store and returns its ref, or "" on failure.
+func (c *SignalChannel) downloadAttachment(chatID string, att attachment, scope string) string {
+	store := c.GetMediaStore()
+	if store == nil || att.ID == "" {
+		return ""
+	}
+	if att.Size > maxDownloadSize {
+		logger.InfoCF("signal", "Skipping large attachment", map[string]any{
+			"id":   att.ID,
+			"size": att.Size,
+		})
+		return ""
+	}
+
+	params := c.target(chatID)
+	params["id"] = att.ID
+	ctx, cancel := context.WithTimeout(c.ctx, 2*time.Minute)
+	defer cancel()
+	result, err := c.rpc.call(ctx, "getAttachment", params)
+	if err != nil {
+		logger.WarnCF("signal", "Failed to download attachment", map[string]any{
+			"id":    att.ID,
+			"error": err.Error(),
+		})
+		return ""
+	}
+	var payload struct {
+		Data string `json:"data"`
+	}
+	if err := json.Unmarshal(result, &payload); err != nil {
+		return ""
+	}
+	data, err := base64.StdEncoding.DecodeString(payload.Data)
+	if err != nil {
+		return ""
+	}
+
+	filename := att.Filename
+	if filename == "" {
+		filename = att.ID
+		if exts, _ := mime.ExtensionsByType(att.ContentType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		return ""
+	}
+	localPath := filepath.Join(mediaDir, "signal-"+utils.SanitizeFilename(att.ID)+"-"+utils.SanitizeFilename(filename))
+	if err := os.WriteFile(localPath, data, 0o600); err != nil {
+		return ""
+	}
+
+	ref, err := store.Store(localPath, media.MediaMeta{
+		Filename:    filename,
+		ContentType: att.ContentType,
+		Source:      "signal",
+	}, scope)
+	if err != nil {
+		os.Remove(localPath)
+		return ""
+	}
+	return ref
+}
+
+func attachmentLabel(att attachment) string {
+	kind := "file"
+	switch {
+	case strings.HasPrefix(att.ContentType, "image/"):
+		kind = "image"
+	case strings.HasPrefix(att.ContentType, "audio/"):
+		kind = "audio"
+	case strings.HasPrefix(att.ContentType, "video/"):
+		kind = "video"
+	}
+	name := att.Filename
+	if name == "" {
+		name = att.ContentType
+	}
+	return fmt.Sprintf("[%s: %s]", kind, name)
+}
+
+func appendLine(content, line string) string {
+	if content == "" {
+		return line
+	}
+	return content + "\n" + line
+}
+
+// inboundRef identifies a received message: Signal addresses messages by
+// author and timestamp.
+type inboundRef struct {
+	author    string
+	timestamp int64
+	text      string
+}
+
+// recentMessages remembers the authors of recent inbound messages so
+// reactions can target them by chat and message ID.
+type recentMessages struct {
+	mu    sync.Mutex
+	limit int
+	refs  map[string]inboundRef
+	order []string
+}
+
+func newRecentMessages(limit int) *recentMessages {
+	return &recentMessages{limit: limit, refs: make(map[string]inboundRef)}
+}
+
+func (r *recentMessages) add(chatID, messageID string, ref inboundRef) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := chatID + "/" + messageID
+	if _, ok := r.refs[key]; !ok {
+		r.order = append(r.order, key)
+	}
+	r.refs[key] = ref
+	for len(r.order) > r.limit {
+		delete(r.refs, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *recentMessages) get(chatID, messageID string) (inboundRef, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ref, ok := r.refs[chatID+"/"+messageID]
+	return ref, ok
+}
@@ -0,0 +1,352 @@
+package signal
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/bus/bustest"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/media"
+)
+
+const (
+	botNumber = "+15550000000"
+	botUUID   = "bot-uuid"
+)
+
+type rpcCall struct {
+	method string
+	params map[string]any
+}
+
+// fakeDaemon answers JSON-RPC calls the way signal-cli does and records them.
+type fakeDaemon struct {
+	mu    sync.Mutex
+	calls []rpcCall
+}
+
+func (d *fakeDaemon) handle(method string, params map[string]any) any {
+	d.mu.Lock()
+	d.calls = append(d.calls, rpcCall{method: method, params: params})
+	d.mu.Unlock()
+
+	switch method {
+	case "send":
+		return map[string]any{"timestamp": 42, "results": []any{map[string]any{"type": "SUCCESS"}}}
+	case "getAttachment":
+		return map[string]any{"data": base64.StdEncoding.EncodeToString([]byte("jpeg-bytes"))}
+	case "getUserStatus":
+		return []any{map[string]any{"number": botNumber, "uuid": botUUID}}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (d *fakeDaemon) callsTo(method string) []rpcCall {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []rpcCall
+	for _, c := range d.calls {
+		if c.method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// newHTTPDaemon serves the daemon's HTTP interface; notifications written to
+// the returned channel are streamed as server-sent events.
+func newHTTPDaemon(t *testing.T) (*fakeDaemon, *httptest.Server, chan<- any) {
+	d := &fakeDaemon{}
+	events := make(chan any, 10)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/rpc", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string         `json:"method"`
+			Params map[string]any `json:"params"`
+			ID     string         `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "result": d.handle(req.Method, req.Params), "id": req.ID})
+	})
+	mux.HandleFunc("GET /api/v1/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case ev := <-events:
+				data, _ := json.Marshal(ev)
+				fmt.Fprintf(w, ":\n\nevent:receive\ndata:%s\n\n", data)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return d, srv, events
+}
+
+func newTestChannel(t *testing.T, endpoint string) (*SignalChannel, *bus.MessageBus) {
+	t.Helper()
+	mb := bus.NewMessageBus()
+	ch, err := NewSignalChannel(config.SignalConfig{
+		Account:      botNumber,
+		Endpoint:     endpoint,
+		AllowFrom:    config.FlexibleStringSlice{"+15551111111", "carol-uuid"},
+		GroupTrigger: config.GroupTriggerConfig{MentionOnly: true},
+	}, mb)
+	if err != nil {
+		t.Fatalf("NewSignalChannel() error = %v", err)
+	}
+	ch.SetMediaStore(media.NewFileMediaStore())
+	return ch, mb
+}
+
+func notification(env map[string]any) map[string]any {
+	return map[string]any{"envelope": env, "account": botNumber}
+}
+
+func TestSignalChannel_HTTPDaemon(t *testing.T) {
+	d, srv, events := newHTTPDaemon(t)
+	ch, mb := newTestChannel(t, srv.URL)
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer ch.Stop(context.Background())
+
+	// Stranger, receipt and an allowed DM with an attachment.
+	events <- notification(map[string]any{
+		"sourceNumber": "+15559999999", "timestamp": 1,
+		"dataMessage": map[string]any{"timestamp": 1, "message": "hi"},
+	})
+	events <- notification(map[string]any{
+		"sourceNumber": "+15551111111", "timestamp": 2,
+		"receiptMessage": map[string]any{"isRead": true},
+	})
+	events <- notification(map[string]any{
+		"sourceNumber": "+15551111111", "sourceUuid": "alice-uuid", "sourceName": "Alice", "timestamp": 3,
+		"dataMessage": map[string]any{
+			"timestamp": 3, "message": "what is this?",
+			"attachments": []any{map[string]any{"id": "att1", "contentType": "image/jpeg", "filename": "pic.jpg", "size": 10}},
+		},
+	})
+
+	msg := bustest.Consume(t, mb)
+	if msg.ChatID != "+15551111111" || msg.Peer.Kind != "direct" || msg.MessageID != "3" {
+		t.Errorf("DM = %+v", msg)
+	}
+	if msg.Content != "what is this?\n[image: pic.jpg]" || len(msg.Media) != 1 {
+		t.Fatalf("DM content = %q, media = %v", msg.Content, msg.Media)
+	}
+	path, err := ch.GetMediaStore().Resolve(msg.Media[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "jpeg-bytes" {
+		t.Errorf("attachment = %q", data)
+	}
+	if msg.Sender.DisplayName != "Alice" || msg.SenderID != "signal:+15551111111" {
+		t.Errorf("sender = %+v, id %q", msg.Sender, msg.SenderID)
+	}
+
+	// A group message without a mention is ignored; a mention of the bot by
+	// UUID (the usual case) is answered, from a sender allowed by UUID.
+	events <- notification(map[string]any{
+		"sourceNumber": "+15551111111", "timestamp": 4,
+		"dataMessage": map[string]any{"timestamp": 4, "message": "just chatting", "groupInfo": map[string]any{"groupId": "Z3JvdXA="}},
+	})
+	events <- notification(map[string]any{
+		"sourceUuid": "carol-uuid", "timestamp": 5,
+		"dataMessage": map[string]any{
+			"timestamp": 5, "message": "￼ ask ￼ about it",
+			"groupInfo": map[string]any{"groupId": "Z3JvdXA="},
+			"mentions": []any{
+				map[string]any{"uuid": botUUID, "start": 0, "length": 1},
+				map[string]any{"name": "Dave", "uuid": "dave-uuid", "start": 6, "length": 1},
+			},
+			"quote": map[string]any{"id": 2, "authorNumber": "+15551111111", "text": "earlier"},
+		},
+	})
+
+	msg = bustest.Consume(t, mb)
+	if msg.ChatID != "group:Z3JvdXA=" || msg.Peer.Kind != "group" || msg.SenderID != "signal:carol-uuid" {
+		t.Errorf("group message = %+v", msg)
+	}
+	if msg.Content != "[quote: earlier]\nask @Dave about it" || msg.Metadata["reply_to"] != "2" {
+		t.Errorf("group content = %q, metadata = %v", msg.Content, msg.Metadata)
+	}
+
+	ctx := context.Background()
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "group:Z3JvdXA=", Content: "sure"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "group:Z3JvdXA=", Content: "more"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	sends := d.callsTo("send")
+	if len(sends) != 2 {
+		t.Fatalf("sends = %v", sends)
+	}
+	first, second := sends[0].params, sends[1].params
+	if first["groupId"] != "Z3JvdXA=" || first["message"] != "sure" || first["account"] != botNumber {
+		t.Errorf("send params = %v", first)
+	}
+	if first["quoteAuthor"] != "carol-uuid" || first["quoteTimestamp"] != float64(5) {
+		t.Errorf("first reply should quote the question, got %v", first)
+	}
+	if _, quoted := second["quoteTimestamp"]; quoted {
+		t.Errorf("only the first reply should quote, got %v", second)
+	}
+
+	undo, err := ch.ReactToMessage(ctx, "+15551111111", "3")
+	if err != nil {
+		t.Fatalf("ReactToMessage() error = %v", err)
+	}
+	undo()
+	undo()
+	reactions := d.callsTo("sendReaction")
+	if len(reactions) != 2 || reactions[0].params["targetAuthor"] != "+15551111111" ||
+		reactions[0].params["targetTimestamp"] != float64(3) || reactions[1].params["remove"] != true {
+		t.Errorf("reactions = %v", reactions)
+	}
+
+	stop, err := ch.StartTyping(ctx, "+15551111111")
+	if err != nil {
+		t.Fatalf("StartTyping() error = %v", err)
+	}
+	stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(d.callsTo("sendTyping")) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("typing calls = %v", d.callsTo("sendTyping"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	typing := d.callsTo("sendTyping")
+	if typing[1].params["stop"] != true {
+		t.Errorf("typing should be stopped, got %v", typing)
+	}
+
+	out := filepath.Join(t.TempDir(), "chart; final.png")
+	os.WriteFile(out, []byte("png"), 0o600)
+	ref, _ := ch.GetMediaStore().Store(out, media.MediaMeta{Filename: "chart; final.png"}, "test")
+	err = ch.SendMedia(ctx, bus.OutboundMediaMessage{
+		ChatID: "+15551111111",
+		Parts:  []bus.MediaPart{{Type: "image", Ref: ref, Caption: "here"}},
+	})
+	if err != nil {
+		t.Fatalf("SendMedia() error = %v", err)
+	}
+	sends = d.callsTo("send")
+	mediaParams := sends[len(sends)-1].params
+	attachments, _ := mediaParams["attachments"].([]any)
+	want := "data:image/png;filename=chart_ final.png;base64," + base64.StdEncoding.EncodeToString([]byte("png"))
+	if len(attachments) != 1 || attachments[0] != want || mediaParams["message"] != "here" {
+		t.Errorf("media params = %v", mediaParams)
+	}
+}
+
+func TestSignalChannel_Socket(t *testing.T) {
+	d := &fakeDaemon{}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var mu sync.Mutex
+		write := func(v any) {
+			data, _ := json.Marshal(v)
+			mu.Lock()
+			conn.Write(append(data, '\n'))
+			mu.Unlock()
+		}
+		// The attachment download happens while handling this notification,
+		// over the same connection.
+		write(map[string]any{"jsonrpc": "2.0", "method": "receive", "params": notification(map[string]any{
+			"sourceNumber": "+15551111111", "timestamp": 7,
+			"dataMessage": map[string]any{
+				"timestamp":   7,
+				"attachments": []any{map[string]any{"id": "att2", "contentType": "image/jpeg", "size": 10}},
+			},
+		})})
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var req struct {
+				Method string         `json:"method"`
+				Params map[string]any `json:"params"`
+				ID     string         `json:"id"`
+			}
+			json.Unmarshal(scanner.Bytes(), &req)
+			if req.Method == "send" && req.Params["message"] == "fail" {
+				write(map[string]any{"jsonrpc": "2.0", "error": map[string]any{"code": -1, "message": "Invalid recipient"}, "id": req.ID})
+				continue
+			}
+			write(map[string]any{"jsonrpc": "2.0", "result": d.handle(req.Method, req.Params), "id": req.ID})
+		}
+	}()
+
+	ch, mb := newTestChannel(t, "tcp://"+ln.Addr().String())
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer ch.Stop(context.Background())
+
+	msg := bustest.Consume(t, mb)
+	if msg.Content != "[image: image/jpeg]" || len(msg.Media) != 1 {
+		t.Fatalf("inbound = %+v", msg)
+	}
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "+15551111111", Content: "ok"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	err = ch.Send(context.Background(), bus.OutboundMessage{ChatID: "+15551111111", Content: "fail"})
+	if !errors.Is(err, channels.ErrSendFailed) {
+		t.Errorf("Send() error = %v, want ErrSendFailed", err)
+	}
+}
+
+func TestSignalChannel_SendNotConnected(t *testing.T) {
+	ch, _ := newTestChannel(t, "unix://"+filepath.Join(t.TempDir(), "missing.sock"))
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "+1", Content: "x"}); !errors.Is(err, channels.ErrNotRunning) {
+		t.Errorf("Send() before Start error = %v, want ErrNotRunning", err)
+	}
+	ch.SetRunning(true)
+	err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "+1", Content: "x"})
+	if !errors.Is(err, channels.ErrTemporary) {
+		t.Errorf("Send() without daemon error = %v, want ErrTemporary", err)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	for _, endpoint := range []string{"http://127.0.0.1:8080", "unix:///run/signal.sock", "tcp://127.0.0.1:7583"} {
+		if _, err := newTransport(endpoint); err != nil {
+			t.Errorf("newTransport(%q) error = %v", endpoint, err)
+		}
+	}
+	if _, err := newTransport("ftp://example.org"); err == nil || !strings.Contains(err.Error(), "use http://") {
+		t.Errorf("newTransport(ftp) error = %v", err)
+	}
+}
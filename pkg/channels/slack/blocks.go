@@ -0,0 +1,141 @@
+package slack
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
+)
+
+// Block Kit limits.
+const (
+	maxBlocks         = 50
+	maxSectionText    = 3000
+	maxHeaderText     = 150
+	maxActionElements = 25
+	maxButtonText     = 75
+	maxButtonValue    = 2000
+)
+
+// actionIDPrefix marks buttons created by this channel. The rest of the
+// action ID is "<row>_<col>", keeping IDs unique within a message.
+const actionIDPrefix = "pc_"
+
+var (
+	mdFence   = regexp.MustCompile("^\\s*(```+|~~~+)")
+	mdHeading = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*$`)
+	mdRule    = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+)
+
+// messageOptions renders content and buttons as Block Kit, with the mrkdwn
+// text as the notification fallback. Content that does not fit Slack's
+// block limits is sent as mrkdwn text only.
+func messageOptions(content string, buttons [][]bus.Button) []slack.MsgOption {
+	text := format.Render(content, format.SlackMrkdwn)
+	blocks := renderBlocks(content)
+	actions := actionBlocks(buttons)
+	if len(blocks)+len(actions) > maxBlocks {
+		blocks = nil
+		if len(actions) > 0 {
+			blocks = []slack.Block{section(truncate(text, maxSectionText))}
+		}
+	}
+	opts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if len(blocks)+len(actions) > 0 {
+		opts = append(opts, slack.MsgOptionBlocks(append(blocks, actions...)...))
+	}
+	return opts
+}
+
+// renderBlocks converts Markdown to header, divider and section blocks.
+// The text between headings and rules becomes mrkdwn sections, split so
+// that no formatting, code block or table is cut in half.
+func renderBlocks(md string) []slack.Block {
+	var blocks []slack.Block
+	var para []string
+
+	flush := func() {
+		for _, chunk := range format.Split(strings.Join(para, "\n"), format.SlackMrkdwn, maxSectionText) {
+			blocks = append(blocks, section(chunk))
+		}
+		para = nil
+	}
+
+	fence := ""
+	for _, line := range strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			para = append(para, line)
+
+		case mdFence.MatchString(line):
+			fence = mdFence.FindStringSubmatch(line)[1]
+			para = append(para, line)
+
+		case mdHeading.MatchString(trimmed):
+			flush()
+			heading := format.Render(mdHeading.FindStringSubmatch(trimmed)[1], format.Plain)
+			blocks = append(blocks, slack.NewHeaderBlock(
+				slack.NewTextBlockObject(slack.PlainTextType, truncate(heading, maxHeaderText), false, false)))
+
+		case mdRule.MatchString(line):
+			flush()
+			blocks = append(blocks, slack.NewDividerBlock())
+
+		default:
+			para = append(para, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func section(text string) slack.Block {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+// actionBlocks renders button rows as actions blocks.
+func actionBlocks(buttons [][]bus.Button) []slack.Block {
+	var blocks []slack.Block
+	for i, row := range buttons {
+		if len(row) == 0 {
+			continue
+		}
+		var elements []slack.BlockElement
+		for j, b := range row[:min(len(row), maxActionElements)] {
+			elements = append(elements, slack.NewButtonBlockElement(
+				fmt.Sprintf("%s%d_%d", actionIDPrefix, i, j),
+				truncate(b.Value(), maxButtonValue),
+				slack.NewTextBlockObject(slack.PlainTextType, truncate(b.Text, maxButtonText), false, false),
+			))
+		}
+		blocks = append(blocks, slack.NewActionBlock("", elements...))
+	}
+	return blocks
+}
+
+// withoutActions drops the actions blocks from a message's blocks.
+func withoutActions(blocks []slack.Block) []slack.Block {
+	out := make([]slack.Block, 0, len(blocks))
+	for _, b := range blocks {
+		if b.BlockType() != slack.MBTAction {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,80 @@
+package slack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestRenderBlocks(t *testing.T) {
+	md := "# **Report**\n\nSome **text**.\n\n```go\n# not a heading\nfmt.Println(\"<hi>\")\n```\n\n---\n\n| Name | Qty |\n|------|----:|\n| apple | 3 |\n| kiwi | 12 |\n"
+	blocks := renderBlocks(md)
+
+	var types []slack.MessageBlockType
+	for _, b := range blocks {
+		types = append(types, b.BlockType())
+	}
+	want := []slack.MessageBlockType{slack.MBTHeader, slack.MBTSection, slack.MBTDivider, slack.MBTSection}
+	if len(types) != len(want) {
+		t.Fatalf("block types = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("block types = %v, want %v", types, want)
+		}
+	}
+
+	if got := blocks[0].(*slack.HeaderBlock).Text.Text; got != "Report" {
+		t.Errorf("header = %q", got)
+	}
+	wantBody := "Some *text*.\n\n```\n# not a heading\nfmt.Println(\"&lt;hi&gt;\")\n```"
+	if got := blocks[1].(*slack.SectionBlock).Text.Text; got != wantBody {
+		t.Errorf("section = %q, want %q", got, wantBody)
+	}
+	table := blocks[3].(*slack.SectionBlock).Text.Text
+	wantTable := "```\nName  | Qty\n------+----\napple | 3\nkiwi  | 12\n```"
+	if table != wantTable {
+		t.Errorf("table = %q, want %q", table, wantTable)
+	}
+}
+
+func TestRenderBlocksSplitsLongSections(t *testing.T) {
+	line := strings.Repeat("x", 100)
+	md := strings.TrimSpace(strings.Repeat(line+"\n", 70))
+	blocks := renderBlocks(md)
+	if len(blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(blocks))
+	}
+	for _, b := range blocks {
+		if n := len(b.(*slack.SectionBlock).Text.Text); n > maxSectionText {
+			t.Errorf("section has %d chars", n)
+		}
+	}
+}
+
+func TestActionBlocks(t *testing.T) {
+	blocks := actionBlocks([][]bus.Button{
+		{{Text: "Approve", Data: "approve"}, {Text: "Deny"}},
+		{},
+	})
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(blocks))
+	}
+	elements := blocks[0].(*slack.ActionBlock).Elements.ElementSet
+	approve := elements[0].(*slack.ButtonBlockElement)
+	deny := elements[1].(*slack.ButtonBlockElement)
+	if approve.Value != "approve" || deny.Value != "Deny" || approve.ActionID == deny.ActionID {
+		t.Fatalf("unexpected buttons: %+v %+v", approve, deny)
+	}
+	if !strings.HasPrefix(approve.ActionID, actionIDPrefix) {
+		t.Fatalf("action ID %q lacks prefix", approve.ActionID)
+	}
+
+	kept := withoutActions([]slack.Block{section("hi"), blocks[0]})
+	if len(kept) != 1 || kept[0].BlockType() != slack.MBTSection {
+		t.Fatalf("withoutActions kept %v", kept)
+	}
+}
@@ -3,6 +3,7 @@ package slack
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 	"sync"
 
@@ -12,6 +13,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/identity"
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -50,6 +52,7 @@ func NewSlackChannel(cfg config.SlackConfig, messageBus *bus.MessageBus) (*Slack
 
 	base := channels.NewBaseChannel("slack", cfg, messageBus, cfg.AllowFrom,
 		channels.WithMaxMessageLength(40000),
+		channels.WithTextFormat(format.Markdown),
 		channels.WithGroupTrigger(cfg.GroupTrigger),
 		channels.WithReasoningChannelID(cfg.ReasoningChannelID),
 	)
@@ -118,9 +121,7 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
 	}
 
-	opts := []slack.MsgOption{
-		slack.MsgOptionText(msg.Content, false),
-	}
+	opts := messageOptions(msg.Content, msg.Buttons)
 
 	if threadTS != "" {
 		opts = append(opts, slack.MsgOptionTS(threadTS))
@@ -131,13 +132,7 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		return fmt.Errorf("slack send: %w", channels.ErrTemporary)
 	}
 
-	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
-		msgRef := ref.(slackMessageRef)
-		c.api.AddReaction("white_check_mark", slack.ItemRef{
-			Channel:   msgRef.ChannelID,
-			Timestamp: msgRef.Timestamp,
-		})
-	}
+	c.ackMessage(msg.ChatID)
 
 	logger.DebugCF("slack", "Message sent", map[string]any{
 		"channel_id": channelID,
@@ -153,7 +148,7 @@ func (c *SlackChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMessa
 		return channels.ErrNotRunning
 	}
 
-	channelID, _ := parseSlackChatID(msg.ChatID)
+	channelID, threadTS := parseSlackChatID(msg.ChatID)
 	if channelID == "" {
 		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
 	}
@@ -178,16 +173,23 @@ func (c *SlackChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMessa
 			filename = "file"
 		}
 
-		title := part.Caption
-		if title == "" {
-			title = filename
+		info, err := os.Stat(localPath)
+		if err != nil {
+			logger.ErrorCF("slack", "Failed to stat media file", map[string]any{
+				"path":  localPath,
+				"error": err.Error(),
+			})
+			continue
 		}
 
 		_, err = c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
-			Channel:  channelID,
-			File:     localPath,
-			Filename: filename,
-			Title:    title,
+			Channel:         channelID,
+			ThreadTimestamp: threadTS,
+			File:            localPath,
+			FileSize:        int(info.Size()),
+			Filename:        filename,
+			Title:           filename,
+			InitialComment:  format.Render(part.Caption, format.SlackMrkdwn),
 		})
 		if err != nil {
 			logger.ErrorCF("slack", "Failed to upload media", map[string]any{
@@ -201,6 +203,70 @@ func (c *SlackChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMessa
 	return nil
 }
 
+// SendPlaceholder implements channels.PlaceholderCapable.
+// It posts a placeholder that is later edited to the actual response via
+// EditMessage (channels.MessageEditor).
+func (c *SlackChannel) SendPlaceholder(ctx context.Context, chatID string) (string, error) {
+	if !c.config.Placeholder.Enabled {
+		return "", nil
+	}
+
+	channelID, threadTS := parseSlackChatID(chatID)
+	if channelID == "" {
+		return "", fmt.Errorf("invalid slack chat ID: %s", chatID)
+	}
+
+	text := c.config.Placeholder.Text
+	if text == "" {
+		text = "Thinking... 💭"
+	}
+
+	opts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+	_, ts, err := c.api.PostMessageContext(ctx, channelID, opts...)
+	if err != nil {
+		return "", err
+	}
+	return ts, nil
+}
+
+// EditMessage implements channels.MessageEditor.
+func (c *SlackChannel) EditMessage(ctx context.Context, chatID, messageID, content string) error {
+	return c.EditMessageButtons(ctx, chatID, messageID, content, nil)
+}
+
+// EditMessageButtons implements channels.ButtonCapable.
+func (c *SlackChannel) EditMessageButtons(
+	ctx context.Context,
+	chatID, messageID, content string,
+	buttons [][]bus.Button,
+) error {
+	channelID, _ := parseSlackChatID(chatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", chatID)
+	}
+
+	if _, _, _, err := c.api.UpdateMessageContext(ctx, channelID, messageID, messageOptions(content, buttons)...); err != nil {
+		return err
+	}
+
+	c.ackMessage(chatID)
+	return nil
+}
+
+// ackMessage marks the inbound message that started this turn as answered.
+func (c *SlackChannel) ackMessage(chatID string) {
+	if ref, ok := c.pendingAcks.LoadAndDelete(chatID); ok {
+		msgRef := ref.(slackMessageRef)
+		c.api.AddReaction("white_check_mark", slack.ItemRef{
+			Channel:   msgRef.ChannelID,
+			Timestamp: msgRef.Timestamp,
+		})
+	}
+}
+
 // ReactToMessage implements channels.ReactionCapable.
 // It adds an "eyes" (👀) reaction to the inbound message and returns an undo function
 // that removes the reaction.
@@ -238,9 +304,7 @@ func (c *SlackChannel) eventLoop() {
 			case socketmode.EventTypeSlashCommand:
 				c.handleSlashCommand(event)
 			case socketmode.EventTypeInteractive:
-				if event.Request != nil {
-					c.socketClient.Ack(*event.Request)
-				}
+				c.handleInteractive(event)
 			}
 		}
 	}
@@ -498,6 +562,87 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 	)
 }
 
+// handleInteractive passes a button click on one of the bot's messages to the
+// agent as a reply to that message, and removes the buttons.
+func (c *SlackChannel) handleInteractive(event socketmode.Event) {
+	if event.Request != nil {
+		c.socketClient.Ack(*event.Request)
+	}
+
+	callback, ok := event.Data.(slack.InteractionCallback)
+	if !ok || callback.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+	var action *slack.BlockAction
+	for _, a := range callback.ActionCallback.BlockActions {
+		if strings.HasPrefix(a.ActionID, actionIDPrefix) {
+			action = a
+			break
+		}
+	}
+	if action == nil || action.Value == "" {
+		return
+	}
+
+	senderID := callback.User.ID
+	sender := bus.SenderInfo{
+		Platform:    "slack",
+		PlatformID:  senderID,
+		CanonicalID: identity.BuildCanonicalID("slack", senderID),
+		Username:    callback.User.Name,
+	}
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("slack", "Interaction rejected by allowlist", map[string]any{
+			"user_id": senderID,
+		})
+		return
+	}
+
+	channelID := callback.Container.ChannelID
+	if channelID == "" {
+		channelID = callback.Channel.ID
+	}
+	messageTS := callback.Container.MessageTs
+	threadTS := callback.Container.ThreadTs
+	if threadTS == "" {
+		threadTS = callback.Message.ThreadTimestamp
+	}
+
+	chatID := channelID
+	if threadTS != "" {
+		chatID = channelID + "/" + threadTS
+	}
+
+	if messageTS != "" {
+		_, _, _, err := c.api.UpdateMessageContext(c.ctx, channelID, messageTS,
+			slack.MsgOptionText(callback.Message.Text, false),
+			slack.MsgOptionBlocks(withoutActions(callback.Message.Blocks.BlockSet)...),
+		)
+		if err != nil {
+			logger.DebugCF("slack", "Failed to remove buttons", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	peer := bus.Peer{Kind: "channel", ID: channelID}
+	if strings.HasPrefix(channelID, "D") {
+		peer = bus.Peer{Kind: "direct", ID: senderID}
+	}
+
+	metadata := map[string]string{
+		"message_ts":  callback.ActionTs,
+		"channel_id":  channelID,
+		"thread_ts":   threadTS,
+		"platform":    "slack",
+		"team_id":     c.teamID,
+		"reply_to":    messageTS,
+		"interaction": "block_actions",
+	}
+
+	c.HandleMessage(c.ctx, peer, callback.ActionTs, senderID, chatID, action.Value, nil, metadata, sender)
+}
+
 func (c *SlackChannel) downloadSlackFile(file slack.File) string {
 	downloadURL := file.URLPrivateDownload
 	if downloadURL == "" {
@@ -1,10 +1,28 @@
 package slack
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/bus/bustest"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/media"
 )
 
 func TestParseSlackChatID(t *testing.T) {
@@ -172,3 +190,272 @@ func TestSlackChannelIsAllowed(t *testing.T) {
 		}
 	})
 }
+
+// fakeSlack is a stand-in for the Slack Web API methods the channel calls.
+// Every method call is recorded with its form values.
+type fakeSlack struct {
+	t   *testing.T
+	url string
+
+	mu      sync.Mutex
+	calls   []apiCall
+	uploads [][]byte
+}
+
+type apiCall struct {
+	method string
+	values url.Values
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	fs := &fakeSlack{t: t}
+	srv := httptest.NewServer(fs)
+	t.Cleanup(srv.Close)
+	fs.url = srv.URL
+	return fs
+}
+
+func (fs *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/upload" {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		fs.mu.Lock()
+		fs.uploads = append(fs.uploads, data)
+		fs.mu.Unlock()
+		return
+	}
+
+	r.ParseForm()
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	fs.mu.Lock()
+	fs.calls = append(fs.calls, apiCall{method: method, values: r.PostForm})
+	n := len(fs.calls)
+	fs.mu.Unlock()
+
+	resp := map[string]any{"ok": true}
+	switch method {
+	case "chat.postMessage":
+		resp["channel"] = r.PostForm.Get("channel")
+		resp["ts"] = fmt.Sprintf("1700000000.%06d", n)
+	case "chat.update":
+		resp["channel"] = r.PostForm.Get("channel")
+		resp["ts"] = r.PostForm.Get("ts")
+		resp["text"] = r.PostForm.Get("text")
+	case "files.getUploadURLExternal":
+		resp["upload_url"] = fs.url + "/upload"
+		resp["file_id"] = "F123"
+	case "files.completeUploadExternal":
+		resp["files"] = []map[string]string{{"id": "F123", "title": "report.txt"}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// called returns the recorded calls of one API method.
+func (fs *fakeSlack) called(method string) []url.Values {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var out []url.Values
+	for _, c := range fs.calls {
+		if c.method == method {
+			out = append(out, c.values)
+		}
+	}
+	return out
+}
+
+// newTestChannel returns a running channel whose Web API client talks to fs.
+// Socket Mode is not connected; events are fed to the handlers directly.
+func newTestChannel(t *testing.T, fs *fakeSlack, cfg config.SlackConfig) (*SlackChannel, *bus.MessageBus) {
+	t.Helper()
+	cfg.BotToken = "xoxb-test"
+	cfg.AppToken = "xapp-test"
+	mb := bus.NewMessageBus()
+	ch, err := NewSlackChannel(cfg, mb)
+	if err != nil {
+		t.Fatalf("NewSlackChannel() error = %v", err)
+	}
+	ch.api = slack.New(cfg.BotToken, slack.OptionAPIURL(fs.url+"/"))
+	ch.ctx, ch.cancel = context.WithCancel(context.Background())
+	t.Cleanup(ch.cancel)
+	ch.SetMediaStore(media.NewFileMediaStore())
+	ch.SetRunning(true)
+	return ch, mb
+}
+
+func TestSlackChannel_PlaceholderEdit(t *testing.T) {
+	fs := newFakeSlack(t)
+	ch, _ := newTestChannel(t, fs, config.SlackConfig{
+		Placeholder: config.PlaceholderConfig{Enabled: true, Text: "Working..."},
+	})
+	ctx := context.Background()
+	chatID := "C1/1699999999.000100"
+	ch.pendingAcks.Store(chatID, slackMessageRef{ChannelID: "C1", Timestamp: "1699999999.000200"})
+
+	ts, err := ch.SendPlaceholder(ctx, chatID)
+	if err != nil {
+		t.Fatalf("SendPlaceholder() error = %v", err)
+	}
+	posts := fs.called("chat.postMessage")
+	if len(posts) != 1 {
+		t.Fatalf("chat.postMessage calls = %d, want 1", len(posts))
+	}
+	if posts[0].Get("channel") != "C1" || posts[0].Get("thread_ts") != "1699999999.000100" ||
+		posts[0].Get("text") != "Working..." {
+		t.Errorf("placeholder post = %v", posts[0])
+	}
+	if ts == "" {
+		t.Fatal("SendPlaceholder() returned no message ts")
+	}
+
+	if err := ch.EditMessage(ctx, chatID, ts, "**Done**"); err != nil {
+		t.Fatalf("EditMessage() error = %v", err)
+	}
+	updates := fs.called("chat.update")
+	if len(updates) != 1 {
+		t.Fatalf("chat.update calls = %d, want 1", len(updates))
+	}
+	if updates[0].Get("channel") != "C1" || updates[0].Get("ts") != ts || updates[0].Get("text") != "*Done*" {
+		t.Errorf("edit = %v", updates[0])
+	}
+	if len(fs.called("chat.postMessage")) != 1 {
+		t.Error("edit posted a new message")
+	}
+
+	reactions := fs.called("reactions.add")
+	if len(reactions) != 1 || reactions[0].Get("name") != "white_check_mark" ||
+		reactions[0].Get("timestamp") != "1699999999.000200" {
+		t.Errorf("reactions.add = %v, want one ack on the inbound message", reactions)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		fs := newFakeSlack(t)
+		ch, _ := newTestChannel(t, fs, config.SlackConfig{})
+		ts, err := ch.SendPlaceholder(ctx, "C1")
+		if err != nil || ts != "" {
+			t.Errorf("SendPlaceholder() = %q, %v; want no placeholder", ts, err)
+		}
+		if len(fs.called("chat.postMessage")) != 0 {
+			t.Error("disabled placeholder was posted")
+		}
+	})
+}
+
+func buttonClick(userID string) socketmode.Event {
+	return socketmode.Event{
+		Type: socketmode.EventTypeInteractive,
+		Data: slack.InteractionCallback{
+			Type:     slack.InteractionTypeBlockActions,
+			User:     slack.User{ID: userID, Name: "alice"},
+			ActionTs: "1700000001.000001",
+			Container: slack.Container{
+				ChannelID: "C1",
+				MessageTs: "1700000000.000001",
+				ThreadTs:  "1699999999.000100",
+			},
+			Message: slack.Message{Msg: slack.Msg{
+				Text: "Deploy?",
+				Blocks: slack.Blocks{BlockSet: []slack.Block{
+					slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "Deploy?", false, false), nil, nil),
+					slack.NewActionBlock("", slack.NewButtonBlockElement(actionIDPrefix+"0_0", "yes",
+						slack.NewTextBlockObject(slack.PlainTextType, "Yes", false, false))),
+				}},
+			}},
+			ActionCallback: slack.ActionCallbacks{BlockActions: []*slack.BlockAction{
+				{ActionID: actionIDPrefix + "0_0", Value: "yes"},
+			}},
+		},
+	}
+}
+
+func TestSlackChannel_ButtonClick(t *testing.T) {
+	fs := newFakeSlack(t)
+	ch, mb := newTestChannel(t, fs, config.SlackConfig{AllowFrom: []string{"U_ALLOWED"}})
+
+	ch.handleInteractive(buttonClick("U_ALLOWED"))
+
+	msg := bustest.Consume(t, mb)
+	if msg.Content != "yes" || msg.ChatID != "C1/1699999999.000100" || msg.MessageID != "1700000001.000001" {
+		t.Errorf("inbound = %+v", msg)
+	}
+	if msg.Peer.Kind != "channel" || msg.Peer.ID != "C1" {
+		t.Errorf("peer = %+v", msg.Peer)
+	}
+	if msg.Metadata["reply_to"] != "1700000000.000001" || msg.Metadata["interaction"] != "block_actions" {
+		t.Errorf("metadata = %v", msg.Metadata)
+	}
+
+	updates := fs.called("chat.update")
+	if len(updates) != 1 {
+		t.Fatalf("chat.update calls = %d, want 1", len(updates))
+	}
+	if updates[0].Get("ts") != "1700000000.000001" {
+		t.Errorf("updated ts = %q", updates[0].Get("ts"))
+	}
+	if blocks := updates[0].Get("blocks"); strings.Contains(blocks, `"actions"`) || !strings.Contains(blocks, "Deploy?") {
+		t.Errorf("buttons not removed: %s", blocks)
+	}
+}
+
+func TestSlackChannel_ButtonClickRejected(t *testing.T) {
+	fs := newFakeSlack(t)
+	ch, mb := newTestChannel(t, fs, config.SlackConfig{AllowFrom: []string{"U_ALLOWED"}})
+
+	ch.handleInteractive(buttonClick("U_BLOCKED"))
+
+	bustest.NoInbound(t, mb, 100*time.Millisecond)
+	if updates := fs.called("chat.update"); len(updates) != 0 {
+		t.Errorf("rejected click edited the message: %v", updates)
+	}
+}
+
+func TestSlackChannel_SendMedia(t *testing.T) {
+	fs := newFakeSlack(t)
+	ch, _ := newTestChannel(t, fs, config.SlackConfig{})
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	content := []byte("quarterly numbers")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := ch.GetMediaStore().Store(path, media.MediaMeta{Filename: "report.txt"}, "test")
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	err = ch.SendMedia(context.Background(), bus.OutboundMediaMessage{
+		ChatID: "C1/1699999999.000100",
+		Parts:  []bus.MediaPart{{Type: "file", Ref: ref, Filename: "report.txt", Caption: "**Q3**"}},
+	})
+	if err != nil {
+		t.Fatalf("SendMedia() error = %v", err)
+	}
+
+	urls := fs.called("files.getUploadURLExternal")
+	if len(urls) != 1 {
+		t.Fatalf("files.getUploadURLExternal calls = %d, want 1", len(urls))
+	}
+	if urls[0].Get("filename") != "report.txt" || urls[0].Get("length") != strconv.Itoa(len(content)) {
+		t.Errorf("upload URL request = %v", urls[0])
+	}
+
+	fs.mu.Lock()
+	uploads := fs.uploads
+	fs.mu.Unlock()
+	if len(uploads) != 1 || string(uploads[0]) != string(content) {
+		t.Errorf("uploaded = %q, want %q", uploads, content)
+	}
+
+	done := fs.called("files.completeUploadExternal")
+	if len(done) != 1 {
+		t.Fatalf("files.completeUploadExternal calls = %d, want 1", len(done))
+	}
+	if done[0].Get("channel_id") != "C1" || done[0].Get("thread_ts") != "1699999999.000100" ||
+		done[0].Get("initial_comment") != "*Q3*" {
+		t.Errorf("complete upload = %v", done[0])
+	}
+}
@@ -0,0 +1,62 @@
+package telegram
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxCallbackData is Telegram's limit on a button's callback data.
+	maxCallbackData = 64
+	// callbackTokenPrefix marks callback data that stands for a value kept
+	// in the callbackStore.
+	callbackTokenPrefix = "cb:"
+	// maxCallbackValues caps the values kept; the oldest are forgotten first.
+	maxCallbackValues = 4096
+)
+
+// callbackStore keeps button values that don't fit in callback data, keyed
+// by a short token that is sent instead. The zero value is ready to use.
+type callbackStore struct {
+	mu     sync.Mutex
+	values map[string]string
+	order  []string // tokens, oldest first
+}
+
+// data returns the callback data for a button value: the value itself if it
+// fits, or else a token for it.
+func (s *callbackStore) data(value string) string {
+	if len(value) <= maxCallbackData && !strings.HasPrefix(value, callbackTokenPrefix) {
+		return value
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	token := callbackTokenPrefix + hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]string)
+	}
+	s.values[token] = value
+	s.order = append(s.order, token)
+	if len(s.order) > maxCallbackValues {
+		delete(s.values, s.order[0])
+		s.order = s.order[1:]
+	}
+	return token
+}
+
+// value returns the button value for callback data. It reports false for a
+// token that is no longer known, for example after a restart.
+func (s *callbackStore) value(data string) (string, bool) {
+	if !strings.HasPrefix(data, callbackTokenPrefix) {
+		return data, true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[data]
+	return v, ok
+}
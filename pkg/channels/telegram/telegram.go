@@ -2,7 +2,10 @@ package telegram
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
+	"html"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -10,6 +13,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/mymmrac/telego"
@@ -18,6 +22,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/identity"
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -25,18 +30,11 @@ import (
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
-var (
-	reHeading    = regexp.MustCompile(`^#{1,6}\s+(.+)$`)
-	reBlockquote = regexp.MustCompile(`^>\s*(.*)$`)
-	reLink       = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
-	reBoldStar   = regexp.MustCompile(`\*\*(.+?)\*\*`)
-	reBoldUnder  = regexp.MustCompile(`__(.+?)__`)
-	reItalic     = regexp.MustCompile(`_([^_]+)_`)
-	reStrike     = regexp.MustCompile(`~~(.+?)~~`)
-	reListItem   = regexp.MustCompile(`^[-*]\s+`)
-	reCodeBlock  = regexp.MustCompile("```[\\w]*\\n?([\\s\\S]*?)```")
-	reInlineCode = regexp.MustCompile("`([^`]+)`")
-)
+// maxWebhookBodySize bounds a single webhook update.
+const maxWebhookBodySize = 1 << 20
+
+// reTag matches an HTML tag, for the plain text fallback.
+var reTag = regexp.MustCompile(`<[^>]+>`)
 
 type TelegramChannel struct {
 	*channels.BaseChannel
@@ -45,8 +43,12 @@ type TelegramChannel struct {
 	commands TelegramCommander
 	config   *config.Config
 	chatIDs  map[string]int64
+	buttons  callbackStore
 	ctx      context.Context
 	cancel   context.CancelFunc
+
+	// webhook receives updates posted to ServeHTTP; nil while polling.
+	webhook atomic.Pointer[telego.WebhookHandler]
 }
 
 func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus) (*TelegramChannel, error) {
@@ -87,6 +89,7 @@ func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus) (*TelegramChann
 		bus,
 		telegramCfg.AllowFrom,
 		channels.WithMaxMessageLength(4096),
+		channels.WithTextFormat(format.TelegramHTML),
 		channels.WithGroupTrigger(telegramCfg.GroupTrigger),
 		channels.WithReasoningChannelID(telegramCfg.ReasoningChannelID),
 	)
@@ -101,7 +104,7 @@ func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus) (*TelegramChann
 }
 
 func (c *TelegramChannel) Start(ctx context.Context) error {
-	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
+	logger.InfoC("telegram", "Starting Telegram bot...")
 
 	c.ctx, c.cancel = context.WithCancel(ctx)
 
@@ -111,12 +114,10 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		})
 	}
 
-	updates, err := c.bot.UpdatesViaLongPolling(c.ctx, &telego.GetUpdatesParams{
-		Timeout: 30,
-	})
+	updates, err := c.receiveUpdates(c.ctx)
 	if err != nil {
 		c.cancel()
-		return fmt.Errorf("failed to start long polling: %w", err)
+		return fmt.Errorf("failed to receive updates: %w", err)
 	}
 
 	bh, err := th.NewBotHandler(c.bot, updates)
@@ -145,6 +146,10 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return c.handleMessage(ctx, &message)
 	}, th.AnyMessage())
 
+	bh.HandleCallbackQuery(func(ctx *th.Context, query telego.CallbackQuery) error {
+		return c.handleCallbackQuery(ctx, query)
+	}, th.AnyCallbackQueryWithMessage())
+
 	c.SetRunning(true)
 	logger.InfoCF("telegram", "Telegram bot connected", map[string]any{
 		"username": c.bot.Username(),
@@ -170,6 +175,15 @@ func (c *TelegramChannel) Stop(ctx context.Context) error {
 		_ = c.bh.StopWithContext(ctx)
 	}
 
+	// Hand updates back to getUpdates for the next start, or other consumers
+	if c.webhook.Swap(nil) != nil {
+		if err := c.bot.DeleteWebhook(ctx, &telego.DeleteWebhookParams{}); err != nil {
+			logger.WarnCF("telegram", "Failed to delete webhook", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
 	// Cancel our context (stops long polling)
 	if c.cancel != nil {
 		c.cancel()
@@ -178,6 +192,122 @@ func (c *TelegramChannel) Stop(ctx context.Context) error {
 	return nil
 }
 
+// receiveUpdates registers the webhook when webhook_url is configured, and
+// long-polls for updates otherwise or when registration fails.
+func (c *TelegramChannel) receiveUpdates(ctx context.Context) (<-chan telego.Update, error) {
+	if webhookURL := c.webhookURL(); webhookURL != "" {
+		updates, err := c.startWebhook(ctx, webhookURL)
+		if err == nil {
+			logger.InfoCF("telegram", "Receiving updates via webhook", map[string]any{
+				"url":  webhookURL,
+				"path": c.WebhookPath(),
+			})
+			return updates, nil
+		}
+		logger.WarnCF("telegram", "Webhook registration failed, falling back to polling", map[string]any{
+			"url":   webhookURL,
+			"error": err.Error(),
+		})
+		// getUpdates is refused while a webhook from an earlier run is set
+		_ = c.bot.DeleteWebhook(ctx, &telego.DeleteWebhookParams{})
+	}
+
+	logger.InfoC("telegram", "Receiving updates via long polling")
+	return c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
+		Timeout: 30,
+	})
+}
+
+func (c *TelegramChannel) startWebhook(ctx context.Context, webhookURL string) (<-chan telego.Update, error) {
+	err := c.bot.SetWebhook(ctx, &telego.SetWebhookParams{
+		URL:         webhookURL,
+		SecretToken: c.webhookSecret(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updates, err := c.bot.UpdatesViaWebhook(ctx, func(handler telego.WebhookHandler) error {
+		c.webhook.Store(&handler)
+		return nil
+	})
+	if err != nil {
+		c.webhook.Store(nil)
+		_ = c.bot.DeleteWebhook(ctx, &telego.DeleteWebhookParams{})
+		return nil, err
+	}
+	return updates, nil
+}
+
+// webhookURL returns the public URL Telegram should post updates to. A URL
+// without a path gets WebhookPath appended.
+func (c *TelegramChannel) webhookURL() string {
+	raw := strings.TrimSpace(c.config.Channels.Telegram.WebhookURL)
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = c.WebhookPath()
+	}
+	return u.String()
+}
+
+// webhookSecret returns the token Telegram sends in every webhook request.
+func (c *TelegramChannel) webhookSecret() string {
+	if secret := c.config.Channels.Telegram.WebhookSecret; secret != "" {
+		return secret
+	}
+	return c.bot.SecretToken()
+}
+
+// WebhookPath implements channels.WebhookHandler.
+func (c *TelegramChannel) WebhookPath() string {
+	if path := c.config.Channels.Telegram.WebhookPath; path != "" {
+		return path
+	}
+	return "/webhook/telegram"
+}
+
+// ServeHTTP implements http.Handler for the shared HTTP server. It accepts
+// updates only while the webhook is registered and the request carries the
+// secret token.
+func (c *TelegramChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler := c.webhook.Load()
+	if handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	secret := r.Header.Get(telego.WebhookSecretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(c.webhookSecret())) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	// Updates are handled after the response, so they get the channel's
+	// context rather than the request's.
+	if err := (*handler)(c.ctx, data); err != nil {
+		logger.WarnCF("telegram", "Rejected webhook update", map[string]any{
+			"error": err.Error(),
+		})
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 func (c *TelegramChannel) initBotCommands(ctx context.Context) error {
 	currentCommands, err := c.bot.GetMyCommands(ctx, &telego.GetMyCommandsParams{
 		Scope: tu.ScopeDefault(),
@@ -228,22 +358,26 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return channels.ErrNotRunning
 	}
 
-	chatID, err := parseChatID(msg.ChatID)
+	chatID, threadID, err := parseChatID(msg.ChatID)
 	if err != nil {
 		return fmt.Errorf("invalid chat ID %s: %w", msg.ChatID, channels.ErrSendFailed)
 	}
 
-	htmlContent := markdownToTelegramHTML(msg.Content)
-
-	// Typing/placeholder handled by Manager.preSend — just send the message
-	tgMsg := tu.Message(tu.ID(chatID), htmlContent)
+	// Typing/placeholder handled by Manager.preSend, and the content arrives
+	// rendered as Telegram HTML — just send the message
+	tgMsg := tu.Message(tu.ID(chatID), msg.Content)
+	tgMsg.MessageThreadID = threadID
 	tgMsg.ParseMode = telego.ModeHTML
+	if keyboard := c.inlineKeyboard(msg.Buttons); keyboard != nil {
+		tgMsg.ReplyMarkup = keyboard
+	}
 
 	if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
 		logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]any{
 			"error": err.Error(),
 		})
 		tgMsg.ParseMode = ""
+		tgMsg.Text = htmlToPlain(msg.Content)
 		if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
 			return fmt.Errorf("telegram send: %w", channels.ErrTemporary)
 		}
@@ -257,13 +391,15 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 // (Telegram's typing indicator expires after ~5s) in a background goroutine.
 // The returned stop function is idempotent and cancels the goroutine.
 func (c *TelegramChannel) StartTyping(ctx context.Context, chatID string) (func(), error) {
-	cid, err := parseChatID(chatID)
+	cid, threadID, err := parseChatID(chatID)
 	if err != nil {
 		return func() {}, err
 	}
+	action := tu.ChatAction(tu.ID(cid), telego.ChatActionTyping)
+	action.MessageThreadID = threadID
 
 	// Send the first typing action immediately
-	_ = c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(cid), telego.ChatActionTyping))
+	_ = c.bot.SendChatAction(ctx, action)
 
 	typingCtx, cancel := context.WithCancel(ctx)
 	go func() {
@@ -274,7 +410,7 @@ func (c *TelegramChannel) StartTyping(ctx context.Context, chatID string) (func(
 			case <-typingCtx.Done():
 				return
 			case <-ticker.C:
-				_ = c.bot.SendChatAction(typingCtx, tu.ChatAction(tu.ID(cid), telego.ChatActionTyping))
+				_ = c.bot.SendChatAction(typingCtx, action)
 			}
 		}
 	}()
@@ -284,7 +420,17 @@ func (c *TelegramChannel) StartTyping(ctx context.Context, chatID string) (func(
 
 // EditMessage implements channels.MessageEditor.
 func (c *TelegramChannel) EditMessage(ctx context.Context, chatID string, messageID string, content string) error {
-	cid, err := parseChatID(chatID)
+	return c.EditMessageButtons(ctx, chatID, messageID, content, nil)
+}
+
+// EditMessageButtons implements channels.ButtonCapable. The buttons become
+// an inline keyboard under the message.
+func (c *TelegramChannel) EditMessageButtons(
+	ctx context.Context,
+	chatID, messageID, content string,
+	buttons [][]bus.Button,
+) error {
+	cid, _, err := parseChatID(chatID)
 	if err != nil {
 		return err
 	}
@@ -292,9 +438,9 @@ func (c *TelegramChannel) EditMessage(ctx context.Context, chatID string, messag
 	if err != nil {
 		return err
 	}
-	htmlContent := markdownToTelegramHTML(content)
-	editMsg := tu.EditMessageText(tu.ID(cid), mid, htmlContent)
+	editMsg := tu.EditMessageText(tu.ID(cid), mid, content)
 	editMsg.ParseMode = telego.ModeHTML
+	editMsg.ReplyMarkup = c.inlineKeyboard(buttons)
 	_, err = c.bot.EditMessageText(ctx, editMsg)
 	return err
 }
@@ -313,12 +459,14 @@ func (c *TelegramChannel) SendPlaceholder(ctx context.Context, chatID string) (s
 		text = "Thinking... 💭"
 	}
 
-	cid, err := parseChatID(chatID)
+	cid, threadID, err := parseChatID(chatID)
 	if err != nil {
 		return "", err
 	}
 
-	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(cid), text))
+	params := tu.Message(tu.ID(cid), text)
+	params.MessageThreadID = threadID
+	pMsg, err := c.bot.SendMessage(ctx, params)
 	if err != nil {
 		return "", err
 	}
@@ -332,7 +480,7 @@ func (c *TelegramChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMe
 		return channels.ErrNotRunning
 	}
 
-	chatID, err := parseChatID(msg.ChatID)
+	chatID, threadID, err := parseChatID(msg.ChatID)
 	if err != nil {
 		return fmt.Errorf("invalid chat ID %s: %w", msg.ChatID, channels.ErrSendFailed)
 	}
@@ -364,30 +512,34 @@ func (c *TelegramChannel) SendMedia(ctx context.Context, msg bus.OutboundMediaMe
 		switch part.Type {
 		case "image":
 			params := &telego.SendPhotoParams{
-				ChatID:  tu.ID(chatID),
-				Photo:   telego.InputFile{File: file},
-				Caption: part.Caption,
+				ChatID:          tu.ID(chatID),
+				MessageThreadID: threadID,
+				Photo:           telego.InputFile{File: file},
+				Caption:         part.Caption,
 			}
 			_, err = c.bot.SendPhoto(ctx, params)
 		case "audio":
 			params := &telego.SendAudioParams{
-				ChatID:  tu.ID(chatID),
-				Audio:   telego.InputFile{File: file},
-				Caption: part.Caption,
+				ChatID:          tu.ID(chatID),
+				MessageThreadID: threadID,
+				Audio:           telego.InputFile{File: file},
+				Caption:         part.Caption,
 			}
 			_, err = c.bot.SendAudio(ctx, params)
 		case "video":
 			params := &telego.SendVideoParams{
-				ChatID:  tu.ID(chatID),
-				Video:   telego.InputFile{File: file},
-				Caption: part.Caption,
+				ChatID:          tu.ID(chatID),
+				MessageThreadID: threadID,
+				Video:           telego.InputFile{File: file},
+				Caption:         part.Caption,
 			}
 			_, err = c.bot.SendVideo(ctx, params)
 		default: // "file" or unknown types
 			params := &telego.SendDocumentParams{
-				ChatID:   tu.ID(chatID),
-				Document: telego.InputFile{File: file},
-				Caption:  part.Caption,
+				ChatID:          tu.ID(chatID),
+				MessageThreadID: threadID,
+				Document:        telego.InputFile{File: file},
+				Caption:         part.Caption,
 			}
 			_, err = c.bot.SendDocument(ctx, params)
 		}
@@ -518,9 +670,18 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		content = "[empty message]"
 	}
 
+	replyTo := quotedMessage(message)
+	if replyTo != nil {
+		if quote := quoteText(message, replyTo); quote != "" {
+			content = fmt.Sprintf("[quote: %s]\n%s", utils.Truncate(quote, 200), content)
+		}
+	}
+
 	// In group chats, apply unified group trigger filtering
 	if message.Chat.Type != "private" {
-		isMentioned := c.isBotMentioned(message)
+		// Replying to the bot counts as addressing it.
+		isMentioned := c.isBotMentioned(message) ||
+			(replyTo != nil && replyTo.From != nil && replyTo.From.ID == c.bot.ID())
 		if isMentioned {
 			content = c.stripBotMention(content)
 		}
@@ -539,28 +700,17 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 
 	// Placeholder is now auto-triggered by BaseChannel.HandleMessage via PlaceholderCapable
 
-	peerKind := "direct"
-	peerID := fmt.Sprintf("%d", user.ID)
-	if message.Chat.Type != "private" {
-		peerKind = "group"
-		peerID = fmt.Sprintf("%d", chatID)
-	}
-
-	peer := bus.Peer{Kind: peerKind, ID: peerID}
+	peer, metadata := conversation(message, user)
 	messageID := fmt.Sprintf("%d", message.MessageID)
-
-	metadata := map[string]string{
-		"user_id":    fmt.Sprintf("%d", user.ID),
-		"username":   user.Username,
-		"first_name": user.FirstName,
-		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
+	if replyTo != nil {
+		metadata["reply_to"] = fmt.Sprintf("%d", replyTo.MessageID)
 	}
 
 	c.HandleMessage(c.ctx,
 		peer,
 		messageID,
 		platformID,
-		fmt.Sprintf("%d", chatID),
+		formatChatID(chatID, topicID(message)),
 		content,
 		mediaPaths,
 		metadata,
@@ -569,6 +719,79 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	return nil
 }
 
+// handleCallbackQuery delivers a tap on an inline keyboard button as a
+// message from the user who tapped it, in the chat and topic of the message
+// that carried the keyboard.
+func (c *TelegramChannel) handleCallbackQuery(ctx context.Context, query telego.CallbackQuery) error {
+	// Answer every query so the client stops showing a spinner on the button.
+	answer := tu.CallbackQuery(query.ID)
+	defer func() {
+		if err := c.bot.AnswerCallbackQuery(ctx, answer); err != nil {
+			logger.DebugCF("telegram", "Failed to answer callback query", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	message := query.Message.Message()
+	if message == nil || query.Data == "" {
+		return nil
+	}
+
+	user := query.From
+	platformID := fmt.Sprintf("%d", user.ID)
+	sender := bus.SenderInfo{
+		Platform:    "telegram",
+		PlatformID:  platformID,
+		CanonicalID: identity.BuildCanonicalID("telegram", platformID),
+		Username:    user.Username,
+		DisplayName: user.FirstName,
+	}
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("telegram", "Callback query rejected by allowlist", map[string]any{
+			"user_id": platformID,
+		})
+		return nil
+	}
+
+	content, ok := c.buttons.value(query.Data)
+	if !ok {
+		answer.WithText("This choice has expired.")
+		return nil
+	}
+
+	// Drop the keyboard so a choice is only made once.
+	if _, err := c.bot.EditMessageReplyMarkup(ctx, tu.EditMessageReplyMarkup(
+		tu.ID(message.Chat.ID), message.MessageID, nil,
+	)); err != nil {
+		logger.DebugCF("telegram", "Failed to remove inline keyboard", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	logger.DebugCF("telegram", "Received button tap", map[string]any{
+		"sender_id": sender.CanonicalID,
+		"chat_id":   fmt.Sprintf("%d", message.Chat.ID),
+		"data":      utils.Truncate(content, 50),
+	})
+
+	peer, metadata := conversation(message, &user)
+	metadata["reply_to"] = fmt.Sprintf("%d", message.MessageID)
+	metadata["callback_query"] = "true"
+
+	c.HandleMessage(c.ctx,
+		peer,
+		query.ID,
+		platformID,
+		formatChatID(message.Chat.ID, topicID(message)),
+		content,
+		nil,
+		metadata,
+		sender,
+	)
+	return nil
+}
+
 func (c *TelegramChannel) downloadPhoto(ctx context.Context, fileID string) string {
 	file, err := c.bot.GetFile(ctx, &telego.GetFileParams{FileID: fileID})
 	if err != nil {
@@ -608,115 +831,113 @@ func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext string)
 	return c.downloadFileWithInfo(file, ext)
 }
 
-func parseChatID(chatIDStr string) (int64, error) {
-	var id int64
-	_, err := fmt.Sscanf(chatIDStr, "%d", &id)
-	return id, err
-}
-
-func markdownToTelegramHTML(text string) string {
-	if text == "" {
-		return ""
+// conversation returns the routing peer and base metadata for a message
+// from user. Private chats route by user and groups by chat; each forum
+// topic is a peer of its own, with the group as parent peer so group
+// bindings still apply.
+func conversation(message *telego.Message, user *telego.User) (bus.Peer, map[string]string) {
+	isGroup := message.Chat.Type != "private"
+	metadata := map[string]string{
+		"user_id":    fmt.Sprintf("%d", user.ID),
+		"username":   user.Username,
+		"first_name": user.FirstName,
+		"is_group":   fmt.Sprintf("%t", isGroup),
 	}
-
-	codeBlocks := extractCodeBlocks(text)
-	text = codeBlocks.text
-
-	inlineCodes := extractInlineCodes(text)
-	text = inlineCodes.text
-
-	text = reHeading.ReplaceAllString(text, "$1")
-
-	text = reBlockquote.ReplaceAllString(text, "$1")
-
-	text = escapeHTML(text)
-
-	text = reLink.ReplaceAllString(text, `<a href="$2">$1</a>`)
-
-	text = reBoldStar.ReplaceAllString(text, "<b>$1</b>")
-
-	text = reBoldUnder.ReplaceAllString(text, "<b>$1</b>")
-
-	text = reItalic.ReplaceAllStringFunc(text, func(s string) string {
-		match := reItalic.FindStringSubmatch(s)
-		if len(match) < 2 {
-			return s
-		}
-		return "<i>" + match[1] + "</i>"
-	})
-
-	text = reStrike.ReplaceAllString(text, "<s>$1</s>")
-
-	text = reListItem.ReplaceAllString(text, "• ")
-
-	for i, code := range inlineCodes.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(text, fmt.Sprintf("\x00IC%d\x00", i), fmt.Sprintf("<code>%s</code>", escaped))
+	if !isGroup {
+		return bus.Peer{Kind: "direct", ID: fmt.Sprintf("%d", user.ID)}, metadata
 	}
 
-	for i, code := range codeBlocks.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(
-			text,
-			fmt.Sprintf("\x00CB%d\x00", i),
-			fmt.Sprintf("<pre><code>%s</code></pre>", escaped),
-		)
+	groupID := fmt.Sprintf("%d", message.Chat.ID)
+	topic := topicID(message)
+	if topic == 0 {
+		return bus.Peer{Kind: "group", ID: groupID}, metadata
 	}
-
-	return text
+	metadata["topic_id"] = fmt.Sprintf("%d", topic)
+	metadata["parent_peer_kind"] = "group"
+	metadata["parent_peer_id"] = groupID
+	return bus.Peer{Kind: "group", ID: fmt.Sprintf("%s:topic:%d", groupID, topic)}, metadata
 }
 
-type codeBlockMatch struct {
-	text  string
-	codes []string
+// topicID returns the forum topic a message was posted in, or 0 outside
+// forums and in the General topic. Only forum topics count: in ordinary
+// groups message_thread_id merely links reply chains.
+func topicID(message *telego.Message) int {
+	if message.IsTopicMessage {
+		return message.MessageThreadID
+	}
+	return 0
 }
 
-func extractCodeBlocks(text string) codeBlockMatch {
-	matches := reCodeBlock.FindAllStringSubmatch(text, -1)
-
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
+// quotedMessage returns the message being replied to. In forums every
+// message is technically a reply to its topic's creation message, which is
+// not a real reply and is skipped.
+func quotedMessage(message *telego.Message) *telego.Message {
+	reply := message.ReplyToMessage
+	if reply == nil || reply.ForumTopicCreated != nil {
+		return nil
 	}
-
-	i := 0
-	text = reCodeBlock.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00CB%d\x00", i)
-		i++
-		return placeholder
-	})
-
-	return codeBlockMatch{text: text, codes: codes}
+	return reply
 }
 
-type inlineCodeMatch struct {
-	text  string
-	codes []string
+// quoteText returns the part of reply the user quoted, or its whole text.
+func quoteText(message, reply *telego.Message) string {
+	if message.Quote != nil && message.Quote.Text != "" {
+		return message.Quote.Text
+	}
+	if reply.Text != "" {
+		return reply.Text
+	}
+	return reply.Caption
 }
 
-func extractInlineCodes(text string) inlineCodeMatch {
-	matches := reInlineCode.FindAllStringSubmatch(text, -1)
-
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
+// inlineKeyboard converts button rows to an inline keyboard, or nil if there
+// are none. Values too long for callback data are kept server-side and sent
+// as a token.
+func (c *TelegramChannel) inlineKeyboard(buttons [][]bus.Button) *telego.InlineKeyboardMarkup {
+	var rows [][]telego.InlineKeyboardButton
+	for _, row := range buttons {
+		var kbRow []telego.InlineKeyboardButton
+		for _, b := range row {
+			kbRow = append(kbRow, tu.InlineKeyboardButton(b.Text).WithCallbackData(c.buttons.data(b.Value())))
+		}
+		if len(kbRow) > 0 {
+			rows = append(rows, kbRow)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
 	}
+	return tu.InlineKeyboard(rows...)
+}
 
-	i := 0
-	text = reInlineCode.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00IC%d\x00", i)
-		i++
-		return placeholder
-	})
+// formatChatID builds the chat ID replies are addressed to: the Telegram
+// chat ID, followed by "/<topic>" for messages in a forum topic.
+func formatChatID(chatID int64, threadID int) string {
+	if threadID != 0 {
+		return fmt.Sprintf("%d/%d", chatID, threadID)
+	}
+	return fmt.Sprintf("%d", chatID)
+}
 
-	return inlineCodeMatch{text: text, codes: codes}
+// parseChatID splits a chat ID made by formatChatID.
+func parseChatID(chatIDStr string) (chatID int64, threadID int, err error) {
+	idPart, topicPart, hasTopic := strings.Cut(chatIDStr, "/")
+	chatID, err = strconv.ParseInt(strings.TrimSpace(idPart), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid chat ID %q", chatIDStr)
+	}
+	if hasTopic {
+		threadID, err = strconv.Atoi(topicPart)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid topic in chat ID %q", chatIDStr)
+		}
+	}
+	return chatID, threadID, nil
 }
 
-func escapeHTML(text string) string {
-	text = strings.ReplaceAll(text, "&", "&amp;")
-	text = strings.ReplaceAll(text, "<", "&lt;")
-	text = strings.ReplaceAll(text, ">", "&gt;")
-	return text
+// htmlToPlain strips the markup from rendered Telegram HTML.
+func htmlToPlain(s string) string {
+	return html.UnescapeString(reTag.ReplaceAllString(s, ""))
 }
 
 // isBotMentioned checks if the bot is mentioned in the message via entities.
@@ -0,0 +1,140 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels/format"
+)
+
+func TestParseChatID(t *testing.T) {
+	tests := []struct {
+		in       string
+		chatID   int64
+		threadID int
+		wantErr  bool
+	}{
+		{"12345", 12345, 0, false},
+		{"-1001234567890", -1001234567890, 0, false},
+		{"-1001234567890/42", -1001234567890, 42, false},
+		{"abc", 0, 0, true},
+		{"-100/x", 0, 0, true},
+	}
+	for _, tt := range tests {
+		chatID, threadID, err := parseChatID(tt.in)
+		if (err != nil) != tt.wantErr || chatID != tt.chatID || threadID != tt.threadID {
+			t.Errorf("parseChatID(%q) = %d, %d, %v", tt.in, chatID, threadID, err)
+		}
+		if err == nil && formatChatID(chatID, threadID) != tt.in {
+			t.Errorf("formatChatID(%d, %d) = %q", chatID, threadID, formatChatID(chatID, threadID))
+		}
+	}
+}
+
+func TestConversation_ForumTopics(t *testing.T) {
+	user := &telego.User{ID: 7, FirstName: "Ann"}
+	forum := telego.Chat{ID: -100, Type: "supergroup", IsForum: true}
+
+	peer, meta := conversation(&telego.Message{Chat: forum, MessageThreadID: 42, IsTopicMessage: true}, user)
+	if peer.Kind != "group" || peer.ID != "-100:topic:42" {
+		t.Fatalf("topic peer = %+v", peer)
+	}
+	if meta["parent_peer_kind"] != "group" || meta["parent_peer_id"] != "-100" || meta["topic_id"] != "42" {
+		t.Fatalf("topic metadata = %v", meta)
+	}
+
+	// General topic, and reply chains in ordinary groups, share the group peer.
+	for _, msg := range []*telego.Message{
+		{Chat: forum},
+		{Chat: telego.Chat{ID: -200, Type: "supergroup"}, MessageThreadID: 5},
+	} {
+		peer, meta := conversation(msg, user)
+		if peer.ID != formatChatID(msg.Chat.ID, 0) || meta["parent_peer_id"] != "" {
+			t.Fatalf("peer = %+v, metadata = %v", peer, meta)
+		}
+	}
+
+	peer, _ = conversation(&telego.Message{Chat: telego.Chat{ID: 7, Type: "private"}}, user)
+	if peer.Kind != "direct" || peer.ID != "7" {
+		t.Fatalf("private peer = %+v", peer)
+	}
+}
+
+func TestQuotedMessage(t *testing.T) {
+	original := &telego.Message{MessageID: 3, Text: "the full original text"}
+	msg := &telego.Message{ReplyToMessage: original}
+	if quotedMessage(msg) != original || quoteText(msg, original) != "the full original text" {
+		t.Fatal("expected the replied-to text")
+	}
+
+	msg.Quote = &telego.TextQuote{Text: "original"}
+	if got := quoteText(msg, original); got != "original" {
+		t.Fatalf("quoteText = %q, want the quoted part", got)
+	}
+
+	topicStart := &telego.Message{ForumTopicCreated: &telego.ForumTopicCreated{Name: "Ideas"}}
+	if quotedMessage(&telego.Message{ReplyToMessage: topicStart}) != nil {
+		t.Fatal("topic creation message is not a reply")
+	}
+}
+
+func TestInlineKeyboard(t *testing.T) {
+	c := &TelegramChannel{}
+	if c.inlineKeyboard(nil) != nil {
+		t.Fatal("expected no keyboard without buttons")
+	}
+
+	long := strings.Repeat("é", 40) // 80 bytes
+	kb := c.inlineKeyboard([][]bus.Button{
+		{{Text: "Approve", Data: "approve"}, {Text: "Deny"}},
+		{{Text: "Long", Data: long}, {Text: "Lookalike", Data: "cb:0123"}},
+	})
+	if len(kb.InlineKeyboard) != 2 || len(kb.InlineKeyboard[0]) != 2 {
+		t.Fatalf("keyboard = %+v", kb.InlineKeyboard)
+	}
+	if b := kb.InlineKeyboard[0][1]; b.Text != "Deny" || b.CallbackData != "Deny" {
+		t.Fatalf("button = %+v", b)
+	}
+
+	// Values that don't fit, or look like a token, travel as a token and
+	// come back whole.
+	for i, want := range []string{long, "cb:0123"} {
+		data := kb.InlineKeyboard[1][i].CallbackData
+		if len(data) > maxCallbackData || data == want {
+			t.Fatalf("callback data = %q (%d bytes)", data, len(data))
+		}
+		if got, ok := c.buttons.value(data); !ok || got != want {
+			t.Fatalf("value(%q) = %q, %v, want %q", data, got, ok, want)
+		}
+	}
+	if _, ok := c.buttons.value("cb:unknown"); ok {
+		t.Fatal("unknown token should not resolve")
+	}
+	if got, ok := c.buttons.value("approve"); !ok || got != "approve" {
+		t.Fatalf("inline value = %q, %v", got, ok)
+	}
+}
+
+func TestCallbackStore_Cap(t *testing.T) {
+	var s callbackStore
+	first := s.data(strings.Repeat("x", 100))
+	for range maxCallbackValues {
+		s.data(strings.Repeat("y", 100))
+	}
+	if _, ok := s.value(first); ok {
+		t.Fatal("oldest value should be forgotten")
+	}
+	if len(s.values) != maxCallbackValues {
+		t.Fatalf("values = %d, want %d", len(s.values), maxCallbackValues)
+	}
+}
+
+func TestHTMLToPlain(t *testing.T) {
+	in := format.Render("**Note:** use `a < b` & [docs](https://example.com)", format.TelegramHTML)
+	if got, want := htmlToPlain(in), "Note: use a < b & docs"; got != want {
+		t.Fatalf("htmlToPlain(%q) = %q, want %q", in, got, want)
+	}
+}
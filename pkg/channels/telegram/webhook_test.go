@@ -0,0 +1,167 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const testToken = "123456:ABCDEFGHIJKLMNOPQRSTUVWXYZ012345678"
+
+// fakeAPI is a minimal Telegram Bot API that records the methods called.
+type fakeAPI struct {
+	mu         sync.Mutex
+	calls      []string
+	params     map[string]map[string]any
+	setWebhook bool // whether setWebhook succeeds
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	body, _ := io.ReadAll(r.Body)
+	var params map[string]any
+	json.Unmarshal(body, &params)
+
+	f.mu.Lock()
+	f.calls = append(f.calls, method)
+	f.params[method] = params
+	f.mu.Unlock()
+
+	var result any = true
+	switch method {
+	case "getMe":
+		result = map[string]any{"id": 1, "is_bot": true, "first_name": "Bot", "username": "test_bot"}
+	case "getMyCommands", "getUpdates":
+		if method == "getUpdates" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		result = []any{}
+	case "setWebhook":
+		if !f.setWebhook {
+			json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": 400, "description": "bad webhook"})
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+func (f *fakeAPI) called(method string) (map[string]any, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	params, ok := f.params[method]
+	return params, ok
+}
+
+func startWebhookChannel(t *testing.T, api *fakeAPI, tg config.TelegramConfig) (*TelegramChannel, *bus.MessageBus) {
+	t.Helper()
+	api.params = map[string]map[string]any{}
+	apiSrv := httptest.NewServer(api)
+	t.Cleanup(apiSrv.Close)
+
+	cfg := config.DefaultConfig()
+	tg.Token = testToken
+	tg.BaseURL = apiSrv.URL
+	cfg.Channels.Telegram = tg
+
+	mb := bus.NewMessageBus()
+	ch, err := NewTelegramChannel(cfg, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return ch, mb
+}
+
+func postUpdate(ch *TelegramChannel, secret, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, ch.WebhookPath(), strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set(telego.WebhookSecretTokenHeader, secret)
+	}
+	rec := httptest.NewRecorder()
+	ch.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebhookMode(t *testing.T) {
+	api := &fakeAPI{setWebhook: true}
+	ch, mb := startWebhookChannel(t, api, config.TelegramConfig{
+		WebhookURL:    "https://bot.example.com",
+		WebhookSecret: "s3cret",
+	})
+
+	params, ok := api.called("setWebhook")
+	if !ok || params["url"] != "https://bot.example.com/webhook/telegram" || params["secret_token"] != "s3cret" {
+		t.Fatalf("setWebhook params = %v", params)
+	}
+	if _, polled := api.called("getUpdates"); polled {
+		t.Fatal("polled for updates in webhook mode")
+	}
+
+	update := `{"update_id": 1, "message": {"message_id": 5, "date": 1,
+		"chat": {"id": 42, "type": "private"}, "from": {"id": 42, "is_bot": false, "first_name": "Ann"},
+		"text": "hello"}}`
+	if rec := postUpdate(ch, "wrong", update); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong secret: status = %d", rec.Code)
+	}
+	if rec := postUpdate(ch, "s3cret", "{"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad body: status = %d", rec.Code)
+	}
+	if rec := postUpdate(ch, "s3cret", update); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.Content != "hello" || msg.ChatID != "42" {
+		t.Fatalf("inbound = %+v", msg)
+	}
+
+	ch.Stop(context.Background())
+	if _, ok := api.called("deleteWebhook"); !ok {
+		t.Fatal("deleteWebhook not called on stop")
+	}
+	if rec := postUpdate(ch, "s3cret", update); rec.Code != http.StatusNotFound {
+		t.Fatalf("after stop: status = %d", rec.Code)
+	}
+}
+
+func TestWebhookFallsBackToPolling(t *testing.T) {
+	api := &fakeAPI{setWebhook: false}
+	ch, _ := startWebhookChannel(t, api, config.TelegramConfig{
+		WebhookURL:  "https://bot.example.com/hooks/tg",
+		WebhookPath: "/hooks/tg",
+	})
+	defer ch.Stop(context.Background())
+
+	params, _ := api.called("setWebhook")
+	if params["url"] != "https://bot.example.com/hooks/tg" || params["secret_token"] != ch.bot.SecretToken() {
+		t.Fatalf("setWebhook params = %v", params)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := api.called("getUpdates"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("did not fall back to polling")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rec := postUpdate(ch, ch.bot.SecretToken(), `{"update_id": 1}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("webhook served while polling: status = %d", rec.Code)
+	}
+}
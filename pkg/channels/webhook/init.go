@@ -0,0 +1,13 @@
+package webhook
+
+import (
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func init() {
+	channels.RegisterFactory("webhook", func(cfg *config.Config, b *bus.MessageBus) (channels.Channel, error) {
+		return NewWebhookChannel(cfg.Channels.Webhook, b)
+	})
+}
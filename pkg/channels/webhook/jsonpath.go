@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed JSONPath-style expression. Only the child and index
+// selectors are supported: "$.a.b", "$.items[0].text", "$['odd key']".
+// The leading "$" is optional.
+type jsonPath []pathStep
+
+type pathStep struct {
+	name  string
+	index int // used when name is ""
+}
+
+func parsePath(expr string) (jsonPath, error) {
+	s := strings.TrimSpace(expr)
+	s = strings.TrimPrefix(s, "$")
+	var path jsonPath
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path %q: empty name", expr)
+			}
+			path = append(path, pathStep{name: s[:end]})
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ]", expr)
+			}
+			inner := s[1:end]
+			s = s[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = append(path, pathStep{name: inner[1 : len(inner)-1]})
+				continue
+			}
+			i, err := strconv.Atoi(inner)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid path %q: bad index %q", expr, inner)
+			}
+			path = append(path, pathStep{index: i})
+		default:
+			if len(path) > 0 {
+				return nil, fmt.Errorf("invalid path %q", expr)
+			}
+			// A bare first name, as in "sender.id".
+			s = "." + s
+		}
+	}
+	return path, nil
+}
+
+// lookup returns the value at path in a document decoded with UseNumber.
+func (p jsonPath) lookup(doc any) (any, bool) {
+	v := doc
+	for _, step := range p {
+		if step.name != "" {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[step.name]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		arr, ok := v.([]any)
+		if !ok || step.index >= len(arr) {
+			return nil, false
+		}
+		v = arr[step.index]
+	}
+	return v, true
+}
+
+// lookupString returns the value at path as a string. Numbers and booleans
+// are formatted; objects, arrays and null count as missing.
+func (p jsonPath) lookupString(doc any) string {
+	if p == nil {
+		return ""
+	}
+	v, ok := p.lookup(doc)
+	if !ok {
+		return ""
+	}
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
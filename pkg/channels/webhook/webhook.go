@@ -0,0 +1,683 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	maxBodySize        = 1 << 20
+	maxAttachmentSize  = 20 << 20
+	maxIdempotencyKeys = 1000
+	defaultPath        = "/webhook/generic"
+	defaultReplyWait   = 30 * time.Second
+	replyModeSync      = "sync"
+	replyModeAsync     = "async"
+)
+
+// WebhookChannel implements the Channel interface for arbitrary systems that
+// can POST JSON: ticketing, CI, form tools. The request body is mapped to a
+// message with configurable paths, and the agent's answer is returned in the
+// HTTP response (sync) or posted to a callback URL (async).
+type WebhookChannel struct {
+	*channels.BaseChannel
+	config  config.WebhookConfig
+	mapping mapping
+	timeout time.Duration
+	client  *http.Client
+	seen    *idempotencyCache
+	lastIDs sync.Map // chatID -> message ID of the latest request, echoed in callbacks
+	mu      sync.Mutex
+	waiters map[waiterKey]chan string // sync requests awaiting their answer
+	seq     atomic.Uint64
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// waiterKey identifies a sync request by chat and inbound message ID, which
+// the agent echoes in the ReplyTo of its final answer.
+type waiterKey struct {
+	chatID, messageID string
+}
+
+type mapping struct {
+	sender, senderName, chatID, content, attachments, messageID jsonPath
+}
+
+// NewWebhookChannel creates a new webhook channel instance.
+func NewWebhookChannel(cfg config.WebhookConfig, messageBus *bus.MessageBus) (*WebhookChannel, error) {
+	if cfg.Secret == "" && cfg.Token == "" {
+		return nil, fmt.Errorf("webhook secret or token is required")
+	}
+	switch cfg.ReplyMode {
+	case "":
+		cfg.ReplyMode = replyModeSync
+	case replyModeSync, replyModeAsync:
+	default:
+		return nil, fmt.Errorf("webhook reply_mode must be %q or %q", replyModeSync, replyModeAsync)
+	}
+	if cfg.CallbackURL != "" {
+		u, err := url.Parse(cfg.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook callback_url must be an http(s) URL")
+		}
+	} else if cfg.ReplyMode == replyModeAsync {
+		return nil, fmt.Errorf("webhook callback_url is required in async reply mode")
+	}
+	if cfg.SignatureHeader == "" {
+		cfg.SignatureHeader = "X-Signature-256"
+	}
+
+	var m mapping
+	for _, f := range []struct {
+		dst  *jsonPath
+		expr string
+		def  string
+	}{
+		{&m.sender, cfg.Mapping.Sender, "$.sender.id"},
+		{&m.senderName, cfg.Mapping.SenderName, ""},
+		{&m.chatID, cfg.Mapping.ChatID, "$.chat_id"},
+		{&m.content, cfg.Mapping.Content, "$.text"},
+		{&m.attachments, cfg.Mapping.Attachments, ""},
+		{&m.messageID, cfg.Mapping.MessageID, ""},
+	} {
+		expr := f.expr
+		if expr == "" {
+			expr = f.def
+		}
+		p, err := parsePath(expr)
+		if err != nil {
+			return nil, fmt.Errorf("webhook mapping: %w", err)
+		}
+		*f.dst = p
+	}
+
+	timeout := time.Duration(cfg.ReplyTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultReplyWait
+	}
+
+	base := channels.NewBaseChannel("webhook", cfg, messageBus, cfg.AllowFrom,
+		channels.WithReasoningChannelID(cfg.ReasoningChannelID),
+	)
+
+	return &WebhookChannel{
+		BaseChannel: base,
+		config:      cfg,
+		mapping:     m,
+		timeout:     timeout,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		seen:        newIdempotencyCache(maxIdempotencyKeys),
+		waiters:     make(map[waiterKey]chan string),
+	}, nil
+}
+
+// Start marks the channel as running; requests arrive through the shared
+// HTTP server.
+func (c *WebhookChannel) Start(ctx context.Context) error {
+	logger.InfoC("webhook", "Starting webhook channel")
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.SetRunning(true)
+	logger.InfoCF("webhook", "Webhook channel started", map[string]any{
+		"path":       c.WebhookPath(),
+		"reply_mode": c.config.ReplyMode,
+	})
+	return nil
+}
+
+// Stop marks the channel as stopped. Requests still waiting for a reply
+// give up when the context is canceled.
+func (c *WebhookChannel) Stop(ctx context.Context) error {
+	logger.InfoC("webhook", "Stopping webhook channel")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.SetRunning(false)
+	logger.InfoC("webhook", "Webhook channel stopped")
+	return nil
+}
+
+// Send answers the sync request msg is the final answer to. Anything else,
+// such as tool output, notices and answers to requests that stopped waiting,
+// goes to the callback URL if one is configured and is dropped otherwise.
+func (c *WebhookChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return channels.ErrNotRunning
+	}
+
+	if waiter := c.takeWaiter(msg.ChatID, msg.ReplyTo); waiter != nil {
+		waiter <- msg.Content
+		return nil
+	}
+	if c.config.CallbackURL == "" {
+		logger.DebugCF("webhook", "No waiting request or callback for message, dropping it", map[string]any{
+			"chat_id":  msg.ChatID,
+			"reply_to": msg.ReplyTo,
+		})
+		return nil
+	}
+	return c.postCallback(ctx, msg.ChatID, msg.Content)
+}
+
+// callbackPayload is the body of a callback POST.
+type callbackPayload struct {
+	ChatID  string `json:"chat_id"`
+	Text    string `json:"text"`
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
+// postCallback delivers a reply to the callback URL, signed the same way
+// requests are.
+func (c *WebhookChannel) postCallback(ctx context.Context, chatID, text string) error {
+	payload := callbackPayload{ChatID: chatID, Text: text}
+	if v, ok := c.lastIDs.Load(chatID); ok {
+		payload.ReplyTo = v.(string)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", channels.ErrSendFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.Secret != "" {
+		req.Header.Set(c.config.SignatureHeader, "sha256="+sign(c.config.Secret, body))
+	}
+	if c.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return channels.ClassifyNetError(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return channels.ClassifySendError(resp.StatusCode, fmt.Errorf("callback returned HTTP %d", resp.StatusCode))
+	}
+	return nil
+}
+
+// WebhookPath returns the path for registering on the shared HTTP server.
+func (c *WebhookChannel) WebhookPath() string {
+	if c.config.Path != "" {
+		return c.config.Path
+	}
+	return defaultPath
+}
+
+// ServeHTTP implements http.Handler for the shared HTTP server.
+func (c *WebhookChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !c.authenticate(r, body) {
+		logger.WarnCF("webhook", "Rejected unauthenticated request", map[string]any{
+			"remote": r.RemoteAddr,
+		})
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !c.IsRunning() {
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		http.Error(w, "Body must be a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	messageID := c.mapping.messageID.lookupString(doc)
+	key := r.Header.Get(c.idempotencyHeader())
+	if key == "" {
+		key = messageID
+	}
+	if key != "" && !c.seen.add(key) {
+		logger.DebugCF("webhook", "Ignoring retried request", map[string]any{
+			"key": key,
+		})
+		writeJSON(w, http.StatusOK, map[string]string{"status": "duplicate"})
+		return
+	}
+
+	senderID := c.mapping.sender.lookupString(doc)
+	chatID := c.mapping.chatID.lookupString(doc)
+	if chatID == "" {
+		chatID = senderID
+	}
+	if senderID == "" {
+		senderID = chatID
+	}
+	if chatID == "" {
+		c.seen.remove(key)
+		http.Error(w, "Missing chat ID or sender", http.StatusBadRequest)
+		return
+	}
+	content := strings.TrimSpace(c.mapping.content.lookupString(doc))
+	attachments := c.attachments(doc)
+	if content == "" && len(attachments) == 0 {
+		c.seen.remove(key)
+		http.Error(w, "Missing content", http.StatusBadRequest)
+		return
+	}
+
+	sender := bus.SenderInfo{
+		Platform:    "webhook",
+		PlatformID:  senderID,
+		CanonicalID: identity.BuildCanonicalID("webhook", senderID),
+		DisplayName: c.mapping.senderName.lookupString(doc),
+	}
+	if !c.IsAllowedSender(sender) {
+		logger.DebugCF("webhook", "Request rejected by allowlist", map[string]any{
+			"sender": senderID,
+		})
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	scope := channels.BuildMediaScope("webhook", chatID, messageID)
+	var mediaRefs []string
+	for _, att := range attachments {
+		ref, label := c.storeAttachment(r.Context(), att, scope)
+		if ref != "" {
+			mediaRefs = append(mediaRefs, ref)
+		}
+		content = appendLine(content, label)
+	}
+
+	metadata := map[string]string{
+		"platform": "webhook",
+	}
+	if messageID != "" {
+		metadata["message_id"] = messageID
+		c.lastIDs.Store(chatID, messageID)
+	} else {
+		c.lastIDs.Delete(chatID)
+	}
+
+	logger.DebugCF("webhook", "Received message", map[string]any{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	peer := bus.Peer{Kind: "direct", ID: chatID}
+	if c.config.ReplyMode == replyModeAsync {
+		c.HandleMessage(c.ctx, peer, messageID, senderID, chatID, content, mediaRefs, metadata, sender)
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted", "chat_id": chatID})
+		return
+	}
+
+	// The answer is matched to this request by message ID, so every sync
+	// request needs one that is unique within its chat.
+	waiterID := messageID
+	waiter := c.addWaiter(chatID, waiterID)
+	if waiter == nil {
+		waiterID = fmt.Sprintf("webhook-%d", c.seq.Add(1))
+		waiter = c.addWaiter(chatID, waiterID)
+	}
+	c.HandleMessage(c.ctx, peer, waiterID, senderID, chatID, content, mediaRefs, metadata, sender)
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case reply := <-waiter:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "chat_id": chatID, "reply": reply})
+		return
+	case <-timer.C:
+	case <-r.Context().Done():
+	case <-c.ctx.Done():
+	}
+
+	if !c.removeWaiter(chatID, waiterID) {
+		// Send took the waiter just now; the reply is on its way.
+		reply := <-waiter
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "chat_id": chatID, "reply": reply})
+		return
+	}
+	if c.config.CallbackURL != "" {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted", "chat_id": chatID})
+		return
+	}
+	writeJSON(w, http.StatusGatewayTimeout, map[string]string{"status": "timeout", "chat_id": chatID})
+}
+
+func (c *WebhookChannel) idempotencyHeader() string {
+	if c.config.IdempotencyHeader != "" {
+		return c.config.IdempotencyHeader
+	}
+	return "Idempotency-Key"
+}
+
+// authenticate accepts a request that carries a valid signature or bearer
+// token, whichever is configured.
+func (c *WebhookChannel) authenticate(r *http.Request, body []byte) bool {
+	if c.config.Secret != "" {
+		sig := strings.TrimPrefix(strings.TrimSpace(r.Header.Get(c.config.SignatureHeader)), "sha256=")
+		if got, err := hex.DecodeString(sig); err == nil && len(got) == sha256.Size {
+			want, _ := hex.DecodeString(sign(c.config.Secret, body))
+			if hmac.Equal(got, want) {
+				return true
+			}
+		}
+	}
+	if c.config.Token != "" {
+		auth := r.Header.Get("Authorization")
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(c.config.Token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// sign returns the hex HMAC-SHA256 of body.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// addWaiter registers a sync request. It returns nil when messageID is
+// empty or already waiting in the chat.
+func (c *WebhookChannel) addWaiter(chatID, messageID string) chan string {
+	if messageID == "" {
+		return nil
+	}
+	key := waiterKey{chatID, messageID}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.waiters[key]; ok {
+		return nil
+	}
+	ch := make(chan string, 1)
+	c.waiters[key] = ch
+	return ch
+}
+
+// takeWaiter removes and returns the sync request messageID in chatID.
+func (c *WebhookChannel) takeWaiter(chatID, messageID string) chan string {
+	if messageID == "" {
+		return nil
+	}
+	key := waiterKey{chatID, messageID}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := c.waiters[key]
+	delete(c.waiters, key)
+	return ch
+}
+
+// removeWaiter drops a sync request that stopped waiting. It returns false
+// when Send already took it.
+func (c *WebhookChannel) removeWaiter(chatID, messageID string) bool {
+	return c.takeWaiter(chatID, messageID) != nil
+}
+
+// attachment is one entry of the attachments array: either a URL string or
+// an object with "url" or base64 "data", and optional "filename" and
+// "content_type".
+type attachment struct {
+	url, data, filename, contentType string
+}
+
+func (c *WebhookChannel) attachments(doc any) []attachment {
+	if c.mapping.attachments == nil {
+		return nil
+	}
+	v, ok := c.mapping.attachments.lookup(doc)
+	if !ok {
+		return nil
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	var out []attachment
+	for _, item := range items {
+		switch item := item.(type) {
+		case string:
+			out = append(out, attachment{url: item})
+		case map[string]any:
+			att := attachment{
+				url:         stringField(item, "url"),
+				data:        stringField(item, "data"),
+				filename:    stringField(item, "filename", "name"),
+				contentType: stringField(item, "content_type", "mime_type"),
+			}
+			if att.url != "" || att.data != "" {
+				out = append(out, att)
+			}
+		}
+	}
+	return out
+}
+
+func stringField(obj map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := obj[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// storeAttachment saves an attachment in the media store and returns its
+// ref ("" on failure) and the label to add to the message.
+func (c *WebhookChannel) storeAttachment(ctx context.Context, att attachment, scope string) (string, string) {
+	filename := att.filename
+	if filename == "" && att.url != "" {
+		if u, err := url.Parse(att.url); err == nil {
+			filename = path.Base(u.Path)
+		}
+	}
+	if filename == "" || filename == "." || filename == "/" {
+		filename = "attachment"
+	}
+	label := fmt.Sprintf("[%s: %s]", mediaKind(att.contentType), filename)
+
+	store := c.GetMediaStore()
+	if store == nil {
+		return "", label
+	}
+
+	var data []byte
+	var err error
+	if att.data != "" {
+		data, err = base64.StdEncoding.DecodeString(att.data)
+		if err == nil && len(data) > maxAttachmentSize {
+			err = fmt.Errorf("attachment too large")
+		}
+	} else {
+		data, att.contentType, err = c.download(ctx, att.url, att.contentType)
+	}
+	if err != nil {
+		logger.WarnCF("webhook", "Failed to fetch attachment", map[string]any{
+			"filename": filename,
+			"error":    err.Error(),
+		})
+		return "", label
+	}
+	if att.contentType == "" {
+		att.contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if att.contentType == "" {
+		att.contentType = http.DetectContentType(data)
+	}
+	label = fmt.Sprintf("[%s: %s]", mediaKind(att.contentType), filename)
+
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		return "", label
+	}
+	f, err := os.CreateTemp(mediaDir, "webhook-*-"+utils.SanitizeFilename(filename))
+	if err != nil {
+		return "", label
+	}
+	localPath := f.Name()
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(localPath)
+		return "", label
+	}
+
+	ref, err := store.Store(localPath, media.MediaMeta{
+		Filename:    filename,
+		ContentType: att.contentType,
+		Source:      "webhook",
+	}, scope)
+	if err != nil {
+		os.Remove(localPath)
+		return "", label
+	}
+	return ref, label
+}
+
+// download fetches an http(s) attachment URL.
+func (c *WebhookChannel) download(ctx context.Context, rawURL, contentType string) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, "", fmt.Errorf("unsupported attachment URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAttachmentSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxAttachmentSize {
+		return nil, "", errors.New("attachment too large")
+	}
+	if contentType == "" {
+		contentType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	}
+	return data, contentType, nil
+}
+
+func mediaKind(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return "image"
+	case strings.HasPrefix(contentType, "audio/"):
+		return "audio"
+	case strings.HasPrefix(contentType, "video/"):
+		return "video"
+	default:
+		return "file"
+	}
+}
+
+func appendLine(content, line string) string {
+	if content == "" {
+		return line
+	}
+	return content + "\n" + line
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// idempotencyCache remembers the most recent idempotency keys in a ring
+// buffer, so retries of a request are ignored without unbounded growth.
+type idempotencyCache struct {
+	mu   sync.Mutex
+	keys map[string]bool
+	ring []string
+	idx  int
+}
+
+func newIdempotencyCache(size int) *idempotencyCache {
+	return &idempotencyCache{
+		keys: make(map[string]bool, size),
+		ring: make([]string, size),
+	}
+}
+
+// add records key and reports whether it is new.
+func (d *idempotencyCache) add(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.keys[key] {
+		return false
+	}
+	if old := d.ring[d.idx]; old != "" {
+		delete(d.keys, old)
+	}
+	d.keys[key] = true
+	d.ring[d.idx] = key
+	d.idx = (d.idx + 1) % len(d.ring)
+	return true
+}
+
+// remove forgets key, so a request rejected as invalid can be retried once
+// fixed. The ring slot is reclaimed when it comes around again.
+func (d *idempotencyCache) remove(key string) {
+	if key == "" {
+		return
+	}
+	d.mu.Lock()
+	delete(d.keys, key)
+	d.mu.Unlock()
+}
@@ -0,0 +1,433 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/bus/bustest"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/media"
+)
+
+const (
+	secret = "shh"
+	token  = "tok"
+)
+
+func newTestChannel(t *testing.T, cfg config.WebhookConfig) (*WebhookChannel, *bus.MessageBus) {
+	t.Helper()
+	mb := bus.NewMessageBus()
+	ch, err := NewWebhookChannel(cfg, mb)
+	if err != nil {
+		t.Fatalf("NewWebhookChannel() error = %v", err)
+	}
+	ch.SetMediaStore(media.NewFileMediaStore())
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { ch.Stop(context.Background()) })
+	return ch, mb
+}
+
+func signedRequest(body string, header http.Header) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhook/generic", strings.NewReader(body))
+	req.Header.Set("X-Signature-256", "sha256="+sign(secret, []byte(body)))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return req
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	var out map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("response %q: %v", rec.Body.String(), err)
+	}
+	return out
+}
+
+func TestNewWebhookChannel_Validation(t *testing.T) {
+	mb := bus.NewMessageBus()
+	tests := []struct {
+		name string
+		cfg  config.WebhookConfig
+	}{
+		{"no credentials", config.WebhookConfig{}},
+		{"bad reply mode", config.WebhookConfig{Token: token, ReplyMode: "later"}},
+		{"async without callback", config.WebhookConfig{Token: token, ReplyMode: "async"}},
+		{"bad callback", config.WebhookConfig{Token: token, CallbackURL: "ftp://example.com"}},
+		{"bad mapping", config.WebhookConfig{Token: token, Mapping: config.WebhookMappingConfig{Content: "$.items[x]"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWebhookChannel(tt.cfg, mb); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestWebhookChannel_Auth(t *testing.T) {
+	ch, _ := newTestChannel(t, config.WebhookConfig{Secret: secret, Token: token, ReplyMode: "async", CallbackURL: "http://127.0.0.1:1/cb"})
+	body := `{"chat_id":"c1","text":"hi"}`
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		want int
+	}{
+		{"signature", func() *http.Request { return signedRequest(body, nil) }, http.StatusAccepted},
+		{"bare hex signature", func() *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header.Set("X-Signature-256", sign(secret, []byte(body)))
+			return req
+		}, http.StatusAccepted},
+		{"bearer", func() *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			return req
+		}, http.StatusAccepted},
+		{"tampered body", func() *http.Request {
+			req := signedRequest(body, nil)
+			req.Body = io.NopCloser(strings.NewReader(`{"chat_id":"c1","text":"bye"}`))
+			return req
+		}, http.StatusUnauthorized},
+		{"wrong token", func() *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer nope")
+			return req
+		}, http.StatusUnauthorized},
+		{"no credentials", func() *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		}, http.StatusUnauthorized},
+		{"GET", func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/", nil)
+		}, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ch.ServeHTTP(rec, tt.req())
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookChannel_SyncReply(t *testing.T) {
+	ch, mb := newTestChannel(t, config.WebhookConfig{
+		Secret: secret,
+		Mapping: config.WebhookMappingConfig{
+			Sender:     "$.user.login",
+			SenderName: "user['display name']",
+			ChatID:     "$.ticket.id",
+			Content:    "$.events[0].comment",
+			MessageID:  "$.delivery",
+		},
+	})
+	body := `{"delivery":"d1","user":{"login":"alice","display name":"Alice"},"ticket":{"id":42},"events":[{"comment":"server down"}]}`
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		ch.ServeHTTP(rec, signedRequest(body, nil))
+		done <- rec
+	}()
+
+	msg := bustest.Consume(t, mb)
+	if msg.ChatID != "42" || msg.Sender.PlatformID != "alice" || msg.Content != "server down" || msg.MessageID != "d1" {
+		t.Fatalf("unexpected inbound message: %+v", msg)
+	}
+	if msg.Sender.DisplayName != "Alice" || msg.Sender.CanonicalID != "webhook:alice" {
+		t.Fatalf("unexpected sender: %+v", msg.Sender)
+	}
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "42", Content: "restarting it", ReplyTo: "d1"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	rec := <-done
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := decode(t, rec); got["reply"] != "restarting it" || got["chat_id"] != "42" {
+		t.Fatalf("response = %v", got)
+	}
+}
+
+func TestWebhookChannel_SyncReplySkipsProgress(t *testing.T) {
+	callbacks := make(chan callbackPayload, 2)
+	cb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p callbackPayload
+		json.NewDecoder(r.Body).Decode(&p)
+		callbacks <- p
+	}))
+	t.Cleanup(cb.Close)
+	ch, mb := newTestChannel(t, config.WebhookConfig{Token: token, CallbackURL: cb.URL})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"chat_id":"c1","text":"deploy"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		ch.ServeHTTP(rec, req)
+		done <- rec
+	}()
+	msg := bustest.Consume(t, mb)
+	if msg.MessageID == "" {
+		t.Fatal("sync request without a message ID cannot be matched to its answer")
+	}
+
+	// Tool output and notices carry no ReplyTo and must not answer the request.
+	ctx := context.Background()
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "c1", Content: "running build..."}); err != nil {
+		t.Fatalf("Send(progress) error = %v", err)
+	}
+	if p := <-callbacks; p.Text != "running build..." {
+		t.Fatalf("callback = %+v, want the progress message", p)
+	}
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "c1", Content: "deployed", ReplyTo: msg.MessageID}); err != nil {
+		t.Fatalf("Send(answer) error = %v", err)
+	}
+
+	rec := <-done
+	if got := decode(t, rec); rec.Code != http.StatusOK || got["reply"] != "deployed" {
+		t.Fatalf("response = %d %v, want the final answer", rec.Code, got)
+	}
+	select {
+	case p := <-callbacks:
+		t.Fatalf("final answer also sent to callback: %+v", p)
+	default:
+	}
+}
+
+func TestWebhookChannel_SyncTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		callback string
+		want     int
+	}{
+		{"no callback", "", http.StatusGatewayTimeout},
+		{"callback", "http://127.0.0.1:1/cb", http.StatusAccepted},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, mb := newTestChannel(t, config.WebhookConfig{Token: token, CallbackURL: tt.callback})
+			ch.timeout = 50 * time.Millisecond
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"chat_id":"c1","text":"hi"}`))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			ch.ServeHTTP(rec, req)
+			bustest.Consume(t, mb)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			ch.mu.Lock()
+			n := len(ch.waiters)
+			ch.mu.Unlock()
+			if n != 0 {
+				t.Fatalf("waiters left behind: %d", n)
+			}
+		})
+	}
+}
+
+func TestWebhookChannel_AsyncCallback(t *testing.T) {
+	got := make(chan *http.Request, 1)
+	gotBody := make(chan []byte, 1)
+	cb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- r
+		gotBody <- body
+	}))
+	defer cb.Close()
+
+	ch, mb := newTestChannel(t, config.WebhookConfig{
+		Secret:      secret,
+		Token:       token,
+		ReplyMode:   "async",
+		CallbackURL: cb.URL,
+		Mapping:     config.WebhookMappingConfig{MessageID: "$.id"},
+	})
+
+	rec := httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedRequest(`{"id":"m7","sender":{"id":"bob"},"text":"status?"}`, nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	msg := bustest.Consume(t, mb)
+	if msg.ChatID != "bob" {
+		t.Fatalf("chat ID should fall back to sender, got %q", msg.ChatID)
+	}
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "bob", Content: "all green"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	req, body := <-got, <-gotBody
+	if req.Header.Get("X-Signature-256") != "sha256="+sign(secret, body) {
+		t.Fatal("callback is not signed")
+	}
+	if req.Header.Get("Authorization") != "Bearer "+token {
+		t.Fatal("callback is missing the bearer token")
+	}
+	var payload callbackPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload != (callbackPayload{ChatID: "bob", Text: "all green", ReplyTo: "m7"}) {
+		t.Fatalf("payload = %+v", payload)
+	}
+}
+
+func TestWebhookChannel_CallbackErrors(t *testing.T) {
+	status := http.StatusBadRequest
+	cb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer cb.Close()
+	ch, _ := newTestChannel(t, config.WebhookConfig{Token: token, ReplyMode: "async", CallbackURL: cb.URL})
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "c", Content: "x"}); !errors.Is(err, channels.ErrSendFailed) {
+		t.Fatalf("400: err = %v, want ErrSendFailed", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "c", Content: "x"}); !errors.Is(err, channels.ErrTemporary) {
+		t.Fatalf("503: err = %v, want ErrTemporary", err)
+	}
+
+	ch.Stop(context.Background())
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "c", Content: "x"}); err != channels.ErrNotRunning {
+		t.Fatalf("stopped: err = %v, want ErrNotRunning", err)
+	}
+}
+
+func TestWebhookChannel_Idempotency(t *testing.T) {
+	ch, mb := newTestChannel(t, config.WebhookConfig{Secret: secret, ReplyMode: "async", CallbackURL: "http://127.0.0.1:1/cb"})
+	body := `{"chat_id":"c1","text":"deploy"}`
+	key := http.Header{"Idempotency-Key": {"abc"}}
+
+	rec := httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedRequest(body, key))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("first: status = %d", rec.Code)
+	}
+	bustest.Consume(t, mb)
+
+	rec = httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedRequest(body, key))
+	if rec.Code != http.StatusOK || decode(t, rec)["status"] != "duplicate" {
+		t.Fatalf("retry: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	bustest.NoInbound(t, mb, 100*time.Millisecond)
+
+	// An invalid request doesn't burn its key.
+	rec = httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedRequest(`{"chat_id":"c1"}`, http.Header{"Idempotency-Key": {"def"}}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid: status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedRequest(body, http.Header{"Idempotency-Key": {"def"}}))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("fixed retry: status = %d", rec.Code)
+	}
+}
+
+func TestWebhookChannel_AllowList(t *testing.T) {
+	ch, _ := newTestChannel(t, config.WebhookConfig{
+		Secret:      secret,
+		ReplyMode:   "async",
+		CallbackURL: "http://127.0.0.1:1/cb",
+		AllowFrom:   config.FlexibleStringSlice{"alice"},
+	})
+	rec := httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedRequest(`{"sender":{"id":"mallory"},"text":"hi"}`, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+}
+
+func TestWebhookChannel_Attachments(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG fake"))
+	}))
+	defer files.Close()
+
+	ch, mb := newTestChannel(t, config.WebhookConfig{
+		Secret:      secret,
+		ReplyMode:   "async",
+		CallbackURL: "http://127.0.0.1:1/cb",
+		Mapping:     config.WebhookMappingConfig{Attachments: "$.attachments"},
+	})
+	body := `{"chat_id":"c1","attachments":["` + files.URL + `/shot.png",{"data":"aGVsbG8=","filename":"note.txt"},{"url":"file:///etc/passwd"}]}`
+
+	rec := httptest.NewRecorder()
+	ch.ServeHTTP(rec, signedRequest(body, nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	msg := bustest.Consume(t, mb)
+	if len(msg.Media) != 2 {
+		t.Fatalf("media refs = %v, want 2", msg.Media)
+	}
+	for _, want := range []string{"[image: shot.png]", "[file: note.txt]", "[file: passwd]"} {
+		if !strings.Contains(msg.Content, want) {
+			t.Fatalf("content %q missing %q", msg.Content, want)
+		}
+	}
+
+	_, meta, err := ch.GetMediaStore().ResolveWithMeta(msg.Media[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Filename != "note.txt" || meta.Source != "webhook" {
+		t.Fatalf("meta = %+v", meta)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	doc := map[string]any{
+		"a":   map[string]any{"b": []any{"x", map[string]any{"c d": json.Number("3")}}},
+		"ok":  true,
+		"nil": nil,
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$.a.b[0]", "x"},
+		{"a.b[1]['c d']", "3"},
+		{`$["ok"]`, "true"},
+		{"$.a.b[5]", ""},
+		{"$.a", ""},
+		{"$.nil", ""},
+		{"$.missing.x", ""},
+	}
+	for _, tt := range tests {
+		p, err := parsePath(tt.expr)
+		if err != nil {
+			t.Fatalf("parsePath(%q) error = %v", tt.expr, err)
+		}
+		if got := p.lookupString(doc); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"$..a", "$.a[", "$.a[-1]", "$.a[b]"} {
+		if _, err := parsePath(bad); err == nil {
+			t.Errorf("parsePath(%q) should fail", bad)
+		}
+	}
+}
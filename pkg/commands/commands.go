@@ -0,0 +1,104 @@
+// Package commands describes the chat commands handled by the agent loop, so
+// channels can offer them natively, e.g. as Discord slash commands.
+package commands
+
+import "strings"
+
+// CompleteModel marks an argument whose values are model names.
+const CompleteModel = "model"
+
+// Arg is one argument of a command.
+type Arg struct {
+	Name        string
+	Description string
+	Required    bool
+	Choices     []string // fixed values, if any
+	Complete    string   // dynamic value source, e.g. CompleteModel
+}
+
+// Command is a chat command. Usage is the text form the agent loop parses,
+// with "{name}" standing for each argument.
+type Command struct {
+	Name        string // without the leading slash
+	Description string
+	Usage       string
+	Args        []Arg
+}
+
+// Format renders an invocation in the text form, leaving out optional
+// arguments that have no value.
+func (c Command) Format(values map[string]string) string {
+	out := c.Usage
+	for _, a := range c.Args {
+		out = strings.ReplaceAll(out, "{"+a.Name+"}", strings.TrimSpace(values[a.Name]))
+	}
+	return strings.Join(strings.Fields(out), " ")
+}
+
+// Find returns the command with the given name, with or without the slash.
+func Find(name string) (Command, bool) {
+	name = strings.TrimPrefix(name, "/")
+	for _, c := range Builtin {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Command{}, false
+}
+
+// Builtin lists the commands AgentLoop.handleCommand understands.
+var Builtin = []Command{
+	{
+		Name:        "show",
+		Description: "Show the current model, channel or agents",
+		Usage:       "/show {target}",
+		Args: []Arg{
+			{Name: "target", Description: "What to show", Required: true, Choices: []string{"model", "channel", "agents"}},
+		},
+	},
+	{
+		Name:        "list",
+		Description: "List available models, channels or agents",
+		Usage:       "/list {target}",
+		Args: []Arg{
+			{Name: "target", Description: "What to list", Required: true, Choices: []string{"models", "channels", "agents"}},
+		},
+	},
+	{
+		Name:        "switch",
+		Description: "Switch the default agent's model or the target channel",
+		Usage:       "/switch {target} to {value}",
+		Args: []Arg{
+			{Name: "target", Description: "What to switch", Required: true, Choices: []string{"model", "channel"}},
+			{Name: "value", Description: "Model or channel name", Required: true, Complete: CompleteModel},
+		},
+	},
+	{Name: "new", Description: "Start a new session, saving the current one", Usage: "/new"},
+	{Name: "reset", Description: "Clear the current session", Usage: "/reset"},
+	{Name: "sessions", Description: "List saved sessions", Usage: "/sessions"},
+	{
+		Name:        "resume",
+		Description: "Resume a saved session",
+		Usage:       "/resume {id}",
+		Args:        []Arg{{Name: "id", Description: "Session ID from /sessions", Required: true}},
+	},
+	{
+		Name:        "rename",
+		Description: "Rename the current session",
+		Usage:       "/rename {title}",
+		Args:        []Arg{{Name: "title", Description: "New title", Required: true}},
+	},
+	{Name: "compact", Description: "Summarize older messages to free up context", Usage: "/compact"},
+	{
+		Name:        "history",
+		Description: "Show recent messages of the session",
+		Usage:       "/history {count}",
+		Args:        []Arg{{Name: "count", Description: "Number of messages"}},
+	},
+	{
+		Name:        "export",
+		Description: "Export the session as a file",
+		Usage:       "/export {format}",
+		Args:        []Arg{{Name: "format", Description: "File format", Choices: []string{"markdown", "html", "json"}}},
+	},
+}
@@ -0,0 +1,18 @@
+package commands
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	sw, ok := Find("/switch")
+	if !ok {
+		t.Fatal("switch not found")
+	}
+	if got := sw.Format(map[string]string{"target": "model", "value": " gpt-4o "}); got != "/switch model to gpt-4o" {
+		t.Fatalf("Format() = %q", got)
+	}
+
+	history, _ := Find("history")
+	if got := history.Format(nil); got != "/history" {
+		t.Fatalf("Format() without optional arg = %q", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 
 	"github.com/caarlos0/env/v11"
@@ -58,6 +59,16 @@ type Config struct {
 	Tools     ToolsConfig     `json:"tools"`
 	Heartbeat HeartbeatConfig `json:"heartbeat"`
 	Devices   DevicesConfig   `json:"devices"`
+	Redaction RedactionConfig `json:"redaction"`
+
+	// secretRefs remembers the references resolved by LoadConfig, keyed by
+	// JSON path, so SaveConfig never writes resolved secrets to disk.
+	secretRefs map[string]secretRef
+
+	// files and layers record where a layered config was loaded from; see
+	// ResolveLayers.
+	files  []string
+	layers *layerState
 }
 
 // MarshalJSON implements custom JSON marshaling for Config
@@ -137,6 +148,30 @@ type AgentConfig struct {
 	Model     *AgentModelConfig `json:"model,omitempty"`
 	Skills    []string          `json:"skills,omitempty"`
 	Subagents *SubagentsConfig  `json:"subagents,omitempty"`
+	Isolation *IsolationConfig  `json:"isolation,omitempty"`
+}
+
+const (
+	IsolationModeShared = "shared"
+	IsolationModePeer   = "peer"
+)
+
+// IsolationConfig controls whether everyone talking to an agent shares its
+// memory and workspace, or whether each session peer gets its own.
+type IsolationConfig struct {
+	// Mode is "shared" (default) or "peer". In "peer" mode memory and a
+	// scratch directory are kept under workspace/peers/<peer>/, where the
+	// peer is derived from the session key (honoring session.dm_scope and
+	// session.identity_links).
+	Mode string `json:"mode,omitempty"`
+	// Shared additionally exposes workspace/shared/ (and its MEMORY.md) to
+	// every peer. Only meaningful in "peer" mode.
+	Shared bool `json:"shared,omitempty"`
+}
+
+// PerPeer reports whether per-peer isolation is enabled.
+func (c *IsolationConfig) PerPeer() bool {
+	return c != nil && c.Mode == IsolationModePeer
 }
 
 type SubagentsConfig struct {
@@ -218,6 +253,13 @@ type ChannelsConfig struct {
 	WeComApp   WeComAppConfig   `json:"wecom_app"`
 	WeComAIBot WeComAIBotConfig `json:"wecom_aibot"`
 	Pico       PicoConfig       `json:"pico"`
+	Email      EmailConfig      `json:"email"`
+	Matrix     MatrixConfig     `json:"matrix"`
+	Signal     SignalConfig     `json:"signal"`
+	IRC        IRCConfig        `json:"irc"`
+	Mattermost MattermostConfig `json:"mattermost"`
+	MQTT       MQTTConfig       `json:"mqtt"`
+	Webhook    WebhookConfig    `json:"webhook"`
 }
 
 // GroupTriggerConfig controls when the bot responds in group chats.
@@ -251,6 +293,9 @@ type TelegramConfig struct {
 	Token              string              `json:"token"                   env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
 	BaseURL            string              `json:"base_url"                env:"PICOCLAW_CHANNELS_TELEGRAM_BASE_URL"`
 	Proxy              string              `json:"proxy"                   env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
+	WebhookURL         string              `json:"webhook_url"             env:"PICOCLAW_CHANNELS_TELEGRAM_WEBHOOK_URL"`    // public URL; enables webhook mode
+	WebhookPath        string              `json:"webhook_path"            env:"PICOCLAW_CHANNELS_TELEGRAM_WEBHOOK_PATH"`   // path on the gateway server
+	WebhookSecret      string              `json:"webhook_secret"          env:"PICOCLAW_CHANNELS_TELEGRAM_WEBHOOK_SECRET"` // defaults to one derived from the token
 	AllowFrom          FlexibleStringSlice `json:"allow_from"              env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
 	GroupTrigger       GroupTriggerConfig  `json:"group_trigger,omitempty"`
 	Typing             TypingConfig        `json:"typing,omitempty"`
@@ -271,15 +316,17 @@ type FeishuConfig struct {
 }
 
 type DiscordConfig struct {
-	Enabled            bool                `json:"enabled"                 env:"PICOCLAW_CHANNELS_DISCORD_ENABLED"`
-	Token              string              `json:"token"                   env:"PICOCLAW_CHANNELS_DISCORD_TOKEN"`
-	Proxy              string              `json:"proxy"                   env:"PICOCLAW_CHANNELS_DISCORD_PROXY"`
-	AllowFrom          FlexibleStringSlice `json:"allow_from"              env:"PICOCLAW_CHANNELS_DISCORD_ALLOW_FROM"`
-	MentionOnly        bool                `json:"mention_only"            env:"PICOCLAW_CHANNELS_DISCORD_MENTION_ONLY"`
-	GroupTrigger       GroupTriggerConfig  `json:"group_trigger,omitempty"`
-	Typing             TypingConfig        `json:"typing,omitempty"`
-	Placeholder        PlaceholderConfig   `json:"placeholder,omitempty"`
-	ReasoningChannelID string              `json:"reasoning_channel_id"    env:"PICOCLAW_CHANNELS_DISCORD_REASONING_CHANNEL_ID"`
+	Enabled               bool                `json:"enabled"                 env:"PICOCLAW_CHANNELS_DISCORD_ENABLED"`
+	Token                 string              `json:"token"                   env:"PICOCLAW_CHANNELS_DISCORD_TOKEN"`
+	Proxy                 string              `json:"proxy"                   env:"PICOCLAW_CHANNELS_DISCORD_PROXY"`
+	AllowFrom             FlexibleStringSlice `json:"allow_from"              env:"PICOCLAW_CHANNELS_DISCORD_ALLOW_FROM"`
+	MentionOnly           bool                `json:"mention_only"            env:"PICOCLAW_CHANNELS_DISCORD_MENTION_ONLY"`
+	ThreadPerConversation bool                `json:"thread_per_conversation" env:"PICOCLAW_CHANNELS_DISCORD_THREAD_PER_CONVERSATION"` // one thread per conversation in guild channels
+	SlashCommands         bool                `json:"slash_commands"          env:"PICOCLAW_CHANNELS_DISCORD_SLASH_COMMANDS"`          // register chat commands as slash commands
+	GroupTrigger          GroupTriggerConfig  `json:"group_trigger,omitempty"`
+	Typing                TypingConfig        `json:"typing,omitempty"`
+	Placeholder           PlaceholderConfig   `json:"placeholder,omitempty"`
+	ReasoningChannelID    string              `json:"reasoning_channel_id"    env:"PICOCLAW_CHANNELS_DISCORD_REASONING_CHANNEL_ID"`
 }
 
 type MaixCamConfig struct {
@@ -389,16 +436,171 @@ type WeComAIBotConfig struct {
 }
 
 type PicoConfig struct {
-	Enabled         bool                `json:"enabled"                     env:"PICOCLAW_CHANNELS_PICO_ENABLED"`
-	Token           string              `json:"token"                       env:"PICOCLAW_CHANNELS_PICO_TOKEN"`
-	AllowTokenQuery bool                `json:"allow_token_query,omitempty"`
-	AllowOrigins    []string            `json:"allow_origins,omitempty"`
-	PingInterval    int                 `json:"ping_interval,omitempty"`
-	ReadTimeout     int                 `json:"read_timeout,omitempty"`
-	WriteTimeout    int                 `json:"write_timeout,omitempty"`
-	MaxConnections  int                 `json:"max_connections,omitempty"`
-	AllowFrom       FlexibleStringSlice `json:"allow_from"                  env:"PICOCLAW_CHANNELS_PICO_ALLOW_FROM"`
-	Placeholder     PlaceholderConfig   `json:"placeholder,omitempty"`
+	Enabled          bool                `json:"enabled"                     env:"PICOCLAW_CHANNELS_PICO_ENABLED"`
+	Token            string              `json:"token"                       env:"PICOCLAW_CHANNELS_PICO_TOKEN"`
+	AllowTokenQuery  bool                `json:"allow_token_query,omitempty"`
+	AllowOrigins     []string            `json:"allow_origins,omitempty"`
+	PingInterval     int                 `json:"ping_interval,omitempty"`
+	ReadTimeout      int                 `json:"read_timeout,omitempty"`
+	WriteTimeout     int                 `json:"write_timeout,omitempty"`
+	MaxConnections   int                 `json:"max_connections,omitempty"`
+	MaxMediaSize     int                 `json:"max_media_size,omitempty"`     // bytes per media.send upload
+	ReplayBufferSize int                 `json:"replay_buffer_size,omitempty"` // unacked frames kept per session
+	HistorySize      int                 `json:"history_size,omitempty"`       // messages returned by history.get
+	AllowFrom        FlexibleStringSlice `json:"allow_from"                  env:"PICOCLAW_CHANNELS_PICO_ALLOW_FROM"`
+	Placeholder      PlaceholderConfig   `json:"placeholder,omitempty"`
+}
+
+// EmailConfig configures the email channel. Incoming mail is read over IMAP
+// and replies are sent over SMTP. The SMTP credentials default to the IMAP
+// ones when left empty.
+type EmailConfig struct {
+	Enabled            bool                `json:"enabled"              env:"PICOCLAW_CHANNELS_EMAIL_ENABLED"`
+	Address            string              `json:"address"              env:"PICOCLAW_CHANNELS_EMAIL_ADDRESS"`
+	DisplayName        string              `json:"display_name"         env:"PICOCLAW_CHANNELS_EMAIL_DISPLAY_NAME"`
+	IMAPHost           string              `json:"imap_host"            env:"PICOCLAW_CHANNELS_EMAIL_IMAP_HOST"`
+	IMAPPort           int                 `json:"imap_port"            env:"PICOCLAW_CHANNELS_EMAIL_IMAP_PORT"`
+	IMAPSecurity       string              `json:"imap_security"        env:"PICOCLAW_CHANNELS_EMAIL_IMAP_SECURITY"` // "tls", "starttls" or "none"
+	Username           string              `json:"username"             env:"PICOCLAW_CHANNELS_EMAIL_USERNAME"`
+	Password           string              `json:"password"             env:"PICOCLAW_CHANNELS_EMAIL_PASSWORD"`
+	Folders            FlexibleStringSlice `json:"folders"              env:"PICOCLAW_CHANNELS_EMAIL_FOLDERS"`
+	SMTPHost           string              `json:"smtp_host"            env:"PICOCLAW_CHANNELS_EMAIL_SMTP_HOST"`
+	SMTPPort           int                 `json:"smtp_port"            env:"PICOCLAW_CHANNELS_EMAIL_SMTP_PORT"`
+	SMTPSecurity       string              `json:"smtp_security"        env:"PICOCLAW_CHANNELS_EMAIL_SMTP_SECURITY"` // "tls", "starttls" or "none"
+	SMTPUsername       string              `json:"smtp_username"        env:"PICOCLAW_CHANNELS_EMAIL_SMTP_USERNAME"`
+	SMTPPassword       string              `json:"smtp_password"        env:"PICOCLAW_CHANNELS_EMAIL_SMTP_PASSWORD"`
+	PollInterval       int                 `json:"poll_interval"        env:"PICOCLAW_CHANNELS_EMAIL_POLL_INTERVAL"` // seconds; used when the server lacks IDLE
+	MaxAttachmentMB    int                 `json:"max_attachment_mb"    env:"PICOCLAW_CHANNELS_EMAIL_MAX_ATTACHMENT_MB"`
+	AllowFrom          FlexibleStringSlice `json:"allow_from"           env:"PICOCLAW_CHANNELS_EMAIL_ALLOW_FROM"`
+	ReasoningChannelID string              `json:"reasoning_channel_id" env:"PICOCLAW_CHANNELS_EMAIL_REASONING_CHANNEL_ID"`
+}
+
+// MatrixConfig configures the Matrix channel. StorePath holds the sync
+// token so restarts resume where they left off; it defaults to
+// <workspace>/matrix.
+type MatrixConfig struct {
+	Enabled            bool                `json:"enabled"                 env:"PICOCLAW_CHANNELS_MATRIX_ENABLED"`
+	Homeserver         string              `json:"homeserver"              env:"PICOCLAW_CHANNELS_MATRIX_HOMESERVER"`
+	UserID             string              `json:"user_id"                 env:"PICOCLAW_CHANNELS_MATRIX_USER_ID"`
+	AccessToken        string              `json:"access_token"            env:"PICOCLAW_CHANNELS_MATRIX_ACCESS_TOKEN"`
+	StorePath          string              `json:"store_path"              env:"PICOCLAW_CHANNELS_MATRIX_STORE_PATH"`
+	AutoJoin           bool                `json:"auto_join"               env:"PICOCLAW_CHANNELS_MATRIX_AUTO_JOIN"`
+	SyncTimeout        int                 `json:"sync_timeout"            env:"PICOCLAW_CHANNELS_MATRIX_SYNC_TIMEOUT"` // seconds
+	AllowFrom          FlexibleStringSlice `json:"allow_from"              env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_FROM"`
+	GroupTrigger       GroupTriggerConfig  `json:"group_trigger,omitempty"`
+	Placeholder        PlaceholderConfig   `json:"placeholder,omitempty"`
+	ReasoningChannelID string              `json:"reasoning_channel_id"    env:"PICOCLAW_CHANNELS_MATRIX_REASONING_CHANNEL_ID"`
+}
+
+// SignalConfig configures the Signal channel, which talks to a signal-cli
+// daemon. Endpoint is the daemon's HTTP address (signal-cli daemon --http)
+// or its JSON-RPC socket as unix:///path or tcp://host:port.
+type SignalConfig struct {
+	Enabled            bool                `json:"enabled"              env:"PICOCLAW_CHANNELS_SIGNAL_ENABLED"`
+	Account            string              `json:"account"              env:"PICOCLAW_CHANNELS_SIGNAL_ACCOUNT"` // bot phone number, e.g. "+15551234567"
+	Endpoint           string              `json:"endpoint"             env:"PICOCLAW_CHANNELS_SIGNAL_ENDPOINT"`
+	AllowFrom          FlexibleStringSlice `json:"allow_from"           env:"PICOCLAW_CHANNELS_SIGNAL_ALLOW_FROM"`
+	GroupTrigger       GroupTriggerConfig  `json:"group_trigger,omitempty"`
+	ReasoningChannelID string              `json:"reasoning_channel_id" env:"PICOCLAW_CHANNELS_SIGNAL_REASONING_CHANNEL_ID"`
+}
+
+// IRCConfig configures the IRC channel. SASLMechanism is "PLAIN" (with
+// SASLUsername/SASLPassword) or "EXTERNAL" (with the TLS client certificate);
+// NickServPassword identifies with NickServ when SASL is unavailable.
+// Channels entries are "#channel" or "#channel key". After FloodBurst lines,
+// one line is sent every FloodDelay milliseconds.
+type IRCConfig struct {
+	Enabled            bool                `json:"enabled"              env:"PICOCLAW_CHANNELS_IRC_ENABLED"`
+	Server             string              `json:"server"               env:"PICOCLAW_CHANNELS_IRC_SERVER"` // host:port
+	TLS                bool                `json:"tls"                  env:"PICOCLAW_CHANNELS_IRC_TLS"`
+	TLSCertFile        string              `json:"tls_cert_file"        env:"PICOCLAW_CHANNELS_IRC_TLS_CERT_FILE"`
+	TLSKeyFile         string              `json:"tls_key_file"         env:"PICOCLAW_CHANNELS_IRC_TLS_KEY_FILE"`
+	Password           string              `json:"password"             env:"PICOCLAW_CHANNELS_IRC_PASSWORD"`
+	Nick               string              `json:"nick"                 env:"PICOCLAW_CHANNELS_IRC_NICK"`
+	Username           string              `json:"username"             env:"PICOCLAW_CHANNELS_IRC_USERNAME"`
+	RealName           string              `json:"real_name"            env:"PICOCLAW_CHANNELS_IRC_REAL_NAME"`
+	SASLMechanism      string              `json:"sasl_mechanism"       env:"PICOCLAW_CHANNELS_IRC_SASL_MECHANISM"`
+	SASLUsername       string              `json:"sasl_username"        env:"PICOCLAW_CHANNELS_IRC_SASL_USERNAME"`
+	SASLPassword       string              `json:"sasl_password"        env:"PICOCLAW_CHANNELS_IRC_SASL_PASSWORD"`
+	NickServPassword   string              `json:"nickserv_password"    env:"PICOCLAW_CHANNELS_IRC_NICKSERV_PASSWORD"`
+	Channels           FlexibleStringSlice `json:"channels"             env:"PICOCLAW_CHANNELS_IRC_CHANNELS"`
+	FloodBurst         int                 `json:"flood_burst"          env:"PICOCLAW_CHANNELS_IRC_FLOOD_BURST"`
+	FloodDelay         int                 `json:"flood_delay"          env:"PICOCLAW_CHANNELS_IRC_FLOOD_DELAY"` // milliseconds
+	AllowFrom          FlexibleStringSlice `json:"allow_from"           env:"PICOCLAW_CHANNELS_IRC_ALLOW_FROM"`
+	GroupTrigger       GroupTriggerConfig  `json:"group_trigger,omitempty"`
+	ReasoningChannelID string              `json:"reasoning_channel_id" env:"PICOCLAW_CHANNELS_IRC_REASONING_CHANNEL_ID"`
+}
+
+// MattermostConfig configures the Mattermost channel. Token is a personal
+// access token of a bot account. CommandTokens are the tokens of the slash
+// commands pointed at WebhookPath on the gateway server; requests with any
+// other token are rejected.
+type MattermostConfig struct {
+	Enabled            bool                `json:"enabled"              env:"PICOCLAW_CHANNELS_MATTERMOST_ENABLED"`
+	ServerURL          string              `json:"server_url"           env:"PICOCLAW_CHANNELS_MATTERMOST_SERVER_URL"`
+	Token              string              `json:"token"                env:"PICOCLAW_CHANNELS_MATTERMOST_TOKEN"`
+	CommandTokens      FlexibleStringSlice `json:"command_tokens"       env:"PICOCLAW_CHANNELS_MATTERMOST_COMMAND_TOKENS"`
+	WebhookPath        string              `json:"webhook_path"         env:"PICOCLAW_CHANNELS_MATTERMOST_WEBHOOK_PATH"`
+	AllowFrom          FlexibleStringSlice `json:"allow_from"           env:"PICOCLAW_CHANNELS_MATTERMOST_ALLOW_FROM"`
+	GroupTrigger       GroupTriggerConfig  `json:"group_trigger,omitempty"`
+	Placeholder        PlaceholderConfig   `json:"placeholder,omitempty"`
+	ReasoningChannelID string              `json:"reasoning_channel_id" env:"PICOCLAW_CHANNELS_MATTERMOST_REASONING_CHANNEL_ID"`
+}
+
+// MQTTConfig configures the MQTT channel. Topics are subscription patterns in
+// which a {chat_id} segment names the chat; without one the whole topic is the
+// chat ID. Replies go to the MQTT v5 response topic of the request when it has
+// one, otherwise to ResponseTopic with {chat_id} filled in. PayloadFormat is
+// "text" or "json". StatusTopic receives a retained "online"/"offline" status,
+// with "offline" also registered as the last will.
+type MQTTConfig struct {
+	Enabled            bool                `json:"enabled"              env:"PICOCLAW_CHANNELS_MQTT_ENABLED"`
+	Broker             string              `json:"broker"               env:"PICOCLAW_CHANNELS_MQTT_BROKER"`
+	ClientID           string              `json:"client_id"            env:"PICOCLAW_CHANNELS_MQTT_CLIENT_ID"`
+	Username           string              `json:"username"             env:"PICOCLAW_CHANNELS_MQTT_USERNAME"`
+	Password           string              `json:"password"             env:"PICOCLAW_CHANNELS_MQTT_PASSWORD"`
+	TLSCAFile          string              `json:"tls_ca_file"          env:"PICOCLAW_CHANNELS_MQTT_TLS_CA_FILE"`
+	TLSCertFile        string              `json:"tls_cert_file"        env:"PICOCLAW_CHANNELS_MQTT_TLS_CERT_FILE"`
+	TLSKeyFile         string              `json:"tls_key_file"         env:"PICOCLAW_CHANNELS_MQTT_TLS_KEY_FILE"`
+	Topics             FlexibleStringSlice `json:"topics"               env:"PICOCLAW_CHANNELS_MQTT_TOPICS"`
+	ResponseTopic      string              `json:"response_topic"       env:"PICOCLAW_CHANNELS_MQTT_RESPONSE_TOPIC"`
+	StatusTopic        string              `json:"status_topic"         env:"PICOCLAW_CHANNELS_MQTT_STATUS_TOPIC"`
+	QoS                int                 `json:"qos"                  env:"PICOCLAW_CHANNELS_MQTT_QOS"`
+	PayloadFormat      string              `json:"payload_format"       env:"PICOCLAW_CHANNELS_MQTT_PAYLOAD_FORMAT"`
+	AllowFrom          FlexibleStringSlice `json:"allow_from"           env:"PICOCLAW_CHANNELS_MQTT_ALLOW_FROM"`
+	ReasoningChannelID string              `json:"reasoning_channel_id" env:"PICOCLAW_CHANNELS_MQTT_REASONING_CHANNEL_ID"`
+}
+
+// WebhookConfig configures the generic webhook channel, which accepts JSON
+// posts on Path of the gateway server. A request must carry either an
+// HMAC-SHA256 signature of the body, keyed by Secret, in SignatureHeader, or
+// Token as a bearer token. ReplyMode "sync" answers in the HTTP response,
+// waiting up to ReplyTimeout seconds; "async" answers with a POST to
+// CallbackURL.
+type WebhookConfig struct {
+	Enabled            bool                 `json:"enabled"              env:"PICOCLAW_CHANNELS_WEBHOOK_ENABLED"`
+	Path               string               `json:"path"                 env:"PICOCLAW_CHANNELS_WEBHOOK_PATH"`
+	Secret             string               `json:"secret"               env:"PICOCLAW_CHANNELS_WEBHOOK_SECRET"`
+	SignatureHeader    string               `json:"signature_header"     env:"PICOCLAW_CHANNELS_WEBHOOK_SIGNATURE_HEADER"`
+	Token              string               `json:"token"                env:"PICOCLAW_CHANNELS_WEBHOOK_TOKEN"`
+	Mapping            WebhookMappingConfig `json:"mapping"`
+	IdempotencyHeader  string               `json:"idempotency_header"   env:"PICOCLAW_CHANNELS_WEBHOOK_IDEMPOTENCY_HEADER"`
+	ReplyMode          string               `json:"reply_mode"           env:"PICOCLAW_CHANNELS_WEBHOOK_REPLY_MODE"`
+	ReplyTimeout       int                  `json:"reply_timeout"        env:"PICOCLAW_CHANNELS_WEBHOOK_REPLY_TIMEOUT"` // seconds
+	CallbackURL        string               `json:"callback_url"         env:"PICOCLAW_CHANNELS_WEBHOOK_CALLBACK_URL"`
+	AllowFrom          FlexibleStringSlice  `json:"allow_from"           env:"PICOCLAW_CHANNELS_WEBHOOK_ALLOW_FROM"`
+	ReasoningChannelID string               `json:"reasoning_channel_id" env:"PICOCLAW_CHANNELS_WEBHOOK_REASONING_CHANNEL_ID"`
+}
+
+// WebhookMappingConfig holds JSONPath-style paths ("$.sender.id",
+// "$.items[0].text") locating the message fields in a webhook body.
+type WebhookMappingConfig struct {
+	Sender      string `json:"sender,omitempty"`
+	SenderName  string `json:"sender_name,omitempty"`
+	ChatID      string `json:"chat_id,omitempty"`
+	Content     string `json:"content,omitempty"`
+	Attachments string `json:"attachments,omitempty"`
+	MessageID   string `json:"message_id,omitempty"`
 }
 
 type HeartbeatConfig struct {
@@ -406,6 +608,17 @@ type HeartbeatConfig struct {
 	Interval int  `json:"interval" env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
 }
 
+// RedactionConfig controls where secrets and personal data are masked.
+// API keys, bearer tokens and the secrets in this config are always detected;
+// PII enables the email and phone number detectors as well.
+type RedactionConfig struct {
+	Enabled     bool `json:"enabled"      env:"PICOCLAW_REDACTION_ENABLED"`
+	Logs        bool `json:"logs"         env:"PICOCLAW_REDACTION_LOGS"`
+	ToolResults bool `json:"tool_results" env:"PICOCLAW_REDACTION_TOOL_RESULTS"`
+	Outbound    bool `json:"outbound"     env:"PICOCLAW_REDACTION_OUTBOUND"`
+	PII         bool `json:"pii"          env:"PICOCLAW_REDACTION_PII"`
+}
+
 type DevicesConfig struct {
 	Enabled    bool `json:"enabled"     env:"PICOCLAW_DEVICES_ENABLED"`
 	MonitorUSB bool `json:"monitor_usb" env:"PICOCLAW_DEVICES_MONITOR_USB"`
@@ -524,6 +737,24 @@ func (c *ModelConfig) Validate() error {
 type GatewayConfig struct {
 	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
 	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	// HotReload applies changes to the config file without restarting.
+	HotReload bool `json:"hot_reload" env:"PICOCLAW_GATEWAY_HOT_RELOAD"`
+	// OpenAIAPI serves the agents as an OpenAI-compatible API.
+	OpenAIAPI OpenAIAPIConfig `json:"openai_api"`
+}
+
+// OpenAIAPIConfig configures the OpenAI-compatible /v1/chat/completions and
+// /v1/models endpoints on the gateway's HTTP server. Each agent is exposed as
+// a model; callers authenticate with one of APIKeys as a bearer token. The
+// SessionHeader request header selects a persistent session.
+type OpenAIAPIConfig struct {
+	Enabled       bool                `json:"enabled"        env:"PICOCLAW_GATEWAY_OPENAI_API_ENABLED"`
+	APIKeys       FlexibleStringSlice `json:"api_keys"       env:"PICOCLAW_GATEWAY_OPENAI_API_API_KEYS"`
+	SessionHeader string              `json:"session_header" env:"PICOCLAW_GATEWAY_OPENAI_API_SESSION_HEADER"`
+	// ToolProgress streams a line per tool call ahead of the answer.
+	ToolProgress bool `json:"tool_progress" env:"PICOCLAW_GATEWAY_OPENAI_API_TOOL_PROGRESS"`
+	// Timeout bounds a request in seconds.
+	Timeout int `json:"timeout" env:"PICOCLAW_GATEWAY_OPENAI_API_TIMEOUT"`
 }
 
 type ToolConfig struct {
@@ -682,35 +913,23 @@ type MCPConfig struct {
 }
 
 func LoadConfig(path string) (*Config, error) {
-	cfg := DefaultConfig()
-
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return cfg, nil
-		}
-		return nil, err
-	}
+	return LoadConfigProfile(path, os.Getenv(ProfileEnv))
+}
 
-	// Pre-scan the JSON to check how many model_list entries the user provided.
-	// Go's JSON decoder reuses existing slice backing-array elements rather than
-	// zero-initializing them, so fields absent from the user's JSON (e.g. api_base)
-	// would silently inherit values from the DefaultConfig template at the same
-	// index position. We only reset cfg.ModelList when the user actually provides
-	// entries; when count is 0 we keep DefaultConfig's built-in list as fallback.
-	var tmp Config
-	if err := json.Unmarshal(data, &tmp); err != nil {
-		return nil, err
-	}
-	if len(tmp.ModelList) > 0 {
-		cfg.ModelList = nil
+// loadLayers decodes merged config layers and applies environment
+// overrides and migrations. Secret references are resolved when
+// resolveSecrets is set and kept as written otherwise.
+func loadLayers(layers *Layers, resolveSecrets bool) (*Config, error) {
+	if layers.Data == nil {
+		return DefaultConfig(), nil
 	}
 
-	if err := json.Unmarshal(data, cfg); err != nil {
+	cfg, err := decodeConfig(layers.Data)
+	if err != nil {
 		return nil, err
 	}
 
-	if err := env.Parse(cfg); err != nil {
+	if err := parseEnv(cfg); err != nil {
 		return nil, err
 	}
 
@@ -722,14 +941,62 @@ func LoadConfig(path string) (*Config, error) {
 		cfg.ModelList = ConvertProvidersToModelList(cfg)
 	}
 
+	// Resolve env:/file:/cmd: references in secret-bearing fields. This runs
+	// after the migration so that references copied into model_list are
+	// tracked, and written back, at their new paths too.
+	if resolveSecrets {
+		cfg.resolveSecretRefs()
+	}
+
 	// Validate model_list for uniqueness and required fields
 	if err := cfg.ValidateModelList(); err != nil {
 		return nil, err
 	}
 
+	cfg.files = layers.Files
+	if len(layers.Files) > 1 || len(layers.Files) == 1 && layers.Files[0] != layers.Base {
+		saved, err := cfg.WithSecretRefs()
+		if err != nil {
+			return nil, err
+		}
+		snapshot, err := toGeneric(saved)
+		if err != nil {
+			return nil, err
+		}
+		cfg.layers = &layerState{base: layers.Base, snapshot: snapshot}
+	}
+
+	return cfg, nil
+}
+
+// decodeConfig decodes config JSON on top of the defaults.
+func decodeConfig(data []byte) (*Config, error) {
+	cfg := DefaultConfig()
+
+	// Pre-scan the JSON to check how many model_list entries the user provided.
+	// Go's JSON decoder reuses existing slice backing-array elements rather than
+	// zero-initializing them, so fields absent from the user's JSON (e.g. api_base)
+	// would silently inherit values from the DefaultConfig template at the same
+	// index position. We only reset cfg.ModelList when the user actually provides
+	// entries; when count is 0 we keep DefaultConfig's built-in list as fallback.
+	var tmp Config
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return nil, err
+	}
+	if len(tmp.ModelList) > 0 {
+		cfg.ModelList = nil
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+func parseEnv(cfg *Config) error {
+	return env.Parse(cfg)
+}
+
 func (c *Config) migrateChannelConfigs() {
 	// Discord: mention_only -> group_trigger.mention_only
 	if c.Channels.Discord.MentionOnly && !c.Channels.Discord.GroupTrigger.MentionOnly {
@@ -743,16 +1010,41 @@ func (c *Config) migrateChannelConfigs() {
 	}
 }
 
+// SaveConfig writes cfg to path. Secrets that were loaded from env:, file: or
+// cmd: references are written back as the reference.
 func SaveConfig(path string, cfg *Config) error {
+	// A layered config only writes its own changes back, to the base file,
+	// so values from includes and overlays are not copied into it.
+	if state := cfg.layers; state != nil && sameFile(state.base, path) {
+		saved, err := cfg.WithSecretRefs()
+		if err != nil {
+			return err
+		}
+		return saveLayered(state, saved)
+	}
+
+	cfg, err := cfg.WithSecretRefs()
+	if err != nil {
+		return err
+	}
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		return err
 	}
+	return writeConfigFile(path, data)
+}
 
+func writeConfigFile(path string, data []byte) error {
 	// Use unified atomic write utility with explicit sync for flash storage reliability.
 	return fileutil.WriteFileAtomic(path, data, 0o600)
 }
 
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
 func (c *Config) WorkspacePath() string {
 	return expandHome(c.Agents.Defaults.Workspace)
 }
@@ -68,10 +68,11 @@ func DefaultConfig() *Config {
 				AllowFrom:         FlexibleStringSlice{},
 			},
 			Discord: DiscordConfig{
-				Enabled:     false,
-				Token:       "",
-				AllowFrom:   FlexibleStringSlice{},
-				MentionOnly: false,
+				Enabled:       false,
+				Token:         "",
+				AllowFrom:     FlexibleStringSlice{},
+				MentionOnly:   false,
+				SlashCommands: true,
 			},
 			MaixCam: MaixCamConfig{
 				Enabled:   false,
@@ -150,13 +151,83 @@ func DefaultConfig() *Config {
 				WelcomeMessage: "Hello! I'm your AI assistant. How can I help you today?",
 			},
 			Pico: PicoConfig{
-				Enabled:        false,
-				Token:          "",
-				PingInterval:   30,
-				ReadTimeout:    60,
-				WriteTimeout:   10,
-				MaxConnections: 100,
-				AllowFrom:      FlexibleStringSlice{},
+				Enabled:          false,
+				Token:            "",
+				PingInterval:     30,
+				ReadTimeout:      60,
+				WriteTimeout:     10,
+				MaxConnections:   100,
+				MaxMediaSize:     10 << 20,
+				ReplayBufferSize: 100,
+				HistorySize:      50,
+				AllowFrom:        FlexibleStringSlice{},
+			},
+			Email: EmailConfig{
+				Enabled:         false,
+				IMAPPort:        993,
+				IMAPSecurity:    "tls",
+				Folders:         FlexibleStringSlice{"INBOX"},
+				SMTPPort:        587,
+				SMTPSecurity:    "starttls",
+				PollInterval:    60,
+				MaxAttachmentMB: 20,
+				AllowFrom:       FlexibleStringSlice{},
+			},
+			Matrix: MatrixConfig{
+				Enabled:     false,
+				Homeserver:  "https://matrix.org",
+				AutoJoin:    true,
+				SyncTimeout: 30,
+				AllowFrom:   FlexibleStringSlice{},
+			},
+			Signal: SignalConfig{
+				Enabled:   false,
+				Endpoint:  "http://127.0.0.1:8080",
+				AllowFrom: FlexibleStringSlice{},
+			},
+			IRC: IRCConfig{
+				Enabled:    false,
+				Server:     "irc.libera.chat:6697",
+				TLS:        true,
+				Nick:       "picoclaw",
+				Channels:   FlexibleStringSlice{},
+				FloodBurst: 5,
+				FloodDelay: 2000,
+				AllowFrom:  FlexibleStringSlice{},
+			},
+			Mattermost: MattermostConfig{
+				Enabled:       false,
+				CommandTokens: FlexibleStringSlice{},
+				WebhookPath:   "/webhook/mattermost",
+				AllowFrom:     FlexibleStringSlice{},
+			},
+			MQTT: MQTTConfig{
+				Enabled:       false,
+				Broker:        "mqtt://127.0.0.1:1883",
+				ClientID:      "picoclaw",
+				Topics:        FlexibleStringSlice{"picoclaw/{chat_id}/in"},
+				ResponseTopic: "picoclaw/{chat_id}/out",
+				StatusTopic:   "picoclaw/status",
+				QoS:           1,
+				PayloadFormat: "text",
+				AllowFrom:     FlexibleStringSlice{},
+			},
+			Webhook: WebhookConfig{
+				Enabled:         false,
+				Path:            "/webhook/generic",
+				SignatureHeader: "X-Signature-256",
+				Mapping: WebhookMappingConfig{
+					Sender:      "$.sender.id",
+					SenderName:  "$.sender.name",
+					ChatID:      "$.chat_id",
+					Content:     "$.text",
+					Attachments: "$.attachments",
+					MessageID:   "$.id",
+				},
+				IdempotencyHeader: "Idempotency-Key",
+				ReplyMode:         "sync",
+				ReplyTimeout:      30,
+				AllowFrom:         FlexibleStringSlice{},
 			},
 		},
 		Providers: ProvidersConfig{
@@ -331,8 +402,14 @@ func DefaultConfig() *Config {
 			},
 		},
 		Gateway: GatewayConfig{
-			Host: "127.0.0.1",
-			Port: 18790,
+			Host:      "127.0.0.1",
+			Port:      18790,
+			HotReload: true,
+			OpenAIAPI: OpenAIAPIConfig{
+				APIKeys:       FlexibleStringSlice{},
+				SessionHeader: "X-Session-Id",
+				Timeout:       600,
+			},
 		},
 		Tools: ToolsConfig{
 			MediaCleanup: MediaCleanupConfig{
@@ -457,5 +534,12 @@ func DefaultConfig() *Config {
 			Enabled:    false,
 			MonitorUSB: true,
 		},
+		Redaction: RedactionConfig{
+			Enabled:     true,
+			Logs:        true,
+			ToolResults: true,
+			Outbound:    false,
+			PII:         false,
+		},
 	}
 }
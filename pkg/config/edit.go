@@ -0,0 +1,727 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Document is a config file held as generic JSON. Unlike a decoded Config it
+// keeps key order, comments and fields unknown to this version, so editing a
+// value by path rewrites nothing else.
+type Document struct {
+	root any
+}
+
+// object is a JSON object that remembers the order of its keys.
+type object struct {
+	keys []string
+	vals map[string]any
+}
+
+func newObject() *object {
+	return &object{vals: make(map[string]any)}
+}
+
+func (o *object) get(key string) (any, bool) {
+	v, ok := o.vals[key]
+	return v, ok
+}
+
+func (o *object) set(key string, v any) {
+	if _, ok := o.vals[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.vals[key] = v
+}
+
+func (o *object) delete(key string) bool {
+	if _, ok := o.vals[key]; !ok {
+		return false
+	}
+	delete(o.vals, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(o.vals[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// ParseDocument parses a config file for editing.
+func ParseDocument(data []byte) (*Document, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	root, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the top-level JSON value")
+	}
+	if _, ok := root.(*object); !ok {
+		return nil, errors.New("config must be a JSON object")
+	}
+	return &Document{root: root}, nil
+}
+
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := newObject()
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				val, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj.set(keyTok.(string), val)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return obj, nil
+		case '[':
+			arr := []any{}
+			for dec.More() {
+				val, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, val)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return arr, nil
+		}
+	}
+	return tok, nil
+}
+
+// Bytes returns the document as indented JSON.
+func (d *Document) Bytes() ([]byte, error) {
+	data, err := json.MarshalIndent(d.root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// pathSegment is one step of a config path: an object key, an array index,
+// or an array element selected by one of its fields.
+type pathSegment struct {
+	key   string
+	index int // -1 unless the segment is an array index
+	field string
+	value string
+}
+
+func (s pathSegment) String() string {
+	switch {
+	case s.field != "":
+		return fmt.Sprintf("[%s=%s]", s.field, s.value)
+	case s.index >= 0:
+		return strconv.Itoa(s.index)
+	}
+	return s.key
+}
+
+// parsePath splits a path such as "model_list[name=gpt4].api_key" or
+// "agents.list.0.model" into segments.
+func parsePath(path string) ([]pathSegment, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("empty path")
+	}
+	var segs []pathSegment
+	rest := path
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed '[' in path %q", path)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if field, value, ok := strings.Cut(inner, "="); ok {
+				if field == "" || value == "" {
+					return nil, fmt.Errorf("invalid selector [%s] in path %q", inner, path)
+				}
+				segs = append(segs, pathSegment{index: -1, field: field, value: value})
+				break
+			}
+			n, err := strconv.Atoi(inner)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid index [%s] in path %q", inner, path)
+			}
+			segs = append(segs, pathSegment{index: n})
+		case rest[0] == '.':
+			rest = rest[1:]
+			if rest == "" || rest[0] == '.' {
+				return nil, fmt.Errorf("empty key in path %q", path)
+			}
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if n, err := strconv.Atoi(key); err == nil && n >= 0 {
+				segs = append(segs, pathSegment{key: key, index: n})
+			} else {
+				segs = append(segs, pathSegment{key: key, index: -1})
+			}
+		}
+	}
+	return segs, nil
+}
+
+func joinSegments(segs []pathSegment) string {
+	var b strings.Builder
+	for i, s := range segs {
+		if i > 0 && s.field == "" {
+			b.WriteByte('.')
+		}
+		b.WriteString(s.String())
+	}
+	return b.String()
+}
+
+// matchesSelector reports whether elem is an object whose field equals
+// value. The field "name" also matches "model_name" and "id", so that
+// model_list[name=gpt4] and agents.list[name=main] read naturally.
+func matchesSelector(elem any, field, value string) bool {
+	obj, ok := elem.(*object)
+	if !ok {
+		return false
+	}
+	fields := []string{field}
+	if field == "name" {
+		fields = append(fields, "model_name", "id")
+	}
+	for _, f := range fields {
+		if v, ok := obj.get(f); ok && scalarString(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func scalarString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case nil:
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+// selectIndex resolves an index or selector segment against arr.
+func selectIndex(arr []any, seg pathSegment, at string) (int, error) {
+	if seg.field == "" {
+		if seg.index >= len(arr) {
+			return 0, fmt.Errorf("%s: index %d out of range (length %d)", at, seg.index, len(arr))
+		}
+		return seg.index, nil
+	}
+	found := -1
+	for i, elem := range arr {
+		if matchesSelector(elem, seg.field, seg.value) {
+			if found >= 0 {
+				return 0, fmt.Errorf("%s: [%s=%s] matches more than one entry; use an index", at, seg.field, seg.value)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("%s: no entry with %s=%s", at, seg.field, seg.value)
+	}
+	return found, nil
+}
+
+// ErrPathNotFound is returned when a path does not exist in the document.
+var ErrPathNotFound = errors.New("not set")
+
+// Get returns the value at path as plain JSON-compatible data.
+func (d *Document) Get(path string) (any, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	cur := d.root
+	for i, seg := range segs {
+		at := joinSegments(segs[:i+1])
+		switch node := cur.(type) {
+		case *object:
+			if seg.field != "" {
+				return nil, fmt.Errorf("%s: selector used on an object", at)
+			}
+			v, ok := node.get(seg.key)
+			if !ok {
+				return nil, fmt.Errorf("%s: %w", at, ErrPathNotFound)
+			}
+			cur = v
+		case []any:
+			if seg.field == "" && seg.index < 0 {
+				return nil, fmt.Errorf("%s: %s is a list; use an index or [field=value]", at, joinSegments(segs[:i]))
+			}
+			idx, err := selectIndex(node, seg, at)
+			if err != nil {
+				return nil, err
+			}
+			cur = node[idx]
+		default:
+			return nil, fmt.Errorf("%s: %w", at, ErrPathNotFound)
+		}
+	}
+	return cur, nil
+}
+
+// edit walks to the parent of the last segment, creating missing objects on
+// the way when create is set, and calls fn with the container and the last
+// segment.
+func (d *Document) edit(path string, create bool, fn func(parent any, seg pathSegment, at string, replace func(any)) error) error {
+	segs, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	var parent any = d.root
+	replaceParent := func(any) {}
+	for i, seg := range segs[:len(segs)-1] {
+		at := joinSegments(segs[:i+1])
+		switch node := parent.(type) {
+		case *object:
+			if seg.field != "" {
+				return fmt.Errorf("%s: selector used on an object", at)
+			}
+			next, ok := node.get(seg.key)
+			if !ok || next == nil {
+				if !create {
+					return fmt.Errorf("%s: %w", at, ErrPathNotFound)
+				}
+				next = newObject()
+				node.set(seg.key, next)
+			}
+			key := seg.key
+			replaceParent = func(v any) { node.set(key, v) }
+			parent = next
+		case []any:
+			if seg.field == "" && seg.index < 0 {
+				return fmt.Errorf("%s: %s is a list; use an index or [field=value]", at, joinSegments(segs[:i]))
+			}
+			idx, err := selectIndex(node, seg, at)
+			if err != nil {
+				return err
+			}
+			arr := node
+			replaceParent = func(v any) { arr[idx] = v }
+			parent = node[idx]
+		default:
+			return fmt.Errorf("%s: cannot descend into a %s", at, jsonType(toPlain(node)))
+		}
+	}
+	return fn(parent, segs[len(segs)-1], joinSegments(segs), replaceParent)
+}
+
+// Set stores value at path, creating intermediate objects as needed.
+func (d *Document) Set(path string, value any) error {
+	return d.edit(path, true, func(parent any, seg pathSegment, at string, _ func(any)) error {
+		switch node := parent.(type) {
+		case *object:
+			if seg.field != "" {
+				return fmt.Errorf("%s: selector used on an object", at)
+			}
+			node.set(seg.key, fromPlain(value))
+			return nil
+		case []any:
+			if seg.field == "" && seg.index < 0 {
+				return fmt.Errorf("%s: parent is a list; use an index or [field=value]", at)
+			}
+			idx, err := selectIndex(node, seg, at)
+			if err != nil {
+				return err
+			}
+			node[idx] = fromPlain(value)
+			return nil
+		}
+		return fmt.Errorf("%s: parent is not an object or list", at)
+	})
+}
+
+// Unset removes the value at path. Removing a list element shifts the ones
+// after it.
+func (d *Document) Unset(path string) error {
+	return d.edit(path, false, func(parent any, seg pathSegment, at string, replace func(any)) error {
+		switch node := parent.(type) {
+		case *object:
+			if seg.field != "" || !node.delete(seg.key) {
+				return fmt.Errorf("%s: %w", at, ErrPathNotFound)
+			}
+			return nil
+		case []any:
+			if seg.field == "" && seg.index < 0 {
+				return fmt.Errorf("%s: parent is a list; use an index or [field=value]", at)
+			}
+			idx, err := selectIndex(node, seg, at)
+			if err != nil {
+				return err
+			}
+			replace(append(node[:idx:idx], node[idx+1:]...))
+			return nil
+		}
+		return fmt.Errorf("%s: %w", at, ErrPathNotFound)
+	})
+}
+
+// setKeys stores value under a sequence of object keys, which unlike a path
+// may contain dots. Missing or non-object intermediate values are replaced
+// by objects.
+func (d *Document) setKeys(keys []string, value any) error {
+	if len(keys) == 0 {
+		obj, ok := fromPlain(value).(*object)
+		if !ok {
+			return errors.New("config must be a JSON object")
+		}
+		d.root = obj
+		return nil
+	}
+	cur := d.root.(*object)
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := cur.get(key)
+		obj, isObj := next.(*object)
+		if !ok || !isObj {
+			obj = newObject()
+			cur.set(key, obj)
+		}
+		cur = obj
+	}
+	cur.set(keys[len(keys)-1], fromPlain(value))
+	return nil
+}
+
+// unsetKeys removes the value under a sequence of object keys, if present.
+func (d *Document) unsetKeys(keys []string) {
+	cur, ok := d.root.(*object)
+	for i, key := range keys {
+		if !ok {
+			return
+		}
+		if i == len(keys)-1 {
+			cur.delete(key)
+			return
+		}
+		next, _ := cur.get(key)
+		cur, ok = next.(*object)
+	}
+}
+
+// Append adds value to the list at path, creating the list if it is missing.
+func (d *Document) Append(path string, value any) error {
+	cur, err := d.Get(path)
+	if err != nil && !errors.Is(err, ErrPathNotFound) {
+		return err
+	}
+	var list []any
+	if cur != nil {
+		arr, ok := cur.([]any)
+		if !ok {
+			return fmt.Errorf("%s: not a list", path)
+		}
+		list = arr
+	}
+	return d.Set(path, append(list, fromPlain(value)))
+}
+
+// Remove deletes every element equal to value from the list at path and
+// returns how many were removed.
+func (d *Document) Remove(path string, value any) (int, error) {
+	cur, err := d.Get(path)
+	if err != nil {
+		return 0, err
+	}
+	arr, ok := cur.([]any)
+	if !ok {
+		return 0, fmt.Errorf("%s: not a list", path)
+	}
+	want := toPlain(fromPlain(value))
+	kept := make([]any, 0, len(arr))
+	for _, elem := range arr {
+		if valuesEqual(toPlain(elem), want) {
+			continue
+		}
+		kept = append(kept, elem)
+	}
+	removed := len(arr) - len(kept)
+	if removed == 0 {
+		return 0, fmt.Errorf("%s: no element equal to %s", path, scalarString(want))
+	}
+	return removed, d.Set(path, kept)
+}
+
+// valuesEqual compares two plain JSON values; numbers compare by value and,
+// as with allow_from lists, a number equals its string form.
+func valuesEqual(a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	_, aObj := a.(map[string]any)
+	_, bObj := b.(map[string]any)
+	_, aArr := a.([]any)
+	_, bArr := b.([]any)
+	if aObj || bObj || aArr || bArr {
+		return false
+	}
+	return scalarString(a) == scalarString(b)
+}
+
+// toPlain converts document values (ordered objects, json.Number) to the
+// types encoding/json produces for interface{} targets.
+func toPlain(v any) any {
+	switch val := v.(type) {
+	case *object:
+		m := make(map[string]any, len(val.keys))
+		for _, k := range val.keys {
+			m[k] = toPlain(val.vals[k])
+		}
+		return m
+	case []any:
+		out := make([]any, len(val))
+		for i, e := range val {
+			out[i] = toPlain(e)
+		}
+		return out
+	case json.Number:
+		f, _ := val.Float64()
+		return f
+	}
+	return v
+}
+
+// fromPlain converts plain values back into document values, keeping the
+// key order of maps deterministic.
+func fromPlain(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		obj := newObject()
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			obj.set(k, fromPlain(val[k]))
+		}
+		return obj
+	case []any:
+		out := make([]any, len(val))
+		for i, e := range val {
+			out[i] = fromPlain(e)
+		}
+		return out
+	}
+	return v
+}
+
+// SchemaAt returns the schema of the value at path, or an error naming the
+// first unknown key (with a suggestion) if the path is not part of the
+// config.
+func SchemaAt(path string) (map[string]any, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	schema := Schema()
+	for i, seg := range segs {
+		at := joinSegments(segs[:i+1])
+		types := schemaTypes(schema)
+		switch {
+		case len(types) == 1 && types[0] == "array":
+			if seg.field == "" && seg.index < 0 {
+				return nil, fmt.Errorf("%s: %s is a list; use an index or [field=value]", at, joinSegments(segs[:i]))
+			}
+			schema = schema["items"].(map[string]any)
+		case len(types) == 1 && types[0] == "object":
+			if seg.field != "" {
+				return nil, fmt.Errorf("%s: selector used on an object", at)
+			}
+			props, _ := schema["properties"].(map[string]any)
+			if ps, ok := props[seg.key].(map[string]any); ok {
+				schema = ps
+				continue
+			}
+			if extra, ok := schema["additionalProperties"].(map[string]any); ok {
+				schema = extra
+				continue
+			}
+			known := make([]string, 0, len(props))
+			for name := range props {
+				known = append(known, name)
+			}
+			return nil, ValidationError{Path: at, Message: "unknown key", Suggestion: closestMatch(seg.key, known)}
+		default:
+			return nil, fmt.Errorf("%s: %s is not an object or list", at, joinSegments(segs[:i]))
+		}
+	}
+	return schema, nil
+}
+
+// CoerceValue converts a command-line string to the JSON type the schema
+// expects at path: "true" becomes a boolean for enabled flags, "8080" a
+// number for ports, "a,b" a list for string lists. JSON literals ("[...]",
+// "{...}") are accepted wherever a list or object is expected.
+func CoerceValue(path, raw string) (any, error) {
+	schema, err := SchemaAt(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := coerce(schema, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if errs := validateValue(schema, v, path); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return v, nil
+}
+
+// CoerceElement converts raw to the element type of the list at path, for
+// appending to or removing from it.
+func CoerceElement(path, raw string) (any, error) {
+	schema, err := SchemaAt(path)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := schema["items"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: not a list", path)
+	}
+	v, err := coerce(items, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if errs := validateValue(items, v, path); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return v, nil
+}
+
+func coerce(schema map[string]any, raw string) (any, error) {
+	trimmed := strings.TrimSpace(raw)
+	isJSON := strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")
+	parseJSON := func() (any, error) {
+		var v any
+		if err := json.Unmarshal([]byte(trimmed), &v); err != nil {
+			return nil, fmt.Errorf("invalid JSON value: %w", err)
+		}
+		return v, nil
+	}
+
+	if _, ok := schema["oneOf"]; ok {
+		if isJSON {
+			return parseJSON()
+		}
+		return raw, nil
+	}
+
+	types := schemaTypes(schema)
+	has := func(t string) bool {
+		for _, st := range types {
+			if st == t {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case has("string"):
+		return raw, nil
+	case has("boolean"):
+		b, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false, got %q", raw)
+		}
+		return b, nil
+	case has("integer"):
+		n, err := strconv.ParseInt(trimmed, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got %q", raw)
+		}
+		return float64(n), nil
+	case has("number"):
+		f, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number, got %q", raw)
+		}
+		return f, nil
+	case has("array"):
+		if isJSON {
+			return parseJSON()
+		}
+		items, _ := schema["items"].(map[string]any)
+		out := []any{}
+		if trimmed == "" {
+			return out, nil
+		}
+		for _, part := range strings.Split(raw, ",") {
+			v, err := coerce(items, strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case has("object"):
+		if !isJSON {
+			return nil, fmt.Errorf("expected a JSON object, got %q", raw)
+		}
+		return parseJSON()
+	}
+	if isJSON {
+		return parseJSON()
+	}
+	return raw, nil
+}
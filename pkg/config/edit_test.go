@@ -0,0 +1,195 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const editTestConfig = `{
+  "_comment": "kept",
+  "channels": {
+    "telegram": {
+      "enabled": false,
+      "allow_from": ["1", "2"]
+    }
+  },
+  "model_list": [
+    {"model_name": "gpt4", "model": "openai/gpt-4o", "api_key": "a"},
+    {"model_name": "local", "model": "ollama/llama3", "api_key": "b"}
+  ]
+}
+`
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"channels.telegram.allow_from", "channels.telegram.allow_from"},
+		{"model_list[name=gpt4].api_key", "model_list[name=gpt4].api_key"},
+		{"model_list[1].model", "model_list.1.model"},
+		{"model_list.1.model", "model_list.1.model"},
+	}
+	for _, tt := range tests {
+		segs, err := parsePath(tt.path)
+		if err != nil {
+			t.Fatalf("parsePath(%q): %v", tt.path, err)
+		}
+		if got := joinSegments(segs); got != tt.want {
+			t.Errorf("parsePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "a..b", "a[", "a[x]", "a[=1]", "a."} {
+		if _, err := parsePath(bad); err == nil {
+			t.Errorf("parsePath(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestDocumentGetSetUnset(t *testing.T) {
+	doc, err := ParseDocument([]byte(editTestConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := doc.Get("model_list[name=local].model")
+	if err != nil || got != "ollama/llama3" {
+		t.Fatalf("Get selector = %v, %v", got, err)
+	}
+	if _, err := doc.Get("channels.discord.token"); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("Get missing = %v, want ErrPathNotFound", err)
+	}
+	if _, err := doc.Get("model_list[name=nope].model"); err == nil {
+		t.Fatal("Get with unmatched selector succeeded")
+	}
+
+	if err := doc.Set("model_list[name=gpt4].api_key", "env:OPENAI_API_KEY"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Set("channels.discord.enabled", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Unset("model_list[1]"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Unset("channels.telegram.proxy"); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("Unset missing = %v, want ErrPathNotFound", err)
+	}
+
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{`"_comment": "kept"`, `"api_key": "env:OPENAI_API_KEY"`, `"discord": {`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "ollama") {
+		t.Errorf("unset list element still present:\n%s", out)
+	}
+	// Existing keys keep their order; new keys are added at the end.
+	if strings.Index(out, `"_comment"`) > strings.Index(out, `"channels"`) ||
+		strings.Index(out, `"telegram"`) > strings.Index(out, `"discord"`) {
+		t.Errorf("key order not preserved:\n%s", out)
+	}
+}
+
+func TestDocumentAppendRemove(t *testing.T) {
+	doc, err := ParseDocument([]byte(editTestConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := doc.Append("channels.telegram.allow_from", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Append("channels.discord.allow_from", "9"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := doc.Remove("channels.telegram.allow_from", float64(1))
+	if err != nil || n != 1 {
+		t.Fatalf("Remove = %d, %v", n, err)
+	}
+	if _, err := doc.Remove("channels.telegram.allow_from", "42"); err == nil {
+		t.Fatal("Remove of missing element succeeded")
+	}
+
+	got, _ := doc.Get("channels.telegram.allow_from")
+	if want := []any{"2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("allow_from = %v, want %v", got, want)
+	}
+	got, _ = doc.Get("channels.discord.allow_from")
+	if want := []any{"9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("discord allow_from = %v, want %v", got, want)
+	}
+}
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		path string
+		raw  string
+		want any
+	}{
+		{"channels.telegram.enabled", "true", true},
+		{"gateway.port", "9000", float64(9000)},
+		{"agents.defaults.temperature", "0.5", 0.5},
+		{"channels.telegram.token", "123", "123"},
+		{"channels.telegram.allow_from", "1, 2", []any{"1", "2"}},
+		{"channels.telegram.allow_from", `["a"]`, []any{"a"}},
+		{"model_list[name=gpt4].model", "openai/gpt-4o", "openai/gpt-4o"},
+	}
+	for _, tt := range tests {
+		got, err := CoerceValue(tt.path, tt.raw)
+		if err != nil {
+			t.Errorf("CoerceValue(%q, %q): %v", tt.path, tt.raw, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CoerceValue(%q, %q) = %#v, want %#v", tt.path, tt.raw, got, tt.want)
+		}
+	}
+
+	if _, err := CoerceValue("gateway.port", "http"); err == nil {
+		t.Error("CoerceValue accepted a non-integer port")
+	}
+	_, err := CoerceValue("channels.telegram.enabld", "true")
+	var verr ValidationError
+	if !errors.As(err, &verr) || verr.Suggestion != "enabled" {
+		t.Errorf("CoerceValue unknown key = %v, want suggestion \"enabled\"", err)
+	}
+
+	got, err := CoerceElement("channels.telegram.allow_from", "42")
+	if err != nil || got != "42" {
+		t.Errorf("CoerceElement = %#v, %v", got, err)
+	}
+}
+
+func TestDocumentMaskSecrets(t *testing.T) {
+	doc, err := ParseDocument([]byte(`{
+  "model_list": [{"model_name": "gpt4", "api_key": "sk-live-123"}],
+  "channels": {"telegram": {"token": "env:TELEGRAM_TOKEN", "max_tokens": 5}}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.MaskSecrets()
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if strings.Contains(got, "sk-live-123") || !strings.Contains(got, `"api_key": "********"`) {
+		t.Errorf("literal secret not masked:\n%s", got)
+	}
+	if !strings.Contains(got, `"token": "env:TELEGRAM_TOKEN"`) || !strings.Contains(got, `"max_tokens": 5`) {
+		t.Errorf("references and non-secrets should be kept:\n%s", got)
+	}
+	if strings.Index(got, "model_list") > strings.Index(got, "channels") {
+		t.Errorf("key order not kept:\n%s", got)
+	}
+}
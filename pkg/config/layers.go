@@ -0,0 +1,538 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ProfileEnv selects a config profile when none is given on the command line.
+const ProfileEnv = "PICOCLAW_PROFILE"
+
+// Layering directives. "$include" is only recognised at the top level of a
+// file; "$append" and "$replace" wrap a value in an overlay.
+const (
+	includeKey = "$include"
+	appendKey  = "$append"
+	replaceKey = "$replace"
+)
+
+// Source names for values that do not come from a config file.
+const (
+	SourceDefault = "default"
+	SourceEnv     = "env"
+)
+
+// Layers is the result of merging a base config file with its includes and
+// overlays.
+type Layers struct {
+	Base  string   // the base config file
+	Files []string // files merged, lowest precedence first
+	Data  []byte   // the merged config as JSON, without directives
+
+	// sources maps the JSON path of every leaf value (scalar or list) to the
+	// file that set it.
+	sources map[string]string
+}
+
+// layerState is what LoadConfig remembers about a layered config so that
+// SaveConfig can write changes back to the base file only.
+type layerState struct {
+	base     string
+	snapshot any
+}
+
+// HostOverlayPath returns the per-host overlay for the base config at path:
+// hosts/<hostname>.json next to it.
+func HostOverlayPath(path string) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return ""
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	return filepath.Join(filepath.Dir(path), "hosts", host+".json")
+}
+
+// ProfileOverlayPath returns the overlay for profile next to the base
+// config at path: profiles/<profile>.json.
+func ProfileOverlayPath(path, profile string) string {
+	return filepath.Join(filepath.Dir(path), "profiles", profile+".json")
+}
+
+// ResolveLayers reads the config at path and merges, in order of increasing
+// precedence:
+//
+//  1. the files listed in its "$include" (recursively, each before the file
+//     that includes it),
+//  2. the file itself,
+//  3. hosts/<hostname>.json, if present,
+//  4. profiles/<profile>.json, if a profile is given.
+//
+// Objects are merged key by key; any other value, lists included, replaces
+// the one below it. An overlay appends to a list with {"$append": [...]},
+// replaces an object wholesale with {"$replace": {...}}, and removes a key,
+// restoring its default, by setting it to null. A missing base file is not an
+// error; a missing profile is.
+func ResolveLayers(path, profile string) (*Layers, error) {
+	l := &Layers{Base: path, sources: make(map[string]string)}
+	var root any = newObject()
+	merged := 0
+
+	add := func(file string, required bool) error {
+		if file == "" {
+			return nil
+		}
+		if _, err := os.Stat(file); err != nil {
+			if os.IsNotExist(err) && !required {
+				return nil
+			}
+			return err
+		}
+		n, err := l.mergeFile(&root, file, nil)
+		merged += n
+		return err
+	}
+
+	if err := add(path, false); err != nil {
+		return nil, err
+	}
+	if err := add(HostOverlayPath(path), false); err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		if strings.ContainsAny(profile, `/\`) || profile == "." || profile == ".." {
+			return nil, fmt.Errorf("invalid profile name %q", profile)
+		}
+		file := ProfileOverlayPath(path, profile)
+		if err := add(file, true); err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("profile %q not found: %s does not exist", profile, file)
+			}
+			return nil, err
+		}
+	}
+
+	if merged == 0 {
+		return l, nil
+	}
+	// A lone file without directives is used verbatim, so decoding errors
+	// keep pointing at the right place in it.
+	if len(l.Files) == 1 {
+		data, err := os.ReadFile(l.Files[0])
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Contains(data, []byte(`"$`)) {
+			l.Data = data
+			return l, nil
+		}
+	}
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	l.Data = data
+	return l, nil
+}
+
+// mergeFile merges file, after its includes, into root and returns the
+// number of files merged. stack holds the files being included, to detect
+// cycles.
+func (l *Layers) mergeFile(root *any, file string, stack []string) (int, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range stack {
+		if f == abs {
+			return 0, fmt.Errorf("%s: include cycle: %s", file, strings.Join(append(stack, abs), " -> "))
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", file, err)
+	}
+	obj := doc.root.(*object)
+
+	merged := 0
+	if inc, ok := obj.get(includeKey); ok {
+		var includes []string
+		switch v := inc.(type) {
+		case string:
+			includes = []string{v}
+		case []any:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return 0, fmt.Errorf("%s: %s must list file paths", file, includeKey)
+				}
+				includes = append(includes, s)
+			}
+		default:
+			return 0, fmt.Errorf("%s: %s must be a path or a list of paths", file, includeKey)
+		}
+		for _, inc := range includes {
+			inc = expandHome(inc)
+			if !filepath.IsAbs(inc) {
+				inc = filepath.Join(filepath.Dir(file), inc)
+			}
+			n, err := l.mergeFile(root, inc, append(stack, abs))
+			if err != nil {
+				return 0, err
+			}
+			merged += n
+		}
+		obj.delete(includeKey)
+	}
+
+	*root, err = l.merge(*root, obj, "", l.sourceName(file))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", file, err)
+	}
+	l.Files = append(l.Files, file)
+	return merged + 1, nil
+}
+
+// merge applies overlay on top of base and records the source of every
+// value the overlay sets.
+func (l *Layers) merge(base, overlay any, path, source string) (any, error) {
+	obj, ok := overlay.(*object)
+	if !ok {
+		overlay = stripDirectives(overlay)
+		l.setSource(path, overlay, source)
+		return overlay, nil
+	}
+
+	if v, ok := obj.get(appendKey); ok {
+		if len(obj.keys) != 1 {
+			return nil, fmt.Errorf("%s: %s cannot be combined with other keys", path, appendKey)
+		}
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s needs a list", path, appendKey)
+		}
+		var list []any
+		switch b := base.(type) {
+		case nil:
+		case []any:
+			list = append(list, b...)
+		default:
+			return nil, fmt.Errorf("%s: %s used on a value that is not a list", path, appendKey)
+		}
+		list = append(list, stripDirectives(items).([]any)...)
+		l.setSource(path, list, source)
+		return list, nil
+	}
+	if v, ok := obj.get(replaceKey); ok {
+		if len(obj.keys) != 1 {
+			return nil, fmt.Errorf("%s: %s cannot be combined with other keys", path, replaceKey)
+		}
+		v = stripDirectives(v)
+		l.setSource(path, v, source)
+		return v, nil
+	}
+
+	dst, ok := base.(*object)
+	if !ok {
+		dst = newObject()
+		l.clearSources(path)
+	}
+	for _, key := range obj.keys {
+		childPath := joinPath(path, key)
+		val := obj.vals[key]
+		if val == nil {
+			dst.delete(key)
+			l.clearSources(childPath)
+			continue
+		}
+		cur, _ := dst.get(key)
+		next, err := l.merge(cur, val, childPath, source)
+		if err != nil {
+			return nil, err
+		}
+		dst.set(key, next)
+	}
+	return dst, nil
+}
+
+// setSource records source for v at path, replacing whatever was recorded
+// for it or below it.
+func (l *Layers) setSource(path string, v any, source string) {
+	l.clearSources(path)
+	if obj, ok := v.(*object); ok {
+		for _, key := range obj.keys {
+			l.setSource(joinPath(path, key), obj.vals[key], source)
+		}
+		return
+	}
+	l.sources[path] = source
+}
+
+func (l *Layers) clearSources(path string) {
+	for p := range l.sources {
+		if p == path || path == "" || strings.HasPrefix(p, path+".") {
+			delete(l.sources, p)
+		}
+	}
+}
+
+// sourceName shortens file for display: relative to the base config's
+// directory when it is inside it.
+func (l *Layers) sourceName(file string) string {
+	dir, err := filepath.Abs(filepath.Dir(l.Base))
+	if err != nil {
+		return file
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	if rel, err := filepath.Rel(dir, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return abs
+}
+
+// stripDirectives resolves directives inside a value that has nothing to
+// merge with: $append and $replace simply yield their contents.
+func stripDirectives(v any) any {
+	switch val := v.(type) {
+	case *object:
+		if len(val.keys) == 1 && (val.keys[0] == appendKey || val.keys[0] == replaceKey) {
+			return stripDirectives(val.vals[val.keys[0]])
+		}
+		out := newObject()
+		for _, key := range val.keys {
+			if val.vals[key] != nil && key != includeKey {
+				out.set(key, stripDirectives(val.vals[key]))
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, e := range val {
+			out[i] = stripDirectives(e)
+		}
+		return out
+	}
+	return v
+}
+
+// withoutDirectives returns config JSON with layering directives resolved
+// as if the file had nothing below it, so that a single file can be
+// validated on its own.
+func withoutDirectives(data []byte) []byte {
+	if !bytes.Contains(data, []byte(`"$`)) {
+		return data
+	}
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return data
+	}
+	out, err := json.Marshal(stripDirectives(doc.root))
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// LoadConfigProfile loads the config at path together with its includes,
+// the overlay for this host and the overlay for profile (see ResolveLayers).
+func LoadConfigProfile(path, profile string) (*Config, error) {
+	layers, err := ResolveLayers(path, profile)
+	if err != nil {
+		return nil, err
+	}
+	return loadLayers(layers, true)
+}
+
+// LoadConfigRefs loads the config like LoadConfig but keeps secret
+// references as written instead of resolving them, so reading the config
+// never runs a cmd: reference. Editors use it to show and save the config.
+func LoadConfigRefs(path string) (*Config, error) {
+	layers, err := ResolveLayers(path, os.Getenv(ProfileEnv))
+	if err != nil {
+		return nil, err
+	}
+	return loadLayers(layers, false)
+}
+
+// Files returns the config files the config was loaded from, lowest
+// precedence first. It is empty for a config that was not loaded from disk.
+func (c *Config) Files() []string {
+	return c.files
+}
+
+// AdoptLayers makes SaveConfig treat c as an edited copy of from: when from
+// was loaded from layered files, only the values c changes are written, to
+// the base file.
+func (c *Config) AdoptLayers(from *Config) {
+	c.files = from.files
+	c.layers = from.layers
+}
+
+// ResolvedValue is one effective config value and where it came from.
+type ResolvedValue struct {
+	Path   string // JSON path; lists are shown as a whole
+	Value  any
+	Source string // a config file, SourceEnv or SourceDefault
+}
+
+// Resolve returns every effective value of the layered config with its
+// source. Secret references are shown as written, not resolved.
+func (l *Layers) Resolve() ([]ResolvedValue, error) {
+	fileCfg, err := decodeConfig(l.Data)
+	if err != nil {
+		return nil, err
+	}
+	fileVals, err := flattenConfig(fileCfg)
+	if err != nil {
+		return nil, err
+	}
+	envCfg, err := decodeConfig(l.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseEnv(envCfg); err != nil {
+		return nil, err
+	}
+	envVals, err := flattenConfig(envCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(envVals))
+	for p := range envVals {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	out := make([]ResolvedValue, 0, len(paths))
+	for _, p := range paths {
+		source := SourceDefault
+		switch fv, ok := fileVals[p]; {
+		case !ok || !reflect.DeepEqual(fv, envVals[p]):
+			source = SourceEnv
+		case l.sources[p] != "":
+			source = l.sources[p]
+		}
+		out = append(out, ResolvedValue{Path: p, Value: envVals[p], Source: source})
+	}
+	return out, nil
+}
+
+// flattenConfig returns the leaf values of cfg keyed by JSON path.
+func flattenConfig(cfg *Config) (map[string]any, error) {
+	tree, err := toGeneric(cfg)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]any)
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		if m, ok := v.(map[string]any); ok && len(m) > 0 {
+			for k, child := range m {
+				walk(joinPath(path, k), child)
+			}
+			return
+		}
+		out[path] = v
+	}
+	walk("", tree)
+	return out, nil
+}
+
+func toGeneric(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+// saveLayered writes the changes made to a layered config since it was
+// loaded into its base file, leaving includes and overlays untouched.
+func saveLayered(state *layerState, cfg *Config) error {
+	current, err := toGeneric(cfg)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(state.base)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		data = []byte("{}")
+	}
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", state.base, err)
+	}
+
+	var apply error
+	diffGeneric(state.snapshot, current, nil, func(keys []string, v any, removed bool) {
+		if apply != nil {
+			return
+		}
+		if removed {
+			doc.unsetKeys(keys)
+			return
+		}
+		apply = doc.setKeys(keys, v)
+	})
+	if apply != nil {
+		return apply
+	}
+	out, err := doc.Bytes()
+	if err != nil {
+		return err
+	}
+	return writeConfigFile(state.base, out)
+}
+
+// diffGeneric calls fn for every value that differs between old and next,
+// descending into objects present in both.
+func diffGeneric(old, next any, keys []string, fn func(keys []string, v any, removed bool)) {
+	om, oOK := old.(map[string]any)
+	nm, nOK := next.(map[string]any)
+	if !oOK || !nOK {
+		if !reflect.DeepEqual(old, next) {
+			fn(keys, next, false)
+		}
+		return
+	}
+	names := make([]string, 0, len(om)+len(nm))
+	for k := range nm {
+		names = append(names, k)
+	}
+	for k := range om {
+		if _, ok := nm[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		child := append(keys[:len(keys):len(keys)], k)
+		nv, inNext := nm[k]
+		if !inNext {
+			fn(child, nil, true)
+			continue
+		}
+		diffGeneric(om[k], nv, child, fn)
+	}
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeLayer(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupLayers writes a base config that includes shared.json, a host
+// overlay for this machine and a "staging" profile.
+func setupLayers(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	writeLayer(t, filepath.Join(dir, "shared.json"), `{
+		"agents": {"defaults": {"workspace": "/srv/ws", "max_tokens": 1000}},
+		"channels": {"telegram": {"enabled": true, "allow_from": ["1"]}},
+		"gateway": {"host": "0.0.0.0", "port": 18790}
+	}`)
+	writeLayer(t, path, `{
+		"$include": "shared.json",
+		"agents": {"defaults": {"max_tokens": 2000}}
+	}`)
+	if host := HostOverlayPath(path); host != "" {
+		writeLayer(t, host, `{
+			"channels": {"telegram": {"token": "host-token", "allow_from": {"$append": ["2"]}}}
+		}`)
+	}
+	writeLayer(t, ProfileOverlayPath(path, "staging"), `{
+		"gateway": {"port": 28790, "host": null}
+	}`)
+	return path
+}
+
+func TestResolveLayers(t *testing.T) {
+	path := setupLayers(t)
+
+	layers, err := ResolveLayers(path, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers.Files) != 4 {
+		t.Fatalf("Files = %v, want shared, base, host and profile", layers.Files)
+	}
+	if strings.Contains(string(layers.Data), "$") {
+		t.Errorf("directives left in merged data:\n%s", layers.Data)
+	}
+
+	cfg, err := LoadConfigProfile(path, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Agents.Defaults.Workspace != "/srv/ws" || cfg.Agents.Defaults.MaxTokens != 2000 {
+		t.Errorf("defaults = %+v, want workspace from include and max_tokens from base", cfg.Agents.Defaults)
+	}
+	if got, want := []string(cfg.Channels.Telegram.AllowFrom), []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("allow_from = %v, want %v", got, want)
+	}
+	if cfg.Channels.Telegram.Token != "host-token" {
+		t.Errorf("token = %q, want host overlay value", cfg.Channels.Telegram.Token)
+	}
+	if cfg.Gateway.Port != 28790 {
+		t.Errorf("port = %d, want profile value", cfg.Gateway.Port)
+	}
+	if cfg.Gateway.Host != DefaultConfig().Gateway.Host {
+		t.Errorf("host = %q, want default after null in profile", cfg.Gateway.Host)
+	}
+
+	// Without the profile the shared values apply.
+	cfg, err = LoadConfigProfile(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Gateway.Port != 18790 || cfg.Gateway.Host != "0.0.0.0" {
+		t.Errorf("gateway = %+v, want shared values", cfg.Gateway)
+	}
+
+	if _, err := ResolveLayers(path, "missing"); err == nil {
+		t.Error("ResolveLayers with a missing profile succeeded")
+	}
+	if _, err := ResolveLayers(path, "../x"); err == nil {
+		t.Error("ResolveLayers accepted a profile with a path separator")
+	}
+}
+
+func TestResolveLayers_IncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeLayer(t, filepath.Join(dir, "a.json"), `{"$include": "b.json"}`)
+	writeLayer(t, filepath.Join(dir, "b.json"), `{"$include": ["a.json"]}`)
+	if _, err := ResolveLayers(filepath.Join(dir, "a.json"), ""); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("err = %v, want include cycle", err)
+	}
+}
+
+func TestLayersResolve_Sources(t *testing.T) {
+	path := setupLayers(t)
+	t.Setenv("PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE", "0.3")
+
+	layers, err := ResolveLayers(path, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := layers.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := make(map[string]string)
+	for _, v := range values {
+		sources[v.Path] = v.Source
+	}
+
+	want := map[string]string{
+		"agents.defaults.workspace":    "shared.json",
+		"agents.defaults.max_tokens":   "config.json",
+		"gateway.port":                 filepath.Join("profiles", "staging.json"),
+		"gateway.host":                 SourceDefault,
+		"agents.defaults.temperature":  SourceEnv,
+		"channels.telegram.enabled":    "shared.json",
+		"channels.discord.enabled":     SourceDefault,
+		"channels.telegram.allow_from": "",
+	}
+	if rel, err := filepath.Rel(filepath.Dir(path), HostOverlayPath(path)); err == nil {
+		want["channels.telegram.allow_from"] = rel
+	}
+	for p, src := range want {
+		if sources[p] != src {
+			t.Errorf("source of %s = %q, want %q", p, sources[p], src)
+		}
+	}
+}
+
+func TestSaveConfig_Layered(t *testing.T) {
+	path := setupLayers(t)
+	sharedBefore, err := os.ReadFile(filepath.Join(filepath.Dir(path), "shared.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigProfile(path, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Agents.Defaults.MaxTokens = 4000
+	cfg.Heartbeat.Interval = 45
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var base map[string]any
+	if err := json.Unmarshal(data, &base); err != nil {
+		t.Fatal(err)
+	}
+	if base["$include"] != "shared.json" {
+		t.Errorf("include lost: %s", data)
+	}
+	if _, ok := base["gateway"]; ok {
+		t.Errorf("overlay values copied into base: %s", data)
+	}
+	if _, ok := base["channels"]; ok {
+		t.Errorf("include values copied into base: %s", data)
+	}
+
+	sharedAfter, _ := os.ReadFile(filepath.Join(filepath.Dir(path), "shared.json"))
+	if string(sharedAfter) != string(sharedBefore) {
+		t.Error("included file was modified")
+	}
+
+	cfg, err = LoadConfigProfile(path, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Agents.Defaults.MaxTokens != 4000 || cfg.Heartbeat.Interval != 45 {
+		t.Errorf("changes not saved: max_tokens=%d interval=%d", cfg.Agents.Defaults.MaxTokens, cfg.Heartbeat.Interval)
+	}
+}
+
+func TestValidate_IgnoresDirectives(t *testing.T) {
+	errs := Validate([]byte(`{"$include": "shared.json", "channels": {"telegram": {"allow_from": {"$append": ["1"]}}}}`))
+	if len(errs) != 0 {
+		t.Errorf("Validate = %v, want no errors", errs)
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SchemaURL identifies the JSON Schema dialect produced by Schema.
+const SchemaURL = "https://json-schema.org/draft/2020-12/schema"
+
+const commentKeyPattern = "^_"
+
+var (
+	flexibleStringSliceType = reflect.TypeOf(FlexibleStringSlice{})
+	agentModelConfigType    = reflect.TypeOf(AgentModelConfig{})
+)
+
+// Schema returns a JSON Schema describing config.json, generated from the
+// Config struct so that it never drifts from what LoadConfig accepts. Fields
+// that can be overridden from the environment carry the variable name in an
+// "x-env" annotation.
+func Schema() map[string]any {
+	s := schemaFor(reflect.TypeOf(Config{}), "")
+	s["$schema"] = SchemaURL
+	s["title"] = "PicoClaw configuration"
+	return s
+}
+
+func schemaFor(t reflect.Type, envPrefix string) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	// Types with custom JSON decoding accept more than their Go shape.
+	switch t {
+	case flexibleStringSliceType:
+		return map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": []string{"string", "number"}},
+		}
+	case agentModelConfigType:
+		return map[string]any{
+			"oneOf": []any{
+				map[string]any{"type": "string"},
+				map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"primary":   map[string]any{"type": "string"},
+						"fallbacks": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+					},
+					"additionalProperties": false,
+				},
+			},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), "")}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), "")}
+	case reflect.Struct:
+		props := make(map[string]any)
+		addStructProperties(t, envPrefix, props)
+		return map[string]any{
+			"type":       "object",
+			"properties": props,
+			// Keys starting with "_" are comments, as in config.example.json.
+			"patternProperties":    map[string]any{commentKeyPattern: map[string]any{}},
+			"additionalProperties": false,
+		}
+	}
+	return map[string]any{}
+}
+
+// addStructProperties adds the JSON properties of struct t to props.
+// Embedded structs are inlined, as encoding/json does, and envPrefix tags
+// accumulate the way github.com/caarlos0/env applies them.
+func addStructProperties(t reflect.Type, envPrefix string, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		prefix := envPrefix + field.Tag.Get("envPrefix")
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructProperties(ft, prefix, props)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fs := schemaFor(field.Type, prefix)
+		if env, _, _ := strings.Cut(field.Tag.Get("env"), ","); env != "" {
+			fs["x-env"] = envPrefix + env
+		}
+		props[name] = fs
+	}
+}
@@ -0,0 +1,335 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSecretLength keeps short placeholder values such as "x" or "none" out of
+// the secret list; masking them would mangle unrelated text.
+const minSecretLength = 8
+
+// secretFieldMarkers are the words in a JSON tag or map key that identify
+// credential fields, e.g. "api_key" or "Authorization".
+var secretFieldMarkers = []string{
+	"key", "token", "secret", "password", "passwd", "authorization",
+	"apikey", "accesstoken", "authtoken",
+}
+
+// nonSecretSuffixes are final words of names that describe a credential
+// rather than hold one, e.g. "tls_key_file" or "summarize_token_percent".
+var nonSecretSuffixes = []string{"file", "path", "dir", "field", "percent", "query", "count", "limit", "url"}
+
+// Secret reference prefixes. A secret-bearing field whose value starts with
+// one of these is resolved at load time instead of being used literally.
+const (
+	SecretRefEnv  = "env:"
+	SecretRefFile = "file:"
+	SecretRefCmd  = "cmd:"
+)
+
+// secretCmdTimeout bounds how long a cmd: reference may run.
+const secretCmdTimeout = 10 * time.Second
+
+// secretRef records a reference resolved by LoadConfig so that SaveConfig can
+// write the reference back instead of the secret.
+type secretRef struct {
+	ref   string
+	value string
+	err   error
+}
+
+// SecretRefStatus describes one secret reference found in the config.
+type SecretRefStatus struct {
+	Path string // JSON path of the field, e.g. "channels.telegram.token"
+	Ref  string // the reference as written, e.g. "env:TELEGRAM_TOKEN"
+	Err  error  // nil if the reference resolved to a non-empty value
+}
+
+// IsSecretRef reports whether s is a secret reference rather than a literal.
+func IsSecretRef(s string) bool {
+	return strings.HasPrefix(s, SecretRefEnv) ||
+		strings.HasPrefix(s, SecretRefFile) ||
+		strings.HasPrefix(s, SecretRefCmd)
+}
+
+// ResolveSecretRef returns the value a secret reference points to:
+//
+//	env:NAME           the environment variable NAME
+//	file:/path         the contents of the file, trimmed
+//	cmd:pass show x    the output of the command, trimmed
+//
+// Values that are not references are returned unchanged.
+func ResolveSecretRef(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, SecretRefEnv):
+		name := strings.TrimSpace(strings.TrimPrefix(ref, SecretRefEnv))
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+
+	case strings.HasPrefix(ref, SecretRefFile):
+		path := expandHome(strings.TrimSpace(strings.TrimPrefix(ref, SecretRefFile)))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading secret file: %w", err)
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "" {
+			return "", fmt.Errorf("secret file %s is empty", path)
+		}
+		return value, nil
+
+	case strings.HasPrefix(ref, SecretRefCmd):
+		command := strings.TrimSpace(strings.TrimPrefix(ref, SecretRefCmd))
+		ctx, cancel := context.WithTimeout(context.Background(), secretCmdTimeout)
+		defer cancel()
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", command)
+		}
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("running secret command: %w", err)
+		}
+		value := strings.TrimSpace(string(out))
+		if value == "" {
+			return "", fmt.Errorf("secret command produced no output")
+		}
+		return value, nil
+	}
+	return ref, nil
+}
+
+// resolveSecretRefs replaces every secret reference in the config with the
+// value it points to. References that fail to resolve leave the field empty;
+// they are reported by SecretRefs rather than failing the whole load, so that
+// a missing key for one channel does not take down the others.
+func (c *Config) resolveSecretRefs() {
+	c.secretRefs = nil
+	walkSecrets(reflect.ValueOf(c).Elem(), "", false, func(path, value string, set func(string)) {
+		if !IsSecretRef(value) {
+			return
+		}
+		resolved, err := ResolveSecretRef(value)
+		if c.secretRefs == nil {
+			c.secretRefs = make(map[string]secretRef)
+		}
+		c.secretRefs[path] = secretRef{ref: value, value: resolved, err: err}
+		set(resolved)
+	})
+}
+
+// SecretRefs returns the secret references found when the config was loaded,
+// sorted by path. Resolved values are never included.
+func (c *Config) SecretRefs() []SecretRefStatus {
+	out := make([]SecretRefStatus, 0, len(c.secretRefs))
+	for path, ref := range c.secretRefs {
+		out = append(out, SecretRefStatus{Path: path, Ref: ref.ref, Err: ref.err})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// WithSecretRefs returns a copy of the config in which every field that was
+// loaded from a secret reference holds the reference again. Fields changed
+// since loading keep their new value. This is the form that is written to
+// disk and shown to users.
+func (c *Config) WithSecretRefs() (*Config, error) {
+	if len(c.secretRefs) == 0 {
+		return c, nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var out Config
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	walkSecrets(reflect.ValueOf(&out).Elem(), "", false, func(path, value string, set func(string)) {
+		if ref, ok := c.secretRefs[path]; ok && value == ref.value {
+			set(ref.ref)
+		}
+	})
+	return &out, nil
+}
+
+// CommandRefs returns the cmd: references written in secret-bearing fields,
+// keyed by JSON path. Only a config loaded with LoadConfigRefs, or decoded
+// from JSON, still holds them.
+func (c *Config) CommandRefs() map[string]string {
+	refs := make(map[string]string)
+	walkSecrets(reflect.ValueOf(c).Elem(), "", false, func(path, value string, _ func(string)) {
+		if strings.HasPrefix(strings.TrimSpace(value), SecretRefCmd) {
+			refs[path] = value
+		}
+	})
+	return refs
+}
+
+// Secrets returns every credential value set in the config (API keys, bot
+// tokens, app secrets, ...), deduplicated. It is used to build redaction
+// rules so that the exact values never reach logs or the model.
+func (c *Config) Secrets() []string {
+	seen := make(map[string]bool)
+	var out []string
+	walkSecrets(reflect.ValueOf(c).Elem(), "", false, func(_, s string, _ func(string)) {
+		s = strings.TrimSpace(s)
+		if len(s) < minSecretLength || seen[s] || IsSecretRef(s) {
+			return
+		}
+		seen[s] = true
+		out = append(out, s)
+	})
+	return out
+}
+
+// walkSecrets calls fn for every string in a secret-bearing field below v,
+// empty or not, with its JSON path and a setter that replaces the value in
+// place.
+func walkSecrets(v reflect.Value, path string, secret bool, fn func(path, value string, set func(string))) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			walkSecrets(v.Elem(), path, secret, fn)
+		}
+	case reflect.String:
+		if secret {
+			fn(path, v.String(), func(s string) {
+				if v.CanSet() {
+					v.SetString(s)
+				}
+			})
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkSecrets(v.Index(i), joinPath(path, strconv.Itoa(i)), secret, fn)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			elem := v.MapIndex(k)
+			childPath := joinPath(path, k.String())
+			childSecret := secret || isSecretName(k.String())
+			if elem.Kind() == reflect.String {
+				if childSecret {
+					fn(childPath, elem.String(), func(s string) {
+						v.SetMapIndex(k, reflect.ValueOf(s).Convert(elem.Type()))
+					})
+				}
+				continue
+			}
+			walkSecrets(elem, childPath, childSecret, fn)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			walkSecrets(v.Field(i), joinPath(path, name), isSecretName(name), fn)
+		}
+	}
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// IsSecretPath reports whether the value at a JSON path such as
+// "channels.telegram.token" holds a credential.
+func IsSecretPath(path string) bool {
+	for _, name := range strings.Split(path, ".") {
+		if isSecretName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretMask replaces literal secrets in config output.
+const secretMask = "********"
+
+// MaskSecrets returns v, the value at path, with every literal secret below
+// it replaced by a mask. Secret references are kept, since they reveal
+// nothing.
+func MaskSecrets(path string, v any) any {
+	switch val := v.(type) {
+	case string:
+		if val != "" && IsSecretPath(path) && !IsSecretRef(val) {
+			return secretMask
+		}
+	case []any:
+		out := make([]any, len(val))
+		for i, e := range val {
+			out[i] = MaskSecrets(path, e)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, e := range val {
+			out[k] = MaskSecrets(joinPath(path, k), e)
+		}
+		return out
+	case *object:
+		out := newObject()
+		for _, k := range val.keys {
+			out.set(k, MaskSecrets(joinPath(path, k), val.vals[k]))
+		}
+		return out
+	}
+	return v
+}
+
+// MaskSecrets replaces every literal secret in the document with a mask,
+// keeping the key order of the file.
+func (d *Document) MaskSecrets() {
+	d.root = MaskSecrets("", d.root)
+}
+
+// isSecretName reports whether a field or map key name holds a credential.
+// Names are matched word by word, so "monkey" or "max_tokens" don't count.
+func isSecretName(name string) bool {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	if len(words) == 0 || words[0] == "max" || slices.Contains(nonSecretSuffixes, words[len(words)-1]) {
+		return false
+	}
+	for _, w := range words {
+		for _, marker := range secretFieldMarkers {
+			if w == marker || w == marker+"s" {
+				return true
+			}
+		}
+	}
+	return false
+}
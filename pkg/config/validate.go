@@ -0,0 +1,407 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/routing/agentid"
+)
+
+// ValidationError describes one problem found in a config file.
+type ValidationError struct {
+	Path       string `json:"path,omitempty"` // JSON path, e.g. "channels.telegram.token"; empty for the whole file
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"` // likely intended value, e.g. the key a typo was meant to be
+}
+
+func (e ValidationError) Error() string {
+	msg := e.Message
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", e.Suggestion)
+	}
+	return msg
+}
+
+// ValidateFile validates the config file at path. It returns an error only
+// if the file cannot be read.
+func ValidateFile(path string) ([]ValidationError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Validate(data), nil
+}
+
+// Validate checks raw config JSON against the schema (unknown keys, wrong
+// types) and the cross-field rules (bindings and agents referring to things
+// that do not exist). Secret references are not resolved, and layering
+// directives are applied as if the file were the only layer.
+func Validate(data []byte) []ValidationError {
+	data = withoutDirectives(data)
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []ValidationError{{Message: describeSyntaxError(data, err)}}
+	}
+
+	errs := validateValue(Schema(), doc, "")
+
+	cfg := DefaultConfig()
+	if m, ok := doc.(map[string]any); ok {
+		if list, ok := m["model_list"].([]any); ok && len(list) > 0 {
+			cfg.ModelList = nil
+		}
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		if len(errs) > 0 {
+			// The type errors found above already explain the failure.
+			return errs
+		}
+		return []ValidationError{{Message: err.Error()}}
+	}
+	cfg.migrateChannelConfigs()
+	if len(cfg.ModelList) == 0 && cfg.HasProvidersConfig() {
+		cfg.ModelList = ConvertProvidersToModelList(cfg)
+	}
+	return append(errs, cfg.ValidateReferences()...)
+}
+
+// ValidateReferences runs the cross-field checks: every model_list entry is
+// complete, bindings point at configured agents, and agents point at models
+// that exist in model_list.
+func (c *Config) ValidateReferences() []ValidationError {
+	var errs []ValidationError
+
+	for i := range c.ModelList {
+		if err := c.ModelList[i].Validate(); err != nil {
+			errs = append(errs, ValidationError{
+				Path:    fmt.Sprintf("model_list.%d", i),
+				Message: err.Error(),
+			})
+		}
+	}
+
+	agentIDs := []string{agentid.Default}
+	if len(c.Agents.List) > 0 {
+		agentIDs = agentIDs[:0]
+		seen := make(map[string]int)
+		for i, ac := range c.Agents.List {
+			id := agentid.Normalize(ac.ID)
+			if prev, ok := seen[id]; ok {
+				errs = append(errs, ValidationError{
+					Path:    fmt.Sprintf("agents.list.%d.id", i),
+					Message: fmt.Sprintf("duplicate agent id %q (also used by agents.list.%d)", ac.ID, prev),
+				})
+				continue
+			}
+			seen[id] = i
+			agentIDs = append(agentIDs, id)
+		}
+	}
+	checkAgent := func(path, id string) {
+		if !containsID(agentIDs, id) {
+			errs = append(errs, ValidationError{
+				Path:       path,
+				Message:    fmt.Sprintf("agent %q is not defined in agents.list", id),
+				Suggestion: closestMatch(agentid.Normalize(id), agentIDs),
+			})
+		}
+	}
+	for i, b := range c.Bindings {
+		checkAgent(fmt.Sprintf("bindings.%d.agent_id", i), b.AgentID)
+	}
+	for i, ac := range c.Agents.List {
+		if ac.Subagents == nil {
+			continue
+		}
+		for j, allowed := range ac.Subagents.AllowAgents {
+			if allowed != "*" {
+				checkAgent(fmt.Sprintf("agents.list.%d.subagents.allow_agents.%d", i, j), allowed)
+			}
+		}
+	}
+
+	// Model references can only be checked against an explicit model_list.
+	if len(c.ModelList) == 0 {
+		return errs
+	}
+	modelNames := make([]string, 0, len(c.ModelList))
+	for _, mc := range c.ModelList {
+		modelNames = append(modelNames, mc.ModelName)
+	}
+	checkModel := func(path, name string) {
+		if name == "" || c.hasModel(name) {
+			return
+		}
+		errs = append(errs, ValidationError{
+			Path:       path,
+			Message:    fmt.Sprintf("model %q is not defined in model_list", name),
+			Suggestion: closestMatch(name, modelNames),
+		})
+	}
+	checkModels := func(path string, m *AgentModelConfig) {
+		if m == nil {
+			return
+		}
+		checkModel(path+".primary", m.Primary)
+		for j, fb := range m.Fallbacks {
+			checkModel(fmt.Sprintf("%s.fallbacks.%d", path, j), fb)
+		}
+	}
+
+	d := &c.Agents.Defaults
+	if d.ModelName != "" {
+		checkModel("agents.defaults.model_name", d.ModelName)
+	} else {
+		checkModel("agents.defaults.model", d.Model)
+	}
+	for i, fb := range d.ModelFallbacks {
+		checkModel(fmt.Sprintf("agents.defaults.model_fallbacks.%d", i), fb)
+	}
+	checkModel("agents.defaults.image_model", d.ImageModel)
+	for i, fb := range d.ImageModelFallbacks {
+		checkModel(fmt.Sprintf("agents.defaults.image_model_fallbacks.%d", i), fb)
+	}
+	for i, ac := range c.Agents.List {
+		checkModels(fmt.Sprintf("agents.list.%d.model", i), ac.Model)
+		if ac.Subagents != nil {
+			checkModels(fmt.Sprintf("agents.list.%d.subagents.model", i), ac.Subagents.Model)
+		}
+	}
+	return errs
+}
+
+// hasModel reports whether name refers to a model_list entry, either by its
+// model_name or by its model identifier (with or without the protocol), the
+// same ways agents resolve models.
+func (c *Config) hasModel(name string) bool {
+	name = strings.TrimSpace(name)
+	for _, mc := range c.ModelList {
+		if mc.ModelName == name || mc.Model == name {
+			return true
+		}
+		if _, id, ok := strings.Cut(mc.Model, "/"); ok && id == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(ids []string, id string) bool {
+	id = agentid.Normalize(id)
+	for _, known := range ids {
+		if known == id {
+			return true
+		}
+	}
+	return false
+}
+
+// validateValue checks v against schema and returns the problems found below
+// path. It understands the subset of JSON Schema produced by Schema.
+func validateValue(schema map[string]any, v any, path string) []ValidationError {
+	if v == nil {
+		// encoding/json leaves the field at its zero value for null.
+		return nil
+	}
+
+	if branches, ok := schema["oneOf"].([]any); ok {
+		var types []string
+		for _, b := range branches {
+			bs := b.(map[string]any)
+			if len(validateValue(bs, v, path)) == 0 {
+				return nil
+			}
+			types = append(types, schemaTypes(bs)...)
+		}
+		return []ValidationError{{
+			Path:    path,
+			Message: fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), jsonType(v)),
+		}}
+	}
+
+	types := schemaTypes(schema)
+	if len(types) > 0 && !matchesType(types, v) {
+		return []ValidationError{{
+			Path:    path,
+			Message: fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), jsonType(v)),
+		}}
+	}
+
+	var errs []ValidationError
+	switch val := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			childPath := joinPath(path, k)
+			if ps, ok := props[k].(map[string]any); ok {
+				errs = append(errs, validateValue(ps, val[k], childPath)...)
+				continue
+			}
+			if ps, ok := matchPatternProperty(schema, k); ok {
+				errs = append(errs, validateValue(ps, val[k], childPath)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case map[string]any:
+				errs = append(errs, validateValue(extra, val[k], childPath)...)
+			case bool:
+				if !extra {
+					known := make([]string, 0, len(props))
+					for name := range props {
+						known = append(known, name)
+					}
+					errs = append(errs, ValidationError{
+						Path:       childPath,
+						Message:    "unknown key",
+						Suggestion: closestMatch(k, known),
+					})
+				}
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				errs = append(errs, validateValue(items, item, joinPath(path, strconv.Itoa(i)))...)
+			}
+		}
+	}
+	return errs
+}
+
+func matchPatternProperty(schema map[string]any, key string) (map[string]any, bool) {
+	patterns, _ := schema["patternProperties"].(map[string]any)
+	for pattern, ps := range patterns {
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(key) {
+			return ps.(map[string]any), true
+		}
+	}
+	return nil, false
+}
+
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+func matchesType(types []string, v any) bool {
+	for _, t := range types {
+		switch val := v.(type) {
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && val == math.Trunc(val)) {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonType(v any) string {
+	switch val := v.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "null"
+}
+
+// describeSyntaxError turns a JSON syntax error into a message with the line
+// and column where it occurred.
+func describeSyntaxError(data []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return "invalid JSON: " + err.Error()
+	}
+	offset := int(syntaxErr.Offset)
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	col := offset - bytes.LastIndexByte(data[:offset], '\n')
+	return fmt.Sprintf("invalid JSON at line %d, column %d: %s", line, col, syntaxErr.Error())
+}
+
+// closestMatch returns the candidate closest to s by edit distance, or "" if
+// none is close enough to be a plausible typo.
+func closestMatch(s string, candidates []string) string {
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		d := editDistance(strings.ToLower(s), strings.ToLower(c))
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	limit := max(2, len(s)/3)
+	if bestDist < 0 || bestDist > limit {
+		return ""
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSchema_EnvAndEmbeddedFields(t *testing.T) {
+	s := Schema()
+	if s["$schema"] != SchemaURL {
+		t.Errorf("$schema = %v", s["$schema"])
+	}
+
+	prop := func(m map[string]any, path ...string) map[string]any {
+		for _, p := range path {
+			m = m["properties"].(map[string]any)[p].(map[string]any)
+		}
+		return m
+	}
+	if env := prop(s, "gateway", "port")["x-env"]; env != "PICOCLAW_GATEWAY_PORT" {
+		t.Errorf("gateway.port x-env = %v", env)
+	}
+	// ToolConfig is embedded with an envPrefix; its fields are inlined.
+	if env := prop(s, "tools", "mcp", "enabled")["x-env"]; env != "PICOCLAW_TOOLS_MCP_ENABLED" {
+		t.Errorf("tools.mcp.enabled x-env = %v", env)
+	}
+	if _, err := json.Marshal(s); err != nil {
+		t.Fatalf("schema is not serializable: %v", err)
+	}
+}
+
+func TestValidate_ExampleConfig(t *testing.T) {
+	errs, err := ValidateFile(filepath.Join("..", "..", "config", "config.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range errs {
+		t.Errorf("unexpected error: %v", e)
+	}
+}
+
+func TestValidate_UnknownKeysAndTypes(t *testing.T) {
+	errs := Validate([]byte(`{
+		"channels": {"telegram": {"enabled": "yes", "tokn": "x"}},
+		"gateway": {"port": 1.5},
+		"agents": {"defaults": {"max_tokens": 100}}
+	}`))
+	want := map[string]string{
+		"channels.telegram.enabled": "expected boolean, got string",
+		"channels.telegram.tokn":    "unknown key",
+		"gateway.port":              "expected integer, got number",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), errs)
+	}
+	for _, e := range errs {
+		if want[e.Path] != e.Message {
+			t.Errorf("%s: message %q, want %q", e.Path, e.Message, want[e.Path])
+		}
+		if e.Path == "channels.telegram.tokn" && e.Suggestion != "token" {
+			t.Errorf("suggestion = %q, want token", e.Suggestion)
+		}
+	}
+}
+
+func TestValidate_CrossFieldReferences(t *testing.T) {
+	errs := Validate([]byte(`{
+		"model_list": [{"model_name": "gpt-5", "model": "openai/gpt-5", "api_key": "k"}],
+		"agents": {
+			"defaults": {"model_name": "gpt5"},
+			"list": [{"id": "support", "model": "openai/gpt-5"}, {"id": "sales", "model": {"primary": "claude"}}]
+		},
+		"bindings": [{"agent_id": "suport", "match": {"channel": "telegram"}}]
+	}`))
+
+	byPath := make(map[string]ValidationError)
+	for _, e := range errs {
+		byPath[e.Path] = e
+	}
+	if len(errs) != 3 {
+		t.Fatalf("got %d errors, want 3: %v", len(errs), errs)
+	}
+	if e := byPath["agents.defaults.model_name"]; e.Suggestion != "gpt-5" {
+		t.Errorf("defaults model: %+v", e)
+	}
+	if e := byPath["agents.list.1.model.primary"]; !strings.Contains(e.Message, `"claude"`) {
+		t.Errorf("agent model: %+v", e)
+	}
+	if e := byPath["bindings.0.agent_id"]; e.Suggestion != "support" {
+		t.Errorf("binding: %+v", e)
+	}
+}
+
+func TestValidate_AgentIDsNormalizedLikeRouting(t *testing.T) {
+	// The router treats "Sales Team" and "sales-team" as the same agent, and
+	// "a b" and "a-b" as a duplicate.
+	errs := Validate([]byte(`{
+		"agents": {"list": [{"id": "sales-team"}, {"id": "a b"}, {"id": "a-b"}]},
+		"bindings": [{"agent_id": "Sales Team", "match": {"channel": "telegram"}}]
+	}`))
+	if len(errs) != 1 || errs[0].Path != "agents.list.2.id" {
+		t.Fatalf("got %v, want only the duplicate agents.list.2.id", errs)
+	}
+}
+
+func TestValidate_SyntaxError(t *testing.T) {
+	errs := Validate([]byte("{\n  \"gateway\": {,\n}"))
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "line 2") {
+		t.Errorf("got %v, want a syntax error on line 2", errs)
+	}
+}
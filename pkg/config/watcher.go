@@ -0,0 +1,66 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ChangedSections returns the JSON names of the top-level config sections
+// (e.g. "channels", "model_list") that differ between old and next.
+func ChangedSections(old, next *Config) []string {
+	ov := reflect.ValueOf(old).Elem()
+	nv := reflect.ValueOf(next).Elem()
+	t := ov.Type()
+
+	var changed []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+		changed = append(changed, name)
+	}
+	return changed
+}
+
+// WatchFile polls path every interval and calls onChange when the file's
+// modification time or size changes. Polling is used instead of filesystem
+// notifications so it also works for editors that replace the file and on
+// filesystems without inotify support. WatchFile blocks until ctx is done.
+func WatchFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	stamp := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+
+	lastMod, lastSize := stamp()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mod, size := stamp()
+			if size < 0 || (mod.Equal(lastMod) && size == lastSize) {
+				continue
+			}
+			lastMod, lastSize = mod, size
+			onChange()
+		}
+	}
+}
@@ -7,6 +7,7 @@ var internalChannels = map[string]struct{}{
 	"cli":      {},
 	"system":   {},
 	"subagent": {},
+	"openai":   {}, // OpenAI-compatible API; answers go back in the HTTP response
 }
 
 // IsInternalChannel returns true if the channel is an internal channel.
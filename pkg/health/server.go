@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"maps"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -16,6 +17,7 @@ type Server struct {
 	ready     bool
 	checks    map[string]Check
 	startTime time.Time
+	reload    func() error
 }
 
 type Check struct {
@@ -41,6 +43,7 @@ func NewServer(host string, port int) *Server {
 
 	mux.HandleFunc("/health", s.healthHandler)
 	mux.HandleFunc("/ready", s.readyHandler)
+	mux.HandleFunc("POST /reload", s.reloadHandler)
 
 	addr := fmt.Sprintf("%s:%d", host, port)
 	s.server = &http.Server{
@@ -155,11 +158,70 @@ func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// RegisterOnMux registers /health and /ready handlers onto the given mux.
-// This allows the health endpoints to be served by a shared HTTP server.
+// SetReloadFunc sets the function called by POST /reload to reload the
+// configuration. Without one, the endpoint responds 503.
+func (s *Server) SetReloadFunc(fn func() error) {
+	s.mu.Lock()
+	s.reload = fn
+	s.mu.Unlock()
+}
+
+// reloadHandler triggers a config reload. It is only served to clients on
+// the same host, since it lets the caller make the gateway re-read its config.
+func (s *Server) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !isLocalRequest(r) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"status": "forbidden"})
+		return
+	}
+
+	s.mu.RLock()
+	reload := s.reload
+	s.mu.RUnlock()
+	if reload == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "reload not available"})
+		return
+	}
+
+	if err := reload(); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{"status": "rejected", "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "reloaded"})
+}
+
+// isLocalRequest reports whether r comes from the loopback interface or from
+// the address the server itself is listening on.
+func isLocalRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if localHost, _, err := net.SplitHostPort(local.String()); err == nil {
+			return ip.Equal(net.ParseIP(localHost))
+		}
+	}
+	return false
+}
+
+// RegisterOnMux registers /health, /ready and /reload handlers onto the given
+// mux. This allows the health endpoints to be served by a shared HTTP server.
 func (s *Server) RegisterOnMux(mux *http.ServeMux) {
 	mux.HandleFunc("/health", s.healthHandler)
 	mux.HandleFunc("/ready", s.readyHandler)
+	mux.HandleFunc("POST /reload", s.reloadHandler)
 }
 
 func statusString(ok bool) string {
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/redact"
 )
 
 type LogLevel int
@@ -31,6 +33,7 @@ var (
 	}
 
 	currentLevel = INFO
+	redactor     *redact.Redactor
 	logger       *Logger
 	once         sync.Once
 	mu           sync.RWMutex
@@ -67,6 +70,14 @@ func GetLevel() LogLevel {
 	return currentLevel
 }
 
+// SetRedactor installs r to mask secrets in every log message and field
+// before it is written. Pass nil to disable redaction.
+func SetRedactor(r *redact.Redactor) {
+	mu.Lock()
+	defer mu.Unlock()
+	redactor = r
+}
+
 func EnableFileLogging(filePath string) error {
 	mu.Lock()
 	defer mu.Unlock()
@@ -101,6 +112,8 @@ func logMessage(level LogLevel, component string, message string, fields map[str
 		return
 	}
 
+	message, fields = redactEntry(message, fields)
+
 	entry := LogEntry{
 		Level:     logLevelNames[level],
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
@@ -145,6 +158,39 @@ func logMessage(level LogLevel, component string, message string, fields map[str
 	}
 }
 
+// Redact masks secrets in s with the installed redactor. Use it on text that
+// is truncated for a log message before cutting it: a partial secret no
+// longer matches and would be logged as is.
+func Redact(s string) string {
+	mu.RLock()
+	r := redactor
+	mu.RUnlock()
+	return r.String(s)
+}
+
+// redactEntry masks secrets in a log message and its fields. When anything
+// was masked, a "redactions" field records how many values were replaced.
+func redactEntry(message string, fields map[string]any) (string, map[string]any) {
+	mu.RLock()
+	r := redactor
+	mu.RUnlock()
+	if r == nil {
+		return message, fields
+	}
+
+	message, n := r.Redact(message)
+	redacted, m := r.Fields(fields)
+	if n+m == 0 {
+		return message, fields
+	}
+	out := make(map[string]any, len(redacted)+1)
+	for k, v := range redacted {
+		out[k] = v
+	}
+	out["redactions"] = n + m
+	return message, out
+}
+
 func formatComponent(component string) string {
 	if component == "" {
 		return ""
@@ -1,7 +1,10 @@
 package logger
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/redact"
 )
 
 func TestLogLevelFiltering(t *testing.T) {
@@ -137,3 +140,46 @@ func TestLoggerHelperFunctions(t *testing.T) {
 	DebugC("test", "Debug with component")
 	WarnF("Warning with fields", map[string]any{"key": "value"})
 }
+
+func TestRedactEntry(t *testing.T) {
+	SetRedactor(redact.New(redact.Options{Secrets: []string{"super-secret-value"}}))
+	defer SetRedactor(nil)
+
+	fields := map[string]any{"args": "token=super-secret-value", "iteration": 1}
+	message, got := redactEntry("calling with super-secret-value", fields)
+
+	if message != "calling with [REDACTED:secret]" {
+		t.Errorf("message = %q", message)
+	}
+	if got["args"] != "token=[REDACTED:secret]" {
+		t.Errorf("args = %v", got["args"])
+	}
+	if got["redactions"] != 2 {
+		t.Errorf("redactions = %v, want 2", got["redactions"])
+	}
+	if fields["args"] != "token=super-secret-value" {
+		t.Error("redactEntry must not modify the caller's fields")
+	}
+
+	_, clean := redactEntry("nothing here", map[string]any{"iteration": 1})
+	if _, ok := clean["redactions"]; ok {
+		t.Error("redactions field should only be added when something was masked")
+	}
+}
+
+func TestRedactBeforeTruncate(t *testing.T) {
+	SetRedactor(redact.New(redact.Options{Secrets: []string{"super-secret-value"}}))
+	defer SetRedactor(nil)
+
+	// A preview cut inside the secret would no longer match it.
+	args := `{"token":"super-secret-value"}`
+	preview := Redact(args)[:20]
+	if strings.Contains(preview, "super") {
+		t.Errorf("preview leaks part of the secret: %q", preview)
+	}
+
+	SetRedactor(nil)
+	if got := Redact(args); got != args {
+		t.Errorf("Redact without a redactor = %q", got)
+	}
+}
@@ -0,0 +1,397 @@
+// Package openaiapi serves the agents through an OpenAI-compatible Chat
+// Completions API, so existing OpenAI clients can talk to PicoClaw.
+package openaiapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	// PathPrefix is the path the handler is mounted on.
+	PathPrefix = "/v1/"
+
+	maxBodySize          = 4 << 20
+	defaultTimeout       = 10 * time.Minute
+	defaultSessionHeader = "X-Session-Id"
+	ownedBy              = "picoclaw"
+)
+
+// keepAliveInterval is how often a streaming response sends an SSE comment
+// while the agent is working, so proxies don't drop the idle connection.
+var keepAliveInterval = 15 * time.Second
+
+// Agent is the part of the agent loop the API serves.
+type Agent interface {
+	ListAgentIDs() []string
+	ProcessAPIRequest(ctx context.Context, req agent.APIRequest) (string, error)
+}
+
+// Handler implements /v1/chat/completions and /v1/models.
+type Handler struct {
+	cfg     config.OpenAIAPIConfig
+	agent   Agent
+	timeout time.Duration
+	mux     *http.ServeMux
+}
+
+// NewHandler creates the API handler. At least one API key is required.
+func NewHandler(cfg config.OpenAIAPIConfig, a Agent) (*Handler, error) {
+	if len(cfg.APIKeys) == 0 {
+		return nil, fmt.Errorf("openai_api.api_keys is required")
+	}
+	if cfg.SessionHeader == "" {
+		cfg.SessionHeader = defaultSessionHeader
+	}
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	h := &Handler{cfg: cfg, agent: a, timeout: timeout, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /v1/chat/completions", h.chatCompletions)
+	h.mux.HandleFunc("GET /v1/models", h.listModels)
+	h.mux.HandleFunc("GET /v1/models/{id}", h.getModel)
+	return h, nil
+}
+
+// ServeHTTP authenticates the request and routes it.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticate(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Invalid API key")
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) authenticate(r *http.Request) bool {
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	key = strings.TrimSpace(key)
+	valid := false
+	for _, k := range h.cfg.APIKeys {
+		if k != "" && subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+type model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func (h *Handler) listModels(w http.ResponseWriter, r *http.Request) {
+	ids := h.agent.ListAgentIDs()
+	models := make([]model, 0, len(ids))
+	for _, id := range ids {
+		models = append(models, model{ID: id, Object: "model", OwnedBy: ownedBy})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": models})
+}
+
+func (h *Handler) getModel(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.resolveModel(r.PathValue("id"))
+	if !ok || id == "" {
+		writeError(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+			fmt.Sprintf("The model %q does not exist", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, model{ID: id, Object: "model", OwnedBy: ownedBy})
+}
+
+// resolveModel maps a model name to an agent ID. An empty name selects the
+// default agent and resolves to "".
+func (h *Handler) resolveModel(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", true
+	}
+	if slices.Contains(h.agent.ListAgentIDs(), name) {
+		return name, true
+	}
+	return "", false
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	User     string        `json:"user"`
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message's text. Content is either a string or an array of
+// parts, of which only the text parts are kept.
+func (m chatMessage) text() string {
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return ""
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func (h *Handler) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", "Invalid JSON body")
+		return
+	}
+	agentID, ok := h.resolveModel(req.Model)
+	if !ok {
+		writeError(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+			fmt.Sprintf("The model %q does not exist", req.Model))
+		return
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != "user" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "",
+			"messages must end with a user message")
+		return
+	}
+	content := strings.TrimSpace(req.Messages[len(req.Messages)-1].text())
+	if content == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", "The last message has no text")
+		return
+	}
+
+	// Only the session header keeps a conversation on the server. The user
+	// field names the end user, who may have several conversations, so it
+	// does not select one.
+	apiReq := agent.APIRequest{
+		AgentID:   agentID,
+		SessionID: r.Header.Get(h.cfg.SessionHeader),
+		Content:   content,
+	}
+	if apiReq.SessionID == "" {
+		apiReq.History = history(req.Messages[:len(req.Messages)-1])
+	}
+
+	model := req.Model
+	if model == "" {
+		model = ownedBy
+	}
+	resp := completion{
+		ID:      newCompletionID(),
+		Created: time.Now().Unix(),
+		Model:   model,
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+	// The shared server's write timeout is shorter than an agent turn.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(h.timeout + 10*time.Second))
+
+	logger.DebugCF("openai_api", "Chat completion request", map[string]any{
+		"model":   model,
+		"stream":  req.Stream,
+		"user":    req.User,
+		"session": apiReq.SessionID,
+	})
+
+	if req.Stream {
+		h.stream(ctx, w, apiReq, resp)
+		return
+	}
+
+	reply, err := h.agent.ProcessAPIRequest(ctx, apiReq)
+	if err != nil {
+		logger.ErrorCF("openai_api", "Agent failed", map[string]any{"error": err.Error()})
+		status, code := http.StatusInternalServerError, ""
+		if errors.Is(err, context.DeadlineExceeded) {
+			status, code = http.StatusGatewayTimeout, "timeout"
+		}
+		writeError(w, status, "server_error", code, err.Error())
+		return
+	}
+	resp.Object = "chat.completion"
+	resp.Choices = []choice{{
+		Message:      &delta{Role: "assistant", Content: reply},
+		FinishReason: ptr("stop"),
+	}}
+	resp.Usage = &usage{}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// history converts the earlier messages of a stateless request into the
+// seed of the agent's session. The agent brings its own system prompt, so
+// system messages are dropped, as are tool messages.
+func history(msgs []chatMessage) []providers.Message {
+	var out []providers.Message
+	for _, m := range msgs {
+		if m.Role != "user" && m.Role != "assistant" {
+			continue
+		}
+		if text := m.text(); text != "" {
+			out = append(out, providers.Message{Role: m.Role, Content: text})
+		}
+	}
+	return out
+}
+
+// stream runs the turn and writes it as server-sent events: the role, a line
+// per tool call if enabled, then the answer.
+func (h *Handler) stream(ctx context.Context, w http.ResponseWriter, req agent.APIRequest, resp completion) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "server_error", "", "Streaming unsupported")
+		return
+	}
+
+	progress := make(chan string, 32)
+	if h.cfg.ToolProgress {
+		req.OnToolCall = func(name string, args map[string]any) {
+			select {
+			case progress <- fmt.Sprintf("> 🔧 %s\n\n", name):
+			default:
+			}
+		}
+	}
+	type result struct {
+		reply string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := h.agent.ProcessAPIRequest(ctx, req)
+		done <- result{reply, err}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	resp.Object = "chat.completion.chunk"
+	send := func(d delta, finish *string) {
+		chunk := resp
+		chunk.Choices = []choice{{Delta: &d, FinishReason: finish}}
+		writeEvent(w, chunk)
+		flusher.Flush()
+	}
+	send(delta{Role: "assistant"}, nil)
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case line := <-progress:
+			send(delta{Content: line}, nil)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case res := <-done:
+			for len(progress) > 0 {
+				send(delta{Content: <-progress}, nil)
+			}
+			if res.err != nil {
+				if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return // client went away
+				}
+				logger.ErrorCF("openai_api", "Agent failed", map[string]any{"error": res.err.Error()})
+				writeEvent(w, errorBody("server_error", "", res.err.Error()))
+			} else {
+				send(delta{Content: res.reply}, nil)
+				send(delta{}, ptr("stop"))
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+type completion struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []choice `json:"choices"`
+	Usage   *usage   `json:"usage,omitempty"`
+}
+
+type choice struct {
+	Index        int     `json:"index"`
+	Message      *delta  `json:"message,omitempty"`
+	Delta        *delta  `json:"delta,omitempty"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+type delta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// usage is reported as zeros: a turn may span many LLM calls, and their
+// token counts are not tracked per request.
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func newCompletionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+func ptr(s string) *string { return &s }
+
+func errorBody(typ, code, message string) map[string]any {
+	e := map[string]any{"message": message, "type": typ}
+	if code != "" {
+		e["code"] = code
+	}
+	return map[string]any{"error": e}
+}
+
+func writeError(w http.ResponseWriter, status int, typ, code, message string) {
+	writeJSON(w, status, errorBody(typ, code, message))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeEvent(w http.ResponseWriter, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
@@ -0,0 +1,279 @@
+package openaiapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const apiKey = "sk-test"
+
+type fakeAgent struct {
+	mu       sync.Mutex
+	requests []agent.APIRequest
+	reply    string
+	tools    []string
+	block    chan struct{}
+}
+
+func (f *fakeAgent) ListAgentIDs() []string { return []string{"main", "research"} }
+
+func (f *fakeAgent) ProcessAPIRequest(ctx context.Context, req agent.APIRequest) (string, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	for _, name := range f.tools {
+		if req.OnToolCall != nil {
+			req.OnToolCall(name, nil)
+		}
+	}
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	return f.reply, nil
+}
+
+func (f *fakeAgent) lastRequest() agent.APIRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[len(f.requests)-1]
+}
+
+func newTestServer(t *testing.T, cfg config.OpenAIAPIConfig, a Agent) *httptest.Server {
+	t.Helper()
+	cfg.APIKeys = config.FlexibleStringSlice{apiKey}
+	h, err := NewHandler(cfg, a)
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(PathPrefix, h)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func post(t *testing.T, srv *httptest.Server, body string, header http.Header) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestNewHandler_RequiresKeys(t *testing.T) {
+	if _, err := NewHandler(config.OpenAIAPIConfig{}, &fakeAgent{}); err == nil {
+		t.Fatal("expected error without api_keys")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	srv := newTestServer(t, config.OpenAIAPIConfig{}, &fakeAgent{})
+	for _, auth := range []string{"", "Bearer wrong", apiKey} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/models", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want 401", auth, resp.StatusCode)
+		}
+	}
+}
+
+func TestModels(t *testing.T) {
+	srv := newTestServer(t, config.OpenAIAPIConfig{}, &fakeAgent{})
+
+	get := func(path string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	var list struct {
+		Object string  `json:"object"`
+		Data   []model `json:"data"`
+	}
+	json.NewDecoder(get("/v1/models").Body).Decode(&list)
+	if list.Object != "list" || len(list.Data) != 2 || list.Data[1].ID != "research" || list.Data[1].Object != "model" {
+		t.Fatalf("models = %+v", list)
+	}
+
+	if resp := get("/v1/models/Research"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("known model: status = %d", resp.StatusCode)
+	}
+	if resp := get("/v1/models/gpt-4o"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown model: status = %d", resp.StatusCode)
+	}
+}
+
+func TestChatCompletion(t *testing.T) {
+	a := &fakeAgent{reply: "Paris"}
+	srv := newTestServer(t, config.OpenAIAPIConfig{}, a)
+
+	resp := post(t, srv, `{
+		"model": "research",
+		"messages": [
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": "I am planning a trip"},
+			{"role": "assistant", "content": "Where to?"},
+			{"role": "user", "content": [{"type": "text", "text": "Capital of France?"}, {"type": "image_url", "image_url": {"url": "x"}}]}
+		]
+	}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	var out completion
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Object != "chat.completion" || out.Model != "research" || !strings.HasPrefix(out.ID, "chatcmpl-") {
+		t.Fatalf("completion = %+v", out)
+	}
+	if len(out.Choices) != 1 || out.Choices[0].Message.Content != "Paris" || *out.Choices[0].FinishReason != "stop" {
+		t.Fatalf("choices = %+v", out.Choices)
+	}
+
+	req := a.lastRequest()
+	if req.AgentID != "research" || req.Content != "Capital of France?" || req.SessionID != "" {
+		t.Fatalf("request = %+v", req)
+	}
+	if len(req.History) != 2 || req.History[0].Content != "I am planning a trip" || req.History[1].Role != "assistant" {
+		t.Fatalf("history = %+v", req.History)
+	}
+}
+
+func TestChatCompletion_Sessions(t *testing.T) {
+	a := &fakeAgent{reply: "ok"}
+	srv := newTestServer(t, config.OpenAIAPIConfig{}, a)
+	body := `{"messages": [{"role": "user", "content": "old"}, {"role": "assistant", "content": "x"}, {"role": "user", "content": "hi"}], "user": "alice"}`
+
+	// The user field alone does not select a session; the client's history
+	// is used.
+	post(t, srv, body, nil)
+	if req := a.lastRequest(); req.SessionID != "" || req.AgentID != "" || len(req.History) != 2 {
+		t.Fatalf("user field: request = %+v", req)
+	}
+
+	post(t, srv, body, http.Header{"X-Session-Id": {"conv-7"}})
+	if req := a.lastRequest(); req.SessionID != "conv-7" || req.History != nil {
+		t.Fatalf("session header: request = %+v", req)
+	}
+}
+
+func TestChatCompletion_Errors(t *testing.T) {
+	srv := newTestServer(t, config.OpenAIAPIConfig{}, &fakeAgent{})
+	tests := []struct {
+		name string
+		body string
+		want int
+		code string
+	}{
+		{"invalid JSON", `{`, http.StatusBadRequest, ""},
+		{"unknown model", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}]}`, http.StatusNotFound, "model_not_found"},
+		{"no user message", `{"messages": [{"role": "system", "content": "hi"}]}`, http.StatusBadRequest, ""},
+		{"empty content", `{"messages": [{"role": "user", "content": " "}]}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(t, srv, tt.body, nil)
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			var out struct {
+				Error struct {
+					Type string `json:"type"`
+					Code string `json:"code"`
+				} `json:"error"`
+			}
+			json.NewDecoder(resp.Body).Decode(&out)
+			if out.Error.Type != "invalid_request_error" || out.Error.Code != tt.code {
+				t.Fatalf("error = %+v", out.Error)
+			}
+		})
+	}
+}
+
+func TestChatCompletion_Stream(t *testing.T) {
+	old := keepAliveInterval
+	keepAliveInterval = 10 * time.Millisecond
+	defer func() { keepAliveInterval = old }()
+
+	a := &fakeAgent{reply: "done", tools: []string{"web_search"}, block: make(chan struct{})}
+	srv := newTestServer(t, config.OpenAIAPIConfig{ToolProgress: true}, a)
+	time.AfterFunc(50*time.Millisecond, func() { close(a.block) })
+
+	resp := post(t, srv, `{"model": "main", "stream": true, "messages": [{"role": "user", "content": "search"}]}`, nil)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	var chunks []completion
+	var keepAlives int
+	var sawDone bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, ":"):
+			keepAlives++
+		case line == "data: [DONE]":
+			sawDone = true
+		case strings.HasPrefix(line, "data: "):
+			var c completion
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &c); err != nil {
+				t.Fatalf("bad chunk %q: %v", line, err)
+			}
+			chunks = append(chunks, c)
+		}
+	}
+	if !sawDone || keepAlives == 0 {
+		t.Fatalf("done = %v, keep-alives = %d", sawDone, keepAlives)
+	}
+
+	var content strings.Builder
+	for _, c := range chunks {
+		if c.Object != "chat.completion.chunk" || c.ID != chunks[0].ID {
+			t.Fatalf("chunk = %+v", c)
+		}
+		content.WriteString(c.Choices[0].Delta.Content)
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Fatalf("first chunk = %+v", chunks[0].Choices[0])
+	}
+	if got := content.String(); got != "> 🔧 web_search\n\ndone" {
+		t.Fatalf("content = %q", got)
+	}
+	if last := chunks[len(chunks)-1].Choices[0]; last.FinishReason == nil || *last.FinishReason != "stop" {
+		t.Fatalf("last chunk = %+v", last)
+	}
+}
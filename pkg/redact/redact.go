@@ -0,0 +1,230 @@
+// Package redact masks secrets and personal data in free-form text before it
+// is written to logs, handed to the model, or sent back to a chat.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of detected data; used in the replacement mask.
+const (
+	KindSecret = "secret"
+	KindAPIKey = "api_key"
+	KindToken  = "token"
+	KindEmail  = "email"
+	KindPhone  = "phone"
+)
+
+// Options configures a Redactor.
+type Options struct {
+	// Secrets are exact values (usually the credentials from the loaded
+	// config) that are always masked wherever they appear.
+	Secrets []string
+	// PII enables the email and phone number detectors.
+	PII bool
+}
+
+type detector struct {
+	kind string
+	re   *regexp.Regexp
+	// keep is the index of a submatch that is preserved in front of the
+	// mask, e.g. the "Bearer " prefix. Zero means replace the whole match.
+	keep int
+}
+
+var secretDetectors = []detector{
+	// OpenAI / Anthropic / OpenRouter / DeepSeek style keys.
+	{kind: KindAPIKey, re: regexp.MustCompile(`\bsk-(?:ant-|or-|proj-)?[A-Za-z0-9_\-]{16,}`)},
+	// GitHub personal access and app tokens.
+	{kind: KindToken, re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{30,}|github_pat_[A-Za-z0-9_]{30,})`)},
+	// Slack bot, user and app-level tokens.
+	{kind: KindToken, re: regexp.MustCompile(`\b(?:xox[abposr]|xapp)-[A-Za-z0-9\-]{10,}`)},
+	// Google API keys.
+	{kind: KindAPIKey, re: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`)},
+	// AWS access key IDs.
+	{kind: KindAPIKey, re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	// Telegram bot tokens.
+	{kind: KindToken, re: regexp.MustCompile(`\b[0-9]{8,10}:[A-Za-z0-9_\-]{35}\b`)},
+	// JSON Web Tokens.
+	{kind: KindToken, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`)},
+	// Authorization header values; the scheme is kept for readability.
+	{kind: KindToken, re: regexp.MustCompile(`(?i)(\b(?:bearer|token)\s+)[A-Za-z0-9_\-.=+/]{16,}`), keep: 1},
+}
+
+var piiDetectors = []detector{
+	{kind: KindEmail, re: regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`)},
+	// International numbers with a leading "+", or North American "(555) 123-4567".
+	{kind: KindPhone, re: regexp.MustCompile(`(?:\+[1-9][0-9]{0,2}[\s.\-]?(?:\([0-9]{1,4}\)[\s.\-]?)?[0-9]{2,4}(?:[\s.\-]?[0-9]{2,4}){1,3}|\([0-9]{3}\)\s?[0-9]{3}[\s.\-][0-9]{4})\b`)},
+}
+
+// Redactor masks secrets and, optionally, personal data. A nil *Redactor is
+// valid and leaves text unchanged.
+type Redactor struct {
+	secrets   []string
+	detectors []detector
+}
+
+// New builds a Redactor from opts.
+func New(opts Options) *Redactor {
+	r := &Redactor{}
+
+	seen := make(map[string]bool, len(opts.Secrets))
+	for _, s := range opts.Secrets {
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		r.secrets = append(r.secrets, s)
+	}
+	// Longest first so a secret that contains another is masked as a whole.
+	sort.SliceStable(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+
+	r.detectors = append(r.detectors, secretDetectors...)
+	if opts.PII {
+		r.detectors = append(r.detectors, piiDetectors...)
+	}
+	return r
+}
+
+// Mask returns the replacement text for a value of the given kind.
+func Mask(kind string) string {
+	return fmt.Sprintf("[REDACTED:%s]", kind)
+}
+
+// Redact masks everything the Redactor detects in s and returns the result
+// together with the number of replacements made.
+func (r *Redactor) Redact(s string) (string, int) {
+	if r == nil || s == "" {
+		return s, 0
+	}
+
+	count := 0
+	for _, secret := range r.secrets {
+		if n := strings.Count(s, secret); n > 0 {
+			s = strings.ReplaceAll(s, secret, Mask(KindSecret))
+			count += n
+		}
+	}
+	for _, d := range r.detectors {
+		s = d.re.ReplaceAllStringFunc(s, func(match string) string {
+			count++
+			if d.keep > 0 {
+				sub := d.re.FindStringSubmatch(match)
+				return sub[d.keep] + Mask(d.kind)
+			}
+			return Mask(d.kind)
+		})
+	}
+	return s, count
+}
+
+// String is a convenience wrapper around Redact that drops the count.
+func (r *Redactor) String(s string) string {
+	out, _ := r.Redact(s)
+	return out
+}
+
+// Fields returns a copy of fields with every string value redacted, along
+// with the total number of replacements. Maps and slices, such as tool
+// arguments, are redacted recursively. Other non-string values are formatted
+// first only when they are errors or Stringers; the rest (numbers, booleans)
+// pass through untouched. fields itself is never modified.
+func (r *Redactor) Fields(fields map[string]any) (map[string]any, int) {
+	if r == nil || len(fields) == 0 {
+		return fields, 0
+	}
+	return r.redactMap(fields)
+}
+
+// value redacts a single field value. It returns v itself when nothing was
+// masked.
+func (r *Redactor) value(v any) (any, int) {
+	switch val := v.(type) {
+	case string:
+		return r.changed(v, val)
+	case error:
+		return r.changed(v, val.Error())
+	case fmt.Stringer:
+		return r.changed(v, val.String())
+	case map[string]any:
+		return r.redactMap(val)
+	case map[string]string:
+		out, total := val, 0
+		for k, s := range val {
+			redacted, n := r.Redact(s)
+			if n == 0 {
+				continue
+			}
+			if total == 0 {
+				out = make(map[string]string, len(val))
+				for fk, fv := range val {
+					out[fk] = fv
+				}
+			}
+			out[k] = redacted
+			total += n
+		}
+		return out, total
+	case []any:
+		out, total := val, 0
+		for i, e := range val {
+			redacted, n := r.value(e)
+			if n == 0 {
+				continue
+			}
+			if total == 0 {
+				out = append([]any(nil), val...)
+			}
+			out[i] = redacted
+			total += n
+		}
+		return out, total
+	case []string:
+		out, total := val, 0
+		for i, e := range val {
+			redacted, n := r.Redact(e)
+			if n == 0 {
+				continue
+			}
+			if total == 0 {
+				out = append([]string(nil), val...)
+			}
+			out[i] = redacted
+			total += n
+		}
+		return out, total
+	}
+	return v, 0
+}
+
+func (r *Redactor) changed(v any, text string) (any, int) {
+	redacted, n := r.Redact(text)
+	if n == 0 {
+		return v, 0
+	}
+	return redacted, n
+}
+
+func (r *Redactor) redactMap(m map[string]any) (map[string]any, int) {
+	out, total := m, 0
+	for k, v := range m {
+		redacted, n := r.value(v)
+		if n == 0 {
+			continue
+		}
+		if total == 0 {
+			out = make(map[string]any, len(m))
+			for fk, fv := range m {
+				out[fk] = fv
+			}
+		}
+		out[k] = redacted
+		total += n
+	}
+	return out, total
+}
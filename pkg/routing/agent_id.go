@@ -3,13 +3,15 @@ package routing
 import (
 	"regexp"
 	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/routing/agentid"
 )
 
 const (
-	DefaultAgentID   = "main"
+	DefaultAgentID   = agentid.Default
 	DefaultMainKey   = "main"
 	DefaultAccountID = "default"
-	MaxAgentIDLength = 64
+	MaxAgentIDLength = agentid.MaxLength
 )
 
 var (
@@ -23,24 +25,7 @@ var (
 // Invalid characters are collapsed to "-". Leading/trailing dashes stripped.
 // Empty input returns DefaultAgentID ("main").
 func NormalizeAgentID(id string) string {
-	trimmed := strings.TrimSpace(id)
-	if trimmed == "" {
-		return DefaultAgentID
-	}
-	lower := strings.ToLower(trimmed)
-	if validIDRe.MatchString(lower) {
-		return lower
-	}
-	result := invalidCharsRe.ReplaceAllString(lower, "-")
-	result = leadingDashRe.ReplaceAllString(result, "")
-	result = trailingDashRe.ReplaceAllString(result, "")
-	if len(result) > MaxAgentIDLength {
-		result = result[:MaxAgentIDLength]
-	}
-	if result == "" {
-		return DefaultAgentID
-	}
-	return result
+	return agentid.Normalize(id)
 }
 
 // NormalizeAccountID sanitizes an account ID. Empty returns DefaultAccountID.
@@ -0,0 +1,46 @@
+// Package agentid normalizes agent IDs. It has no dependencies so that both
+// routing and config validation can use it and agree on which IDs are equal.
+package agentid
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// Default is the ID of the implicit main agent.
+	Default = "main"
+	// MaxLength is the longest normalized ID.
+	MaxLength = 64
+)
+
+var (
+	validRe        = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	invalidCharsRe = regexp.MustCompile(`[^a-z0-9_-]+`)
+	leadingDashRe  = regexp.MustCompile(`^-+`)
+	trailingDashRe = regexp.MustCompile(`-+$`)
+)
+
+// Normalize sanitizes an agent ID to [a-z0-9][a-z0-9_-]{0,63}.
+// Invalid characters are collapsed to "-". Leading/trailing dashes stripped.
+// Empty input returns Default ("main").
+func Normalize(id string) string {
+	trimmed := strings.TrimSpace(id)
+	if trimmed == "" {
+		return Default
+	}
+	lower := strings.ToLower(trimmed)
+	if validRe.MatchString(lower) {
+		return lower
+	}
+	result := invalidCharsRe.ReplaceAllString(lower, "-")
+	result = leadingDashRe.ReplaceAllString(result, "")
+	result = trailingDashRe.ReplaceAllString(result, "")
+	if len(result) > MaxLength {
+		result = result[:MaxLength]
+	}
+	if result == "" {
+		return Default
+	}
+	return result
+}
@@ -1,6 +1,8 @@
 package routing
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
 )
@@ -120,6 +122,35 @@ func ParseAgentSessionKey(sessionKey string) *ParsedSessionKey {
 	return &ParsedSessionKey{AgentID: agentID, Rest: rest}
 }
 
+// PeerScope returns a filesystem-safe identifier for the peer a session key
+// belongs to, e.g. "telegram_group_123-1f0c2a9e" or "direct_alice-5d41402a".
+// The readable part is lower-cased and sanitized, so a short hash of the raw
+// key keeps peers that sanitize alike apart. Because it is derived from the
+// routed key, it follows the same dm_scope and identity link rules as session
+// isolation. Keys that are not agent-scoped (heartbeat, cron) have no peer
+// and return "".
+func PeerScope(sessionKey string) string {
+	parsed := ParseAgentSessionKey(sessionKey)
+	if parsed == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, r := range strings.ToLower(parsed.Rest) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	scope := strings.Trim(sb.String(), "._")
+	if scope == "" {
+		scope = DefaultMainKey
+	}
+	sum := sha256.Sum256([]byte(parsed.Rest))
+	return scope + "-" + hex.EncodeToString(sum[:4])
+}
+
 // IsSubagentSessionKey returns true if the session key represents a subagent.
 func IsSubagentSessionKey(sessionKey string) bool {
 	raw := strings.TrimSpace(sessionKey)
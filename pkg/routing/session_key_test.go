@@ -205,3 +205,24 @@ func TestIsSubagentSessionKey(t *testing.T) {
 		}
 	}
 }
+
+func TestPeerScope(t *testing.T) {
+	tests := map[string]string{
+		"agent:main:main":                   "main-0d6e4079",
+		"agent:main:telegram:group:-100123": "telegram_group_-100123-c261e24a",
+		"agent:main:direct:alice":           "direct_alice-e98139a2",
+		"agent:ops:slack:acct:direct:U1/..": "slack_acct_direct_u1-a50a358d",
+		"heartbeat":                         "",
+		"":                                  "",
+	}
+	for key, want := range tests {
+		if got := PeerScope(key); got != want {
+			t.Errorf("PeerScope(%q) = %q, want %q", key, got, want)
+		}
+	}
+
+	// Keys that sanitize to the same name must still get their own scope.
+	if a, b := PeerScope("agent:main:direct:U1"), PeerScope("agent:main:direct:u1"); a == b {
+		t.Errorf("PeerScope collided: %q", a)
+	}
+}
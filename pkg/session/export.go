@@ -0,0 +1,310 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// ExportFormat selects how Export renders a session.
+type ExportFormat string
+
+const (
+	ExportMarkdown ExportFormat = "markdown"
+	ExportHTML     ExportFormat = "html"
+	ExportJSON     ExportFormat = "json"
+)
+
+// ParseExportFormat maps a user-supplied format name to an ExportFormat.
+// An empty string selects Markdown.
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "md", "markdown":
+		return ExportMarkdown, nil
+	case "html", "htm":
+		return ExportHTML, nil
+	case "json":
+		return ExportJSON, nil
+	}
+	return "", fmt.Errorf("unsupported export format %q (want markdown, html or json)", s)
+}
+
+// Extension returns the file extension for the format, including the dot.
+func (f ExportFormat) Extension() string {
+	switch f {
+	case ExportHTML:
+		return ".html"
+	case ExportJSON:
+		return ".json"
+	default:
+		return ".md"
+	}
+}
+
+// ContentType returns the MIME type for the format.
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportHTML:
+		return "text/html"
+	case ExportJSON:
+		return "application/json"
+	default:
+		return "text/markdown"
+	}
+}
+
+// ExportedSession is the normalized, provider-independent form of a session
+// written by the JSON exporter.
+type ExportedSession struct {
+	Key      string            `json:"key"`
+	Title    string            `json:"title,omitempty"`
+	Channel  string            `json:"channel,omitempty"`
+	Summary  string            `json:"summary,omitempty"`
+	Created  time.Time         `json:"created"`
+	Updated  time.Time         `json:"updated"`
+	Messages []ExportedMessage `json:"messages"`
+}
+
+// ExportedMessage is a single normalized message.
+type ExportedMessage struct {
+	Role       string             `json:"role"`
+	Content    string             `json:"content,omitempty"`
+	Media      []string           `json:"media,omitempty"`
+	ToolCalls  []ExportedToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string             `json:"tool_call_id,omitempty"`
+}
+
+// ExportedToolCall is a tool invocation with its arguments as a JSON string.
+type ExportedToolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// Snapshot returns a deep copy of the session stored under key.
+func (sm *SessionManager) Snapshot(key string) (*Session, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	stored, ok := sm.sessions[key]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *stored
+	snapshot.Messages = make([]providers.Message, len(stored.Messages))
+	copy(snapshot.Messages, stored.Messages)
+	return &snapshot, true
+}
+
+// Normalize converts a session into its exported form. Tool call names and
+// arguments are taken from whichever representation the provider filled in.
+func Normalize(s *Session) ExportedSession {
+	out := ExportedSession{
+		Key:      s.Key,
+		Title:    s.Title,
+		Channel:  s.Channel,
+		Summary:  s.Summary,
+		Created:  s.Created,
+		Updated:  s.Updated,
+		Messages: make([]ExportedMessage, 0, len(s.Messages)),
+	}
+	for _, m := range s.Messages {
+		em := ExportedMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			Media:      m.Media,
+			ToolCallID: m.ToolCallID,
+		}
+		for _, tc := range m.ToolCalls {
+			em.ToolCalls = append(em.ToolCalls, normalizeToolCall(tc))
+		}
+		out.Messages = append(out.Messages, em)
+	}
+	return out
+}
+
+func normalizeToolCall(tc providers.ToolCall) ExportedToolCall {
+	etc := ExportedToolCall{ID: tc.ID, Name: tc.Name}
+	if tc.Function != nil {
+		if etc.Name == "" {
+			etc.Name = tc.Function.Name
+		}
+		etc.Arguments = tc.Function.Arguments
+	}
+	if etc.Arguments == "" && len(tc.Arguments) > 0 {
+		if data, err := json.Marshal(tc.Arguments); err == nil {
+			etc.Arguments = string(data)
+		}
+	}
+	return etc
+}
+
+// Export renders a session in the given format.
+func Export(w io.Writer, s *Session, format ExportFormat) error {
+	normalized := Normalize(s)
+	switch format {
+	case ExportJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(normalized)
+	case ExportHTML:
+		return exportHTML(w, normalized)
+	case ExportMarkdown:
+		return exportMarkdown(w, normalized)
+	}
+	return fmt.Errorf("unsupported export format %q", format)
+}
+
+func exportTitle(s ExportedSession) string {
+	if s.Title != "" {
+		return s.Title
+	}
+	return s.Key
+}
+
+func roleLabel(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case "system":
+		return "System"
+	case "tool":
+		return "Tool result"
+	}
+	return role
+}
+
+// fence returns a code fence long enough not to collide with any backtick
+// run inside content.
+func fence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func exportMarkdown(w io.Writer, s ExportedSession) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# %s\n\n", exportTitle(s))
+	fmt.Fprintf(&sb, "- Session: `%s`\n", s.Key)
+	if s.Channel != "" {
+		fmt.Fprintf(&sb, "- Channel: %s\n", s.Channel)
+	}
+	fmt.Fprintf(&sb, "- Created: %s\n", s.Created.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "- Updated: %s\n", s.Updated.Format(time.RFC3339))
+
+	if s.Summary != "" {
+		fmt.Fprintf(&sb, "\n## Summary\n\n%s\n", s.Summary)
+	}
+
+	sb.WriteString("\n## Messages\n")
+	for _, m := range s.Messages {
+		if m.Role == "tool" {
+			f := fence(m.Content)
+			fmt.Fprintf(&sb, "\n<details>\n<summary>Tool result")
+			if m.ToolCallID != "" {
+				fmt.Fprintf(&sb, " (%s)", m.ToolCallID)
+			}
+			fmt.Fprintf(&sb, "</summary>\n\n%s\n%s\n%s\n\n</details>\n", f, m.Content, f)
+			continue
+		}
+
+		fmt.Fprintf(&sb, "\n### %s\n", roleLabel(m.Role))
+		if m.Content != "" {
+			fmt.Fprintf(&sb, "\n%s\n", m.Content)
+		}
+		for _, ref := range m.Media {
+			fmt.Fprintf(&sb, "\n📎 `%s`\n", ref)
+		}
+		for _, tc := range m.ToolCalls {
+			fmt.Fprintf(&sb, "\n**Tool call** `%s`", tc.Name)
+			if tc.ID != "" {
+				fmt.Fprintf(&sb, " (%s)", tc.ID)
+			}
+			sb.WriteString("\n")
+			if tc.Arguments != "" {
+				f := fence(tc.Arguments)
+				fmt.Fprintf(&sb, "\n%sjson\n%s\n%s\n", f, tc.Arguments, f)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+const exportHTMLStyle = `body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",sans-serif;` +
+	`max-width:860px;margin:2em auto;padding:0 1em;color:#222;line-height:1.5}` +
+	`.meta{color:#666;font-size:.9em}.msg{border-radius:8px;padding:.6em 1em;margin:1em 0}` +
+	`.user{background:#eef4ff}.assistant{background:#f4f4f4}.system{background:#fff8e5}` +
+	`.role{font-weight:600;margin-bottom:.3em}pre{white-space:pre-wrap;word-break:break-word;` +
+	`background:#fafafa;border:1px solid #ddd;border-radius:4px;padding:.5em}` +
+	`details{margin:.5em 0 1em}summary{cursor:pointer;color:#555}.content{white-space:pre-wrap}`
+
+func exportHTML(w io.Writer, s ExportedSession) error {
+	var sb strings.Builder
+	esc := html.EscapeString
+
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&sb, "<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n", esc(exportTitle(s)), exportHTMLStyle)
+	fmt.Fprintf(&sb, "<h1>%s</h1>\n<div class=\"meta\">\n", esc(exportTitle(s)))
+	fmt.Fprintf(&sb, "<div>Session: <code>%s</code></div>\n", esc(s.Key))
+	if s.Channel != "" {
+		fmt.Fprintf(&sb, "<div>Channel: %s</div>\n", esc(s.Channel))
+	}
+	fmt.Fprintf(&sb, "<div>Created: %s</div>\n", s.Created.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "<div>Updated: %s</div>\n</div>\n", s.Updated.Format(time.RFC3339))
+
+	if s.Summary != "" {
+		fmt.Fprintf(&sb, "<h2>Summary</h2>\n<div class=\"content\">%s</div>\n", esc(s.Summary))
+	}
+
+	sb.WriteString("<h2>Messages</h2>\n")
+	for _, m := range s.Messages {
+		if m.Role == "tool" {
+			sb.WriteString("<details><summary>Tool result")
+			if m.ToolCallID != "" {
+				fmt.Fprintf(&sb, " (%s)", esc(m.ToolCallID))
+			}
+			fmt.Fprintf(&sb, "</summary><pre>%s</pre></details>\n", esc(m.Content))
+			continue
+		}
+
+		fmt.Fprintf(&sb, "<div class=\"msg %s\">\n<div class=\"role\">%s</div>\n", esc(m.Role), esc(roleLabel(m.Role)))
+		if m.Content != "" {
+			fmt.Fprintf(&sb, "<div class=\"content\">%s</div>\n", esc(m.Content))
+		}
+		for _, ref := range m.Media {
+			fmt.Fprintf(&sb, "<div>📎 <code>%s</code></div>\n", esc(ref))
+		}
+		for _, tc := range m.ToolCalls {
+			fmt.Fprintf(&sb, "<div>Tool call <code>%s</code>", esc(tc.Name))
+			if tc.ID != "" {
+				fmt.Fprintf(&sb, " (%s)", esc(tc.ID))
+			}
+			sb.WriteString("</div>\n")
+			if tc.Arguments != "" {
+				fmt.Fprintf(&sb, "<pre>%s</pre>\n", esc(tc.Arguments))
+			}
+		}
+		sb.WriteString("</div>\n")
+	}
+	sb.WriteString("</body>\n</html>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,114 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func exportFixture() *Session {
+	created := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	return &Session{
+		Key:     "agent:main:telegram:direct:42",
+		Title:   "Weather <check>",
+		Channel: "telegram",
+		Summary: "User asked about weather earlier.",
+		Created: created,
+		Updated: created.Add(time.Minute),
+		Messages: []providers.Message{
+			{Role: "user", Content: "What's the weather?", Media: []string{"media://abc"}},
+			{
+				Role: "assistant",
+				ToolCalls: []providers.ToolCall{{
+					ID:       "call_1",
+					Function: &providers.FunctionCall{Name: "web_search", Arguments: `{"query":"weather"}`},
+				}},
+			},
+			{Role: "tool", Content: "Sunny, 22°C", ToolCallID: "call_1"},
+			{Role: "assistant", Content: "It's sunny."},
+		},
+	}
+}
+
+func TestParseExportFormat(t *testing.T) {
+	tests := map[string]ExportFormat{
+		"":         ExportMarkdown,
+		"md":       ExportMarkdown,
+		"Markdown": ExportMarkdown,
+		"html":     ExportHTML,
+		"json":     ExportJSON,
+	}
+	for input, want := range tests {
+		got, err := ParseExportFormat(input)
+		if err != nil || got != want {
+			t.Errorf("ParseExportFormat(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseExportFormat("pdf"); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
+
+func TestExport_Markdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, exportFixture(), ExportMarkdown); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# Weather <check>",
+		"## Summary",
+		"### User",
+		"`media://abc`",
+		"**Tool call** `web_search` (call_1)",
+		`{"query":"weather"}`,
+		"<details>\n<summary>Tool result (call_1)</summary>",
+		"It's sunny.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("markdown export missing %q\n%s", want, out)
+		}
+	}
+}
+
+func TestExport_HTMLEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, exportFixture(), ExportHTML); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") {
+		t.Error("expected standalone HTML document")
+	}
+	if strings.Contains(out, "<check>") || !strings.Contains(out, "Weather &lt;check&gt;") {
+		t.Error("expected title to be HTML-escaped")
+	}
+	if !strings.Contains(out, "<details><summary>Tool result (call_1)</summary>") {
+		t.Error("expected tool result to be collapsed")
+	}
+}
+
+func TestExport_JSONNormalizesToolCalls(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, exportFixture(), ExportJSON); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	var got ExportedSession
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(got.Messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(got.Messages))
+	}
+	tc := got.Messages[1].ToolCalls
+	if len(tc) != 1 || tc[0].Name != "web_search" || tc[0].Arguments != `{"query":"weather"}` {
+		t.Errorf("unexpected normalized tool calls: %+v", tc)
+	}
+}
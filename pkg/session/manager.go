@@ -2,8 +2,11 @@ package session
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,12 +16,47 @@ import (
 
 type Session struct {
 	Key      string              `json:"key"`
+	Title    string              `json:"title,omitempty"`
+	Channel  string              `json:"channel,omitempty"`
 	Messages []providers.Message `json:"messages"`
 	Summary  string              `json:"summary,omitempty"`
 	Created  time.Time           `json:"created"`
 	Updated  time.Time           `json:"updated"`
 }
 
+// ErrSessionNotFound is returned when a session key or archive ID does not exist.
+var ErrSessionNotFound = errors.New("session not found")
+
+// archiveSeparator joins a routed session key and the ID of a session that
+// was archived from it, e.g. "agent:main:main:archive:20260102-150405".
+const archiveSeparator = ":archive:"
+
+// ArchiveKey returns the storage key of the session archived from key under id.
+func ArchiveKey(key, id string) string {
+	return key + archiveSeparator + id
+}
+
+// SplitArchiveKey splits an archive key into its routed session key and
+// archive ID. ok is false if key is not an archive key.
+func SplitArchiveKey(key string) (base, id string, ok bool) {
+	idx := strings.LastIndex(key, archiveSeparator)
+	if idx <= 0 {
+		return key, "", false
+	}
+	return key[:idx], key[idx+len(archiveSeparator):], true
+}
+
+// SessionInfo is a lightweight description of a stored session.
+type SessionInfo struct {
+	Key      string
+	Title    string
+	Channel  string
+	Messages int
+	Summary  bool
+	Created  time.Time
+	Updated  time.Time
+}
+
 type SessionManager struct {
 	sessions map[string]*Session
 	mu       sync.RWMutex
@@ -179,6 +217,8 @@ func (sm *SessionManager) Save(key string) error {
 
 	snapshot := Session{
 		Key:     stored.Key,
+		Title:   stored.Title,
+		Channel: stored.Channel,
 		Summary: stored.Summary,
 		Created: stored.Created,
 		Updated: stored.Updated,
@@ -233,6 +273,182 @@ func (sm *SessionManager) Save(key string) error {
 	return nil
 }
 
+// SetTitle sets a human-readable title on an existing session.
+func (sm *SessionManager) SetTitle(key, title string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return false
+	}
+	session.Title = title
+	session.Updated = time.Now()
+	return true
+}
+
+// SetChannel records the channel a session was last used from.
+func (sm *SessionManager) SetChannel(key, channel string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if session, ok := sm.sessions[key]; ok && channel != "" {
+		session.Channel = channel
+	}
+}
+
+// Info returns a description of the session stored under key.
+func (sm *SessionManager) Info(key string) (SessionInfo, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return SessionInfo{}, false
+	}
+	return describe(session), true
+}
+
+// List returns a description of every known session, most recently
+// updated first.
+func (sm *SessionManager) List() []SessionInfo {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		infos = append(infos, describe(session))
+	}
+	sortInfos(infos)
+	return infos
+}
+
+// ListArchived returns the sessions archived from key, most recently
+// updated first.
+func (sm *SessionManager) ListArchived(key string) []SessionInfo {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var infos []SessionInfo
+	for k, session := range sm.sessions {
+		if base, _, ok := SplitArchiveKey(k); ok && base == key {
+			infos = append(infos, describe(session))
+		}
+	}
+	sortInfos(infos)
+	return infos
+}
+
+// Archive moves the session stored under key to a new archive key, leaving
+// key free for a fresh conversation. It returns the archive ID, or false if
+// there was nothing worth archiving.
+func (sm *SessionManager) Archive(key string) (string, bool) {
+	sm.mu.Lock()
+	id, ok := sm.archiveLocked(key)
+	sm.mu.Unlock()
+
+	if !ok {
+		return "", false
+	}
+	sm.Save(ArchiveKey(key, id))
+	sm.removeFile(key)
+	return id, true
+}
+
+// Restore makes the archived session id the active session for key. The
+// session currently stored under key, if any, is archived first. It returns
+// the ID the previous session was archived under, or "" if it was empty.
+func (sm *SessionManager) Restore(key, id string) (string, error) {
+	archived := ArchiveKey(key, id)
+
+	sm.mu.Lock()
+	session, ok := sm.sessions[archived]
+	if !ok {
+		sm.mu.Unlock()
+		return "", ErrSessionNotFound
+	}
+	prevID, _ := sm.archiveLocked(key)
+	delete(sm.sessions, archived)
+	session.Key = key
+	session.Updated = time.Now()
+	sm.sessions[key] = session
+	sm.mu.Unlock()
+
+	sm.removeFile(archived)
+	if prevID != "" {
+		sm.Save(ArchiveKey(key, prevID))
+	}
+	return prevID, sm.Save(key)
+}
+
+// Delete removes a session from memory and from disk.
+func (sm *SessionManager) Delete(key string) error {
+	sm.mu.Lock()
+	_, ok := sm.sessions[key]
+	delete(sm.sessions, key)
+	sm.mu.Unlock()
+
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return sm.removeFile(key)
+}
+
+// archiveLocked renames the session under key to a fresh archive key.
+// Empty sessions are dropped instead. Callers must hold sm.mu.
+func (sm *SessionManager) archiveLocked(key string) (string, bool) {
+	session, ok := sm.sessions[key]
+	if !ok {
+		return "", false
+	}
+	delete(sm.sessions, key)
+	if len(session.Messages) == 0 && session.Summary == "" {
+		return "", false
+	}
+
+	base := session.Updated.Format("20060102-150405")
+	id := base
+	for n := 2; ; n++ {
+		if _, exists := sm.sessions[ArchiveKey(key, id)]; !exists {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	session.Key = ArchiveKey(key, id)
+	sm.sessions[session.Key] = session
+	return id, true
+}
+
+func (sm *SessionManager) removeFile(key string) error {
+	if sm.storage == "" {
+		return nil
+	}
+	err := os.Remove(filepath.Join(sm.storage, sanitizeFilename(key)+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func describe(session *Session) SessionInfo {
+	return SessionInfo{
+		Key:      session.Key,
+		Title:    session.Title,
+		Channel:  session.Channel,
+		Messages: len(session.Messages),
+		Summary:  session.Summary != "",
+		Created:  session.Created,
+		Updated:  session.Updated,
+	}
+}
+
+func sortInfos(infos []SessionInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Updated.After(infos[j].Updated)
+	})
+}
+
 func (sm *SessionManager) loadSessions() error {
 	files, err := os.ReadDir(sm.storage)
 	if err != nil {
@@ -72,3 +72,90 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestArchiveAndRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+
+	key := "agent:main:telegram:direct:42"
+	sm.AddMessage(key, "user", "first conversation")
+	sm.SetTitle(key, "first")
+	sm.Save(key)
+
+	id, ok := sm.Archive(key)
+	if !ok {
+		t.Fatal("expected Archive to succeed for non-empty session")
+	}
+	if got := sm.GetHistory(key); len(got) != 0 {
+		t.Fatalf("expected active session to be empty after archive, got %d messages", len(got))
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, sanitizeFilename(key)+".json")); !os.IsNotExist(err) {
+		t.Fatalf("expected active session file to be removed, stat err = %v", err)
+	}
+
+	archived := sm.ListArchived(key)
+	if len(archived) != 1 || archived[0].Title != "first" {
+		t.Fatalf("expected one archived session titled 'first', got %+v", archived)
+	}
+
+	sm.AddMessage(key, "user", "second conversation")
+	prevID, err := sm.Restore(key, id)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if prevID == "" {
+		t.Fatal("expected the second conversation to be archived on restore")
+	}
+
+	history := sm.GetHistory(key)
+	if len(history) != 1 || history[0].Content != "first conversation" {
+		t.Fatalf("expected restored history, got %+v", history)
+	}
+
+	// Both sessions must survive a reload from disk.
+	sm2 := NewSessionManager(tmpDir)
+	if got := sm2.GetHistory(key); len(got) != 1 || got[0].Content != "first conversation" {
+		t.Fatalf("expected restored session after reload, got %+v", got)
+	}
+	if got := sm2.GetHistory(ArchiveKey(key, prevID)); len(got) != 1 || got[0].Content != "second conversation" {
+		t.Fatalf("expected archived session after reload, got %+v", got)
+	}
+}
+
+func TestArchive_EmptySession(t *testing.T) {
+	sm := NewSessionManager("")
+	sm.GetOrCreate("empty")
+
+	if _, ok := sm.Archive("empty"); ok {
+		t.Fatal("expected empty session not to be archived")
+	}
+	if len(sm.List()) != 0 {
+		t.Fatal("expected empty session to be dropped")
+	}
+}
+
+func TestRestore_NotFound(t *testing.T) {
+	sm := NewSessionManager("")
+	if _, err := sm.Restore("key", "missing"); err != ErrSessionNotFound {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+
+	key := "discord:1"
+	sm.AddMessage(key, "user", "hello")
+	sm.Save(key)
+
+	if err := sm.Delete(key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := sm.Delete(key); err != ErrSessionNotFound {
+		t.Fatalf("expected ErrSessionNotFound on second delete, got %v", err)
+	}
+	if len(NewSessionManager(tmpDir).List()) != 0 {
+		t.Fatal("expected no sessions on disk after delete")
+	}
+}
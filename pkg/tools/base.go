@@ -1,6 +1,9 @@
 package tools
 
-import "context"
+import (
+	"context"
+	"regexp"
+)
 
 // Tool is the interface that all tools must implement.
 type Tool interface {
@@ -21,10 +24,24 @@ type Tool interface {
 type toolCtxKey struct{ name string }
 
 var (
-	ctxKeyChannel = &toolCtxKey{"channel"}
-	ctxKeyChatID  = &toolCtxKey{"chatID"}
+	ctxKeyChannel   = &toolCtxKey{"channel"}
+	ctxKeyChatID    = &toolCtxKey{"chatID"}
+	ctxKeyWorkspace = &toolCtxKey{"workspace"}
 )
 
+// WorkspaceScope redirects workspace-restricted file and exec tools to a
+// sub-workspace for the duration of one request, e.g. a per-peer scratch
+// directory when an agent runs with context isolation.
+type WorkspaceScope struct {
+	// Dir replaces the tool's workspace as sandbox root and default cwd.
+	Dir string
+	// AllowPaths are extra patterns outside Dir that remain accessible.
+	AllowPaths []*regexp.Regexp
+	// ReadOnlyPaths are patterns outside Dir that can be read but not
+	// written, e.g. skills shared by every peer.
+	ReadOnlyPaths []*regexp.Regexp
+}
+
 // WithToolContext returns a child context carrying channel and chatID.
 func WithToolContext(ctx context.Context, channel, chatID string) context.Context {
 	ctx = context.WithValue(ctx, ctxKeyChannel, channel)
@@ -44,6 +61,17 @@ func ToolChatID(ctx context.Context) string {
 	return v
 }
 
+// WithWorkspaceScope returns a child context carrying a workspace scope.
+func WithWorkspaceScope(ctx context.Context, scope *WorkspaceScope) context.Context {
+	return context.WithValue(ctx, ctxKeyWorkspace, scope)
+}
+
+// ToolWorkspaceScope extracts the workspace scope from ctx, or nil if unset.
+func ToolWorkspaceScope(ctx context.Context) *WorkspaceScope {
+	v, _ := ctx.Value(ctxKeyWorkspace).(*WorkspaceScope)
+	return v
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
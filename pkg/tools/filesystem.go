@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -123,7 +124,7 @@ func (t *ReadFileTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 		return ErrorResult("path is required")
 	}
 
-	content, err := t.fs.ReadFile(path)
+	content, err := scopedFs(ctx, t.fs).ReadFile(path)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
@@ -178,7 +179,7 @@ func (t *WriteFileTool) Execute(ctx context.Context, args map[string]any) *ToolR
 		return ErrorResult("content is required")
 	}
 
-	if err := t.fs.WriteFile(path, []byte(content)); err != nil {
+	if err := scopedFs(ctx, t.fs).WriteFile(path, []byte(content)); err != nil {
 		return ErrorResult(err.Error())
 	}
 
@@ -224,7 +225,7 @@ func (t *ListDirTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 		path = "."
 	}
 
-	entries, err := t.fs.ReadDir(path)
+	entries, err := scopedFs(ctx, t.fs).ReadDir(path)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to read directory: %v", err))
 	}
@@ -390,15 +391,17 @@ func (r *sandboxFs) ReadDir(path string) ([]os.DirEntry, error) {
 }
 
 // whitelistFs wraps a sandboxFs and allows access to specific paths outside
-// the workspace when they match any of the provided patterns.
+// the workspace when they match any of the provided patterns. Paths matching
+// a readOnly pattern can be read but never written.
 type whitelistFs struct {
 	sandbox  *sandboxFs
 	host     hostFs
 	patterns []*regexp.Regexp
+	readOnly []*regexp.Regexp
 }
 
-func (w *whitelistFs) matches(path string) bool {
-	for _, p := range w.patterns {
+func matchesAny(patterns []*regexp.Regexp, path string) bool {
+	for _, p := range patterns {
 		if p.MatchString(path) {
 			return true
 		}
@@ -406,23 +409,60 @@ func (w *whitelistFs) matches(path string) bool {
 	return false
 }
 
+// hostPath returns the real location of an absolute path: cleaned, and with
+// symlinks in its existing part resolved, so that neither ".." segments nor
+// links can step out of a matching directory. Relative paths return "" and
+// stay in the sandbox.
+func hostPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return ""
+	}
+	abs := filepath.Clean(path)
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	// The file may not exist yet; resolve its closest existing ancestor.
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			rel, _ := filepath.Rel(dir, abs)
+			return filepath.Join(real, rel)
+		}
+		if filepath.Dir(dir) == dir {
+			return abs
+		}
+	}
+}
+
+func (w *whitelistFs) matches(path string) (string, bool) {
+	real := hostPath(path)
+	if real == "" {
+		return "", false
+	}
+	return real, matchesAny(w.patterns, real) || matchesAny(w.readOnly, real)
+}
+
 func (w *whitelistFs) ReadFile(path string) ([]byte, error) {
-	if w.matches(path) {
-		return w.host.ReadFile(path)
+	if real, ok := w.matches(path); ok {
+		return w.host.ReadFile(real)
 	}
 	return w.sandbox.ReadFile(path)
 }
 
 func (w *whitelistFs) WriteFile(path string, data []byte) error {
-	if w.matches(path) {
-		return w.host.WriteFile(path, data)
+	if real := hostPath(path); real != "" {
+		if matchesAny(w.readOnly, real) {
+			return fmt.Errorf("access denied: %s is read-only", path)
+		}
+		if matchesAny(w.patterns, real) {
+			return w.host.WriteFile(real, data)
+		}
 	}
 	return w.sandbox.WriteFile(path, data)
 }
 
 func (w *whitelistFs) ReadDir(path string) ([]os.DirEntry, error) {
-	if w.matches(path) {
-		return w.host.ReadDir(path)
+	if real, ok := w.matches(path); ok {
+		return w.host.ReadDir(real)
 	}
 	return w.sandbox.ReadDir(path)
 }
@@ -440,6 +480,29 @@ func buildFs(workspace string, restrict bool, patterns []*regexp.Regexp) fileSys
 	return sandbox
 }
 
+// scopedFs returns the fileSystem a tool should use for this request. When the
+// request carries a WorkspaceScope, restricted filesystems are re-rooted at the
+// scope's directory; unrestricted access is left untouched.
+func scopedFs(ctx context.Context, fsys fileSystem) fileSystem {
+	scope := ToolWorkspaceScope(ctx)
+	if scope == nil || scope.Dir == "" {
+		return fsys
+	}
+	sandbox := &sandboxFs{workspace: scope.Dir}
+	switch f := fsys.(type) {
+	case *sandboxFs:
+		if len(scope.AllowPaths) > 0 || len(scope.ReadOnlyPaths) > 0 {
+			return &whitelistFs{sandbox: sandbox, patterns: scope.AllowPaths, readOnly: scope.ReadOnlyPaths}
+		}
+		return sandbox
+	case *whitelistFs:
+		patterns := append(slices.Clone(f.patterns), scope.AllowPaths...)
+		readOnly := append(slices.Clone(f.readOnly), scope.ReadOnlyPaths...)
+		return &whitelistFs{sandbox: sandbox, patterns: patterns, readOnly: readOnly}
+	}
+	return fsys
+}
+
 // Helper to get a safe relative path for os.Root usage
 func getSafeRelPath(workspace, path string) (string, error) {
 	if workspace == "" {
@@ -520,3 +520,92 @@ func TestWhitelistFs_AllowsMatchingPaths(t *testing.T) {
 		t.Errorf("expected non-whitelisted path to be blocked, got: %s", result.ForLLM)
 	}
 }
+
+func TestScopedFs_ReRootsRestrictedTools(t *testing.T) {
+	workspace := t.TempDir()
+	peerDir := filepath.Join(workspace, "peers", "alice")
+	sharedDir := filepath.Join(workspace, "shared")
+	os.MkdirAll(peerDir, 0o755)
+	os.MkdirAll(sharedDir, 0o755)
+	os.WriteFile(filepath.Join(workspace, "secret.txt"), []byte("owner only"), 0o644)
+	os.WriteFile(filepath.Join(sharedDir, "notes.txt"), []byte("shared"), 0o644)
+
+	skillsDir := filepath.Join(workspace, "skills")
+	os.MkdirAll(skillsDir, 0o755)
+	os.WriteFile(filepath.Join(skillsDir, "SKILL.md"), []byte("skill"), 0o644)
+
+	ctx := WithWorkspaceScope(context.Background(), &WorkspaceScope{
+		Dir:           peerDir,
+		AllowPaths:    []*regexp.Regexp{regexp.MustCompile("^" + regexp.QuoteMeta(sharedDir))},
+		ReadOnlyPaths: []*regexp.Regexp{regexp.MustCompile("^" + regexp.QuoteMeta(skillsDir))},
+	})
+
+	write := NewWriteFileTool(workspace, true)
+	result := write.Execute(ctx, map[string]any{"path": "scratch.txt", "content": "mine"})
+	assert.False(t, result.IsError, result.ForLLM)
+	assert.FileExists(t, filepath.Join(peerDir, "scratch.txt"))
+	assert.NoFileExists(t, filepath.Join(workspace, "scratch.txt"))
+
+	read := NewReadFileTool(workspace, true)
+	result = read.Execute(ctx, map[string]any{"path": "../../secret.txt"})
+	assert.True(t, result.IsError, "peer must not read outside its scratch directory")
+
+	result = read.Execute(ctx, map[string]any{"path": filepath.Join(sharedDir, "notes.txt")})
+	assert.False(t, result.IsError, result.ForLLM)
+	assert.Equal(t, "shared", result.ForLLM)
+
+	result = read.Execute(ctx, map[string]any{"path": filepath.Join(skillsDir, "SKILL.md")})
+	assert.False(t, result.IsError, result.ForLLM)
+	result = write.Execute(ctx, map[string]any{"path": filepath.Join(skillsDir, "SKILL.md"), "content": "hijacked"})
+	assert.True(t, result.IsError, "peer must not change shared skills")
+	data, _ := os.ReadFile(filepath.Join(skillsDir, "SKILL.md"))
+	assert.Equal(t, "skill", string(data))
+
+	// Without a scope the tool still uses the agent workspace.
+	result = read.Execute(context.Background(), map[string]any{"path": "secret.txt"})
+	assert.False(t, result.IsError, result.ForLLM)
+}
+
+func TestScopedFs_DotDotCannotLeaveAllowedDirs(t *testing.T) {
+	workspace := t.TempDir()
+	peerDir := filepath.Join(workspace, "peers", "alice")
+	bobDir := filepath.Join(workspace, "peers", "bob", "memory")
+	sharedDir := filepath.Join(workspace, "shared")
+	skillsDir := filepath.Join(workspace, "skills")
+	for _, dir := range []string{peerDir, bobDir, sharedDir, skillsDir} {
+		os.MkdirAll(dir, 0o755)
+	}
+	os.WriteFile(filepath.Join(bobDir, "MEMORY.md"), []byte("bob's secret"), 0o644)
+	os.WriteFile(filepath.Join(skillsDir, "SKILL.md"), []byte("skill"), 0o644)
+	os.Symlink(filepath.Join(workspace, "peers", "bob"), filepath.Join(sharedDir, "bob"))
+
+	ctx := WithWorkspaceScope(context.Background(), &WorkspaceScope{
+		Dir:           peerDir,
+		AllowPaths:    []*regexp.Regexp{regexp.MustCompile("^" + regexp.QuoteMeta(sharedDir) + "(/|$)")},
+		ReadOnlyPaths: []*regexp.Regexp{regexp.MustCompile("^" + regexp.QuoteMeta(skillsDir) + "(/|$)")},
+	})
+	read := NewReadFileTool(workspace, true)
+	write := NewWriteFileTool(workspace, true)
+	list := NewListDirTool(workspace, true)
+
+	for _, path := range []string{
+		sharedDir + "/../peers/bob/memory/MEMORY.md",
+		skillsDir + "/../peers/bob/memory/MEMORY.md",
+		filepath.Join(sharedDir, "bob", "memory", "MEMORY.md"),
+	} {
+		result := read.Execute(ctx, map[string]any{"path": path})
+		assert.True(t, result.IsError, "read %s: %s", path, result.ForLLM)
+	}
+	result := list.Execute(ctx, map[string]any{"path": sharedDir + "/../peers/bob"})
+	assert.True(t, result.IsError, result.ForLLM)
+
+	result = write.Execute(ctx, map[string]any{"path": sharedDir + "/../skills/SKILL.md", "content": "hijacked"})
+	assert.True(t, result.IsError, result.ForLLM)
+	data, _ := os.ReadFile(filepath.Join(skillsDir, "SKILL.md"))
+	assert.Equal(t, "skill", string(data))
+
+	result = write.Execute(ctx, map[string]any{"path": sharedDir + "/../peers/bob/memory/MEMORY.md", "content": "overwritten"})
+	assert.True(t, result.IsError, result.ForLLM)
+	data, _ = os.ReadFile(filepath.Join(bobDir, "MEMORY.md"))
+	assert.Equal(t, "bob's secret", string(data))
+}
@@ -3,10 +3,13 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync/atomic"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
-type SendCallback func(channel, chatID, content string) error
+type SendCallback func(channel, chatID, content string, buttons [][]bus.Button) error
 
 type MessageTool struct {
 	sendCallback SendCallback
@@ -41,6 +44,29 @@ func (t *MessageTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Optional: target chat/user ID",
 			},
+			"buttons": map[string]any{
+				"type": "array",
+				"description": "Optional: rows of choices shown as tappable buttons under the message. " +
+					"A tap comes back as a user message containing the button's data (or its text). " +
+					"Channels without buttons list the choices in the message text instead.",
+				"items": map[string]any{
+					"type": "array",
+					"items": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"text": map[string]any{
+								"type":        "string",
+								"description": "Button label",
+							},
+							"data": map[string]any{
+								"type":        "string",
+								"description": "Optional: text sent back when tapped, defaults to the label",
+							},
+						},
+						"required": []string{"text"},
+					},
+				},
+			},
 		},
 		"required": []string{"content"},
 	}
@@ -81,11 +107,16 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 		return &ToolResult{ForLLM: "No target channel/chat specified", IsError: true}
 	}
 
+	buttons, err := parseButtons(args["buttons"])
+	if err != nil {
+		return &ToolResult{ForLLM: err.Error(), IsError: true}
+	}
+
 	if t.sendCallback == nil {
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
 	}
 
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	if err := t.sendCallback(channel, chatID, content, buttons); err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -100,3 +131,41 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 		Silent: true,
 	}
 }
+
+// parseButtons reads the buttons argument. Rows may also be given as plain
+// strings, which are used as both label and data.
+func parseButtons(raw any) ([][]bus.Button, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	rows, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("buttons must be an array of rows")
+	}
+	var buttons [][]bus.Button
+	for _, r := range rows {
+		items, ok := r.([]any)
+		if !ok {
+			items = []any{r} // a single button instead of a row
+		}
+		var row []bus.Button
+		for _, item := range items {
+			var b bus.Button
+			switch v := item.(type) {
+			case string:
+				b.Text = v
+			case map[string]any:
+				b.Text, _ = v["text"].(string)
+				b.Data, _ = v["data"].(string)
+			}
+			if strings.TrimSpace(b.Text) == "" {
+				return nil, fmt.Errorf("each button needs a text label")
+			}
+			row = append(row, b)
+		}
+		if len(row) > 0 {
+			buttons = append(buttons, row)
+		}
+	}
+	return buttons, nil
+}
@@ -4,13 +4,15 @@ import (
 	"context"
 	"errors"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 func TestMessageTool_Execute_Success(t *testing.T) {
 	tool := NewMessageTool()
 
 	var sentChannel, sentChatID, sentContent string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, _ [][]bus.Button) error {
 		sentChannel = channel
 		sentChatID = chatID
 		sentContent = content
@@ -61,7 +63,7 @@ func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 	tool := NewMessageTool()
 
 	var sentChannel, sentChatID string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, _ [][]bus.Button) error {
 		sentChannel = channel
 		sentChatID = chatID
 		return nil
@@ -96,7 +98,7 @@ func TestMessageTool_Execute_SendFailure(t *testing.T) {
 	tool := NewMessageTool()
 
 	sendErr := errors.New("network error")
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, _ [][]bus.Button) error {
 		return sendErr
 	})
 
@@ -149,7 +151,7 @@ func TestMessageTool_Execute_NoTargetChannel(t *testing.T) {
 	tool := NewMessageTool()
 	// No WithToolContext — channel/chatID are empty
 
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, _ [][]bus.Button) error {
 		return nil
 	})
 
@@ -252,3 +254,34 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_Execute_Buttons(t *testing.T) {
+	tool := NewMessageTool()
+
+	var sent [][]bus.Button
+	tool.SetSendCallback(func(channel, chatID, content string, buttons [][]bus.Button) error {
+		sent = buttons
+		return nil
+	})
+
+	ctx := WithToolContext(context.Background(), "telegram", "42")
+	result := tool.Execute(ctx, map[string]any{
+		"content": "Deploy now?",
+		"buttons": []any{
+			[]any{map[string]any{"text": "Yes", "data": "approve"}, "No"},
+			map[string]any{"text": "Ask me later"},
+		},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	want := [][]bus.Button{{{Text: "Yes", Data: "approve"}, {Text: "No"}}, {{Text: "Ask me later"}}}
+	if len(sent) != 2 || len(sent[0]) != 2 || sent[0][0] != want[0][0] || sent[0][1] != want[0][1] || sent[1][0] != want[1][0] {
+		t.Fatalf("buttons = %+v, want %+v", sent, want)
+	}
+
+	result = tool.Execute(ctx, map[string]any{"content": "x", "buttons": []any{[]any{map[string]any{"data": "y"}}}})
+	if !result.IsError {
+		t.Fatal("expected error for a button without text")
+	}
+}
@@ -33,6 +33,17 @@ func (r *ToolRegistry) Register(tool Tool) {
 	r.tools[name] = tool
 }
 
+// Unregister removes a tool by name and reports whether it was registered.
+func (r *ToolRegistry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tools[name]; !exists {
+		return false
+	}
+	delete(r.tools, name)
+	return true
+}
+
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -172,10 +172,15 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 		return ErrorResult("command is required")
 	}
 
-	cwd := t.workingDir
+	workingDir := t.workingDir
+	if scope := ToolWorkspaceScope(ctx); scope != nil && scope.Dir != "" {
+		workingDir = scope.Dir
+	}
+
+	cwd := workingDir
 	if wd, ok := args["working_dir"].(string); ok && wd != "" {
-		if t.restrictToWorkspace && t.workingDir != "" {
-			resolvedWD, err := validatePath(wd, t.workingDir, true)
+		if t.restrictToWorkspace && workingDir != "" {
+			resolvedWD, err := validatePath(wd, workingDir, true)
 			if err != nil {
 				return ErrorResult("Command blocked by safety guard (" + err.Error() + ")")
 			}
@@ -139,7 +139,7 @@ func RunToolLoop(
 				defer wg.Done()
 
 				argsJSON, _ := json.Marshal(tc.Arguments)
-				argsPreview := utils.Truncate(string(argsJSON), 200)
+				argsPreview := utils.Truncate(logger.Redact(string(argsJSON)), 200)
 				logger.InfoCF("toolloop", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
 					map[string]any{
 						"tool":      tc.Name,